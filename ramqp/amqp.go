@@ -0,0 +1,366 @@
+package ramqp
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// HeaderResultID and others are AMQP headers set on published result messages
+const (
+	HeaderResultID = "reactr-result-id"
+	HeaderJobType  = "reactr-job-type"
+)
+
+// maxResubscribeBackoff is the longest a consumer waits between attempts to resubscribe to its queue
+const maxResubscribeBackoff = 30 * time.Second
+
+// Binding connects an AMQP queue to a jobType, and optionally
+// publishes the results of those jobs to an exchange
+type Binding struct {
+	// Queue is the name of the queue to consume from, it must already exist
+	Queue   string
+	JobType string
+
+	// Exchange is where results and errors are published, if empty results are only
+	// published for messages with ReplyTo set (which use the default exchange)
+	Exchange         string
+	ResultRoutingKey string
+	ErrorRoutingKey  string
+
+	// Prefetch limits the number of unacknowledged messages (and therefore in-flight jobs),
+	// and if 0 it will be set to the target thread count of the jobType's worker
+	Prefetch int
+}
+
+// Adapter consumes AMQP messages and turns them into Reactr jobs
+type Adapter struct {
+	reactr *rt.Reactr
+	log    *vlog.Logger
+	conn   *amqp.Connection
+
+	// openChannel opens a channel on the connection, and is replaced with a fake in tests
+	openChannel func() (channel, error)
+
+	channels []channel
+	closed   bool
+	lock     sync.Mutex
+}
+
+// channel is the part of *amqp.Channel used by consumers
+type channel interface {
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Close() error
+}
+
+// New connects to the AMQP server at url and returns an Adapter that schedules jobs on the provided Reactr instance
+func New(r *rt.Reactr, log *vlog.Logger, url string) (*Adapter, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Dial")
+	}
+
+	a := &Adapter{
+		reactr: r,
+		log:    log,
+		conn:   conn,
+		openChannel: func() (channel, error) {
+			return conn.Channel()
+		},
+		channels: []channel{},
+		lock:     sync.Mutex{},
+	}
+
+	return a, nil
+}
+
+// Consume begins consuming messages from the binding's queue. Each message's body is used as the data
+// for a job, and the message is acknowledged once the job completes (or rejected if the job fails).
+// If the binding's channel is closed by the server, the Adapter logs the error and resubscribes to the queue
+// on a new channel, until the Adapter or its connection is closed.
+func (a *Adapter) Consume(binding Binding) error {
+	if !a.reactr.IsRegistered(binding.JobType) {
+		return errors.Errorf("jobType %s is not registered", binding.JobType)
+	}
+
+	prefetch := binding.Prefetch
+	if prefetch == 0 {
+		prefetch = a.reactr.Metrics().Workers[binding.JobType].TargetThreadCount
+		if prefetch < 1 {
+			prefetch = 1
+		}
+	}
+
+	c := &consumer{
+		binding:  binding,
+		prefetch: prefetch,
+		adapter:  a,
+		reactr:   a.reactr,
+		log:      a.log,
+		lock:     sync.Mutex{},
+	}
+
+	deliveries, err := c.subscribe()
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe")
+	}
+
+	go c.consume(deliveries)
+
+	return nil
+}
+
+// Close closes all channels and the underlying connection
+func (a *Adapter) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.closed = true
+
+	for _, ch := range a.channels {
+		ch.Close()
+	}
+
+	a.channels = []channel{}
+
+	return a.conn.Close()
+}
+
+// track adds ch to the channels closed by Close, or returns an error if the Adapter is already closed
+func (a *Adapter) track(ch channel) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.closed {
+		return amqp.ErrClosed
+	}
+
+	a.channels = append(a.channels, ch)
+
+	return nil
+}
+
+// untrack removes ch from the channels closed by Close
+func (a *Adapter) untrack(ch channel) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for i, c := range a.channels {
+		if c == ch {
+			a.channels = append(a.channels[:i], a.channels[i+1:]...)
+			return
+		}
+	}
+}
+
+func (a *Adapter) isClosed() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.closed
+}
+
+// consumer handles the deliveries for a single binding
+type consumer struct {
+	binding  Binding
+	prefetch int
+	adapter  *Adapter
+	reactr   *rt.Reactr
+	log      *vlog.Logger
+
+	ch   channel
+	lock sync.Mutex // amqp channels are not safe to publish and ack from multiple goroutines
+}
+
+// subscribe opens a channel for the consumer (so that prefetch can be controlled for each binding) and begins consuming from its queue
+func (c *consumer) subscribe() (<-chan amqp.Delivery, error) {
+	ch, err := c.adapter.openChannel()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Channel")
+	}
+
+	if err := ch.Qos(c.prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, errors.Wrap(err, "failed to Qos")
+	}
+
+	deliveries, err := ch.Consume(c.binding.Queue, "", false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, errors.Wrap(err, "failed to Consume")
+	}
+
+	if err := c.adapter.track(ch); err != nil {
+		ch.Close()
+		return nil, errors.Wrap(err, "failed to track")
+	}
+
+	c.lock.Lock()
+	c.ch = ch
+	c.lock.Unlock()
+
+	return deliveries, nil
+}
+
+func (c *consumer) consume(deliveries <-chan amqp.Delivery) {
+	for {
+		for d := range deliveries {
+			delivery := d
+
+			res := c.reactr.Do(rt.NewJob(c.binding.JobType, delivery.Body))
+
+			res.ThenDo(func(data interface{}, err error) {
+				c.handleResult(delivery, res.UUID(), data, err)
+			})
+		}
+
+		// deliveries are closed when the Adapter is closed, or when the server closes the channel or connection
+		if c.adapter.isClosed() {
+			return
+		}
+
+		c.log.Error(errors.Errorf("stopped receiving deliveries from queue %s, resubscribing", c.binding.Queue))
+
+		deliveries = c.resubscribe()
+		if deliveries == nil {
+			return
+		}
+	}
+}
+
+// resubscribe replaces the consumer's closed channel, retrying with a backoff until it succeeds or the connection is
+// closed, in which case it returns nil. Jobs for messages from the closed channel can't be acknowledged, so they'll be redelivered
+func (c *consumer) resubscribe() <-chan amqp.Delivery {
+	c.lock.Lock()
+	c.adapter.untrack(c.ch)
+	c.lock.Unlock()
+
+	backoff := time.Second
+
+	for {
+		deliveries, err := c.subscribe()
+		if err == nil {
+			return deliveries
+		}
+
+		if errors.Is(err, amqp.ErrClosed) {
+			if !c.adapter.isClosed() {
+				c.log.Error(errors.Wrapf(err, "stopped consuming from queue %s", c.binding.Queue))
+			}
+
+			return nil
+		}
+
+		c.log.Error(errors.Wrapf(err, "failed to resubscribe to queue %s", c.binding.Queue))
+
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > maxResubscribeBackoff {
+			backoff = maxResubscribeBackoff
+		}
+	}
+}
+
+func (c *consumer) handleResult(d amqp.Delivery, resultID string, data interface{}, jobErr error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	msg := amqp.Publishing{
+		Headers: amqp.Table{
+			HeaderResultID: resultID,
+			HeaderJobType:  c.binding.JobType,
+		},
+		CorrelationId: d.CorrelationId,
+	}
+
+	if msg.CorrelationId == "" {
+		msg.CorrelationId = d.MessageId
+	}
+
+	routingKey := c.binding.ResultRoutingKey
+
+	if jobErr != nil {
+		c.log.Error(errors.Wrapf(jobErr, "job from AMQP message %s returned error result", d.MessageId))
+
+		routingKey = c.binding.ErrorRoutingKey
+		msg.Type = rt.MsgTypeReactrJobErr
+		msg.Body = []byte(jobErr.Error())
+
+		runErr := &rt.RunErr{}
+		if errors.As(jobErr, runErr) {
+			msg.Type = rt.MsgTypeReactrRunErr
+			msg.Body = []byte(runErr.Error())
+		}
+	} else {
+		body, err := resultBytes(data)
+		if err != nil {
+			c.log.Error(errors.Wrap(err, "failed to resultBytes"))
+			msg.Type = rt.MsgTypeReactrJobErr
+			msg.Body = []byte(err.Error())
+		} else {
+			msg.Type = rt.MsgTypeReactrResult
+			msg.Body = body
+		}
+	}
+
+	if err := c.publish(d, routingKey, msg); err != nil {
+		c.log.Error(errors.Wrap(err, "failed to publish result"))
+	}
+
+	if jobErr != nil {
+		// failed jobs are not requeued, dead-lettering can be configured on the queue if needed
+		if err := d.Nack(false, false); err != nil {
+			c.log.Error(errors.Wrap(err, "failed to Nack"))
+		}
+
+		return
+	}
+
+	if err := d.Ack(false); err != nil {
+		c.log.Error(errors.Wrap(err, "failed to Ack"))
+	}
+}
+
+func (c *consumer) publish(d amqp.Delivery, routingKey string, msg amqp.Publishing) error {
+	// if the sender asked for a reply, send it directly (RPC style) via the default exchange
+	if d.ReplyTo != "" {
+		if err := c.ch.Publish("", d.ReplyTo, false, false, msg); err != nil {
+			return errors.Wrap(err, "failed to Publish reply")
+		}
+	}
+
+	if c.binding.Exchange == "" {
+		return nil
+	}
+
+	if err := c.ch.Publish(c.binding.Exchange, routingKey, false, false, msg); err != nil {
+		return errors.Wrap(err, "failed to Publish")
+	}
+
+	return nil
+}
+
+// resultBytes converts a job result into a message body
+func resultBytes(data interface{}) ([]byte, error) {
+	if data == nil {
+		return []byte{}, nil
+	} else if bytes, isBytes := data.([]byte); isBytes {
+		return bytes, nil
+	} else if str, isString := data.(string); isString {
+		return []byte(str), nil
+	}
+
+	resultJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Marshal job result")
+	}
+
+	return resultJSON, nil
+}
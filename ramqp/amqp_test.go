@@ -0,0 +1,218 @@
+package ramqp
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/vektor/vlog"
+)
+
+type publishing struct {
+	exchange string
+	key      string
+	msg      amqp.Publishing
+}
+
+// fakeChannel delivers the messages sent to its deliveries and records what's published on it
+type fakeChannel struct {
+	deliveries chan amqp.Delivery
+	published  chan publishing
+}
+
+func newFakeChannel() *fakeChannel {
+	f := &fakeChannel{
+		deliveries: make(chan amqp.Delivery),
+		published:  make(chan publishing, 10),
+	}
+
+	return f
+}
+
+func (f *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return nil
+}
+
+func (f *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return f.deliveries, nil
+}
+
+func (f *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	f.published <- publishing{exchange: exchange, key: key, msg: msg}
+	return nil
+}
+
+func (f *fakeChannel) Close() error {
+	return nil
+}
+
+// fakeAcknowledger records whether each delivery was acked or nacked
+type fakeAcknowledger chan string
+
+func (f fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	f <- "ack"
+	return nil
+}
+
+func (f fakeAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	f <- "nack"
+	return nil
+}
+
+func (f fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	f <- "reject"
+	return nil
+}
+
+type upper struct{}
+
+func (u upper) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	if string(job.Bytes()) == "fail" {
+		return nil, errors.New("failed")
+	}
+
+	return strings.ToUpper(string(job.Bytes())), nil
+}
+
+func (u upper) OnChange(change rt.ChangeEvent) error {
+	return nil
+}
+
+// newTestAdapter returns an Adapter whose channels are taken from channels, and the number of channels it has opened
+func newTestAdapter(channels ...*fakeChannel) (*Adapter, *int32) {
+	r := rt.New()
+	r.Register("upper", upper{})
+
+	opened := int32(0)
+
+	a := &Adapter{
+		reactr: r,
+		log:    vlog.Default(vlog.Level(vlog.LogLevelError)),
+		openChannel: func() (channel, error) {
+			next := atomic.AddInt32(&opened, 1)
+			if int(next) > len(channels) {
+				return nil, amqp.ErrClosed
+			}
+
+			return channels[next-1], nil
+		},
+		channels: []channel{},
+	}
+
+	return a, &opened
+}
+
+func receive(t *testing.T, published chan publishing) publishing {
+	t.Helper()
+
+	select {
+	case p := <-published:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a message to be published")
+	}
+
+	return publishing{}
+}
+
+func TestConsume(t *testing.T) {
+	ch := newFakeChannel()
+	a, _ := newTestAdapter(ch)
+
+	binding := Binding{
+		Queue:            "jobs",
+		JobType:          "upper",
+		Exchange:         "results",
+		ResultRoutingKey: "done",
+		ErrorRoutingKey:  "failed",
+	}
+
+	if err := a.Consume(binding); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Consume"))
+	}
+
+	t.Run("result", func(t *testing.T) {
+		acks := make(fakeAcknowledger, 1)
+		ch.deliveries <- amqp.Delivery{Acknowledger: acks, MessageId: "1", ReplyTo: "replies", Body: []byte("hello")}
+
+		reply := receive(t, ch.published)
+		if reply.exchange != "" || reply.key != "replies" {
+			t.Errorf("expected reply to be sent to replies, got %s/%s", reply.exchange, reply.key)
+		}
+
+		result := receive(t, ch.published)
+		if result.exchange != "results" || result.key != "done" {
+			t.Errorf("expected result to be published to results/done, got %s/%s", result.exchange, result.key)
+		}
+
+		if string(result.msg.Body) != "HELLO" || result.msg.Type != rt.MsgTypeReactrResult || result.msg.CorrelationId != "1" {
+			t.Errorf("unexpected result message: %+v", result.msg)
+		}
+
+		if result.msg.Headers[HeaderJobType] != "upper" || result.msg.Headers[HeaderResultID] == "" {
+			t.Errorf("unexpected result headers: %v", result.msg.Headers)
+		}
+
+		if ack := <-acks; ack != "ack" {
+			t.Error("expected delivery to be acked, got", ack)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		acks := make(fakeAcknowledger, 1)
+		ch.deliveries <- amqp.Delivery{Acknowledger: acks, MessageId: "2", Body: []byte("fail")}
+
+		result := receive(t, ch.published)
+		if result.exchange != "results" || result.key != "failed" {
+			t.Errorf("expected error to be published to results/failed, got %s/%s", result.exchange, result.key)
+		}
+
+		if result.msg.Type != rt.MsgTypeReactrJobErr {
+			t.Error("expected job error message, got", result.msg.Type)
+		}
+
+		if ack := <-acks; ack != "nack" {
+			t.Error("expected delivery to be nacked, got", ack)
+		}
+	})
+}
+
+func TestConsumeResubscribes(t *testing.T) {
+	first, second := newFakeChannel(), newFakeChannel()
+	a, opened := newTestAdapter(first, second)
+
+	if err := a.Consume(Binding{Queue: "jobs", JobType: "upper"}); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Consume"))
+	}
+
+	// the server closing the channel should cause the consumer to resubscribe on a new one
+	close(first.deliveries)
+
+	acks := make(fakeAcknowledger, 1)
+
+	select {
+	case second.deliveries <- amqp.Delivery{Acknowledger: acks, Body: []byte("hello")}:
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumer did not resubscribe")
+	}
+
+	if ack := <-acks; ack != "ack" {
+		t.Error("expected delivery to be acked, got", ack)
+	}
+
+	a.lock.Lock()
+	a.closed = true
+	a.lock.Unlock()
+
+	// once the Adapter is closed, the consumer should stop rather than resubscribing
+	close(second.deliveries)
+	time.Sleep(100 * time.Millisecond)
+
+	if count := atomic.LoadInt32(opened); count != 2 {
+		t.Errorf("expected 2 channels to be opened, got %d", count)
+	}
+}
@@ -0,0 +1,55 @@
+package ramqp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publisher publishes messages to an exchange, using each message's topic as its routing key.
+// It satisfies rcap.BrokerPublisher, so that Runnables can publish with the message broker capability
+type Publisher struct {
+	exchange string
+
+	ch   *amqp.Channel
+	lock sync.Mutex // amqp channels are not safe to publish from multiple goroutines
+}
+
+// Publisher opens a channel that publishes to exchange, which is closed when the Adapter is closed
+func (a *Adapter) Publisher(exchange string) (*Publisher, error) {
+	ch, err := a.conn.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Channel")
+	}
+
+	if err := a.track(ch); err != nil {
+		ch.Close()
+		return nil, errors.Wrap(err, "failed to track")
+	}
+
+	p := &Publisher{
+		exchange: exchange,
+		ch:       ch,
+		lock:     sync.Mutex{},
+	}
+
+	return p, nil
+}
+
+// Publish publishes data to the exchange with topic as its routing key, giving up once ctx is cancelled
+func (p *Publisher) Publish(ctx context.Context, topic string, data []byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	msg := amqp.Publishing{
+		Body: data,
+	}
+
+	if err := p.ch.PublishWithContext(ctx, p.exchange, topic, false, false, msg); err != nil {
+		return errors.Wrap(err, "failed to PublishWithContext")
+	}
+
+	return nil
+}
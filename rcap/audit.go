@@ -0,0 +1,133 @@
+package rcap
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// The outcomes of host function calls that are recorded by the audit capability
+const (
+	// AuditOutcomeOK means the host function ran and didn't return an error code
+	AuditOutcomeOK = "ok"
+	// AuditOutcomeFailed means the host function ran and returned a negative error code (or failed entirely)
+	AuditOutcomeFailed = "failed"
+	// AuditOutcomeDenied means the call was denied by the policy capability, so the host function didn't run
+	AuditOutcomeDenied = "denied"
+	// AuditOutcomeLimited means the call would have exceeded a limit of the limits capability, so the host function didn't run
+	AuditOutcomeLimited = "limited"
+)
+
+// AuditEvent describes a call to a host function
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	JobType string    `json:"jobType"`
+	JobUUID string    `json:"jobUUID"`
+	Tenant  string    `json:"tenant,omitempty"`
+	HostFn  string    `json:"hostFn"`
+
+	// Args are the host function's arguments other than the ident. Pointers and sizes are recorded as they are, rather than
+	// the data they refer to, so that secrets and other sensitive data passed to the host aren't written to the audit log
+	Args []int32 `json:"args"`
+
+	// PayloadSize is the size of the data the host function was given, as counted by the limits capability
+	PayloadSize int `json:"payloadSize"`
+
+	Outcome string `json:"outcome"`
+
+	// Result is the host function's return value (or the first of them), and Error is set if it failed entirely
+	Result int32  `json:"result"`
+	Error  string `json:"error,omitempty"`
+
+	Duration time.Duration `json:"duration"`
+}
+
+// AuditSink records audit events, such as by writing them to a file or sending them to a SIEM
+type AuditSink interface {
+	// Record records an event. It's called while the job waits for the host function to return, so it should be quick
+	Record(event AuditEvent)
+}
+
+// AuditConfig is configuration for the audit capability, which records calls to host functions for compliance and forensics
+type AuditConfig struct {
+	Enabled bool       `json:"enabled" yaml:"enabled"`
+	Rules   AuditRules `json:"rules" yaml:"rules"`
+
+	// Sink is where events are recorded, which can only be set by the host
+	Sink AuditSink `json:"-" yaml:"-"`
+}
+
+// AuditRules is a set of rules that governs which host function calls are recorded
+type AuditRules struct {
+	// HostFns are the host functions whose calls are recorded, which can be patterns such as db_*
+	// If none are listed, calls to every host function are recorded.
+	HostFns []string `json:"hostFns" yaml:"hostFns"`
+}
+
+// AuditCapability records calls to host functions
+type AuditCapability interface {
+	// Audits returns true if calls to the named host function are recorded
+	Audits(hostFn string) bool
+	// Record records an event
+	Record(event AuditEvent)
+}
+
+type defaultAudit struct {
+	config AuditConfig
+}
+
+// DefaultAudit creates an audit capability that records events in the config's sink
+func DefaultAudit(config AuditConfig) AuditCapability {
+	d := &defaultAudit{
+		config: config,
+	}
+
+	return d
+}
+
+// Audits checks whether calls to a host function are recorded
+func (d *defaultAudit) Audits(hostFn string) bool {
+	if !d.config.Enabled || d.config.Sink == nil {
+		return false
+	}
+
+	if len(d.config.Rules.HostFns) == 0 {
+		return true
+	}
+
+	return matchHostFn(d.config.Rules.HostFns, hostFn)
+}
+
+// Record records an event
+func (d *defaultAudit) Record(event AuditEvent) {
+	if !d.Audits(event.HostFn) {
+		return
+	}
+
+	d.config.Sink.Record(event)
+}
+
+// JSONAuditSink is an AuditSink that writes each event to a writer as a line of JSON
+type JSONAuditSink struct {
+	encoder *json.Encoder
+	lock    sync.Mutex
+}
+
+// NewJSONAuditSink creates a JSONAuditSink that writes to w, such as an append-only file
+func NewJSONAuditSink(w io.Writer) *JSONAuditSink {
+	j := &JSONAuditSink{
+		encoder: json.NewEncoder(w),
+	}
+
+	return j
+}
+
+// Record writes an event
+func (j *JSONAuditSink) Record(event AuditEvent) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	// events that can't be written are dropped rather than failing the job
+	j.encoder.Encode(event)
+}
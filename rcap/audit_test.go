@@ -0,0 +1,40 @@
+package rcap
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	out := &bytes.Buffer{}
+
+	audit := DefaultAudit(AuditConfig{
+		Enabled: true,
+		Rules:   AuditRules{HostFns: []string{"db_*", "secret_get"}},
+		Sink:    NewJSONAuditSink(out),
+	})
+
+	if !audit.Audits("db_exec") || !audit.Audits("secret_get") || audit.Audits("cache_get") {
+		t.Error("expected only db_* and secret_get to be audited")
+	}
+
+	audit.Record(AuditEvent{HostFn: "db_exec", Tenant: "acme", Args: []int32{1024, 12, 0, 0}, Outcome: AuditOutcomeOK, Duration: time.Millisecond})
+	audit.Record(AuditEvent{HostFn: "cache_get", Tenant: "acme", Outcome: AuditOutcomeOK})
+
+	event := AuditEvent{}
+	if err := json.Unmarshal(out.Bytes(), &event); err != nil {
+		t.Fatal("expected a single JSON event, got", out.String())
+	}
+
+	if event.HostFn != "db_exec" || event.Tenant != "acme" || len(event.Args) != 4 {
+		t.Errorf("expected db_exec event for tenant acme, got %+v", event)
+	}
+
+	t.Run("no sink", func(t *testing.T) {
+		if DefaultAudit(AuditConfig{Enabled: true}).Audits("db_exec") {
+			t.Error("expected nothing to be audited without a sink")
+		}
+	})
+}
@@ -0,0 +1,375 @@
+package rcap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrBlobNotFound           = errors.New("blob not found")
+	ErrBlobStoreNotConfigured = errors.New("no blob store is configured")
+
+	// errBlobTooLarge is returned when an object is larger than the size that the caller would read
+	errBlobTooLarge = errors.New("blob is larger than the maximum size")
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// BlobConfig is configuration for the blob capability
+type BlobConfig struct {
+	Enabled bool      `json:"enabled" yaml:"enabled"`
+	Rules   BlobRules `json:"rules" yaml:"rules"`
+	S3      *S3Config `json:"s3,omitempty" yaml:"s3,omitempty"`
+}
+
+// BlobRules is a set of rules that governs use of the blob capability
+type BlobRules struct {
+	AllowPut     bool `json:"allowPut" yaml:"allowPut"`
+	AllowGet     bool `json:"allowGet" yaml:"allowGet"`
+	AllowList    bool `json:"allowList" yaml:"allowList"`
+	AllowPresign bool `json:"allowPresign" yaml:"allowPresign"`
+
+	// MaxPresignSeconds is the longest that a presigned URL can be valid for, or 1 hour if it is 0
+	MaxPresignSeconds int `json:"maxPresignSeconds" yaml:"maxPresignSeconds"`
+}
+
+// S3Config is configuration for a bucket in an object store that uses the S3 API, such as Amazon S3, MinIO,
+// or Google Cloud Storage (with HMAC keys, at https://storage.googleapis.com)
+type S3Config struct {
+	// Endpoint is the store's URL, such as https://s3.us-east-1.amazonaws.com or http://localhost:9000
+	Endpoint        string `json:"endpoint" yaml:"endpoint"`
+	Region          string `json:"region" yaml:"region"`
+	Bucket          string `json:"bucket" yaml:"bucket"`
+	AccessKeyID     string `json:"accessKeyId" yaml:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey" yaml:"secretAccessKey"`
+
+	// PathStyle puts the bucket in the URL's path rather than its host, which MinIO needs by default
+	PathStyle bool `json:"pathStyle" yaml:"pathStyle"`
+}
+
+// BlobCapability gives Runnables the ability to store objects that are too large for the cache
+type BlobCapability interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns ErrBlobNotFound if the object doesn't exist
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the keys that begin with prefix
+	List(ctx context.Context, prefix string) ([]string, error)
+	// PresignURL returns a URL that can be used to GET or PUT the object without credentials until it expires
+	PresignURL(ctx context.Context, method, key string, expiry time.Duration) (string, error)
+}
+
+type s3BlobStore struct {
+	config BlobConfig
+	client *http.Client
+	signer *v4.Signer
+}
+
+// DefaultBlobStore creates a blob store that follows the config's rules
+func DefaultBlobStore(config BlobConfig) BlobCapability {
+	s := &s3BlobStore{
+		config: config,
+		client: http.DefaultClient,
+		signer: v4.NewSigner(func(opts *v4.SignerOptions) {
+			// object keys are escaped once when the URL is built, and S3 expects them to be signed that way
+			opts.DisableURIPathEscaping = true
+		}),
+	}
+
+	return s
+}
+
+// Put stores data as the object key
+func (s *s3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := s.check(s.config.Rules.AllowPut); err != nil {
+		return err
+	}
+
+	req, err := s.request(ctx, http.MethodPut, key, nil, data)
+	if err != nil {
+		return errors.Wrap(err, "failed to request")
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(req, data)
+	if err != nil {
+		return errors.Wrap(err, "failed to do")
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+// Get returns the object key
+func (s *s3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return s.get(ctx, key, 0)
+}
+
+// get returns the object key, or errBlobTooLarge if it's larger than maxSize bytes (unless maxSize is 0)
+func (s *s3BlobStore) get(ctx context.Context, key string, maxSize int64) ([]byte, error) {
+	if err := s.check(s.config.Rules.AllowGet); err != nil {
+		return nil, err
+	}
+
+	req, err := s.request(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to request")
+	}
+
+	resp, err := s.do(req, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to do")
+	}
+
+	defer resp.Body.Close()
+
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return nil, errBlobTooLarge
+	}
+
+	body := io.Reader(resp.Body)
+	if maxSize > 0 {
+		// read one byte past the limit to find out whether the object is larger than it
+		body = io.LimitReader(resp.Body, maxSize+1)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ReadAll")
+	}
+
+	if maxSize > 0 && int64(len(data)) > maxSize {
+		return nil, errBlobTooLarge
+	}
+
+	return data, nil
+}
+
+// s3ListResult is the part of a ListObjectsV2 response that's needed to list keys
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the keys of the objects that begin with prefix
+func (s *s3BlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if err := s.check(s.config.Rules.AllowList); err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	token := ""
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.request(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to request")
+		}
+
+		resp, err := s.do(req, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to do")
+		}
+
+		result := s3ListResult{}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to Decode")
+		}
+
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+
+		token = result.NextContinuationToken
+	}
+
+	return keys, nil
+}
+
+// PresignURL returns a URL for the object key that's valid for the given method until expiry
+func (s *s3BlobStore) PresignURL(ctx context.Context, method, key string, expiry time.Duration) (string, error) {
+	if err := s.check(s.config.Rules.AllowPresign); err != nil {
+		return "", err
+	}
+
+	method = strings.ToUpper(method)
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", fmt.Errorf("URLs can't be presigned for %s requests", method)
+	}
+
+	if key == "" {
+		return "", errors.New("key is empty")
+	}
+
+	maxExpiry := time.Hour
+	if s.config.Rules.MaxPresignSeconds > 0 {
+		maxExpiry = time.Duration(s.config.Rules.MaxPresignSeconds) * time.Second
+	}
+
+	if expiry <= 0 || expiry > maxExpiry {
+		expiry = maxExpiry
+	}
+
+	query := url.Values{}
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expiry/time.Second)))
+
+	req, err := s.request(ctx, method, key, query, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to request")
+	}
+
+	signed, _, err := s.signer.PresignHTTP(ctx, s.credentials(), req, "UNSIGNED-PAYLOAD", "s3", s.config.S3.Region, time.Now())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to PresignHTTP")
+	}
+
+	return signed, nil
+}
+
+// check returns an error if the store can't be used, or if the operation isn't allowed
+func (s *s3BlobStore) check(allowed bool) error {
+	if !s.config.Enabled || !allowed {
+		return ErrCapabilityNotEnabled
+	}
+
+	if s.config.S3 == nil || s.config.S3.Endpoint == "" || s.config.S3.Bucket == "" {
+		return ErrBlobStoreNotConfigured
+	}
+
+	return nil
+}
+
+// request creates an unsigned request for the object key (or the bucket, if key is empty)
+func (s *s3BlobStore) request(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Request, error) {
+	endpoint, err := url.Parse(s.config.S3.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to url.Parse endpoint")
+	}
+
+	path := "/" + key
+	if s.config.S3.PathStyle {
+		path = "/" + s.config.S3.Bucket + path
+	} else {
+		endpoint.Host = s.config.S3.Bucket + "." + endpoint.Host
+	}
+
+	endpoint.Path = path
+	endpoint.RawPath = s3EscapePath(path)
+
+	if query != nil {
+		endpoint.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to NewRequest")
+	}
+
+	return req, nil
+}
+
+// do signs and sends the request, and returns an error if the store didn't respond with success
+func (s *s3BlobStore) do(req *http.Request, body []byte) (*http.Response, error) {
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	if err := s.signer.SignHTTP(req.Context(), s.credentials(), req, payloadHash, "s3", s.config.S3.Region, time.Now()); err != nil {
+		return nil, errors.Wrap(err, "failed to SignHTTP")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Do")
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrBlobNotFound
+	}
+
+	if resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+
+		return nil, fmt.Errorf("blob store responded with status %d: %s", resp.StatusCode, msg)
+	}
+
+	return resp, nil
+}
+
+func (s *s3BlobStore) credentials() aws.Credentials {
+	return aws.Credentials{
+		AccessKeyID:     s.config.S3.AccessKeyID,
+		SecretAccessKey: s.config.S3.SecretAccessKey,
+	}
+}
+
+// s3EscapePath escapes every byte of a path except unreserved characters and slashes, which is how S3 expects keys to be encoded
+func s3EscapePath(path string) string {
+	builder := strings.Builder{}
+
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || strings.IndexByte("-_.~/", c) >= 0 {
+			builder.WriteByte(c)
+		} else {
+			fmt.Fprintf(&builder, "%%%02X", c)
+		}
+	}
+
+	return builder.String()
+}
+
+// defaultBlobRules returns the default rules with all operations allowed
+func defaultBlobRules() BlobRules {
+	b := BlobRules{
+		AllowPut:     true,
+		AllowGet:     true,
+		AllowList:    true,
+		AllowPresign: true,
+	}
+
+	return b
+}
@@ -0,0 +1,208 @@
+package rcap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestBlobStore(t *testing.T) {
+	server := newTestS3Server(t)
+	defer server.Close()
+
+	store := DefaultBlobStore(BlobConfig{
+		Enabled: true,
+		Rules:   defaultBlobRules(),
+		S3: &S3Config{
+			Endpoint:        server.URL,
+			Region:          "us-east-1",
+			Bucket:          "reactr",
+			AccessKeyID:     "AKIDTEST",
+			SecretAccessKey: "secret",
+			PathStyle:       true,
+		},
+	})
+
+	ctx := context.Background()
+
+	for _, key := range []string{"reports/2021 q1.csv", "reports/2021 q2.csv", "reports/2022+q1.csv", "images/logo.png"} {
+		if err := store.Put(ctx, key, []byte("contents of "+key), "text/plain"); err != nil {
+			t.Fatal("failed to Put", err)
+		}
+	}
+
+	t.Run("get", func(t *testing.T) {
+		data, err := store.Get(ctx, "reports/2021 q1.csv")
+		if err != nil {
+			t.Fatal("failed to Get", err)
+		}
+
+		if string(data) != "contents of reports/2021 q1.csv" {
+			t.Errorf("unexpected contents %q", data)
+		}
+
+		if _, err := store.Get(ctx, "missing"); !errors.Is(err, ErrBlobNotFound) {
+			t.Error("expected ErrBlobNotFound, got", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		// the server returns two keys at a time, so this needs more than one page
+		keys, err := store.List(ctx, "reports/")
+		if err != nil {
+			t.Fatal("failed to List", err)
+		}
+
+		if strings.Join(keys, ",") != "reports/2021 q1.csv,reports/2021 q2.csv,reports/2022+q1.csv" {
+			t.Error("unexpected keys", keys)
+		}
+	})
+
+	t.Run("presign", func(t *testing.T) {
+		presigned, err := store.PresignURL(ctx, "get", "images/logo.png", 5*time.Minute)
+		if err != nil {
+			t.Fatal("failed to PresignURL", err)
+		}
+
+		if !strings.Contains(presigned, "X-Amz-Expires=300") || !strings.Contains(presigned, "X-Amz-Signature=") {
+			t.Error("expected a presigned URL, got", presigned)
+		}
+
+		resp, err := http.Get(presigned)
+		if err != nil {
+			t.Fatal("failed to Get presigned URL", err)
+		}
+
+		defer resp.Body.Close()
+
+		if data, _ := io.ReadAll(resp.Body); string(data) != "contents of images/logo.png" {
+			t.Errorf("unexpected contents %q", data)
+		}
+
+		// expiries are limited to an hour by default
+		presigned, _ = store.PresignURL(ctx, "PUT", "images/logo.png", 48*time.Hour)
+		if !strings.Contains(presigned, "X-Amz-Expires=3600") {
+			t.Error("expected expiry to be limited, got", presigned)
+		}
+
+		if _, err := store.PresignURL(ctx, "DELETE", "images/logo.png", time.Minute); err == nil {
+			t.Error("expected DELETE to be rejected")
+		}
+	})
+
+	t.Run("rules", func(t *testing.T) {
+		readOnly := DefaultBlobStore(BlobConfig{Enabled: true, Rules: BlobRules{AllowGet: true}, S3: &S3Config{Endpoint: server.URL, Bucket: "reactr", PathStyle: true}})
+
+		if err := readOnly.Put(ctx, "key", []byte("val"), ""); !errors.Is(err, ErrCapabilityNotEnabled) {
+			t.Error("expected ErrCapabilityNotEnabled, got", err)
+		}
+
+		unconfigured := DefaultBlobStore(BlobConfig{Enabled: true, Rules: defaultBlobRules()})
+
+		if _, err := unconfigured.Get(ctx, "key"); !errors.Is(err, ErrBlobStoreNotConfigured) {
+			t.Error("expected ErrBlobStoreNotConfigured, got", err)
+		}
+	})
+}
+
+func TestBlobRequestURL(t *testing.T) {
+	store := DefaultBlobStore(BlobConfig{S3: &S3Config{Endpoint: "https://s3.us-east-1.amazonaws.com", Bucket: "reactr"}}).(*s3BlobStore)
+
+	req, _ := store.request(context.Background(), http.MethodGet, "reports/2021 q1+final.csv", nil, nil)
+
+	if expected := "https://reactr.s3.us-east-1.amazonaws.com/reports/2021%20q1%2Bfinal.csv"; req.URL.String() != expected {
+		t.Errorf("expected %s, got %s", expected, req.URL.String())
+	}
+
+	store.config.S3.PathStyle = true
+
+	req, _ = store.request(context.Background(), http.MethodGet, "logo.png", nil, nil)
+
+	if expected := "https://s3.us-east-1.amazonaws.com/reactr/logo.png"; req.URL.String() != expected {
+		t.Errorf("expected %s, got %s", expected, req.URL.String())
+	}
+}
+
+// newTestS3Server starts a server that stores objects in memory for path style requests to any bucket,
+// and checks that requests are signed (but not that their signatures are valid)
+func newTestS3Server(t *testing.T) *httptest.Server {
+	objects := map[string][]byte{}
+	lock := sync.Mutex{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		signedHeader := strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDTEST/")
+		signedQuery := r.URL.Query().Get("X-Amz-Signature") != ""
+
+		if !signedHeader && !signedQuery {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		// strip the bucket from the path
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		key := ""
+		if len(parts) == 2 {
+			key = parts[1]
+		}
+
+		switch {
+		case r.Method == http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+
+			sum := sha256.Sum256(body)
+			if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			objects[key] = body
+		case r.URL.Query().Get("list-type") == "2":
+			keys := []string{}
+			for k := range objects {
+				if strings.HasPrefix(k, r.URL.Query().Get("prefix")) && k > r.URL.Query().Get("continuation-token") {
+					keys = append(keys, k)
+				}
+			}
+
+			sort.Strings(keys)
+
+			truncated := len(keys) > 2
+			if truncated {
+				keys = keys[:2]
+			}
+
+			fmt.Fprint(w, "<ListBucketResult>")
+			for _, k := range keys {
+				fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", k)
+			}
+
+			if truncated {
+				fmt.Fprintf(w, "<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>", keys[1])
+			}
+
+			fmt.Fprint(w, "</ListBucketResult>")
+		default:
+			val, exists := objects[key]
+			if !exists {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Write(val)
+		}
+	}))
+}
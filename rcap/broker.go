@@ -0,0 +1,89 @@
+package rcap
+
+import (
+	"context"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrBrokerPublisherNotSet = errors.New("message broker publisher not set")
+	ErrBrokerTopicDisallowed = errors.New("publishing to this topic is disallowed")
+)
+
+// BrokerPublisher publishes messages to an external message broker that the host is connected to, such as those provided by the ramqp, rnats and rkafka packages.
+// Publish should stop waiting on the broker once ctx is cancelled
+type BrokerPublisher interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+}
+
+// MessageBrokerConfig is configuration for the message broker capability, which lets Runnables publish events to external brokers
+type MessageBrokerConfig struct {
+	Enabled bool               `json:"enabled" yaml:"enabled"`
+	Rules   MessageBrokerRules `json:"rules" yaml:"rules"`
+
+	// Publisher is the host's connection to the broker, which can only be set by the host
+	Publisher BrokerPublisher `json:"-" yaml:"-"`
+}
+
+// MessageBrokerRules is a set of rules that governs use of the message broker capability
+type MessageBrokerRules struct {
+	// AllowedTopics are the topics that can be published to, which can be patterns such as orders.*
+	// If none are listed, any topic can be published to.
+	AllowedTopics []string `json:"allowedTopics" yaml:"allowedTopics"`
+}
+
+// MessageBrokerCapability gives Runnables the ability to publish messages to an external broker
+type MessageBrokerCapability interface {
+	Publish(ctx context.Context, topic string, data []byte) error
+}
+
+type defaultMessageBroker struct {
+	config MessageBrokerConfig
+}
+
+// DefaultMessageBroker creates a message broker capability that publishes with the config's publisher
+func DefaultMessageBroker(config MessageBrokerConfig) MessageBrokerCapability {
+	d := &defaultMessageBroker{
+		config: config,
+	}
+
+	return d
+}
+
+// Publish publishes a message to a topic, giving up once ctx is cancelled
+func (d *defaultMessageBroker) Publish(ctx context.Context, topic string, data []byte) error {
+	if !d.config.Enabled {
+		return ErrCapabilityNotEnabled
+	}
+
+	if d.config.Publisher == nil {
+		return ErrBrokerPublisherNotSet
+	}
+
+	if err := d.config.Rules.topicIsAllowed(topic); err != nil {
+		return err
+	}
+
+	return d.config.Publisher.Publish(ctx, topic, data)
+}
+
+// topicIsAllowed returns a non-nil error if the topic isn't allowed to be published to
+func (m MessageBrokerRules) topicIsAllowed(topic string) error {
+	if topic == "" {
+		return errors.Wrap(ErrBrokerTopicDisallowed, "empty topic")
+	}
+
+	if len(m.AllowedTopics) == 0 {
+		return nil
+	}
+
+	for _, allowed := range m.AllowedTopics {
+		if matched, _ := path.Match(allowed, topic); matched {
+			return nil
+		}
+	}
+
+	return ErrBrokerTopicDisallowed
+}
@@ -0,0 +1,45 @@
+package rcap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testPublisher struct {
+	published map[string][]byte
+}
+
+func (t *testPublisher) Publish(ctx context.Context, topic string, data []byte) error {
+	t.published[topic] = data
+	return nil
+}
+
+func TestMessageBroker(t *testing.T) {
+	publisher := &testPublisher{published: map[string][]byte{}}
+
+	broker := DefaultMessageBroker(MessageBrokerConfig{
+		Enabled:   true,
+		Rules:     MessageBrokerRules{AllowedTopics: []string{"orders.*"}},
+		Publisher: publisher,
+	})
+
+	if err := broker.Publish(context.Background(), "orders.created", []byte("hello")); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Publish"))
+	}
+
+	if string(publisher.published["orders.created"]) != "hello" {
+		t.Error("expected message to be published, got", publisher.published)
+	}
+
+	if err := broker.Publish(context.Background(), "payments.created", []byte("hello")); !errors.Is(err, ErrBrokerTopicDisallowed) {
+		t.Error("expected ErrBrokerTopicDisallowed, got", err)
+	}
+
+	noPublisher := DefaultMessageBroker(MessageBrokerConfig{Enabled: true})
+
+	if err := noPublisher.Publish(context.Background(), "orders.created", []byte("hello")); !errors.Is(err, ErrBrokerPublisherNotSet) {
+		t.Error("expected ErrBrokerPublisherNotSet, got", err)
+	}
+}
@@ -1,6 +1,10 @@
 package rcap
 
 import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,17 +14,30 @@ import (
 // ErrCacheKeyNotFound is returned when a non-existent cache key is requested
 var ErrCacheKeyNotFound = errors.New("key not found")
 
+// ErrCacheValueNotInteger is returned when a value that isn't a base 10 integer is incremented
+var ErrCacheValueNotInteger = errors.New("value is not an integer")
+
 // CacheConfig is configuration for the cache capability
 type CacheConfig struct {
-	Enabled     bool         `json:"enabled" yaml:"enabled"`
-	Rules       CacheRules   `json:"rules" yaml:"rules"`
-	RedisConfig *RedisConfig `json:"redis,omitempty" yaml:"redis,omitempty"`
+	Enabled bool       `json:"enabled" yaml:"enabled"`
+	Rules   CacheRules `json:"rules" yaml:"rules"`
+
+	// the cache is stored in memory, unless one of the backends below is configured
+	RedisConfig     *RedisConfig     `json:"redis,omitempty" yaml:"redis,omitempty"`
+	MemcachedConfig *MemcachedConfig `json:"memcached,omitempty" yaml:"memcached,omitempty"`
+	BoltConfig      *BoltConfig      `json:"bolt,omitempty" yaml:"bolt,omitempty"`
+
+	// Namespace isolates the cache's keys from those of other namespaces, see NamespacedCache
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
 }
 
 type CacheRules struct {
 	AllowSet    bool `json:"allowSet" yaml:"allowSet"`
 	AllowGet    bool `json:"allowGet" yaml:"allowGet"`
 	AllowDelete bool `json:"allowDelete" yaml:"allowDelete"`
+
+	// AllowedNamespaces are other namespaces whose keys can be used, such as shared::config
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty" yaml:"allowedNamespaces,omitempty"`
 }
 
 // CacheCapability gives Runnables access to a key/value cache
@@ -28,6 +45,28 @@ type CacheCapability interface {
 	Set(key string, val []byte, ttl int) error
 	Get(key string) ([]byte, error)
 	Delete(key string) error
+	// Keys returns the keys that begin with prefix, in no particular order
+	Keys(prefix string) ([]string, error)
+	// Increment atomically adds delta to the integer stored at key (starting from 0 if it doesn't exist) and returns the result
+	Increment(key string, delta int64) (int64, error)
+	// CompareAndSwap atomically sets key to val if its value is old, or if old is nil and the key doesn't exist,
+	// and returns whether it was set
+	CompareAndSwap(key string, old, val []byte, ttl int) (bool, error)
+}
+
+// contextCache is implemented by caches whose calls can be cancelled, such as the Redis cache
+type contextCache interface {
+	withContext(ctx context.Context) CacheCapability
+}
+
+// CacheWithContext returns a cache whose calls are cancelled along with ctx if its backend supports it (such as Redis),
+// or the cache itself if it doesn't. Memcached calls have their own short timeout, and the other backends are local
+func CacheWithContext(cache CacheCapability, ctx context.Context) CacheCapability {
+	if cc, ok := cache.(contextCache); ok {
+		return cc.withContext(ctx)
+	}
+
+	return cache
 }
 
 // memoryCache is a "default" cache implementation for Reactr
@@ -46,7 +85,14 @@ type uniqueVal struct {
 func SetupCache(config CacheConfig) CacheCapability {
 	var cache CacheCapability
 
-	if config.RedisConfig == nil {
+	switch {
+	case config.RedisConfig != nil:
+		cache = newRedisCache(config)
+	case config.MemcachedConfig != nil:
+		cache = newMemcachedCache(config)
+	case config.BoltConfig != nil:
+		cache = newBoltCache(config)
+	default:
 		m := &memoryCache{
 			config: config,
 			values: make(map[string]*uniqueVal),
@@ -54,9 +100,10 @@ func SetupCache(config CacheConfig) CacheCapability {
 		}
 
 		cache = m
-	} else {
-		r := newRedisCache(config)
-		cache = r
+	}
+
+	if config.Namespace != "" {
+		cache = NamespacedCache(cache, config.Namespace, config.Rules.AllowedNamespaces...)
 	}
 
 	return cache
@@ -70,6 +117,13 @@ func (m *memoryCache) Set(key string, val []byte, ttl int) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
+	m.set(key, val, ttl)
+
+	return nil
+}
+
+// set sets the value, and must be called with the lock held
+func (m *memoryCache) set(key string, val []byte, ttl int) {
 	uVal := &uniqueVal{
 		val: val,
 	}
@@ -89,8 +143,6 @@ func (m *memoryCache) Set(key string, val []byte, ttl int) error {
 			}
 		}()
 	}
-
-	return nil
 }
 
 func (m *memoryCache) Get(key string) ([]byte, error) {
@@ -127,6 +179,71 @@ func (m *memoryCache) Delete(key string) error {
 	return nil
 }
 
+func (m *memoryCache) Keys(prefix string) ([]string, error) {
+	if !m.config.Enabled || !m.config.Rules.AllowGet {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	keys := []string{}
+	for key := range m.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (m *memoryCache) Increment(key string, delta int64) (int64, error) {
+	if !m.config.Enabled || !m.config.Rules.AllowSet {
+		return 0, ErrCapabilityNotEnabled
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	uVal, exists := m.values[key]
+	if !exists {
+		m.set(key, []byte(strconv.FormatInt(delta, 10)), 0)
+		return delta, nil
+	}
+
+	current, err := strconv.ParseInt(string(uVal.val), 10, 64)
+	if err != nil {
+		return 0, ErrCacheValueNotInteger
+	}
+
+	// the value is changed in place so that it keeps its TTL
+	uVal.val = []byte(strconv.FormatInt(current+delta, 10))
+
+	return current + delta, nil
+}
+
+func (m *memoryCache) CompareAndSwap(key string, old, val []byte, ttl int) (bool, error) {
+	if !m.config.Enabled || !m.config.Rules.AllowSet {
+		return false, ErrCapabilityNotEnabled
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	uVal, exists := m.values[key]
+	if old == nil && exists {
+		return false, nil
+	}
+
+	if old != nil && (!exists || !bytes.Equal(uVal.val, old)) {
+		return false, nil
+	}
+
+	m.set(key, val, ttl)
+
+	return true, nil
+}
+
 func defaultCacheRules() CacheRules {
 	c := CacheRules{
 		AllowSet:    true,
@@ -0,0 +1,260 @@
+package rcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultBoltBucket is the bucket that values are stored in if the config doesn't name one
+const defaultBoltBucket = "reactr"
+
+// BoltCache is a cache stored in a BoltDB file, so that its values survive restarts
+type BoltCache struct {
+	config CacheConfig
+	bucket []byte
+	db     *bolt.DB
+	dbErr  error
+}
+
+// BoltConfig is configuration for a BoltDB cache
+type BoltConfig struct {
+	// Path is the database file, which is created if it doesn't exist
+	Path   string `json:"path" yaml:"path"`
+	Bucket string `json:"bucket,omitempty" yaml:"bucket,omitempty"`
+}
+
+// boltDBs are the open databases, since a file can only be opened once, and each Runnable's cache is set up separately
+var boltDBs = map[string]*bolt.DB{}
+var boltDBsLock = sync.Mutex{}
+
+func newBoltCache(config CacheConfig) *BoltCache {
+	bc := &BoltCache{
+		config: config,
+		bucket: []byte(config.BoltConfig.Bucket),
+	}
+
+	if len(bc.bucket) == 0 {
+		bc.bucket = []byte(defaultBoltBucket)
+	}
+
+	bc.db, bc.dbErr = openBoltDB(config.BoltConfig.Path)
+
+	if bc.dbErr == nil {
+		bc.dbErr = bc.db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists(bc.bucket)
+			return err
+		})
+	}
+
+	return bc
+}
+
+func openBoltDB(path string) (*bolt.DB, error) {
+	boltDBsLock.Lock()
+	defer boltDBsLock.Unlock()
+
+	if db, exists := boltDBs[path]; exists {
+		return db, nil
+	}
+
+	// the timeout stops another process that has the file open from blocking forever
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to bolt.Open")
+	}
+
+	boltDBs[path] = db
+
+	return db, nil
+}
+
+// Set sets a value in the cache
+func (b *BoltCache) Set(key string, val []byte, ttl int) error {
+	if !b.config.Enabled || !b.config.Rules.AllowSet {
+		return ErrCapabilityNotEnabled
+	}
+
+	return b.update(func(bucket *bolt.Bucket) error {
+		return bucket.Put([]byte(key), encodeBoltValue(val, ttl))
+	})
+}
+
+// Get gets a value from the cache
+func (b *BoltCache) Get(key string) ([]byte, error) {
+	if !b.config.Enabled || !b.config.Rules.AllowGet {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	var val []byte
+
+	err := b.view(func(bucket *bolt.Bucket) error {
+		current, exists := decodeBoltValue(bucket.Get([]byte(key)))
+		if !exists {
+			return ErrCacheKeyNotFound
+		}
+
+		// values are only valid during the transaction
+		val = append([]byte{}, current...)
+
+		return nil
+	})
+
+	return val, err
+}
+
+// Delete deletes a key
+func (b *BoltCache) Delete(key string) error {
+	if !b.config.Enabled || !b.config.Rules.AllowDelete {
+		return ErrCapabilityNotEnabled
+	}
+
+	return b.update(func(bucket *bolt.Bucket) error {
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// Keys returns the keys that begin with prefix, and removes any expired keys that it comes across
+func (b *BoltCache) Keys(prefix string) ([]string, error) {
+	if !b.config.Enabled || !b.config.Rules.AllowGet {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	keys := []string{}
+
+	err := b.update(func(bucket *bolt.Bucket) error {
+		expired := [][]byte{}
+
+		cursor := bucket.Cursor()
+		for k, v := cursor.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = cursor.Next() {
+			if _, exists := decodeBoltValue(v); !exists {
+				expired = append(expired, append([]byte{}, k...))
+				continue
+			}
+
+			keys = append(keys, string(k))
+		}
+
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return keys, err
+}
+
+// Increment atomically adds delta to the integer stored at key
+func (b *BoltCache) Increment(key string, delta int64) (int64, error) {
+	if !b.config.Enabled || !b.config.Rules.AllowSet {
+		return 0, ErrCapabilityNotEnabled
+	}
+
+	var result int64
+
+	err := b.update(func(bucket *bolt.Bucket) error {
+		raw := bucket.Get([]byte(key))
+
+		current, exists := decodeBoltValue(raw)
+		if !exists {
+			result = delta
+			return bucket.Put([]byte(key), encodeBoltValue([]byte(strconv.FormatInt(delta, 10)), 0))
+		}
+
+		val, err := strconv.ParseInt(string(current), 10, 64)
+		if err != nil {
+			return ErrCacheValueNotInteger
+		}
+
+		result = val + delta
+
+		// the value keeps its expiry
+		updated := append(append([]byte{}, raw[:8]...), strconv.FormatInt(result, 10)...)
+
+		return bucket.Put([]byte(key), updated)
+	})
+
+	return result, err
+}
+
+// CompareAndSwap atomically sets key to val if its value is old (or if old is nil and it doesn't exist)
+func (b *BoltCache) CompareAndSwap(key string, old, val []byte, ttl int) (bool, error) {
+	if !b.config.Enabled || !b.config.Rules.AllowSet {
+		return false, ErrCapabilityNotEnabled
+	}
+
+	swapped := false
+
+	err := b.update(func(bucket *bolt.Bucket) error {
+		current, exists := decodeBoltValue(bucket.Get([]byte(key)))
+
+		if old == nil && exists {
+			return nil
+		}
+
+		if old != nil && (!exists || !bytes.Equal(current, old)) {
+			return nil
+		}
+
+		swapped = true
+
+		return bucket.Put([]byte(key), encodeBoltValue(val, ttl))
+	})
+
+	return swapped, err
+}
+
+func (b *BoltCache) view(fn func(bucket *bolt.Bucket) error) error {
+	if b.dbErr != nil {
+		return b.dbErr
+	}
+
+	return b.db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(b.bucket))
+	})
+}
+
+func (b *BoltCache) update(fn func(bucket *bolt.Bucket) error) error {
+	if b.dbErr != nil {
+		return b.dbErr
+	}
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(b.bucket))
+	})
+}
+
+// encodeBoltValue prefixes a value with its expiry as big-endian Unix nanoseconds, or 0 if it doesn't expire
+func encodeBoltValue(val []byte, ttl int) []byte {
+	var expires int64
+	if ttl > 0 {
+		expires = time.Now().Add(time.Duration(ttl) * time.Second).UnixNano()
+	}
+
+	encoded := make([]byte, 8, 8+len(val))
+	binary.BigEndian.PutUint64(encoded, uint64(expires))
+
+	return append(encoded, val...)
+}
+
+// decodeBoltValue returns a stored value, and whether it exists and hasn't expired
+func decodeBoltValue(raw []byte) ([]byte, bool) {
+	if len(raw) < 8 {
+		return nil, false
+	}
+
+	expires := int64(binary.BigEndian.Uint64(raw[:8]))
+	if expires != 0 && time.Now().UnixNano() >= expires {
+		return nil, false
+	}
+
+	return raw[8:], true
+}
@@ -0,0 +1,92 @@
+package rcap
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestBoltCache(t *testing.T) {
+	config := CacheConfig{
+		Enabled:    true,
+		Rules:      defaultCacheRules(),
+		BoltConfig: &BoltConfig{Path: filepath.Join(t.TempDir(), "cache.db")},
+	}
+
+	cache := SetupCache(config)
+
+	if err := cache.Set("user:1", []byte("alice"), 0); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Set"))
+	}
+
+	// a second cache using the same file shares its values rather than failing to open it
+	if val, err := SetupCache(config).Get("user:1"); err != nil || string(val) != "alice" {
+		t.Errorf("expected 'alice', got %q (%v)", val, err)
+	}
+
+	if _, err := cache.Get("user:2"); !errors.Is(err, ErrCacheKeyNotFound) {
+		t.Error("expected ErrCacheKeyNotFound, got", err)
+	}
+
+	if err := cache.Set("user:2", []byte("bob"), 1); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Set"))
+	}
+
+	cache.Set("order:1", []byte("val"), 0)
+
+	keys, err := cache.Keys("user:")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Keys"))
+	}
+
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "user:1,user:2" {
+		t.Error("expected user:1 and user:2, got", keys)
+	}
+
+	time.Sleep(time.Millisecond * 1100)
+
+	if _, err := cache.Get("user:2"); !errors.Is(err, ErrCacheKeyNotFound) {
+		t.Error("expected expired key to be ErrCacheKeyNotFound, got", err)
+	}
+
+	if keys, _ := cache.Keys("user:"); strings.Join(keys, ",") != "user:1" {
+		t.Error("expected only user:1, got", keys)
+	}
+
+	if val, err := cache.Increment("counter", 5); err != nil || val != 5 {
+		t.Errorf("expected 5, got %d (%v)", val, err)
+	}
+
+	if val, err := cache.Increment("counter", -7); err != nil || val != -2 {
+		t.Errorf("expected -2, got %d (%v)", val, err)
+	}
+
+	if _, err := cache.Increment("user:1", 1); !errors.Is(err, ErrCacheValueNotInteger) {
+		t.Error("expected ErrCacheValueNotInteger, got", err)
+	}
+
+	if swapped, err := cache.CompareAndSwap("lock", nil, []byte("first"), 0); err != nil || !swapped {
+		t.Errorf("expected swap of missing key, got %t (%v)", swapped, err)
+	}
+
+	if swapped, _ := cache.CompareAndSwap("lock", []byte("second"), []byte("third"), 0); swapped {
+		t.Error("expected no swap of mismatched value")
+	}
+
+	if swapped, _ := cache.CompareAndSwap("lock", []byte("first"), []byte("third"), 0); !swapped {
+		t.Error("expected swap of matching value")
+	}
+
+	if err := cache.Delete("lock"); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Delete"))
+	}
+
+	if _, err := cache.Get("lock"); !errors.Is(err, ErrCacheKeyNotFound) {
+		t.Error("expected ErrCacheKeyNotFound, got", err)
+	}
+}
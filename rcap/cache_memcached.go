@@ -0,0 +1,192 @@
+package rcap
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/pkg/errors"
+)
+
+// ErrCacheKeysNotSupported is returned when listing keys from a cache backend that can't list them, such as Memcached
+var ErrCacheKeysNotSupported = errors.New("listing keys is not supported by this cache")
+
+// memcachedMaxRelativeTTL is the longest expiration that Memcached treats as relative, anything longer is a Unix timestamp
+const memcachedMaxRelativeTTL = 60 * 60 * 24 * 30
+
+// MemcachedCache is a cache backed by one or more Memcached servers
+type MemcachedCache struct {
+	config CacheConfig
+	client *memcache.Client
+}
+
+// MemcachedConfig is configuration for a Memcached cache
+type MemcachedConfig struct {
+	// ServerAddresses are the servers that keys are spread across, such as localhost:11211
+	ServerAddresses []string `json:"serverAddresses" yaml:"serverAddresses"`
+}
+
+func newMemcachedCache(config CacheConfig) *MemcachedCache {
+	mc := &MemcachedCache{
+		config: config,
+		client: memcache.New(config.MemcachedConfig.ServerAddresses...),
+	}
+
+	return mc
+}
+
+// Set sets a value in the cache
+func (m *MemcachedCache) Set(key string, val []byte, ttl int) error {
+	if !m.config.Enabled || !m.config.Rules.AllowSet {
+		return ErrCapabilityNotEnabled
+	}
+
+	if err := m.client.Set(&memcache.Item{Key: key, Value: val, Expiration: memcachedExpiration(ttl)}); err != nil {
+		return errors.Wrap(err, "failed to client.Set")
+	}
+
+	return nil
+}
+
+// Get gets a value from the cache
+func (m *MemcachedCache) Get(key string) ([]byte, error) {
+	if !m.config.Enabled || !m.config.Rules.AllowGet {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	item, err := m.client.Get(key)
+	if err != nil {
+		if errors.Is(err, memcache.ErrCacheMiss) {
+			return nil, ErrCacheKeyNotFound
+		}
+
+		return nil, errors.Wrap(err, "failed to client.Get")
+	}
+
+	return item.Value, nil
+}
+
+// Delete deletes a key
+func (m *MemcachedCache) Delete(key string) error {
+	if !m.config.Enabled || !m.config.Rules.AllowDelete {
+		return ErrCapabilityNotEnabled
+	}
+
+	if err := m.client.Delete(key); err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return errors.Wrap(err, "failed to client.Delete")
+	}
+
+	return nil
+}
+
+// Keys isn't supported, since Memcached can't list its keys
+func (m *MemcachedCache) Keys(prefix string) ([]string, error) {
+	if !m.config.Enabled || !m.config.Rules.AllowGet {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	return nil, ErrCacheKeysNotSupported
+}
+
+// Increment atomically adds delta to the integer stored at key. Memcached counters are unsigned,
+// so they can't be decremented below 0
+func (m *MemcachedCache) Increment(key string, delta int64) (int64, error) {
+	if !m.config.Enabled || !m.config.Rules.AllowSet {
+		return 0, ErrCapabilityNotEnabled
+	}
+
+	for {
+		var val uint64
+		var err error
+
+		if delta < 0 {
+			val, err = m.client.Decrement(key, uint64(-delta))
+		} else {
+			val, err = m.client.Increment(key, uint64(delta))
+		}
+
+		if err == nil {
+			return int64(val), nil
+		}
+
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			if strings.Contains(err.Error(), "client error") {
+				return 0, ErrCacheValueNotInteger
+			}
+
+			return 0, errors.Wrap(err, "failed to increment")
+		}
+
+		initial := delta
+		if initial < 0 {
+			initial = 0
+		}
+
+		// if another client creates the key first, increment it instead
+		err = m.client.Add(&memcache.Item{Key: key, Value: []byte(strconv.FormatInt(initial, 10))})
+		if err == nil {
+			return initial, nil
+		}
+
+		if !errors.Is(err, memcache.ErrNotStored) {
+			return 0, errors.Wrap(err, "failed to client.Add")
+		}
+	}
+}
+
+// CompareAndSwap atomically sets key to val if its value is old (or if old is nil and it doesn't exist)
+func (m *MemcachedCache) CompareAndSwap(key string, old, val []byte, ttl int) (bool, error) {
+	if !m.config.Enabled || !m.config.Rules.AllowSet {
+		return false, ErrCapabilityNotEnabled
+	}
+
+	if old == nil {
+		err := m.client.Add(&memcache.Item{Key: key, Value: val, Expiration: memcachedExpiration(ttl)})
+		if errors.Is(err, memcache.ErrNotStored) {
+			return false, nil
+		} else if err != nil {
+			return false, errors.Wrap(err, "failed to client.Add")
+		}
+
+		return true, nil
+	}
+
+	// the item carries the CAS ID from the Get, so the swap fails if it's been changed since
+	item, err := m.client.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "failed to client.Get")
+	}
+
+	if !bytes.Equal(item.Value, old) {
+		return false, nil
+	}
+
+	item.Value = val
+	item.Expiration = memcachedExpiration(ttl)
+
+	err = m.client.CompareAndSwap(item)
+	if errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrCacheMiss) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "failed to client.CompareAndSwap")
+	}
+
+	return true, nil
+}
+
+// memcachedExpiration converts a TTL in seconds to a Memcached expiration
+func memcachedExpiration(ttl int) int32 {
+	if ttl <= 0 {
+		return 0
+	}
+
+	if ttl > memcachedMaxRelativeTTL {
+		return int32(time.Now().Add(time.Duration(ttl) * time.Second).Unix())
+	}
+
+	return int32(ttl)
+}
@@ -0,0 +1,144 @@
+package rcap
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCacheNamespaceDisallowed is returned when a key in a namespace that hasn't been granted is used
+var ErrCacheNamespaceDisallowed = errors.New("cache namespace is disallowed")
+
+// CacheNamespaceSeparator separates a namespace from a key, such as shared::config
+const CacheNamespaceSeparator = "::"
+
+// namespacedCache isolates the keys used through it from those used through other namespaces of the same cache
+type namespacedCache struct {
+	cache     CacheCapability
+	namespace string
+	allowed   []string
+
+	// err is set if the namespace can't be used, and is returned by every call
+	err error
+}
+
+// NamespacedCache returns a cache that stores its keys in namespace, so that they don't collide with the keys of other
+// namespaces sharing the same underlying cache. Keys in the allowed namespaces can also be used by prefixing them with
+// the namespace and CacheNamespaceSeparator. If cache is already namespaced, its namespace and grants are replaced.
+// A namespace containing CacheNamespaceSeparator can't be used, and every call to its cache returns ErrCacheNamespaceDisallowed.
+func NamespacedCache(cache CacheCapability, namespace string, allowed ...string) CacheCapability {
+	if nc, isNamespaced := cache.(*namespacedCache); isNamespaced {
+		cache = nc.cache
+	}
+
+	n := &namespacedCache{
+		cache:     cache,
+		namespace: namespace,
+		allowed:   allowed,
+	}
+
+	// namespace foo could otherwise use the keys of namespace foo::bar, by qualifying them as foo::bar::key
+	if strings.Contains(namespace, CacheNamespaceSeparator) {
+		n.err = errors.Wrapf(ErrCacheNamespaceDisallowed, "namespace %s contains %s", namespace, CacheNamespaceSeparator)
+	}
+
+	return n
+}
+
+func (n *namespacedCache) withContext(ctx context.Context) CacheCapability {
+	nc := *n
+	nc.cache = CacheWithContext(n.cache, ctx)
+
+	return &nc
+}
+
+func (n *namespacedCache) Set(key string, val []byte, ttl int) error {
+	nsKey, err := n.key(key)
+	if err != nil {
+		return err
+	}
+
+	return n.cache.Set(nsKey, val, ttl)
+}
+
+func (n *namespacedCache) Get(key string) ([]byte, error) {
+	nsKey, err := n.key(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.cache.Get(nsKey)
+}
+
+func (n *namespacedCache) Delete(key string) error {
+	nsKey, err := n.key(key)
+	if err != nil {
+		return err
+	}
+
+	return n.cache.Delete(nsKey)
+}
+
+func (n *namespacedCache) Keys(prefix string) ([]string, error) {
+	nsPrefix, err := n.key(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := n.cache.Keys(nsPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// keys are returned the same way the prefix was given, so only qualified prefixes return qualified keys
+	if !strings.Contains(prefix, CacheNamespaceSeparator) {
+		for i, key := range keys {
+			keys[i] = strings.TrimPrefix(key, n.namespace+CacheNamespaceSeparator)
+		}
+	}
+
+	return keys, nil
+}
+
+func (n *namespacedCache) Increment(key string, delta int64) (int64, error) {
+	nsKey, err := n.key(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return n.cache.Increment(nsKey, delta)
+}
+
+func (n *namespacedCache) CompareAndSwap(key string, old, val []byte, ttl int) (bool, error) {
+	nsKey, err := n.key(key)
+	if err != nil {
+		return false, err
+	}
+
+	return n.cache.CompareAndSwap(nsKey, old, val, ttl)
+}
+
+// key returns the key as it's stored in the underlying cache, or an error if it's in a namespace that isn't allowed
+func (n *namespacedCache) key(key string) (string, error) {
+	if n.err != nil {
+		return "", n.err
+	}
+
+	namespace, _, qualified := strings.Cut(key, CacheNamespaceSeparator)
+	if !qualified {
+		return n.namespace + CacheNamespaceSeparator + key, nil
+	}
+
+	if namespace == n.namespace {
+		return key, nil
+	}
+
+	for _, allowed := range n.allowed {
+		if namespace == allowed {
+			return key, nil
+		}
+	}
+
+	return "", errors.Wrapf(ErrCacheNamespaceDisallowed, "namespace %s has not been granted", namespace)
+}
@@ -2,6 +2,7 @@ package rcap
 
 import (
 	"context"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -11,6 +12,9 @@ import (
 type RedisCache struct {
 	config CacheConfig
 	client *redis.Client
+
+	// ctx is set with withContext, and context.Background is used if it's nil
+	ctx context.Context
 }
 
 type RedisConfig struct {
@@ -34,6 +38,22 @@ func newRedisCache(config CacheConfig) *RedisCache {
 	return rc
 }
 
+// withContext returns a copy of the cache whose commands are cancelled along with ctx, sharing the same client
+func (r *RedisCache) withContext(ctx context.Context) CacheCapability {
+	rc := *r
+	rc.ctx = ctx
+
+	return &rc
+}
+
+func (r *RedisCache) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+
+	return r.ctx
+}
+
 // Set sets a value in the cache
 func (r *RedisCache) Set(key string, val []byte, ttl int) error {
 	if !r.config.Enabled || !r.config.Rules.AllowSet {
@@ -42,7 +62,7 @@ func (r *RedisCache) Set(key string, val []byte, ttl int) error {
 
 	ttlDuration := time.Duration(time.Second * time.Duration(ttl))
 
-	if err := r.client.Set(context.Background(), key, val, ttlDuration).Err(); err != nil {
+	if err := r.client.Set(r.context(), key, val, ttlDuration).Err(); err != nil {
 		return errors.Wrap(err, "failed to client.Set")
 	}
 
@@ -55,7 +75,7 @@ func (r *RedisCache) Get(key string) ([]byte, error) {
 		return nil, ErrCapabilityNotEnabled
 	}
 
-	val, err := r.client.Get(context.Background(), key).Bytes()
+	val, err := r.client.Get(r.context(), key).Bytes()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to client.Get")
 	}
@@ -69,9 +89,87 @@ func (r *RedisCache) Delete(key string) error {
 		return ErrCapabilityNotEnabled
 	}
 
-	if _, err := r.client.Del(context.Background(), key).Result(); err != nil {
+	if _, err := r.client.Del(r.context(), key).Result(); err != nil {
 		return errors.Wrap(err, "failed to client.Del")
 	}
 
 	return nil
 }
+
+// Keys returns the keys that begin with prefix
+func (r *RedisCache) Keys(prefix string) ([]string, error) {
+	if !r.config.Enabled || !r.config.Rules.AllowGet {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	// SCAN is used rather than KEYS so that Redis isn't blocked while a large keyspace is searched
+	match := redisGlobEscaper.Replace(prefix) + "*"
+
+	keys := []string{}
+	iter := r.client.Scan(r.context(), 0, match, 0).Iterator()
+
+	for iter.Next(r.context()) {
+		keys = append(keys, iter.Val())
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to Scan")
+	}
+
+	return keys, nil
+}
+
+// Increment atomically adds delta to the integer stored at key
+func (r *RedisCache) Increment(key string, delta int64) (int64, error) {
+	if !r.config.Enabled || !r.config.Rules.AllowSet {
+		return 0, ErrCapabilityNotEnabled
+	}
+
+	val, err := r.client.IncrBy(r.context(), key, delta).Result()
+	if err != nil {
+		var replyErr redis.Error
+		if errors.As(err, &replyErr) {
+			return 0, ErrCacheValueNotInteger
+		}
+
+		return 0, errors.Wrap(err, "failed to client.IncrBy")
+	}
+
+	return val, nil
+}
+
+// CompareAndSwap atomically sets key to val if its value is old (or if old is nil and it doesn't exist)
+func (r *RedisCache) CompareAndSwap(key string, old, val []byte, ttl int) (bool, error) {
+	if !r.config.Enabled || !r.config.Rules.AllowSet {
+		return false, ErrCapabilityNotEnabled
+	}
+
+	expectMissing := "0"
+	if old == nil {
+		expectMissing = "1"
+	}
+
+	swapped, err := redisCompareAndSwap.Run(r.context(), r.client, []string{key}, old, val, expectMissing, ttl).Int()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to Run compare and swap")
+	}
+
+	return swapped == 1, nil
+}
+
+// redisCompareAndSwap is run as a script so that the comparison and the swap happen atomically
+var redisCompareAndSwap = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if (ARGV[3] == '1' and current == false) or (ARGV[3] == '0' and current == ARGV[1]) then
+	if tonumber(ARGV[4]) > 0 then
+		redis.call('SET', KEYS[1], ARGV[2], 'EX', ARGV[4])
+	else
+		redis.call('SET', KEYS[1], ARGV[2])
+	end
+	return 1
+end
+return 0
+`)
+
+// redisGlobEscaper escapes the characters that have a special meaning in a SCAN pattern
+var redisGlobEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
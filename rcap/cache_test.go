@@ -1,6 +1,13 @@
 package rcap
 
-import "testing"
+import (
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
 
 func TestDefaultCache(t *testing.T) {
 	config := CacheConfig{
@@ -181,3 +188,209 @@ func TestDisabledDelete(t *testing.T) {
 		}
 	})
 }
+
+func TestNamespacedCache(t *testing.T) {
+	cache := SetupCache(CacheConfig{Enabled: true, Rules: defaultCacheRules()})
+
+	first := NamespacedCache(cache, "first")
+	second := NamespacedCache(cache, "second", "first")
+
+	if err := first.Set("foo", []byte("first"), 0); err != nil {
+		t.Fatal("failed to Set", err)
+	}
+
+	if err := second.Set("foo", []byte("second"), 0); err != nil {
+		t.Fatal("failed to Set", err)
+	}
+
+	t.Run("keys are isolated", func(t *testing.T) {
+		val, err := first.Get("foo")
+		if err != nil || string(val) != "first" {
+			t.Errorf("expected 'first', got %q (%v)", val, err)
+		}
+
+		val, err = second.Get("foo")
+		if err != nil || string(val) != "second" {
+			t.Errorf("expected 'second', got %q (%v)", val, err)
+		}
+	})
+
+	t.Run("granted namespace", func(t *testing.T) {
+		val, err := second.Get("first::foo")
+		if err != nil || string(val) != "first" {
+			t.Errorf("expected 'first', got %q (%v)", val, err)
+		}
+	})
+
+	t.Run("own namespace", func(t *testing.T) {
+		val, err := first.Get("first::foo")
+		if err != nil || string(val) != "first" {
+			t.Errorf("expected 'first', got %q (%v)", val, err)
+		}
+	})
+
+	t.Run("namespace not granted", func(t *testing.T) {
+		if _, err := first.Get("second::foo"); !errors.Is(err, ErrCacheNamespaceDisallowed) {
+			t.Error("expected ErrCacheNamespaceDisallowed, got", err)
+		}
+
+		if err := first.Delete("second::foo"); !errors.Is(err, ErrCacheNamespaceDisallowed) {
+			t.Error("expected ErrCacheNamespaceDisallowed, got", err)
+		}
+	})
+
+	t.Run("namespace containing the separator", func(t *testing.T) {
+		// first could otherwise reach its keys as first::nested::foo
+		nested := NamespacedCache(cache, "first::nested")
+
+		if err := nested.Set("foo", []byte("nested"), 0); !errors.Is(err, ErrCacheNamespaceDisallowed) {
+			t.Error("expected ErrCacheNamespaceDisallowed, got", err)
+		}
+
+		if _, err := nested.Get("foo"); !errors.Is(err, ErrCacheNamespaceDisallowed) {
+			t.Error("expected ErrCacheNamespaceDisallowed, got", err)
+		}
+	})
+
+	t.Run("namespace from config", func(t *testing.T) {
+		configured := SetupCache(CacheConfig{Enabled: true, Rules: defaultCacheRules(), Namespace: "configured"})
+
+		if err := configured.Set("foo", []byte("bar"), 0); err != nil {
+			t.Fatal("failed to Set", err)
+		}
+
+		if _, err := configured.Get("first::foo"); !errors.Is(err, ErrCacheNamespaceDisallowed) {
+			t.Error("expected ErrCacheNamespaceDisallowed, got", err)
+		}
+	})
+}
+
+func TestCacheKeys(t *testing.T) {
+	cache := SetupCache(CacheConfig{Enabled: true, Rules: defaultCacheRules()})
+
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		if err := cache.Set(key, []byte("val"), 0); err != nil {
+			t.Fatal("failed to Set", err)
+		}
+	}
+
+	keys, err := cache.Keys("user:")
+	if err != nil {
+		t.Fatal("failed to Keys", err)
+	}
+
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "user:1,user:2" {
+		t.Error("expected user:1 and user:2, got", keys)
+	}
+
+	if err := cache.Delete("user:1"); err != nil {
+		t.Fatal("failed to Delete", err)
+	}
+
+	if keys, _ := cache.Keys(""); len(keys) != 2 {
+		t.Error("expected 2 keys, got", keys)
+	}
+
+	t.Run("namespaced", func(t *testing.T) {
+		first := NamespacedCache(cache, "first")
+		second := NamespacedCache(cache, "second", "first")
+
+		first.Set("user:3", []byte("val"), 0)
+
+		keys, err := first.Keys("user:")
+		if err != nil || strings.Join(keys, ",") != "user:3" {
+			t.Errorf("expected user:3, got %v (%v)", keys, err)
+		}
+
+		keys, err = second.Keys("first::")
+		if err != nil || strings.Join(keys, ",") != "first::user:3" {
+			t.Errorf("expected first::user:3, got %v (%v)", keys, err)
+		}
+
+		if keys, _ := second.Keys(""); len(keys) != 0 {
+			t.Error("expected no keys, got", keys)
+		}
+	})
+
+	t.Run("get disallowed", func(t *testing.T) {
+		noGet := SetupCache(CacheConfig{Enabled: true, Rules: CacheRules{AllowSet: true}})
+
+		if _, err := noGet.Keys(""); !errors.Is(err, ErrCapabilityNotEnabled) {
+			t.Error("expected ErrCapabilityNotEnabled, got", err)
+		}
+	})
+}
+
+func TestCacheAtomicOperations(t *testing.T) {
+	cache := SetupCache(CacheConfig{Enabled: true, Rules: defaultCacheRules()})
+
+	t.Run("increment", func(t *testing.T) {
+		wg := sync.WaitGroup{}
+
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if _, err := cache.Increment("counter", 2); err != nil {
+					t.Error("failed to Increment", err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		val, err := cache.Increment("counter", -50)
+		if err != nil || val != 150 {
+			t.Errorf("expected 150, got %d (%v)", val, err)
+		}
+
+		if stored, _ := cache.Get("counter"); string(stored) != "150" {
+			t.Errorf("expected '150' to be stored, got %q", stored)
+		}
+	})
+
+	t.Run("increment non-integer", func(t *testing.T) {
+		cache.Set("name", []byte("alice"), 0)
+
+		if _, err := cache.Increment("name", 1); !errors.Is(err, ErrCacheValueNotInteger) {
+			t.Error("expected ErrCacheValueNotInteger, got", err)
+		}
+	})
+
+	t.Run("compare and swap", func(t *testing.T) {
+		if swapped, err := cache.CompareAndSwap("lock", nil, []byte("first"), 0); err != nil || !swapped {
+			t.Errorf("expected swap of missing key, got %t (%v)", swapped, err)
+		}
+
+		if swapped, _ := cache.CompareAndSwap("lock", nil, []byte("second"), 0); swapped {
+			t.Error("expected no swap of existing key")
+		}
+
+		if swapped, _ := cache.CompareAndSwap("lock", []byte("second"), []byte("third"), 0); swapped {
+			t.Error("expected no swap of mismatched value")
+		}
+
+		if swapped, _ := cache.CompareAndSwap("lock", []byte("first"), []byte("third"), 0); !swapped {
+			t.Error("expected swap of matching value")
+		}
+
+		if val, _ := cache.Get("lock"); string(val) != "third" {
+			t.Errorf("expected 'third', got %q", val)
+		}
+	})
+
+	t.Run("namespaced", func(t *testing.T) {
+		ns := NamespacedCache(cache, "ns")
+
+		if val, err := ns.Increment("counter", 1); err != nil || val != 1 {
+			t.Errorf("expected 1, got %d (%v)", val, err)
+		}
+
+		if swapped, _ := ns.CompareAndSwap("lock", nil, []byte("ns"), 0); !swapped {
+			t.Error("expected swap of missing namespaced key")
+		}
+	})
+}
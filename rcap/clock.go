@@ -0,0 +1,129 @@
+package rcap
+
+import (
+	"sync"
+	"time"
+)
+
+// clockStart is the fixed point that the system clock's monotonic time is measured from
+var clockStart = time.Now()
+
+// ClockConfig is configuration for the clock capability
+type ClockConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Clock is the source of time, which is the system clock if it is nil, and can be
+	// set to a FrozenClock (or any other Clock) to test Runnables that depend on time
+	Clock Clock `json:"-" yaml:"-"`
+}
+
+// Clock is a source of time
+type Clock interface {
+	// Now returns the wall clock time
+	Now() time.Time
+	// Monotonic returns the time elapsed since a fixed point, which never goes backwards, even if the wall clock does
+	Monotonic() time.Duration
+}
+
+// ClockCapability gives Runnables the current time
+type ClockCapability interface {
+	Now() (time.Time, error)
+	Monotonic() (time.Duration, error)
+}
+
+type defaultClock struct {
+	config ClockConfig
+	clock  Clock
+}
+
+// DefaultClock creates a clock capability that uses the config's Clock
+func DefaultClock(config ClockConfig) ClockCapability {
+	d := &defaultClock{
+		config: config,
+		clock:  config.Clock,
+	}
+
+	if d.clock == nil {
+		d.clock = systemClock{}
+	}
+
+	return d
+}
+
+// Now returns the wall clock time
+func (d *defaultClock) Now() (time.Time, error) {
+	if !d.config.Enabled {
+		return time.Time{}, ErrCapabilityNotEnabled
+	}
+
+	return d.clock.Now(), nil
+}
+
+// Monotonic returns the monotonic time
+func (d *defaultClock) Monotonic() (time.Duration, error) {
+	if !d.config.Enabled {
+		return 0, ErrCapabilityNotEnabled
+	}
+
+	return d.clock.Monotonic(), nil
+}
+
+type systemClock struct{}
+
+func (s systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (s systemClock) Monotonic() time.Duration {
+	return time.Since(clockStart)
+}
+
+// FrozenClock is a Clock that only changes when it's told to
+type FrozenClock struct {
+	now     time.Time
+	elapsed time.Duration
+	lock    sync.RWMutex
+}
+
+// NewFrozenClock returns a clock frozen at now
+func NewFrozenClock(now time.Time) *FrozenClock {
+	f := &FrozenClock{
+		now:  now,
+		lock: sync.RWMutex{},
+	}
+
+	return f
+}
+
+// Now returns the clock's wall clock time
+func (f *FrozenClock) Now() time.Time {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.now
+}
+
+// Monotonic returns the total that the clock has been advanced by
+func (f *FrozenClock) Monotonic() time.Duration {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.elapsed
+}
+
+// Advance moves both the wall clock and monotonic times forward by d
+func (f *FrozenClock) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.now = f.now.Add(d)
+	f.elapsed += d
+}
+
+// Set changes the wall clock time, which (like a system clock being changed) doesn't affect the monotonic time
+func (f *FrozenClock) Set(now time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.now = now
+}
@@ -0,0 +1,58 @@
+package rcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestFrozenClock(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	frozen := NewFrozenClock(start)
+
+	clock := DefaultClock(ClockConfig{Enabled: true, Clock: frozen})
+
+	if now, _ := clock.Now(); !now.Equal(start) {
+		t.Errorf("expected %s, got %s", start, now)
+	}
+
+	frozen.Advance(90 * time.Second)
+
+	if now, _ := clock.Now(); !now.Equal(start.Add(90 * time.Second)) {
+		t.Errorf("expected the clock to advance, got %s", now)
+	}
+
+	// setting the wall clock back doesn't move the monotonic time
+	frozen.Set(start)
+
+	if now, _ := clock.Now(); !now.Equal(start) {
+		t.Errorf("expected %s, got %s", start, now)
+	}
+
+	if monotonic, _ := clock.Monotonic(); monotonic != 90*time.Second {
+		t.Errorf("expected monotonic time of 90s, got %s", monotonic)
+	}
+}
+
+func TestSystemClock(t *testing.T) {
+	clock := DefaultClock(ClockConfig{Enabled: true})
+
+	first, _ := clock.Monotonic()
+	time.Sleep(time.Millisecond)
+	second, _ := clock.Monotonic()
+
+	if second <= first {
+		t.Errorf("expected monotonic time to increase, got %s then %s", first, second)
+	}
+
+	if now, _ := clock.Now(); time.Since(now) > time.Second {
+		t.Error("unexpected wall clock time", now)
+	}
+
+	disabled := DefaultClock(ClockConfig{})
+
+	if _, err := disabled.Now(); !errors.Is(err, ErrCapabilityNotEnabled) {
+		t.Error("expected ErrCapabilityNotEnabled, got", err)
+	}
+}
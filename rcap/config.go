@@ -14,11 +14,33 @@ var ErrCapabilityNotEnabled = errors.New("capability is not enabled")
 type CapabilityConfig struct {
 	Logger         *LoggerConfig         `json:"logger,omitempty" yaml:"logger,omitempty"`
 	HTTP           *HTTPConfig           `json:"http,omitempty" yaml:"http,omitempty"`
+	WebSocket      *WebSocketConfig      `json:"webSocket,omitempty" yaml:"webSocket,omitempty"`
 	GraphQL        *GraphQLConfig        `json:"graphql,omitempty" yaml:"graphql,omitempty"`
+	GRPC           *GRPCConfig           `json:"grpc,omitempty" yaml:"grpc,omitempty"`
+	DNS            *DNSConfig            `json:"dns,omitempty" yaml:"dns,omitempty"`
+	Database       *DatabaseConfig       `json:"database,omitempty" yaml:"database,omitempty"`
+	Redis          *RedisClientConfig    `json:"redis,omitempty" yaml:"redis,omitempty"`
+	Blob           *BlobConfig           `json:"blob,omitempty" yaml:"blob,omitempty"`
+	Secrets        *SecretsConfig        `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+	Configuration  *ConfigurationConfig  `json:"configuration,omitempty" yaml:"configuration,omitempty"`
+	Crypto         *CryptoConfig         `json:"crypto,omitempty" yaml:"crypto,omitempty"`
+	Clock          *ClockConfig          `json:"clock,omitempty" yaml:"clock,omitempty"`
+	Grav           *GravConfig           `json:"grav,omitempty" yaml:"grav,omitempty"`
+	Metrics        *MetricsConfig        `json:"metrics,omitempty" yaml:"metrics,omitempty"`
+	Email          *EmailConfig          `json:"email,omitempty" yaml:"email,omitempty"`
+	MessageBroker  *MessageBrokerConfig  `json:"messageBroker,omitempty" yaml:"messageBroker,omitempty"`
 	Auth           *AuthConfig           `json:"auth,omitempty" yaml:"auth,omitempty"`
+	JWT            *JWTConfig            `json:"jwt,omitempty" yaml:"jwt,omitempty"`
+	OAuth2         *OAuth2Config         `json:"oauth2,omitempty" yaml:"oauth2,omitempty"`
 	Cache          *CacheConfig          `json:"cache,omitempty" yaml:"cache,omitempty"`
+	Locks          *LocksConfig          `json:"locks,omitempty" yaml:"locks,omitempty"`
 	File           *FileConfig           `json:"file,omitempty" yaml:"file,omitempty"`
+	Templates      *TemplatesConfig      `json:"templates,omitempty" yaml:"templates,omitempty"`
 	RequestHandler *RequestHandlerConfig `json:"requestHandler,omitempty" yaml:"requestHandler,omitempty"`
+	Policy         *PolicyConfig         `json:"policy,omitempty" yaml:"policy,omitempty"`
+	Limits         *LimitsConfig         `json:"limits,omitempty" yaml:"limits,omitempty"`
+	Timeouts       *TimeoutsConfig       `json:"timeouts,omitempty" yaml:"timeouts,omitempty"`
+	Audit          *AuditConfig          `json:"audit,omitempty" yaml:"audit,omitempty"`
 }
 
 // DefaultCapabilityConfig returns the default all-enabled config (with a default logger)
@@ -36,23 +58,106 @@ func DefaultConfigWithLogger(logger *vlog.Logger) CapabilityConfig {
 			Enabled: true,
 			Rules:   defaultHTTPRules(),
 		},
+		WebSocket: &WebSocketConfig{
+			Enabled: true,
+			Rules:   defaultWebSocketRules(),
+		},
 		GraphQL: &GraphQLConfig{
 			Enabled: true,
 			Rules:   defaultHTTPRules(),
 		},
+		GRPC: &GRPCConfig{
+			Enabled: true,
+			Rules:   defaultGRPCRules(),
+		},
+		DNS: &DNSConfig{
+			Enabled:      true,
+			CacheSeconds: 30,
+		},
+		// there's no default database, so it must be configured to be used
+		Database: &DatabaseConfig{
+			Enabled: false,
+		},
+		// likewise there's no default Redis server or blob store
+		Redis: &RedisClientConfig{
+			Enabled: false,
+		},
+		Blob: &BlobConfig{
+			Enabled: false,
+			Rules:   defaultBlobRules(),
+		},
+		// secrets are read from providers configured by the host, and only the secrets that are allowed can be read
+		Secrets: &SecretsConfig{
+			Enabled: false,
+		},
+		Configuration: &ConfigurationConfig{
+			Enabled: true,
+		},
+		Crypto: &CryptoConfig{
+			Enabled: true,
+		},
+		Clock: &ClockConfig{
+			Enabled: true,
+		},
+		// messages can't be sent until the host sets a pod
+		Grav: &GravConfig{
+			Enabled: true,
+		},
+		// likewise metrics can't be recorded until the host sets a sink
+		Metrics: &MetricsConfig{
+			Enabled: true,
+		},
+		// likewise emails can't be sent until the host sets a sender
+		Email: &EmailConfig{
+			Enabled: true,
+		},
+		// and messages can't be published until the host sets a publisher
+		MessageBroker: &MessageBrokerConfig{
+			Enabled: true,
+		},
 		Auth: &AuthConfig{
 			Enabled: true,
 		},
+		// tokens can't be verified until the host sets a JWKS URL or keys
+		JWT: &JWTConfig{
+			Enabled: true,
+		},
+		// and tokens can't be requested until the host sets OAuth2 clients
+		OAuth2: &OAuth2Config{
+			Enabled: true,
+		},
 		Cache: &CacheConfig{
 			Enabled: true,
 			Rules:   defaultCacheRules(),
 		},
+		Locks: &LocksConfig{
+			Enabled: true,
+		},
 		File: &FileConfig{
 			Enabled: true,
 		},
+		Templates: &TemplatesConfig{
+			Enabled: true,
+		},
 		RequestHandler: &RequestHandlerConfig{
 			Enabled: true,
 		},
+		// every host function can be called unless the host sets a policy
+		Policy: &PolicyConfig{
+			Enabled: false,
+		},
+		// and there are no limits on how often they can be called
+		Limits: &LimitsConfig{
+			Enabled: false,
+		},
+		// calls are cancelled along with their job, but don't have their own timeouts unless the host sets them
+		Timeouts: &TimeoutsConfig{
+			Enabled: true,
+		},
+		// calls can't be audited until the host sets a sink
+		Audit: &AuditConfig{
+			Enabled: true,
+		},
 	}
 
 	return c
@@ -0,0 +1,88 @@
+package rcap
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrConfigKeyNotFound   = errors.New("configuration key not found")
+	ErrConfigKeyDisallowed = errors.New("reading this configuration key is disallowed")
+)
+
+// ConfigurationFunc is a function that returns the value of a configuration key, or ErrConfigKeyNotFound
+type ConfigurationFunc func(key string) (string, error)
+
+// ConfigurationConfig is configuration for the configuration capability, which gives Runnables
+// settings such as feature flags that are managed by the host rather than compiled into their modules
+type ConfigurationConfig struct {
+	Enabled bool               `json:"enabled" yaml:"enabled"`
+	Rules   ConfigurationRules `json:"rules" yaml:"rules"`
+
+	// Values are looked up first, and then ValueFunc is called for keys that aren't in Values,
+	// so that values that change while the host is running (such as feature flags) can be provided
+	Values    map[string]string `json:"values,omitempty" yaml:"values,omitempty"`
+	ValueFunc ConfigurationFunc `json:"-" yaml:"-"`
+}
+
+// ConfigurationRules is a set of rules that governs use of the configuration capability
+type ConfigurationRules struct {
+	// AllowedKeys are the keys that can be read, which can be patterns such as features.*
+	// If none are listed, any key can be read.
+	AllowedKeys []string `json:"allowedKeys" yaml:"allowedKeys"`
+}
+
+// ConfigurationCapability gives Runnables the ability to read the host's configuration values
+type ConfigurationCapability interface {
+	Get(key string) (string, error)
+}
+
+type defaultConfiguration struct {
+	config ConfigurationConfig
+}
+
+// DefaultConfiguration creates a configuration capability that reads the config's values
+func DefaultConfiguration(config ConfigurationConfig) ConfigurationCapability {
+	d := &defaultConfiguration{
+		config: config,
+	}
+
+	return d
+}
+
+// Get returns the value of a configuration key
+func (d *defaultConfiguration) Get(key string) (string, error) {
+	if !d.config.Enabled {
+		return "", ErrCapabilityNotEnabled
+	}
+
+	if err := d.config.Rules.keyIsAllowed(key); err != nil {
+		return "", err
+	}
+
+	if val, exists := d.config.Values[key]; exists {
+		return val, nil
+	}
+
+	if d.config.ValueFunc == nil {
+		return "", ErrConfigKeyNotFound
+	}
+
+	return d.config.ValueFunc(key)
+}
+
+// keyIsAllowed returns a non-nil error if the key isn't allowed to be read
+func (c ConfigurationRules) keyIsAllowed(key string) error {
+	if len(c.AllowedKeys) == 0 {
+		return nil
+	}
+
+	for _, allowed := range c.AllowedKeys {
+		if matched, _ := path.Match(allowed, key); matched {
+			return nil
+		}
+	}
+
+	return ErrConfigKeyDisallowed
+}
@@ -0,0 +1,59 @@
+package rcap
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestConfiguration(t *testing.T) {
+	flags := map[string]string{"features.checkout": "true"}
+
+	configuration := DefaultConfiguration(ConfigurationConfig{
+		Enabled: true,
+		Rules:   ConfigurationRules{AllowedKeys: []string{"features.*", "region"}},
+		Values:  map[string]string{"region": "ca-central-1", "db.host": "10.0.0.5"},
+		ValueFunc: func(key string) (string, error) {
+			val, exists := flags[key]
+			if !exists {
+				return "", ErrConfigKeyNotFound
+			}
+
+			return val, nil
+		},
+	})
+
+	if val, err := configuration.Get("region"); err != nil || val != "ca-central-1" {
+		t.Errorf("expected region to be ca-central-1, got %q (%v)", val, err)
+	}
+
+	if val, err := configuration.Get("features.checkout"); err != nil || val != "true" {
+		t.Errorf("expected features.checkout to be true, got %q (%v)", val, err)
+	}
+
+	// values from the func can change without the capability being recreated
+	flags["features.checkout"] = "false"
+
+	if val, _ := configuration.Get("features.checkout"); val != "false" {
+		t.Errorf("expected features.checkout to be false, got %q", val)
+	}
+
+	if _, err := configuration.Get("features.search"); !errors.Is(err, ErrConfigKeyNotFound) {
+		t.Error("expected ErrConfigKeyNotFound, got", err)
+	}
+
+	if _, err := configuration.Get("db.host"); !errors.Is(err, ErrConfigKeyDisallowed) {
+		t.Error("expected ErrConfigKeyDisallowed, got", err)
+	}
+
+	// without an allowlist, any key can be read
+	unrestricted := DefaultConfiguration(ConfigurationConfig{Enabled: true, Values: map[string]string{"db.host": "10.0.0.5"}})
+
+	if val, err := unrestricted.Get("db.host"); err != nil || val != "10.0.0.5" {
+		t.Errorf("expected db.host to be 10.0.0.5, got %q (%v)", val, err)
+	}
+
+	if _, err := unrestricted.Get("region"); !errors.Is(err, ErrConfigKeyNotFound) {
+		t.Error("expected ErrConfigKeyNotFound, got", err)
+	}
+}
@@ -0,0 +1,319 @@
+package rcap
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrCryptoKeyNotFound          = errors.New("crypto key not found")
+	ErrCryptoKeyDisallowed        = errors.New("using this crypto key is disallowed")
+	ErrCryptoKeyUnsuitable        = errors.New("crypto key can't be used for this operation")
+	ErrCryptoAlgorithmUnsupported = errors.New("hash algorithm is unsupported")
+	ErrCryptoDecryptFailed        = errors.New("ciphertext could not be decrypted and authenticated")
+)
+
+// CryptoConfig is configuration for the crypto capability
+type CryptoConfig struct {
+	Enabled bool        `json:"enabled" yaml:"enabled"`
+	Rules   CryptoRules `json:"rules" yaml:"rules"`
+
+	// Keys are the named keys that Runnables can use without having access to them, which can only be set by the host
+	Keys map[string]CryptoKey `json:"-" yaml:"-"`
+}
+
+// CryptoRules is a set of rules that governs use of the crypto capability
+type CryptoRules struct {
+	// AllowedKeys are the names of the keys that can be used, which can be patterns such as webhooks.*
+	// If none are listed, any key can be used.
+	AllowedKeys []string `json:"allowedKeys" yaml:"allowedKeys"`
+}
+
+// CryptoKey is a key held by the host. Secret is used for HMACs and for AES-GCM (if it is 16, 24, or 32 bytes), PrivateKey (an ed25519.PrivateKey or *ecdsa.PrivateKey)
+// is used for signing, and PublicKey (or the public part of PrivateKey) is used to verify signatures
+type CryptoKey struct {
+	Secret     []byte
+	PrivateKey crypto.Signer
+	PublicKey  crypto.PublicKey
+}
+
+// CryptoKeyFromPEM returns a key from a PEM encoded PKCS #8 private key, SEC 1 EC private key, or PKIX public key
+func CryptoKeyFromPEM(pemBytes []byte) (CryptoKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return CryptoKey{}, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return CryptoKey{}, errors.Wrap(err, "failed to ParsePKCS8PrivateKey")
+		}
+
+		signer, isSigner := key.(crypto.Signer)
+		if !isSigner {
+			return CryptoKey{}, ErrCryptoKeyUnsuitable
+		}
+
+		return CryptoKey{PrivateKey: signer}, nil
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return CryptoKey{}, errors.Wrap(err, "failed to ParseECPrivateKey")
+		}
+
+		return CryptoKey{PrivateKey: key}, nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return CryptoKey{}, errors.Wrap(err, "failed to ParsePKIXPublicKey")
+		}
+
+		return CryptoKey{PublicKey: key}, nil
+	}
+
+	return CryptoKey{}, fmt.Errorf("unsupported PEM block type %s", block.Type)
+}
+
+// CryptoCapability gives Runnables the ability to hash, authenticate, and sign data with keys that are held by the host
+type CryptoCapability interface {
+	// Hash returns the digest of data using sha256 or sha512
+	Hash(algorithm string, data []byte) ([]byte, error)
+	// HMAC returns the HMAC of data using the named key's secret and sha256 or sha512
+	HMAC(algorithm, keyName string, data []byte) ([]byte, error)
+	// Sign returns the signature of data using the named key, which is an ASN.1 DER signature of the data's digest for ECDSA keys
+	Sign(keyName string, data []byte) ([]byte, error)
+	// Verify returns whether signature is a valid signature of data by the named key
+	Verify(keyName string, data, signature []byte) (bool, error)
+	// Encrypt encrypts and authenticates plaintext and additionalData with AES-GCM using the named key's secret,
+	// and returns the ciphertext prefixed with its random nonce
+	Encrypt(keyName string, plaintext, additionalData []byte) ([]byte, error)
+	// Decrypt returns the plaintext of ciphertext created by Encrypt, or ErrCryptoDecryptFailed if it can't be authenticated
+	Decrypt(keyName string, ciphertext, additionalData []byte) ([]byte, error)
+}
+
+type defaultCrypto struct {
+	config CryptoConfig
+}
+
+// DefaultCrypto creates a crypto capability that uses the config's keys
+func DefaultCrypto(config CryptoConfig) CryptoCapability {
+	d := &defaultCrypto{
+		config: config,
+	}
+
+	return d
+}
+
+// Hash returns the digest of data
+func (d *defaultCrypto) Hash(algorithm string, data []byte) ([]byte, error) {
+	if !d.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	newHash, err := hashFunc(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	h := newHash()
+	h.Write(data)
+
+	return h.Sum(nil), nil
+}
+
+// HMAC returns the HMAC of data
+func (d *defaultCrypto) HMAC(algorithm, keyName string, data []byte) ([]byte, error) {
+	newHash, err := hashFunc(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := d.key(keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key.Secret) == 0 {
+		return nil, ErrCryptoKeyUnsuitable
+	}
+
+	mac := hmac.New(newHash, key.Secret)
+	mac.Write(data)
+
+	return mac.Sum(nil), nil
+}
+
+// Sign returns the signature of data
+func (d *defaultCrypto) Sign(keyName string, data []byte) ([]byte, error) {
+	key, err := d.key(keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	switch privateKey := key.PrivateKey.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(privateKey, data), nil
+	case *ecdsa.PrivateKey:
+		signature, err := ecdsa.SignASN1(rand.Reader, privateKey, ecdsaDigest(privateKey.Curve, data))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to SignASN1")
+		}
+
+		return signature, nil
+	}
+
+	return nil, ErrCryptoKeyUnsuitable
+}
+
+// Verify returns whether the signature of data is valid
+func (d *defaultCrypto) Verify(keyName string, data, signature []byte) (bool, error) {
+	key, err := d.key(keyName)
+	if err != nil {
+		return false, err
+	}
+
+	publicKey := key.PublicKey
+	if publicKey == nil && key.PrivateKey != nil {
+		publicKey = key.PrivateKey.Public()
+	}
+
+	switch publicKey := publicKey.(type) {
+	case ed25519.PublicKey:
+		return ed25519.Verify(publicKey, data, signature), nil
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(publicKey, ecdsaDigest(publicKey.Curve, data), signature), nil
+	}
+
+	return false, ErrCryptoKeyUnsuitable
+}
+
+// Encrypt returns the nonce and ciphertext of plaintext
+func (d *defaultCrypto) Encrypt(keyName string, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := d.aead(keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "failed to rand.Read")
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Decrypt returns the plaintext of a nonce and ciphertext
+func (d *defaultCrypto) Decrypt(keyName string, ciphertext, additionalData []byte) ([]byte, error) {
+	aead, err := d.aead(keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, ErrCryptoDecryptFailed
+	}
+
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+
+	plaintext, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, ErrCryptoDecryptFailed
+	}
+
+	return plaintext, nil
+}
+
+// aead returns AES-GCM using the named key's secret
+func (d *defaultCrypto) aead(keyName string) (cipher.AEAD, error) {
+	key, err := d.key(keyName)
+	if err != nil {
+		return nil, err
+	}
+
+	// aes.NewCipher accepts 16, 24, or 32 byte keys, for AES-128, AES-192, or AES-256
+	block, err := aes.NewCipher(key.Secret)
+	if err != nil {
+		return nil, ErrCryptoKeyUnsuitable
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to NewGCM")
+	}
+
+	return aead, nil
+}
+
+// key returns the named key if it exists and is allowed to be used
+func (d *defaultCrypto) key(name string) (CryptoKey, error) {
+	if !d.config.Enabled {
+		return CryptoKey{}, ErrCapabilityNotEnabled
+	}
+
+	if len(d.config.Rules.AllowedKeys) > 0 {
+		allowed := false
+
+		for _, pattern := range d.config.Rules.AllowedKeys {
+			if matched, _ := path.Match(pattern, name); matched {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return CryptoKey{}, ErrCryptoKeyDisallowed
+		}
+	}
+
+	key, exists := d.config.Keys[name]
+	if !exists {
+		return CryptoKey{}, ErrCryptoKeyNotFound
+	}
+
+	return key, nil
+}
+
+// hashFunc returns the hash function for an algorithm name such as sha256 or SHA-512
+func hashFunc(algorithm string) (func() hash.Hash, error) {
+	switch strings.ReplaceAll(strings.ToLower(algorithm), "-", "") {
+	case "sha256":
+		return sha256.New, nil
+	case "sha512":
+		return sha512.New, nil
+	}
+
+	return nil, ErrCryptoAlgorithmUnsupported
+}
+
+// ecdsaDigest returns the digest of data that's signed by an ECDSA key, using the hash that matches the key's curve
+func ecdsaDigest(curve elliptic.Curve, data []byte) []byte {
+	switch curve.Params().BitSize {
+	case 384:
+		sum := sha512.Sum384(data)
+		return sum[:]
+	case 521:
+		sum := sha512.Sum512(data)
+		return sum[:]
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
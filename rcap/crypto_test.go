@@ -0,0 +1,176 @@
+package rcap
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCryptoHash(t *testing.T) {
+	c := DefaultCrypto(CryptoConfig{Enabled: true})
+
+	digest, err := c.Hash("sha256", []byte("abc"))
+	if err != nil {
+		t.Fatal("failed to Hash", err)
+	}
+
+	if hex.EncodeToString(digest) != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Error("unexpected sha256 digest", hex.EncodeToString(digest))
+	}
+
+	digest, _ = c.Hash("SHA-512", []byte("abc"))
+	if len(digest) != 64 {
+		t.Error("expected a 64 byte sha512 digest, got", len(digest))
+	}
+
+	if _, err := c.Hash("md5", []byte("abc")); !errors.Is(err, ErrCryptoAlgorithmUnsupported) {
+		t.Error("expected ErrCryptoAlgorithmUnsupported, got", err)
+	}
+}
+
+func TestCryptoHMAC(t *testing.T) {
+	c := DefaultCrypto(CryptoConfig{
+		Enabled: true,
+		Keys:    map[string]CryptoKey{"webhook": {Secret: []byte("key")}},
+	})
+
+	mac, err := c.HMAC("sha256", "webhook", []byte("The quick brown fox jumps over the lazy dog"))
+	if err != nil {
+		t.Fatal("failed to HMAC", err)
+	}
+
+	if hex.EncodeToString(mac) != "f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8" {
+		t.Error("unexpected HMAC", hex.EncodeToString(mac))
+	}
+
+	if _, err := c.HMAC("sha256", "missing", []byte("data")); !errors.Is(err, ErrCryptoKeyNotFound) {
+		t.Error("expected ErrCryptoKeyNotFound, got", err)
+	}
+}
+
+func TestCryptoSignVerify(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	ecPublicDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	ecPublic, err := CryptoKeyFromPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ecPublicDER}))
+	if err != nil {
+		t.Fatal("failed to CryptoKeyFromPEM", err)
+	}
+
+	edPrivateDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+	edPrivate, err := CryptoKeyFromPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edPrivateDER}))
+	if err != nil {
+		t.Fatal("failed to CryptoKeyFromPEM", err)
+	}
+
+	c := DefaultCrypto(CryptoConfig{
+		Enabled: true,
+		Rules:   CryptoRules{AllowedKeys: []string{"signing.*", "webhook"}},
+		Keys: map[string]CryptoKey{
+			"signing.ed25519":  edPrivate,
+			"signing.ecdsa":    {PrivateKey: ecKey},
+			"signing.ecdsapub": ecPublic,
+			"webhook":          {Secret: []byte("key")},
+			"internal":         {PrivateKey: ecKey},
+		},
+	})
+
+	data := []byte("important message")
+
+	for _, key := range []string{"signing.ed25519", "signing.ecdsa"} {
+		signature, err := c.Sign(key, data)
+		if err != nil {
+			t.Fatalf("failed to Sign with %s: %s", key, err)
+		}
+
+		if valid, err := c.Verify(key, data, signature); err != nil || !valid {
+			t.Errorf("expected %s signature to be valid (%v)", key, err)
+		}
+
+		if valid, _ := c.Verify(key, []byte("tampered message"), signature); valid {
+			t.Errorf("expected %s signature of different data to be invalid", key)
+		}
+	}
+
+	// a public key can verify, but not sign
+	signature, _ := c.Sign("signing.ecdsa", data)
+
+	if valid, err := c.Verify("signing.ecdsapub", data, signature); err != nil || !valid {
+		t.Errorf("expected signature to be valid with the public key (%v)", err)
+	}
+
+	if _, err := c.Sign("signing.ecdsapub", data); !errors.Is(err, ErrCryptoKeyUnsuitable) {
+		t.Error("expected ErrCryptoKeyUnsuitable, got", err)
+	}
+
+	if _, err := c.Sign("webhook", data); !errors.Is(err, ErrCryptoKeyUnsuitable) {
+		t.Error("expected ErrCryptoKeyUnsuitable, got", err)
+	}
+
+	if _, err := c.Sign("internal", data); !errors.Is(err, ErrCryptoKeyDisallowed) {
+		t.Error("expected ErrCryptoKeyDisallowed, got", err)
+	}
+}
+
+func TestCryptoEncryptDecrypt(t *testing.T) {
+	c := DefaultCrypto(CryptoConfig{
+		Enabled: true,
+		Keys: map[string]CryptoKey{
+			"tokens": {Secret: []byte("0123456789abcdef0123456789abcdef")},
+			"other":  {Secret: []byte("fedcba9876543210fedcba9876543210")},
+			"short":  {Secret: []byte("key")},
+		},
+	})
+
+	plaintext := []byte("card ending 4242")
+
+	ciphertext, err := c.Encrypt("tokens", plaintext, []byte("user-1"))
+	if err != nil {
+		t.Fatal("failed to Encrypt", err)
+	}
+
+	if bytes.Contains(ciphertext, plaintext) {
+		t.Error("ciphertext contains the plaintext")
+	}
+
+	// nonces are random, so encrypting the same plaintext twice gives different ciphertexts
+	if again, _ := c.Encrypt("tokens", plaintext, []byte("user-1")); bytes.Equal(again, ciphertext) {
+		t.Error("expected ciphertexts to differ")
+	}
+
+	decrypted, err := c.Decrypt("tokens", ciphertext, []byte("user-1"))
+	if err != nil {
+		t.Fatal("failed to Decrypt", err)
+	}
+
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("expected %q, got %q", plaintext, decrypted)
+	}
+
+	tampered := append([]byte{}, ciphertext...)
+	tampered[len(tampered)-1] ^= 1
+
+	for name, attempt := range map[string]func() ([]byte, error){
+		"tampered":   func() ([]byte, error) { return c.Decrypt("tokens", tampered, []byte("user-1")) },
+		"wrong data": func() ([]byte, error) { return c.Decrypt("tokens", ciphertext, []byte("user-2")) },
+		"wrong key":  func() ([]byte, error) { return c.Decrypt("other", ciphertext, []byte("user-1")) },
+		"too short":  func() ([]byte, error) { return c.Decrypt("tokens", ciphertext[:4], nil) },
+	} {
+		if _, err := attempt(); !errors.Is(err, ErrCryptoDecryptFailed) {
+			t.Errorf("%s: expected ErrCryptoDecryptFailed, got %v", name, err)
+		}
+	}
+
+	if _, err := c.Encrypt("short", plaintext, nil); !errors.Is(err, ErrCryptoKeyUnsuitable) {
+		t.Error("expected ErrCryptoKeyUnsuitable, got", err)
+	}
+}
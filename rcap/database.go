@@ -0,0 +1,299 @@
+package rcap
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrDatabaseNotConfigured = errors.New("no database is configured")
+	ErrDatabaseTooManyRows   = errors.New("query returned more than the maximum number of rows")
+)
+
+// defaultMaxRows is the most rows that Query returns if the config doesn't set MaxRows
+const defaultMaxRows = 1000
+
+// sharedDatabases are the connection pools opened by the database capability, keyed by driver name and DSN, so
+// that every Runnable (and every worker and Wasm instance running it) uses the same connections to each database
+var sharedDatabases = struct {
+	pools map[string]*sql.DB
+	lock  sync.Mutex
+}{
+	pools: map[string]*sql.DB{},
+}
+
+// DatabaseConfig is configuration for the database capability
+type DatabaseConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// DriverName is the name of a database/sql driver, such as postgres or mysql, which the host must import
+	DriverName string `json:"driverName" yaml:"driverName"`
+	DSN        string `json:"dsn" yaml:"dsn"`
+
+	// the connection pool's limits, where 0 leaves database/sql's default in place. The pool is shared by every
+	// Runnable whose config has the same DriverName and DSN, so its limits are set by the first one to use it
+	MaxOpenConns           int `json:"maxOpenConns" yaml:"maxOpenConns"`
+	MaxIdleConns           int `json:"maxIdleConns" yaml:"maxIdleConns"`
+	ConnMaxLifetimeSeconds int `json:"connMaxLifetimeSeconds" yaml:"connMaxLifetimeSeconds"`
+
+	// MaxConnsPerRunnable is the most connections from the shared pool that each Runnable can use at once, so that
+	// one busy Runnable can't starve the others. Statements beyond the limit wait for one to finish, or 0 is unlimited
+	MaxConnsPerRunnable int `json:"maxConnsPerRunnable,omitempty" yaml:"maxConnsPerRunnable,omitempty"`
+
+	// MaxRows is the most rows that a query can return, so that a Runnable can't read a whole table into memory.
+	// Queries that return more fail with ErrDatabaseTooManyRows, or 0 means 1000
+	MaxRows int `json:"maxRows,omitempty" yaml:"maxRows,omitempty"`
+
+	// DB is a connection pool opened by the host, which is used instead of opening one with DriverName and DSN
+	DB *sql.DB `json:"-" yaml:"-"`
+}
+
+// DatabaseCapability gives Runnables the ability to run parameterized statements against a SQL database
+type DatabaseCapability interface {
+	// Query runs a statement that returns rows, and returns them as a JSON array of objects keyed by column name
+	Query(ctx context.Context, query string, args []interface{}) ([]byte, error)
+	// Exec runs a statement that doesn't return rows
+	Exec(ctx context.Context, query string, args []interface{}) (*DatabaseResult, error)
+}
+
+// DatabaseResult is the result of a statement run with Exec
+type DatabaseResult struct {
+	RowsAffected int64 `json:"rowsAffected"`
+	LastInsertID int64 `json:"lastInsertId"`
+}
+
+type sqlDatabase struct {
+	config DatabaseConfig
+
+	db   *sql.DB
+	lock sync.Mutex
+}
+
+// DefaultDatabase creates a database capability that uses the config's connection pool, opening it when it's first used
+func DefaultDatabase(config DatabaseConfig) DatabaseCapability {
+	d := &sqlDatabase{
+		config: config,
+		db:     config.DB,
+	}
+
+	return d
+}
+
+// Query runs query with args (which fill its placeholders) and returns the rows as JSON, or ErrDatabaseTooManyRows if there are more than MaxRows
+func (d *sqlDatabase) Query(ctx context.Context, query string, args []interface{}) ([]byte, error) {
+	db, err := d.pool()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to QueryContext")
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Columns")
+	}
+
+	maxRows := d.config.MaxRows
+	if maxRows <= 0 {
+		maxRows = defaultMaxRows
+	}
+
+	results := []map[string]interface{}{}
+
+	for rows.Next() {
+		if len(results) == maxRows {
+			return nil, ErrDatabaseTooManyRows
+		}
+
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, errors.Wrap(err, "failed to Scan")
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			row[col] = jsonValue(values[i])
+		}
+
+		results = append(results, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to Next")
+	}
+
+	resultJSON, err := json.Marshal(results)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Marshal")
+	}
+
+	return resultJSON, nil
+}
+
+// Exec runs query with args (which fill its placeholders)
+func (d *sqlDatabase) Exec(ctx context.Context, query string, args []interface{}) (*DatabaseResult, error) {
+	db, err := d.pool()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ExecContext")
+	}
+
+	result := &DatabaseResult{}
+
+	// not every driver supports both of these, so they're left as 0 if they're unavailable
+	if affected, err := res.RowsAffected(); err == nil {
+		result.RowsAffected = affected
+	}
+
+	if lastID, err := res.LastInsertId(); err == nil {
+		result.LastInsertID = lastID
+	}
+
+	return result, nil
+}
+
+// pool returns the connection pool, opening it or finding the shared one if needed
+func (d *sqlDatabase) pool() (*sql.DB, error) {
+	if !d.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.db != nil {
+		return d.db, nil
+	}
+
+	if d.config.DriverName == "" || d.config.DSN == "" {
+		return nil, ErrDatabaseNotConfigured
+	}
+
+	db, err := openSharedDatabase(d.config)
+	if err != nil {
+		return nil, err
+	}
+
+	d.db = db
+
+	return db, nil
+}
+
+// openSharedDatabase returns the shared connection pool for the config's driver and DSN, opening it if it isn't open yet
+func openSharedDatabase(config DatabaseConfig) (*sql.DB, error) {
+	sharedDatabases.lock.Lock()
+	defer sharedDatabases.lock.Unlock()
+
+	key := config.DriverName + "|" + config.DSN
+
+	if db, exists := sharedDatabases.pools[key]; exists {
+		return db, nil
+	}
+
+	db, err := sql.Open(config.DriverName, config.DSN)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to sql.Open")
+	}
+
+	if config.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(config.MaxOpenConns)
+	}
+
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+
+	if config.ConnMaxLifetimeSeconds > 0 {
+		db.SetConnMaxLifetime(time.Duration(config.ConnMaxLifetimeSeconds) * time.Second)
+	}
+
+	sharedDatabases.pools[key] = db
+
+	return db, nil
+}
+
+type limitedDatabase struct {
+	db    DatabaseCapability
+	conns chan struct{}
+}
+
+// LimitedDatabase returns a database capability that runs at most maxConns of db's statements at once, which
+// rt uses to give each Runnable its own share of the connection pool. Statements beyond the limit wait
+// for one to finish, or until their context is done
+func LimitedDatabase(db DatabaseCapability, maxConns int) DatabaseCapability {
+	if maxConns <= 0 {
+		return db
+	}
+
+	l := &limitedDatabase{
+		db:    db,
+		conns: make(chan struct{}, maxConns),
+	}
+
+	return l
+}
+
+// Query runs query once a connection is available
+func (l *limitedDatabase) Query(ctx context.Context, query string, args []interface{}) ([]byte, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	defer l.release()
+
+	return l.db.Query(ctx, query, args)
+}
+
+// Exec runs query once a connection is available
+func (l *limitedDatabase) Exec(ctx context.Context, query string, args []interface{}) (*DatabaseResult, error) {
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	defer l.release()
+
+	return l.db.Exec(ctx, query, args)
+}
+
+func (l *limitedDatabase) acquire(ctx context.Context) error {
+	select {
+	case l.conns <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "failed to wait for a database connection")
+	}
+}
+
+func (l *limitedDatabase) release() {
+	<-l.conns
+}
+
+// jsonValue converts a value scanned from a row into one that encodes well as JSON
+func jsonValue(val interface{}) interface{} {
+	// drivers often return text columns as bytes, which would otherwise be base64 encoded
+	if b, ok := val.([]byte); ok && utf8.Valid(b) {
+		return string(b)
+	}
+
+	return val
+}
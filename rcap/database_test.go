@@ -0,0 +1,284 @@
+package rcap
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	sql.Register("rcaptest", &testDriver{stores: map[string]*testStore{}})
+}
+
+func TestDatabase(t *testing.T) {
+	db := DefaultDatabase(DatabaseConfig{Enabled: true, DriverName: "rcaptest", DSN: "people", MaxOpenConns: 2})
+
+	ctx := context.Background()
+
+	for _, person := range [][]interface{}{{"alice", int64(34)}, {"bob", nil}} {
+		result, err := db.Exec(ctx, "INSERT INTO people (name, age) VALUES (?, ?)", person)
+		if err != nil {
+			t.Fatal("failed to Exec", err)
+		}
+
+		if result.RowsAffected != 1 {
+			t.Error("expected 1 row affected, got", result.RowsAffected)
+		}
+	}
+
+	rowsJSON, err := db.Query(ctx, "SELECT * FROM people", nil)
+	if err != nil {
+		t.Fatal("failed to Query", err)
+	}
+
+	rows := []map[string]interface{}{}
+	if err := json.Unmarshal(rowsJSON, &rows); err != nil {
+		t.Fatal("failed to Unmarshal", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %s", rowsJSON)
+	}
+
+	// text is returned as bytes by the driver, and should be encoded as a string rather than base64
+	if rows[0]["name"] != "alice" || rows[0]["age"] != float64(34) || rows[0]["id"] != float64(1) {
+		t.Errorf("unexpected first row %s", rowsJSON)
+	}
+
+	if rows[1]["name"] != "bob" || rows[1]["age"] != nil {
+		t.Errorf("unexpected second row %s", rowsJSON)
+	}
+}
+
+func TestDatabaseMaxRows(t *testing.T) {
+	db := DefaultDatabase(DatabaseConfig{Enabled: true, DriverName: "rcaptest", DSN: "maxrows", MaxRows: 2})
+
+	ctx := context.Background()
+
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := db.Exec(ctx, "INSERT INTO people (name, age) VALUES (?, ?)", []interface{}{name, nil}); err != nil {
+			t.Fatal("failed to Exec", err)
+		}
+
+		rowsJSON, err := db.Query(ctx, "SELECT * FROM people", nil)
+
+		if name == "carol" {
+			if !errors.Is(err, ErrDatabaseTooManyRows) {
+				t.Errorf("expected ErrDatabaseTooManyRows, got %s (%v)", rowsJSON, err)
+			}
+		} else if err != nil {
+			t.Error("failed to Query", err)
+		}
+	}
+}
+
+func TestDatabaseNotAvailable(t *testing.T) {
+	disabled := DefaultDatabase(DatabaseConfig{Enabled: false, DriverName: "rcaptest", DSN: "people"})
+
+	if _, err := disabled.Query(context.Background(), "SELECT * FROM people", nil); !errors.Is(err, ErrCapabilityNotEnabled) {
+		t.Error("expected ErrCapabilityNotEnabled, got", err)
+	}
+
+	unconfigured := DefaultDatabase(DatabaseConfig{Enabled: true})
+
+	if _, err := unconfigured.Exec(context.Background(), "DELETE FROM people", nil); !errors.Is(err, ErrDatabaseNotConfigured) {
+		t.Error("expected ErrDatabaseNotConfigured, got", err)
+	}
+}
+
+// testDriver is a database/sql driver where every statement either inserts its arguments
+// as a row (if it has any) or returns all of the rows, in a store named by the DSN
+type testDriver struct {
+	stores map[string]*testStore
+	lock   sync.Mutex
+}
+
+type testStore struct {
+	rows [][]driver.Value
+	lock sync.Mutex
+}
+
+func (d *testDriver) Open(name string) (driver.Conn, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if _, exists := d.stores[name]; !exists {
+		d.stores[name] = &testStore{}
+	}
+
+	return &testConn{store: d.stores[name]}, nil
+}
+
+type testConn struct {
+	store *testStore
+}
+
+func (c *testConn) Prepare(query string) (driver.Stmt, error) { return &testStmt{store: c.store}, nil }
+func (c *testConn) Close() error                              { return nil }
+func (c *testConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type testStmt struct {
+	store *testStore
+}
+
+func (s *testStmt) Close() error  { return nil }
+func (s *testStmt) NumInput() int { return -1 }
+
+func (s *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.store.lock.Lock()
+	defer s.store.lock.Unlock()
+
+	row := append([]driver.Value{int64(len(s.store.rows) + 1)}, args...)
+	s.store.rows = append(s.store.rows, row)
+
+	return driver.RowsAffected(1), nil
+}
+
+func (s *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.store.lock.Lock()
+	defer s.store.lock.Unlock()
+
+	rows := make([][]driver.Value, len(s.store.rows))
+	copy(rows, s.store.rows)
+
+	return &testRows{rows: rows}, nil
+}
+
+type testRows struct {
+	rows [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return []string{"id", "name", "age"} }
+func (r *testRows) Close() error      { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	for i, val := range r.rows[0] {
+		if s, ok := val.(string); ok {
+			val = []byte(s)
+		}
+
+		dest[i] = val
+	}
+
+	r.rows = r.rows[1:]
+
+	return nil
+}
+
+func TestDatabaseSharedPool(t *testing.T) {
+	config := DatabaseConfig{Enabled: true, DriverName: "rcaptest", DSN: "shared"}
+
+	first, err := DefaultDatabase(config).(*sqlDatabase).pool()
+	if err != nil {
+		t.Fatal("failed to pool", err)
+	}
+
+	second, err := DefaultDatabase(config).(*sqlDatabase).pool()
+	if err != nil {
+		t.Fatal("failed to pool", err)
+	}
+
+	if first != second {
+		t.Error("expected capabilities with the same driver and DSN to share a pool")
+	}
+
+	config.DSN = "other"
+
+	other, err := DefaultDatabase(config).(*sqlDatabase).pool()
+	if err != nil {
+		t.Fatal("failed to pool", err)
+	}
+
+	if other == first {
+		t.Error("expected a different DSN to use a different pool")
+	}
+}
+
+func TestLimitedDatabase(t *testing.T) {
+	blocking := &blockingDatabase{release: make(chan struct{})}
+
+	db := LimitedDatabase(blocking, 2)
+
+	wg := sync.WaitGroup{}
+	exec := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db.Exec(context.Background(), "UPDATE counts SET n = n + 1", nil)
+		}()
+	}
+
+	exec()
+	exec()
+
+	for blocking.running() < 2 {
+		runtime.Gosched()
+	}
+
+	// statements beyond the limit wait, and give up when their context is done
+	exec()
+	exec()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := db.Query(ctx, "SELECT * FROM counts", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected context.DeadlineExceeded, got", err)
+	}
+
+	close(blocking.release)
+	wg.Wait()
+
+	if blocking.maxRunning != 2 {
+		t.Error("expected at most 2 statements to run at once, got", blocking.maxRunning)
+	}
+}
+
+// blockingDatabase is a DatabaseCapability whose statements run until release is closed
+type blockingDatabase struct {
+	release    chan struct{}
+	current    int
+	maxRunning int
+	lock       sync.Mutex
+}
+
+func (b *blockingDatabase) Query(ctx context.Context, query string, args []interface{}) ([]byte, error) {
+	_, err := b.Exec(ctx, query, args)
+	return []byte("[]"), err
+}
+
+func (b *blockingDatabase) Exec(ctx context.Context, query string, args []interface{}) (*DatabaseResult, error) {
+	b.lock.Lock()
+	b.current++
+	if b.current > b.maxRunning {
+		b.maxRunning = b.current
+	}
+	b.lock.Unlock()
+
+	<-b.release
+
+	b.lock.Lock()
+	b.current--
+	b.lock.Unlock()
+
+	return &DatabaseResult{}, nil
+}
+
+func (b *blockingDatabase) running() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.current
+}
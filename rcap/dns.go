@@ -0,0 +1,208 @@
+package rcap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrDNSNameDisallowed    = errors.New("resolving this name is disallowed")
+	ErrDNSRecordTypeInvalid = errors.New("DNS record type is invalid")
+)
+
+// DNS record types that can be resolved
+const (
+	DNSRecordA     = "A"
+	DNSRecordAAAA  = "AAAA"
+	DNSRecordCNAME = "CNAME"
+	DNSRecordTXT   = "TXT"
+	DNSRecordMX    = "MX"
+	DNSRecordSRV   = "SRV"
+)
+
+// DNSResolver looks up DNS records, and is satisfied by *net.Resolver
+type DNSResolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSConfig is configuration for the DNS capability
+type DNSConfig struct {
+	Enabled bool     `json:"enabled" yaml:"enabled"`
+	Rules   DNSRules `json:"rules" yaml:"rules"`
+
+	// CacheSeconds is how long results are cached for, or if 0 they aren't cached
+	CacheSeconds int `json:"cacheSeconds" yaml:"cacheSeconds"`
+
+	// Resolver looks up records, which can only be set by the host. If nil, net.DefaultResolver is used
+	Resolver DNSResolver `json:"-" yaml:"-"`
+}
+
+// DNSRules is a set of rules that governs use of the DNS capability
+type DNSRules struct {
+	// AllowedNames are the names that can be resolved, which can be patterns such as *.service.consul
+	// If none are listed, any name can be resolved.
+	AllowedNames []string `json:"allowedNames" yaml:"allowedNames"`
+}
+
+// DNSCapability gives Runnables the ability to resolve DNS records
+type DNSCapability interface {
+	// Resolve returns the records of recordType for name. MX records are formatted as "preference host",
+	// and SRV records as "priority weight port target"
+	Resolve(ctx context.Context, name, recordType string) ([]string, error)
+}
+
+type dnsCacheEntry struct {
+	records []string
+	expires time.Time
+}
+
+type defaultDNS struct {
+	config   DNSConfig
+	resolver DNSResolver
+
+	cache map[string]dnsCacheEntry
+	lock  sync.RWMutex
+}
+
+// DefaultDNS creates a DNS capability that resolves records with the config's resolver
+func DefaultDNS(config DNSConfig) DNSCapability {
+	d := &defaultDNS{
+		config:   config,
+		resolver: config.Resolver,
+		cache:    map[string]dnsCacheEntry{},
+	}
+
+	if d.resolver == nil {
+		d.resolver = net.DefaultResolver
+	}
+
+	return d
+}
+
+// Resolve resolves a name
+func (d *defaultDNS) Resolve(ctx context.Context, name, recordType string) ([]string, error) {
+	if !d.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	recordType = strings.ToUpper(recordType)
+
+	if err := d.config.Rules.nameIsAllowed(name); err != nil {
+		return nil, err
+	}
+
+	key := recordType + " " + name
+
+	if d.config.CacheSeconds > 0 {
+		d.lock.RLock()
+		entry, exists := d.cache[key]
+		d.lock.RUnlock()
+
+		if exists && time.Now().Before(entry.expires) {
+			return entry.records, nil
+		}
+	}
+
+	records, err := d.lookup(ctx, name, recordType)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.config.CacheSeconds > 0 {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+
+		d.cache[key] = dnsCacheEntry{records: records, expires: time.Now().Add(time.Duration(d.config.CacheSeconds) * time.Second)}
+	}
+
+	return records, nil
+}
+
+func (d *defaultDNS) lookup(ctx context.Context, name, recordType string) ([]string, error) {
+	records := []string{}
+
+	switch recordType {
+	case DNSRecordA, DNSRecordAAAA:
+		network := "ip4"
+		if recordType == DNSRecordAAAA {
+			network = "ip6"
+		}
+
+		ips, err := d.resolver.LookupIP(ctx, network, name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to LookupIP")
+		}
+
+		for _, ip := range ips {
+			records = append(records, ip.String())
+		}
+	case DNSRecordCNAME:
+		cname, err := d.resolver.LookupCNAME(ctx, name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to LookupCNAME")
+		}
+
+		records = append(records, cname)
+	case DNSRecordTXT:
+		txts, err := d.resolver.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to LookupTXT")
+		}
+
+		records = append(records, txts...)
+	case DNSRecordMX:
+		mxs, err := d.resolver.LookupMX(ctx, name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to LookupMX")
+		}
+
+		for _, mx := range mxs {
+			records = append(records, fmt.Sprintf("%d %s", mx.Pref, mx.Host))
+		}
+	case DNSRecordSRV:
+		// the name is looked up directly, such as _http._tcp.example.com
+		_, srvs, err := d.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to LookupSRV")
+		}
+
+		for _, srv := range srvs {
+			records = append(records, fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, srv.Target))
+		}
+	default:
+		return nil, errors.Wrapf(ErrDNSRecordTypeInvalid, "record type %s", recordType)
+	}
+
+	return records, nil
+}
+
+// nameIsAllowed returns a non-nil error if the name isn't allowed to be resolved
+func (d DNSRules) nameIsAllowed(name string) error {
+	if name == "" {
+		return errors.Wrap(ErrDNSNameDisallowed, "empty name")
+	}
+
+	if len(d.AllowedNames) == 0 {
+		return nil
+	}
+
+	for _, allowed := range d.AllowedNames {
+		if matched, _ := path.Match(strings.ToLower(allowed), name); matched {
+			return nil
+		}
+	}
+
+	return ErrDNSNameDisallowed
+}
@@ -0,0 +1,84 @@
+package rcap
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testResolver struct {
+	lookups int
+}
+
+func (t *testResolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	t.lookups++
+
+	if network == "ip6" {
+		return []net.IP{net.ParseIP("::1")}, nil
+	}
+
+	return []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}, nil
+}
+
+func (t *testResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return "api.internal.", nil
+}
+
+func (t *testResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return []string{"v=spf1 -all"}, nil
+}
+
+func (t *testResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	return []*net.MX{{Host: "mail.internal.", Pref: 10}}, nil
+}
+
+func (t *testResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	return "", []*net.SRV{{Target: "api.internal.", Port: 8080, Priority: 1, Weight: 5}}, nil
+}
+
+func TestDNS(t *testing.T) {
+	resolver := &testResolver{}
+
+	dns := DefaultDNS(DNSConfig{
+		Enabled:      true,
+		Rules:        DNSRules{AllowedNames: []string{"*.service.consul"}},
+		CacheSeconds: 60,
+		Resolver:     resolver,
+	})
+
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		records, err := dns.Resolve(ctx, "api.service.consul", "a")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Resolve"))
+		}
+
+		if !reflect.DeepEqual(records, []string{"10.0.0.1", "10.0.0.2"}) {
+			t.Errorf("unexpected A records %v", records)
+		}
+	}
+
+	if resolver.lookups != 1 {
+		t.Errorf("expected the second lookup to be cached, got %d lookups", resolver.lookups)
+	}
+
+	if records, err := dns.Resolve(ctx, "api.service.consul", "SRV"); err != nil || records[0] != "1 5 8080 api.internal." {
+		t.Errorf("unexpected SRV records %v (%v)", records, err)
+	}
+
+	if records, err := dns.Resolve(ctx, "api.service.consul", "MX"); err != nil || records[0] != "10 mail.internal." {
+		t.Errorf("unexpected MX records %v (%v)", records, err)
+	}
+
+	if _, err := dns.Resolve(ctx, "example.com", "A"); !errors.Is(err, ErrDNSNameDisallowed) {
+		t.Error("expected ErrDNSNameDisallowed, got", err)
+	}
+
+	if _, err := dns.Resolve(ctx, "api.service.consul", "PTR"); !errors.Is(err, ErrDNSRecordTypeInvalid) {
+		t.Error("expected ErrDNSRecordTypeInvalid, got", err)
+	}
+}
@@ -0,0 +1,437 @@
+package rcap
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrEmailSenderNotSet      = errors.New("email sender not set")
+	ErrEmailInvalid           = errors.New("email is invalid")
+	ErrEmailAddressDisallowed = errors.New("sending email to or from this address is disallowed")
+	ErrEmailRateLimited       = errors.New("email rate limit exceeded")
+)
+
+// EmailMessage is an email to be sent
+type EmailMessage struct {
+	From    string   `json:"from,omitempty"`
+	To      []string `json:"to"`
+	Cc      []string `json:"cc,omitempty"`
+	Bcc     []string `json:"bcc,omitempty"`
+	ReplyTo string   `json:"replyTo,omitempty"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text,omitempty"`
+	HTML    string   `json:"html,omitempty"`
+}
+
+// EmailSender delivers emails, such as over SMTP (see NewSMTPSender) or with an email provider's API.
+// Send should stop waiting on the provider once ctx is cancelled
+type EmailSender interface {
+	Send(ctx context.Context, msg EmailMessage) error
+}
+
+// EmailConfig is configuration for the email capability
+type EmailConfig struct {
+	Enabled bool       `json:"enabled" yaml:"enabled"`
+	Rules   EmailRules `json:"rules" yaml:"rules"`
+
+	// From is the sender used for emails that don't set one
+	From string `json:"from,omitempty" yaml:"from,omitempty"`
+
+	// Sender delivers emails, which can only be set by the host
+	Sender EmailSender `json:"-" yaml:"-"`
+}
+
+// EmailRules is a set of rules that governs use of the email capability
+type EmailRules struct {
+	// AllowedSenders and AllowedRecipients are the addresses that emails can be sent from and to, which can be patterns
+	// such as *@example.com. If none are listed, any address is allowed.
+	AllowedSenders    []string `json:"allowedSenders" yaml:"allowedSenders"`
+	AllowedRecipients []string `json:"allowedRecipients" yaml:"allowedRecipients"`
+
+	// MaxRecipients is the most recipients (including Cc and Bcc) that one email can have, or unlimited if 0
+	MaxRecipients int `json:"maxRecipients" yaml:"maxRecipients"`
+
+	// MaxPerMinute is the most emails that can be sent each minute, or unlimited if 0
+	MaxPerMinute int `json:"maxPerMinute" yaml:"maxPerMinute"`
+}
+
+// EmailCapability gives Runnables the ability to send emails
+type EmailCapability interface {
+	Send(ctx context.Context, msg EmailMessage) error
+}
+
+type defaultEmail struct {
+	config EmailConfig
+
+	windowStart time.Time
+	windowSent  int
+	lock        sync.Mutex
+}
+
+// DefaultEmail creates an email capability that sends emails with the config's sender
+func DefaultEmail(config EmailConfig) EmailCapability {
+	d := &defaultEmail{
+		config: config,
+	}
+
+	return d
+}
+
+// Send sends an email, giving up once ctx is cancelled
+func (d *defaultEmail) Send(ctx context.Context, msg EmailMessage) error {
+	if !d.config.Enabled {
+		return ErrCapabilityNotEnabled
+	}
+
+	if d.config.Sender == nil {
+		return ErrEmailSenderNotSet
+	}
+
+	if msg.From == "" {
+		msg.From = d.config.From
+	}
+
+	if err := d.config.Rules.messageIsAllowed(msg); err != nil {
+		return err
+	}
+
+	if err := d.takeRateLimit(); err != nil {
+		return err
+	}
+
+	return d.config.Sender.Send(ctx, msg)
+}
+
+// takeRateLimit counts an email against the rate limit, and returns a non-nil error if the limit has been reached
+func (d *defaultEmail) takeRateLimit() error {
+	if d.config.Rules.MaxPerMinute <= 0 {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(d.windowStart) >= time.Minute {
+		d.windowStart = now
+		d.windowSent = 0
+	}
+
+	if d.windowSent >= d.config.Rules.MaxPerMinute {
+		return ErrEmailRateLimited
+	}
+
+	d.windowSent++
+
+	return nil
+}
+
+// messageIsAllowed returns a non-nil error if the message isn't valid or isn't allowed to be sent
+func (e EmailRules) messageIsAllowed(msg EmailMessage) error {
+	if msg.From == "" {
+		return errors.Wrap(ErrEmailInvalid, "no sender")
+	}
+
+	recipients := emailRecipients(msg)
+	if len(recipients) == 0 {
+		return errors.Wrap(ErrEmailInvalid, "no recipients")
+	}
+
+	if e.MaxRecipients > 0 && len(recipients) > e.MaxRecipients {
+		return errors.Wrapf(ErrEmailInvalid, "more than %d recipients", e.MaxRecipients)
+	}
+
+	if err := addressIsAllowed(msg.From, e.AllowedSenders); err != nil {
+		return err
+	}
+
+	for _, recipient := range recipients {
+		if err := addressIsAllowed(recipient, e.AllowedRecipients); err != nil {
+			return err
+		}
+	}
+
+	if msg.ReplyTo != "" {
+		if _, err := mail.ParseAddress(msg.ReplyTo); err != nil {
+			return errors.Wrapf(ErrEmailInvalid, "reply-to %s", msg.ReplyTo)
+		}
+	}
+
+	return nil
+}
+
+// addressIsAllowed returns a non-nil error if the address is invalid or doesn't match any of the allowed patterns
+func addressIsAllowed(address string, allowed []string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return errors.Wrapf(ErrEmailInvalid, "address %s", address)
+	}
+
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	for _, pattern := range allowed {
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(parsed.Address)); matched {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrEmailAddressDisallowed, "address %s", parsed.Address)
+}
+
+func emailRecipients(msg EmailMessage) []string {
+	recipients := make([]string, 0, len(msg.To)+len(msg.Cc)+len(msg.Bcc))
+	recipients = append(recipients, msg.To...)
+	recipients = append(recipients, msg.Cc...)
+	recipients = append(recipients, msg.Bcc...)
+
+	return recipients
+}
+
+// SMTPConfig is configuration for sending emails with an SMTP server
+type SMTPConfig struct {
+	Host     string `json:"host" yaml:"host"`
+	Port     int    `json:"port" yaml:"port"`
+	Username string `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `json:"password,omitempty" yaml:"password,omitempty"`
+}
+
+type smtpSender struct {
+	config SMTPConfig
+	send   func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewSMTPSender creates an EmailSender that sends emails with an SMTP server, authenticating with
+// PLAIN auth if a username is set (which net/smtp only allows over TLS or to localhost)
+func NewSMTPSender(config SMTPConfig) EmailSender {
+	s := &smtpSender{
+		config: config,
+		send:   sendMail,
+	}
+
+	return s
+}
+
+// Send sends an email, giving up once ctx is cancelled
+func (s *smtpSender) Send(ctx context.Context, msg EmailMessage) error {
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return errors.Wrapf(ErrEmailInvalid, "address %s", msg.From)
+	}
+
+	recipients := emailRecipients(msg)
+
+	to := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		parsed, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return errors.Wrapf(ErrEmailInvalid, "address %s", recipient)
+		}
+
+		to[i] = parsed.Address
+	}
+
+	body, err := encodeEmail(msg)
+	if err != nil {
+		return errors.Wrap(err, "failed to encodeEmail")
+	}
+
+	var auth smtp.Auth
+	if s.config.Username != "" {
+		auth = smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
+
+	if err := s.send(ctx, addr, auth, from.Address, to, body); err != nil {
+		return errors.Wrap(err, "failed to sendMail")
+	}
+
+	return nil
+}
+
+// sendMail sends an email in the same way as smtp.SendMail, but the connection is closed when ctx is
+// cancelled and has ctx's deadline, so that a server that stops responding can't block the call forever
+func sendMail(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to SplitHostPort")
+	}
+
+	dialer := &net.Dialer{}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to DialContext")
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return errors.Wrap(err, "failed to SetDeadline")
+		}
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return errors.Wrap(err, "failed to NewClient")
+	}
+
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return errors.Wrap(err, "failed to StartTLS")
+		}
+	}
+
+	if a != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("server doesn't support AUTH")
+		}
+
+		if err := client.Auth(a); err != nil {
+			return errors.Wrap(err, "failed to Auth")
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return errors.Wrap(err, "failed to Mail")
+	}
+
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return errors.Wrap(err, "failed to Rcpt")
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return errors.Wrap(err, "failed to Data")
+	}
+
+	if _, err := w.Write(msg); err != nil {
+		return errors.Wrap(err, "failed to Write")
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "failed to Close")
+	}
+
+	if err := client.Quit(); err != nil {
+		return errors.Wrap(err, "failed to Quit")
+	}
+
+	return nil
+}
+
+// encodeEmail encodes a message as MIME, with both text and HTML parts if both are set.
+// Bcc recipients are left out of the headers
+func encodeEmail(msg EmailMessage) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	writeHeader := func(key, val string) {
+		fmt.Fprintf(buf, "%s: %s\r\n", key, val)
+	}
+
+	// addresses are re-formatted after they're parsed so that they can't be used to inject headers
+	writeAddresses := func(key string, addresses ...string) error {
+		formatted := make([]string, len(addresses))
+		for i, address := range addresses {
+			parsed, err := mail.ParseAddress(address)
+			if err != nil {
+				return errors.Wrapf(ErrEmailInvalid, "address %s", address)
+			}
+
+			formatted[i] = parsed.String()
+		}
+
+		writeHeader(key, strings.Join(formatted, ", "))
+
+		return nil
+	}
+
+	if err := writeAddresses("From", msg.From); err != nil {
+		return nil, err
+	}
+
+	if err := writeAddresses("To", msg.To...); err != nil {
+		return nil, err
+	}
+
+	if len(msg.Cc) > 0 {
+		if err := writeAddresses("Cc", msg.Cc...); err != nil {
+			return nil, err
+		}
+	}
+
+	if msg.ReplyTo != "" {
+		if err := writeAddresses("Reply-To", msg.ReplyTo); err != nil {
+			return nil, err
+		}
+	}
+
+	// encoding the subject also prevents a Runnable from injecting headers with it
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader("MIME-Version", "1.0")
+
+	if msg.Text == "" || msg.HTML == "" {
+		contentType, content := "text/plain", msg.Text
+		if msg.HTML != "" {
+			contentType, content = "text/html", msg.HTML
+		}
+
+		writeHeader("Content-Type", contentType+"; charset=utf-8")
+		buf.WriteString("\r\n")
+		buf.WriteString(content)
+
+		return buf.Bytes(), nil
+	}
+
+	parts := &bytes.Buffer{}
+	writer := multipart.NewWriter(parts)
+
+	for _, part := range []struct{ contentType, content string }{{"text/plain", msg.Text}, {"text/html", msg.HTML}} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType + "; charset=utf-8"}})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to CreatePart")
+		}
+
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, errors.Wrap(err, "failed to Write")
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to Close")
+	}
+
+	writeHeader("Content-Type", "multipart/alternative; boundary="+writer.Boundary())
+	buf.WriteString("\r\n")
+	buf.Write(parts.Bytes())
+
+	return buf.Bytes(), nil
+}
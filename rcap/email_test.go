@@ -0,0 +1,139 @@
+package rcap
+
+import (
+	"context"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type testEmailSender struct {
+	sent []EmailMessage
+}
+
+func (t *testEmailSender) Send(ctx context.Context, msg EmailMessage) error {
+	t.sent = append(t.sent, msg)
+	return nil
+}
+
+func TestEmail(t *testing.T) {
+	sender := &testEmailSender{}
+
+	email := DefaultEmail(EmailConfig{
+		Enabled: true,
+		From:    "Notifications <notify@example.com>",
+		Rules: EmailRules{
+			AllowedRecipients: []string{"*@example.com"},
+			MaxRecipients:     2,
+			MaxPerMinute:      2,
+		},
+		Sender: sender,
+	})
+
+	if err := email.Send(context.Background(), EmailMessage{To: []string{"ada@example.com"}, Subject: "Hello"}); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Send"))
+	}
+
+	if len(sender.sent) != 1 || sender.sent[0].From != "Notifications <notify@example.com>" {
+		t.Errorf("expected the email to be sent from the default sender, got %+v", sender.sent)
+	}
+
+	if err := email.Send(context.Background(), EmailMessage{To: []string{"ada@elsewhere.com"}}); !errors.Is(err, ErrEmailAddressDisallowed) {
+		t.Error("expected ErrEmailAddressDisallowed, got", err)
+	}
+
+	if err := email.Send(context.Background(), EmailMessage{To: []string{"a@example.com", "b@example.com"}, Bcc: []string{"c@example.com"}}); !errors.Is(err, ErrEmailInvalid) {
+		t.Error("expected ErrEmailInvalid for too many recipients, got", err)
+	}
+
+	if err := email.Send(context.Background(), EmailMessage{To: []string{"not an address"}}); !errors.Is(err, ErrEmailInvalid) {
+		t.Error("expected ErrEmailInvalid for an invalid address, got", err)
+	}
+
+	if err := email.Send(context.Background(), EmailMessage{To: []string{"ada@example.com"}}); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Send"))
+	}
+
+	if err := email.Send(context.Background(), EmailMessage{To: []string{"ada@example.com"}}); !errors.Is(err, ErrEmailRateLimited) {
+		t.Error("expected ErrEmailRateLimited, got", err)
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	var sentFrom string
+	var sentTo []string
+	var sentMsg []byte
+
+	sender := &smtpSender{
+		config: SMTPConfig{Host: "localhost", Port: 25},
+		send: func(ctx context.Context, addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+			sentFrom, sentTo, sentMsg = from, to, msg
+			return nil
+		},
+	}
+
+	err := sender.Send(context.Background(), EmailMessage{
+		From:    "Notifications <notify@example.com>",
+		To:      []string{"ada@example.com"},
+		Bcc:     []string{"audit@example.com"},
+		Subject: "Hello\r\nBcc: attacker@example.com",
+		Text:    "Hello, Ada",
+		HTML:    "<p>Hello, Ada</p>",
+	})
+
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Send"))
+	}
+
+	if sentFrom != "notify@example.com" || len(sentTo) != 2 || sentTo[1] != "audit@example.com" {
+		t.Errorf("unexpected envelope from %s to %v", sentFrom, sentTo)
+	}
+
+	msg := string(sentMsg)
+
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Error("expected no Bcc header, got", msg)
+	}
+
+	if !strings.Contains(msg, "multipart/alternative") || !strings.Contains(msg, "<p>Hello, Ada</p>") || !strings.Contains(msg, "\r\n\r\nHello, Ada") {
+		t.Error("expected text and html parts, got", msg)
+	}
+}
+
+func TestSendMailTimeout(t *testing.T) {
+	// a server that accepts connections but never greets the client
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Listen"))
+	}
+
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	if err := sendMail(ctx, listener.Addr().String(), nil, "notify@example.com", []string{"ada@example.com"}, []byte("hello")); err == nil {
+		t.Error("expected error, did not get one")
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Error("expected sendMail to give up at its deadline, took", elapsed)
+	}
+}
@@ -1,19 +1,44 @@
 package rcap
 
-import "github.com/pkg/errors"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
 
 var (
-	ErrFileFuncNotSet = errors.New("file func not set")
+	ErrFileFuncNotSet      = errors.New("file func not set")
+	ErrFileDirectoryNotSet = errors.New("file directory not set")
+	ErrFilePathDisallowed  = errors.New("file path is outside of the file directory")
+	ErrFileWriteNotAllowed = errors.New("writing files is not allowed")
+
+	ErrFileDirectoryNotSupported = errors.New("file source does not support reading or writing files")
 )
 
 // StaticFileFunc is a function that returns the contents of a requested file
 type StaticFileFunc func(string) ([]byte, error)
 
+// staticFileContextFunc is a StaticFileFunc that stops waiting for the file's source once ctx is cancelled
+type staticFileContextFunc func(ctx context.Context, filename string) ([]byte, error)
+
 // FileConfig is configuration for the File capability
 type FileConfig struct {
 	Enabled bool `json:"enabled" yaml:"enabled"`
 
 	FileFunc StaticFileFunc `json:"-" yaml:"-"`
+
+	// Static configures where static files come from if FileFunc isn't set, such as an S3 bucket, an HTTP origin
+	// or an embedded filesystem, and how they're cached and limited (see StaticFilesConfig)
+	Static *StaticFilesConfig `json:"static,omitempty" yaml:"static,omitempty"`
+
+	// Directory is a directory on the host that Runnables can read files from with ReadFile,
+	// and write files to with WriteFile if AllowWrite is set. Files outside of it can't be used.
+	Directory  string `json:"directory,omitempty" yaml:"directory,omitempty"`
+	AllowWrite bool   `json:"allowWrite,omitempty" yaml:"allowWrite,omitempty"`
 }
 
 // FileCapability gives runnables access to various kinds of files
@@ -21,16 +46,64 @@ type FileCapability interface {
 	GetStatic(filename string) ([]byte, error)
 }
 
+// FileContextCapability is implemented by file sources that can stop waiting for a static file's source once a context is cancelled
+type FileContextCapability interface {
+	GetStaticWithContext(ctx context.Context, filename string) ([]byte, error)
+}
+
+// FileDirectoryCapability is implemented by file sources that can read and write files in a directory on the host
+type FileDirectoryCapability interface {
+	// ReadFile reads a file at a path relative to the configured directory
+	ReadFile(path string) ([]byte, error)
+	// WriteFile replaces (or creates) the file at a path relative to the configured directory
+	WriteFile(path string, data []byte) error
+}
+
+// GetStaticWithContext returns a static file from files, and stops waiting for its source once ctx is cancelled
+// if files supports it (see FileContextCapability)
+func GetStaticWithContext(files FileCapability, ctx context.Context, filename string) ([]byte, error) {
+	if fc, ok := files.(FileContextCapability); ok {
+		return fc.GetStaticWithContext(ctx, filename)
+	}
+
+	return files.GetStatic(filename)
+}
+
+// FileDirectory returns files as a FileDirectoryCapability, or ErrFileDirectoryNotSupported if it can't read and write files
+func FileDirectory(files FileCapability) (FileDirectoryCapability, error) {
+	if fd, ok := files.(FileDirectoryCapability); ok {
+		return fd, nil
+	}
+
+	return nil, ErrFileDirectoryNotSupported
+}
+
 // defaultFileSource grants access to files
 type defaultFileSource struct {
 	config         FileConfig
-	staticFileFunc StaticFileFunc
+	staticFileFunc staticFileContextFunc
+	staticCache    *staticFileCache
 }
 
 func DefaultFileSource(config FileConfig) FileCapability {
 	d := &defaultFileSource{
-		config:         config,
-		staticFileFunc: config.FileFunc,
+		config: config,
+	}
+
+	if config.FileFunc != nil {
+		d.staticFileFunc = func(_ context.Context, filename string) ([]byte, error) {
+			return config.FileFunc(filename)
+		}
+	}
+
+	if config.Static != nil {
+		if d.staticFileFunc == nil {
+			d.staticFileFunc = config.Static.staticFileFunc()
+		}
+
+		if config.Static.CacheSeconds > 0 {
+			d.staticCache = newStaticFileCache(time.Duration(config.Static.CacheSeconds)*time.Second, config.Static.CacheMaxBytes)
+		}
 	}
 
 	return d
@@ -38,6 +111,11 @@ func DefaultFileSource(config FileConfig) FileCapability {
 
 // GetStatic returns a static file
 func (d *defaultFileSource) GetStatic(filename string) ([]byte, error) {
+	return d.GetStaticWithContext(context.Background(), filename)
+}
+
+// GetStaticWithContext returns a static file, and stops waiting for its source once ctx is cancelled
+func (d *defaultFileSource) GetStaticWithContext(ctx context.Context, filename string) ([]byte, error) {
 	if !d.config.Enabled {
 		return nil, ErrCapabilityNotEnabled
 	}
@@ -46,5 +124,146 @@ func (d *defaultFileSource) GetStatic(filename string) ([]byte, error) {
 		return nil, ErrFileFuncNotSet
 	}
 
-	return d.staticFileFunc(filename)
+	if d.staticCache != nil {
+		if data, exists := d.staticCache.get(filename); exists {
+			return data, nil
+		}
+	}
+
+	data, err := d.staticFileFunc(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.config.Static != nil && d.config.Static.MaxFileSize > 0 && int64(len(data)) > d.config.Static.MaxFileSize {
+		return nil, ErrStaticFileTooLarge
+	}
+
+	if d.staticCache != nil {
+		d.staticCache.set(filename, data)
+	}
+
+	return data, nil
+}
+
+// ReadFile reads a file from the configured directory
+func (d *defaultFileSource) ReadFile(path string) ([]byte, error) {
+	fullPath, err := d.directoryPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// a symlink could point outside of the directory
+	resolved, err := filepath.EvalSymlinks(fullPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to EvalSymlinks")
+	}
+
+	if err := d.checkWithinDirectory(resolved); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(resolved)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ReadFile")
+	}
+
+	return data, nil
+}
+
+// WriteFile writes a file to the configured directory, creating any directories it's in
+func (d *defaultFileSource) WriteFile(path string, data []byte) error {
+	fullPath, err := d.directoryPath(path)
+	if err != nil {
+		return err
+	}
+
+	if !d.config.AllowWrite {
+		return ErrFileWriteNotAllowed
+	}
+
+	// check the closest directory that already exists before creating any, since it could be a symlink to outside of the directory
+	existing := filepath.Dir(fullPath)
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+
+		existing = filepath.Dir(existing)
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return errors.Wrap(err, "failed to EvalSymlinks")
+	}
+
+	if err := d.checkWithinDirectory(resolved); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return errors.Wrap(err, "failed to MkdirAll")
+	}
+
+	// the file is written next to its destination and then moved, so readers never see part of it, and
+	// so that if the destination is a symlink, the symlink is replaced rather than the file it points to
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), ".reactr-*")
+	if err != nil {
+		return errors.Wrap(err, "failed to CreateTemp")
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to Write")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to Close")
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return errors.Wrap(err, "failed to Chmod")
+	}
+
+	if err := os.Rename(tmp.Name(), fullPath); err != nil {
+		return errors.Wrap(err, "failed to Rename")
+	}
+
+	return nil
+}
+
+// directoryPath returns the path on the host of a path within the configured directory
+func (d *defaultFileSource) directoryPath(path string) (string, error) {
+	if !d.config.Enabled {
+		return "", ErrCapabilityNotEnabled
+	}
+
+	if d.config.Directory == "" {
+		return "", ErrFileDirectoryNotSet
+	}
+
+	path = filepath.FromSlash(path)
+
+	if !filepath.IsLocal(path) {
+		return "", ErrFilePathDisallowed
+	}
+
+	return filepath.Join(d.config.Directory, path), nil
+}
+
+// checkWithinDirectory returns ErrFilePathDisallowed if a path with its symlinks resolved is outside of the configured directory
+func (d *defaultFileSource) checkWithinDirectory(resolved string) error {
+	root, err := filepath.EvalSymlinks(d.config.Directory)
+	if err != nil {
+		return errors.Wrap(err, "failed to EvalSymlinks")
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ErrFilePathDisallowed
+	}
+
+	return nil
 }
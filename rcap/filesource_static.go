@@ -0,0 +1,235 @@
+package rcap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrStaticFileTooLarge is returned when a static file is larger than the File capability's MaxFileSize
+var ErrStaticFileTooLarge = errors.New("static file is larger than the maximum size")
+
+// defaultStaticCacheMaxBytes is the most memory that cached static files use if CacheMaxBytes isn't set
+const defaultStaticCacheMaxBytes = 64 << 20
+
+// staticHTTPTimeout is how long a request to a static file origin can take, even if its caller's context has no deadline
+const staticHTTPTimeout = time.Second * 30
+
+// StaticFilesConfig is configuration for where the File capability's static files come from when its FileFunc isn't set
+// (such as by a bundle), and for how they're cached. Only one of S3, HTTPOrigin and FS should be set
+type StaticFilesConfig struct {
+	// S3 is a bucket that static files are read from, with Prefix (such as static/) added to their names
+	S3     *S3Config `json:"s3,omitempty" yaml:"s3,omitempty"`
+	Prefix string    `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+
+	// HTTPOrigin is a URL that static files are fetched from, such as https://assets.example.com/static
+	HTTPOrigin string `json:"httpOrigin,omitempty" yaml:"httpOrigin,omitempty"`
+
+	// FS is a filesystem that static files are read from, such as an embed.FS, which can only be set by the host
+	FS fs.FS `json:"-" yaml:"-"`
+
+	// MaxFileSize is the size in bytes of the largest static file that can be read, or unlimited if 0
+	MaxFileSize int64 `json:"maxFileSize,omitempty" yaml:"maxFileSize,omitempty"`
+
+	// CacheSeconds is how long static files are kept in memory once they've been read, or they aren't cached if 0.
+	// CacheMaxBytes limits the total size of the cached files, or 64MiB if 0
+	CacheSeconds  int   `json:"cacheSeconds,omitempty" yaml:"cacheSeconds,omitempty"`
+	CacheMaxBytes int64 `json:"cacheMaxBytes,omitempty" yaml:"cacheMaxBytes,omitempty"`
+}
+
+// staticFileFunc returns a function that reads files from the configured backend, or nil if none is configured
+func (s StaticFilesConfig) staticFileFunc() staticFileContextFunc {
+	switch {
+	case s.FS != nil:
+		return staticFilesFromFS(s.FS, s.MaxFileSize)
+	case s.S3 != nil:
+		store := DefaultBlobStore(BlobConfig{Enabled: true, Rules: BlobRules{AllowGet: true}, S3: s.S3}).(*s3BlobStore)
+		return staticFilesFromBlob(store, s.Prefix, s.MaxFileSize)
+	case s.HTTPOrigin != "":
+		return staticFilesFromHTTP(s.HTTPOrigin, &http.Client{Timeout: staticHTTPTimeout}, s.MaxFileSize)
+	}
+
+	return nil
+}
+
+// staticFileName cleans a static file's name, so that it can't refer to anything outside of the backend's root
+func staticFileName(filename string) string {
+	return strings.TrimPrefix(path.Clean("/"+filename), "/")
+}
+
+func staticFilesFromFS(fsys fs.FS, maxSize int64) staticFileContextFunc {
+	return func(ctx context.Context, filename string) ([]byte, error) {
+		name := staticFileName(filename)
+
+		if maxSize > 0 {
+			info, err := fs.Stat(fsys, name)
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to Stat")
+			}
+
+			if info.Size() > maxSize {
+				return nil, ErrStaticFileTooLarge
+			}
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to ReadFile")
+		}
+
+		return data, nil
+	}
+}
+
+func staticFilesFromBlob(store *s3BlobStore, prefix string, maxSize int64) staticFileContextFunc {
+	return func(ctx context.Context, filename string) ([]byte, error) {
+		data, err := store.get(ctx, prefix+staticFileName(filename), maxSize)
+		if err != nil {
+			if errors.Is(err, ErrBlobNotFound) {
+				return nil, os.ErrNotExist
+			} else if errors.Is(err, errBlobTooLarge) {
+				return nil, ErrStaticFileTooLarge
+			}
+
+			return nil, errors.Wrap(err, "failed to get")
+		}
+
+		return data, nil
+	}
+}
+
+func staticFilesFromHTTP(origin string, client *http.Client, maxSize int64) staticFileContextFunc {
+	origin = strings.TrimSuffix(origin, "/")
+
+	return func(ctx context.Context, filename string) ([]byte, error) {
+		segments := strings.Split(staticFileName(filename), "/")
+		for i := range segments {
+			segments[i] = url.PathEscape(segments[i])
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/"+strings.Join(segments, "/"), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to NewRequestWithContext")
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to Do")
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, os.ErrNotExist
+		} else if resp.StatusCode > 299 {
+			return nil, fmt.Errorf("static file origin responded with status %d", resp.StatusCode)
+		}
+
+		if maxSize > 0 && resp.ContentLength > maxSize {
+			return nil, ErrStaticFileTooLarge
+		}
+
+		body := io.Reader(resp.Body)
+		if maxSize > 0 {
+			// read one byte past the limit to find out whether the file is larger than it
+			body = io.LimitReader(resp.Body, maxSize+1)
+		}
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to ReadAll")
+		}
+
+		return data, nil
+	}
+}
+
+type cachedStaticFile struct {
+	data    []byte
+	expires time.Time
+}
+
+// staticFileCache keeps static files in memory for a while after they're read, evicting the oldest when it's full
+type staticFileCache struct {
+	ttl      time.Duration
+	maxBytes int64
+
+	files map[string]cachedStaticFile
+	order []string
+	size  int64
+	lock  sync.Mutex
+}
+
+func newStaticFileCache(ttl time.Duration, maxBytes int64) *staticFileCache {
+	if maxBytes <= 0 {
+		maxBytes = defaultStaticCacheMaxBytes
+	}
+
+	c := &staticFileCache{
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		files:    map[string]cachedStaticFile{},
+		order:    []string{},
+	}
+
+	return c
+}
+
+func (c *staticFileCache) get(name string) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	file, exists := c.files[name]
+	if !exists || time.Now().After(file.expires) {
+		return nil, false
+	}
+
+	return file.data, true
+}
+
+func (c *staticFileCache) set(name string, data []byte) {
+	if int64(len(data)) > c.maxBytes {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.remove(name)
+
+	for c.size+int64(len(data)) > c.maxBytes && len(c.order) > 0 {
+		c.remove(c.order[0])
+	}
+
+	c.files[name] = cachedStaticFile{data: data, expires: time.Now().Add(c.ttl)}
+	c.order = append(c.order, name)
+	c.size += int64(len(data))
+}
+
+// remove removes a file from the cache, and must be called with the lock held
+func (c *staticFileCache) remove(name string) {
+	file, exists := c.files[name]
+	if !exists {
+		return
+	}
+
+	delete(c.files, name)
+	c.size -= int64(len(file.data))
+
+	for i, n := range c.order {
+		if n == name {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
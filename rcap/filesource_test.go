@@ -0,0 +1,251 @@
+package rcap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+)
+
+func TestFileDirectory(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// links that lead outside of the directory
+	os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "secret-link.txt"))
+	os.Symlink(outside, filepath.Join(dir, "outside-link"))
+
+	files := DefaultFileSource(FileConfig{Enabled: true, Directory: dir, AllowWrite: true}).(FileDirectoryCapability)
+
+	t.Run("write and read", func(t *testing.T) {
+		if err := files.WriteFile("artifacts/2021/report.txt", []byte("report")); err != nil {
+			t.Fatal("failed to WriteFile", err)
+		}
+
+		if err := files.WriteFile("artifacts/2021/report.txt", []byte("updated report")); err != nil {
+			t.Fatal("failed to WriteFile", err)
+		}
+
+		data, err := files.ReadFile("artifacts/2021/report.txt")
+		if err != nil || string(data) != "updated report" {
+			t.Errorf("expected 'updated report', got %q (%v)", data, err)
+		}
+
+		// no temporary files should be left behind
+		if entries, _ := os.ReadDir(filepath.Join(dir, "artifacts", "2021")); len(entries) != 1 {
+			t.Error("expected 1 file, got", len(entries))
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := files.ReadFile("missing.txt"); !errors.Is(err, os.ErrNotExist) {
+			t.Error("expected os.ErrNotExist, got", err)
+		}
+	})
+
+	t.Run("outside of directory", func(t *testing.T) {
+		for _, path := range []string{"../secret.txt", "artifacts/../../secret.txt", "/etc/passwd", "secret-link.txt", "outside-link/secret.txt"} {
+			if _, err := files.ReadFile(path); !errors.Is(err, ErrFilePathDisallowed) {
+				t.Errorf("expected reading %s to be disallowed, got %v", path, err)
+			}
+		}
+
+		for _, path := range []string{"../new.txt", "outside-link/new.txt", "outside-link/nested/new.txt"} {
+			if err := files.WriteFile(path, []byte("new")); !errors.Is(err, ErrFilePathDisallowed) {
+				t.Errorf("expected writing %s to be disallowed, got %v", path, err)
+			}
+		}
+
+		if entries, _ := os.ReadDir(outside); len(entries) != 1 {
+			t.Error("expected nothing to be written outside of the directory, got", len(entries), "files")
+		}
+	})
+
+	t.Run("write not allowed", func(t *testing.T) {
+		readOnly := DefaultFileSource(FileConfig{Enabled: true, Directory: dir}).(FileDirectoryCapability)
+
+		if err := readOnly.WriteFile("new.txt", []byte("new")); !errors.Is(err, ErrFileWriteNotAllowed) {
+			t.Error("expected ErrFileWriteNotAllowed, got", err)
+		}
+
+		if _, err := readOnly.ReadFile("artifacts/2021/report.txt"); err != nil {
+			t.Error("failed to ReadFile", err)
+		}
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		if _, err := DefaultFileSource(FileConfig{Enabled: true}).(FileDirectoryCapability).ReadFile("report.txt"); !errors.Is(err, ErrFileDirectoryNotSet) {
+			t.Error("expected ErrFileDirectoryNotSet, got", err)
+		}
+
+		if _, err := DefaultFileSource(FileConfig{Directory: dir}).(FileDirectoryCapability).ReadFile("report.txt"); !errors.Is(err, ErrCapabilityNotEnabled) {
+			t.Error("expected ErrCapabilityNotEnabled, got", err)
+		}
+	})
+}
+
+func TestStaticFiles(t *testing.T) {
+	origin := newTestStaticOrigin(t)
+	defer origin.Close()
+
+	s3 := newTestS3Server(t)
+	defer s3.Close()
+
+	s3Config := &S3Config{
+		Endpoint:        s3.URL,
+		Region:          "us-east-1",
+		Bucket:          "reactr",
+		AccessKeyID:     "AKIDTEST",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	}
+
+	store := DefaultBlobStore(BlobConfig{Enabled: true, Rules: defaultBlobRules(), S3: s3Config})
+	store.Put(context.Background(), "static/index.html", []byte("<h1>hello</h1>"), "text/html")
+	store.Put(context.Background(), "static/large.bin", []byte(strings.Repeat("x", 64)), "application/octet-stream")
+
+	sources := map[string]*StaticFilesConfig{
+		"fs": {FS: fstest.MapFS{
+			"index.html": &fstest.MapFile{Data: []byte("<h1>hello</h1>")},
+			"large.bin":  &fstest.MapFile{Data: []byte(strings.Repeat("x", 64))},
+		}},
+		"s3":   {S3: s3Config, Prefix: "static/"},
+		"http": {HTTPOrigin: origin.URL + "/static/"},
+	}
+
+	for name, static := range sources {
+		t.Run(name, func(t *testing.T) {
+			static.MaxFileSize = 32
+
+			files := DefaultFileSource(FileConfig{Enabled: true, Static: static})
+
+			for _, filename := range []string{"index.html", "/index.html", "../index.html"} {
+				data, err := files.GetStatic(filename)
+				if err != nil || string(data) != "<h1>hello</h1>" {
+					t.Errorf("expected %s to be read, got %q (%v)", filename, data, err)
+				}
+			}
+
+			if _, err := files.GetStatic("missing.html"); !errors.Is(err, os.ErrNotExist) {
+				t.Error("expected os.ErrNotExist, got", err)
+			}
+
+			if _, err := files.GetStatic("large.bin"); !errors.Is(err, ErrStaticFileTooLarge) {
+				t.Error("expected ErrStaticFileTooLarge, got", err)
+			}
+
+			if name != "fs" {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				if _, err := GetStaticWithContext(files, ctx, "index.html"); !errors.Is(err, context.Canceled) {
+					t.Error("expected context.Canceled, got", err)
+				}
+			}
+		})
+	}
+
+	t.Run("FileFunc takes precedence", func(t *testing.T) {
+		files := DefaultFileSource(FileConfig{
+			Enabled:  true,
+			FileFunc: func(string) ([]byte, error) { return []byte("from FileFunc"), nil },
+			Static:   &StaticFilesConfig{HTTPOrigin: origin.URL + "/static"},
+		})
+
+		if data, err := files.GetStatic("index.html"); err != nil || string(data) != "from FileFunc" {
+			t.Errorf("expected the FileFunc to be used, got %q (%v)", data, err)
+		}
+	})
+}
+
+func TestStaticFilesCache(t *testing.T) {
+	reads := map[string]int{}
+
+	files := DefaultFileSource(FileConfig{
+		Enabled: true,
+		FileFunc: func(filename string) ([]byte, error) {
+			reads[filename]++
+			return []byte(strings.Repeat("x", 10)), nil
+		},
+		Static: &StaticFilesConfig{CacheSeconds: 60, CacheMaxBytes: 25},
+	})
+
+	for i := 0; i < 3; i++ {
+		files.GetStatic("a.txt")
+	}
+
+	if reads["a.txt"] != 1 {
+		t.Errorf("expected a.txt to be read once, got %d", reads["a.txt"])
+	}
+
+	// the cache only fits two files, so a.txt is evicted when c.txt is read
+	files.GetStatic("b.txt")
+	files.GetStatic("c.txt")
+	files.GetStatic("a.txt")
+
+	if reads["a.txt"] != 2 {
+		t.Errorf("expected a.txt to be read again after it was evicted, got %d", reads["a.txt"])
+	}
+
+	files.GetStatic("c.txt")
+
+	if reads["c.txt"] != 1 {
+		t.Errorf("expected c.txt to stay cached, got %d", reads["c.txt"])
+	}
+}
+
+// newTestStaticOrigin starts a server that serves the same files as the other static file tests under /static/
+func newTestStaticOrigin(t *testing.T) *httptest.Server {
+	files := map[string]string{
+		"/static/index.html": "<h1>hello</h1>",
+		"/static/large.bin":  strings.Repeat("x", 64),
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, exists := files[r.URL.Path]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+
+		// stream the response so that the size limit is enforced while reading it, not from its Content-Length
+		w.Header().Set("Transfer-Encoding", "chunked")
+		w.Write([]byte(data))
+		w.(http.Flusher).Flush()
+	}))
+}
+
+// staticOnlySource is a FileCapability that implements none of the optional interfaces
+type staticOnlySource struct{}
+
+func (s staticOnlySource) GetStatic(filename string) ([]byte, error) {
+	return []byte(filename), nil
+}
+
+func TestFileSourceOptionalInterfaces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// a FileCapability that doesn't support contexts is still used, without the context
+	if data, err := GetStaticWithContext(staticOnlySource{}, ctx, "index.html"); err != nil || string(data) != "index.html" {
+		t.Errorf("expected GetStatic to be used, got %q (%v)", data, err)
+	}
+
+	if _, err := FileDirectory(staticOnlySource{}); !errors.Is(err, ErrFileDirectoryNotSupported) {
+		t.Error("expected ErrFileDirectoryNotSupported, got", err)
+	}
+
+	if _, err := FileDirectory(DefaultFileSource(FileConfig{Enabled: true})); err != nil {
+		t.Error("expected the default file source to support directories, got", err)
+	}
+}
@@ -2,30 +2,67 @@ package rcap
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// ErrGraphQLHeaderDisallowed is returned when a Runnable sets a header that isn't in the capability's AllowedHeaders
+var ErrGraphQLHeaderDisallowed = errors.New("setting this GraphQL request header is disallowed")
+
+const (
+	graphQLDefaultRetryDelay      = 100 * time.Millisecond
+	graphQLDefaultCacheMaxEntries = 1000
+)
+
 // GraphQLConfig is configuration for the GraphQL capability
 type GraphQLConfig struct {
 	Enabled bool      `json:"enabled" yaml:"enabled"`
 	Rules   HTTPRules `json:"rules" yaml:"rules"`
+
+	// AllowedHeaders are the names of the headers (matched case-insensitively) that Runnables can set on their
+	// requests. Runnables can only replace the Authorization header set by the Auth capability if it is listed
+	AllowedHeaders []string `json:"allowedHeaders" yaml:"allowedHeaders"`
+
+	// PersistedQueries sends the SHA-256 hash of each query instead of the query itself (as an automatic persisted
+	// query), and only sends the whole query if the server responds that it doesn't know the hash yet
+	PersistedQueries bool `json:"persistedQueries,omitempty" yaml:"persistedQueries,omitempty"`
+
+	// CacheSeconds is how long successful responses to queries are cached for, keyed by the endpoint, the query, its
+	// variables and the request's headers, or if 0 they aren't cached. CacheMaxEntries limits the number of cached
+	// responses, or 1000 if 0
+	CacheSeconds    int `json:"cacheSeconds,omitempty" yaml:"cacheSeconds,omitempty"`
+	CacheMaxEntries int `json:"cacheMaxEntries,omitempty" yaml:"cacheMaxEntries,omitempty"`
+
+	// Retries is the number of times a query is retried if it can't be sent or the server fails (with a 5xx or 429 status),
+	// waiting RetryDelayMillis (or 100ms if 0) before the first retry and twice as long before each one after that
+	Retries          int `json:"retries,omitempty" yaml:"retries,omitempty"`
+	RetryDelayMillis int `json:"retryDelayMillis,omitempty" yaml:"retryDelayMillis,omitempty"`
 }
 
 // GraphQLCapability is a GraphQL capability for Reactr Modules
 type GraphQLCapability interface {
 	Do(auth AuthCapability, endpoint, query string) (*GraphQLResponse, error)
+	DoRequest(auth AuthCapability, endpoint string, request GraphQLRequest, headers http.Header) (*GraphQLResponse, error)
+	// DoRequestWithContext sends a request that is cancelled along with ctx, including while it's waiting to be retried
+	DoRequestWithContext(ctx context.Context, auth AuthCapability, endpoint string, request GraphQLRequest, headers http.Header) (*GraphQLResponse, error)
 }
 
 // defaultGraphQLClient is the default implementation of the GraphQL capability
 type defaultGraphQLClient struct {
 	config GraphQLConfig
 	client *http.Client
+	cache  *graphQLCache
 }
 
 // DefaultGraphQLClient creates a GraphQLClient object
@@ -33,6 +70,7 @@ func DefaultGraphQLClient(config GraphQLConfig) GraphQLCapability {
 	g := &defaultGraphQLClient{
 		config: config,
 		client: http.DefaultClient,
+		cache:  newGraphQLCache(),
 	}
 
 	return g
@@ -40,9 +78,10 @@ func DefaultGraphQLClient(config GraphQLConfig) GraphQLCapability {
 
 // GraphQLRequest is a request to a GraphQL endpoint
 type GraphQLRequest struct {
-	Query         string            `json:"query"`
-	Variables     map[string]string `json:"variables,omitempty"`
-	OperationName string            `json:"operationName,omitempty"`
+	Query         string                 `json:"query,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"`
 }
 
 // GraphQLResponse is a GraphQL response
@@ -53,70 +92,301 @@ type GraphQLResponse struct {
 
 // GraphQLError is a GraphQL error
 type GraphQLError struct {
-	Message string `json:"message"`
-	Path    string `json:"path"`
+	Message    string                 `json:"message"`
+	Path       string                 `json:"path"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
 }
 
+// Do sends a query with no variables to the endpoint
 func (g *defaultGraphQLClient) Do(auth AuthCapability, endpoint, query string) (*GraphQLResponse, error) {
+	r := GraphQLRequest{
+		Query:     query,
+		Variables: map[string]interface{}{},
+	}
+
+	return g.DoRequest(auth, endpoint, r, nil)
+}
+
+// DoRequest sends a request to the endpoint, so that its variables and operation name are
+// sent separately from the query rather than being interpolated into it. Any headers are
+// added to the request, and an Authorization header replaces the one from the Auth capability
+func (g *defaultGraphQLClient) DoRequest(auth AuthCapability, endpoint string, r GraphQLRequest, headers http.Header) (*GraphQLResponse, error) {
+	return g.DoRequestWithContext(context.Background(), auth, endpoint, r, headers)
+}
+
+// DoRequestWithContext sends a request to the endpoint in the same way as DoRequest, cancelling it along with ctx
+func (g *defaultGraphQLClient) DoRequestWithContext(ctx context.Context, auth AuthCapability, endpoint string, r GraphQLRequest, headers http.Header) (*GraphQLResponse, error) {
 	if !g.config.Enabled {
 		return nil, ErrCapabilityNotEnabled
 	}
 
-	r := &GraphQLRequest{
-		Query:     query,
-		Variables: map[string]string{},
+	for name := range headers {
+		if !g.headerIsAllowed(name) {
+			return nil, errors.Wrapf(ErrGraphQLHeaderDisallowed, "header %s", name)
+		}
+	}
+
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Parse endpoint")
+	}
+
+	reqHeaders := http.Header{}
+	reqHeaders.Add("Content-Type", "application/json")
+
+	authHeader := auth.HeaderForDomain(endpointURL.Host)
+	if authHeader != nil && authHeader.Value != "" && headers.Get("Authorization") == "" {
+		reqHeaders.Add("Authorization", fmt.Sprintf("%s %s", authHeader.HeaderType, authHeader.Value))
+	}
+
+	for name, values := range headers {
+		for _, value := range values {
+			reqHeaders.Add(name, value)
+		}
 	}
 
+	// mutations have side effects, so they're never cached or retried
+	isQuery := !graphQLIsMutation(r.Query)
+
+	cacheKey := ""
+	if isQuery && g.config.CacheSeconds > 0 {
+		cacheKey, err = graphQLCacheKey(endpoint, r, reqHeaders)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to graphQLCacheKey")
+		}
+
+		if cached := g.cache.get(cacheKey); cached != nil {
+			return cached, nil
+		}
+	}
+
+	if g.config.PersistedQueries && r.Query != "" {
+		sum := sha256.Sum256([]byte(r.Query))
+
+		extensions := map[string]interface{}{}
+		for key, val := range r.Extensions {
+			extensions[key] = val
+		}
+
+		r.Extensions = extensions
+		r.Extensions["persistedQuery"] = map[string]interface{}{"version": 1, "sha256Hash": hex.EncodeToString(sum[:])}
+
+		// send only the query's hash first, and the whole query if the server doesn't know it yet
+		hashOnly := r
+		hashOnly.Query = ""
+
+		gqlResp, err := g.send(ctx, endpoint, hashOnly, reqHeaders, isQuery)
+		if !graphQLPersistedQueryNotFound(gqlResp) {
+			return g.cacheResponse(cacheKey, gqlResp, err)
+		}
+	}
+
+	gqlResp, err := g.send(ctx, endpoint, r, reqHeaders, isQuery)
+
+	return g.cacheResponse(cacheKey, gqlResp, err)
+}
+
+// send posts a request to the endpoint, retrying if it can't be sent or the server fails and retry is true
+func (g *defaultGraphQLClient) send(ctx context.Context, endpoint string, r GraphQLRequest, headers http.Header, retry bool) (*GraphQLResponse, error) {
 	reqBytes, err := json.Marshal(r)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to Marshal request")
 	}
 
-	endpointURL, err := url.Parse(endpoint)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to Parse endpoint")
+	attempts := 1
+	if retry {
+		attempts += g.config.Retries
+	}
+
+	delay := time.Duration(g.config.RetryDelayMillis) * time.Millisecond
+	if delay <= 0 {
+		delay = graphQLDefaultRetryDelay
+	}
+
+	var gqlResp *GraphQLResponse
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, errors.Wrap(err, "cancelled while waiting to retry")
+			}
+
+			delay *= 2
+		}
+
+		var status int
+		gqlResp, status, err = g.post(ctx, endpoint, reqBytes, headers)
+		if err == nil || (status < 500 && status != http.StatusTooManyRequests) {
+			break
+		}
 	}
 
-	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBuffer(reqBytes))
+	return gqlResp, err
+}
+
+// post sends a request to the endpoint once, returning the HTTP status code (or 0 if the request couldn't be sent)
+func (g *defaultGraphQLClient) post(ctx context.Context, endpoint string, reqBytes []byte, headers http.Header) (*GraphQLResponse, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(reqBytes))
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to NewRequest")
+		return nil, 0, errors.Wrap(err, "failed to NewRequestWithContext")
 	}
 
 	if err := g.config.Rules.requestIsAllowed(req); err != nil {
-		return nil, errors.Wrap(err, "failed to requestIsAllowed")
+		return nil, http.StatusForbidden, errors.Wrap(err, "failed to requestIsAllowed")
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-
-	authHeader := auth.HeaderForDomain(endpointURL.Host)
-	if authHeader != nil && authHeader.Value != "" {
-		req.Header.Add("Authorization", fmt.Sprintf("%s %s", authHeader.HeaderType, authHeader.Value))
+	for name, values := range headers {
+		req.Header[name] = values
 	}
 
 	resp, err := g.client.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to Do")
+		return nil, 0, errors.Wrap(err, "failed to Do")
 	}
 
 	defer resp.Body.Close()
 
 	respJSON, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to ReadAll body")
+		return nil, resp.StatusCode, errors.Wrap(err, "failed to ReadAll body")
 	}
 
 	gqlResp := &GraphQLResponse{}
 	if err := json.Unmarshal(respJSON, gqlResp); err != nil {
-		return nil, errors.Wrap(err, "failed to Unmarshal response")
+		return nil, resp.StatusCode, errors.Wrap(err, "failed to Unmarshal response")
 	}
 
 	if resp.StatusCode > 299 {
-		return gqlResp, fmt.Errorf("non-200 HTTP response code; %s", string(respJSON))
+		return gqlResp, resp.StatusCode, fmt.Errorf("non-200 HTTP response code; %s", string(respJSON))
 	}
 
 	if gqlResp.Errors != nil && len(gqlResp.Errors) > 0 {
-		return gqlResp, fmt.Errorf("graphQL error; path: %s, message: %s", gqlResp.Errors[0].Path, gqlResp.Errors[0].Message)
+		return gqlResp, resp.StatusCode, fmt.Errorf("graphQL error; path: %s, message: %s", gqlResp.Errors[0].Path, gqlResp.Errors[0].Message)
+	}
+
+	return gqlResp, resp.StatusCode, nil
+}
+
+// cacheResponse caches a successful response if key is set, and returns the response and error it's given
+func (g *defaultGraphQLClient) cacheResponse(key string, gqlResp *GraphQLResponse, err error) (*GraphQLResponse, error) {
+	if key != "" && err == nil {
+		g.cache.set(key, gqlResp, time.Duration(g.config.CacheSeconds)*time.Second, g.config.CacheMaxEntries)
+	}
+
+	return gqlResp, err
+}
+
+// headerIsAllowed returns true if the name is one of the capability's AllowedHeaders
+func (g *defaultGraphQLClient) headerIsAllowed(name string) bool {
+	for _, allowed := range g.config.AllowedHeaders {
+		if strings.EqualFold(allowed, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// graphQLIsMutation returns true if a query document's first operation is a mutation
+func graphQLIsMutation(query string) bool {
+	for _, line := range strings.Split(query, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		return strings.HasPrefix(line, "mutation")
+	}
+
+	return false
+}
+
+// graphQLPersistedQueryNotFound returns true if a response says that the server doesn't know a persisted query's hash
+func graphQLPersistedQueryNotFound(resp *GraphQLResponse) bool {
+	if resp == nil {
+		return false
+	}
+
+	for _, e := range resp.Errors {
+		if e.Message == "PersistedQueryNotFound" || e.Extensions["code"] == "PERSISTED_QUERY_NOT_FOUND" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// graphQLCacheKey returns the key that a request's response is cached with
+func graphQLCacheKey(endpoint string, r GraphQLRequest, headers http.Header) (string, error) {
+	// maps are marshalled with sorted keys, so equal requests have the same key
+	keyJSON, err := json.Marshal(map[string]interface{}{
+		"endpoint": endpoint,
+		"request":  r,
+		"headers":  headers,
+	})
+
+	if err != nil {
+		return "", errors.Wrap(err, "failed to Marshal")
+	}
+
+	sum := sha256.Sum256(keyJSON)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type graphQLCacheEntry struct {
+	resp    *GraphQLResponse
+	expires time.Time
+}
+
+// graphQLCache holds the responses to GraphQL queries until they expire
+type graphQLCache struct {
+	entries map[string]graphQLCacheEntry
+	lock    sync.Mutex
+}
+
+func newGraphQLCache() *graphQLCache {
+	g := &graphQLCache{
+		entries: map[string]graphQLCacheEntry{},
+	}
+
+	return g
+}
+
+func (g *graphQLCache) get(key string) *GraphQLResponse {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	entry, exists := g.entries[key]
+	if !exists || time.Now().After(entry.expires) {
+		return nil
+	}
+
+	return entry.resp
+}
+
+// set caches a response, removing expired ones if the cache has maxEntries, and skipping it if it's still full
+func (g *graphQLCache) set(key string, resp *GraphQLResponse, ttl time.Duration, maxEntries int) {
+	if maxEntries <= 0 {
+		maxEntries = graphQLDefaultCacheMaxEntries
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	now := time.Now()
+
+	if len(g.entries) >= maxEntries {
+		for k, entry := range g.entries {
+			if now.After(entry.expires) {
+				delete(g.entries, k)
+			}
+		}
+
+		if len(g.entries) >= maxEntries {
+			return
+		}
 	}
 
-	return gqlResp, nil
+	g.entries[key] = graphQLCacheEntry{resp: resp, expires: now.Add(ttl)}
 }
@@ -0,0 +1,184 @@
+package rcap
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestGraphQLHeaders(t *testing.T) {
+	// the server returns the headers it received as its data
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]string{
+				"authorization": r.Header.Get("Authorization"),
+				"tenant":        r.Header.Get("X-Tenant"),
+			},
+		})
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+
+	auth := DefaultAuthProvider(AuthConfig{
+		Enabled: true,
+		Headers: map[string]AuthHeader{serverURL.Host: {HeaderType: "bearer", Value: "host-token"}},
+	})
+
+	client := DefaultGraphQLClient(GraphQLConfig{
+		Enabled:        true,
+		Rules:          defaultHTTPRules(),
+		AllowedHeaders: []string{"authorization", "X-Tenant"},
+	})
+
+	req := GraphQLRequest{Query: "{ viewer { id } }"}
+
+	resp, err := client.DoRequest(auth, server.URL, req, nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to DoRequest"))
+	}
+
+	if resp.Data["authorization"] != "bearer host-token" {
+		t.Errorf("expected the Auth capability's header, got %v", resp.Data["authorization"])
+	}
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer runnable-token")
+	headers.Set("X-Tenant", "acme")
+
+	resp, err = client.DoRequest(auth, server.URL, req, headers)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to DoRequest"))
+	}
+
+	if resp.Data["authorization"] != "Bearer runnable-token" || resp.Data["tenant"] != "acme" {
+		t.Errorf("expected the Runnable's headers, got %v", resp.Data)
+	}
+
+	headers.Set("Cookie", "session=abc")
+
+	if _, err := client.DoRequest(auth, server.URL, req, headers); !errors.Is(err, ErrGraphQLHeaderDisallowed) {
+		t.Error("expected ErrGraphQLHeaderDisallowed, got", err)
+	}
+}
+
+func TestGraphQLPersistedQueries(t *testing.T) {
+	persisted := map[string]string{}
+	requests := []GraphQLRequest{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := GraphQLRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		hash := req.Extensions["persistedQuery"].(map[string]interface{})["sha256Hash"].(string)
+
+		if req.Query == "" {
+			if _, exists := persisted[hash]; !exists {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"errors": []map[string]interface{}{{"message": "PersistedQueryNotFound", "extensions": map[string]string{"code": "PERSISTED_QUERY_NOT_FOUND"}}},
+				})
+				return
+			}
+		} else {
+			persisted[hash] = req.Query
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"query": persisted[hash]}})
+	}))
+	defer server.Close()
+
+	client := DefaultGraphQLClient(GraphQLConfig{Enabled: true, Rules: defaultHTTPRules(), PersistedQueries: true})
+
+	auth := DefaultAuthProvider(AuthConfig{Enabled: true})
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.DoRequest(auth, server.URL, GraphQLRequest{Query: "{ viewer { id } }"}, nil)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to DoRequest"))
+		}
+
+		if resp.Data["query"] != "{ viewer { id } }" {
+			t.Errorf("expected the persisted query, got %v", resp.Data)
+		}
+	}
+
+	// the hash is sent, then the query when the server doesn't know it, then only the hash after that
+	if len(requests) != 3 || requests[0].Query != "" || requests[1].Query == "" || requests[2].Query != "" {
+		t.Errorf("expected the query to be sent once, got %+v", requests)
+	}
+}
+
+func TestGraphQLCacheAndRetries(t *testing.T) {
+	calls := map[string]int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := GraphQLRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		key := req.Query + fmt.Sprint(req.Variables)
+		calls[key]++
+
+		// every query fails the first time it's sent
+		if calls[key] == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("{}"))
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"calls": calls[key]}})
+	}))
+	defer server.Close()
+
+	client := DefaultGraphQLClient(GraphQLConfig{
+		Enabled:          true,
+		Rules:            defaultHTTPRules(),
+		CacheSeconds:     60,
+		Retries:          1,
+		RetryDelayMillis: 1,
+	})
+
+	auth := DefaultAuthProvider(AuthConfig{Enabled: true})
+
+	query := "query User($id: ID!) { user(id: $id) { name } }"
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.DoRequest(auth, server.URL, GraphQLRequest{Query: query, Variables: map[string]interface{}{"id": "1"}}, nil)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to DoRequest"))
+		}
+
+		if resp.Data["calls"] != float64(2) {
+			t.Errorf("expected the retried response to be cached, got %v", resp.Data)
+		}
+	}
+
+	// different variables aren't served from the cache
+	if _, err := client.DoRequest(auth, server.URL, GraphQLRequest{Query: query, Variables: map[string]interface{}{"id": "2"}}, nil); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to DoRequest"))
+	}
+
+	if calls[query+"map[id:2]"] != 2 {
+		t.Errorf("expected the query to be sent for the new variables, got %d calls", calls[query+"map[id:2]"])
+	}
+
+	// mutations are neither retried nor cached
+	mutation := "mutation { logout }"
+
+	if _, err := client.DoRequest(auth, server.URL, GraphQLRequest{Query: mutation}, nil); err == nil {
+		t.Error("expected the mutation to fail without being retried")
+	}
+
+	for i := 0; i < 2; i++ {
+		client.DoRequest(auth, server.URL, GraphQLRequest{Query: mutation}, nil)
+	}
+
+	if calls[mutation+"map[]"] != 3 {
+		t.Errorf("expected the mutation to be sent 3 times, got %d", calls[mutation+"map[]"])
+	}
+}
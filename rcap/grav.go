@@ -0,0 +1,88 @@
+package rcap
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+)
+
+var (
+	ErrGravPodNotSet       = errors.New("grav pod not set")
+	ErrGravPodDisconnected = errors.New("grav pod is disconnected")
+	ErrGravTypeDisallowed  = errors.New("sending messages of this type is disallowed")
+)
+
+// GravConfig is configuration for the Grav capability
+type GravConfig struct {
+	Enabled bool      `json:"enabled" yaml:"enabled"`
+	Rules   GravRules `json:"rules" yaml:"rules"`
+
+	// Pod is the pod that messages are sent from, which can only be set by the host
+	Pod *grav.Pod `json:"-" yaml:"-"`
+}
+
+// GravRules is a set of rules that governs use of the Grav capability
+type GravRules struct {
+	// AllowedTypes are the message types that can be sent, which can be patterns such as order.*
+	// If none are listed, messages of any type can be sent.
+	AllowedTypes []string `json:"allowedTypes" yaml:"allowedTypes"`
+}
+
+// GravCapability gives Runnables the ability to send messages onto a Grav bus
+type GravCapability interface {
+	Send(msgType string, data []byte) error
+}
+
+type defaultGrav struct {
+	config GravConfig
+}
+
+// DefaultGrav creates a Grav capability that sends messages from the config's pod
+func DefaultGrav(config GravConfig) GravCapability {
+	d := &defaultGrav{
+		config: config,
+	}
+
+	return d
+}
+
+// Send sends a message of msgType containing data
+func (d *defaultGrav) Send(msgType string, data []byte) error {
+	if !d.config.Enabled {
+		return ErrCapabilityNotEnabled
+	}
+
+	if d.config.Pod == nil {
+		return ErrGravPodNotSet
+	}
+
+	if err := d.config.Rules.typeIsAllowed(msgType); err != nil {
+		return err
+	}
+
+	if receipt := d.config.Pod.Send(grav.NewMsg(msgType, data)); receipt == nil {
+		return ErrGravPodDisconnected
+	}
+
+	return nil
+}
+
+// typeIsAllowed returns a non-nil error if messages of msgType can't be sent
+func (g GravRules) typeIsAllowed(msgType string) error {
+	if msgType == "" {
+		return errors.Wrap(ErrGravTypeDisallowed, "message type is empty")
+	}
+
+	if len(g.AllowedTypes) == 0 {
+		return nil
+	}
+
+	for _, allowed := range g.AllowedTypes {
+		if matched, _ := path.Match(allowed, msgType); matched {
+			return nil
+		}
+	}
+
+	return ErrGravTypeDisallowed
+}
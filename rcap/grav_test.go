@@ -0,0 +1,48 @@
+package rcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+)
+
+func TestGravSend(t *testing.T) {
+	g := grav.New()
+
+	received := make(chan grav.Message, 1)
+
+	receiver := g.Connect()
+	receiver.On(func(msg grav.Message) error {
+		received <- msg
+		return nil
+	})
+
+	sender := DefaultGrav(GravConfig{
+		Enabled: true,
+		Rules:   GravRules{AllowedTypes: []string{"order.*"}},
+		Pod:     g.Connect(),
+	})
+
+	if err := sender.Send("order.created", []byte("order 1")); err != nil {
+		t.Fatal("failed to Send", err)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.Type() != "order.created" || string(msg.Data()) != "order 1" {
+			t.Errorf("unexpected message %s: %s", msg.Type(), msg.Data())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not received")
+	}
+
+	if err := sender.Send("user.deleted", []byte("user 1")); !errors.Is(err, ErrGravTypeDisallowed) {
+		t.Error("expected ErrGravTypeDisallowed, got", err)
+	}
+
+	if err := DefaultGrav(GravConfig{Enabled: true}).Send("order.created", nil); !errors.Is(err, ErrGravPodNotSet) {
+		t.Error("expected ErrGravPodNotSet, got", err)
+	}
+}
@@ -0,0 +1,199 @@
+package rcap
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+var ErrGRPCTargetDisallowed = errors.New("calls to this target are disallowed")
+
+// GRPCConfig is configuration for the gRPC capability
+type GRPCConfig struct {
+	Enabled bool      `json:"enabled" yaml:"enabled"`
+	Rules   GRPCRules `json:"rules" yaml:"rules"`
+
+	// TimeoutSeconds is the deadline for each call, if 0 calls only end when the job's context is done
+	TimeoutSeconds int `json:"timeoutSeconds" yaml:"timeoutSeconds"`
+
+	// Plaintext connects to targets without TLS, otherwise TLS is used with the TLS config, or the system's roots if it is nil
+	Plaintext bool        `json:"plaintext" yaml:"plaintext"`
+	TLS       *tls.Config `json:"-" yaml:"-"`
+}
+
+// GRPCRules is a set of rules that governs use of the gRPC capability
+type GRPCRules struct {
+	// AllowedTargets are the hosts (optionally with a port) that can be called, such as api.example.com, *.example.com or
+	// localhost:9090. If none are listed, any target is allowed.
+	AllowedTargets []string `json:"allowedTargets" yaml:"allowedTargets"`
+}
+
+// GRPCCapability gives Runnables the ability to make unary gRPC calls with serialized messages
+type GRPCCapability interface {
+	Call(ctx context.Context, auth AuthCapability, target, method string, request []byte) ([]byte, error)
+}
+
+type grpcClient struct {
+	config GRPCConfig
+
+	conns map[string]*grpc.ClientConn
+	lock  sync.Mutex
+}
+
+// DefaultGRPCClient creates a gRPC client that follows the config's rules, and keeps a connection open to each target it calls
+func DefaultGRPCClient(config GRPCConfig) GRPCCapability {
+	g := &grpcClient{
+		config: config,
+		conns:  map[string]*grpc.ClientConn{},
+	}
+
+	return g
+}
+
+// Call invokes method (such as /package.Service/Method) on target (host:port) with the serialized
+// request message, and returns the serialized response message. Failed calls return a gRPC status error.
+func (g *grpcClient) Call(ctx context.Context, auth AuthCapability, target, method string, request []byte) ([]byte, error) {
+	if !g.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	if err := g.config.Rules.targetIsAllowed(target); err != nil {
+		return nil, errors.Wrap(err, "failed to targetIsAllowed")
+	}
+
+	if !strings.HasPrefix(method, "/") {
+		method = "/" + method
+	}
+
+	conn, err := g.conn(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to conn")
+	}
+
+	if g.config.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(g.config.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+	}
+
+	authHeader := auth.HeaderForDomain(host)
+	if authHeader != nil && authHeader.Value != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", fmt.Sprintf("%s %s", authHeader.HeaderType, authHeader.Value))
+	}
+
+	response := []byte{}
+
+	if err := conn.Invoke(ctx, method, request, &response, grpc.ForceCodec(rawCodec{})); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// conn returns the connection to target, creating it if needed
+func (g *grpcClient) conn(target string) (*grpc.ClientConn, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if conn, exists := g.conns[target]; exists {
+		return conn, nil
+	}
+
+	creds := insecure.NewCredentials()
+	if !g.config.Plaintext {
+		tlsConfig := &tls.Config{}
+		if g.config.TLS != nil {
+			tlsConfig = g.config.TLS.Clone()
+		}
+
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	// connections are made lazily, so this doesn't block
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Dial")
+	}
+
+	g.conns[target] = conn
+
+	return conn, nil
+}
+
+// targetIsAllowed returns a non-nil error if calls to target are not allowed
+func (g GRPCRules) targetIsAllowed(target string) error {
+	if len(g.AllowedTargets) == 0 {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+	}
+
+	for _, allowed := range g.AllowedTargets {
+		// a target without a port matches any port
+		toMatch := target
+		if _, _, err := net.SplitHostPort(allowed); err != nil {
+			toMatch = host
+		}
+
+		if matchesDomain(allowed, toMatch) {
+			return nil
+		}
+	}
+
+	return ErrGRPCTargetDisallowed
+}
+
+// rawCodec sends and receives messages that have already been serialized, leaving their encoding to the Runnable
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	data, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("rawCodec can't marshal %T", v)
+	}
+
+	return data, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	out, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("rawCodec can't unmarshal into %T", v)
+	}
+
+	*out = append((*out)[:0], data...)
+
+	return nil
+}
+
+// Name is proto so that servers decode the messages as protocol buffers, which they must be serialized as
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// defaultGRPCRules returns the default rules with all targets allowed
+func defaultGRPCRules() GRPCRules {
+	g := GRPCRules{
+		AllowedTargets: []string{},
+	}
+
+	return g
+}
@@ -0,0 +1,105 @@
+package rcap
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGRPCRules(t *testing.T) {
+	rules := defaultGRPCRules()
+	rules.AllowedTargets = []string{"api.example.com", "*.internal.com", "localhost:9090"}
+
+	for _, tc := range []struct {
+		target  string
+		allowed bool
+	}{
+		{"api.example.com:443", true},
+		{"api.example.com", true},
+		{"other.example.com:443", false},
+		{"users.internal.com:8080", true},
+		{"localhost:9090", true},
+		{"localhost:9091", false},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			if err := rules.targetIsAllowed(tc.target); (err == nil) != tc.allowed {
+				t.Errorf("expected allowed to be %t, got error %v", tc.allowed, err)
+			}
+		})
+	}
+}
+
+func TestGRPCClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Listen"))
+	}
+
+	authorization := ""
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+			authorization = md.Get("authorization")[0]
+		}
+
+		return handler(ctx, req)
+	}))
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("reactr", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	go server.Serve(listener)
+	defer server.Stop()
+
+	target := listener.Addr().String()
+
+	client := DefaultGRPCClient(GRPCConfig{Enabled: true, Plaintext: true, TimeoutSeconds: 5, Rules: defaultGRPCRules()})
+	auth := DefaultAuthProvider(AuthConfig{
+		Enabled: true,
+		Headers: map[string]AuthHeader{"127.0.0.1": {HeaderType: "bearer", Value: "abc123"}},
+	})
+
+	request, _ := proto.Marshal(&healthpb.HealthCheckRequest{Service: "reactr"})
+
+	respBytes, err := client.Call(context.Background(), auth, target, "grpc.health.v1.Health/Check", request)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Call"))
+	}
+
+	resp := &healthpb.HealthCheckResponse{}
+	if err := proto.Unmarshal(respBytes, resp); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Unmarshal"))
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Error("expected SERVING, got", resp.Status)
+	}
+
+	if authorization != "bearer abc123" {
+		t.Error("expected auth header to be sent, got", authorization)
+	}
+
+	// calls that fail return their gRPC status
+	request, _ = proto.Marshal(&healthpb.HealthCheckRequest{Service: "missing"})
+
+	_, err = client.Call(context.Background(), auth, target, "/grpc.health.v1.Health/Check", request)
+	if status.Code(err) != codes.NotFound {
+		t.Error("expected NotFound, got", err)
+	}
+
+	disabled := DefaultGRPCClient(GRPCConfig{})
+
+	if _, err := disabled.Call(context.Background(), auth, target, "/grpc.health.v1.Health/Check", request); !errors.Is(err, ErrCapabilityNotEnabled) {
+		t.Error("expected ErrCapabilityNotEnabled, got", err)
+	}
+}
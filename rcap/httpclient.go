@@ -2,9 +2,14 @@ package rcap
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -13,21 +18,73 @@ import (
 type HTTPConfig struct {
 	Enabled bool      `json:"enabled" yaml:"enabled"`
 	Rules   HTTPRules `json:"rules" yaml:"rules"`
+
+	// Client configures how requests are made, and if it's nil http.DefaultClient is used
+	Client *HTTPClientConfig `json:"client,omitempty" yaml:"client,omitempty"`
+
+	// Retry configures how failed requests are retried, and if it's nil they aren't
+	Retry *HTTPRetryConfig `json:"retry,omitempty" yaml:"retry,omitempty"`
+
+	// CircuitBreaker configures the circuit breakers that refuse requests to hosts that keep failing, and if it's nil there are none
+	CircuitBreaker *HTTPCircuitBreakerConfig `json:"circuitBreaker,omitempty" yaml:"circuitBreaker,omitempty"`
+}
+
+// HTTPClientConfig is configuration for the connections that the HTTP capability makes
+type HTTPClientConfig struct {
+	// ProxyURL is the proxy that requests are sent through, such as http://proxy.internal:3128. If it's empty
+	// and UseEnvironmentProxy is set, the proxy is read from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables
+	ProxyURL            string `json:"proxyURL,omitempty" yaml:"proxyURL,omitempty"`
+	UseEnvironmentProxy bool   `json:"useEnvironmentProxy,omitempty" yaml:"useEnvironmentProxy,omitempty"`
+
+	// CAFile is a PEM bundle of the certificate authorities that servers are verified with, in place of the system's roots
+	CAFile string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+
+	// ClientCertFile and ClientKeyFile are a PEM certificate and key that are presented to servers that require mTLS
+	ClientCertFile string `json:"clientCertFile,omitempty" yaml:"clientCertFile,omitempty"`
+	ClientKeyFile  string `json:"clientKeyFile,omitempty" yaml:"clientKeyFile,omitempty"`
+
+	// TLS is used as the base TLS config, which can only be set by the host. The CA and client certificates are added to a copy of it
+	TLS *tls.Config `json:"-" yaml:"-"`
+
+	// MaxIdleConns limits the idle connections kept open to all hosts, and MaxIdleConnsPerHost to each host.
+	// MaxConnsPerHost limits all of the connections to each host, including those in use. 0 uses Go's defaults
+	MaxIdleConns        int `json:"maxIdleConns,omitempty" yaml:"maxIdleConns,omitempty"`
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty" yaml:"maxIdleConnsPerHost,omitempty"`
+	MaxConnsPerHost     int `json:"maxConnsPerHost,omitempty" yaml:"maxConnsPerHost,omitempty"`
+
+	// IdleConnTimeoutSeconds is how long idle connections are kept open for, or 90 seconds if it's 0
+	IdleConnTimeoutSeconds int `json:"idleConnTimeoutSeconds,omitempty" yaml:"idleConnTimeoutSeconds,omitempty"`
 }
 
 // HTTPCapability gives Runnables the ability to make HTTP requests
 type HTTPCapability interface {
 	Do(auth AuthCapability, method, urlString string, body []byte, headers http.Header) (*http.Response, error)
+	// DoWithContext performs a request that is cancelled along with ctx, including while it's waiting to be retried
+	DoWithContext(ctx context.Context, auth AuthCapability, method, urlString string, body []byte, headers http.Header) (*http.Response, error)
 }
 
 type httpClient struct {
-	config HTTPConfig
+	config   HTTPConfig
+	client   *http.Client
+	breakers *circuitBreakers
+
+	// clientErr is returned from every request if the client's config is invalid
+	clientErr error
 }
 
-// DefaultHTTPClient creates an HTTP client with no restrictions
+// DefaultHTTPClient creates an HTTP client that follows the config's rules
 func DefaultHTTPClient(config HTTPConfig) HTTPCapability {
 	d := &httpClient{
 		config: config,
+		client: http.DefaultClient,
+	}
+
+	if config.Client != nil {
+		d.client, d.clientErr = newHTTPClient(*config.Client)
+	}
+
+	if config.CircuitBreaker != nil {
+		d.breakers = newCircuitBreakers(*config.CircuitBreaker)
 	}
 
 	return d
@@ -35,10 +92,19 @@ func DefaultHTTPClient(config HTTPConfig) HTTPCapability {
 
 // Do performs the provided request
 func (h *httpClient) Do(auth AuthCapability, method, urlString string, body []byte, headers http.Header) (*http.Response, error) {
+	return h.DoWithContext(context.Background(), auth, method, urlString, body, headers)
+}
+
+// DoWithContext performs the provided request, cancelling it along with ctx
+func (h *httpClient) DoWithContext(ctx context.Context, auth AuthCapability, method, urlString string, body []byte, headers http.Header) (*http.Response, error) {
 	if !h.config.Enabled {
 		return nil, ErrCapabilityNotEnabled
 	}
 
+	if h.clientErr != nil {
+		return nil, h.clientErr
+	}
+
 	urlObj, err := url.Parse(urlString)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to url.Parse")
@@ -58,7 +124,134 @@ func (h *httpClient) Do(auth AuthCapability, method, urlString string, body []by
 		headers.Add("Authorization", fmt.Sprintf("%s %s", authHeader.HeaderType, authHeader.Value))
 	}
 
-	req.Header = headers
+	return h.send(ctx, method, urlObj, body, headers)
+}
+
+// send sends a request, retrying it if it fails and the Retry config allows, unless the host's circuit breaker is open
+func (h *httpClient) send(ctx context.Context, method string, urlObj *url.URL, body []byte, headers http.Header) (*http.Response, error) {
+	retry := HTTPRetryConfig{}
+	if h.config.Retry != nil {
+		retry = *h.config.Retry
+	}
+
+	var resp *http.Response
+	var err error
+
+	for attempt := 0; attempt <= retry.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if !retry.shouldRetry(method, resp, err) {
+				break
+			}
+
+			if err := sleepContext(ctx, retry.delay(attempt)); err != nil {
+				if resp != nil {
+					resp.Body.Close()
+				}
+
+				return nil, errors.Wrap(err, "cancelled while waiting to retry")
+			}
+		}
+
+		if h.breakers != nil {
+			if openErr := h.breakers.allow(urlObj.Host); openErr != nil {
+				if attempt == 0 {
+					return nil, openErr
+				}
+
+				// the circuit opened while retrying, so the last failure is returned
+				break
+			}
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		// the request is recreated for each attempt, since sending it consumes its body
+		req, reqErr := http.NewRequestWithContext(ctx, method, urlObj.String(), bytes.NewBuffer(body))
+		if reqErr != nil {
+			return nil, errors.Wrap(reqErr, "failed to NewRequestWithContext")
+		}
+
+		req.Header = headers
+
+		resp, err = h.client.Do(req)
+
+		// requests cancelled by the caller don't say anything about the host, but ones that time out do
+		if h.breakers != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				h.breakers.abandon(urlObj.Host)
+			} else {
+				h.breakers.record(urlObj.Host, err != nil || resp.StatusCode > 499)
+			}
+		}
+	}
+
+	return resp, err
+}
+
+// newHTTPClient creates a client with its own transport, which keeps its own pool of connections
+func newHTTPClient(config HTTPClientConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.Proxy = nil
+
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to url.Parse proxy URL")
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	} else if config.UseEnvironmentProxy {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.TLS != nil {
+		tlsConfig = config.TLS.Clone()
+	}
+
+	if config.CAFile != "" {
+		caPEM, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to ReadFile CA file")
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("CA file %s contains no certificates", config.CAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.ClientCertFile != "" || config.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to LoadX509KeyPair")
+		}
+
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+
+	transport.TLSClientConfig = tlsConfig
+
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+
+	if config.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+
+	if config.IdleConnTimeoutSeconds > 0 {
+		transport.IdleConnTimeout = time.Duration(config.IdleConnTimeoutSeconds) * time.Second
+	}
 
-	return http.DefaultClient.Do(req)
+	return &http.Client{Transport: transport}, nil
 }
@@ -0,0 +1,216 @@
+package rcap
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrHTTPCircuitOpen is returned when a request isn't sent because the host's circuit breaker is open
+var ErrHTTPCircuitOpen = errors.New("circuit breaker is open for this host")
+
+const (
+	httpDefaultRetryDelay      = 100 * time.Millisecond
+	httpDefaultMaxRetryDelay   = 5 * time.Second
+	httpDefaultFailureLimit    = 5
+	httpDefaultCircuitOpenTime = 30 * time.Second
+)
+
+// HTTPRetryConfig is configuration for retrying requests that fail
+type HTTPRetryConfig struct {
+	// MaxRetries is the number of times a request is retried if it can't be sent or the server responds with one of
+	// the RetryStatuses (502, 503, 504 and 429 if empty)
+	MaxRetries    int   `json:"maxRetries" yaml:"maxRetries"`
+	RetryStatuses []int `json:"retryStatuses,omitempty" yaml:"retryStatuses,omitempty"`
+
+	// Methods are the methods of the requests that are retried, or GET, HEAD, OPTIONS, PUT and DELETE if empty,
+	// since retrying other requests could repeat their side effects
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+
+	// DelayMillis is how long to wait before the first retry (or 100ms if 0), which doubles before each
+	// retry after that up to MaxDelayMillis (or 5s if 0)
+	DelayMillis    int `json:"delayMillis,omitempty" yaml:"delayMillis,omitempty"`
+	MaxDelayMillis int `json:"maxDelayMillis,omitempty" yaml:"maxDelayMillis,omitempty"`
+}
+
+// HTTPCircuitBreakerConfig is configuration for the circuit breakers that stop requests from being sent to failing hosts
+type HTTPCircuitBreakerConfig struct {
+	// FailureThreshold is the number of requests to a host in a row that can't be sent or that receive a 5xx
+	// response before its circuit is opened, or 5 if it's 0
+	FailureThreshold int `json:"failureThreshold,omitempty" yaml:"failureThreshold,omitempty"`
+
+	// OpenSeconds is how long requests to a host are refused once its circuit is opened, or 30 seconds if it's 0.
+	// After that, one request is sent to test the host, which closes the circuit if it succeeds and opens it again if not
+	OpenSeconds int `json:"openSeconds,omitempty" yaml:"openSeconds,omitempty"`
+}
+
+// shouldRetry returns true if a request that was sent with method and failed with err or received resp should be retried
+func (r HTTPRetryConfig) shouldRetry(method string, resp *http.Response, err error) bool {
+	methods := r.Methods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete}
+	}
+
+	allowed := false
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			allowed = true
+			break
+		}
+	}
+
+	if !allowed {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	statuses := r.RetryStatuses
+	if len(statuses) == 0 {
+		statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout, http.StatusTooManyRequests}
+	}
+
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// delay returns how long to wait before a retry (where 1 is the first retry)
+func (r HTTPRetryConfig) delay(retry int) time.Duration {
+	delay := time.Duration(r.DelayMillis) * time.Millisecond
+	if delay <= 0 {
+		delay = httpDefaultRetryDelay
+	}
+
+	maxDelay := time.Duration(r.MaxDelayMillis) * time.Millisecond
+	if maxDelay <= 0 {
+		maxDelay = httpDefaultMaxRetryDelay
+	}
+
+	for i := 1; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	return delay
+}
+
+// circuitBreakers tracks the failures of the requests to each host
+type circuitBreakers struct {
+	config HTTPCircuitBreakerConfig
+	hosts  map[string]*circuitState
+	lock   sync.Mutex
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+type circuitState struct {
+	failures  int
+	openUntil time.Time
+	testing   bool
+}
+
+func newCircuitBreakers(config HTTPCircuitBreakerConfig) *circuitBreakers {
+	c := &circuitBreakers{
+		config: config,
+		hosts:  map[string]*circuitState{},
+		now:    time.Now,
+	}
+
+	return c
+}
+
+// allow returns ErrHTTPCircuitOpen if a request to host shouldn't be sent
+func (c *circuitBreakers) allow(host string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	state, exists := c.hosts[host]
+	if !exists || state.openUntil.IsZero() {
+		return nil
+	}
+
+	// only one request is sent to test the host once the circuit has been open for long enough
+	if c.now().Before(state.openUntil) || state.testing {
+		return errors.Wrapf(ErrHTTPCircuitOpen, "host %s", host)
+	}
+
+	state.testing = true
+
+	return nil
+}
+
+// record records the outcome of a request to host, opening its circuit if it has failed too many times
+func (c *circuitBreakers) record(host string, failed bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	state, exists := c.hosts[host]
+	if !exists {
+		if !failed {
+			return
+		}
+
+		state = &circuitState{}
+		c.hosts[host] = state
+	}
+
+	if !failed {
+		delete(c.hosts, host)
+		return
+	}
+
+	state.failures++
+
+	threshold := c.config.FailureThreshold
+	if threshold <= 0 {
+		threshold = httpDefaultFailureLimit
+	}
+
+	if state.testing || state.failures >= threshold {
+		openFor := time.Duration(c.config.OpenSeconds) * time.Second
+		if openFor <= 0 {
+			openFor = httpDefaultCircuitOpenTime
+		}
+
+		state.openUntil = c.now().Add(openFor)
+		state.testing = false
+	}
+}
+
+// abandon records that a request to host was cancelled, so that another can be sent to test it if it was the test request
+func (c *circuitBreakers) abandon(host string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if state, exists := c.hosts[host]; exists {
+		state.testing = false
+	}
+}
+
+// sleepContext waits for d, returning early with ctx's error if it's done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,300 @@
+package rcap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestHTTPClientCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	t.Run("unknown CA rejected", func(t *testing.T) {
+		client := DefaultHTTPClient(HTTPConfig{Enabled: true, Rules: defaultHTTPRules()})
+
+		if _, err := client.Do(DefaultAuthProvider(AuthConfig{}), http.MethodGet, server.URL, nil, http.Header{}); err == nil {
+			t.Error("expected error for server with unknown CA, got none")
+		}
+	})
+
+	t.Run("CA bundle trusted", func(t *testing.T) {
+		client := DefaultHTTPClient(HTTPConfig{Enabled: true, Rules: defaultHTTPRules(), Client: &HTTPClientConfig{CAFile: caFile}})
+
+		resp, err := client.Do(DefaultAuthProvider(AuthConfig{}), http.MethodGet, server.URL, nil, http.Header{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("expected status 204, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("invalid CA file", func(t *testing.T) {
+		notPEM := filepath.Join(t.TempDir(), "ca.pem")
+		os.WriteFile(notPEM, []byte("not a certificate"), 0600)
+
+		client := DefaultHTTPClient(HTTPConfig{Enabled: true, Rules: defaultHTTPRules(), Client: &HTTPClientConfig{CAFile: notPEM}})
+
+		if _, err := client.Do(DefaultAuthProvider(AuthConfig{}), http.MethodGet, server.URL, nil, http.Header{}); err == nil {
+			t.Error("expected error for invalid CA file, got none")
+		}
+	})
+}
+
+func TestHTTPClientCertificate(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "reactr-test"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := HTTPConfig{
+		Enabled: true,
+		Rules:   defaultHTTPRules(),
+		Client: &HTTPClientConfig{
+			CAFile:         writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw),
+			ClientCertFile: writePEM(t, "client.pem", "CERTIFICATE", certDER),
+			ClientKeyFile:  writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER),
+		},
+	}
+
+	resp, err := DefaultHTTPClient(config).Do(DefaultAuthProvider(AuthConfig{}), http.MethodGet, server.URL, nil, http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	body := make([]byte, 64)
+	n, _ := resp.Body.Read(body)
+
+	if string(body[:n]) != "reactr-test" {
+		t.Errorf("expected server to receive client certificate reactr-test, got %q", string(body[:n]))
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	proxied := ""
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// requests sent through a proxy use the absolute URL
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	client := DefaultHTTPClient(HTTPConfig{Enabled: true, Rules: defaultHTTPRules(), Client: &HTTPClientConfig{ProxyURL: proxy.URL}})
+
+	resp, err := client.Do(DefaultAuthProvider(AuthConfig{}), http.MethodGet, "http://example.com/hello", nil, http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if proxied != "http://example.com/hello" {
+		t.Errorf("expected request to be proxied, got %q", proxied)
+	}
+}
+
+func TestHTTPClientRetry(t *testing.T) {
+	attempts := int32(0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first two attempts fail, and the body should be sent with every attempt
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		io.Copy(w, r.Body)
+	}))
+	defer server.Close()
+
+	client := DefaultHTTPClient(HTTPConfig{
+		Enabled: true,
+		Rules:   defaultHTTPRules(),
+		Retry:   &HTTPRetryConfig{MaxRetries: 2, DelayMillis: 1},
+	})
+
+	auth := DefaultAuthProvider(AuthConfig{})
+
+	resp, err := client.Do(auth, http.MethodPut, server.URL, []byte("hello"), http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || string(body) != "hello" || atomic.LoadInt32(&attempts) != 3 {
+		t.Errorf("expected the third attempt to succeed, got %d %q after %d attempts", resp.StatusCode, body, attempts)
+	}
+
+	// POSTs aren't retried by default, since that could repeat their side effects
+	atomic.StoreInt32(&attempts, 0)
+
+	resp, err = client.Do(auth, http.MethodPost, server.URL, []byte("hello"), http.Header{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(&attempts) != 1 {
+		t.Errorf("expected one failed attempt, got %d after %d attempts", resp.StatusCode, attempts)
+	}
+}
+
+func TestHTTPClientContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := DefaultHTTPClient(HTTPConfig{
+		Enabled: true,
+		Rules:   defaultHTTPRules(),
+		Retry:   &HTTPRetryConfig{MaxRetries: 3, DelayMillis: 10000},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+
+	// the request fails and would be retried after 10 seconds, but the context is done before then
+	if _, err := client.DoWithContext(ctx, DefaultAuthProvider(AuthConfig{}), http.MethodGet, server.URL, nil, http.Header{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected context.DeadlineExceeded, got", err)
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Error("expected the request to stop when its context was done, but it took", elapsed)
+	}
+}
+
+func TestHTTPClientCircuitBreaker(t *testing.T) {
+	failing := int32(1)
+	requests := int32(0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	client := DefaultHTTPClient(HTTPConfig{
+		Enabled:        true,
+		Rules:          defaultHTTPRules(),
+		CircuitBreaker: &HTTPCircuitBreakerConfig{FailureThreshold: 3, OpenSeconds: 10},
+	}).(*httpClient)
+
+	now := time.Now()
+	client.breakers.now = func() time.Time { return now }
+
+	get := func() (*http.Response, error) {
+		resp, err := client.Do(DefaultAuthProvider(AuthConfig{}), http.MethodGet, server.URL, nil, http.Header{})
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		return resp, err
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the circuit is open after three failures, so requests aren't sent
+	if _, err := get(); !errors.Is(err, ErrHTTPCircuitOpen) {
+		t.Error("expected ErrHTTPCircuitOpen, got", err)
+	}
+
+	if atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("expected 3 requests to be sent, got %d", requests)
+	}
+
+	// a test request that fails opens the circuit again
+	now = now.Add(11 * time.Second)
+
+	if _, err := get(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := get(); !errors.Is(err, ErrHTTPCircuitOpen) {
+		t.Error("expected ErrHTTPCircuitOpen after the test request failed, got", err)
+	}
+
+	// and one that succeeds closes it
+	atomic.StoreInt32(&failing, 0)
+	now = now.Add(11 * time.Second)
+
+	for i := 0; i < 2; i++ {
+		if resp, err := get(); err != nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("expected the circuit to be closed, got %v", err)
+		}
+	}
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	filename := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return filename
+}
@@ -0,0 +1,590 @@
+package rcap
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrJWTKeysNotSet       = errors.New("no JWKS URL or keys are set to verify JWTs with")
+	ErrJWTInvalid          = errors.New("JWT is malformed or its signature is invalid")
+	ErrJWTExpired          = errors.New("JWT has expired or is not valid yet")
+	ErrJWTClaimsDisallowed = errors.New("JWT's issuer or audience is disallowed")
+)
+
+// jwksMinRefresh is the shortest time between fetches of the JWKS, so that tokens with unknown key IDs can't be used to flood the server
+const jwksMinRefresh = 30 * time.Second
+
+// jwksFetchTimeout limits how long a fetch of the JWKS can take, as it isn't cancelled along with the call that started it
+const jwksFetchTimeout = 10 * time.Second
+
+// JWTConfig is configuration for the JWT capability, which verifies the JWTs that Runnables receive, such as bearer tokens
+type JWTConfig struct {
+	Enabled bool     `json:"enabled" yaml:"enabled"`
+	Rules   JWTRules `json:"rules" yaml:"rules"`
+
+	// JWKSURL is the URL of the JSON Web Key Set that tokens are verified with, such as https://issuer.example.com/.well-known/jwks.json
+	JWKSURL string `json:"jwksURL,omitempty" yaml:"jwksURL,omitempty"`
+
+	// JWKSRefreshSeconds is how often the JWKS is fetched again, or every hour if 0. It's also fetched again
+	// (at most every 30 seconds) when a token is signed by a key that isn't in the set, so that rotated keys are picked up
+	JWKSRefreshSeconds int `json:"jwksRefreshSeconds,omitempty" yaml:"jwksRefreshSeconds,omitempty"`
+
+	// Keys are public keys (*rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey) that tokens are verified with, by key ID.
+	// The key with an empty ID verifies tokens without a key ID. They can only be set by the host
+	Keys map[string]crypto.PublicKey `json:"-" yaml:"-"`
+
+	// HTTPClient fetches the JWKS, or http.DefaultClient if it's nil
+	HTTPClient *http.Client `json:"-" yaml:"-"`
+}
+
+// JWTRules is a set of rules that governs which JWTs are accepted
+type JWTRules struct {
+	// Issuers are the accepted values of the iss claim. If none are listed, any issuer is accepted.
+	Issuers []string `json:"issuers" yaml:"issuers"`
+
+	// Audiences are the accepted values of the aud claim, of which a token must have at least one. If none are listed, any audience is accepted.
+	Audiences []string `json:"audiences" yaml:"audiences"`
+
+	// Algorithms are the accepted signing algorithms. If none are listed, each of the supported algorithms is accepted:
+	// RS256, RS384, RS512, PS256, PS384, PS512, ES256, ES384, ES512 and EdDSA
+	Algorithms []string `json:"algorithms" yaml:"algorithms"`
+
+	// LeewaySeconds allows for clock skew when checking the exp, nbf and iat claims
+	LeewaySeconds int `json:"leewaySeconds" yaml:"leewaySeconds"`
+}
+
+// JWTCapability gives Runnables the ability to verify JWTs
+type JWTCapability interface {
+	// Verify verifies a token's signature and claims, and returns its claims
+	Verify(ctx context.Context, token string) (map[string]interface{}, error)
+}
+
+type defaultJWT struct {
+	config JWTConfig
+	client *http.Client
+
+	// jwksAttempted is when the JWKS was last fetched, whether or not it succeeded, and jwksErr is set if it failed
+	jwks          map[string]crypto.PublicKey
+	jwksFetched   time.Time
+	jwksAttempted time.Time
+	jwksErr       error
+	fetching      singleflight.Group
+	lock          sync.Mutex
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// DefaultJWT creates a JWT capability that verifies tokens with the config's JWKS and keys
+func DefaultJWT(config JWTConfig) JWTCapability {
+	d := &defaultJWT{
+		config: config,
+		client: config.HTTPClient,
+		now:    time.Now,
+	}
+
+	if d.client == nil {
+		d.client = http.DefaultClient
+	}
+
+	return d
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify verifies a token
+func (d *defaultJWT) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	if !d.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	if d.config.JWKSURL == "" && len(d.config.Keys) == 0 {
+		return nil, ErrJWTKeysNotSet
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.Wrap(ErrJWTInvalid, "token does not have 3 parts")
+	}
+
+	header := jwtHeader{}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, errors.Wrap(err, "failed to decode header")
+	}
+
+	if !d.config.Rules.algorithmIsAllowed(header.Alg) {
+		return nil, errors.Wrapf(ErrJWTInvalid, "algorithm %s is not accepted", header.Alg)
+	}
+
+	key, err := d.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(ErrJWTInvalid, "signature is not base64url encoded")
+	}
+
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(err, "failed to decode claims")
+	}
+
+	if err := d.config.Rules.claimsAreAllowed(claims, d.now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// key returns the key with the given ID, fetching the JWKS if it hasn't been fetched recently enough
+func (d *defaultJWT) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, exists := d.config.Keys[kid]; exists {
+		return key, nil
+	}
+
+	if d.config.JWKSURL == "" {
+		return nil, errors.Wrapf(ErrJWTInvalid, "no key with ID %q", kid)
+	}
+
+	refresh := time.Hour
+	if d.config.JWKSRefreshSeconds > 0 {
+		refresh = time.Duration(d.config.JWKSRefreshSeconds) * time.Second
+	}
+
+	d.lock.Lock()
+	_, exists := d.jwks[kid]
+	shouldFetch := time.Since(d.jwksFetched) >= refresh || !exists
+	d.lock.Unlock()
+
+	if shouldFetch {
+		if err := d.refreshJWKS(ctx, refresh); err != nil && ctx.Err() != nil {
+			return nil, errors.Wrap(err, "failed to refreshJWKS")
+		}
+	}
+
+	d.lock.Lock()
+	jwks, fetchErr := d.jwks, d.jwksErr
+	d.lock.Unlock()
+
+	// keep using the keys that were fetched before, if there are any
+	if jwks == nil && fetchErr != nil {
+		return nil, errors.Wrap(fetchErr, "failed to fetchJWKS")
+	}
+
+	key, exists := jwks[kid]
+	if !exists {
+		return nil, errors.Wrapf(ErrJWTInvalid, "no key with ID %q", kid)
+	}
+
+	return key, nil
+}
+
+// refreshJWKS fetches the JWKS unless it was attempted too recently, without holding the lock while the request is made.
+// Callers that need the JWKS at the same time share one fetch, and each can stop waiting for it when its ctx is done
+func (d *defaultJWT) refreshJWKS(ctx context.Context, refresh time.Duration) error {
+	// unknown key IDs can't cause fetches more often than jwksMinRefresh, or than refresh if it's shorter
+	minInterval := jwksMinRefresh
+	if refresh < minInterval {
+		minInterval = refresh
+	}
+
+	resChan := d.fetching.DoChan("jwks", func() (interface{}, error) {
+		d.lock.Lock()
+
+		if time.Since(d.jwksAttempted) < minInterval {
+			err := d.jwksErr
+			d.lock.Unlock()
+
+			return nil, err
+		}
+
+		// the attempt is recorded before the fetch so that a failing JWKS server isn't retried on every request
+		d.jwksAttempted = time.Now()
+		d.lock.Unlock()
+
+		// other callers may be waiting for the fetch, so it carries on if the ctx of the call that started it is cancelled
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksFetchTimeout)
+		defer cancel()
+
+		jwks, err := d.fetchJWKS(fetchCtx)
+
+		d.lock.Lock()
+		defer d.lock.Unlock()
+
+		d.jwksErr = err
+
+		if err == nil {
+			d.jwks = jwks
+			d.jwksFetched = time.Now()
+		}
+
+		return nil, err
+	})
+
+	select {
+	case res := <-resChan:
+		return res.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (d *defaultJWT) fetchJWKS(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.config.JWKSURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to NewRequest")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Do request")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS server responded with status %d", resp.StatusCode)
+	}
+
+	jwks := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, errors.Wrap(err, "failed to Decode JWKS")
+	}
+
+	keys := map[string]crypto.PublicKey{}
+
+	for _, jwk := range jwks.Keys {
+		// keys used for encryption can't verify signatures
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// keys of unsupported types are skipped so that the rest of the set can still be used
+			continue
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (j jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeJWKInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", j.Crv)
+		}
+
+		x, err := decodeJWKInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeJWKInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", j.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", j.Kty)
+}
+
+func decodeJWKInt(val string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(val)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.Wrap(ErrJWTInvalid, "part is not base64url encoded")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(decoded))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(v); err != nil {
+		return errors.Wrap(ErrJWTInvalid, "part is not a JSON object")
+	}
+
+	return nil
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var h hash.Hash
+	var hashFunc crypto.Hash
+
+	switch alg[len(alg)-3:] {
+	case "256":
+		h, hashFunc = sha256.New(), crypto.SHA256
+	case "384":
+		h, hashFunc = sha512.New384(), crypto.SHA384
+	case "512":
+		h, hashFunc = sha512.New(), crypto.SHA512
+	}
+
+	if h != nil {
+		h.Write(signed)
+	}
+
+	valid := false
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		rsaKey, isRSA := key.(*rsa.PublicKey)
+		if !isRSA {
+			return errors.Wrapf(ErrJWTInvalid, "key can't verify %s", alg)
+		}
+
+		if strings.HasPrefix(alg, "RS") {
+			valid = rsa.VerifyPKCS1v15(rsaKey, hashFunc, h.Sum(nil), signature) == nil
+		} else {
+			valid = rsa.VerifyPSS(rsaKey, hashFunc, h.Sum(nil), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case strings.HasPrefix(alg, "ES"):
+		ecKey, isEC := key.(*ecdsa.PublicKey)
+		if !isEC {
+			return errors.Wrapf(ErrJWTInvalid, "key can't verify %s", alg)
+		}
+
+		// the signature is r and s concatenated, each the size of the curve
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.Wrap(ErrJWTInvalid, "signature is the wrong size")
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		valid = ecdsa.Verify(ecKey, h.Sum(nil), r, s)
+	case alg == "EdDSA":
+		edKey, isEd := key.(ed25519.PublicKey)
+		if !isEd {
+			return errors.Wrapf(ErrJWTInvalid, "key can't verify %s", alg)
+		}
+
+		valid = ed25519.Verify(edKey, signed, signature)
+	}
+
+	if !valid {
+		return errors.Wrap(ErrJWTInvalid, "signature is invalid")
+	}
+
+	return nil
+}
+
+var supportedJWTAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// algorithmIsAllowed returns true if the algorithm is supported and accepted
+func (j JWTRules) algorithmIsAllowed(alg string) bool {
+	supported := false
+	for _, s := range supportedJWTAlgorithms {
+		if alg == s {
+			supported = true
+		}
+	}
+
+	if !supported {
+		return false
+	}
+
+	if len(j.Algorithms) == 0 {
+		return true
+	}
+
+	for _, allowed := range j.Algorithms {
+		if alg == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// claimsAreAllowed returns a non-nil error if the claims are expired or their issuer or audience isn't accepted
+func (j JWTRules) claimsAreAllowed(claims map[string]interface{}, now time.Time) error {
+	leeway := time.Duration(j.LeewaySeconds) * time.Second
+
+	exp, exists, err := numericClaim(claims, "exp")
+	if err != nil {
+		return err
+	} else if exists && !now.Before(exp.Add(leeway)) {
+		return errors.Wrap(ErrJWTExpired, "token has expired")
+	}
+
+	nbf, exists, err := numericClaim(claims, "nbf")
+	if err != nil {
+		return err
+	} else if exists && now.Add(leeway).Before(nbf) {
+		return errors.Wrap(ErrJWTExpired, "token is not valid yet")
+	}
+
+	iat, exists, err := numericClaim(claims, "iat")
+	if err != nil {
+		return err
+	} else if exists && now.Add(leeway).Before(iat) {
+		return errors.Wrap(ErrJWTExpired, "token was issued in the future")
+	}
+
+	if len(j.Issuers) > 0 {
+		iss, _ := claims["iss"].(string)
+
+		if !stringInList(iss, j.Issuers) {
+			return errors.Wrapf(ErrJWTClaimsDisallowed, "issuer %q", iss)
+		}
+	}
+
+	if len(j.Audiences) > 0 {
+		audiences := []string{}
+
+		switch aud := claims["aud"].(type) {
+		case string:
+			audiences = append(audiences, aud)
+		case []interface{}:
+			for _, a := range aud {
+				if s, isString := a.(string); isString {
+					audiences = append(audiences, s)
+				}
+			}
+		}
+
+		accepted := false
+		for _, aud := range audiences {
+			if stringInList(aud, j.Audiences) {
+				accepted = true
+			}
+		}
+
+		if !accepted {
+			return errors.Wrap(ErrJWTClaimsDisallowed, "audience")
+		}
+	}
+
+	return nil
+}
+
+// maxNumericDate is the largest NumericDate accepted in a claim, which is the last second of the year 9999
+const maxNumericDate = 253402300799
+
+// numericClaim returns a NumericDate claim, which is a number of seconds since the Unix epoch. It returns an error if the
+// claim is set to anything else, so that a token can't avoid being checked by giving its exp as a string, for example
+func numericClaim(claims map[string]interface{}, name string) (time.Time, bool, error) {
+	val, exists := claims[name]
+	if !exists {
+		return time.Time{}, false, nil
+	}
+
+	num, isNumber := val.(json.Number)
+	if !isNumber {
+		return time.Time{}, false, errors.Wrapf(ErrJWTInvalid, "%s claim is not a number", name)
+	}
+
+	seconds, err := num.Float64()
+	if err != nil {
+		return time.Time{}, false, errors.Wrapf(ErrJWTInvalid, "%s claim is not a valid number", name)
+	}
+
+	// converting a huge claim to nanoseconds would overflow and wrap around into the past, so dates beyond year 9999 are rejected
+	if math.IsNaN(seconds) || seconds < 0 || seconds > maxNumericDate {
+		return time.Time{}, false, errors.Wrapf(ErrJWTInvalid, "%s claim is out of range", name)
+	}
+
+	sec, frac := math.Modf(seconds)
+
+	return time.Unix(int64(sec), int64(frac*1e9)), true, nil
+}
+
+func stringInList(s string, list []string) bool {
+	for _, l := range list {
+		if s == l {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,227 @@
+package rcap
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	fetches := int32(0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+
+		jwks := map[string]interface{}{
+			"keys": []map[string]string{
+				{
+					"kty": "RSA",
+					"kid": "rsa-1",
+					"use": "sig",
+					"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+					"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				{
+					"kty": "EC",
+					"kid": "ec-1",
+					"crv": "P-256",
+					"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+					"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+				},
+			},
+		}
+
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer server.Close()
+
+	jwt := DefaultJWT(JWTConfig{
+		Enabled: true,
+		Rules: JWTRules{
+			Issuers:   []string{"https://issuer.example.com"},
+			Audiences: []string{"orders"},
+		},
+		JWKSURL: server.URL,
+		Keys:    map[string]crypto.PublicKey{"ed-1": edPub},
+	})
+
+	valid := map[string]interface{}{
+		"iss": "https://issuer.example.com",
+		"aud": []string{"billing", "orders"},
+		"sub": "user-42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		errIs   error
+		fetches int32
+	}{
+		{"RS256", signTestJWT(t, "RS256", "rsa-1", rsaKey, valid), nil, 1},
+		{"ES256", signTestJWT(t, "ES256", "ec-1", ecKey, valid), nil, 1},
+		{"EdDSA", signTestJWT(t, "EdDSA", "ed-1", edKey, valid), nil, 1},
+		{"expired", signTestJWT(t, "RS256", "rsa-1", rsaKey, withClaim(valid, "exp", time.Now().Add(-time.Minute).Unix())), ErrJWTExpired, 1},
+		{"string exp", signTestJWT(t, "RS256", "rsa-1", rsaKey, withClaim(valid, "exp", "9999999999")), ErrJWTInvalid, 1},
+		{"null nbf", signTestJWT(t, "RS256", "rsa-1", rsaKey, withClaim(valid, "nbf", nil)), ErrJWTInvalid, 1},
+		// an nbf this large would overflow into the past if it were converted to nanoseconds
+		{"huge nbf", signTestJWT(t, "RS256", "rsa-1", rsaKey, withClaim(valid, "nbf", 1e19)), ErrJWTInvalid, 1},
+		{"negative iat", signTestJWT(t, "RS256", "rsa-1", rsaKey, withClaim(valid, "iat", -1)), ErrJWTInvalid, 1},
+		{"wrong issuer", signTestJWT(t, "RS256", "rsa-1", rsaKey, withClaim(valid, "iss", "https://evil.example.com")), ErrJWTClaimsDisallowed, 1},
+		{"wrong audience", signTestJWT(t, "RS256", "rsa-1", rsaKey, withClaim(valid, "aud", "inventory")), ErrJWTClaimsDisallowed, 1},
+		{"wrong key", signTestJWT(t, "ES256", "ec-1", mustECKey(t), valid), ErrJWTInvalid, 1},
+		{"none", signTestJWT(t, "none", "", nil, valid), ErrJWTInvalid, 1},
+		{"malformed", "not.a.jwt", ErrJWTInvalid, 1},
+		// an unknown key ID doesn't cause another fetch so soon after the last one
+		{"unknown key", signTestJWT(t, "RS256", "rsa-2", rsaKey, valid), ErrJWTInvalid, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := jwt.Verify(context.Background(), tc.token)
+
+			if tc.errIs == nil {
+				if err != nil {
+					t.Fatal(errors.Wrap(err, "failed to Verify"))
+				}
+
+				if claims["sub"] != "user-42" {
+					t.Errorf("expected sub claim user-42, got %v", claims["sub"])
+				}
+			} else if !errors.Is(err, tc.errIs) {
+				t.Errorf("expected %v, got %v", tc.errIs, err)
+			}
+
+			if atomic.LoadInt32(&fetches) != tc.fetches {
+				t.Errorf("expected the JWKS to have been fetched %d times, got %d", tc.fetches, fetches)
+			}
+		})
+	}
+
+	t.Run("keys not set", func(t *testing.T) {
+		if _, err := DefaultJWT(JWTConfig{Enabled: true}).Verify(context.Background(), "a.b.c"); !errors.Is(err, ErrJWTKeysNotSet) {
+			t.Error("expected ErrJWTKeysNotSet, got", err)
+		}
+	})
+
+	t.Run("algorithm not accepted", func(t *testing.T) {
+		esOnly := DefaultJWT(JWTConfig{Enabled: true, Rules: JWTRules{Algorithms: []string{"ES256"}}, Keys: map[string]crypto.PublicKey{"ed-1": edPub}})
+
+		if _, err := esOnly.Verify(context.Background(), signTestJWT(t, "EdDSA", "ed-1", edKey, valid)); !errors.Is(err, ErrJWTInvalid) {
+			t.Error("expected ErrJWTInvalid, got", err)
+		}
+	})
+}
+
+func TestJWTKeySetUnavailable(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	fetches := int32(0)
+	release := make(chan bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+
+		<-release
+
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	jwt := DefaultJWT(JWTConfig{Enabled: true, JWKSURL: server.URL})
+	token := signTestJWT(t, "ES256", "ec-1", ecKey, map[string]interface{}{"sub": "user-42"})
+
+	// a call that gives up waiting for the JWKS doesn't hold up the others
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := jwt.Verify(ctx, token); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected context.DeadlineExceeded, got", err)
+	}
+
+	done := make(chan error)
+
+	go func() {
+		_, err := jwt.Verify(context.Background(), token)
+		done <- err
+	}()
+
+	release <- true
+
+	if err := <-done; err == nil || errors.Is(err, ErrJWTInvalid) {
+		t.Error("expected the failed fetch's error, got", err)
+	}
+
+	// the failed attempt counts towards the minimum time between fetches
+	if _, err := jwt.Verify(context.Background(), token); err == nil {
+		t.Error("expected error, did not get one")
+	}
+
+	if count := atomic.LoadInt32(&fetches); count != 1 {
+		t.Errorf("expected the JWKS to have been fetched once, got %d", count)
+	}
+}
+
+func withClaim(claims map[string]interface{}, name string, val interface{}) map[string]interface{} {
+	updated := map[string]interface{}{}
+	for k, v := range claims {
+		updated[k] = v
+	}
+
+	updated[name] = val
+
+	return updated
+}
+
+func mustECKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func signTestJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signed))
+	}
+
+	return strings.Join([]string{signed, base64.RawURLEncoding.EncodeToString(signature)}, ".")
+}
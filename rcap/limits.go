@@ -0,0 +1,116 @@
+package rcap
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLimitExceeded is returned when a call to a host function would exceed one of its limits
+var ErrLimitExceeded = errors.New("host function limit exceeded")
+
+// LimitsConfig is configuration for the limits capability, which limits how often host functions can be called and how
+// much data they can be given. Each limit is shared by all of the jobs that use the same Capabilities
+type LimitsConfig struct {
+	Enabled bool          `json:"enabled" yaml:"enabled"`
+	Limits  []HostFnLimit `json:"limits" yaml:"limits"`
+}
+
+// HostFnLimit limits a group of host functions, such as 50 calls to fetch_* per second, or 5MB of cache writes per minute
+type HostFnLimit struct {
+	// HostFns are the host functions that share the limit, which can be patterns such as fetch_*
+	HostFns []string `json:"hostFns" yaml:"hostFns"`
+
+	// MaxCalls is the most calls that can be made in each period, or unlimited if 0
+	MaxCalls int `json:"maxCalls,omitempty" yaml:"maxCalls,omitempty"`
+
+	// MaxBytes is the most data that can be passed in each period (such as the values written to the cache or
+	// the bodies of HTTP requests), or unlimited if 0
+	MaxBytes int64 `json:"maxBytes,omitempty" yaml:"maxBytes,omitempty"`
+
+	// PeriodSeconds is how long each period lasts, or 1 second if 0
+	PeriodSeconds int `json:"periodSeconds,omitempty" yaml:"periodSeconds,omitempty"`
+}
+
+// LimitsCapability enforces limits on calls to host functions
+type LimitsCapability interface {
+	// Use counts a call to the named host function that's passed size bytes of data against each of the limits
+	// that apply to it. If any of them would be exceeded, ErrLimitExceeded is returned and the call isn't counted
+	Use(hostFn string, size int) error
+}
+
+type limitWindow struct {
+	start time.Time
+	calls int
+	bytes int64
+}
+
+type defaultLimits struct {
+	config  LimitsConfig
+	windows []limitWindow
+	lock    sync.Mutex
+}
+
+// DefaultLimits creates a limits capability that enforces the config's limits
+func DefaultLimits(config LimitsConfig) LimitsCapability {
+	d := &defaultLimits{
+		config:  config,
+		windows: make([]limitWindow, len(config.Limits)),
+	}
+
+	return d
+}
+
+// Use counts a call against the limits
+func (d *defaultLimits) Use(hostFn string, size int) error {
+	if !d.config.Enabled || len(d.config.Limits) == 0 {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+	applied := []int{}
+
+	for i, limit := range d.config.Limits {
+		if !matchHostFn(limit.HostFns, hostFn) {
+			continue
+		}
+
+		window := &d.windows[i]
+
+		if now.Sub(window.start) >= limit.period() {
+			window.start = now
+			window.calls = 0
+			window.bytes = 0
+		}
+
+		if limit.MaxCalls > 0 && window.calls >= limit.MaxCalls {
+			return errors.Wrapf(ErrLimitExceeded, "%d calls to %s per %s", limit.MaxCalls, hostFn, limit.period())
+		}
+
+		if limit.MaxBytes > 0 && window.bytes+int64(size) > limit.MaxBytes {
+			return errors.Wrapf(ErrLimitExceeded, "%d bytes to %s per %s", limit.MaxBytes, hostFn, limit.period())
+		}
+
+		applied = append(applied, i)
+	}
+
+	// the call is only counted once it's known that it doesn't exceed any of the limits
+	for _, i := range applied {
+		d.windows[i].calls++
+		d.windows[i].bytes += int64(size)
+	}
+
+	return nil
+}
+
+func (h HostFnLimit) period() time.Duration {
+	if h.PeriodSeconds <= 0 {
+		return time.Second
+	}
+
+	return time.Duration(h.PeriodSeconds) * time.Second
+}
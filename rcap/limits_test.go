@@ -0,0 +1,62 @@
+package rcap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestLimits(t *testing.T) {
+	limits := DefaultLimits(LimitsConfig{
+		Enabled: true,
+		Limits: []HostFnLimit{
+			{HostFns: []string{"fetch_url", "http_request"}, MaxCalls: 2},
+			{HostFns: []string{"cache_*"}, MaxBytes: 100, PeriodSeconds: 60},
+		},
+	})
+
+	t.Run("calls", func(t *testing.T) {
+		if err := limits.Use("fetch_url", 10); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Use"))
+		}
+
+		if err := limits.Use("http_request", 10); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Use"))
+		}
+
+		if err := limits.Use("fetch_url", 10); !errors.Is(err, ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got", err)
+		}
+
+		// the period is reset once it's over
+		limits.(*defaultLimits).windows[0].start = time.Now().Add(-time.Second)
+
+		if err := limits.Use("fetch_url", 10); err != nil {
+			t.Error("expected limit to be reset, got", err)
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		if err := limits.Use("cache_set", 60); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Use"))
+		}
+
+		if err := limits.Use("cache_cas", 60); !errors.Is(err, ErrLimitExceeded) {
+			t.Error("expected ErrLimitExceeded, got", err)
+		}
+
+		// calls that are limited aren't counted, so the rest of the quota can still be used
+		if err := limits.Use("cache_cas", 40); err != nil {
+			t.Error("expected remaining quota to be usable, got", err)
+		}
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			if err := limits.Use("db_query", 1000); err != nil {
+				t.Fatal("expected db_query to be unlimited, got", err)
+			}
+		}
+	})
+}
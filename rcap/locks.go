@@ -0,0 +1,100 @@
+package rcap
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrLockHeld       = errors.New("lock is held by another holder")
+	ErrLockNotHeld    = errors.New("lock is not held, it may have expired")
+	ErrLockTTLInvalid = errors.New("lock TTL must be positive")
+)
+
+// LockKeyPrefix is prepended to the name of each lock to form its cache key
+const LockKeyPrefix = "reactr.lock:"
+
+// LocksConfig is configuration for the locks capability, which stores locks in the cache capability so that they're
+// shared by everything that shares the cache (such as every node connected to the same Redis server)
+type LocksConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+}
+
+// LocksCapability gives Runnables the ability to serialize critical sections with named locks
+type LocksCapability interface {
+	// Acquire acquires the named lock for ttl seconds, after which it's released if it hasn't been already,
+	// and returns the token needed to release it. ErrLockHeld is returned if it's held by another holder
+	Acquire(name string, ttl int) (string, error)
+	// Release releases the lock if token is still its holder's token
+	Release(name, token string) error
+}
+
+// releasedLock is the value of a lock that has been released, which lets Release be a compare-and-swap
+var releasedLock = []byte{}
+
+type defaultLocks struct {
+	config LocksConfig
+	cache  CacheCapability
+}
+
+// DefaultLocks creates a locks capability that stores locks in cache
+func DefaultLocks(config LocksConfig, cache CacheCapability) LocksCapability {
+	d := &defaultLocks{
+		config: config,
+		cache:  cache,
+	}
+
+	return d
+}
+
+// Acquire acquires a lock
+func (d *defaultLocks) Acquire(name string, ttl int) (string, error) {
+	if !d.config.Enabled {
+		return "", ErrCapabilityNotEnabled
+	}
+
+	if ttl <= 0 {
+		return "", ErrLockTTLInvalid
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", errors.Wrap(err, "failed to Read")
+	}
+
+	token := hex.EncodeToString(tokenBytes)
+
+	// the lock is either missing, or has been released and not yet expired from the cache
+	for _, old := range [][]byte{nil, releasedLock} {
+		swapped, err := d.cache.CompareAndSwap(LockKeyPrefix+name, old, []byte(token), ttl)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to CompareAndSwap")
+		}
+
+		if swapped {
+			return token, nil
+		}
+	}
+
+	return "", ErrLockHeld
+}
+
+// Release releases a lock
+func (d *defaultLocks) Release(name, token string) error {
+	if !d.config.Enabled {
+		return ErrCapabilityNotEnabled
+	}
+
+	swapped, err := d.cache.CompareAndSwap(LockKeyPrefix+name, []byte(token), releasedLock, 1)
+	if err != nil {
+		return errors.Wrap(err, "failed to CompareAndSwap")
+	}
+
+	if !swapped {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package rcap
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLocks(t *testing.T) {
+	cache := SetupCache(CacheConfig{Enabled: true, Rules: defaultCacheRules()})
+
+	locks := DefaultLocks(LocksConfig{Enabled: true}, cache)
+
+	token, err := locks.Acquire("orders", 10)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Acquire"))
+	}
+
+	if _, err := locks.Acquire("orders", 10); !errors.Is(err, ErrLockHeld) {
+		t.Error("expected ErrLockHeld, got", err)
+	}
+
+	if err := locks.Release("orders", "not-the-token"); !errors.Is(err, ErrLockNotHeld) {
+		t.Error("expected ErrLockNotHeld, got", err)
+	}
+
+	if err := locks.Release("orders", token); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Release"))
+	}
+
+	// a released lock can be acquired again straight away
+	if _, err := locks.Acquire("orders", 10); err != nil {
+		t.Error(errors.Wrap(err, "failed to Acquire released lock"))
+	}
+
+	if _, err := locks.Acquire("payments", 0); !errors.Is(err, ErrLockTTLInvalid) {
+		t.Error("expected ErrLockTTLInvalid, got", err)
+	}
+}
@@ -0,0 +1,127 @@
+package rcap
+
+import (
+	"math"
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrMetricsSinkNotSet    = errors.New("metrics sink not set")
+	ErrMetricNameDisallowed = errors.New("recording this metric is disallowed")
+	ErrMetricValueInvalid   = errors.New("metric value is invalid")
+)
+
+// MetricsSink records metrics in the host's metrics registry, such as the one provided by the rprom package
+type MetricsSink interface {
+	CounterAdd(name string, value float64, labels map[string]string) error
+	GaugeSet(name string, value float64, labels map[string]string) error
+	HistogramObserve(name string, value float64, labels map[string]string) error
+}
+
+// MetricsConfig is configuration for the metrics capability, which lets Runnables record their own metrics
+type MetricsConfig struct {
+	Enabled bool         `json:"enabled" yaml:"enabled"`
+	Rules   MetricsRules `json:"rules" yaml:"rules"`
+
+	// Sink is where metrics are recorded, which can only be set by the host
+	Sink MetricsSink `json:"-" yaml:"-"`
+}
+
+// MetricsRules is a set of rules that governs use of the metrics capability
+type MetricsRules struct {
+	// AllowedNames are the names of the metrics that can be recorded, which can be patterns such as orders_*
+	// If none are listed, any metric can be recorded.
+	AllowedNames []string `json:"allowedNames" yaml:"allowedNames"`
+}
+
+// MetricsCapability gives Runnables the ability to record metrics
+type MetricsCapability interface {
+	// CounterAdd adds a value, which can't be negative, to a counter
+	CounterAdd(name string, value float64, labels map[string]string) error
+	// GaugeSet sets a gauge to a value
+	GaugeSet(name string, value float64, labels map[string]string) error
+	// HistogramObserve adds an observation to a histogram
+	HistogramObserve(name string, value float64, labels map[string]string) error
+}
+
+type defaultMetrics struct {
+	config MetricsConfig
+}
+
+// DefaultMetrics creates a metrics capability that records metrics in the config's sink
+func DefaultMetrics(config MetricsConfig) MetricsCapability {
+	d := &defaultMetrics{
+		config: config,
+	}
+
+	return d
+}
+
+// CounterAdd adds a value to a counter
+func (d *defaultMetrics) CounterAdd(name string, value float64, labels map[string]string) error {
+	if err := d.checkMetric(name, value); err != nil {
+		return err
+	}
+
+	if value < 0 {
+		return errors.Wrap(ErrMetricValueInvalid, "counters can't be decreased")
+	}
+
+	return d.config.Sink.CounterAdd(name, value, labels)
+}
+
+// GaugeSet sets a gauge
+func (d *defaultMetrics) GaugeSet(name string, value float64, labels map[string]string) error {
+	if err := d.checkMetric(name, value); err != nil {
+		return err
+	}
+
+	return d.config.Sink.GaugeSet(name, value, labels)
+}
+
+// HistogramObserve observes a value in a histogram
+func (d *defaultMetrics) HistogramObserve(name string, value float64, labels map[string]string) error {
+	if err := d.checkMetric(name, value); err != nil {
+		return err
+	}
+
+	return d.config.Sink.HistogramObserve(name, value, labels)
+}
+
+// checkMetric returns a non-nil error if the metric can't be recorded
+func (d *defaultMetrics) checkMetric(name string, value float64) error {
+	if !d.config.Enabled {
+		return ErrCapabilityNotEnabled
+	}
+
+	if d.config.Sink == nil {
+		return ErrMetricsSinkNotSet
+	}
+
+	if err := d.config.Rules.nameIsAllowed(name); err != nil {
+		return err
+	}
+
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return ErrMetricValueInvalid
+	}
+
+	return nil
+}
+
+// nameIsAllowed returns a non-nil error if the metric isn't allowed to be recorded
+func (m MetricsRules) nameIsAllowed(name string) error {
+	if len(m.AllowedNames) == 0 {
+		return nil
+	}
+
+	for _, allowed := range m.AllowedNames {
+		if matched, _ := path.Match(allowed, name); matched {
+			return nil
+		}
+	}
+
+	return ErrMetricNameDisallowed
+}
@@ -0,0 +1,60 @@
+package rcap
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testSink struct {
+	counters map[string]float64
+}
+
+func (t *testSink) CounterAdd(name string, value float64, labels map[string]string) error {
+	t.counters[name] += value
+	return nil
+}
+
+func (t *testSink) GaugeSet(name string, value float64, labels map[string]string) error {
+	return nil
+}
+
+func (t *testSink) HistogramObserve(name string, value float64, labels map[string]string) error {
+	return nil
+}
+
+func TestMetrics(t *testing.T) {
+	sink := &testSink{counters: map[string]float64{}}
+
+	metrics := DefaultMetrics(MetricsConfig{
+		Enabled: true,
+		Rules:   MetricsRules{AllowedNames: []string{"orders_*"}},
+		Sink:    sink,
+	})
+
+	if err := metrics.CounterAdd("orders_total", 2, nil); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to CounterAdd"))
+	}
+
+	if sink.counters["orders_total"] != 2 {
+		t.Errorf("expected orders_total to be 2, got %f", sink.counters["orders_total"])
+	}
+
+	if err := metrics.CounterAdd("orders_total", -1, nil); !errors.Is(err, ErrMetricValueInvalid) {
+		t.Error("expected ErrMetricValueInvalid for a negative counter, got", err)
+	}
+
+	if err := metrics.GaugeSet("orders_pending", math.NaN(), nil); !errors.Is(err, ErrMetricValueInvalid) {
+		t.Error("expected ErrMetricValueInvalid for NaN, got", err)
+	}
+
+	if err := metrics.HistogramObserve("payments_seconds", 1, nil); !errors.Is(err, ErrMetricNameDisallowed) {
+		t.Error("expected ErrMetricNameDisallowed, got", err)
+	}
+
+	// metrics can't be recorded until the host sets a sink
+	if err := DefaultMetrics(MetricsConfig{Enabled: true}).GaugeSet("orders_pending", 1, nil); !errors.Is(err, ErrMetricsSinkNotSet) {
+		t.Error("expected ErrMetricsSinkNotSet, got", err)
+	}
+}
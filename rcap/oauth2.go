@@ -0,0 +1,285 @@
+package rcap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrOAuth2NoClient is returned when no OAuth2 client is configured for a domain
+var ErrOAuth2NoClient = errors.New("no OAuth2 client is configured for the domain")
+
+// oauth2ExpiryBuffer is how long before a token expires that it's replaced, so that it doesn't expire during a request
+const oauth2ExpiryBuffer = 30 * time.Second
+
+// oauth2DefaultLifetime is how long a token is used for if the server doesn't say when it expires
+const oauth2DefaultLifetime = 5 * time.Minute
+
+// OAuth2Config is configuration for the OAuth2 capability, which acquires tokens with the client credentials grant
+// and adds them to the HTTP and GraphQL requests that Runnables make, so that they never handle the credentials
+type OAuth2Config struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Clients are the OAuth2 clients, each of which is used for requests to its domains
+	Clients []OAuth2ClientConfig `json:"clients" yaml:"clients"`
+
+	// HTTPClient requests tokens, or http.DefaultClient if it's nil
+	HTTPClient *http.Client `json:"-" yaml:"-"`
+}
+
+// OAuth2ClientConfig is configuration for an OAuth2 client
+type OAuth2ClientConfig struct {
+	// Domains are the domains that the client's tokens are added to requests to, which can be patterns such as *.example.com
+	Domains []string `json:"domains" yaml:"domains"`
+
+	// TokenURL is the authorization server's token endpoint, such as https://auth.example.com/oauth/token
+	TokenURL string `json:"tokenURL" yaml:"tokenURL"`
+
+	// ClientID and ClientSecret are the client's credentials. Like the Auth capability's headers,
+	// the secret can be read from the environment by setting it to env(SOME_VARIABLE)
+	ClientID     string `json:"clientID" yaml:"clientID"`
+	ClientSecret string `json:"clientSecret" yaml:"clientSecret"`
+
+	// Scopes and Audience are sent with each token request if they're set
+	Scopes   []string `json:"scopes,omitempty" yaml:"scopes,omitempty"`
+	Audience string   `json:"audience,omitempty" yaml:"audience,omitempty"`
+
+	// CredentialsInBody sends the client's credentials in the request body rather than with HTTP basic auth
+	CredentialsInBody bool `json:"credentialsInBody,omitempty" yaml:"credentialsInBody,omitempty"`
+}
+
+// OAuth2Capability acquires OAuth2 tokens for the requests that Runnables make
+type OAuth2Capability interface {
+	// HeaderForDomain returns an Authorization header with a token for requests to the domain, requesting a new token if
+	// the previous one has expired. ErrOAuth2NoClient is returned if no client is configured for the domain
+	HeaderForDomain(ctx context.Context, domain string) (*AuthHeader, error)
+}
+
+type oauth2Token struct {
+	header  AuthHeader
+	expires time.Time
+}
+
+type oauth2Client struct {
+	config OAuth2ClientConfig
+	token  *oauth2Token
+	lock   sync.Mutex
+}
+
+type defaultOAuth2 struct {
+	config  OAuth2Config
+	client  *http.Client
+	clients []*oauth2Client
+
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// DefaultOAuth2 creates an OAuth2 capability that requests tokens with the config's clients
+func DefaultOAuth2(config OAuth2Config) OAuth2Capability {
+	d := &defaultOAuth2{
+		config:  config,
+		client:  config.HTTPClient,
+		clients: make([]*oauth2Client, len(config.Clients)),
+		now:     time.Now,
+	}
+
+	if d.client == nil {
+		d.client = http.DefaultClient
+	}
+
+	for i := range config.Clients {
+		d.clients[i] = &oauth2Client{config: config.Clients[i]}
+	}
+
+	return d
+}
+
+// HeaderForDomain returns an Authorization header for the domain
+func (d *defaultOAuth2) HeaderForDomain(ctx context.Context, domain string) (*AuthHeader, error) {
+	if !d.config.Enabled {
+		return nil, ErrOAuth2NoClient
+	}
+
+	client := d.clientForDomain(domain)
+	if client == nil {
+		return nil, ErrOAuth2NoClient
+	}
+
+	// the lock is held while the token is requested so that concurrent jobs share one request rather than each making their own
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	if client.token != nil && d.now().Before(client.token.expires) {
+		header := client.token.header
+		return &header, nil
+	}
+
+	token, err := d.requestToken(ctx, client.config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to requestToken from %s", client.config.TokenURL)
+	}
+
+	client.token = token
+
+	header := token.header
+	return &header, nil
+}
+
+// clientForDomain returns the first client whose domains match the domain, with or without its port
+func (d *defaultOAuth2) clientForDomain(domain string) *oauth2Client {
+	hostname := domain
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		hostname = host
+	}
+
+	for _, client := range d.clients {
+		for _, pattern := range client.config.Domains {
+			if matched, _ := path.Match(pattern, domain); matched {
+				return client
+			}
+
+			if matched, _ := path.Match(pattern, hostname); matched {
+				return client
+			}
+		}
+	}
+
+	return nil
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// requestToken requests a token with the client credentials grant
+func (d *defaultOAuth2) requestToken(ctx context.Context, config OAuth2ClientConfig) (*oauth2Token, error) {
+	secret := oauth2SecretFromEnv(config.ClientSecret)
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	if len(config.Scopes) > 0 {
+		form.Set("scope", strings.Join(config.Scopes, " "))
+	}
+
+	if config.Audience != "" {
+		form.Set("audience", config.Audience)
+	}
+
+	if config.CredentialsInBody {
+		form.Set("client_id", config.ClientID)
+		form.Set("client_secret", secret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to NewRequest")
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if !config.CredentialsInBody {
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(secret))
+	}
+
+	requested := d.now()
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Do")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint responded with status %d", resp.StatusCode)
+	}
+
+	tokenResp := oauth2TokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, errors.Wrap(err, "failed to Decode token response")
+	}
+
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+
+	lifetime := oauth2DefaultLifetime
+	if tokenResp.ExpiresIn > 0 {
+		lifetime = time.Duration(tokenResp.ExpiresIn) * time.Second
+	}
+
+	// short-lived tokens are used until they expire rather than being requested again for every request
+	if lifetime > 2*oauth2ExpiryBuffer {
+		lifetime -= oauth2ExpiryBuffer
+	}
+
+	tokenType := tokenResp.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+
+	token := &oauth2Token{
+		header: AuthHeader{
+			HeaderType: tokenType,
+			Value:      tokenResp.AccessToken,
+		},
+		expires: requested.Add(lifetime),
+	}
+
+	return token, nil
+}
+
+// oauth2SecretFromEnv turns env(SOME_VARIABLE) into the value of SOME_VARIABLE
+func oauth2SecretFromEnv(secret string) string {
+	if strings.HasPrefix(secret, "env(") && strings.HasSuffix(secret, ")") {
+		return os.Getenv(strings.TrimSuffix(strings.TrimPrefix(secret, "env("), ")"))
+	}
+
+	return secret
+}
+
+// AuthWithHeader returns an AuthCapability that uses header for requests to domain, and auth for requests to other domains.
+// It's used to add a token from the OAuth2 capability to a request, in place of the Auth capability's header
+func AuthWithHeader(auth AuthCapability, domain string, header *AuthHeader) AuthCapability {
+	a := &headerAuth{
+		auth:   auth,
+		domain: domain,
+		header: header,
+	}
+
+	return a
+}
+
+type headerAuth struct {
+	auth   AuthCapability
+	domain string
+	header *AuthHeader
+}
+
+// HeaderForDomain returns the header for the domain
+func (h *headerAuth) HeaderForDomain(domain string) *AuthHeader {
+	if domain == h.domain {
+		return h.header
+	}
+
+	if h.auth == nil {
+		return nil
+	}
+
+	return h.auth.HeaderForDomain(domain)
+}
@@ -0,0 +1,160 @@
+package rcap
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestOAuth2HeaderForDomain(t *testing.T) {
+	requests := int32(0)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+
+		r.ParseForm()
+
+		clientID, secret, hasBasic := r.BasicAuth()
+		if !hasBasic {
+			clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+
+		if r.PostForm.Get("grant_type") != "client_credentials" || clientID != "reactr" || secret != "s3cret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+
+		resp := map[string]interface{}{
+			"access_token": r.PostForm.Get("scope") + ":" + r.PostForm.Get("audience") + ":" + strconv.Itoa(int(n)),
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		}
+
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	os.Setenv("REACTR_OAUTH2_SECRET", "s3cret")
+	defer os.Unsetenv("REACTR_OAUTH2_SECRET")
+
+	oauth2 := DefaultOAuth2(OAuth2Config{
+		Enabled: true,
+		Clients: []OAuth2ClientConfig{
+			{
+				Domains:      []string{"api.example.com", "*.internal"},
+				TokenURL:     server.URL,
+				ClientID:     "reactr",
+				ClientSecret: "env(REACTR_OAUTH2_SECRET)",
+				Scopes:       []string{"read", "write"},
+				Audience:     "api",
+			},
+			{
+				Domains:           []string{"body.example.com"},
+				TokenURL:          server.URL,
+				ClientID:          "reactr",
+				ClientSecret:      "s3cret",
+				CredentialsInBody: true,
+			},
+			{
+				Domains:      []string{"wrong.example.com"},
+				TokenURL:     server.URL,
+				ClientID:     "reactr",
+				ClientSecret: "wrong",
+			},
+		},
+	}).(*defaultOAuth2)
+
+	now := time.Now()
+	oauth2.now = func() time.Time { return now }
+
+	header, err := oauth2.HeaderForDomain(context.Background(), "api.example.com")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to HeaderForDomain"))
+	}
+
+	if header.HeaderType != "Bearer" || header.Value != "read write:api:1" {
+		t.Errorf("unexpected header %+v", header)
+	}
+
+	// the token is reused until it's about to expire, including for other domains of the same client
+	header, err = oauth2.HeaderForDomain(context.Background(), "billing.internal:8443")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to HeaderForDomain"))
+	}
+
+	if header.Value != "read write:api:1" || atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("expected the token to be reused, got %q after %d requests", header.Value, requests)
+	}
+
+	now = now.Add(time.Hour - oauth2ExpiryBuffer)
+
+	header, err = oauth2.HeaderForDomain(context.Background(), "api.example.com")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to HeaderForDomain"))
+	}
+
+	if header.Value != "read write:api:2" {
+		t.Errorf("expected a new token, got %q", header.Value)
+	}
+
+	t.Run("credentials in body", func(t *testing.T) {
+		header, err := oauth2.HeaderForDomain(context.Background(), "body.example.com")
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to HeaderForDomain"))
+		}
+
+		if header.Value != "::3" {
+			t.Errorf("unexpected token %q", header.Value)
+		}
+	})
+
+	t.Run("rejected credentials", func(t *testing.T) {
+		if _, err := oauth2.HeaderForDomain(context.Background(), "wrong.example.com"); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("no client", func(t *testing.T) {
+		if _, err := oauth2.HeaderForDomain(context.Background(), "example.com"); !errors.Is(err, ErrOAuth2NoClient) {
+			t.Errorf("expected ErrOAuth2NoClient, got %v", err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := DefaultOAuth2(OAuth2Config{Clients: []OAuth2ClientConfig{{Domains: []string{"*"}, TokenURL: server.URL}}})
+
+		if _, err := disabled.HeaderForDomain(context.Background(), "api.example.com"); !errors.Is(err, ErrOAuth2NoClient) {
+			t.Errorf("expected ErrOAuth2NoClient, got %v", err)
+		}
+	})
+}
+
+func TestAuthWithHeader(t *testing.T) {
+	auth := AuthWithHeader(DefaultAuthProvider(AuthConfig{
+		Enabled: true,
+		Headers: map[string]AuthHeader{
+			"api.example.com":   {HeaderType: "Bearer", Value: "static"},
+			"other.example.com": {HeaderType: "Bearer", Value: "other"},
+		},
+	}), "api.example.com", &AuthHeader{HeaderType: "Bearer", Value: "oauth2"})
+
+	if header := auth.HeaderForDomain("api.example.com"); header.Value != "oauth2" {
+		t.Errorf("expected the OAuth2 token, got %q", header.Value)
+	}
+
+	if header := auth.HeaderForDomain("other.example.com"); header.Value != "other" {
+		t.Errorf("expected the static header, got %q", header.Value)
+	}
+
+	if auth.HeaderForDomain("none.example.com") != nil {
+		t.Error("expected no header")
+	}
+}
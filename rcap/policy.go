@@ -0,0 +1,75 @@
+package rcap
+
+import (
+	"path"
+
+	"github.com/pkg/errors"
+)
+
+// ErrHostFnDenied is returned when a Runnable's policy doesn't allow it to call a host function
+var ErrHostFnDenied = errors.New("calling this host function is denied by policy")
+
+// PolicyConfig is configuration for the policy capability, which governs which host functions a Runnable can call.
+// If it isn't enabled, any host function can be called (subject to the rules of the capability it uses)
+type PolicyConfig struct {
+	Enabled bool        `json:"enabled" yaml:"enabled"`
+	Rules   PolicyRules `json:"rules" yaml:"rules"`
+}
+
+// PolicyRules is a set of rules that governs which host functions can be called
+type PolicyRules struct {
+	// AllowedHostFns are the host functions that can be called, which can be patterns such as cache_*
+	// If none are listed, any host function that isn't denied can be called.
+	AllowedHostFns []string `json:"allowedHostFns" yaml:"allowedHostFns"`
+
+	// DeniedHostFns are the host functions that can't be called, even if they're allowed
+	DeniedHostFns []string `json:"deniedHostFns" yaml:"deniedHostFns"`
+}
+
+// PolicyCapability decides which host functions a Runnable can call
+type PolicyCapability interface {
+	// HostFnAllowed returns ErrHostFnDenied if the named host function can't be called
+	HostFnAllowed(name string) error
+}
+
+type defaultPolicy struct {
+	config PolicyConfig
+}
+
+// DefaultPolicy creates a policy capability that follows the config's rules
+func DefaultPolicy(config PolicyConfig) PolicyCapability {
+	d := &defaultPolicy{
+		config: config,
+	}
+
+	return d
+}
+
+// HostFnAllowed checks whether a host function can be called
+func (d *defaultPolicy) HostFnAllowed(name string) error {
+	if !d.config.Enabled {
+		return nil
+	}
+
+	if matchHostFn(d.config.Rules.DeniedHostFns, name) {
+		return errors.Wrapf(ErrHostFnDenied, "host function %s", name)
+	}
+
+	if len(d.config.Rules.AllowedHostFns) == 0 || matchHostFn(d.config.Rules.AllowedHostFns, name) {
+		return nil
+	}
+
+	return errors.Wrapf(ErrHostFnDenied, "host function %s", name)
+}
+
+// matchHostFn returns true if the host function's name matches any of the patterns, such as db_*,
+// which is how the policy, limits, timeouts and audit capabilities choose the host functions they apply to
+func matchHostFn(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,46 @@
+package rcap
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestPolicy(t *testing.T) {
+	policy := DefaultPolicy(PolicyConfig{
+		Enabled: true,
+		Rules: PolicyRules{
+			AllowedHostFns: []string{"cache_*", "return_result", "db_query"},
+			DeniedHostFns:  []string{"cache_delete"},
+		},
+	})
+
+	for _, tc := range []struct {
+		name    string
+		allowed bool
+	}{
+		{"cache_get", true},
+		{"cache_delete", false},
+		{"return_result", true},
+		{"db_query", true},
+		{"db_exec", false},
+		{"fetch_url", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := policy.HostFnAllowed(tc.name)
+			if tc.allowed && err != nil {
+				t.Error("expected allowed, got", err)
+			} else if !tc.allowed && !errors.Is(err, ErrHostFnDenied) {
+				t.Error("expected ErrHostFnDenied, got", err)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := DefaultPolicy(PolicyConfig{Enabled: false, Rules: PolicyRules{DeniedHostFns: []string{"*"}}})
+
+		if err := disabled.HostFnAllowed("fetch_url"); err != nil {
+			t.Error("expected disabled policy to allow everything, got", err)
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package rcap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrRedisNotConfigured     = errors.New("no Redis server is configured")
+	ErrRedisCommandDisallowed = errors.New("command is disallowed")
+)
+
+// redisCommands are the commands that Runnables can use, and the fewest arguments (including the command itself) each needs.
+// Commands that affect the whole server or more than the keys they are given (like KEYS, FLUSHALL or EVAL) are left out.
+var redisCommands = map[string]int{
+	"GET":     2,
+	"MGET":    2,
+	"SET":     3,
+	"DEL":     2,
+	"EXISTS":  2,
+	"INCR":    2,
+	"INCRBY":  3,
+	"DECR":    2,
+	"DECRBY":  3,
+	"EXPIRE":  3,
+	"TTL":     2,
+	"PERSIST": 2,
+	"LPUSH":   3,
+	"RPUSH":   3,
+	"LPOP":    2,
+	"RPOP":    2,
+	"LRANGE":  4,
+	"LLEN":    2,
+	"HGET":    3,
+	"HSET":    4,
+	"HDEL":    3,
+	"HGETALL": 2,
+}
+
+// RedisClientConfig is configuration for the Redis capability
+type RedisClientConfig struct {
+	Enabled bool         `json:"enabled" yaml:"enabled"`
+	Rules   RedisRules   `json:"rules" yaml:"rules"`
+	Server  *RedisConfig `json:"server,omitempty" yaml:"server,omitempty"`
+}
+
+// RedisRules is a set of rules that governs use of the Redis capability
+type RedisRules struct {
+	// AllowedCommands limits Runnables to some of the supported commands, such as GET and INCR.
+	// If none are listed, all of them are allowed.
+	AllowedCommands []string `json:"allowedCommands" yaml:"allowedCommands"`
+}
+
+// RedisCapability gives Runnables the ability to run a safe subset of Redis commands
+type RedisCapability interface {
+	// Do runs the commands (each a command name followed by its arguments) in a pipeline, and returns their results in order
+	Do(ctx context.Context, commands [][]string) ([]RedisResult, error)
+}
+
+// RedisResult is the result of one command. Value is a string, integer, array or nil, and
+// Error is set instead if Redis rejected the command (without affecting the others).
+type RedisResult struct {
+	Value interface{} `json:"value"`
+	Error string      `json:"error,omitempty"`
+}
+
+type redisClient struct {
+	config RedisClientConfig
+
+	client *redis.Client
+	lock   sync.Mutex
+}
+
+// DefaultRedisClient creates a Redis client that follows the config's rules, connecting to the server when it's first used
+func DefaultRedisClient(config RedisClientConfig) RedisCapability {
+	r := &redisClient{
+		config: config,
+	}
+
+	return r
+}
+
+// Do runs the commands in a pipeline
+func (r *redisClient) Do(ctx context.Context, commands [][]string) ([]RedisResult, error) {
+	if !r.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	for _, command := range commands {
+		if err := r.config.Rules.commandIsAllowed(command); err != nil {
+			return nil, errors.Wrap(err, "failed to commandIsAllowed")
+		}
+	}
+
+	client, err := r.conn()
+	if err != nil {
+		return nil, err
+	}
+
+	pipe := client.Pipeline()
+
+	cmds := make([]*redis.Cmd, len(commands))
+	for i, command := range commands {
+		args := make([]interface{}, len(command))
+		for j, arg := range command {
+			args[j] = arg
+		}
+
+		cmds[i] = pipe.Do(ctx, args...)
+	}
+
+	// errors for individual commands are returned in their results, so only fail if Redis couldn't be used at all
+	if _, err := pipe.Exec(ctx); err != nil && !isRedisReplyError(err) {
+		return nil, errors.Wrap(err, "failed to Exec")
+	}
+
+	results := make([]RedisResult, len(cmds))
+	for i, cmd := range cmds {
+		val, err := cmd.Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			results[i] = RedisResult{Error: err.Error()}
+			continue
+		}
+
+		results[i] = RedisResult{Value: val}
+	}
+
+	return results, nil
+}
+
+// conn returns the client, creating it if needed
+func (r *redisClient) conn() (*redis.Client, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.client != nil {
+		return r.client, nil
+	}
+
+	if r.config.Server == nil || r.config.Server.ServerAddress == "" {
+		return nil, ErrRedisNotConfigured
+	}
+
+	r.client = redis.NewClient(&redis.Options{
+		Addr:     r.config.Server.ServerAddress,
+		Username: r.config.Server.Username,
+		Password: r.config.Server.Password,
+	})
+
+	return r.client, nil
+}
+
+// commandIsAllowed returns a non-nil error if the command isn't supported, isn't allowed by the rules, or is missing arguments
+func (r RedisRules) commandIsAllowed(command []string) error {
+	if len(command) == 0 {
+		return errors.New("command is empty")
+	}
+
+	name := strings.ToUpper(command[0])
+
+	minArgs, supported := redisCommands[name]
+	if !supported {
+		return errors.Wrapf(ErrRedisCommandDisallowed, "%s is not supported", name)
+	}
+
+	if len(r.AllowedCommands) > 0 {
+		allowed := false
+		for _, allowedCommand := range r.AllowedCommands {
+			if strings.EqualFold(allowedCommand, name) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return errors.Wrapf(ErrRedisCommandDisallowed, "%s is not allowed", name)
+		}
+	}
+
+	if len(command) < minArgs {
+		return fmt.Errorf("%s needs at least %d arguments", name, minArgs-1)
+	}
+
+	return nil
+}
+
+// isRedisReplyError returns true if err is an error reply from Redis, rather than a failure to talk to it
+func isRedisReplyError(err error) bool {
+	var replyErr redis.Error
+	if errors.As(err, &replyErr) {
+		return true
+	}
+
+	return errors.Is(err, redis.Nil)
+}
@@ -0,0 +1,193 @@
+package rcap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestRedisRules(t *testing.T) {
+	rules := RedisRules{AllowedCommands: []string{"get", "SET", "incr"}}
+
+	for _, tc := range []struct {
+		command []string
+		allowed bool
+	}{
+		{[]string{"GET", "name"}, true},
+		{[]string{"get", "name"}, true},
+		{[]string{"SET", "name", "alice"}, true},
+		{[]string{"SET", "name", "alice", "EX", "60"}, true},
+		{[]string{"SET", "name"}, false},
+		{[]string{"INCR"}, false},
+		{[]string{"DEL", "name"}, false},
+		{[]string{"FLUSHALL"}, false},
+		{[]string{}, false},
+	} {
+		t.Run(strings.Join(tc.command, " "), func(t *testing.T) {
+			if err := rules.commandIsAllowed(tc.command); (err == nil) != tc.allowed {
+				t.Errorf("expected allowed to be %t, got error %v", tc.allowed, err)
+			}
+		})
+	}
+
+	// all of the supported commands are allowed if none are listed
+	if err := (RedisRules{}).commandIsAllowed([]string{"DEL", "name"}); err != nil {
+		t.Error("expected DEL to be allowed, got", err)
+	}
+
+	if err := (RedisRules{}).commandIsAllowed([]string{"KEYS", "*"}); !errors.Is(err, ErrRedisCommandDisallowed) {
+		t.Error("expected ErrRedisCommandDisallowed for KEYS, got", err)
+	}
+}
+
+func TestRedisClient(t *testing.T) {
+	addr := startTestRedisServer(t)
+
+	client := DefaultRedisClient(RedisClientConfig{Enabled: true, Server: &RedisConfig{ServerAddress: addr}})
+
+	results, err := client.Do(context.Background(), [][]string{
+		{"SET", "name", "alice"},
+		{"GET", "name"},
+		{"GET", "missing"},
+		{"INCR", "visits"},
+		{"INCR", "name"},
+	})
+	if err != nil {
+		t.Fatal("failed to Do", err)
+	}
+
+	expected := []RedisResult{
+		{Value: "OK"},
+		{Value: "alice"},
+		{Value: nil},
+		{Value: int64(1)},
+		{Error: "ERR value is not an integer or out of range"},
+	}
+
+	if fmt.Sprint(results) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+
+	// commands are checked before any of them are run
+	if _, err := client.Do(context.Background(), [][]string{{"SET", "name", "bob"}, {"FLUSHALL"}}); !errors.Is(err, ErrRedisCommandDisallowed) {
+		t.Error("expected ErrRedisCommandDisallowed, got", err)
+	}
+
+	results, _ = client.Do(context.Background(), [][]string{{"GET", "name"}})
+	if len(results) != 1 || results[0].Value != "alice" {
+		t.Error("expected the disallowed pipeline not to have run, got", results)
+	}
+
+	disabled := DefaultRedisClient(RedisClientConfig{Enabled: false, Server: &RedisConfig{ServerAddress: addr}})
+	if _, err := disabled.Do(context.Background(), [][]string{{"GET", "name"}}); !errors.Is(err, ErrCapabilityNotEnabled) {
+		t.Error("expected ErrCapabilityNotEnabled, got", err)
+	}
+
+	unconfigured := DefaultRedisClient(RedisClientConfig{Enabled: true})
+	if _, err := unconfigured.Do(context.Background(), [][]string{{"GET", "name"}}); !errors.Is(err, ErrRedisNotConfigured) {
+		t.Error("expected ErrRedisNotConfigured, got", err)
+	}
+}
+
+// startTestRedisServer starts a server that speaks enough of the Redis protocol to handle SET, GET and INCR
+func startTestRedisServer(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to Listen", err)
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	values := map[string]string{}
+	lock := sync.Mutex{}
+
+	reply := func(command []string) string {
+		lock.Lock()
+		defer lock.Unlock()
+
+		switch strings.ToUpper(command[0]) {
+		case "SET":
+			values[command[1]] = command[2]
+			return "+OK\r\n"
+		case "GET":
+			val, exists := values[command[1]]
+			if !exists {
+				return "$-1\r\n"
+			}
+
+			return fmt.Sprintf("$%d\r\n%s\r\n", len(val), val)
+		case "INCR":
+			count, err := strconv.Atoi(values[command[1]])
+			if err != nil && values[command[1]] != "" {
+				return "-ERR value is not an integer or out of range\r\n"
+			}
+
+			values[command[1]] = strconv.Itoa(count + 1)
+			return fmt.Sprintf(":%d\r\n", count+1)
+		}
+
+		return "-ERR unknown command\r\n"
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+
+				for {
+					command, err := readTestRedisCommand(reader)
+					if err != nil {
+						return
+					}
+
+					conn.Write([]byte(reply(command)))
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// readTestRedisCommand reads a command, which clients send as an array of bulk strings
+func readTestRedisCommand(reader *bufio.Reader) ([]string, error) {
+	readLine := func() (string, error) {
+		line, err := reader.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	header, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	count, _ := strconv.Atoi(strings.TrimPrefix(header, "*"))
+
+	command := make([]string, count)
+	for i := range command {
+		// skip the bulk string's length, since none of the test values contain newlines
+		if _, err := readLine(); err != nil {
+			return nil, err
+		}
+
+		if command[i], err = readLine(); err != nil {
+			return nil, err
+		}
+	}
+
+	return command, nil
+}
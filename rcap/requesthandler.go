@@ -1,6 +1,8 @@
 package rcap
 
 import (
+	"net/url"
+
 	"github.com/pkg/errors"
 	"github.com/suborbital/reactr/request"
 )
@@ -27,9 +29,24 @@ type RequestHandlerConfig struct {
 // RequestHandlerCapability allows runnables to handle HTTP requests
 type RequestHandlerCapability interface {
 	GetField(fieldType int32, key string) ([]byte, error)
+	// GetBody returns the request's full body
+	GetBody() ([]byte, error)
+	// GetInfo returns everything about the request other than its body
+	GetInfo() (*RequestInfo, error)
 	SetResponseHeader(key, val string) error
 }
 
+// RequestInfo describes a request, so that a Runnable can read all of it at once rather than field by field
+type RequestInfo struct {
+	ID      string              `json:"id"`
+	Method  string              `json:"method"`
+	URL     string              `json:"url"`
+	Path    string              `json:"path"`
+	Query   map[string][]string `json:"query"`
+	Headers map[string]string   `json:"headers"`
+	Params  map[string]string   `json:"params"`
+}
+
 type requestHandler struct {
 	config RequestHandlerConfig
 	req    *request.CoordinatedRequest
@@ -105,6 +122,56 @@ func (r *requestHandler) GetField(fieldType int32, key string) ([]byte, error) {
 	return []byte(val), nil
 }
 
+// GetBody returns the request's body
+func (r *requestHandler) GetBody() ([]byte, error) {
+	if !r.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	if r.req == nil {
+		return nil, ErrReqNotSet
+	}
+
+	return r.req.Body, nil
+}
+
+// GetInfo returns the request's method, URL, query parameters, headers and params
+func (r *requestHandler) GetInfo() (*RequestInfo, error) {
+	if !r.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	if r.req == nil {
+		return nil, ErrReqNotSet
+	}
+
+	reqURL, err := url.Parse(r.req.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Parse URL")
+	}
+
+	info := &RequestInfo{
+		ID:      r.req.ID,
+		Method:  r.req.Method,
+		URL:     r.req.URL,
+		Path:    reqURL.Path,
+		Query:   reqURL.Query(),
+		Headers: r.req.Headers,
+		Params:  r.req.Params,
+	}
+
+	// empty maps are encoded as objects rather than null, so Runnables don't need to check for both
+	if info.Headers == nil {
+		info.Headers = map[string]string{}
+	}
+
+	if info.Params == nil {
+		info.Params = map[string]string{}
+	}
+
+	return info, nil
+}
+
 // SetResponseHeader sets a header on the response
 func (r *requestHandler) SetResponseHeader(key, val string) error {
 	if !r.config.Enabled {
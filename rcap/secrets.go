@@ -0,0 +1,251 @@
+package rcap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrSecretNotFound    = errors.New("secret not found")
+	ErrSecretDisallowed  = errors.New("reading this secret is disallowed")
+	ErrSecretInvalidName = errors.New("secret name is invalid")
+)
+
+// SecretsConfig is configuration for the secrets capability
+type SecretsConfig struct {
+	Enabled bool         `json:"enabled" yaml:"enabled"`
+	Rules   SecretsRules `json:"rules" yaml:"rules"`
+
+	// the providers that secrets are read from, which are tried in the order Env, Files, Vault, and then Providers
+	Env       *EnvSecretsConfig   `json:"env,omitempty" yaml:"env,omitempty"`
+	Files     *FileSecretsConfig  `json:"files,omitempty" yaml:"files,omitempty"`
+	Vault     *VaultSecretsConfig `json:"vault,omitempty" yaml:"vault,omitempty"`
+	Providers []SecretProvider    `json:"-" yaml:"-"`
+}
+
+// SecretsRules is a set of rules that governs use of the secrets capability
+type SecretsRules struct {
+	// AllowedSecrets are the names of the secrets that can be read, which can be patterns such as db/*.
+	// Secrets must be allowed to be read, so if none are listed, none can be.
+	AllowedSecrets []string `json:"allowedSecrets" yaml:"allowedSecrets"`
+}
+
+// EnvSecretsConfig reads secrets from environment variables, with names such as db/password read from PREFIX_DB_PASSWORD
+type EnvSecretsConfig struct {
+	Prefix string `json:"prefix" yaml:"prefix"`
+}
+
+// FileSecretsConfig reads secrets from the files in a directory, such as those mounted by Docker or Kubernetes
+type FileSecretsConfig struct {
+	Directory string `json:"directory" yaml:"directory"`
+}
+
+// VaultSecretsConfig reads secrets from a HashiCorp Vault KV version 2 secrets engine,
+// with names such as db/password read from the Field of the secret at Mount/data/db/password
+type VaultSecretsConfig struct {
+	Address string `json:"address" yaml:"address"`
+	Token   string `json:"token" yaml:"token"`
+	Mount   string `json:"mount" yaml:"mount"`
+	Field   string `json:"field" yaml:"field"`
+}
+
+// SecretProvider is a source of secrets, which returns ErrSecretNotFound for secrets that it doesn't have
+type SecretProvider interface {
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+// SecretsCapability gives Runnables the ability to read individual secrets
+type SecretsCapability interface {
+	Get(ctx context.Context, name string) ([]byte, error)
+}
+
+type defaultSecrets struct {
+	config    SecretsConfig
+	providers []SecretProvider
+}
+
+// DefaultSecrets creates a secrets capability that reads secrets from the config's providers
+func DefaultSecrets(config SecretsConfig) SecretsCapability {
+	d := &defaultSecrets{
+		config:    config,
+		providers: []SecretProvider{},
+	}
+
+	if config.Env != nil {
+		d.providers = append(d.providers, &envSecretProvider{prefix: config.Env.Prefix})
+	}
+
+	if config.Files != nil {
+		d.providers = append(d.providers, &fileSecretProvider{directory: config.Files.Directory})
+	}
+
+	if config.Vault != nil {
+		d.providers = append(d.providers, newVaultSecretProvider(*config.Vault))
+	}
+
+	d.providers = append(d.providers, config.Providers...)
+
+	return d
+}
+
+// Get returns the secret from the first provider that has it
+func (d *defaultSecrets) Get(ctx context.Context, name string) ([]byte, error) {
+	if !d.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	if err := d.config.Rules.secretIsAllowed(name); err != nil {
+		return nil, err
+	}
+
+	for _, provider := range d.providers {
+		secret, err := provider.Secret(ctx, name)
+		if err != nil {
+			if errors.Is(err, ErrSecretNotFound) {
+				continue
+			}
+
+			return nil, errors.Wrap(err, "failed to Secret")
+		}
+
+		return secret, nil
+	}
+
+	return nil, ErrSecretNotFound
+}
+
+// secretIsAllowed returns a non-nil error if the secret isn't allowed to be read
+func (s SecretsRules) secretIsAllowed(name string) error {
+	// names are paths, so they can't lead out of the directories or mounts that secrets are read from
+	if name == "" || !filepath.IsLocal(filepath.FromSlash(name)) || strings.Contains(name, "\\") {
+		return ErrSecretInvalidName
+	}
+
+	for _, allowed := range s.AllowedSecrets {
+		if matched, _ := path.Match(allowed, name); matched {
+			return nil
+		}
+	}
+
+	return ErrSecretDisallowed
+}
+
+type envSecretProvider struct {
+	prefix string
+}
+
+func (e *envSecretProvider) Secret(ctx context.Context, name string) ([]byte, error) {
+	key := e.prefix + strings.ToUpper(strings.NewReplacer("/", "_", "-", "_", ".", "_").Replace(name))
+
+	val, exists := os.LookupEnv(key)
+	if !exists {
+		return nil, ErrSecretNotFound
+	}
+
+	return []byte(val), nil
+}
+
+type fileSecretProvider struct {
+	directory string
+}
+
+func (f *fileSecretProvider) Secret(ctx context.Context, name string) ([]byte, error) {
+	secret, err := os.ReadFile(filepath.Join(f.directory, filepath.FromSlash(name)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrSecretNotFound
+		}
+
+		return nil, errors.Wrap(err, "failed to ReadFile")
+	}
+
+	return secret, nil
+}
+
+type vaultSecretProvider struct {
+	config VaultSecretsConfig
+	client *http.Client
+}
+
+func newVaultSecretProvider(config VaultSecretsConfig) *vaultSecretProvider {
+	if config.Mount == "" {
+		config.Mount = "secret"
+	}
+
+	if config.Field == "" {
+		config.Field = "value"
+	}
+
+	v := &vaultSecretProvider{
+		config: config,
+		client: http.DefaultClient,
+	}
+
+	return v
+}
+
+// vaultSecretResponse is the part of a KV version 2 read response that contains the secret's fields
+type vaultSecretResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+func (v *vaultSecretProvider) Secret(ctx context.Context, name string) ([]byte, error) {
+	secretURL, err := url.Parse(v.config.Address)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to url.Parse")
+	}
+
+	secretURL.Path = path.Join("/v1", v.config.Mount, "data", name)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretURL.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to NewRequest")
+	}
+
+	req.Header.Set("X-Vault-Token", v.config.Token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Do")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrSecretNotFound
+	}
+
+	if resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("Vault responded with status %d: %s", resp.StatusCode, msg)
+	}
+
+	secretResp := vaultSecretResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&secretResp); err != nil {
+		return nil, errors.Wrap(err, "failed to Decode")
+	}
+
+	val, exists := secretResp.Data.Data[v.config.Field]
+	if !exists {
+		return nil, ErrSecretNotFound
+	}
+
+	if str, isString := val.(string); isString {
+		return []byte(str), nil
+	}
+
+	// fields that aren't strings are returned as JSON
+	return json.Marshal(val)
+}
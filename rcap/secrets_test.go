@@ -0,0 +1,100 @@
+package rcap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testSecretProvider map[string]string
+
+func (t testSecretProvider) Secret(ctx context.Context, name string) ([]byte, error) {
+	val, exists := t[name]
+	if !exists {
+		return nil, ErrSecretNotFound
+	}
+
+	return []byte(val), nil
+}
+
+func TestSecrets(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "api-key"), []byte("from-file"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("REACTR_SECRET_DB_PASSWORD", "from-env")
+
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/kv/data/stripe/key":
+			fmt.Fprint(w, `{"data":{"data":{"value":"from-vault"},"metadata":{"version":1}}}`)
+		case "/v1/kv/data/db/password":
+			fmt.Fprint(w, `{"data":{"data":{"value":"shadowed"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	defer vault.Close()
+
+	secrets := DefaultSecrets(SecretsConfig{
+		Enabled:   true,
+		Rules:     SecretsRules{AllowedSecrets: []string{"db/*", "api-key", "stripe/key", "custom", "missing"}},
+		Env:       &EnvSecretsConfig{Prefix: "REACTR_SECRET_"},
+		Files:     &FileSecretsConfig{Directory: dir},
+		Vault:     &VaultSecretsConfig{Address: vault.URL, Token: "root", Mount: "kv"},
+		Providers: []SecretProvider{testSecretProvider{"custom": "from-provider", "other": "private"}},
+	})
+
+	ctx := context.Background()
+
+	for name, expected := range map[string]string{
+		"db/password": "from-env",
+		"api-key":     "from-file",
+		"stripe/key":  "from-vault",
+		"custom":      "from-provider",
+	} {
+		secret, err := secrets.Get(ctx, name)
+		if err != nil {
+			t.Errorf("failed to Get %s: %s", name, err)
+			continue
+		}
+
+		if string(secret) != expected {
+			t.Errorf("expected %s to be %q, got %q", name, expected, secret)
+		}
+	}
+
+	if _, err := secrets.Get(ctx, "missing"); !errors.Is(err, ErrSecretNotFound) {
+		t.Error("expected ErrSecretNotFound, got", err)
+	}
+
+	if _, err := secrets.Get(ctx, "other"); !errors.Is(err, ErrSecretDisallowed) {
+		t.Error("expected ErrSecretDisallowed, got", err)
+	}
+
+	for _, name := range []string{"", "../api-key", "db/../../etc/passwd", "/etc/passwd"} {
+		if _, err := secrets.Get(ctx, name); !errors.Is(err, ErrSecretInvalidName) {
+			t.Errorf("expected ErrSecretInvalidName for %q, got %v", name, err)
+		}
+	}
+
+	disabled := DefaultSecrets(SecretsConfig{Env: &EnvSecretsConfig{Prefix: "REACTR_SECRET_"}, Rules: SecretsRules{AllowedSecrets: []string{"*"}}})
+
+	if _, err := disabled.Get(ctx, "db/password"); !errors.Is(err, ErrCapabilityNotEnabled) {
+		t.Error("expected ErrCapabilityNotEnabled, got", err)
+	}
+}
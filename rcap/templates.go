@@ -0,0 +1,114 @@
+package rcap
+
+import (
+	"bytes"
+	"context"
+	htmltemplate "html/template"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+
+	"github.com/pkg/errors"
+)
+
+var ErrTemplateNameDisallowed = errors.New("template name is outside of the templates directory")
+
+// TemplatesConfig is configuration for the templates capability, which renders Go templates loaded from the File capability's static files
+type TemplatesConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// Directory is the directory within the static files that templates are loaded from, such as templates
+	Directory string `json:"directory,omitempty" yaml:"directory,omitempty"`
+}
+
+// TemplatesCapability gives Runnables the ability to render templates
+type TemplatesCapability interface {
+	// Render executes the named template with data. Templates whose names end with .html or .htm are
+	// rendered with html/template, so that data is escaped, and all others are rendered with text/template
+	// Templates that haven't been loaded yet stop loading once ctx is cancelled
+	Render(ctx context.Context, name string, data interface{}) ([]byte, error)
+}
+
+// renderer is a parsed text or html template
+type renderer interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+type defaultTemplates struct {
+	config TemplatesConfig
+	files  FileCapability
+
+	parsed map[string]renderer
+	lock   sync.RWMutex
+}
+
+// DefaultTemplates creates a templates capability that loads templates from files' static files.
+// Each template is parsed the first time that it's rendered
+func DefaultTemplates(config TemplatesConfig, files FileCapability) TemplatesCapability {
+	d := &defaultTemplates{
+		config: config,
+		files:  files,
+		parsed: map[string]renderer{},
+	}
+
+	return d
+}
+
+// Render renders a template
+func (d *defaultTemplates) Render(ctx context.Context, name string, data interface{}) ([]byte, error) {
+	if !d.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	tmpl, err := d.template(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, errors.Wrap(err, "failed to Execute")
+	}
+
+	return buf.Bytes(), nil
+}
+
+// template returns the parsed template, loading it if needed
+func (d *defaultTemplates) template(ctx context.Context, name string) (renderer, error) {
+	d.lock.RLock()
+	tmpl, exists := d.parsed[name]
+	d.lock.RUnlock()
+
+	if exists {
+		return tmpl, nil
+	}
+
+	cleaned := path.Clean("/" + name)[1:]
+	if cleaned == "" || cleaned != name {
+		return nil, ErrTemplateNameDisallowed
+	}
+
+	contents, err := GetStaticWithContext(d.files, ctx, path.Join(d.config.Directory, name))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to GetStaticWithContext")
+	}
+
+	if ext := path.Ext(name); strings.EqualFold(ext, ".html") || strings.EqualFold(ext, ".htm") {
+		tmpl, err = htmltemplate.New(name).Parse(string(contents))
+	} else {
+		tmpl, err = texttemplate.New(name).Parse(string(contents))
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Parse")
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.parsed[name] = tmpl
+
+	return tmpl, nil
+}
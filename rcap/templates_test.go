@@ -0,0 +1,50 @@
+package rcap
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestTemplates(t *testing.T) {
+	static := map[string]string{
+		"templates/welcome.html": `<p>Hello, {{.name}}</p>`,
+		"templates/welcome.txt":  `Hello, {{.name}}`,
+		"secret.txt":             `not a template`,
+	}
+
+	files := DefaultFileSource(FileConfig{
+		Enabled: true,
+		FileFunc: func(name string) ([]byte, error) {
+			contents, exists := static[name]
+			if !exists {
+				return nil, os.ErrNotExist
+			}
+
+			return []byte(contents), nil
+		},
+	})
+
+	templates := DefaultTemplates(TemplatesConfig{Enabled: true, Directory: "templates"}, files)
+
+	data := map[string]interface{}{"name": "<Ada>"}
+
+	// html templates escape their data, and text templates don't
+	if out, err := templates.Render(context.Background(), "welcome.html", data); err != nil || string(out) != "<p>Hello, &lt;Ada&gt;</p>" {
+		t.Errorf("unexpected html render %q (%v)", out, err)
+	}
+
+	if out, err := templates.Render(context.Background(), "welcome.txt", data); err != nil || string(out) != "Hello, <Ada>" {
+		t.Errorf("unexpected text render %q (%v)", out, err)
+	}
+
+	if _, err := templates.Render(context.Background(), "missing.txt", data); !errors.Is(err, os.ErrNotExist) {
+		t.Error("expected os.ErrNotExist, got", err)
+	}
+
+	if _, err := templates.Render(context.Background(), "../secret.txt", data); !errors.Is(err, ErrTemplateNameDisallowed) {
+		t.Error("expected ErrTemplateNameDisallowed, got", err)
+	}
+}
@@ -0,0 +1,76 @@
+package rcap
+
+import (
+	"context"
+	"time"
+)
+
+// TimeoutsConfig is configuration for the timeouts capability, which limits how long each call to a host function can take,
+// so that a hung upstream (such as an HTTP server or database) can't hold on to a Wasm instance until its job times out
+type TimeoutsConfig struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+
+	// DefaultMillis is the timeout for calls to host functions that none of the Timeouts apply to, or there is none if 0
+	DefaultMillis int `json:"defaultMillis,omitempty" yaml:"defaultMillis,omitempty"`
+
+	// Timeouts are checked in order, and the first that applies to a host function is used
+	Timeouts []HostFnTimeout `json:"timeouts,omitempty" yaml:"timeouts,omitempty"`
+}
+
+// HostFnTimeout is the timeout for each call to a group of host functions, such as 5 seconds for fetch_*
+type HostFnTimeout struct {
+	// HostFns are the host functions that the timeout applies to, which can be patterns such as db_*
+	HostFns []string `json:"hostFns" yaml:"hostFns"`
+
+	// Millis is the timeout for each call, or there is none if 0
+	Millis int `json:"millis" yaml:"millis"`
+}
+
+// TimeoutsCapability gives host functions a context for each call
+type TimeoutsCapability interface {
+	// Context returns a context for a call to the named host function, which is cancelled when parent (such
+	// as the job's context) is cancelled or when the call's timeout passes. cancel must be called once the call is done
+	Context(parent context.Context, hostFn string) (context.Context, context.CancelFunc)
+}
+
+type defaultTimeouts struct {
+	config TimeoutsConfig
+}
+
+// DefaultTimeouts creates a timeouts capability that applies the config's timeouts
+func DefaultTimeouts(config TimeoutsConfig) TimeoutsCapability {
+	d := &defaultTimeouts{
+		config: config,
+	}
+
+	return d
+}
+
+// Context returns a context for a call to hostFn
+func (d *defaultTimeouts) Context(parent context.Context, hostFn string) (context.Context, context.CancelFunc) {
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	timeout := d.timeout(hostFn)
+	if timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+
+	return context.WithTimeout(parent, timeout)
+}
+
+// timeout returns the timeout for calls to hostFn, or 0 if there is none
+func (d *defaultTimeouts) timeout(hostFn string) time.Duration {
+	if !d.config.Enabled {
+		return 0
+	}
+
+	for _, t := range d.config.Timeouts {
+		if matchHostFn(t.HostFns, hostFn) {
+			return time.Duration(t.Millis) * time.Millisecond
+		}
+	}
+
+	return time.Duration(d.config.DefaultMillis) * time.Millisecond
+}
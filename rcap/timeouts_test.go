@@ -0,0 +1,58 @@
+package rcap
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTimeouts(t *testing.T) {
+	timeouts := DefaultTimeouts(TimeoutsConfig{
+		Enabled:       true,
+		DefaultMillis: 5000,
+		Timeouts: []HostFnTimeout{
+			{HostFns: []string{"fetch_*", "http_request"}, Millis: 100},
+			{HostFns: []string{"db_*"}, Millis: 0},
+		},
+	})
+
+	for hostFn, expected := range map[string]time.Duration{
+		"fetch_url":    100 * time.Millisecond,
+		"http_request": 100 * time.Millisecond,
+		"cache_get":    5 * time.Second,
+		"db_query":     0,
+	} {
+		ctx, cancel := timeouts.Context(context.Background(), hostFn)
+
+		deadline, hasDeadline := ctx.Deadline()
+		if expected == 0 && hasDeadline {
+			t.Errorf("expected %s not to have a timeout", hostFn)
+		} else if remaining := time.Until(deadline); expected > 0 && (remaining > expected || remaining < expected-time.Second) {
+			t.Errorf("expected %s to have a timeout of %s, got %s", hostFn, expected, remaining)
+		}
+
+		cancel()
+	}
+
+	// calls are cancelled along with their parent, such as the job's context
+	parent, cancelParent := context.WithCancel(context.Background())
+
+	ctx, cancel := timeouts.Context(parent, "db_query")
+	defer cancel()
+
+	cancelParent()
+
+	if ctx.Err() != context.Canceled {
+		t.Error("expected the call to be cancelled with its parent, got", ctx.Err())
+	}
+
+	// timeouts aren't applied when the capability is disabled
+	disabled := DefaultTimeouts(TimeoutsConfig{Enabled: false, DefaultMillis: 100})
+
+	ctx, cancel = disabled.Context(context.Background(), "fetch_url")
+	defer cancel()
+
+	if _, hasDeadline := ctx.Deadline(); hasDeadline {
+		t.Error("expected no timeout when the capability is disabled")
+	}
+}
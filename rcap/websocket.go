@@ -0,0 +1,238 @@
+package rcap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrWebSocketInsecure         = errors.New("connections to insecure WebSocket endpoints are disallowed")
+	ErrWebSocketOriginDisallowed = errors.New("connections to this origin are disallowed")
+	ErrWebSocketClosed           = errors.New("the WebSocket connection was closed")
+)
+
+// WebSocket message types, which match the frame opcodes from RFC 6455
+const (
+	WebSocketTextMessage   = websocket.TextMessage
+	WebSocketBinaryMessage = websocket.BinaryMessage
+)
+
+// WebSocketConfig is configuration for the WebSocket capability
+type WebSocketConfig struct {
+	Enabled bool           `json:"enabled" yaml:"enabled"`
+	Rules   WebSocketRules `json:"rules" yaml:"rules"`
+}
+
+// WebSocketRules is a set of rules that governs use of the WebSocket capability
+type WebSocketRules struct {
+	// AllowedOrigins are the origins that can be connected to, such as wss://stream.example.com or wss://*.example.com.
+	// An origin without a scheme allows either ws:// or wss://, and if none are listed, any origin is allowed.
+	AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins"`
+	AllowInsecure  bool     `json:"allowInsecure" yaml:"allowInsecure"`
+}
+
+// WebSocketCapability gives Runnables the ability to connect to WebSocket servers
+type WebSocketCapability interface {
+	Dial(ctx context.Context, auth AuthCapability, urlString string, headers http.Header) (WebSocketConn, error)
+}
+
+// WebSocketConn is an open WebSocket connection
+type WebSocketConn interface {
+	// Send sends a message of the given type (WebSocketTextMessage or WebSocketBinaryMessage)
+	Send(messageType int, data []byte) error
+	// Receive waits for the next message until ctx is done, and returns ErrWebSocketClosed once the server has closed the connection.
+	// If ctx is done first, the connection is closed (since it can't be read from again) and its error is returned
+	Receive(ctx context.Context) (messageType int, data []byte, err error)
+	// Close closes the connection, telling the server why if possible
+	Close() error
+}
+
+type webSocketClient struct {
+	config WebSocketConfig
+	dialer *websocket.Dialer
+}
+
+// DefaultWebSocketClient creates a WebSocket client that follows the config's rules
+func DefaultWebSocketClient(config WebSocketConfig) WebSocketCapability {
+	w := &webSocketClient{
+		config: config,
+		dialer: websocket.DefaultDialer,
+	}
+
+	return w
+}
+
+// Dial connects to the WebSocket server at urlString
+func (w *webSocketClient) Dial(ctx context.Context, auth AuthCapability, urlString string, headers http.Header) (WebSocketConn, error) {
+	if !w.config.Enabled {
+		return nil, ErrCapabilityNotEnabled
+	}
+
+	urlObj, err := url.Parse(urlString)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to url.Parse")
+	}
+
+	if err := w.config.Rules.connectionIsAllowed(urlObj); err != nil {
+		return nil, errors.Wrap(err, "failed to connectionIsAllowed")
+	}
+
+	if headers == nil {
+		headers = http.Header{}
+	}
+
+	authHeader := auth.HeaderForDomain(urlObj.Host)
+	if authHeader != nil && authHeader.Value != "" {
+		headers.Add("Authorization", fmt.Sprintf("%s %s", authHeader.HeaderType, authHeader.Value))
+	}
+
+	conn, resp, err := w.dialer.DialContext(ctx, urlObj.String(), headers)
+	if err != nil {
+		if resp != nil {
+			return nil, errors.Wrapf(err, "failed to Dial, server responded with status %d", resp.StatusCode)
+		}
+
+		return nil, errors.Wrap(err, "failed to Dial")
+	}
+
+	return &webSocketConn{conn: conn}, nil
+}
+
+// connectionIsAllowed returns a non-nil error if a connection to the URL is not allowed
+func (w WebSocketRules) connectionIsAllowed(urlObj *url.URL) error {
+	if urlObj.Scheme != "ws" && urlObj.Scheme != "wss" {
+		return fmt.Errorf("unsupported WebSocket scheme %q", urlObj.Scheme)
+	}
+
+	if urlObj.Scheme == "ws" && !w.AllowInsecure {
+		return ErrWebSocketInsecure
+	}
+
+	if len(w.AllowedOrigins) == 0 {
+		return nil
+	}
+
+	for _, origin := range w.AllowedOrigins {
+		scheme, host := "", origin
+
+		if originURL, err := url.Parse(origin); err == nil && originURL.Host != "" {
+			scheme, host = originURL.Scheme, originURL.Host
+		}
+
+		if scheme != "" && scheme != urlObj.Scheme {
+			continue
+		}
+
+		// an origin without a port matches any port
+		target := urlObj.Host
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			target = urlObj.Hostname()
+		}
+
+		if matchesDomain(host, target) {
+			return nil
+		}
+	}
+
+	return ErrWebSocketOriginDisallowed
+}
+
+type webSocketConn struct {
+	conn *websocket.Conn
+
+	// timedOut is set once a Receive has timed out or been cancelled, after which the connection is closed
+	timedOut bool
+}
+
+func (w *webSocketConn) Send(messageType int, data []byte) error {
+	if w.timedOut {
+		return errors.Wrap(ErrWebSocketClosed, "closed after a receive timed out")
+	}
+
+	if messageType != WebSocketTextMessage && messageType != WebSocketBinaryMessage {
+		return fmt.Errorf("invalid WebSocket message type %d", messageType)
+	}
+
+	return w.conn.WriteMessage(messageType, data)
+}
+
+func (w *webSocketConn) Receive(ctx context.Context) (int, []byte, error) {
+	if w.timedOut {
+		return 0, nil, errors.Wrap(ErrWebSocketClosed, "closed after a receive timed out")
+	}
+
+	deadline, _ := ctx.Deadline()
+
+	if err := w.conn.SetReadDeadline(deadline); err != nil {
+		return 0, nil, errors.Wrap(err, "failed to SetReadDeadline")
+	}
+
+	// stop waiting if the context is cancelled before its deadline
+	if ctx.Done() != nil {
+		received := make(chan struct{})
+		defer close(received)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				w.conn.SetReadDeadline(time.Now())
+			case <-received:
+			}
+		}()
+	}
+
+	messageType, data, err := w.conn.ReadMessage()
+	if err != nil {
+		// the read deadline can pass just before the context notices its own deadline
+		var netErr net.Error
+		if ctx.Err() != nil || (errors.As(err, &netErr) && netErr.Timeout()) {
+			ctxErr := ctx.Err()
+			if ctxErr == nil {
+				ctxErr = context.DeadlineExceeded
+			}
+
+			// gorilla's connections can't be read from again once a read has timed out
+			w.timedOut = true
+			w.conn.Close()
+
+			return 0, nil, errors.Wrap(ctxErr, "failed to ReadMessage")
+		}
+
+		if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+			return 0, nil, ErrWebSocketClosed
+		}
+
+		return 0, nil, errors.Wrap(err, "failed to ReadMessage")
+	}
+
+	return messageType, data, nil
+}
+
+func (w *webSocketConn) Close() error {
+	if w.timedOut {
+		return nil
+	}
+
+	// let the server know the connection is closing, but don't wait for it to respond
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	w.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+
+	return w.conn.Close()
+}
+
+// defaultWebSocketRules returns the default rules with all connections allowed
+func defaultWebSocketRules() WebSocketRules {
+	w := WebSocketRules{
+		AllowedOrigins: []string{},
+		AllowInsecure:  true,
+	}
+
+	return w
+}
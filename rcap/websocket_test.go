@@ -0,0 +1,147 @@
+package rcap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+func TestWebSocketRules(t *testing.T) {
+	rules := defaultWebSocketRules()
+	rules.AllowedOrigins = []string{"wss://stream.example.com", "*.events.com", "ws://localhost:8080"}
+
+	for _, tc := range []struct {
+		url     string
+		allowed bool
+	}{
+		{"wss://stream.example.com/feed", true},
+		{"wss://stream.example.com:8443/feed", true},
+		{"ws://stream.example.com/feed", false},
+		{"wss://other.example.com/feed", false},
+		{"ws://eu.events.com", true},
+		{"wss://eu.events.com", true},
+		{"ws://localhost:8080", true},
+		{"ws://localhost:9090", false},
+		{"https://stream.example.com", false},
+	} {
+		t.Run(tc.url, func(t *testing.T) {
+			urlObj, _ := url.Parse(tc.url)
+
+			if err := rules.connectionIsAllowed(urlObj); (err == nil) != tc.allowed {
+				t.Errorf("expected allowed to be %t, got error %v", tc.allowed, err)
+			}
+		})
+	}
+
+	rules = defaultWebSocketRules()
+	rules.AllowInsecure = false
+
+	urlObj, _ := url.Parse("ws://stream.example.com")
+
+	if err := rules.connectionIsAllowed(urlObj); !errors.Is(err, ErrWebSocketInsecure) {
+		t.Error("expected ErrWebSocketInsecure, got", err)
+	}
+}
+
+func TestWebSocketClient(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if string(data) == "bye" {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			}
+
+			if string(data) == "wait" {
+				continue
+			}
+
+			conn.WriteMessage(messageType, []byte(r.Header.Get("X-Greeting")+" "+string(data)))
+		}
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	client := DefaultWebSocketClient(WebSocketConfig{Enabled: true, Rules: defaultWebSocketRules()})
+	auth := DefaultAuthProvider(AuthConfig{})
+
+	conn, err := client.Dial(context.Background(), auth, wsURL, http.Header{"X-Greeting": []string{"hello"}})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Dial"))
+	}
+
+	defer conn.Close()
+
+	if err := conn.Send(WebSocketTextMessage, []byte("world")); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Send"))
+	}
+
+	messageType, data, err := conn.Receive(context.Background())
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Receive"))
+	}
+
+	if messageType != WebSocketTextMessage || string(data) != "hello world" {
+		t.Errorf("unexpected message %d %q", messageType, string(data))
+	}
+
+	// waiting for a message stops when the context is done
+	conn.Send(WebSocketTextMessage, []byte("wait"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	if _, _, err := conn.Receive(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected context.DeadlineExceeded, got", err)
+	}
+
+	// the connection is closed once a receive has timed out
+	if _, _, err := conn.Receive(context.Background()); !errors.Is(err, ErrWebSocketClosed) {
+		t.Error("expected ErrWebSocketClosed after timeout, got", err)
+	}
+
+	if err := conn.Send(WebSocketTextMessage, []byte("world")); !errors.Is(err, ErrWebSocketClosed) {
+		t.Error("expected ErrWebSocketClosed after timeout, got", err)
+	}
+
+	// a connection closed by the server is reported as ErrWebSocketClosed
+	closing, err := client.Dial(context.Background(), auth, wsURL, nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Dial"))
+	}
+
+	defer closing.Close()
+
+	closing.Send(WebSocketTextMessage, []byte("bye"))
+
+	if _, _, err := closing.Receive(context.Background()); !errors.Is(err, ErrWebSocketClosed) {
+		t.Error("expected ErrWebSocketClosed, got", err)
+	}
+
+	disabled := DefaultWebSocketClient(WebSocketConfig{})
+
+	if _, err := disabled.Dial(context.Background(), auth, wsURL, nil); !errors.Is(err, ErrCapabilityNotEnabled) {
+		t.Error("expected ErrCapabilityNotEnabled, got", err)
+	}
+}
@@ -0,0 +1,284 @@
+package rgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rgrpc/pb"
+	"github.com/suborbital/reactr/rt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// inFlightTTL is how long the result of a job submitted without await can be streamed for, and maxInFlight is the most
+// results that can be waiting to be streamed, so that results that are never streamed don't build up forever
+const (
+	inFlightTTL = 10 * time.Minute
+	maxInFlight = 10000
+)
+
+// Server is a gRPC server that allows non-Go clients to schedule Reactr jobs
+type Server struct {
+	pb.UnimplementedReactrServer
+
+	*grpc.Server
+	*rt.Reactr
+	inFlight map[string]inFlightResult
+	lock     sync.Mutex
+}
+
+// inFlightResult is the result of a job submitted without await, which is waiting to be streamed
+type inFlightResult struct {
+	result  *rt.Result
+	expires time.Time
+}
+
+// New creates a new rgrpc server
+func New(opts ...grpc.ServerOption) *Server {
+	return NewWithReactr(rt.New(), opts...)
+}
+
+// NewWithReactr creates a new rgrpc server that schedules jobs on an existing Reactr instance
+func NewWithReactr(r *rt.Reactr, opts ...grpc.ServerOption) *Server {
+	server := &Server{
+		Server:   grpc.NewServer(opts...),
+		Reactr:   r,
+		inFlight: make(map[string]inFlightResult),
+		lock:     sync.Mutex{},
+	}
+
+	pb.RegisterReactrServer(server.Server, server)
+
+	return server
+}
+
+// Start listens on the provided address and serves gRPC requests until the server is stopped
+func (s *Server) Start(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "failed to Listen")
+	}
+
+	return s.Serve(lis)
+}
+
+// SubmitJob schedules a job, and waits for its result if requested
+func (s *Server) SubmitJob(ctx context.Context, req *pb.SubmitJobRequest) (*pb.SubmitJobResponse, error) {
+	if req.JobType == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing job_type")
+	}
+
+	if !s.IsRegistered(req.JobType) {
+		return nil, status.Errorf(codes.NotFound, "jobType %s is not registered", req.JobType)
+	}
+
+	if !req.Await && !s.hasInFlightRoom() {
+		return nil, status.Error(codes.ResourceExhausted, "too many results are waiting to be streamed")
+	}
+
+	res := s.Do(rt.NewJob(req.JobType, req.Data))
+
+	resp := &pb.SubmitJobResponse{
+		ResultId: res.UUID(),
+	}
+
+	if req.Await {
+		result, err := awaitResult(ctx, res)
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Result = result
+
+		return resp, nil
+	}
+
+	s.addInFlight(res)
+
+	return resp, nil
+}
+
+// awaitResult waits for a job's result, or returns ctx's error as a status if ctx is done first. A result that
+// arrives as ctx is done is returned rather than dropped, since the job has already run
+func awaitResult(ctx context.Context, res *rt.Result) (*pb.JobResult, error) {
+	data, err := res.ThenWithContext(ctx)
+	if ctxErr := ctx.Err(); ctxErr == nil || !errors.Is(err, ctxErr) {
+		return jobResult(res.UUID(), data, err), nil
+	}
+
+	// callbacks are called straight away if the result is ready, or otherwise later, when nothing is waiting for them
+	ready := make(chan *pb.JobResult, 1)
+
+	res.OnSuccess(func(data interface{}) {
+		ready <- jobResult(res.UUID(), data, nil)
+	}).OnError(func(err error) {
+		ready <- jobResult(res.UUID(), nil, err)
+	})
+
+	select {
+	case result := <-ready:
+		return result, nil
+	default:
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// StreamResults waits on each of the requested results and sends them in the order that they complete. Results are
+// removed once they've been sent, so any that aren't sent (such as if the stream is cancelled) can be streamed again
+func (s *Server) StreamResults(req *pb.StreamResultsRequest, stream pb.Reactr_StreamResultsServer) error {
+	results := make([]*rt.Result, len(req.ResultIds))
+
+	for i, id := range req.ResultIds {
+		res := s.getInFlight(id)
+		if res == nil {
+			return status.Errorf(codes.NotFound, "result with ID %s not found", id)
+		}
+
+		results[i] = res
+	}
+
+	completed := make(chan *pb.JobResult, len(results))
+
+	// callbacks don't consume the results, unlike waiting on them with Then
+	for i := range results {
+		id := results[i].UUID()
+
+		results[i].OnSuccess(func(data interface{}) {
+			completed <- jobResult(id, data, nil)
+		}).OnError(func(err error) {
+			completed <- jobResult(id, nil, err)
+		})
+	}
+
+	for range results {
+		select {
+		case result := <-completed:
+			if err := stream.Send(result); err != nil {
+				return errors.Wrap(err, "failed to Send")
+			}
+
+			s.removeInFlight(result.ResultId)
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+
+	return nil
+}
+
+// GetStats returns Reactr's internal metrics
+func (s *Server) GetStats(ctx context.Context, req *pb.GetStatsRequest) (*pb.Stats, error) {
+	metrics := s.Metrics()
+
+	stats := &pb.Stats{
+		TotalThreadCount: int32(metrics.TotalThreadCount),
+		TotalJobCount:    int32(metrics.TotalJobCount),
+		Workers:          map[string]*pb.WorkerStats{},
+	}
+
+	for name, w := range metrics.Workers {
+		stats.Workers[name] = &pb.WorkerStats{
+			TargetThreadCount: int32(w.TargetThreadCount),
+			ThreadCount:       int32(w.ThreadCount),
+			JobCount:          int32(w.JobCount),
+			JobRate:           w.JobRate,
+		}
+	}
+
+	return stats, nil
+}
+
+// jobResult converts a job's result into its protobuf representation
+func jobResult(id string, data interface{}, err error) *pb.JobResult {
+	result := &pb.JobResult{
+		ResultId: id,
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+
+		runErr := &rt.RunErr{}
+		if errors.As(err, runErr) {
+			result.RunErr = &pb.RunErr{Code: int32(runErr.Code), Message: runErr.Message}
+		}
+
+		return result
+	}
+
+	if data == nil {
+		return result
+	}
+
+	// if result is bytes or a string, send that,
+	// if not, attempt to Marshal it from a struct
+	if bytes, isBytes := data.([]byte); isBytes {
+		result.Data = bytes
+	} else if str, isString := data.(string); isString {
+		result.Data = []byte(str)
+	} else {
+		resultJSON, err := json.Marshal(data)
+		if err != nil {
+			result.Error = errors.Wrap(err, "failed to Marshal job result").Error()
+		} else {
+			result.Data = resultJSON
+		}
+	}
+
+	return result
+}
+
+func (s *Server) addInFlight(r *rt.Result) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.inFlight[r.UUID()] = inFlightResult{result: r, expires: time.Now().Add(inFlightTTL)}
+}
+
+func (s *Server) getInFlight(id string) *rt.Result {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, ok := s.inFlight[id]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(r.expires) {
+		delete(s.inFlight, id)
+		return nil
+	}
+
+	return r.result
+}
+
+func (s *Server) removeInFlight(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.inFlight, id)
+}
+
+// hasInFlightRoom returns true if another result can wait to be streamed, removing any that have expired if there are too many
+func (s *Server) hasInFlightRoom() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.inFlight) < maxInFlight {
+		return true
+	}
+
+	now := time.Now()
+
+	for id, r := range s.inFlight {
+		if now.After(r.expires) {
+			delete(s.inFlight, id)
+		}
+	}
+
+	return len(s.inFlight) < maxInFlight
+}
@@ -0,0 +1,293 @@
+package rgrpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rgrpc/pb"
+	"github.com/suborbital/reactr/rt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type echo struct{}
+
+// Run runs an echo job
+func (e echo) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	if job.String() == "fail" {
+		return nil, rt.RunErr{Code: 400, Message: "failed"}
+	}
+
+	return job.Bytes(), nil
+}
+
+func (e echo) OnChange(change rt.ChangeEvent) error {
+	return nil
+}
+
+// wait is a Runnable whose jobs wait until release is closed
+type wait struct {
+	release chan struct{}
+}
+
+func (w wait) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	<-w.release
+
+	return job.Bytes(), nil
+}
+
+func (w wait) OnChange(change rt.ChangeEvent) error {
+	return nil
+}
+
+func setupClient(t *testing.T) (pb.ReactrClient, func()) {
+	_, client, done := setupServer(t)
+
+	return client, done
+}
+
+func setupServer(t *testing.T) (*Server, pb.ReactrClient, func()) {
+	server := New()
+	server.Register("echo", echo{})
+
+	lis := bufconn.Listen(1024 * 1024)
+	go server.Serve(lis)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Dial"))
+	}
+
+	return server, pb.NewReactrClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestSubmitJobAwait(t *testing.T) {
+	client, done := setupClient(t)
+	defer done()
+
+	resp, err := client.SubmitJob(context.Background(), &pb.SubmitJobRequest{JobType: "echo", Data: []byte("hello"), Await: true})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to SubmitJob"))
+	}
+
+	if string(resp.Result.Data) != "hello" {
+		t.Error("expected 'hello', got", string(resp.Result.Data))
+	}
+}
+
+func TestAwaitResultCancelled(t *testing.T) {
+	server := New()
+	server.Register("echo", echo{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// whichever of the result and the cancelled context is seen first, a result that is ready must not be dropped
+	for i := 0; i < 20; i++ {
+		res := server.Do(rt.NewJob("echo", []byte("hello")))
+
+		completed := make(chan struct{})
+		res.OnSuccess(func(interface{}) { close(completed) })
+		<-completed
+
+		result, err := awaitResult(ctx, res)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to awaitResult"))
+		}
+
+		if string(result.Data) != "hello" {
+			t.Errorf("expected hello, got %q", result.Data)
+		}
+	}
+
+	// without a result, the context's error is returned
+	release := make(chan struct{})
+	defer close(release)
+
+	server.Register("wait", wait{release: release})
+
+	if _, err := awaitResult(ctx, server.Do(rt.NewJob("wait", nil))); status.Code(err) != codes.Canceled {
+		t.Error("expected Canceled, got", err)
+	}
+}
+
+func TestSubmitJobUnregistered(t *testing.T) {
+	client, done := setupClient(t)
+	defer done()
+
+	if _, err := client.SubmitJob(context.Background(), &pb.SubmitJobRequest{JobType: "nope"}); err == nil {
+		t.Error("expected error, did not get one")
+	}
+}
+
+func TestStreamResults(t *testing.T) {
+	client, done := setupClient(t)
+	defer done()
+
+	ids := []string{}
+
+	for _, data := range []string{"first", "second", "fail"} {
+		resp, err := client.SubmitJob(context.Background(), &pb.SubmitJobRequest{JobType: "echo", Data: []byte(data)})
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to SubmitJob"))
+		}
+
+		ids = append(ids, resp.ResultId)
+	}
+
+	stream, err := client.StreamResults(context.Background(), &pb.StreamResultsRequest{ResultIds: ids})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to StreamResults"))
+	}
+
+	count := 0
+	runErrs := 0
+
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Recv"))
+		}
+
+		count++
+
+		if res.RunErr != nil {
+			runErrs++
+
+			if res.RunErr.Code != 400 {
+				t.Error("expected RunErr code 400, got", res.RunErr.Code)
+			}
+		}
+	}
+
+	if count != 3 {
+		t.Error("expected 3 results, got", count)
+	}
+
+	if runErrs != 1 {
+		t.Error("expected 1 RunErr, got", runErrs)
+	}
+}
+
+func TestStreamResultsCancelled(t *testing.T) {
+	server, client, done := setupServer(t)
+	defer done()
+
+	release := make(chan struct{})
+	server.Register("wait", wait{release: release})
+
+	resp, err := client.SubmitJob(context.Background(), &pb.SubmitJobRequest{JobType: "wait", Data: []byte("hello")})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to SubmitJob"))
+	}
+
+	ids := []string{resp.ResultId}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	stream, err := client.StreamResults(ctx, &pb.StreamResultsRequest{ResultIds: ids})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to StreamResults"))
+	}
+
+	cancel()
+
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Fatal("expected Canceled, got", err)
+	}
+
+	close(release)
+
+	// the result wasn't sent, so it can still be streamed
+	stream, err = client.StreamResults(context.Background(), &pb.StreamResultsRequest{ResultIds: ids})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to StreamResults"))
+	}
+
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Recv"))
+	}
+
+	if string(res.Data) != "hello" {
+		t.Error("expected 'hello', got", string(res.Data))
+	}
+
+	if _, err := stream.Recv(); err != io.EOF {
+		t.Error("expected EOF, got", err)
+	}
+
+	// once it has been sent, it can't be streamed again
+	stream, err = client.StreamResults(context.Background(), &pb.StreamResultsRequest{ResultIds: ids})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to StreamResults"))
+	}
+
+	if _, err := stream.Recv(); status.Code(err) != codes.NotFound {
+		t.Error("expected NotFound, got", err)
+	}
+}
+
+func TestInFlightExpiry(t *testing.T) {
+	server, client, done := setupServer(t)
+	defer done()
+
+	resp, err := client.SubmitJob(context.Background(), &pb.SubmitJobRequest{JobType: "echo", Data: []byte("hello")})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to SubmitJob"))
+	}
+
+	expired := time.Now().Add(-time.Second)
+
+	server.lock.Lock()
+
+	for id, r := range server.inFlight {
+		r.expires = expired
+		server.inFlight[id] = r
+	}
+
+	server.lock.Unlock()
+
+	stream, err := client.StreamResults(context.Background(), &pb.StreamResultsRequest{ResultIds: []string{resp.ResultId}})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to StreamResults"))
+	}
+
+	if _, err := stream.Recv(); status.Code(err) != codes.NotFound {
+		t.Error("expected NotFound for expired result, got", err)
+	}
+
+	// expired results are removed to make room for new ones once the server is full
+	server.lock.Lock()
+
+	for i := len(server.inFlight); i < maxInFlight; i++ {
+		server.inFlight[strconv.Itoa(i)] = inFlightResult{expires: expired}
+	}
+
+	server.lock.Unlock()
+
+	if _, err := client.SubmitJob(context.Background(), &pb.SubmitJobRequest{JobType: "echo", Data: []byte("hello")}); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to SubmitJob"))
+	}
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	if len(server.inFlight) != 1 {
+		t.Error("expected expired results to be removed, got", len(server.inFlight))
+	}
+}
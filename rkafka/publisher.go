@@ -0,0 +1,72 @@
+package rkafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// batchTimeout is how long the writer waits for more messages before sending a batch. Publish waits
+// for its message to be written, so this is kept short rather than using the writer's default of a second
+const batchTimeout = 10 * time.Millisecond
+
+// Publisher publishes messages to Kafka, using each message's topic as its Kafka topic.
+// It satisfies rcap.BrokerPublisher, so that Runnables can publish with the message broker capability
+type Publisher struct {
+	writer writer
+}
+
+// writer is the part of *kafka.Writer used by the Publisher
+type writer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// New returns a Publisher that writes to the Kafka cluster with the given broker addresses, waiting for each message
+// to be acknowledged by all of its partition's in-sync replicas. Topics must already exist, they aren't created
+func New(addrs ...string) *Publisher {
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(addrs...),
+		Balancer:     &kafka.Hash{},
+		BatchTimeout: batchTimeout,
+		RequiredAcks: kafka.RequireAll,
+	}
+
+	return NewWithWriter(w)
+}
+
+// NewWithWriter returns a Publisher that publishes with a configured writer, which must not have its Topic set
+// (since each message's topic is used) or be Async (since errors couldn't be returned). The writer is closed
+// when the Publisher is closed
+func NewWithWriter(w *kafka.Writer) *Publisher {
+	p := &Publisher{
+		writer: w,
+	}
+
+	return p
+}
+
+// Publish writes data to topic, and waits for it to be acknowledged, giving up once ctx is cancelled
+func (p *Publisher) Publish(ctx context.Context, topic string, data []byte) error {
+	msg := kafka.Message{
+		Topic: topic,
+		Value: data,
+	}
+
+	if err := p.writer.WriteMessages(ctx, msg); err != nil {
+		return errors.Wrap(err, "failed to WriteMessages")
+	}
+
+	return nil
+}
+
+// Close flushes any pending messages and closes the Publisher's writer
+func (p *Publisher) Close() error {
+	if err := p.writer.Close(); err != nil {
+		return errors.Wrap(err, "failed to Close writer")
+	}
+
+	return nil
+}
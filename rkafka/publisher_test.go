@@ -0,0 +1,49 @@
+package rkafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeWriter records the messages written to it
+type fakeWriter struct {
+	messages []kafka.Message
+	err      error
+}
+
+func (f *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if f.err != nil {
+		return f.err
+	}
+
+	f.messages = append(f.messages, msgs...)
+
+	return nil
+}
+
+func (f *fakeWriter) Close() error {
+	return nil
+}
+
+func TestPublish(t *testing.T) {
+	w := &fakeWriter{}
+
+	p := &Publisher{writer: w}
+
+	if err := p.Publish(context.Background(), "orders.created", []byte("order 42")); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Publish"))
+	}
+
+	if len(w.messages) != 1 || w.messages[0].Topic != "orders.created" || string(w.messages[0].Value) != "order 42" {
+		t.Errorf("expected 'order 42' to be written to orders.created, got %v", w.messages)
+	}
+
+	w.err = errors.New("leader not available")
+
+	if err := p.Publish(context.Background(), "orders.created", []byte("order 43")); err == nil {
+		t.Error("expected error when the write fails, did not get one")
+	}
+}
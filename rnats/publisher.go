@@ -0,0 +1,69 @@
+package rnats
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// flushTimeout is how long Publish waits for the server to receive a message when its context has no deadline
+const flushTimeout = 10 * time.Second
+
+// Publisher publishes messages to NATS, using each message's topic as its subject.
+// It satisfies rcap.BrokerPublisher, so that Runnables can publish with the message broker capability
+type Publisher struct {
+	conn conn
+}
+
+// conn is the part of *nats.Conn used by the Publisher
+type conn interface {
+	Publish(subject string, data []byte) error
+	FlushWithContext(ctx context.Context) error
+	Close()
+}
+
+// New connects to the NATS server at url and returns a Publisher, whose connection is closed when the Publisher is closed
+func New(url string, options ...nats.Option) (*Publisher, error) {
+	nc, err := nats.Connect(url, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Connect")
+	}
+
+	return NewWithConn(nc), nil
+}
+
+// NewWithConn returns a Publisher that publishes with an existing connection, which is closed when the Publisher is closed
+func NewWithConn(nc *nats.Conn) *Publisher {
+	p := &Publisher{
+		conn: nc,
+	}
+
+	return p
+}
+
+// Publish publishes data with topic as its subject, and waits for the server to receive it, giving up once ctx is cancelled
+func (p *Publisher) Publish(ctx context.Context, topic string, data []byte) error {
+	if err := p.conn.Publish(topic, data); err != nil {
+		return errors.Wrap(err, "failed to Publish")
+	}
+
+	// NATS can only flush with a context that has a deadline
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flushTimeout)
+		defer cancel()
+	}
+
+	if err := p.conn.FlushWithContext(ctx); err != nil {
+		return errors.Wrap(err, "failed to FlushWithContext")
+	}
+
+	return nil
+}
+
+// Close closes the Publisher's connection
+func (p *Publisher) Close() {
+	p.conn.Close()
+}
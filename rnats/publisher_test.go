@@ -0,0 +1,54 @@
+package rnats
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// fakeConn records what's published on it, and whether each flush had a deadline
+type fakeConn struct {
+	published map[string]string
+	flushErr  error
+	deadlines []bool
+}
+
+func (f *fakeConn) Publish(subject string, data []byte) error {
+	f.published[subject] = string(data)
+	return nil
+}
+
+func (f *fakeConn) FlushWithContext(ctx context.Context) error {
+	_, hasDeadline := ctx.Deadline()
+	f.deadlines = append(f.deadlines, hasDeadline)
+
+	return f.flushErr
+}
+
+func (f *fakeConn) Close() {}
+
+func TestPublish(t *testing.T) {
+	conn := &fakeConn{published: map[string]string{}}
+
+	p := &Publisher{conn: conn}
+
+	if err := p.Publish(context.Background(), "orders.created", []byte("order 42")); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Publish"))
+	}
+
+	if conn.published["orders.created"] != "order 42" {
+		t.Errorf("expected 'order 42' to be published to orders.created, got %v", conn.published)
+	}
+
+	// NATS can't flush without a deadline, so one is added
+	if len(conn.deadlines) != 1 || !conn.deadlines[0] {
+		t.Error("expected the message to be flushed with a deadline")
+	}
+
+	conn.flushErr = errors.New("timed out")
+
+	if err := p.Publish(context.Background(), "orders.created", []byte("order 43")); err == nil {
+		t.Error("expected error when the flush fails, did not get one")
+	}
+}
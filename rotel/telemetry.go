@@ -0,0 +1,273 @@
+package rotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	metricnoop "go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/suborbital/reactr/rt"
+)
+
+// instrumentationName is the name of the tracer and meter that Reactr's spans and metrics are recorded with
+const instrumentationName = "github.com/suborbital/reactr"
+
+// Attribute keys that are set on each job's span and metrics
+const (
+	AttrJobType    = attribute.Key("reactr.job.type")
+	AttrJobUUID    = attribute.Key("reactr.job.uuid")
+	AttrJobAttempt = attribute.Key("reactr.job.attempt")
+	AttrJobStatus  = attribute.Key("reactr.job.status")
+)
+
+// Config is configuration for exporting Reactr's traces and metrics to an OpenTelemetry collector with OTLP over HTTP.
+// Any settings that aren't set can be set with the standard OTEL_EXPORTER_OTLP_* environment variables instead
+type Config struct {
+	// ServiceName and ServiceVersion are the service.name and service.version resource attributes, and
+	// ServiceName is "reactr" if it's empty. Attributes are any other resource attributes, such as deployment.environment
+	ServiceName    string            `json:"serviceName" yaml:"serviceName"`
+	ServiceVersion string            `json:"serviceVersion,omitempty" yaml:"serviceVersion,omitempty"`
+	Attributes     map[string]string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+
+	// Endpoint is the host and port of the collector, such as localhost:4318, and Insecure sends data to it
+	// without TLS. Headers are sent with each export, such as for authentication
+	Endpoint string            `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Insecure bool              `json:"insecure,omitempty" yaml:"insecure,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+
+	// SampleRatio is the fraction of jobs that are traced (unless they're part of a trace that's already sampled), or all of them if it's 0
+	SampleRatio float64 `json:"sampleRatio,omitempty" yaml:"sampleRatio,omitempty"`
+
+	// MetricIntervalSeconds is how often metrics are exported, or every 60 seconds if it's 0
+	MetricIntervalSeconds int `json:"metricIntervalSeconds,omitempty" yaml:"metricIntervalSeconds,omitempty"`
+
+	DisableTraces  bool `json:"disableTraces,omitempty" yaml:"disableTraces,omitempty"`
+	DisableMetrics bool `json:"disableMetrics,omitempty" yaml:"disableMetrics,omitempty"`
+}
+
+// Telemetry records a span and metrics for each job of the Runnables it observes. It satisfies rt.JobObserver
+type Telemetry struct {
+	tracer   trace.Tracer
+	jobs     metric.Int64Counter
+	duration metric.Float64Histogram
+
+	// shutdown stops the providers that Setup created
+	shutdown []func(context.Context) error
+}
+
+// Setup creates Telemetry that exports traces and metrics with OTLP according to config. Shutdown
+// should be called before the program exits so that any spans and metrics that haven't been exported yet aren't lost
+func Setup(ctx context.Context, config Config) (*Telemetry, error) {
+	res, err := config.resource(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to resource.New")
+	}
+
+	var tracerProvider trace.TracerProvider = tracenoop.NewTracerProvider()
+	var meterProvider metric.MeterProvider = metricnoop.NewMeterProvider()
+
+	shutdown := []func(context.Context) error{}
+
+	if !config.DisableTraces {
+		exporter, err := otlptracehttp.New(ctx, config.traceOptions()...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to otlptracehttp.New")
+		}
+
+		sampler := sdktrace.AlwaysSample()
+		if config.SampleRatio > 0 {
+			sampler = sdktrace.TraceIDRatioBased(config.SampleRatio)
+		}
+
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithResource(res),
+			sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		)
+
+		tracerProvider = provider
+		shutdown = append(shutdown, provider.Shutdown)
+	}
+
+	if !config.DisableMetrics {
+		exporter, err := otlpmetrichttp.New(ctx, config.metricOptions()...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to otlpmetrichttp.New")
+		}
+
+		interval := time.Duration(config.MetricIntervalSeconds) * time.Second
+		if interval <= 0 {
+			interval = time.Minute
+		}
+
+		provider := sdkmetric.NewMeterProvider(
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))),
+			sdkmetric.WithResource(res),
+		)
+
+		meterProvider = provider
+		shutdown = append(shutdown, provider.Shutdown)
+	}
+
+	t, err := New(tracerProvider, meterProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	t.shutdown = shutdown
+
+	return t, nil
+}
+
+// New creates Telemetry that records spans and metrics with the application's own providers
+func New(tracerProvider trace.TracerProvider, meterProvider metric.MeterProvider) (*Telemetry, error) {
+	meter := meterProvider.Meter(instrumentationName)
+
+	jobs, err := meter.Int64Counter("reactr.jobs",
+		metric.WithDescription("Number of jobs run"),
+		metric.WithUnit("{job}"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Int64Counter")
+	}
+
+	duration, err := meter.Float64Histogram("reactr.job.duration",
+		metric.WithDescription("Time taken to run jobs"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Float64Histogram")
+	}
+
+	t := &Telemetry{
+		tracer:   tracerProvider.Tracer(instrumentationName),
+		jobs:     jobs,
+		duration: duration,
+	}
+
+	return t, nil
+}
+
+// Observe returns an rt.Option that records a span and metrics for each of a Runnable's jobs, such as
+// r.Register("fetch", runner, telemetry.Observe())
+func (t *Telemetry) Observe() rt.Option {
+	return rt.Observe(t)
+}
+
+// JobStarted starts the job's span, which becomes the parent of any spans created with the job's context
+func (t *Telemetry) JobStarted(ctx context.Context, job rt.Job) context.Context {
+	ctx, _ = t.tracer.Start(ctx, job.JobType(),
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(
+			AttrJobType.String(job.JobType()),
+			AttrJobUUID.String(job.UUID()),
+			AttrJobAttempt.Int(job.Attempt()),
+		),
+	)
+
+	return ctx
+}
+
+// JobFinished ends the job's span and records its metrics
+func (t *Telemetry) JobFinished(ctx context.Context, job rt.Job, err error, duration time.Duration) {
+	status := "ok"
+
+	span := trace.SpanFromContext(ctx)
+
+	if err != nil {
+		status = "error"
+
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+
+	attrs := metric.WithAttributes(AttrJobType.String(job.JobType()), AttrJobStatus.String(status))
+
+	t.jobs.Add(ctx, 1, attrs)
+	t.duration.Record(ctx, duration.Seconds(), attrs)
+}
+
+// Shutdown exports any spans and metrics that haven't been exported yet and stops the providers created by Setup
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	for _, shutdown := range t.shutdown {
+		if err := shutdown(ctx); err != nil {
+			return errors.Wrap(err, "failed to Shutdown")
+		}
+	}
+
+	return nil
+}
+
+// resource returns the resource that describes the service, including any attributes set with OTEL_RESOURCE_ATTRIBUTES
+func (c Config) resource(ctx context.Context) (*resource.Resource, error) {
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = "reactr"
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("service.name", serviceName)}
+
+	if c.ServiceVersion != "" {
+		attrs = append(attrs, attribute.String("service.version", c.ServiceVersion))
+	}
+
+	for key, value := range c.Attributes {
+		attrs = append(attrs, attribute.String(key, value))
+	}
+
+	return resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(attrs...),
+	)
+}
+
+func (c Config) traceOptions() []otlptracehttp.Option {
+	opts := []otlptracehttp.Option{}
+
+	if c.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(c.Endpoint))
+	}
+
+	if c.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	if len(c.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(c.Headers))
+	}
+
+	return opts
+}
+
+func (c Config) metricOptions() []otlpmetrichttp.Option {
+	opts := []otlpmetrichttp.Option{}
+
+	if c.Endpoint != "" {
+		opts = append(opts, otlpmetrichttp.WithEndpoint(c.Endpoint))
+	}
+
+	if c.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+
+	if len(c.Headers) > 0 {
+		opts = append(opts, otlpmetrichttp.WithHeaders(c.Headers))
+	}
+
+	return opts
+}
@@ -0,0 +1,96 @@
+package rotel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/suborbital/reactr/rt"
+)
+
+// spanChecker fails if the job's context doesn't carry its span, and returns an error if the job's data is "fail"
+type spanChecker struct{}
+
+func (s spanChecker) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	if !trace.SpanFromContext(ctx.Context()).SpanContext().IsValid() {
+		return nil, errors.New("job's context has no span")
+	}
+
+	if job.String() == "fail" {
+		return nil, errors.New("failed")
+	}
+
+	return "ok", nil
+}
+
+func (s spanChecker) OnChange(_ rt.ChangeEvent) error {
+	return nil
+}
+
+func TestTelemetry(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+
+	telemetry, err := New(
+		sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to New"))
+	}
+
+	r := rt.New()
+	r.Register("check", spanChecker{}, telemetry.Observe())
+
+	if _, err := r.Do(r.Job("check", "succeed")).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if _, err := r.Do(r.Job("check", "fail")).Then(); err == nil {
+		t.Fatal("expected error, did not get one")
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 2 {
+		t.Fatal("expected 2 spans, got", len(ended))
+	}
+
+	for i, code := range []codes.Code{codes.Unset, codes.Error} {
+		if ended[i].Name() != "check" || ended[i].Status().Code != code {
+			t.Errorf("expected span 'check' with status %s, got %q with status %s", code, ended[i].Name(), ended[i].Status().Code)
+		}
+	}
+
+	metrics := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &metrics); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Collect"))
+	}
+
+	jobs := map[string]int64{}
+
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != "reactr.jobs" {
+				continue
+			}
+
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				jobType, _ := point.Attributes.Value(AttrJobType)
+				status, _ := point.Attributes.Value(AttrJobStatus)
+
+				jobs[jobType.AsString()+"/"+status.AsString()] += point.Value
+			}
+		}
+	}
+
+	if jobs["check/ok"] != 1 || jobs["check/error"] != 1 {
+		t.Error("expected 1 successful and 1 failed job, got", jobs)
+	}
+}
@@ -0,0 +1,108 @@
+package rprom
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// StatsSource is anything that reports Wasm environment statistics, it is satisfied by *rwasm.Runner
+type StatsSource interface {
+	Stats() runtime.EnvironmentStats
+}
+
+// EnvironmentCollector is a Prometheus collector that reports the statistics of Wasm Runnables' environments.
+// Its metrics are about the Wasm runtime, and are separate from those about scheduling jobs
+type EnvironmentCollector struct {
+	sources map[string]StatsSource
+	lock    sync.RWMutex
+
+	instances      *prometheus.Desc
+	idleInstances  *prometheus.Desc
+	memory         *prometheus.Desc
+	memoryTotal    *prometheus.Desc
+	calls          *prometheus.Desc
+	callDuration   *prometheus.Desc
+	instantiations *prometheus.Desc
+	failures       *prometheus.Desc
+	traps          *prometheus.Desc
+	hostCalls      *prometheus.Desc
+}
+
+// NewEnvironmentCollector creates an EnvironmentCollector, which must be registered with a Prometheus registry
+func NewEnvironmentCollector() *EnvironmentCollector {
+	labels := []string{"job_type", "env"}
+
+	e := &EnvironmentCollector{
+		sources: map[string]StatsSource{},
+		lock:    sync.RWMutex{},
+
+		instances:      prometheus.NewDesc("reactr_wasm_instances", "Number of Wasm instances in the environment", labels, nil),
+		idleInstances:  prometheus.NewDesc("reactr_wasm_idle_instances", "Number of the environment's Wasm instances that are waiting for a job", labels, nil),
+		memory:         prometheus.NewDesc("reactr_wasm_memory_high_water_bytes", "Largest linear memory seen in any of the environment's instances", labels, nil),
+		memoryTotal:    prometheus.NewDesc("reactr_wasm_memory_bytes", "Total linear memory of the environment's instances", labels, nil),
+		calls:          prometheus.NewDesc("reactr_wasm_calls_total", "Number of jobs run by the environment's instances", labels, nil),
+		callDuration:   prometheus.NewDesc("reactr_wasm_call_duration_seconds_total", "Total time spent running jobs in the environment's instances", labels, nil),
+		instantiations: prometheus.NewDesc("reactr_wasm_instantiations_total", "Number of Wasm instances that have been built", labels, nil),
+		failures:       prometheus.NewDesc("reactr_wasm_instantiation_failures_total", "Number of times building a Wasm instance has failed", labels, nil),
+		traps:          prometheus.NewDesc("reactr_wasm_traps_total", "Number of jobs during which a Wasm instance trapped", labels, nil),
+		hostCalls:      prometheus.NewDesc("reactr_wasm_host_calls_total", "Number of calls the environment's instances have made to each host function", append(labels, "host_fn"), nil),
+	}
+
+	return e
+}
+
+// Add starts reporting the statistics of a Wasm Runnable registered as jobType
+func (e *EnvironmentCollector) Add(jobType string, source StatsSource) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.sources[jobType] = source
+}
+
+// Remove stops reporting the statistics for jobType
+func (e *EnvironmentCollector) Remove(jobType string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	delete(e.sources, jobType)
+}
+
+// Describe sends the descriptions of the collector's metrics
+func (e *EnvironmentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- e.instances
+	ch <- e.idleInstances
+	ch <- e.memory
+	ch <- e.memoryTotal
+	ch <- e.calls
+	ch <- e.callDuration
+	ch <- e.instantiations
+	ch <- e.failures
+	ch <- e.traps
+	ch <- e.hostCalls
+}
+
+// Collect sends the current statistics of each Runnable
+func (e *EnvironmentCollector) Collect(ch chan<- prometheus.Metric) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	for jobType, source := range e.sources {
+		stats := source.Stats()
+
+		ch <- prometheus.MustNewConstMetric(e.instances, prometheus.GaugeValue, float64(stats.Instances), jobType, stats.UUID)
+		ch <- prometheus.MustNewConstMetric(e.idleInstances, prometheus.GaugeValue, float64(stats.IdleInstances), jobType, stats.UUID)
+		ch <- prometheus.MustNewConstMetric(e.memory, prometheus.GaugeValue, float64(stats.MemoryHighWaterBytes), jobType, stats.UUID)
+		ch <- prometheus.MustNewConstMetric(e.memoryTotal, prometheus.GaugeValue, float64(stats.MemoryBytes), jobType, stats.UUID)
+		ch <- prometheus.MustNewConstMetric(e.calls, prometheus.CounterValue, float64(stats.Calls), jobType, stats.UUID)
+		ch <- prometheus.MustNewConstMetric(e.callDuration, prometheus.CounterValue, stats.TotalCallDuration.Seconds(), jobType, stats.UUID)
+		ch <- prometheus.MustNewConstMetric(e.instantiations, prometheus.CounterValue, float64(stats.Instantiations), jobType, stats.UUID)
+		ch <- prometheus.MustNewConstMetric(e.failures, prometheus.CounterValue, float64(stats.InstantiationFailures), jobType, stats.UUID)
+		ch <- prometheus.MustNewConstMetric(e.traps, prometheus.CounterValue, float64(stats.Traps), jobType, stats.UUID)
+
+		for hostFn, count := range stats.HostCalls {
+			ch <- prometheus.MustNewConstMetric(e.hostCalls, prometheus.CounterValue, float64(count), jobType, stats.UUID, hostFn)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package rprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+type fakeSource struct {
+	stats runtime.EnvironmentStats
+}
+
+func (f fakeSource) Stats() runtime.EnvironmentStats {
+	return f.stats
+}
+
+func TestEnvironmentCollector(t *testing.T) {
+	collector := NewEnvironmentCollector()
+
+	collector.Add("hello", fakeSource{runtime.EnvironmentStats{
+		UUID:                  "abc",
+		Instances:             2,
+		IdleInstances:         1,
+		MemoryHighWaterBytes:  65536,
+		MemoryBytes:           131072,
+		Calls:                 10,
+		TotalCallDuration:     time.Second * 3,
+		Instantiations:        3,
+		InstantiationFailures: 1,
+		Traps:                 2,
+		HostCalls:             map[string]uint64{"cache_get": 7, "fetch_url": 4},
+	}})
+
+	expected := `
+# HELP reactr_wasm_calls_total Number of jobs run by the environment's instances
+# TYPE reactr_wasm_calls_total counter
+reactr_wasm_calls_total{env="abc",job_type="hello"} 10
+# HELP reactr_wasm_call_duration_seconds_total Total time spent running jobs in the environment's instances
+# TYPE reactr_wasm_call_duration_seconds_total counter
+reactr_wasm_call_duration_seconds_total{env="abc",job_type="hello"} 3
+# HELP reactr_wasm_host_calls_total Number of calls the environment's instances have made to each host function
+# TYPE reactr_wasm_host_calls_total counter
+reactr_wasm_host_calls_total{env="abc",host_fn="cache_get",job_type="hello"} 7
+reactr_wasm_host_calls_total{env="abc",host_fn="fetch_url",job_type="hello"} 4
+# HELP reactr_wasm_idle_instances Number of the environment's Wasm instances that are waiting for a job
+# TYPE reactr_wasm_idle_instances gauge
+reactr_wasm_idle_instances{env="abc",job_type="hello"} 1
+# HELP reactr_wasm_instances Number of Wasm instances in the environment
+# TYPE reactr_wasm_instances gauge
+reactr_wasm_instances{env="abc",job_type="hello"} 2
+# HELP reactr_wasm_instantiations_total Number of Wasm instances that have been built
+# TYPE reactr_wasm_instantiations_total counter
+reactr_wasm_instantiations_total{env="abc",job_type="hello"} 3
+# HELP reactr_wasm_instantiation_failures_total Number of times building a Wasm instance has failed
+# TYPE reactr_wasm_instantiation_failures_total counter
+reactr_wasm_instantiation_failures_total{env="abc",job_type="hello"} 1
+# HELP reactr_wasm_memory_bytes Total linear memory of the environment's instances
+# TYPE reactr_wasm_memory_bytes gauge
+reactr_wasm_memory_bytes{env="abc",job_type="hello"} 131072
+# HELP reactr_wasm_memory_high_water_bytes Largest linear memory seen in any of the environment's instances
+# TYPE reactr_wasm_memory_high_water_bytes gauge
+reactr_wasm_memory_high_water_bytes{env="abc",job_type="hello"} 65536
+# HELP reactr_wasm_traps_total Number of jobs during which a Wasm instance trapped
+# TYPE reactr_wasm_traps_total counter
+reactr_wasm_traps_total{env="abc",job_type="hello"} 2
+`
+
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	collector.Remove("hello")
+
+	if count := testutil.CollectAndCount(collector); count != 0 {
+		t.Error("expected no metrics after Remove, got", count)
+	}
+}
@@ -0,0 +1,136 @@
+package rprom
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrMetricMismatch is returned when a metric is recorded as a different kind, or with different label names, than it was first recorded with
+var ErrMetricMismatch = errors.New("metric does not match the kind or labels it was first recorded with")
+
+// RunnableMetrics records the metrics that Runnables report with the metrics capability in a Prometheus registry.
+// It satisfies rcap.MetricsSink. Each metric is registered the first time it is recorded, and must always be recorded
+// as the same kind of metric with the same label names
+type RunnableMetrics struct {
+	registerer prometheus.Registerer
+	namespace  string
+
+	metrics map[string]runnableMetric
+	lock    sync.Mutex
+}
+
+type runnableMetric struct {
+	kind       string
+	labelNames []string
+	collector  prometheus.Collector
+}
+
+const (
+	kindCounter   = "counter"
+	kindGauge     = "gauge"
+	kindHistogram = "histogram"
+)
+
+// NewRunnableMetrics creates RunnableMetrics that registers metrics with registerer, with their names prefixed by namespace (if it's not empty)
+func NewRunnableMetrics(registerer prometheus.Registerer, namespace string) *RunnableMetrics {
+	r := &RunnableMetrics{
+		registerer: registerer,
+		namespace:  namespace,
+		metrics:    map[string]runnableMetric{},
+	}
+
+	return r
+}
+
+// CounterAdd adds a value to a counter
+func (r *RunnableMetrics) CounterAdd(name string, value float64, labels map[string]string) error {
+	collector, err := r.collector(kindCounter, name, labels)
+	if err != nil {
+		return err
+	}
+
+	collector.(*prometheus.CounterVec).With(labels).Add(value)
+
+	return nil
+}
+
+// GaugeSet sets a gauge
+func (r *RunnableMetrics) GaugeSet(name string, value float64, labels map[string]string) error {
+	collector, err := r.collector(kindGauge, name, labels)
+	if err != nil {
+		return err
+	}
+
+	collector.(*prometheus.GaugeVec).With(labels).Set(value)
+
+	return nil
+}
+
+// HistogramObserve observes a value in a histogram, which uses Prometheus' default buckets
+func (r *RunnableMetrics) HistogramObserve(name string, value float64, labels map[string]string) error {
+	collector, err := r.collector(kindHistogram, name, labels)
+	if err != nil {
+		return err
+	}
+
+	collector.(*prometheus.HistogramVec).With(labels).Observe(value)
+
+	return nil
+}
+
+// collector returns the collector for a metric, registering it if it's the first time it's been recorded
+func (r *RunnableMetrics) collector(kind, name string, labels map[string]string) (prometheus.Collector, error) {
+	labelNames := make([]string, 0, len(labels))
+	for label := range labels {
+		labelNames = append(labelNames, label)
+	}
+
+	sort.Strings(labelNames)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if existing, exists := r.metrics[name]; exists {
+		if existing.kind != kind || !equalStrings(existing.labelNames, labelNames) {
+			return nil, errors.Wrapf(ErrMetricMismatch, "metric %s", name)
+		}
+
+		return existing.collector, nil
+	}
+
+	var collector prometheus.Collector
+
+	switch kind {
+	case kindCounter:
+		collector = prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: r.namespace, Name: name, Help: "Counter recorded by a Runnable"}, labelNames)
+	case kindGauge:
+		collector = prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: r.namespace, Name: name, Help: "Gauge recorded by a Runnable"}, labelNames)
+	case kindHistogram:
+		collector = prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: r.namespace, Name: name, Help: "Histogram recorded by a Runnable"}, labelNames)
+	}
+
+	if err := r.registerer.Register(collector); err != nil {
+		return nil, errors.Wrap(err, "failed to Register")
+	}
+
+	r.metrics[name] = runnableMetric{kind: kind, labelNames: labelNames, collector: collector}
+
+	return collector, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
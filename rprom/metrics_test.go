@@ -0,0 +1,52 @@
+package rprom
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRunnableMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	metrics := NewRunnableMetrics(registry, "app")
+
+	labels := map[string]string{"job_type": "checkout", "region": "ca"}
+
+	if err := metrics.CounterAdd("orders_total", 2, labels); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to CounterAdd"))
+	}
+
+	if err := metrics.CounterAdd("orders_total", 1, labels); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to CounterAdd"))
+	}
+
+	if err := metrics.GaugeSet("queue_depth", 7, map[string]string{"job_type": "checkout"}); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to GaugeSet"))
+	}
+
+	expected := `
+# HELP app_orders_total Counter recorded by a Runnable
+# TYPE app_orders_total counter
+app_orders_total{job_type="checkout",region="ca"} 3
+# HELP app_queue_depth Gauge recorded by a Runnable
+# TYPE app_queue_depth gauge
+app_queue_depth{job_type="checkout"} 7
+`
+
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	// a metric must keep the kind and label names it was first recorded with
+	if err := metrics.GaugeSet("orders_total", 1, labels); !errors.Is(err, ErrMetricMismatch) {
+		t.Error("expected ErrMetricMismatch for a different kind, got", err)
+	}
+
+	if err := metrics.CounterAdd("orders_total", 1, map[string]string{"job_type": "checkout"}); !errors.Is(err, ErrMetricMismatch) {
+		t.Error("expected ErrMetricMismatch for different labels, got", err)
+	}
+}
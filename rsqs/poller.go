@@ -0,0 +1,218 @@
+package rsqs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// Client is the subset of the SQS API used by the Poller, it is satisfied by *sqs.Client
+type Client interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// Config is configuration for a Poller
+type Config struct {
+	QueueURL string
+	JobType  string
+
+	// MaxMessages is the number of messages requested per poll (1-10, default 10)
+	MaxMessages int32
+	// WaitTimeSeconds is the long-polling duration (0-20, default 20)
+	WaitTimeSeconds int32
+	// VisibilityTimeout is how long a message stays hidden from other consumers, and it is
+	// extended periodically for as long as the message's job is running (default 30)
+	VisibilityTimeout int32
+	// MaxInFlight limits the number of jobs running at once (default MaxMessages)
+	MaxInFlight int
+}
+
+// Poller receives messages from an SQS queue and turns them into Reactr jobs. Messages are
+// only deleted from the queue when their job succeeds, failed jobs' messages become visible again
+// once their visibility timeout expires, allowing the queue's redrive policy to handle them.
+type Poller struct {
+	reactr *rt.Reactr
+	log    *vlog.Logger
+	client Client
+	config Config
+
+	inFlight chan bool
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// New creates a new Poller that schedules jobs on the provided Reactr instance
+func New(r *rt.Reactr, log *vlog.Logger, client Client, config Config) *Poller {
+	if config.MaxMessages == 0 {
+		config.MaxMessages = 10
+	}
+
+	if config.WaitTimeSeconds == 0 {
+		config.WaitTimeSeconds = 20
+	}
+
+	if config.VisibilityTimeout == 0 {
+		config.VisibilityTimeout = 30
+	}
+
+	if config.MaxInFlight == 0 {
+		config.MaxInFlight = int(config.MaxMessages)
+	}
+
+	p := &Poller{
+		reactr:   r,
+		log:      log,
+		client:   client,
+		config:   config,
+		inFlight: make(chan bool, config.MaxInFlight),
+	}
+
+	return p
+}
+
+// Start begins polling the queue in the background
+func (p *Poller) Start() error {
+	if !p.reactr.IsRegistered(p.config.JobType) {
+		return errors.Errorf("jobType %s is not registered", p.config.JobType)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	p.wg.Add(1)
+
+	go func() {
+		defer p.wg.Done()
+
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err := p.poll(ctx); err != nil && ctx.Err() == nil {
+				p.log.Error(errors.Wrap(err, "failed to poll"))
+
+				// back off briefly so a persistent error doesn't spin
+				select {
+				case <-time.After(time.Second):
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop stops polling and waits for in-flight jobs to complete
+func (p *Poller) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+
+	p.wg.Wait()
+}
+
+func (p *Poller) poll(ctx context.Context) error {
+	// only request as many messages as there is room for
+	available := p.config.MaxInFlight - len(p.inFlight)
+	if available <= 0 {
+		// wait for an in-flight job to finish before polling again
+		select {
+		case p.inFlight <- true:
+			<-p.inFlight
+		case <-ctx.Done():
+		}
+
+		return nil
+	}
+
+	max := p.config.MaxMessages
+	if int32(available) < max {
+		max = int32(available)
+	}
+
+	out, err := p.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(p.config.QueueURL),
+		MaxNumberOfMessages: max,
+		WaitTimeSeconds:     p.config.WaitTimeSeconds,
+		VisibilityTimeout:   p.config.VisibilityTimeout,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to ReceiveMessage")
+	}
+
+	for i := range out.Messages {
+		msg := out.Messages[i]
+
+		p.inFlight <- true
+		p.wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-p.inFlight
+				p.wg.Done()
+			}()
+
+			p.handle(msg)
+		}()
+	}
+
+	return nil
+}
+
+func (p *Poller) handle(msg types.Message) {
+	body := []byte{}
+	if msg.Body != nil {
+		body = []byte(*msg.Body)
+	}
+
+	res := p.reactr.Do(rt.NewJob(p.config.JobType, body))
+
+	done := make(chan bool)
+	defer close(done)
+
+	// extend the message's visibility for as long as the job is running so that
+	// long-running jobs are not received again by another consumer mid-execution
+	go func() {
+		interval := time.Duration(p.config.VisibilityTimeout) * time.Second / 2
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := p.client.ChangeMessageVisibility(context.Background(), &sqs.ChangeMessageVisibilityInput{
+					QueueUrl:          aws.String(p.config.QueueURL),
+					ReceiptHandle:     msg.ReceiptHandle,
+					VisibilityTimeout: p.config.VisibilityTimeout,
+				}); err != nil {
+					p.log.Error(errors.Wrap(err, "failed to ChangeMessageVisibility"))
+				}
+			}
+		}
+	}()
+
+	if _, err := res.Then(); err != nil {
+		p.log.Error(errors.Wrapf(err, "job from SQS message %s returned error result", aws.ToString(msg.MessageId)))
+		return
+	}
+
+	if _, err := p.client.DeleteMessage(context.Background(), &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(p.config.QueueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	}); err != nil {
+		p.log.Error(errors.Wrap(err, "failed to DeleteMessage"))
+	}
+}
@@ -0,0 +1,108 @@
+package rsqs
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/vektor/vlog"
+)
+
+type fakeClient struct {
+	messages []types.Message
+	deleted  []string
+	lock     sync.Mutex
+}
+
+func (f *fakeClient) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	f.lock.Lock()
+	msgs := f.messages
+	f.messages = nil
+	f.lock.Unlock()
+
+	if len(msgs) == 0 {
+		// simulate long polling
+		select {
+		case <-time.After(time.Millisecond * 50):
+		case <-ctx.Done():
+		}
+	}
+
+	return &sqs.ReceiveMessageOutput{Messages: msgs}, nil
+}
+
+func (f *fakeClient) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.deleted = append(f.deleted, aws.ToString(params.ReceiptHandle))
+
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (f *fakeClient) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return &sqs.ChangeMessageVisibilityOutput{}, nil
+}
+
+type maybeFail struct{}
+
+// Run runs a maybeFail job
+func (m maybeFail) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	if job.String() == "fail" {
+		return nil, errors.New("failed")
+	}
+
+	return job.String(), nil
+}
+
+func (m maybeFail) OnChange(change rt.ChangeEvent) error {
+	return nil
+}
+
+func message(handle, body string) types.Message {
+	return types.Message{
+		MessageId:     aws.String(handle),
+		ReceiptHandle: aws.String(handle),
+		Body:          aws.String(body),
+	}
+}
+
+func TestPollerDeletesOnlySucceeded(t *testing.T) {
+	r := rt.New()
+	r.Register("maybe", maybeFail{})
+
+	client := &fakeClient{
+		messages: []types.Message{
+			message("one", "hello"),
+			message("two", "fail"),
+			message("three", "world"),
+		},
+	}
+
+	p := New(r, vlog.Default(), client, Config{QueueURL: "queue", JobType: "maybe"})
+	if err := p.Start(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Start"))
+	}
+
+	time.Sleep(time.Millisecond * 200)
+	p.Stop()
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	if len(client.deleted) != 2 {
+		t.Fatal("expected 2 deleted messages, got", len(client.deleted))
+	}
+
+	for _, d := range client.deleted {
+		if d == "two" {
+			t.Error("failed job's message should not have been deleted")
+		}
+	}
+}
@@ -108,3 +108,42 @@ func setupReactrWithCache() *Reactr {
 
 	return r
 }
+
+func TestCacheNamespaces(t *testing.T) {
+	r := New()
+
+	r.RegisterWithCaps("set-a", &setTester{}, r.DefaultCaps().WithCacheNamespace("a"))
+	r.RegisterWithCaps("get-a", &getTester{}, r.DefaultCaps().WithCacheNamespace("a"))
+	r.RegisterWithCaps("get-b", &getTester{}, r.DefaultCaps().WithCacheNamespace("b"))
+	r.RegisterWithCaps("get-shared", &getTester{}, r.DefaultCaps().WithCacheNamespace("c", "a"))
+
+	if _, err := r.Do(NewJob("set-a", "namespaced information")).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to set"))
+	}
+
+	val, err := r.Do(NewJob("get-a", "important")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get job failed"))
+	}
+
+	if val.(string) != "namespaced information" {
+		t.Error("result did not match expected 'namespaced information': ", val.(string))
+	}
+
+	if _, err := r.Do(NewJob("get-b", "important")).Then(); err == nil {
+		t.Error("should have errored, did not")
+	}
+
+	if _, err := r.Do(NewJob("get-b", "a::important")).Then(); err == nil {
+		t.Error("should have errored, did not")
+	}
+
+	val, err = r.Do(NewJob("get-shared", "a::important")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "get job failed"))
+	}
+
+	if val.(string) != "namespaced information" {
+		t.Error("result did not match expected 'namespaced information': ", val.(string))
+	}
+}
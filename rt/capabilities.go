@@ -13,11 +13,33 @@ type Capabilities struct {
 	config rcap.CapabilityConfig
 
 	Auth          rcap.AuthCapability
+	JWT           rcap.JWTCapability
+	OAuth2        rcap.OAuth2Capability
 	LoggerSource  rcap.LoggerCapability
 	HTTPClient    rcap.HTTPCapability
+	WebSocket     rcap.WebSocketCapability
 	GraphQLClient rcap.GraphQLCapability
+	GRPCClient    rcap.GRPCCapability
+	DNS           rcap.DNSCapability
+	Database      rcap.DatabaseCapability
+	Redis         rcap.RedisCapability
+	BlobStore     rcap.BlobCapability
+	Secrets       rcap.SecretsCapability
+	Configuration rcap.ConfigurationCapability
+	Crypto        rcap.CryptoCapability
+	Clock         rcap.ClockCapability
+	Grav          rcap.GravCapability
+	Metrics       rcap.MetricsCapability
+	Email         rcap.EmailCapability
+	MessageBroker rcap.MessageBrokerCapability
 	FileSource    rcap.FileCapability
+	Templates     rcap.TemplatesCapability
 	Cache         rcap.CacheCapability
+	Locks         rcap.LocksCapability
+	Policy        rcap.PolicyCapability
+	Limits        rcap.LimitsCapability
+	Timeouts      rcap.TimeoutsCapability
+	Audit         rcap.AuditCapability
 
 	// RequestHandler and doFunc are special because they are more
 	// sensitive; they could cause memory leaks or expose internal state,
@@ -32,14 +54,129 @@ func DefaultCapabilities(logger *vlog.Logger) Capabilities {
 }
 
 func CapabilitiesFromConfig(config rcap.CapabilityConfig) Capabilities {
+	// configs created before a capability existed don't enable it (other than the clock, below)
+	if config.WebSocket == nil {
+		config.WebSocket = &rcap.WebSocketConfig{}
+	}
+
+	if config.GRPC == nil {
+		config.GRPC = &rcap.GRPCConfig{}
+	}
+
+	if config.DNS == nil {
+		config.DNS = &rcap.DNSConfig{}
+	}
+
+	if config.Database == nil {
+		config.Database = &rcap.DatabaseConfig{}
+	}
+
+	if config.Redis == nil {
+		config.Redis = &rcap.RedisClientConfig{}
+	}
+
+	if config.Blob == nil {
+		config.Blob = &rcap.BlobConfig{}
+	}
+
+	if config.Secrets == nil {
+		config.Secrets = &rcap.SecretsConfig{}
+	}
+
+	if config.Configuration == nil {
+		config.Configuration = &rcap.ConfigurationConfig{}
+	}
+
+	if config.Crypto == nil {
+		config.Crypto = &rcap.CryptoConfig{}
+	}
+
+	if config.Grav == nil {
+		config.Grav = &rcap.GravConfig{}
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = &rcap.MetricsConfig{}
+	}
+
+	if config.Email == nil {
+		config.Email = &rcap.EmailConfig{}
+	}
+
+	if config.MessageBroker == nil {
+		config.MessageBroker = &rcap.MessageBrokerConfig{}
+	}
+
+	if config.JWT == nil {
+		config.JWT = &rcap.JWTConfig{}
+	}
+
+	if config.OAuth2 == nil {
+		config.OAuth2 = &rcap.OAuth2Config{}
+	}
+
+	if config.Locks == nil {
+		config.Locks = &rcap.LocksConfig{}
+	}
+
+	if config.Templates == nil {
+		config.Templates = &rcap.TemplatesConfig{}
+	}
+
+	if config.Policy == nil {
+		config.Policy = &rcap.PolicyConfig{}
+	}
+
+	if config.Limits == nil {
+		config.Limits = &rcap.LimitsConfig{}
+	}
+
+	if config.Timeouts == nil {
+		config.Timeouts = &rcap.TimeoutsConfig{}
+	}
+
+	if config.Audit == nil {
+		config.Audit = &rcap.AuditConfig{}
+	}
+
+	// the clock isn't sensitive, so it's enabled unless it's disabled explicitly
+	if config.Clock == nil {
+		config.Clock = &rcap.ClockConfig{Enabled: true}
+	}
+
+	fileSource := rcap.DefaultFileSource(*config.File)
+	cache := rcap.SetupCache(*config.Cache)
+
 	caps := Capabilities{
 		config:        config,
 		Auth:          rcap.DefaultAuthProvider(*config.Auth),
+		JWT:           rcap.DefaultJWT(*config.JWT),
+		OAuth2:        rcap.DefaultOAuth2(*config.OAuth2),
 		LoggerSource:  rcap.DefaultLoggerSource(*config.Logger),
 		HTTPClient:    rcap.DefaultHTTPClient(*config.HTTP),
+		WebSocket:     rcap.DefaultWebSocketClient(*config.WebSocket),
 		GraphQLClient: rcap.DefaultGraphQLClient(*config.GraphQL),
-		FileSource:    rcap.DefaultFileSource(*config.File),
-		Cache:         rcap.SetupCache(*config.Cache),
+		GRPCClient:    rcap.DefaultGRPCClient(*config.GRPC),
+		DNS:           rcap.DefaultDNS(*config.DNS),
+		Database:      rcap.DefaultDatabase(*config.Database),
+		Redis:         rcap.DefaultRedisClient(*config.Redis),
+		BlobStore:     rcap.DefaultBlobStore(*config.Blob),
+		Secrets:       rcap.DefaultSecrets(*config.Secrets),
+		Configuration: rcap.DefaultConfiguration(*config.Configuration),
+		Crypto:        rcap.DefaultCrypto(*config.Crypto),
+		Clock:         rcap.DefaultClock(*config.Clock),
+		Grav:          rcap.DefaultGrav(*config.Grav),
+		Metrics:       rcap.DefaultMetrics(*config.Metrics),
+		Email:         rcap.DefaultEmail(*config.Email),
+		MessageBroker: rcap.DefaultMessageBroker(*config.MessageBroker),
+		FileSource:    fileSource,
+		Templates:     rcap.DefaultTemplates(*config.Templates, fileSource),
+		Cache:         cache,
+		Locks:         rcap.DefaultLocks(*config.Locks, cache),
+		Policy:        rcap.DefaultPolicy(*config.Policy),
+		Limits:        rcap.DefaultLimits(*config.Limits),
+		Timeouts:      rcap.DefaultTimeouts(*config.Timeouts),
+		Audit:         rcap.DefaultAudit(*config.Audit),
 
 		// RequestHandler and doFunc don't get set here since they are set by
 		// the rt and rwasm internals; a better solution for this should probably be found
@@ -48,6 +185,30 @@ func CapabilitiesFromConfig(config rcap.CapabilityConfig) Capabilities {
 	return caps
 }
 
+// WithCacheNamespace returns a copy of the Capabilities whose cache stores its keys in namespace, isolating them from
+// the keys of other Runnables (or tenants) that share the same cache. Keys in the allowed namespaces can also be used
+// by prefixing them with the namespace and rcap.CacheNamespaceSeparator, such as shared::config
+func (c Capabilities) WithCacheNamespace(namespace string, allowed ...string) Capabilities {
+	c.Cache = rcap.NamespacedCache(c.Cache, namespace, allowed...)
+
+	// locks are stored in the cache, so they're namespaced along with it
+	if c.config.Locks != nil {
+		c.Locks = rcap.DefaultLocks(*c.config.Locks, c.Cache)
+	}
+
+	return c
+}
+
+// forRunnable returns a copy of the Capabilities for a Runnable that's being registered, which limits
+// how many of the shared database connections it can use at once if the config sets a limit
+func (c Capabilities) forRunnable() Capabilities {
+	if c.config.Database != nil && c.config.Database.MaxConnsPerRunnable > 0 && c.Database != nil {
+		c.Database = rcap.LimitedDatabase(c.Database, c.config.Database.MaxConnsPerRunnable)
+	}
+
+	return c
+}
+
 // Config returns the configuration that was used to create the Capabilities
 // the config cannot be changed, but it can be used to determine what was
 // previously set so that the orginal config (like enabled settings) can be respected
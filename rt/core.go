@@ -3,6 +3,7 @@ package rt
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/suborbital/vektor/vlog"
@@ -19,16 +20,20 @@ type core struct {
 	scaler *scaler
 	// watcher holds onto active Schedules and ensures they get executed
 	watcher *watcher
+	// routers split jobs between the versions registered for a jobType
+	routers map[string]*versionRouter
 
-	log  *vlog.Logger
-	lock sync.RWMutex
+	log        *vlog.Logger
+	lock       sync.RWMutex
+	reloadLock sync.Mutex
 }
 
 func newCore(log *vlog.Logger) *core {
 	c := &core{
-		scaler: newScaler(log),
-		log:    log,
-		lock:   sync.RWMutex{},
+		scaler:  newScaler(log),
+		routers: map[string]*versionRouter{},
+		log:     log,
+		lock:    sync.RWMutex{},
 	}
 
 	c.watcher = newWatcher(c.do)
@@ -39,15 +44,18 @@ func newCore(log *vlog.Logger) *core {
 func (c *core) do(job *Job) *Result {
 	result := newResult(job.UUID())
 
-	worker := c.scaler.findWorker(job.jobType)
+	worker := c.findWorker(job.jobType)
 	if worker == nil {
-		result.sendErr(fmt.Errorf("failed to getWorker for jobType %q", job.jobType))
+		result.sendErr(errors.Wrapf(ErrNoWorkerRegistered, "failed to getWorker for jobType %q", job.jobType))
 		return result
 	}
 
 	go func() {
 		job.result = result
 
+		// the job may have been scheduled before (such as by a Runnable passing on its own job), but it's queued again now
+		job.queuedAt = time.Time{}
+
 		worker.schedule(job)
 	}()
 
@@ -70,12 +78,259 @@ func (c *core) register(jobType string, runnable Runnable, caps Capabilities, op
 		c.scaler.startAutoscaler()
 	}
 
-	w := newWorker(runnable, caps, opts)
+	w := newWorker(runnable, caps.forRunnable(), opts)
 
 	c.scaler.addWorker(jobType, w)
 }
 
+// reload replaces the Runnable for a jobType, starting the new worker before switching to it
+// and then retiring the old worker once it has finished the jobs already sent to it. The new
+// worker is started without holding the core's lock, since starting it can take a while (such
+// as compiling a Wasm module) and other jobTypes need to keep being scheduled in the meantime.
+func (c *core) reload(jobType string, runnable Runnable) error {
+	// reloads are done one at a time so that the worker being replaced doesn't change underneath one
+	c.reloadLock.Lock()
+	defer c.reloadLock.Unlock()
+
+	old := c.scaler.findWorker(jobType)
+	if old == nil {
+		return errors.Wrapf(ErrNoWorkerRegistered, "jobType %q", jobType)
+	}
+
+	w := newWorker(runnable, old.capabilities(), old.options)
+
+	threadCount := old.metrics().ThreadCount
+	if threadCount < old.options.minThreadCount() {
+		threadCount = old.options.minThreadCount()
+	}
+
+	// start the new worker's threads so that the Runnable can provision
+	// its resources (such as Wasm instances) before receiving any jobs
+	if err := w.setThreadCount(threadCount); err != nil {
+		w.stop()
+		return errors.Wrap(err, "failed to start new worker")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// the jobType may have been deregistered or had a version promoted while the new worker was starting
+	if current := c.scaler.findWorker(jobType); current != old {
+		w.stop()
+		return errors.Wrapf(ErrNoWorkerRegistered, "jobType %q was replaced while reloading", jobType)
+	}
+
+	// the Capabilities may also have been updated while it was starting
+	w.setCapabilities(old.capabilities())
+
+	replaced, err := c.scaler.replaceWorker(jobType, w)
+	if err != nil {
+		w.stop()
+		return errors.Wrap(err, "failed to replaceWorker")
+	}
+
+	go func() {
+		if err := replaced.retire(w); err != nil {
+			c.log.Error(errors.Wrapf(err, "failed to retire %s worker", jobType))
+		}
+	}()
+
+	return nil
+}
+
+// updateCaps replaces the Capabilities of a jobType's worker, and of the workers for each of its versions
+func (c *core) updateCaps(jobType string, caps Capabilities) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	w := c.scaler.findWorker(jobType)
+	if w == nil {
+		return errors.Wrapf(ErrNoWorkerRegistered, "jobType %q", jobType)
+	}
+
+	w.setCapabilities(caps.forRunnable())
+
+	if router, exists := c.routers[jobType]; exists {
+		for _, version := range router.list() {
+			if vw := c.scaler.findVersion(jobType, version); vw != nil {
+				vw.setCapabilities(caps.forRunnable())
+			}
+		}
+	}
+
+	return nil
+}
+
+// findWorker finds the worker for a jobType, choosing between its versions if it has any
+func (c *core) findWorker(jobType string) *worker {
+	c.lock.RLock()
+	router := c.routers[jobType]
+	c.lock.RUnlock()
+
+	if router != nil {
+		if version := router.pick(); version != "" {
+			if w := c.scaler.findVersion(jobType, version); w != nil {
+				return w
+			}
+		}
+	}
+
+	return c.scaler.findWorker(jobType)
+}
+
+// registerVersion adds a canary version of the Runnable for a jobType, which receives weight percent of its jobs
+func (c *core) registerVersion(jobType, version string, runnable Runnable, weight int, caps Capabilities, options ...Option) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if version == "" {
+		return errors.New("version must not be empty")
+	}
+
+	if c.scaler.findWorker(jobType) == nil {
+		return errors.Wrapf(ErrNoWorkerRegistered, "jobType %q", jobType)
+	}
+
+	router, exists := c.routers[jobType]
+	if !exists {
+		router = newVersionRouter()
+	}
+
+	if router.has(version) {
+		return fmt.Errorf("version %s of jobType %q is already registered", version, jobType)
+	}
+
+	opts := defaultOpts(jobType)
+	for _, o := range options {
+		opts = o(opts)
+	}
+
+	if opts.autoscaleMax > opts.poolSize {
+		c.scaler.startAutoscaler()
+	}
+
+	// register the worker before routing any jobs to it
+	c.scaler.addVersion(jobType, version, newWorker(runnable, caps.forRunnable(), opts))
+
+	if err := router.setWeight(version, weight); err != nil {
+		c.scaler.removeVersion(jobType, version)
+		return errors.Wrap(err, "failed to setWeight")
+	}
+
+	c.routers[jobType] = router
+
+	return nil
+}
+
+// setVersionWeight changes the percentage of a jobType's jobs that a version receives
+func (c *core) setVersionWeight(jobType, version string, weight int) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	router, exists := c.routers[jobType]
+	if !exists || !router.has(version) {
+		return errors.Wrapf(ErrNoWorkerRegistered, "version %s of jobType %q", version, jobType)
+	}
+
+	return router.setWeight(version, weight)
+}
+
+// promote makes a version the default Runnable for its jobType, retiring the previous default
+func (c *core) promote(jobType, version string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	router, exists := c.routers[jobType]
+	if !exists || !router.has(version) {
+		return errors.Wrapf(ErrNoWorkerRegistered, "version %s of jobType %q", version, jobType)
+	}
+
+	// check for the default worker before anything is changed, so the version is left as it was if there isn't one
+	if c.scaler.findWorker(jobType) == nil {
+		return errors.Wrapf(ErrNoWorkerRegistered, "jobType %q", jobType)
+	}
+
+	promoted := c.scaler.takeVersion(jobType, version)
+	if promoted == nil {
+		return errors.Wrapf(ErrNoWorkerRegistered, "worker for version %s of jobType %q", version, jobType)
+	}
+
+	router.remove(version)
+
+	if router.empty() {
+		delete(c.routers, jobType)
+	}
+
+	replaced, err := c.scaler.replaceWorker(jobType, promoted)
+	if err != nil {
+		// the default worker was removed in the meantime, so nothing can receive the promoted worker's jobs
+		promoted.stop()
+		return errors.Wrap(err, "failed to replaceWorker")
+	}
+
+	go func() {
+		if err := replaced.retire(promoted); err != nil {
+			c.log.Error(errors.Wrapf(err, "failed to retire %s worker", jobType))
+		}
+	}()
+
+	return nil
+}
+
+// rollback removes a version of a jobType, sending any jobs it had queued to the default Runnable
+func (c *core) rollback(jobType, version string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	router, exists := c.routers[jobType]
+	if !exists || !router.has(version) {
+		return errors.Wrapf(ErrNoWorkerRegistered, "version %s of jobType %q", version, jobType)
+	}
+
+	// stop routing jobs to the version before retiring it
+	router.remove(version)
+
+	if router.empty() {
+		delete(c.routers, jobType)
+	}
+
+	removed := c.scaler.takeVersion(jobType, version)
+	if removed == nil {
+		return nil
+	}
+
+	defaultWorker := c.scaler.findWorker(jobType)
+	if defaultWorker == nil {
+		return removed.stop()
+	}
+
+	go func() {
+		if err := removed.retire(defaultWorker); err != nil {
+			c.log.Error(errors.Wrapf(err, "failed to retire worker for version %s of %s", version, jobType))
+		}
+	}()
+
+	return nil
+}
+
 func (c *core) deRegister(jobType string) error {
+	c.lock.Lock()
+	router := c.routers[jobType]
+	delete(c.routers, jobType)
+	c.lock.Unlock()
+
+	if router != nil {
+		router.lock.RLock()
+		versions := append([]string{}, router.versions...)
+		router.lock.RUnlock()
+
+		for _, version := range versions {
+			if err := c.scaler.removeVersion(jobType, version); err != nil {
+				return errors.Wrap(err, "failed to removeVersion")
+			}
+		}
+	}
+
 	if err := c.scaler.removeWorker(jobType); err != nil {
 		return errors.Wrap(err, "failed to removeWorker")
 	}
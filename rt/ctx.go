@@ -1,6 +1,10 @@
 package rt
 
 import (
+	"context"
+	"io"
+	"sync/atomic"
+
 	"github.com/suborbital/reactr/rcap"
 	"github.com/suborbital/reactr/request"
 )
@@ -8,16 +12,126 @@ import (
 // Ctx is a Job context
 type Ctx struct {
 	*Capabilities
+
+	context context.Context
+	jobType string
+	jobUUID string
+	tenant  string
+	attempt int
+	depth   int
+	meta    map[string]string
+	stream  io.Writer
+
+	// hostCall is the name of the host function that the Runnable is calling, if any
+	hostCall *atomic.Value
 }
 
 func newCtx(caps *Capabilities) *Ctx {
 	c := &Ctx{
 		Capabilities: caps,
+		context:      context.Background(),
+		hostCall:     &atomic.Value{},
 	}
 
 	return c
 }
 
+// Context returns the job's context.Context, which is cancelled if the job times out
+func (c *Ctx) Context() context.Context {
+	if c == nil || c.context == nil {
+		return context.Background()
+	}
+
+	return c.context
+}
+
+// JobType returns the type of the job being run
+func (c *Ctx) JobType() string {
+	if c == nil {
+		return ""
+	}
+
+	return c.jobType
+}
+
+// JobUUID returns the UUID of the job being run
+func (c *Ctx) JobUUID() string {
+	if c == nil {
+		return ""
+	}
+
+	return c.jobUUID
+}
+
+// Tenant returns the tenant of the job being run (see Job.Tenant), which is the
+// tenant that its Capabilities were derived for and that its events are recorded with
+func (c *Ctx) Tenant() string {
+	if c == nil {
+		return ""
+	}
+
+	return c.tenant
+}
+
+// Attempt returns the attempt number of the job being run, counting from 1
+func (c *Ctx) Attempt() int {
+	if c == nil || c.attempt == 0 {
+		return 1
+	}
+
+	return c.attempt
+}
+
+// Depth returns the number of jobs that the job being run is nested in, which is 0 unless it was run with another job's Ctx.Do
+func (c *Ctx) Depth() int {
+	if c == nil {
+		return 0
+	}
+
+	return c.depth
+}
+
+// JobMeta returns a metadata value set on the job being run with Job.WithMeta, and whether it was set
+func (c *Ctx) JobMeta(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	val, exists := c.meta[key]
+
+	return val, exists
+}
+
+// Stream returns the writer set on the job being run with Job.WithStream, or nil if its caller isn't streaming output
+func (c *Ctx) Stream() io.Writer {
+	if c == nil {
+		return nil
+	}
+
+	return c.stream
+}
+
+// SetHostCall records the host function (or other external call) that the Runnable is making, which is reported if the job
+// is slow (see SlowJobThreshold). It should be called with "" once the call returns
+func (c *Ctx) SetHostCall(name string) {
+	if c == nil || c.hostCall == nil {
+		return
+	}
+
+	c.hostCall.Store(name)
+}
+
+// HostCall returns the host function that the Runnable is calling, or "" if it isn't calling one
+func (c *Ctx) HostCall() string {
+	if c == nil || c.hostCall == nil {
+		return ""
+	}
+
+	name, _ := c.hostCall.Load().(string)
+
+	return name
+}
+
 // Do runs a new job
 func (c *Ctx) Do(job Job) *Result {
 	if c.doFunc == nil {
@@ -26,8 +140,10 @@ func (c *Ctx) Do(job Job) *Result {
 		return r
 	}
 
-	// set the same capabilities as the Job who called Do
+	// set the same capabilities (and so the same tenant) as the Job who called Do, and nest the job within it
 	job.caps = c.Capabilities
+	job.tenant = c.tenant
+	job.depth = c.depth + 1
 
 	return c.doFunc(&job)
 }
@@ -0,0 +1,150 @@
+package rt
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// JobEventType is the type of a JobEvent
+type JobEventType string
+
+// JobEventQueued and others are the types of JobEvent
+const (
+	JobEventQueued    JobEventType = "queued"    // the job was scheduled
+	JobEventRetried   JobEventType = "retried"   // the job was scheduled again after it failed (see Job.Retry)
+	JobEventStarted   JobEventType = "started"   // the job started running
+	JobEventFailed    JobEventType = "failed"    // the job returned an error, timed out or couldn't be scheduled
+	JobEventCompleted JobEventType = "completed" // the job returned a result
+)
+
+// JobEvent is a structured record of something that happened to a job
+type JobEvent struct {
+	Type    JobEventType      `json:"type"`
+	Time    time.Time         `json:"time"`
+	JobType string            `json:"jobType"`
+	JobUUID string            `json:"jobUUID"`
+	Attempt int               `json:"attempt"`
+	Tenant  string            `json:"tenant,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+
+	// QueuedMillis is how long the job waited to start after it was scheduled, and DurationMillis
+	// is how long it ran for. They're set on started, failed and completed events
+	QueuedMillis   float64 `json:"queuedMillis,omitempty"`
+	DurationMillis float64 `json:"durationMillis,omitempty"`
+
+	// Error is the error that the job failed with
+	Error string `json:"error,omitempty"`
+}
+
+// JobEventSink receives events for each of a Runnable's jobs. JobEvent is called from the goroutines that
+// schedule and run jobs, so it must be safe to call concurrently and shouldn't block
+type JobEventSink interface {
+	JobEvent(event JobEvent)
+}
+
+// EventSink returns an Option that sends events to sink as each of the Runnable's jobs is queued, started and finished
+func EventSink(sink JobEventSink) Option {
+	return func(opts workerOpts) workerOpts {
+		opts.eventSinks = append(opts.eventSinks, sink)
+		return opts
+	}
+}
+
+// newJobEvent creates an event of eventType for job
+func newJobEvent(eventType JobEventType, job *Job) JobEvent {
+	e := JobEvent{
+		Type:    eventType,
+		Time:    time.Now(),
+		JobType: job.jobType,
+		JobUUID: job.uuid,
+		Attempt: job.Attempt(),
+		Tenant:  job.tenant,
+		Meta:    job.meta,
+	}
+
+	return e
+}
+
+// millis returns d in milliseconds
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// sendJobEvent sends event to each of the sinks
+func sendJobEvent(sinks []JobEventSink, event JobEvent) {
+	for _, s := range sinks {
+		s.JobEvent(event)
+	}
+}
+
+// JSONEventLog is a JobEventSink that writes each event as a line of JSON
+type JSONEventLog struct {
+	writer io.Writer
+	closer io.Closer
+	err    error
+	lock   sync.Mutex
+}
+
+// NewJSONEventLog creates a JSONEventLog that writes events to w
+func NewJSONEventLog(w io.Writer) *JSONEventLog {
+	j := &JSONEventLog{
+		writer: w,
+	}
+
+	return j
+}
+
+// OpenJSONEventLog creates a JSONEventLog that appends events to the file at path, creating it if it doesn't exist
+func OpenJSONEventLog(path string) (*JSONEventLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to OpenFile")
+	}
+
+	j := NewJSONEventLog(file)
+	j.closer = file
+
+	return j, nil
+}
+
+// JobEvent writes an event. If writing fails, no more events are written and Close returns the error
+func (j *JSONEventLog) JobEvent(event JobEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	line = append(line, '\n')
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.err != nil {
+		return
+	}
+
+	if _, err := j.writer.Write(line); err != nil {
+		j.err = errors.Wrap(err, "failed to Write")
+	}
+}
+
+// Close closes the file opened by OpenJSONEventLog, and returns the error that stopped events from being written, if any
+func (j *JSONEventLog) Close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.closer != nil {
+		if err := j.closer.Close(); err != nil && j.err == nil {
+			j.err = errors.Wrap(err, "failed to Close")
+		}
+
+		j.closer = nil
+	}
+
+	return j.err
+}
@@ -0,0 +1,106 @@
+package rt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// failOnce fails the first attempt of each job
+type failOnce struct{}
+
+func (f failOnce) Run(job Job, ctx *Ctx) (interface{}, error) {
+	if job.Attempt() == 1 {
+		return nil, errors.New("first attempt failed")
+	}
+
+	return "ok", nil
+}
+
+func (f failOnce) OnChange(_ ChangeEvent) error {
+	return nil
+}
+
+func TestJSONEventLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	log, err := OpenJSONEventLog(path)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to OpenJSONEventLog"))
+	}
+
+	r := New()
+	r.Register("flaky", failOnce{}, EventSink(log))
+
+	job := r.Job("flaky", nil).WithMeta("correlation-id", "abc")
+
+	if _, err := r.Do(job).Then(); err == nil {
+		t.Fatal("expected error, did not get one")
+	}
+
+	if _, err := r.Do(job.Retry()).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if err := log.Close(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Close"))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ReadFile"))
+	}
+
+	events := []JobEvent{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		event := JobEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Unmarshal"))
+		}
+
+		events = append(events, event)
+	}
+
+	expected := []struct {
+		eventType JobEventType
+		attempt   int
+	}{
+		{JobEventQueued, 1},
+		{JobEventStarted, 1},
+		{JobEventFailed, 1},
+		{JobEventRetried, 2},
+		{JobEventStarted, 2},
+		{JobEventCompleted, 2},
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %s", len(expected), len(events), data)
+	}
+
+	for i, e := range expected {
+		event := events[i]
+
+		if event.Type != e.eventType || event.Attempt != e.attempt || event.JobType != "flaky" || event.JobUUID != job.UUID() {
+			t.Errorf("expected %s event for attempt %d, got %+v", e.eventType, e.attempt, event)
+		}
+
+		if event.Meta["correlation-id"] != "abc" {
+			t.Error("expected correlation-id meta, got", event.Meta)
+		}
+	}
+
+	if events[2].Error != "first attempt failed" {
+		t.Error("expected failed event to have the job's error, got", events[2].Error)
+	}
+
+	if events[5].DurationMillis <= 0 {
+		t.Error("expected completed event to have a duration, got", events[5].DurationMillis)
+	}
+}
@@ -3,6 +3,8 @@ package rt
 import (
 	"encoding/json"
 	"errors"
+	"io"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/suborbital/reactr/request"
@@ -15,6 +17,20 @@ type Job struct {
 	result  *Result
 	data    interface{}
 
+	// attempt is the job's attempt number, counting from 1, and meta is caller-supplied metadata such as correlation IDs
+	attempt int
+	meta    map[string]string
+
+	// stream receives output that the Runnable writes before it returns its result
+	stream io.Writer
+
+	// tenant is found when the job is scheduled (see Tenant), and queuedAt is when it was scheduled
+	tenant   string
+	queuedAt time.Time
+
+	// depth is the number of jobs that the job is nested in, counting jobs run with Ctx.Do
+	depth int
+
 	caps *Capabilities
 	req  *request.CoordinatedRequest
 }
@@ -25,6 +41,7 @@ func NewJob(jobType string, data interface{}) Job {
 		uuid:    uuid.New().String(),
 		jobType: jobType,
 		data:    data,
+		attempt: 1,
 	}
 
 	// detect the coordinated request
@@ -39,6 +56,62 @@ func (j Job) UUID() string {
 	return j.uuid
 }
 
+// JobType returns the type of the job, which is the name its Runnable was registered with
+func (j Job) JobType() string {
+	return j.jobType
+}
+
+// Tenant returns the tenant that the job belongs to, which is found when the job is scheduled if its Runnable was
+// registered with TenantCaps (or inherited from the job that ran it with Ctx.Do), and "" otherwise
+func (j Job) Tenant() string {
+	return j.tenant
+}
+
+// Attempt returns the job's attempt number, which is 1 unless the job was created with Retry
+func (j Job) Attempt() int {
+	if j.attempt == 0 {
+		return 1
+	}
+
+	return j.attempt
+}
+
+// Retry returns a copy of the job to be run again after it failed, with the same UUID and metadata and the next attempt number
+func (j Job) Retry() Job {
+	j.attempt = j.Attempt() + 1
+	j.result = nil
+
+	return j
+}
+
+// WithMeta returns a copy of the job with a metadata value set, which the Runnable can read while it runs the job
+func (j Job) WithMeta(key, value string) Job {
+	meta := make(map[string]string, len(j.meta)+1)
+	for k, v := range j.meta {
+		meta[k] = v
+	}
+
+	meta[key] = value
+	j.meta = meta
+
+	return j
+}
+
+// Meta returns a metadata value set with WithMeta, and whether it was set
+func (j Job) Meta(key string) (string, bool) {
+	val, exists := j.meta[key]
+
+	return val, exists
+}
+
+// WithStream returns a copy of the job that streams output to w as the Runnable writes it, such as an http.ResponseWriter
+// for server-sent events or large files. If w is an http.Flusher, it is flushed after each write from a Wasm Runnable
+func (j Job) WithStream(w io.Writer) Job {
+	j.stream = w
+
+	return j
+}
+
 // Unmarshal unmarshals the job's data into a struct
 func (j Job) Unmarshal(target interface{}) error {
 	if bytes, ok := j.data.([]byte); ok {
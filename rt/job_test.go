@@ -17,3 +17,35 @@ func TestCreateJob(t *testing.T) {
 		t.Error("job's result should be empty, is not")
 	}
 }
+
+func TestJobMeta(t *testing.T) {
+	job := NewJob("test", nil).WithMeta("correlation-id", "abc123")
+	withTenant := job.WithMeta("tenant", "acme")
+
+	if val, exists := job.Meta("correlation-id"); !exists || val != "abc123" {
+		t.Errorf("expected correlation-id to be abc123, got %q", val)
+	}
+
+	// setting metadata on a copy doesn't change the original job
+	if _, exists := job.Meta("tenant"); exists {
+		t.Error("expected tenant not to be set on the original job")
+	}
+
+	if val, _ := withTenant.Meta("tenant"); val != "acme" {
+		t.Errorf("expected tenant to be acme, got %q", val)
+	}
+
+	retry := withTenant.Retry()
+
+	if job.Attempt() != 1 || retry.Attempt() != 2 {
+		t.Errorf("expected attempts 1 and 2, got %d and %d", job.Attempt(), retry.Attempt())
+	}
+
+	if retry.UUID() != job.UUID() {
+		t.Error("expected the retry to have the same UUID")
+	}
+
+	if val, _ := retry.Meta("correlation-id"); val != "abc123" {
+		t.Errorf("expected the retry to keep its metadata, got %q", val)
+	}
+}
@@ -0,0 +1,44 @@
+package rt
+
+import (
+	"context"
+	"time"
+)
+
+// JobObserver is notified when each of a Runnable's jobs starts and finishes running, such as to trace or time them
+type JobObserver interface {
+	// JobStarted is called before a job runs, and the context it returns (derived from ctx) becomes the job's
+	// context (see Ctx.Context), so that it can carry values such as a tracing span to the Runnable
+	JobStarted(ctx context.Context, job Job) context.Context
+
+	// JobFinished is called after a job has run, with the context returned by JobStarted, the
+	// error the job returned (or nil if it succeeded) and how long it ran for
+	JobFinished(ctx context.Context, job Job, err error, duration time.Duration)
+}
+
+// Observe returns an Option that notifies observer when each of the Runnable's jobs starts and finishes.
+// Observers are called in the order they were added when jobs start, and in reverse order when they finish
+func Observe(observer JobObserver) Option {
+	return func(opts workerOpts) workerOpts {
+		opts.observers = append(opts.observers, observer)
+		return opts
+	}
+}
+
+// jobStarted calls each observer's JobStarted, returning the context that the job should run with
+func jobStarted(observers []JobObserver, job Job) context.Context {
+	ctx := context.Background()
+
+	for _, o := range observers {
+		ctx = o.JobStarted(ctx, job)
+	}
+
+	return ctx
+}
+
+// jobFinished calls each observer's JobFinished
+func jobFinished(observers []JobObserver, ctx context.Context, job Job, err error, duration time.Duration) {
+	for i := len(observers) - 1; i >= 0; i-- {
+		observers[i].JobFinished(ctx, job, err, duration)
+	}
+}
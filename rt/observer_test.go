@@ -0,0 +1,85 @@
+package rt
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type observerKey struct{}
+
+// recordingObserver records the calls made to it, and adds its name to the job's context
+type recordingObserver struct {
+	name  string
+	calls *[]string
+	lock  *sync.Mutex
+}
+
+func (o recordingObserver) JobStarted(ctx context.Context, job Job) context.Context {
+	o.record("start " + o.name)
+
+	return context.WithValue(ctx, observerKey{}, o.name)
+}
+
+func (o recordingObserver) JobFinished(ctx context.Context, job Job, err error, duration time.Duration) {
+	o.record("finish " + o.name + " " + ctx.Value(observerKey{}).(string))
+}
+
+func (o recordingObserver) record(call string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	*o.calls = append(*o.calls, call)
+}
+
+// contextValue returns the value that the observers added to the job's context
+type contextValue struct{}
+
+func (c contextValue) Run(job Job, ctx *Ctx) (interface{}, error) {
+	return ctx.Context().Value(observerKey{}), nil
+}
+
+func (c contextValue) OnChange(_ ChangeEvent) error {
+	return nil
+}
+
+func TestObserve(t *testing.T) {
+	r := New()
+
+	calls := []string{}
+	lock := &sync.Mutex{}
+
+	first := recordingObserver{"first", &calls, lock}
+	second := recordingObserver{"second", &calls, lock}
+
+	r.Register("observed", contextValue{}, Observe(first), Observe(second), TimeoutSeconds(1))
+
+	value, err := r.Do(r.Job("observed", nil)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if value.(string) != "second" {
+		t.Error("expected job's context to come from the last observer, got", value)
+	}
+
+	// the result is sent once the observers have finished
+	expected := []string{"start first", "start second", "finish second second", "finish first second"}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(calls) != len(expected) {
+		t.Fatal("expected calls", expected, "got", calls)
+	}
+
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Error("expected calls", expected, "got", calls)
+			break
+		}
+	}
+}
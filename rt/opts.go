@@ -51,9 +51,25 @@ func MaxRetries(count int) Option {
 
 // PreWarm sets the worker to pre-warm itself to minimize cold start time.
 // if not enabled, worker will "warm up" when it receives its first job.
-func PreWarm() Option {
+// if a count is provided, that many threads (and for Wasm Runnables, instances)
+// are started when the Runnable is registered, and the pool is kept at least that large
+func PreWarm(count ...int) Option {
 	return func(opts workerOpts) workerOpts {
 		opts.preWarm = true
+
+		if len(count) > 0 {
+			opts.preWarmCount = count[0]
+		}
+
+		return opts
+	}
+}
+
+// MaxQueueSize returns an Option that limits the number of jobs that can wait for a thread. Jobs that
+// are scheduled while the queue is full fail with ErrQueueFull, rather than waiting for room in the queue
+func MaxQueueSize(size int) Option {
+	return func(opts workerOpts) workerOpts {
+		opts.maxQueueSize = size
 		return opts
 	}
 }
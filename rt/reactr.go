@@ -90,6 +90,49 @@ func (r *Reactr) RegisterWithCaps(jobType string, runner Runnable, caps Capabili
 	r.core.register(jobType, runner, caps, options...)
 }
 
+// Reload replaces the Runnable for a registered jobType without dropping any jobs. The new Runnable is started
+// (for Wasm Runnables, compiled and given warm instances) before any jobs are sent to it, and the old Runnable
+// is stopped once it has finished the jobs that were already sent to it. The worker's options are unchanged.
+func (r *Reactr) Reload(jobType string, runner Runnable) error {
+	return r.core.reload(jobType, runner)
+}
+
+// UpdateCaps replaces the Capabilities of a registered jobType (and of any of its versions) without restarting its worker,
+// so that things like cache backends, auth headers and allowlists can be changed while the host is running. Jobs that
+// have already been scheduled finish with the Capabilities they were given, and every job scheduled afterwards uses caps
+func (r *Reactr) UpdateCaps(jobType string, caps Capabilities) error {
+	caps.doFunc = r.core.do
+
+	return r.core.updateCaps(jobType, caps)
+}
+
+// RegisterVersion registers a canary version of the Runnable for an already registered jobType, which will
+// receive weight percent of the jobType's jobs (e.g. 5 for a 95/5 split). The Runnable passed to Register
+// receives whatever percentage is not assigned to a version. Use Promote or Rollback to end the canary.
+func (r *Reactr) RegisterVersion(jobType, version string, runner Runnable, weight int, options ...Option) error {
+	caps := r.defaultCaps
+	caps.doFunc = r.core.do
+
+	return r.core.registerVersion(jobType, version, runner, weight, caps, options...)
+}
+
+// SetVersionWeight changes the percentage of a jobType's jobs that are sent to a canary version
+func (r *Reactr) SetVersionWeight(jobType, version string, weight int) error {
+	return r.core.setVersionWeight(jobType, version, weight)
+}
+
+// Promote makes a canary version the default Runnable for its jobType. The previous default
+// Runnable is stopped once it has finished the jobs that were already sent to it, as with Reload
+func (r *Reactr) Promote(jobType, version string) error {
+	return r.core.promote(jobType, version)
+}
+
+// Rollback removes a canary version from a jobType. Jobs that were queued for the version are
+// handled by the default Runnable, and the version is stopped once its running jobs are finished
+func (r *Reactr) Rollback(jobType, version string) error {
+	return r.core.rollback(jobType, version)
+}
+
 // DeRegister stops the workers for a given jobType and removes it
 func (r *Reactr) DeRegister(jobType string) error {
 	return r.core.deRegister(jobType)
@@ -152,6 +195,33 @@ func (r *Reactr) Listen(pod *grav.Pod, msgType string) {
 	})
 }
 
+// Subscribe causes Reactr to deliver the messages of the given types (or all messages, if none are given) that the pod receives to the jobType's Runnable.
+// Each message is the data of a new job, so that the Runnable can consume it (Wasm Runnables receive messages with
+// their exported on_message function). Unlike Listen, the job's result is not sent as a reply, and errors are logged.
+func (r *Reactr) Subscribe(pod *grav.Pod, jobType string, msgTypes ...string) {
+	onMsg := func(msg grav.Message) error {
+		r.Do(NewJob(jobType, msg)).ThenDo(func(_ interface{}, err error) {
+			if err != nil {
+				r.log.Error(errors.Wrapf(err, "job from message %s returned error result", msg.UUID()))
+			}
+		})
+
+		return nil
+	}
+
+	if len(msgTypes) == 0 {
+		pod.On(onMsg)
+		return
+	}
+
+	// setting the pod's onFunc resets its filter, so the rest of the types are added afterwards
+	pod.OnType(msgTypes[0], onMsg)
+
+	for _, msgType := range msgTypes[1:] {
+		pod.FilterType(msgType, true)
+	}
+}
+
 // DefaultCaps returns this instance's Capabilities object
 func (r *Reactr) DefaultCaps() Capabilities {
 	return r.defaultCaps
@@ -1,12 +1,15 @@
 package rt
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/suborbital/grav/testutil"
+	"github.com/suborbital/reactr/rcap"
 )
 
 type generic struct{}
@@ -126,6 +129,76 @@ func TestReactrResultThenDo(t *testing.T) {
 	<-wait
 }
 
+func TestReactrResultThenWithTimeout(t *testing.T) {
+	r := New()
+
+	runner := blockingRunner{started: make(chan bool, 1), release: make(chan bool, 1)}
+
+	r.Register("blocking", runner)
+
+	res := r.Do(r.Job("blocking", nil))
+
+	if _, err := res.ThenWithTimeout(10 * time.Millisecond); !errors.Is(err, ErrResultTimeout) {
+		t.Error("expected ErrResultTimeout, got", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := res.ThenWithContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Error("expected context.Canceled, got", err)
+	}
+
+	// the job keeps running, and its result can still be read once it's done
+	runner.release <- true
+
+	if _, err := res.ThenWithTimeout(time.Second); err != nil {
+		t.Error(errors.Wrap(err, "failed to ThenWithTimeout"))
+	}
+}
+
+func TestReactrResultCallbacks(t *testing.T) {
+	r := New()
+
+	r.Register("generic", generic{})
+
+	results := make(chan interface{}, 4)
+
+	onSuccess := func(res interface{}) { results <- res }
+	onError := func(err error) { results <- err }
+
+	// the recursive job's result is only ready once the jobs it returns have finished
+	succeeded := r.Do(r.Job("generic", "first")).OnSuccess(onSuccess).OnError(onError)
+	failed := r.Do(r.Job("generic", "fail")).OnSuccess(onSuccess).OnError(onError)
+
+	for _, res := range []*Result{succeeded, failed} {
+		res.Then()
+	}
+
+	received := map[string]bool{}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case res := <-results:
+			received[fmt.Sprint(res)] = true
+		case <-time.After(time.Second):
+			t.Fatal("expected callback to be called")
+		}
+	}
+
+	if !received["last"] || len(received) != 2 {
+		t.Error("expected result 'last' and an error, got", received)
+	}
+
+	// callbacks added after the result is ready are called immediately
+	called := false
+	succeeded.OnSuccess(func(res interface{}) { called = true }).OnError(onError)
+
+	if !called || len(results) != 0 {
+		t.Error("expected only the success callback to be called immediately")
+	}
+}
+
 type prewarmRunnable struct {
 	counter *testutil.AsyncCounter
 }
@@ -159,6 +232,57 @@ func TestPreWarmWorker(t *testing.T) {
 	}
 }
 
+func TestPreWarmCount(t *testing.T) {
+	counter := testutil.NewAsyncCounter(10)
+
+	runnable := &prewarmRunnable{
+		counter: counter,
+	}
+
+	r := New()
+	r.Register("prewarm", runnable, PreWarm(4))
+
+	// the pool size is 1, but 4 threads should be started
+	if err := counter.Wait(4, 1); err != nil {
+		t.Error(err)
+	}
+
+	if count := r.Metrics().Workers["prewarm"].ThreadCount; count != 4 {
+		t.Error("expected 4 threads, got", count)
+	}
+}
+
+type provisioningRunnable struct {
+	prewarmRunnable
+	provisioned []int
+}
+
+func (p *provisioningRunnable) Provision(count int) {
+	p.provisioned = append(p.provisioned, count)
+}
+
+func TestPreWarmProvision(t *testing.T) {
+	counter := testutil.NewAsyncCounter(10)
+
+	runnable := &provisioningRunnable{
+		prewarmRunnable: prewarmRunnable{
+			counter: counter,
+		},
+	}
+
+	r := New()
+	r.Register("provision", runnable, PoolSize(3), PreWarm())
+
+	if err := counter.Wait(3, 1); err != nil {
+		t.Error(err)
+	}
+
+	// the Runnable should be asked to provision all 3 threads once, before they're started
+	if len(runnable.provisioned) != 1 || runnable.provisioned[0] != 3 {
+		t.Error("expected Provision(3) to be called once, got", runnable.provisioned)
+	}
+}
+
 func TestDeregisterWorker(t *testing.T) {
 	r := New()
 
@@ -188,3 +312,372 @@ func TestDeregisterWorker(t *testing.T) {
 		t.Error("expected error but there was none")
 	}
 }
+
+type versioned struct {
+	version string
+}
+
+// Run returns the Runnable's version after a short delay
+func (v versioned) Run(job Job, ctx *Ctx) (interface{}, error) {
+	time.Sleep(time.Millisecond * 100)
+
+	return v.version, nil
+}
+
+func (v versioned) OnChange(change ChangeEvent) error {
+	return nil
+}
+
+func TestReloadWorker(t *testing.T) {
+	r := New()
+
+	doVersion := r.Register("versioned", versioned{"v1"}, PoolSize(2))
+
+	// give the first job time to start running on v1
+	running := doVersion(nil)
+	time.Sleep(time.Millisecond * 50)
+
+	// jobs sent during the reload can be handled by either version, but none should be dropped
+	results := []*Result{}
+	for i := 0; i < 5; i++ {
+		results = append(results, doVersion(nil))
+	}
+
+	if err := r.Reload("versioned", versioned{"v2"}); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Reload"))
+	}
+
+	version, err := running.Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if version.(string) != "v1" {
+		t.Error("expected running job to be finished by v1, got", version)
+	}
+
+	for _, res := range results {
+		if _, err := res.Then(); err != nil {
+			t.Error(errors.Wrap(err, "failed to Then"))
+		}
+	}
+
+	version, err = doVersion(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if version.(string) != "v2" {
+		t.Error("expected job to be handled by v2, got", version)
+	}
+}
+
+func TestReloadUnregistered(t *testing.T) {
+	r := New()
+
+	if err := r.Reload("nope", versioned{"v2"}); err == nil {
+		t.Error("expected error, did not get one")
+	}
+}
+
+// slowStart is a Runnable that takes a while to start, like a Wasm Runnable compiling its module
+type slowStart struct {
+	starting chan bool
+	release  chan bool
+}
+
+func (s slowStart) Run(job Job, ctx *Ctx) (interface{}, error) {
+	return "slow", nil
+}
+
+func (s slowStart) OnChange(change ChangeEvent) error {
+	if change == ChangeTypeStart {
+		s.starting <- true
+		<-s.release
+	}
+
+	return nil
+}
+
+func TestReloadDoesNotBlockOtherJobTypes(t *testing.T) {
+	r := New()
+
+	r.Register("slow", generic{})
+	doOther := r.Register("other", generic{})
+
+	runner := slowStart{starting: make(chan bool, 1), release: make(chan bool)}
+
+	reloaded := make(chan error, 1)
+	go func() {
+		reloaded <- r.Reload("slow", runner)
+	}()
+
+	<-runner.starting
+
+	// the new worker is still starting, and other jobTypes should be scheduled in the meantime
+	done := make(chan error, 1)
+	go func() {
+		_, err := doOther("hello").Then()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(errors.Wrap(err, "failed to Then"))
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for a job of another jobType while reloading")
+	}
+
+	close(runner.release)
+
+	if err := <-reloaded; err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Reload"))
+	}
+
+	res, err := r.Do(NewJob("slow", nil)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if res.(string) != "slow" {
+		t.Error("expected the job to be handled by the reloaded Runnable, got", res)
+	}
+}
+
+// configured returns the value of the "greeting" configuration key
+type configured struct{}
+
+func (c configured) Run(job Job, ctx *Ctx) (interface{}, error) {
+	return ctx.Configuration.Get("greeting")
+}
+
+func (c configured) OnChange(change ChangeEvent) error {
+	return nil
+}
+
+func TestUpdateCaps(t *testing.T) {
+	r := New()
+
+	capsWithGreeting := func(greeting string) Capabilities {
+		config := rcap.DefaultCapabilityConfig()
+		config.Configuration = &rcap.ConfigurationConfig{
+			Enabled: true,
+			Values:  map[string]string{"greeting": greeting},
+		}
+
+		return CapabilitiesFromConfig(config)
+	}
+
+	r.RegisterWithCaps("configured", configured{}, capsWithGreeting("hello"))
+
+	if err := r.RegisterVersion("configured", "v2", configured{}, 50); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to RegisterVersion"))
+	}
+
+	if err := r.UpdateCaps("configured", capsWithGreeting("bonjour")); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to UpdateCaps"))
+	}
+
+	// the jobs are split between the default Runnable and its version, which should both have been updated
+	for i := 0; i < 10; i++ {
+		greeting, err := r.Do(NewJob("configured", nil)).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		if greeting.(string) != "bonjour" {
+			t.Error("expected updated greeting, got", greeting)
+		}
+	}
+
+	if err := r.UpdateCaps("nope", capsWithGreeting("hola")); err == nil {
+		t.Error("expected error, did not get one")
+	}
+}
+
+func TestVersionWeights(t *testing.T) {
+	r := New()
+
+	doVersion := r.Register("versioned", versioned{"v1"}, PoolSize(5))
+
+	if err := r.RegisterVersion("versioned", "v2", versioned{"v2"}, 100, PoolSize(5)); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to RegisterVersion"))
+	}
+
+	version, err := doVersion(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if version.(string) != "v2" {
+		t.Error("expected job to be handled by v2, got", version)
+	}
+
+	if err := r.SetVersionWeight("versioned", "v2", 0); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to SetVersionWeight"))
+	}
+
+	version, err = doVersion(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if version.(string) != "v1" {
+		t.Error("expected job to be handled by v1, got", version)
+	}
+
+	if err := r.RegisterVersion("versioned", "v3", versioned{"v3"}, 101); err == nil {
+		t.Error("expected error for weight over 100, did not get one")
+	}
+
+	if err := r.RegisterVersion("nope", "v2", versioned{"v2"}, 5); err == nil {
+		t.Error("expected error for unregistered jobType, did not get one")
+	}
+}
+
+func TestVersionNames(t *testing.T) {
+	r := New()
+
+	r.Register("versioned", versioned{"v1"})
+
+	if err := r.RegisterVersion("versioned", "v2", versioned{"v2"}, 0); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to RegisterVersion"))
+	}
+
+	// a jobType whose name looks like a version's must not replace or receive the version's jobs
+	doOther := r.Register("versioned@v2", versioned{"other"})
+
+	version, err := doOther(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if version.(string) != "other" {
+		t.Error("expected job to be handled by versioned@v2's Runnable, got", version)
+	}
+
+	if err := r.SetVersionWeight("versioned", "v2", 100); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to SetVersionWeight"))
+	}
+
+	version, err = r.Do(NewJob("versioned", nil)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if version.(string) != "v2" {
+		t.Error("expected job to be handled by v2, got", version)
+	}
+
+	if _, exists := r.Metrics().Versions["versioned"]["v2"]; !exists {
+		t.Error("expected metrics for v2")
+	}
+}
+
+func TestVersionPreWarm(t *testing.T) {
+	counter := testutil.NewAsyncCounter(10)
+
+	r := New()
+
+	r.Register("versioned", versioned{"v1"})
+
+	if err := r.RegisterVersion("versioned", "v2", &prewarmRunnable{counter: counter}, 5, PreWarm(3)); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to RegisterVersion"))
+	}
+
+	// the version's threads should be started without it being sent a job
+	if err := counter.Wait(3, 1); err != nil {
+		t.Error(err)
+	}
+
+	if count := r.Metrics().Versions["versioned"]["v2"].ThreadCount; count != 3 {
+		t.Error("expected 3 threads, got", count)
+	}
+}
+
+func TestVersionPromote(t *testing.T) {
+	r := New()
+
+	doVersion := r.Register("versioned", versioned{"v1"})
+
+	if err := r.RegisterVersion("versioned", "v2", versioned{"v2"}, 5); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to RegisterVersion"))
+	}
+
+	if err := r.Promote("versioned", "v2"); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Promote"))
+	}
+
+	for i := 0; i < 3; i++ {
+		version, err := doVersion(nil).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		if version.(string) != "v2" {
+			t.Error("expected job to be handled by v2, got", version)
+		}
+	}
+
+	if err := r.Promote("versioned", "v2"); err == nil {
+		t.Error("expected error promoting version twice, did not get one")
+	}
+}
+
+func TestVersionPromoteWithoutDefault(t *testing.T) {
+	r := New()
+
+	r.Register("versioned", versioned{"v1"})
+
+	if err := r.RegisterVersion("versioned", "v2", versioned{"v2"}, 5); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to RegisterVersion"))
+	}
+
+	r.core.scaler.takeWorker("versioned")
+
+	if err := r.Promote("versioned", "v2"); !errors.Is(err, ErrNoWorkerRegistered) {
+		t.Error("expected ErrNoWorkerRegistered, got", err)
+	}
+
+	// the version must be left registered rather than leaked
+	if r.core.scaler.findVersion("versioned", "v2") == nil || !r.core.routers["versioned"].has("v2") {
+		t.Error("expected v2 to still be registered")
+	}
+}
+
+func TestVersionRollback(t *testing.T) {
+	r := New()
+
+	doVersion := r.Register("versioned", versioned{"v1"})
+
+	if err := r.RegisterVersion("versioned", "v2", versioned{"v2"}, 100); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to RegisterVersion"))
+	}
+
+	// queue jobs for v2, which should all complete even though it is rolled back
+	results := []*Result{}
+	for i := 0; i < 3; i++ {
+		results = append(results, doVersion(nil))
+	}
+
+	if err := r.Rollback("versioned", "v2"); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Rollback"))
+	}
+
+	for _, res := range results {
+		if _, err := res.Then(); err != nil {
+			t.Error(errors.Wrap(err, "failed to Then"))
+		}
+	}
+
+	version, err := doVersion(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if version.(string) != "v1" {
+		t.Error("expected job to be handled by v1, got", version)
+	}
+}
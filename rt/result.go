@@ -1,11 +1,17 @@
 package rt
 
 import (
+	"context"
 	"encoding/json"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
+// ErrResultTimeout is returned by ThenWithTimeout when the result isn't ready in time
+var ErrResultTimeout = errors.New("timed out waiting for result")
+
 // Result describes a result
 type Result struct {
 	uuid string
@@ -14,6 +20,12 @@ type Result struct {
 
 	resultChan chan bool
 	errChan    chan bool
+
+	// done is set once the result or error has been sent, after which callbacks are called as soon as they're added
+	done      bool
+	onSuccess []func(interface{})
+	onError   []func(error)
+	lock      sync.Mutex
 }
 
 // ResultFunc is a result callback function.
@@ -44,6 +56,75 @@ func (r *Result) Then() (interface{}, error) {
 	}
 }
 
+// ThenWithContext returns the result or error from a Result, or ctx's error if ctx is done first. The job keeps running
+// if ctx is done, and since the Result holds on to its outcome, it can still be read later with Then (or discarded with Discard)
+func (r *Result) ThenWithContext(ctx context.Context) (interface{}, error) {
+	select {
+	case <-r.resultChan:
+		return r.data, nil
+	case <-r.errChan:
+		return nil, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ThenWithTimeout returns the result or error from a Result, or ErrResultTimeout if it isn't ready within timeout.
+// As with ThenWithContext, the job keeps running and its result can still be read later
+func (r *Result) ThenWithTimeout(timeout time.Duration) (interface{}, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-r.resultChan:
+		return r.data, nil
+	case <-r.errChan:
+		return nil, r.err
+	case <-timer.C:
+		return nil, ErrResultTimeout
+	}
+}
+
+// OnSuccess registers fn to be called with the result if the job succeeds, without a goroutine waiting for it. Callbacks
+// are called on a new goroutine once the result is ready, or immediately on the calling goroutine if it already is.
+// It returns the Result so that OnError can be chained, and doesn't prevent the result from being read with Then
+func (r *Result) OnSuccess(fn func(interface{})) *Result {
+	r.lock.Lock()
+
+	if !r.done {
+		r.onSuccess = append(r.onSuccess, fn)
+		r.lock.Unlock()
+		return r
+	}
+
+	r.lock.Unlock()
+
+	if r.err == nil {
+		fn(r.data)
+	}
+
+	return r
+}
+
+// OnError registers fn to be called with the error if the job fails, in the same way as OnSuccess
+func (r *Result) OnError(fn func(error)) *Result {
+	r.lock.Lock()
+
+	if !r.done {
+		r.onError = append(r.onError, fn)
+		r.lock.Unlock()
+		return r
+	}
+
+	r.lock.Unlock()
+
+	if r.err != nil {
+		fn(r.err)
+	}
+
+	return r
+}
+
 // ThenInt returns the result or error from a Result
 func (r *Result) ThenInt() (int, error) {
 	res, err := r.Then()
@@ -99,13 +180,7 @@ func (r *Result) sendResult(data interface{}) {
 	// or if the result is a group, wait on the
 	// group and propogate the error if any
 	if res, ok := data.(*Result); ok {
-		go func() {
-			if newResult, err := res.Then(); err != nil {
-				r.sendErr(err)
-			} else {
-				r.sendResult(newResult)
-			}
-		}()
+		res.OnSuccess(r.sendResult).OnError(r.sendErr)
 
 		return
 	} else if grp, ok := data.(*Group); ok {
@@ -122,9 +197,36 @@ func (r *Result) sendResult(data interface{}) {
 
 	r.data = data
 	r.resultChan <- true
+
+	r.complete()
 }
 
 func (r *Result) sendErr(err error) {
 	r.err = err
 	r.errChan <- true
+
+	r.complete()
+}
+
+// complete marks the Result as done and calls the callbacks for its outcome
+func (r *Result) complete() {
+	r.lock.Lock()
+	r.done = true
+	onSuccess, onError := r.onSuccess, r.onError
+	r.onSuccess, r.onError = nil, nil
+	r.lock.Unlock()
+
+	if r.err == nil && len(onSuccess) > 0 {
+		go func() {
+			for _, fn := range onSuccess {
+				fn(r.data)
+			}
+		}()
+	} else if r.err != nil && len(onError) > 0 {
+		go func() {
+			for _, fn := range onError {
+				fn(r.err)
+			}
+		}()
+	}
 }
@@ -11,6 +11,21 @@ import (
 type RunErr struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+
+	// Trace is the guest's stack trace, one frame per line, which is set if the Runnable trapped
+	Trace string `json:"trace,omitempty"`
+
+	// Body is a JSON error payload, which is set if the Runnable aborted with return_abort_status.
+	// It's a string rather than bytes so that RunErrs stay comparable, such as with errors.Is
+	Body string `json:"-"`
+}
+
+// runErrJSON is the JSON representation of a RunErr, which includes the body as JSON rather than as a string
+type runErrJSON struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Trace   string          `json:"trace,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
 }
 
 // Error returns the stringified JSON representation of the error
@@ -19,6 +34,38 @@ func (r RunErr) Error() string {
 	return string(bytes)
 }
 
+// MarshalJSON encodes the error with its body as JSON
+func (r RunErr) MarshalJSON() ([]byte, error) {
+	j := runErrJSON{
+		Code:    r.Code,
+		Message: r.Message,
+		Trace:   r.Trace,
+	}
+
+	if r.Body != "" {
+		j.Body = json.RawMessage(r.Body)
+	}
+
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes an error encoded by MarshalJSON
+func (r *RunErr) UnmarshalJSON(data []byte) error {
+	j := runErrJSON{}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	*r = RunErr{
+		Code:    j.Code,
+		Message: j.Message,
+		Trace:   j.Trace,
+		Body:    string(j.Body),
+	}
+
+	return nil
+}
+
 // ToVKErr converts a RunErr to a VKError
 func (r RunErr) ToVKErr() vk.Error {
 	return vk.Err(r.Code, r.Message)
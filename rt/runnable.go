@@ -21,3 +21,10 @@ type Runnable interface {
 	// OnChange will be called for things like startup and shutdown.
 	OnChange(ChangeEvent) error
 }
+
+// ProvisioningRunnable is a Runnable that can prepare the resources for several threads at once, which is faster than
+// preparing them one at a time. Before a worker starts more than one thread (such as when it is pre-warmed), it calls
+// Provision with the number of threads it is about to start, and then calls OnChange(ChangeTypeStart) for each as usual.
+type ProvisioningRunnable interface {
+	Provision(count int)
+}
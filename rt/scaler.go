@@ -1,6 +1,7 @@
 package rt
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -13,6 +14,9 @@ type ScalerMetrics struct {
 	TotalThreadCount int                      `json:"totalThreadCount"`
 	TotalJobCount    int                      `json:"totalJobCount"`
 	Workers          map[string]WorkerMetrics `json:"workers"`
+
+	// Versions holds the metrics for the workers of each jobType's canary versions, keyed by jobType and then version
+	Versions map[string]map[string]WorkerMetrics `json:"versions,omitempty"`
 }
 
 // WorkerMetrics is metrics about a worker
@@ -23,8 +27,15 @@ type WorkerMetrics struct {
 	JobRate           float64 `json:"jobRate"`
 }
 
+// versionID identifies the worker for a canary version of a jobType
+type versionID struct {
+	jobType string
+	version string
+}
+
 type scaler struct {
-	workers map[string]*worker
+	workers  map[string]*worker
+	versions map[versionID]*worker
 
 	log       *vlog.Logger
 	lock      *sync.RWMutex
@@ -34,6 +45,7 @@ type scaler struct {
 func newScaler(log *vlog.Logger) *scaler {
 	s := &scaler{
 		workers:   map[string]*worker{},
+		versions:  map[versionID]*worker{},
 		log:       log,
 		lock:      &sync.RWMutex{},
 		startOnce: &sync.Once{},
@@ -51,23 +63,11 @@ func (s *scaler) startAutoscaler() {
 				s.lock.RLock()
 
 				for _, worker := range s.workers {
-					m := worker.metrics()
-
-					// if job queue is double thread pool size, double the thread count
-					// until it reaches autoscaleMax, and reverse when job queue is half
-					if m.JobCount > m.ThreadCount*2 || m.JobRate > float64(m.ThreadCount*2) {
-						if m.ThreadCount*2 <= worker.options.autoscaleMax {
-							worker.setThreadCount(m.ThreadCount * 2)
-						} else {
-							worker.setThreadCount(worker.options.autoscaleMax)
-						}
-					} else if m.JobCount < m.ThreadCount/2 && m.JobRate < float64(m.ThreadCount/2) {
-						if m.ThreadCount/2 > worker.options.poolSize {
-							worker.setThreadCount(m.ThreadCount / 2)
-						} else {
-							worker.setThreadCount(worker.options.poolSize)
-						}
-					}
+					autoscale(worker)
+				}
+
+				for _, worker := range s.versions {
+					autoscale(worker)
 				}
 
 				s.lock.RUnlock()
@@ -77,15 +77,52 @@ func (s *scaler) startAutoscaler() {
 	})
 }
 
+// autoscale sets the thread count of a worker according to its job queue and job rate
+func autoscale(w *worker) {
+	m := w.metrics()
+
+	// if job queue is double thread pool size, double the thread count
+	// until it reaches autoscaleMax, and reverse when job queue is half
+	if m.JobCount > m.ThreadCount*2 || m.JobRate > float64(m.ThreadCount*2) {
+		if m.ThreadCount*2 <= w.options.autoscaleMax {
+			w.setThreadCount(m.ThreadCount * 2)
+		} else if m.ThreadCount < w.options.autoscaleMax {
+			// a pre-warmed pool may already be larger than autoscaleMax, so don't shrink it here
+			w.setThreadCount(w.options.autoscaleMax)
+		}
+	} else if m.JobCount < m.ThreadCount/2 && m.JobRate < float64(m.ThreadCount/2) {
+		if m.ThreadCount/2 > w.options.minThreadCount() {
+			w.setThreadCount(m.ThreadCount / 2)
+		} else {
+			w.setThreadCount(w.options.minThreadCount())
+		}
+	}
+}
+
 func (s *scaler) addWorker(jobType string, wk *worker) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
 	s.workers[jobType] = wk
 
+	s.start(wk, jobType)
+}
+
+// addVersion adds the worker for a version of a jobType, starting it in the same way as addWorker
+func (s *scaler) addVersion(jobType, version string, wk *worker) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.versions[versionID{jobType, version}] = wk
+
+	s.start(wk, fmt.Sprintf("version %s of %s", version, jobType))
+}
+
+// start starts a worker, pre-warming its threads if it was registered with PreWarm
+func (s *scaler) start(wk *worker, name string) {
 	go func() {
 		if err := wk.start(); err != nil {
-			s.log.Error(errors.Wrapf(err, "failed to start %s worker", jobType))
+			s.log.Error(errors.Wrapf(err, "failed to start %s worker", name))
 		}
 	}()
 }
@@ -109,6 +146,36 @@ func (s *scaler) removeWorker(jobType string) error {
 	return nil
 }
 
+// replaceWorker swaps the worker for a jobType, returning the previous worker
+func (s *scaler) replaceWorker(jobType string, wk *worker) (*worker, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	old, exists := s.workers[jobType]
+	if !exists {
+		return nil, errors.Wrapf(ErrNoWorkerRegistered, "jobType %q", jobType)
+	}
+
+	s.workers[jobType] = wk
+
+	return old, nil
+}
+
+// takeWorker removes a worker from the scaler without stopping it
+func (s *scaler) takeWorker(jobType string) *worker {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	wk, exists := s.workers[jobType]
+	if !exists {
+		return nil
+	}
+
+	delete(s.workers, jobType)
+
+	return wk
+}
+
 func (s *scaler) findWorker(jobType string) *worker {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
@@ -124,6 +191,44 @@ func (s *scaler) findWorker(jobType string) *worker {
 	return nil
 }
 
+// removeVersion removes and stops the worker for a version of a jobType
+func (s *scaler) removeVersion(jobType, version string) error {
+	wk := s.takeVersion(jobType, version)
+	if wk == nil {
+		return nil
+	}
+
+	if err := wk.stop(); err != nil {
+		return errors.Wrap(err, "failed to worker.stop")
+	}
+
+	return nil
+}
+
+// takeVersion removes the worker for a version of a jobType from the scaler without stopping it
+func (s *scaler) takeVersion(jobType, version string) *worker {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := versionID{jobType, version}
+
+	wk, exists := s.versions[id]
+	if !exists {
+		return nil
+	}
+
+	delete(s.versions, id)
+
+	return wk
+}
+
+func (s *scaler) findVersion(jobType, version string) *worker {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.versions[versionID{jobType, version}]
+}
+
 func (s *scaler) metrics() ScalerMetrics {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
@@ -142,5 +247,22 @@ func (s *scaler) metrics() ScalerMetrics {
 		m.Workers[name] = metrics
 	}
 
+	for id, w := range s.versions {
+		metrics := w.metrics()
+
+		m.TotalThreadCount += metrics.ThreadCount
+		m.TotalJobCount += metrics.JobCount
+
+		if m.Versions == nil {
+			m.Versions = map[string]map[string]WorkerMetrics{}
+		}
+
+		if m.Versions[id.jobType] == nil {
+			m.Versions[id.jobType] = map[string]WorkerMetrics{}
+		}
+
+		m.Versions[id.jobType][id.version] = metrics
+	}
+
 	return m
 }
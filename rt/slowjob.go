@@ -0,0 +1,116 @@
+package rt
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// slowJobInputLength is the longest that the summary of a slow job's input can be
+const slowJobInputLength = 128
+
+// SlowJob describes a job that has been running for longer than its Runnable's slow job threshold
+type SlowJob struct {
+	JobType   string
+	JobUUID   string
+	Attempt   int
+	Tenant    string
+	Threshold time.Duration
+
+	// Input is a summary of the job's data, such as the start of its bytes or the method and URL of its request
+	Input string
+
+	// HostCall is the host function that the job was calling when it passed the threshold, or "" if it wasn't calling one
+	HostCall string
+}
+
+// SlowJobFunc is called with each job that runs for longer than its Runnable's slow job threshold
+type SlowJobFunc func(job SlowJob)
+
+// SlowJobThreshold returns an Option that calls slow (if it isn't nil) and logs a warning with the job's
+// capabilities when one of the Runnable's jobs has been running for longer than threshold. They're called while
+// the job is still running, so that a job that is stuck (such as waiting on a degraded upstream) is reported too
+func SlowJobThreshold(threshold time.Duration, slow SlowJobFunc) Option {
+	return func(opts workerOpts) workerOpts {
+		opts.slowThreshold = threshold
+		opts.slowFunc = slow
+		return opts
+	}
+}
+
+// watchSlowJob reports the job if it's still running once threshold has passed. The returned func must be called when the job finishes
+func watchSlowJob(threshold time.Duration, slow SlowJobFunc, job *Job, ctx *Ctx) (stop func()) {
+	if threshold <= 0 {
+		return func() {}
+	}
+
+	timer := time.AfterFunc(threshold, func() {
+		s := SlowJob{
+			JobType:   job.jobType,
+			JobUUID:   job.uuid,
+			Attempt:   job.Attempt(),
+			Tenant:    job.tenant,
+			Threshold: threshold,
+			Input:     inputSummary(job),
+			HostCall:  ctx.HostCall(),
+		}
+
+		if ctx.LoggerSource != nil {
+			scope := map[string]interface{}{
+				"jobType":  s.JobType,
+				"jobUUID":  s.JobUUID,
+				"attempt":  s.Attempt,
+				"tenant":   s.Tenant,
+				"input":    s.Input,
+				"hostCall": s.HostCall,
+			}
+
+			ctx.LoggerSource.Log(2, fmt.Sprintf("job has been running for longer than %s", threshold), scope)
+		}
+
+		if slow != nil {
+			slow(s)
+		}
+	})
+
+	return func() {
+		timer.Stop()
+	}
+}
+
+// inputSummary returns a short description of a job's data
+func inputSummary(job *Job) string {
+	if job.req != nil {
+		return fmt.Sprintf("%s %s", job.req.Method, job.req.URL)
+	}
+
+	var summary string
+
+	switch data := job.data.(type) {
+	case nil:
+		return ""
+	case []byte:
+		summary = string(data)
+	case string:
+		summary = data
+	case fmt.Stringer:
+		summary = data.String()
+	case int, int32, int64, float32, float64, bool:
+		summary = fmt.Sprint(data)
+	default:
+		// other values could be large or sensitive, so only their type is included
+		summary = fmt.Sprintf("%T", data)
+	}
+
+	if len(summary) <= slowJobInputLength {
+		return summary
+	}
+
+	// don't cut a multi-byte character in half
+	cut := slowJobInputLength
+	for cut > 0 && !utf8.RuneStart(summary[cut]) {
+		cut--
+	}
+
+	return summary[:cut] + "..."
+}
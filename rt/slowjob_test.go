@@ -0,0 +1,83 @@
+package rt
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sleeper sleeps for the number of milliseconds it's given while pretending to make a host call
+type sleeper struct{}
+
+func (s sleeper) Run(job Job, ctx *Ctx) (interface{}, error) {
+	ctx.SetHostCall("sleep")
+	defer ctx.SetHostCall("")
+
+	time.Sleep(time.Duration(job.Int()) * time.Millisecond)
+
+	return nil, nil
+}
+
+func (s sleeper) OnChange(_ ChangeEvent) error {
+	return nil
+}
+
+func TestSlowJobThreshold(t *testing.T) {
+	r := New()
+
+	slowJobs := make(chan SlowJob, 2)
+
+	r.Register("sleep", sleeper{}, SlowJobThreshold(50*time.Millisecond, func(job SlowJob) {
+		slowJobs <- job
+	}))
+
+	if _, err := r.Do(r.Job("sleep", 5)).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if len(slowJobs) != 0 {
+		t.Fatal("expected fast job not to be reported")
+	}
+
+	job := r.Job("sleep", 200)
+
+	if _, err := r.Do(job).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	select {
+	case slow := <-slowJobs:
+		if slow.JobType != "sleep" || slow.JobUUID != job.UUID() || slow.HostCall != "sleep" || slow.Threshold != 50*time.Millisecond {
+			t.Errorf("expected slow sleep job calling sleep, got %+v", slow)
+		}
+	default:
+		t.Error("expected slow job to be reported")
+	}
+}
+
+func TestInputSummary(t *testing.T) {
+	long := strings.Repeat("é", slowJobInputLength)
+
+	for _, tc := range []struct {
+		data     interface{}
+		expected string
+	}{
+		{"hello", "hello"},
+		{[]byte("bytes"), "bytes"},
+		{42, "42"},
+		{struct{ a int }{1}, "struct { a int }"},
+		{long, long[:slowJobInputLength] + "..."},
+		// the limit falls in the middle of a character, which is left out
+		{"a" + long, ("a" + long)[:slowJobInputLength-1] + "..."},
+	} {
+		data, expected := tc.data, tc.expected
+
+		job := NewJob("summary", data)
+
+		if summary := inputSummary(&job); summary != expected {
+			t.Errorf("expected summary %q, got %q", expected, summary)
+		}
+	}
+}
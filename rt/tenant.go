@@ -0,0 +1,176 @@
+package rt
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultMaxTenants is the number of tenants whose Capabilities are kept if MaxTenants isn't set
+const defaultMaxTenants = 1000
+
+// TenantFunc returns the tenant that a job belongs to, or "" if it doesn't belong to one
+type TenantFunc func(job Job) string
+
+// DeriveCapsFunc derives a tenant's Capabilities from the Runnable's, such as by namespacing its cache or giving it its own
+// secrets and auth. It's given a copy of the Runnable's Capabilities, which it can modify and return
+type DeriveCapsFunc func(tenant string, caps Capabilities) (Capabilities, error)
+
+// TenantCaps returns an Option that runs each job with Capabilities derived for its tenant, so that one Runnable can serve
+// many tenants while keeping their caches, secrets and auth isolated. derive is called when a tenant's first job is
+// scheduled, and its Capabilities are reused for the tenant's later jobs until the Runnable's Capabilities are updated
+// (see Reactr.UpdateCaps). Jobs without a tenant, and jobs scheduled with DoWithCaps, use the Capabilities they'd use otherwise.
+// The tenant is also what the job's events and the audit log are recorded with. derive can be nil to only find each job's tenant
+func TenantCaps(tenant TenantFunc, derive DeriveCapsFunc) Option {
+	return func(opts workerOpts) workerOpts {
+		opts.tenant = tenant
+		opts.deriveCaps = derive
+		return opts
+	}
+}
+
+// MaxTenants returns an Option that limits the number of tenants whose derived Capabilities are kept (1000 by default).
+// Once the limit is reached, the least recently used tenant's are dropped, and derived again if it schedules another job.
+// This bounds the memory used when tenants come from untrusted input, such as with TenantFromHeader
+func MaxTenants(count int) Option {
+	return func(opts workerOpts) workerOpts {
+		opts.maxTenants = count
+		return opts
+	}
+}
+
+// TenantFromMeta returns a TenantFunc that reads the tenant from a job's metadata (see Job.WithMeta)
+func TenantFromMeta(key string) TenantFunc {
+	return func(job Job) string {
+		tenant, _ := job.Meta(key)
+		return tenant
+	}
+}
+
+// TenantFromHeader returns a TenantFunc that reads the tenant from a header of the request that a job is handling
+func TenantFromHeader(name string) TenantFunc {
+	return func(job Job) string {
+		if job.Req() == nil {
+			return ""
+		}
+
+		for key, value := range job.Req().Headers {
+			if strings.EqualFold(key, name) {
+				return value
+			}
+		}
+
+		return ""
+	}
+}
+
+// tenantCaps is an LRU cache of the Capabilities derived for a worker's tenants
+type tenantCaps struct {
+	max int
+
+	// entries is ordered from most to least recently used
+	entries  *list.List
+	elements map[string]*list.Element
+
+	// derive ensures that concurrent jobs of a new tenant only derive its Capabilities once
+	derive *singleflight.Group
+	lock   sync.Mutex
+}
+
+type tenantEntry struct {
+	tenant string
+	caps   Capabilities
+}
+
+func newTenantCaps(max int) *tenantCaps {
+	if max <= 0 {
+		max = defaultMaxTenants
+	}
+
+	t := &tenantCaps{
+		max:      max,
+		entries:  list.New(),
+		elements: map[string]*list.Element{},
+		derive:   &singleflight.Group{},
+	}
+
+	return t
+}
+
+// get returns the Capabilities derived for tenant, if they're cached
+func (t *tenantCaps) get(tenant string) (Capabilities, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	elem, exists := t.elements[tenant]
+	if !exists {
+		return Capabilities{}, false
+	}
+
+	t.entries.MoveToFront(elem)
+
+	return elem.Value.(*tenantEntry).caps, true
+}
+
+// put caches the Capabilities derived for tenant, dropping the least recently used tenant's if there are too many
+func (t *tenantCaps) put(tenant string, caps Capabilities) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if elem, exists := t.elements[tenant]; exists {
+		elem.Value.(*tenantEntry).caps = caps
+		t.entries.MoveToFront(elem)
+		return
+	}
+
+	t.elements[tenant] = t.entries.PushFront(&tenantEntry{tenant: tenant, caps: caps})
+
+	for t.entries.Len() > t.max {
+		oldest := t.entries.Back()
+		t.entries.Remove(oldest)
+		delete(t.elements, oldest.Value.(*tenantEntry).tenant)
+	}
+}
+
+// jobCapabilities returns the Capabilities that a job should be run with, deriving them for its tenant if needed
+func (w *worker) jobCapabilities(job Job) (Capabilities, error) {
+	w.lock.RLock()
+	caps, tenants := w.defaultCaps, w.tenants
+	w.lock.RUnlock()
+
+	tenant := job.tenant
+	if tenant == "" || w.options.deriveCaps == nil {
+		return caps, nil
+	}
+
+	if derived, exists := tenants.get(tenant); exists {
+		return derived, nil
+	}
+
+	// derive is called without holding the cache's lock, so a slow derive only holds up the jobs of its own tenant
+	derived, err, _ := tenants.derive.Do(tenant, func() (interface{}, error) {
+		if derived, exists := tenants.get(tenant); exists {
+			return derived, nil
+		}
+
+		derived, err := w.options.deriveCaps(tenant, caps)
+		if err != nil {
+			return nil, err
+		}
+
+		// keep the Reactr's internals, which are lost if the Capabilities were created from a config
+		derived.doFunc = caps.doFunc
+
+		tenants.put(tenant, derived)
+
+		return derived, nil
+	})
+	if err != nil {
+		return caps, errors.Wrapf(err, "failed to derive Capabilities for tenant %s", tenant)
+	}
+
+	return derived.(Capabilities), nil
+}
@@ -0,0 +1,248 @@
+package rt
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/request"
+)
+
+// visitCounter counts the visits recorded in its cache, and returns the new count
+type visitCounter struct{}
+
+func (v visitCounter) Run(job Job, ctx *Ctx) (interface{}, error) {
+	count := 0
+
+	if val, err := ctx.Cache.Get("visits"); err == nil {
+		fmt.Sscanf(string(val), "%d", &count)
+	}
+
+	count++
+
+	if err := ctx.Cache.Set("visits", []byte(fmt.Sprint(count)), 0); err != nil {
+		return nil, err
+	}
+
+	return count, nil
+}
+
+func (v visitCounter) OnChange(_ ChangeEvent) error {
+	return nil
+}
+
+func TestTenantCaps(t *testing.T) {
+	r := New()
+
+	derived := int32(0)
+
+	derive := func(tenant string, caps Capabilities) (Capabilities, error) {
+		if tenant == "banned" {
+			return caps, errors.New("tenant is banned")
+		}
+
+		atomic.AddInt32(&derived, 1)
+
+		return caps.WithCacheNamespace(tenant), nil
+	}
+
+	r.Register("visits", visitCounter{}, TenantCaps(TenantFromMeta("tenant"), derive))
+
+	visit := func(tenant string) int {
+		job := NewJob("visits", nil)
+		if tenant != "" {
+			job = job.WithMeta("tenant", tenant)
+		}
+
+		count, err := r.Do(job).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		return count.(int)
+	}
+
+	// each tenant's visits are counted in its own namespace of the cache
+	for i := 1; i <= 3; i++ {
+		if count := visit("acme"); count != i {
+			t.Errorf("expected acme's visit %d, got %d", i, count)
+		}
+	}
+
+	if count := visit("globex"); count != 1 {
+		t.Errorf("expected globex's first visit, got %d", count)
+	}
+
+	if count := visit(""); count != 1 {
+		t.Errorf("expected the first visit without a tenant, got %d", count)
+	}
+
+	if d := atomic.LoadInt32(&derived); d != 2 {
+		t.Errorf("expected Capabilities to be derived once for each tenant, got %d", d)
+	}
+
+	if _, err := r.Do(NewJob("visits", nil).WithMeta("tenant", "banned")).Then(); err == nil {
+		t.Error("expected an error for a tenant whose Capabilities can't be derived")
+	}
+
+	// updating the Runnable's Capabilities derives each tenant's again
+	if err := r.UpdateCaps("visits", r.DefaultCaps()); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to UpdateCaps"))
+	}
+
+	visit("acme")
+
+	if d := atomic.LoadInt32(&derived); d != 3 {
+		t.Errorf("expected Capabilities to be derived again after UpdateCaps, got %d", d)
+	}
+}
+
+func TestMaxTenants(t *testing.T) {
+	r := New()
+
+	derived := map[string]int{}
+	lock := sync.Mutex{}
+	release := make(chan struct{})
+
+	derive := func(tenant string, caps Capabilities) (Capabilities, error) {
+		// slow's Capabilities take a long time to derive
+		if tenant == "slow" {
+			<-release
+		}
+
+		lock.Lock()
+		derived[tenant]++
+		lock.Unlock()
+
+		return caps.WithCacheNamespace(tenant), nil
+	}
+
+	r.Register("visits", visitCounter{}, PoolSize(2), TenantCaps(TenantFromMeta("tenant"), derive), MaxTenants(2))
+
+	visit := func(tenant string) *Result {
+		return r.Do(NewJob("visits", nil).WithMeta("tenant", tenant))
+	}
+
+	slow := visit("slow")
+
+	// other tenants' jobs aren't held up while slow's Capabilities are derived
+	for _, tenant := range []string{"acme", "globex", "acme", "initech", "acme", "globex"} {
+		if _, err := visit(tenant).ThenWithTimeout(time.Second); err != nil {
+			t.Fatal(errors.Wrapf(err, "failed to Then for %s", tenant))
+		}
+	}
+
+	close(release)
+
+	if _, err := slow.Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then for slow"))
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	// only the 2 most recently used tenants are kept, so globex's were dropped when initech's were derived
+	expected := map[string]int{"slow": 1, "acme": 1, "globex": 2, "initech": 1}
+
+	for tenant, count := range expected {
+		if derived[tenant] != count {
+			t.Errorf("expected %s's Capabilities to be derived %d times, got %d", tenant, count, derived[tenant])
+		}
+	}
+}
+
+func TestTenantFromHeader(t *testing.T) {
+	tenant := TenantFromHeader("X-Tenant")
+
+	req := &request.CoordinatedRequest{
+		Method:  "GET",
+		URL:     "/orders",
+		Headers: map[string]string{"x-tenant": "acme"},
+	}
+
+	if got := tenant(NewJob("orders", req)); got != "acme" {
+		t.Errorf("expected acme, got %q", got)
+	}
+
+	if got := tenant(NewJob("orders", "not a request")); got != "" {
+		t.Errorf("expected no tenant, got %q", got)
+	}
+}
+
+// tenantReporter returns the tenant of its job, and of the job it runs with Ctx.Do if its data names a jobType.
+// The job it runs has its own tenant in its meta, which the job's Runnable would find if the job were run on its own
+type tenantReporter struct{}
+
+func (tr tenantReporter) Run(job Job, ctx *Ctx) (interface{}, error) {
+	if jobType, ok := job.Data().(string); ok {
+		nested, err := ctx.Do(NewJob(jobType, nil).WithMeta("tenant", "other")).Then()
+		if err != nil {
+			return nil, err
+		}
+
+		return ctx.Tenant() + "," + nested.(string), nil
+	}
+
+	return ctx.Tenant(), nil
+}
+
+func (tr tenantReporter) OnChange(_ ChangeEvent) error {
+	return nil
+}
+
+// tenantEvents records the tenant of each event
+type tenantEvents struct {
+	tenants []string
+	lock    sync.Mutex
+}
+
+func (te *tenantEvents) JobEvent(event JobEvent) {
+	te.lock.Lock()
+	defer te.lock.Unlock()
+
+	te.tenants = append(te.tenants, event.Tenant)
+}
+
+func TestJobTenant(t *testing.T) {
+	r := New()
+
+	events := &tenantEvents{}
+
+	r.Register("outer", tenantReporter{}, TenantCaps(TenantFromHeader("X-Tenant"), nil), EventSink(events))
+	r.Register("inner", tenantReporter{}, TenantCaps(TenantFromMeta("tenant"), nil))
+
+	req := &request.CoordinatedRequest{
+		Method:  "GET",
+		URL:     "/orders",
+		Headers: map[string]string{"X-Tenant": "acme"},
+	}
+
+	job := NewJob("outer", req)
+	job.data = "inner"
+
+	// the tenant found from the header is the one the job runs with, and is kept by the job it runs
+	res, err := r.Do(job).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if res.(string) != "acme,acme" {
+		t.Errorf("expected both jobs to run with tenant acme, got %s", res.(string))
+	}
+
+	events.lock.Lock()
+	defer events.lock.Unlock()
+
+	for _, tenant := range events.tenants {
+		if tenant != "acme" {
+			t.Errorf("expected events for tenant acme, got %q", tenant)
+		}
+	}
+
+	if len(events.tenants) == 0 {
+		t.Error("expected events to be recorded")
+	}
+}
@@ -0,0 +1,115 @@
+package rt
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+)
+
+// versionRouter splits the jobs for a jobType between its default Runnable and any canary versions
+type versionRouter struct {
+	// versions holds the canary versions in the order they were registered, and weights holds
+	// the percentage of jobs each should receive (the default Runnable receives the remainder)
+	versions []string
+	weights  map[string]int
+
+	lock sync.RWMutex
+}
+
+func newVersionRouter() *versionRouter {
+	v := &versionRouter{
+		versions: []string{},
+		weights:  map[string]int{},
+		lock:     sync.RWMutex{},
+	}
+
+	return v
+}
+
+// setWeight adds or updates a version's weight, ensuring the total stays within 100 percent
+func (v *versionRouter) setWeight(version string, weight int) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if weight < 0 || weight > 100 {
+		return fmt.Errorf("weight %d for version %s must be between 0 and 100", weight, version)
+	}
+
+	total := weight
+	for name, w := range v.weights {
+		if name != version {
+			total += w
+		}
+	}
+
+	if total > 100 {
+		return fmt.Errorf("total weight of versions would be %d, must be no more than 100", total)
+	}
+
+	if _, exists := v.weights[version]; !exists {
+		v.versions = append(v.versions, version)
+	}
+
+	v.weights[version] = weight
+
+	return nil
+}
+
+func (v *versionRouter) remove(version string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	delete(v.weights, version)
+
+	for i, name := range v.versions {
+		if name == version {
+			v.versions = append(v.versions[:i], v.versions[i+1:]...)
+			break
+		}
+	}
+}
+
+func (v *versionRouter) has(version string) bool {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	_, exists := v.weights[version]
+
+	return exists
+}
+
+func (v *versionRouter) empty() bool {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	return len(v.versions) == 0
+}
+
+// list returns the versions in the order they were registered
+func (v *versionRouter) list() []string {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	versions := make([]string, len(v.versions))
+	copy(versions, v.versions)
+
+	return versions
+}
+
+// pick chooses a version for a job according to the weights, returning "" for the default Runnable
+func (v *versionRouter) pick() string {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	n := rand.Intn(100)
+
+	for _, version := range v.versions {
+		if n < v.weights[version] {
+			return version
+		}
+
+		n -= v.weights[version]
+	}
+
+	return ""
+}
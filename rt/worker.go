@@ -13,9 +13,11 @@ const (
 	defaultChanSize = 256
 )
 
-// ErrJobTimeout and others are errors related to workers
+// ErrJobTimeout and others are errors related to workers, which the errors that jobs fail with wrap
 var (
-	ErrJobTimeout = errors.New("job timeout")
+	ErrJobTimeout         = errors.New("job timeout")
+	ErrQueueFull          = errors.New("job queue is full")
+	ErrNoWorkerRegistered = errors.New("no worker is registered")
 )
 
 type worker struct {
@@ -24,10 +26,18 @@ type worker struct {
 	options  workerOpts
 
 	defaultCaps Capabilities
+	tenants     *tenantCaps
 
 	targetThreadCount int
 	threads           []*workThread
 
+	// replacement is set when the worker is retired, and receives any jobs scheduled afterwards.
+	// retired is closed at the same time, to wake schedulers that are waiting for room in the queue,
+	// and sending counts those schedulers so that retire can wait for them to queue or pass on their jobs
+	replacement *worker
+	retired     chan struct{}
+	sending     *sync.WaitGroup
+
 	lock      *sync.RWMutex
 	reconcile *singleflight.Group
 	rate      *rateTracker
@@ -37,11 +47,14 @@ type worker struct {
 func newWorker(runner Runnable, caps Capabilities, opts workerOpts) *worker {
 	w := &worker{
 		runner:            runner,
-		workChan:          make(chan *Job, defaultChanSize),
+		workChan:          make(chan *Job, opts.queueSize()),
 		options:           opts,
 		defaultCaps:       caps,
-		targetThreadCount: opts.poolSize,
+		tenants:           newTenantCaps(opts.maxTenants),
+		targetThreadCount: opts.minThreadCount(),
 		threads:           []*workThread{},
+		retired:           make(chan struct{}),
+		sending:           &sync.WaitGroup{},
 		lock:              &sync.RWMutex{},
 		reconcile:         &singleflight.Group{},
 		rate:              newRateTracker(),
@@ -51,23 +64,150 @@ func newWorker(runner Runnable, caps Capabilities, opts workerOpts) *worker {
 }
 
 func (w *worker) schedule(job *Job) {
+	// jobs run with Ctx.Do keep the tenant of the job that ran them, along with its Capabilities
+	if w.options.tenant != nil && job.tenant == "" {
+		job.tenant = w.options.tenant(*job)
+	}
+
+	// a job that's passed on to the worker's replacement has already been queued
+	if job.queuedAt.IsZero() {
+		job.queuedAt = time.Now()
+
+		eventType := JobEventQueued
+		if job.Attempt() > 1 {
+			eventType = JobEventRetried
+		}
+
+		sendJobEvent(w.options.eventSinks, newJobEvent(eventType, job))
+	}
+
 	if job.caps == nil {
 		// make a copy so internals of the Capabilites aren't shared
-		caps := w.defaultCaps
+		caps, err := w.jobCapabilities(*job)
+		if err != nil {
+			w.fail(job, errors.Wrap(err, "failed to jobCapabilities"))
+			return
+		}
+
 		job.caps = &caps
 	}
 
 	go func() {
+		if next := w.replacedBy(); next != nil {
+			next.schedule(job)
+			return
+		}
+
 		if err := w.reconcilePoolSize(); err != nil {
-			job.result.sendErr(errors.Wrap(err, "failed to reconcilePoolSize"))
+			w.fail(job, errors.Wrap(err, "failed to reconcilePoolSize"))
 			return
 		}
 
-		w.workChan <- job
+		// hold the lock while checking for a replacement so that the worker can't be retired part way through
+		w.lock.RLock()
+
+		if w.replacement != nil {
+			next := w.replacement
+			w.lock.RUnlock()
+
+			next.schedule(job)
+			return
+		}
+
+		// with a max queue size, the channel holds exactly that many jobs, so a job that doesn't fit fails rather than waiting
+		if w.options.maxQueueSize > 0 {
+			select {
+			case w.workChan <- job:
+			default:
+				w.lock.RUnlock()
+
+				w.fail(job, errors.Wrapf(ErrQueueFull, "%d jobs are waiting", w.options.maxQueueSize))
+				return
+			}
+		} else {
+			// waiting for room in the queue could take a while, so the lock is released first and
+			// the job is passed on instead if the worker is retired in the meantime
+			w.sending.Add(1)
+			w.lock.RUnlock()
+
+			select {
+			case w.workChan <- job:
+				w.sending.Done()
+			case <-w.retired:
+				w.sending.Done()
+
+				w.replacedBy().schedule(job)
+				return
+			}
+
+			w.rate.add()
+			return
+		}
+
+		w.lock.RUnlock()
+
 		w.rate.add()
 	}()
 }
 
+// fail sends a job that couldn't be scheduled its error
+func (w *worker) fail(job *Job, err error) {
+	event := newJobEvent(JobEventFailed, job)
+	event.Error = err.Error()
+
+	sendJobEvent(w.options.eventSinks, event)
+
+	job.result.sendErr(err)
+}
+
+// retire sends any jobs scheduled from now on to the worker's replacement, waits for the
+// jobs already queued to be handled, and then stops the worker's threads (which allows
+// the Runnable to wait for its in-progress jobs to finish before de-provisioning)
+func (w *worker) retire(next *worker) error {
+	w.lock.Lock()
+	w.replacement = next
+	close(w.retired)
+	w.lock.Unlock()
+
+	// jobs that were waiting for room in the queue are either queued or passed on by now
+	w.sending.Wait()
+
+	for len(w.workChan) > 0 {
+		time.Sleep(time.Millisecond * 50)
+	}
+
+	if err := w.stop(); err != nil {
+		return errors.Wrap(err, "failed to stop")
+	}
+
+	return nil
+}
+
+// capabilities returns the Capabilities that the worker's jobs are run with
+func (w *worker) capabilities() Capabilities {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	return w.defaultCaps
+}
+
+// setCapabilities replaces the worker's Capabilities, and discards those derived from them for tenants.
+// Jobs that have already been scheduled keep the ones they were given
+func (w *worker) setCapabilities(caps Capabilities) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.defaultCaps = caps
+	w.tenants = newTenantCaps(w.options.maxTenants)
+}
+
+func (w *worker) replacedBy() *worker {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	return w.replacement
+}
+
 // start ensures the worker is ready to receive jobs
 func (w *worker) start() error {
 	if w.options.preWarm {
@@ -112,12 +252,21 @@ func (w *worker) reconcilePoolSize() error {
 	// once at any given time, because we don't want a sudden influx of jobs
 	// to wreak havoc on the Runnable (especially if it needs to provision resources)
 	_, err, _ := w.reconcile.Do("reconcile", func() (interface{}, error) {
+		provisioned := false
+
 		for {
 			w.lock.RLock()
 			actualThreadCount := len(w.threads)
 			w.lock.RUnlock()
 
 			if actualThreadCount < w.targetThreadCount {
+				// let the Runnable prepare for all of the new threads at once rather than one at a time
+				if provisioner, ok := w.runner.(ProvisioningRunnable); ok && !provisioned && w.targetThreadCount-actualThreadCount > 1 {
+					provisioner.Provision(w.targetThreadCount - actualThreadCount)
+				}
+
+				provisioned = true
+
 				if err := w.addThread(); err != nil {
 					if shouldReturn() {
 						return nil, errors.Wrap(err, "failed to addThread more than numRetries")
@@ -149,7 +298,7 @@ func (w *worker) addThread() error {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	wt := newWorkThread(w.runner, w.workChan, w.options.jobTimeoutSeconds)
+	wt := newWorkThread(w.runner, w.workChan, w.options)
 
 	// give the runner opportunity to provision resources if needed
 	if err := w.runner.OnChange(ChangeTypeStart); err != nil {
@@ -203,6 +352,15 @@ type workerOpts struct {
 	numRetries        int
 	retrySecs         int
 	preWarm           bool
+	preWarmCount      int
+	tenant            TenantFunc
+	deriveCaps        DeriveCapsFunc
+	maxTenants        int
+	observers         []JobObserver
+	eventSinks        []JobEventSink
+	slowThreshold     time.Duration
+	slowFunc          SlowJobFunc
+	maxQueueSize      int
 }
 
 func defaultOpts(jobType string) workerOpts {
@@ -214,7 +372,27 @@ func defaultOpts(jobType string) workerOpts {
 		numRetries:        5,
 		retrySecs:         3,
 		preWarm:           false,
+		preWarmCount:      0,
 	}
 
 	return o
 }
+
+// queueSize returns the size of the worker's job channel, which is the max queue size if one is set
+func (o workerOpts) queueSize() int {
+	if o.maxQueueSize > 0 {
+		return o.maxQueueSize
+	}
+
+	return defaultChanSize
+}
+
+// minThreadCount returns the number of threads a worker should keep running, which
+// is the pool size unless a larger number of threads are requested to be pre-warmed
+func (o workerOpts) minThreadCount() int {
+	if o.preWarmCount > o.poolSize {
+		return o.preWarmCount
+	}
+
+	return o.poolSize
+}
@@ -2,6 +2,7 @@ package rt
 
 import (
 	"log"
+	"runtime/pprof"
 	"testing"
 	"time"
 
@@ -78,3 +79,221 @@ func TestRunnerWithJobTimeout(t *testing.T) {
 		t.Error("job should have timed out, but did not")
 	}
 }
+
+// blockingRunner signals when each job starts, and blocks until it's released
+type blockingRunner struct {
+	started chan bool
+	release chan bool
+}
+
+func (b blockingRunner) Run(job Job, ctx *Ctx) (interface{}, error) {
+	b.started <- true
+	<-b.release
+
+	return nil, nil
+}
+
+func (b blockingRunner) OnChange(_ ChangeEvent) error {
+	return nil
+}
+
+func TestMaxQueueSize(t *testing.T) {
+	r := New()
+
+	runner := blockingRunner{started: make(chan bool, 3), release: make(chan bool, 3)}
+
+	doBlocking := r.Register("blocking", runner, MaxQueueSize(1))
+
+	running := doBlocking(nil)
+	<-runner.started
+
+	queued := doBlocking(nil)
+
+	// wait for the second job to be queued behind the first
+	for len(r.core.findWorker("blocking").workChan) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := doBlocking(nil).Then(); !errors.Is(err, ErrQueueFull) {
+		t.Error("expected ErrQueueFull, got", err)
+	}
+
+	runner.release <- true
+	runner.release <- true
+
+	for _, res := range []*Result{running, queued} {
+		if _, err := res.Then(); err != nil {
+			t.Error(errors.Wrap(err, "failed to Then"))
+		}
+	}
+}
+
+func TestMaxQueueSizeBurst(t *testing.T) {
+	r := New()
+
+	runner := blockingRunner{started: make(chan bool, 10), release: make(chan bool, 10)}
+
+	doBlocking := r.Register("blocking", runner, MaxQueueSize(2))
+
+	running := doBlocking(nil)
+	<-runner.started
+
+	// jobs scheduled at the same time must not overshoot the max queue size
+	failures := make(chan error, 8)
+
+	results := []*Result{}
+	for i := 0; i < 8; i++ {
+		res := doBlocking(nil).OnError(func(err error) {
+			failures <- err
+		})
+
+		results = append(results, res)
+	}
+
+	// wait for the jobs that didn't fit to fail before letting the queued ones run
+	for i := 0; i < 6; i++ {
+		select {
+		case <-failures:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for jobs to fail")
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		runner.release <- true
+	}
+
+	failed := 0
+	for _, res := range append(results, running) {
+		if _, err := res.Then(); errors.Is(err, ErrQueueFull) {
+			failed++
+		} else if err != nil {
+			t.Error(errors.Wrap(err, "failed to Then"))
+		}
+	}
+
+	if failed != 6 {
+		t.Errorf("expected 6 jobs to fail with ErrQueueFull, got %d", failed)
+	}
+}
+
+func TestReloadWithFullQueue(t *testing.T) {
+	r := New()
+
+	runner := blockingRunner{started: make(chan bool, 300), release: make(chan bool, 300)}
+
+	doBlocking := r.Register("blocking", runner)
+
+	running := doBlocking(nil)
+	<-runner.started
+
+	// fill the queue, and leave some jobs waiting for room in it
+	done := make(chan bool, 300)
+
+	results := []*Result{running}
+	for i := 0; i < defaultChanSize+20; i++ {
+		results = append(results, doBlocking(nil).OnSuccess(func(interface{}) {
+			done <- true
+		}))
+	}
+
+	for len(r.core.findWorker("blocking").workChan) < defaultChanSize {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the waiting jobs must not keep the worker from being retired, and are passed on to its replacement
+	if err := r.Reload("blocking", generic{}); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Reload"))
+	}
+
+	for i := 0; i < 20; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the replacement worker to run the waiting jobs")
+		}
+	}
+
+	for i := 0; i < 300; i++ {
+		runner.release <- true
+	}
+
+	for _, res := range results {
+		if _, err := res.Then(); err != nil {
+			t.Error(errors.Wrap(err, "failed to Then"))
+		}
+	}
+}
+
+func TestNoWorkerRegistered(t *testing.T) {
+	r := New()
+
+	if _, err := r.Do(NewJob("missing", nil)).Then(); !errors.Is(err, ErrNoWorkerRegistered) {
+		t.Error("expected ErrNoWorkerRegistered from Do, got", err)
+	}
+
+	if err := r.Reload("missing", generic{}); !errors.Is(err, ErrNoWorkerRegistered) {
+		t.Error("expected ErrNoWorkerRegistered from Reload, got", err)
+	}
+
+	r.Register("registered", generic{})
+
+	if err := r.Promote("registered", "v2"); !errors.Is(err, ErrNoWorkerRegistered) {
+		t.Error("expected ErrNoWorkerRegistered from Promote, got", err)
+	}
+}
+
+// labelReader returns the pprof labels that its job is run with
+type labelReader struct{}
+
+func (l labelReader) Run(job Job, ctx *Ctx) (interface{}, error) {
+	labels := map[string]string{}
+
+	pprof.ForLabels(ctx.Context(), func(key, value string) bool {
+		labels[key] = value
+		return true
+	})
+
+	return labels, nil
+}
+
+func (l labelReader) OnChange(_ ChangeEvent) error {
+	return nil
+}
+
+func TestProfileLabels(t *testing.T) {
+	r := New()
+
+	noDerive := func(tenant string, caps Capabilities) (Capabilities, error) {
+		return caps, nil
+	}
+
+	r.Register("labels", labelReader{}, TenantCaps(TenantFromMeta("tenant"), noDerive), TimeoutSeconds(1))
+
+	for tenant, expected := range map[string]map[string]string{
+		"":     {"jobType": "labels"},
+		"acme": {"jobType": "labels", "tenant": "acme"},
+	} {
+		job := NewJob("labels", nil)
+		if tenant != "" {
+			job = job.WithMeta("tenant", tenant)
+		}
+
+		res, err := r.Do(job).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		labels := res.(map[string]string)
+
+		if len(labels) != len(expected) {
+			t.Error("expected labels", expected, "got", labels)
+		}
+
+		for key, value := range expected {
+			if labels[key] != value {
+				t.Error("expected labels", expected, "got", labels)
+			}
+		}
+	}
+}
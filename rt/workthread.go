@@ -2,6 +2,7 @@ package rt
 
 import (
 	"context"
+	"runtime/pprof"
 	"time"
 )
 
@@ -9,17 +10,25 @@ type workThread struct {
 	runner         Runnable
 	workChan       chan *Job
 	timeoutSeconds int
+	observers      []JobObserver
+	eventSinks     []JobEventSink
+	slowThreshold  time.Duration
+	slowFunc       SlowJobFunc
 	context        context.Context
 	cancelFunc     context.CancelFunc
 }
 
-func newWorkThread(runner Runnable, workChan chan *Job, timeoutSeconds int) *workThread {
+func newWorkThread(runner Runnable, workChan chan *Job, opts workerOpts) *workThread {
 	ctx, cancelFunc := context.WithCancel(context.Background())
 
 	wt := &workThread{
 		runner:         runner,
 		workChan:       workChan,
-		timeoutSeconds: timeoutSeconds,
+		timeoutSeconds: opts.jobTimeoutSeconds,
+		observers:      opts.observers,
+		eventSinks:     opts.eventSinks,
+		slowThreshold:  opts.slowThreshold,
+		slowFunc:       opts.slowFunc,
 		context:        ctx,
 		cancelFunc:     cancelFunc,
 	}
@@ -30,39 +39,87 @@ func newWorkThread(runner Runnable, workChan chan *Job, timeoutSeconds int) *wor
 func (wt *workThread) run() {
 	go func() {
 		for {
-			// die if the context has been cancelled
-			if wt.context.Err() != nil {
-				break
+			var job *Job
+
+			// wait for the next job, or die if the context has been cancelled
+			select {
+			case <-wt.context.Done():
+				return
+			case job = <-wt.workChan:
 			}
 
-			// wait for the next job
-			job := <-wt.workChan
 			var err error
 
 			ctx := newCtx(job.caps)
+			ctx.jobType = job.jobType
+			ctx.jobUUID = job.uuid
+			ctx.tenant = job.tenant
+			ctx.attempt = job.Attempt()
+			ctx.depth = job.depth
+			ctx.meta = job.meta
+			ctx.stream = job.stream
+			ctx.context = jobStarted(wt.observers, *job)
+
+			// the observers are given the context they returned rather than the timeout context derived from it
+			observedCtx := ctx.context
+			start := time.Now()
+
+			started := newJobEvent(JobEventStarted, job)
+			started.QueuedMillis = millis(start.Sub(job.queuedAt))
+			sendJobEvent(wt.eventSinks, started)
+
+			stopWatching := watchSlowJob(wt.slowThreshold, wt.slowFunc, job, ctx)
 
 			var result interface{}
 
-			if wt.timeoutSeconds == 0 {
-				// we pass in a dereferenced job so that the Runner cannot modify it
-				result, err = wt.runner.Run(*job, ctx)
-			} else {
-				result, err = wt.runWithTimeout(job, ctx)
-			}
+			// label the thread (and any goroutines the Runnable starts) so that CPU profiles can be broken down by Runnable and tenant
+			pprof.Do(ctx.context, profileLabels(job), func(labelled context.Context) {
+				ctx.context = labelled
+
+				if wt.timeoutSeconds == 0 {
+					// we pass in a dereferenced job so that the Runner cannot modify it
+					result, err = wt.runner.Run(*job, ctx)
+				} else {
+					result, err = wt.runWithTimeout(job, ctx)
+				}
+			})
+
+			stopWatching()
+
+			duration := time.Since(start)
+
+			jobFinished(wt.observers, observedCtx, *job, err, duration)
+
+			finished := newJobEvent(JobEventCompleted, job)
+			finished.QueuedMillis = started.QueuedMillis
+			finished.DurationMillis = millis(duration)
 
 			if err != nil {
+				finished.Type = JobEventFailed
+				finished.Error = err.Error()
+				sendJobEvent(wt.eventSinks, finished)
+
 				job.result.sendErr(err)
 				continue
 			}
 
+			sendJobEvent(wt.eventSinks, finished)
+
 			job.result.sendResult(result)
 		}
 	}()
 }
 
 func (wt *workThread) runWithTimeout(job *Job, ctx *Ctx) (interface{}, error) {
-	resultChan := make(chan interface{})
-	errChan := make(chan error)
+	// buffered so that the Runnable's goroutine can exit even after a timeout
+	resultChan := make(chan interface{}, 1)
+	errChan := make(chan error, 1)
+
+	// the context allows the Runnable to stop its work once the job times out
+	timeoutCtx, cancel := context.WithTimeout(ctx.Context(), time.Second*time.Duration(wt.timeoutSeconds))
+	defer cancel()
+
+	ctx.context = timeoutCtx
 
 	go func() {
 		// we pass in a dereferenced job so that the Runner cannot modify it
@@ -79,11 +136,20 @@ func (wt *workThread) runWithTimeout(job *Job, ctx *Ctx) (interface{}, error) {
 		return result, nil
 	case err := <-errChan:
 		return nil, err
-	case <-time.After(time.Duration(time.Second * time.Duration(wt.timeoutSeconds))):
+	case <-timeoutCtx.Done():
 		return nil, ErrJobTimeout
 	}
 }
 
+// profileLabels returns the pprof labels that a job is run with
+func profileLabels(job *Job) pprof.LabelSet {
+	if job.tenant == "" {
+		return pprof.Labels("jobType", job.jobType)
+	}
+
+	return pprof.Labels("jobType", job.jobType, "tenant", job.tenant)
+}
+
 func (wt *workThread) Stop() {
 	wt.cancelFunc()
 }
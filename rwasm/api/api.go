@@ -9,15 +9,73 @@ func API() []runtime.HostFn {
 		ReturnResultHandler(),
 		ReturnErrorHandler(),
 		GetFFIResultHandler(),
+		TakeFFIResultHandler(),
 		FetchURLHandler(),
+		HTTPRequestHandler(),
+		FetchOpenHandler(),
+		FetchReadHandler(),
+		FetchCloseHandler(),
+		FetchStatusHandler(),
+		FetchHeaderHandler(),
+		FetchHeadersHandler(),
+		WebSocketOpenHandler(),
+		WebSocketSendHandler(),
+		WebSocketReceiveHandler(),
+		WebSocketCloseHandler(),
 		GraphQLQueryHandler(),
+		GraphQLRequestHandler(),
+		GraphQLHeadersHandler(),
+		GRPCCallHandler(),
+		DNSResolveHandler(),
+		DBQueryHandler(),
+		DBExecHandler(),
+		RedisCommandHandler(),
 		CacheSetHandler(),
 		CacheGetHandler(),
+		CacheDeleteHandler(),
+		CacheKeysHandler(),
+		CacheIncrHandler(),
+		CacheCASHandler(),
+		LockAcquireHandler(),
+		LockReleaseHandler(),
+		BlobPutHandler(),
+		BlobGetHandler(),
+		BlobListHandler(),
+		BlobPresignHandler(),
+		SecretGetHandler(),
+		JWTClaimsHandler(),
+		ConfigGetHandler(),
+		CryptoHashHandler(),
+		CryptoHMACHandler(),
+		CryptoSignHandler(),
+		CryptoVerifyHandler(),
+		CryptoEncryptHandler(),
+		CryptoDecryptHandler(),
+		RandomBytesHandler(),
+		IDNewHandler(),
+		TimeNowHandler(),
+		SleepMSHandler(),
+		MessageSendHandler(),
+		BrokerPublishHandler(),
+		RunJobHandler(),
+		JobMetaGetHandler(),
 		LogMsgHandler(),
+		LogStructuredHandler(),
+		MetricCounterAddHandler(),
+		MetricGaugeSetHandler(),
+		MetricHistogramObserveHandler(),
+		SendEmailHandler(),
 		RequestGetFieldHandler(),
+		RequestGetBodyHandler(),
+		RequestGetInfoHandler(),
 		RespSetHeaderHandler(),
+		RespWriteChunkHandler(),
 		GetStaticFileHandler(),
+		RenderTemplateHandler(),
+		FileReadHandler(),
+		FileWriteHandler(),
 		AbortHandler(),
+		AbortStatusHandler(),
 	}
 
 	return api
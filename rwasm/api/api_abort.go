@@ -1,6 +1,7 @@
 package api
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/pkg/errors"
@@ -33,8 +34,16 @@ func return_abort(msgPtr int32, msgSize int32, filePtr int32, fileSize int32, li
 		return -1
 	}
 
-	msg := inst.ReadMemory(msgPtr, msgSize)
-	fileName := inst.ReadMemory(filePtr, fileSize)
+	msg, err := inst.ReadMemory(msgPtr, msgSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+	fileName, err := inst.ReadMemory(filePtr, fileSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 
 	errMsg := fmt.Sprintf("runnable abort: %s; file: %s, line: %d, col: %d", msg, fileName, lineNum, columnNum)
 	runtime.InternalLogger().ErrorString(errMsg)
@@ -43,3 +52,64 @@ func return_abort(msgPtr int32, msgSize int32, filePtr int32, fileSize int32, li
 
 	return 0
 }
+
+// AbortStatusHandler returns the return_abort_status host function, which aborts the job with an HTTP
+// status code and a JSON error payload rather than only a message
+func AbortStatusHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		status := args[0].(int32)
+		msgPtr := args[1].(int32)
+		msgSize := args[2].(int32)
+		bodyPtr := args[3].(int32)
+		bodySize := args[4].(int32)
+		ident := args[5].(int32)
+
+		ret := return_abort_status(status, msgPtr, msgSize, bodyPtr, bodySize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("return_abort_status", 6, true, fn)
+}
+
+// return_abort_status sends a RunErr with the status as its code and the payload as its body, and returns 0 or a negative
+// error code, in which case the job isn't aborted. A body size of 0 aborts without a payload
+func return_abort_status(status int32, msgPtr int32, msgSize int32, bodyPtr int32, bodySize int32, ident int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(ident, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	if status < 400 || status > 599 {
+		runtime.InternalLogger().ErrorString("[rwasm] invalid abort status provided: ", status)
+		return -2
+	}
+
+	msg, err := inst.ReadMemory(msgPtr, msgSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	var body json.RawMessage
+
+	if bodySize > 0 {
+		body, err = inst.ReadMemory(bodyPtr, bodySize)
+		if err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+			return -1
+		}
+
+		if !json.Valid(body) {
+			runtime.InternalLogger().ErrorString("[rwasm] abort body is not valid JSON")
+			return -3
+		}
+	}
+
+	runtime.InternalLogger().ErrorString(fmt.Sprintf("runnable abort: %d %s", status, msg))
+
+	inst.SendExecutionResult(nil, &rt.RunErr{Code: int(status), Message: string(msg), Body: string(body)})
+
+	return 0
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// BlobPutHandler returns the blob_put host function, which stores an object in the blob store
+func BlobPutHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := blob_put(keyPointer, keySize, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("blob_put", 5, true, fn)
+}
+
+func blob_put(keyPointer, keySize, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	if len(key) == 0 {
+		runtime.InternalLogger().ErrorString("blob_put requires a key")
+		return -2
+	}
+
+	ctx, cancel := callContext(inst, "blob_put")
+	defer cancel()
+
+	if err := inst.Ctx().BlobStore.Put(ctx, string(key), data, ""); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to BlobStore.Put"))
+		return -3
+	}
+
+	return 0
+}
+
+// BlobGetHandler returns the blob_get host function, which gets an object from the blob store
+func BlobGetHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := blob_get(keyPointer, keySize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("blob_get", 3, true, fn)
+}
+
+// blob_get sets the FFI result to the object and returns its size, or -2 if it doesn't exist
+func blob_get(keyPointer, keySize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	ctx, cancel := callContext(inst, "blob_get")
+	defer cancel()
+
+	data, err := inst.Ctx().BlobStore.Get(ctx, string(key))
+	if err != nil {
+		if errors.Is(err, rcap.ErrBlobNotFound) {
+			return -2
+		}
+
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to BlobStore.Get"))
+		return -3
+	}
+
+	inst.SetFFIResult(data)
+
+	return int32(len(data))
+}
+
+// BlobListHandler returns the blob_list host function, which lists the objects in the blob store
+func BlobListHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		prefixPointer := args[0].(int32)
+		prefixSize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := blob_list(prefixPointer, prefixSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("blob_list", 3, true, fn)
+}
+
+// blob_list sets the FFI result to a JSON array of the keys that begin with the prefix, and returns its size
+func blob_list(prefixPointer, prefixSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	prefix, err := inst.ReadMemory(prefixPointer, prefixSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	ctx, cancel := callContext(inst, "blob_list")
+	defer cancel()
+
+	keys, err := inst.Ctx().BlobStore.List(ctx, string(prefix))
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to BlobStore.List"))
+		return -3
+	}
+
+	keysJSON, err := json.Marshal(keys)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Marshal"))
+		return -3
+	}
+
+	inst.SetFFIResult(keysJSON)
+
+	return int32(len(keysJSON))
+}
+
+// BlobPresignHandler returns the blob_presign host function, which creates a presigned URL for an object
+func BlobPresignHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		methodPointer := args[0].(int32)
+		methodSize := args[1].(int32)
+		keyPointer := args[2].(int32)
+		keySize := args[3].(int32)
+		expirySeconds := args[4].(int32)
+		ident := args[5].(int32)
+
+		ret := blob_presign(methodPointer, methodSize, keyPointer, keySize, expirySeconds, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("blob_presign", 6, true, fn)
+}
+
+// blob_presign sets the FFI result to a URL that can be used to GET or PUT the object until it expires, and returns its size
+func blob_presign(methodPointer, methodSize, keyPointer, keySize, expirySeconds, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	method, err := inst.ReadMemory(methodPointer, methodSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	expiry := time.Duration(expirySeconds) * time.Second
+
+	ctx, cancel := callContext(inst, "blob_presign")
+	defer cancel()
+
+	presigned, err := inst.Ctx().BlobStore.PresignURL(ctx, string(method), string(key), expiry)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to BlobStore.PresignURL"))
+		return -3
+	}
+
+	inst.SetFFIResult([]byte(presigned))
+
+	return int32(len(presigned))
+}
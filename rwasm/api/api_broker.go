@@ -0,0 +1,63 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// BrokerPublishHandler returns the broker_publish host function, which publishes a message to an external message broker
+func BrokerPublishHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		topicPointer := args[0].(int32)
+		topicSize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := broker_publish(topicPointer, topicSize, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("broker_publish", 5, true, fn)
+}
+
+// broker_publish publishes data to a topic with the host's publisher, and returns 0 or a negative error code
+func broker_publish(topicPointer, topicSize, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	topic, err := inst.ReadMemory(topicPointer, topicSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	ctx, cancel := callContext(inst, "broker_publish")
+	defer cancel()
+
+	if err := inst.Ctx().MessageBroker.Publish(ctx, string(topic), data); err != nil {
+		runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] failed to Publish to %s", topic))
+
+		switch {
+		case errors.Is(err, rcap.ErrCapabilityNotEnabled), errors.Is(err, rcap.ErrBrokerPublisherNotSet):
+			return -2
+		case errors.Is(err, rcap.ErrBrokerTopicDisallowed):
+			return -4
+		}
+
+		return -3
+	}
+
+	return 0
+}
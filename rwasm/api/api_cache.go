@@ -1,7 +1,11 @@
 package api
 
 import (
+	"encoding/json"
+	"strconv"
+
 	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
 	"github.com/suborbital/reactr/rwasm/runtime"
 )
 
@@ -29,12 +33,23 @@ func cache_set(keyPointer int32, keySize int32, valPointer int32, valSize int32,
 		return -1
 	}
 
-	key := inst.ReadMemory(keyPointer, keySize)
-	val := inst.ReadMemory(valPointer, valSize)
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+	val, err := inst.ReadMemory(valPointer, valSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 
 	runtime.InternalLogger().Debug("[rwasm] setting cache key", string(key))
 
-	if err := inst.Ctx().Cache.Set(string(key), val, int(ttl)); err != nil {
+	ctx, cancel := callContext(inst, "cache_set")
+	defer cancel()
+
+	if err := rcap.CacheWithContext(inst.Ctx().Cache, ctx).Set(string(key), val, int(ttl)); err != nil {
 		runtime.InternalLogger().ErrorString("[rwasm] failed to set cache key", string(key), err.Error())
 		return -2
 	}
@@ -63,11 +78,18 @@ func cache_get(keyPointer int32, keySize int32, identifier int32) int32 {
 		return -1
 	}
 
-	key := inst.ReadMemory(keyPointer, keySize)
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 
 	runtime.InternalLogger().Debug("[rwasm] getting cache key", string(key))
 
-	val, err := inst.Ctx().Cache.Get(string(key))
+	ctx, cancel := callContext(inst, "cache_get")
+	defer cancel()
+
+	val, err := rcap.CacheWithContext(inst.Ctx().Cache, ctx).Get(string(key))
 	if err != nil {
 		runtime.InternalLogger().ErrorString("[rwasm] failed to get cache key", string(key), err.Error())
 		return -2
@@ -77,3 +99,207 @@ func cache_get(keyPointer int32, keySize int32, identifier int32) int32 {
 
 	return int32(len(val))
 }
+
+func CacheDeleteHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := cache_delete(keyPointer, keySize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("cache_delete", 3, true, fn)
+}
+
+func cache_delete(keyPointer int32, keySize int32, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	runtime.InternalLogger().Debug("[rwasm] deleting cache key", string(key))
+
+	ctx, cancel := callContext(inst, "cache_delete")
+	defer cancel()
+
+	if err := rcap.CacheWithContext(inst.Ctx().Cache, ctx).Delete(string(key)); err != nil {
+		runtime.InternalLogger().ErrorString("[rwasm] failed to delete cache key", string(key), err.Error())
+		return -2
+	}
+
+	return 0
+}
+
+func CacheKeysHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		prefixPointer := args[0].(int32)
+		prefixSize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := cache_keys(prefixPointer, prefixSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("cache_keys", 3, true, fn)
+}
+
+// cache_keys sets the FFI result to a JSON array of the cache keys that begin with the prefix, and returns its size
+func cache_keys(prefixPointer int32, prefixSize int32, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	prefix, err := inst.ReadMemory(prefixPointer, prefixSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	runtime.InternalLogger().Debug("[rwasm] listing cache keys with prefix", string(prefix))
+
+	ctx, cancel := callContext(inst, "cache_keys")
+	defer cancel()
+
+	keys, err := rcap.CacheWithContext(inst.Ctx().Cache, ctx).Keys(string(prefix))
+	if err != nil {
+		runtime.InternalLogger().ErrorString("[rwasm] failed to list cache keys with prefix", string(prefix), err.Error())
+		return -2
+	}
+
+	keysJSON, err := json.Marshal(keys)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Marshal"))
+		return -2
+	}
+
+	inst.SetFFIResult(keysJSON)
+
+	return int32(len(keysJSON))
+}
+
+func CacheIncrHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		delta := args[2].(int32)
+		ident := args[3].(int32)
+
+		ret := cache_incr(keyPointer, keySize, delta, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("cache_incr", 4, true, fn)
+}
+
+// cache_incr atomically adds delta (which can be negative) to the integer stored at a key, starting from 0 if
+// the key doesn't exist, and sets the FFI result to the new value in base 10, returning its size
+func cache_incr(keyPointer int32, keySize int32, delta int32, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	runtime.InternalLogger().Debug("[rwasm] incrementing cache key", string(key))
+
+	ctx, cancel := callContext(inst, "cache_incr")
+	defer cancel()
+
+	val, err := rcap.CacheWithContext(inst.Ctx().Cache, ctx).Increment(string(key), int64(delta))
+	if err != nil {
+		runtime.InternalLogger().ErrorString("[rwasm] failed to increment cache key", string(key), err.Error())
+		return -2
+	}
+
+	result := []byte(strconv.FormatInt(val, 10))
+
+	inst.SetFFIResult(result)
+
+	return int32(len(result))
+}
+
+func CacheCASHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		oldPointer := args[2].(int32)
+		oldSize := args[3].(int32)
+		valPointer := args[4].(int32)
+		valSize := args[5].(int32)
+		ttl := args[6].(int32)
+		ident := args[7].(int32)
+
+		ret := cache_cas(keyPointer, keySize, oldPointer, oldSize, valPointer, valSize, ttl, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("cache_cas", 8, true, fn)
+}
+
+// cache_cas atomically sets a key to a new value if its current value is old, or if old is empty and the
+// key doesn't exist, and returns 1 if it was set, 0 if it wasn't, or a negative error code
+func cache_cas(keyPointer, keySize, oldPointer, oldSize, valPointer, valSize, ttl, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	var old []byte
+	if oldSize > 0 {
+		if old, err = inst.ReadMemory(oldPointer, oldSize); err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+			return -1
+		}
+	}
+
+	val, err := inst.ReadMemory(valPointer, valSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	runtime.InternalLogger().Debug("[rwasm] swapping cache key", string(key))
+
+	ctx, cancel := callContext(inst, "cache_cas")
+	defer cancel()
+
+	swapped, err := rcap.CacheWithContext(inst.Ctx().Cache, ctx).CompareAndSwap(string(key), old, val, int(ttl))
+	if err != nil {
+		runtime.InternalLogger().ErrorString("[rwasm] failed to swap cache key", string(key), err.Error())
+		return -2
+	}
+
+	if !swapped {
+		return 0
+	}
+
+	return 1
+}
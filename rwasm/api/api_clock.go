@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// TimeNowHandler returns the time_now host function, which gets the current time from the Clock capability
+func TimeNowHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		pointer := args[0].(int32)
+		ident := args[1].(int32)
+
+		ret := time_now(pointer, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("time_now", 2, true, fn)
+}
+
+// time_now writes the wall clock time and the monotonic time as two little-endian int64 nanosecond counts at pointer,
+// and returns 0, or a negative error code
+func time_now(pointer, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	now, err := inst.Ctx().Clock.Now()
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Clock.Now"))
+		return -2
+	}
+
+	monotonic, err := inst.Ctx().Clock.Monotonic()
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Clock.Monotonic"))
+		return -2
+	}
+
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf, uint64(now.UnixNano()))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(monotonic.Nanoseconds()))
+
+	if err := inst.WriteMemoryAtLocation(pointer, buf); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to WriteMemoryAtLocation"))
+		return -1
+	}
+
+	return 0
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// ConfigGetHandler returns the config_get host function, which reads a value from the host's configuration
+func ConfigGetHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := config_get(keyPointer, keySize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("config_get", 3, true, fn)
+}
+
+// config_get sets the FFI result to the value and returns its size, or a negative error code
+func config_get(keyPointer, keySize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	val, err := inst.Ctx().Configuration.Get(string(key))
+	if err != nil {
+		switch {
+		case errors.Is(err, rcap.ErrConfigKeyNotFound):
+			return -2
+		case errors.Is(err, rcap.ErrConfigKeyDisallowed), errors.Is(err, rcap.ErrCapabilityNotEnabled):
+			runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] configuration key %s can't be read", key))
+			return -5
+		}
+
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Configuration.Get"))
+		return -3
+	}
+
+	inst.SetFFIResult([]byte(val))
+
+	return int32(len(val))
+}
@@ -0,0 +1,19 @@
+package api
+
+import (
+	"context"
+
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// callContext returns the context for a call to the named host function, which is cancelled when the job is
+// (such as when it times out) or when the call's timeout from the Runnable's timeouts capability passes
+func callContext(inst *runtime.WasmInstance, hostFn string) (context.Context, context.CancelFunc) {
+	ctx := inst.Ctx()
+
+	if ctx.Capabilities == nil || ctx.Timeouts == nil {
+		return context.WithCancel(ctx.Context())
+	}
+
+	return ctx.Timeouts.Context(ctx.Context(), hostFn)
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// CryptoHashHandler returns the crypto_hash host function, which hashes data with SHA-256 or SHA-512
+func CryptoHashHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		algPointer := args[0].(int32)
+		algSize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := crypto_hash(algPointer, algSize, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("crypto_hash", 5, true, fn)
+}
+
+// crypto_hash sets the FFI result to the digest and returns its size, or a negative error code
+func crypto_hash(algPointer, algSize, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	alg, err := inst.ReadMemory(algPointer, algSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	digest, err := inst.Ctx().Crypto.Hash(string(alg), data)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Crypto.Hash"))
+		return cryptoErrorCode(err)
+	}
+
+	inst.SetFFIResult(digest)
+
+	return int32(len(digest))
+}
+
+// CryptoHMACHandler returns the crypto_hmac host function, which authenticates data with a key held by the host
+func CryptoHMACHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		algPointer := args[0].(int32)
+		algSize := args[1].(int32)
+		keyPointer := args[2].(int32)
+		keySize := args[3].(int32)
+		dataPointer := args[4].(int32)
+		dataSize := args[5].(int32)
+		ident := args[6].(int32)
+
+		ret := crypto_hmac(algPointer, algSize, keyPointer, keySize, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("crypto_hmac", 7, true, fn)
+}
+
+// crypto_hmac sets the FFI result to the HMAC and returns its size, or a negative error code
+func crypto_hmac(algPointer, algSize, keyPointer, keySize, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	alg, err := inst.ReadMemory(algPointer, algSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	keyName, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	mac, err := inst.Ctx().Crypto.HMAC(string(alg), string(keyName), data)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Crypto.HMAC"))
+		return cryptoErrorCode(err)
+	}
+
+	inst.SetFFIResult(mac)
+
+	return int32(len(mac))
+}
+
+// CryptoSignHandler returns the crypto_sign host function, which signs data with a key held by the host
+func CryptoSignHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := crypto_sign(keyPointer, keySize, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("crypto_sign", 5, true, fn)
+}
+
+// crypto_sign sets the FFI result to the signature and returns its size, or a negative error code
+func crypto_sign(keyPointer, keySize, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	keyName, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	signature, err := inst.Ctx().Crypto.Sign(string(keyName), data)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Crypto.Sign"))
+		return cryptoErrorCode(err)
+	}
+
+	inst.SetFFIResult(signature)
+
+	return int32(len(signature))
+}
+
+// CryptoVerifyHandler returns the crypto_verify host function, which verifies a signature with a key held by the host
+func CryptoVerifyHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		sigPointer := args[4].(int32)
+		sigSize := args[5].(int32)
+		ident := args[6].(int32)
+
+		ret := crypto_verify(keyPointer, keySize, dataPointer, dataSize, sigPointer, sigSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("crypto_verify", 7, true, fn)
+}
+
+// crypto_verify returns 1 if the signature is valid, 0 if it isn't, or a negative error code
+func crypto_verify(keyPointer, keySize, dataPointer, dataSize, sigPointer, sigSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	keyName, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	signature, err := inst.ReadMemory(sigPointer, sigSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	valid, err := inst.Ctx().Crypto.Verify(string(keyName), data, signature)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Crypto.Verify"))
+		return cryptoErrorCode(err)
+	}
+
+	if !valid {
+		return 0
+	}
+
+	return 1
+}
+
+// CryptoEncryptHandler returns the crypto_encrypt host function, which encrypts data with AES-GCM using a key held by the host
+func CryptoEncryptHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		adPointer := args[4].(int32)
+		adSize := args[5].(int32)
+		ident := args[6].(int32)
+
+		ret := crypto_encrypt(keyPointer, keySize, dataPointer, dataSize, adPointer, adSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("crypto_encrypt", 7, true, fn)
+}
+
+// crypto_encrypt sets the FFI result to the nonce and ciphertext and returns its size, or a negative error code
+func crypto_encrypt(keyPointer, keySize, dataPointer, dataSize, adPointer, adSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	keyName, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	additionalData, err := inst.ReadMemory(adPointer, adSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	ciphertext, err := inst.Ctx().Crypto.Encrypt(string(keyName), data, additionalData)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Crypto.Encrypt"))
+		return cryptoErrorCode(err)
+	}
+
+	inst.SetFFIResult(ciphertext)
+
+	return int32(len(ciphertext))
+}
+
+// CryptoDecryptHandler returns the crypto_decrypt host function, which decrypts data encrypted by crypto_encrypt
+func CryptoDecryptHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		adPointer := args[4].(int32)
+		adSize := args[5].(int32)
+		ident := args[6].(int32)
+
+		ret := crypto_decrypt(keyPointer, keySize, dataPointer, dataSize, adPointer, adSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("crypto_decrypt", 7, true, fn)
+}
+
+// crypto_decrypt sets the FFI result to the plaintext and returns its size, or a negative error code
+func crypto_decrypt(keyPointer, keySize, dataPointer, dataSize, adPointer, adSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	keyName, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	additionalData, err := inst.ReadMemory(adPointer, adSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	plaintext, err := inst.Ctx().Crypto.Decrypt(string(keyName), data, additionalData)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Crypto.Decrypt"))
+		return cryptoErrorCode(err)
+	}
+
+	inst.SetFFIResult(plaintext)
+
+	return int32(len(plaintext))
+}
+
+// cryptoErrorCode returns the error code for a failed crypto operation
+func cryptoErrorCode(err error) int32 {
+	switch {
+	case errors.Is(err, rcap.ErrCryptoKeyNotFound):
+		return -2
+	case errors.Is(err, rcap.ErrCryptoAlgorithmUnsupported), errors.Is(err, rcap.ErrCryptoKeyUnsuitable):
+		return -3
+	case errors.Is(err, rcap.ErrCryptoKeyDisallowed), errors.Is(err, rcap.ErrCapabilityNotEnabled):
+		return -5
+	case errors.Is(err, rcap.ErrCryptoDecryptFailed):
+		return -6
+	}
+
+	return -4
+}
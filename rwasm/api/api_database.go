@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// DBQueryHandler returns the db_query host function, which runs a statement that returns rows
+func DBQueryHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		queryPointer := args[0].(int32)
+		querySize := args[1].(int32)
+		argsPointer := args[2].(int32)
+		argsSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := db_query(queryPointer, querySize, argsPointer, argsSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("db_query", 5, true, fn)
+}
+
+// db_query runs a query on behalf of the wasm runner, filling its placeholders with the arguments (a JSON array), and
+// sets the FFI result to the rows as a JSON array of objects keyed by column name, returning its size
+func db_query(queryPointer, querySize, argsPointer, argsSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	query, args, code := readDatabaseStatement(inst, queryPointer, querySize, argsPointer, argsSize)
+	if code < 0 {
+		return code
+	}
+
+	ctx, cancel := callContext(inst, "db_query")
+	defer cancel()
+
+	rows, err := inst.Ctx().Database.Query(ctx, query, args)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Database.Query"))
+
+		if errors.Is(err, rcap.ErrDatabaseTooManyRows) {
+			return -4
+		}
+
+		return -3
+	}
+
+	inst.SetFFIResult(rows)
+
+	return int32(len(rows))
+}
+
+// DBExecHandler returns the db_exec host function, which runs a statement that doesn't return rows
+func DBExecHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		queryPointer := args[0].(int32)
+		querySize := args[1].(int32)
+		argsPointer := args[2].(int32)
+		argsSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := db_exec(queryPointer, querySize, argsPointer, argsSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("db_exec", 5, true, fn)
+}
+
+// db_exec runs a statement like db_query, and sets the FFI result to a JSON object
+// with its rowsAffected and lastInsertId, returning its size
+func db_exec(queryPointer, querySize, argsPointer, argsSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	query, args, code := readDatabaseStatement(inst, queryPointer, querySize, argsPointer, argsSize)
+	if code < 0 {
+		return code
+	}
+
+	ctx, cancel := callContext(inst, "db_exec")
+	defer cancel()
+
+	result, err := inst.Ctx().Database.Exec(ctx, query, args)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Database.Exec"))
+		return -3
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Marshal"))
+		return -3
+	}
+
+	inst.SetFFIResult(resultJSON)
+
+	return int32(len(resultJSON))
+}
+
+// readDatabaseStatement reads a statement and its arguments from the wasm runner's memory, or returns a negative error code
+func readDatabaseStatement(inst *runtime.WasmInstance, queryPointer, querySize, argsPointer, argsSize int32) (string, []interface{}, int32) {
+	queryBytes, err := inst.ReadMemory(queryPointer, querySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return "", nil, -1
+	}
+
+	argsBytes, err := inst.ReadMemory(argsPointer, argsSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return "", nil, -1
+	}
+
+	if len(queryBytes) == 0 {
+		runtime.InternalLogger().ErrorString("database statement is empty")
+		return "", nil, -2
+	}
+
+	args, err := decodeDatabaseArgs(argsBytes)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "could not parse database arguments"))
+		return "", nil, -2
+	}
+
+	return string(queryBytes), args, 0
+}
+
+// decodeDatabaseArgs decodes a JSON array into statement arguments, with
+// whole numbers as int64 and other numbers as float64
+func decodeDatabaseArgs(argsJSON []byte) ([]interface{}, error) {
+	if len(bytes.TrimSpace(argsJSON)) == 0 {
+		return []interface{}{}, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(argsJSON))
+	decoder.UseNumber()
+
+	args := []interface{}{}
+	if err := decoder.Decode(&args); err != nil {
+		return nil, errors.Wrap(err, "failed to Decode")
+	}
+
+	for i, arg := range args {
+		switch a := arg.(type) {
+		case json.Number:
+			if intVal, err := a.Int64(); err == nil {
+				args[i] = intVal
+			} else if floatVal, err := a.Float64(); err == nil {
+				args[i] = floatVal
+			} else {
+				return nil, fmt.Errorf("invalid number %s", a)
+			}
+		case string, bool, nil:
+		default:
+			return nil, fmt.Errorf("argument %d is a %T, only strings, numbers, booleans and null are supported", i, arg)
+		}
+	}
+
+	return args, nil
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// DNSResolveHandler returns the dns_resolve host function, which resolves DNS records with the host's resolver
+func DNSResolveHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		namePointer := args[0].(int32)
+		nameSize := args[1].(int32)
+		typePointer := args[2].(int32)
+		typeSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := dns_resolve(namePointer, nameSize, typePointer, typeSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("dns_resolve", 5, true, fn)
+}
+
+// dns_resolve sets the FFI result to the records as a JSON array of strings and returns its size, or a negative error code
+func dns_resolve(namePointer, nameSize, typePointer, typeSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	name, err := inst.ReadMemory(namePointer, nameSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	recordType, err := inst.ReadMemory(typePointer, typeSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	ctx, cancel := callContext(inst, "dns_resolve")
+	defer cancel()
+
+	records, err := inst.Ctx().DNS.Resolve(ctx, string(name), string(recordType))
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] failed to Resolve %s", name))
+
+		switch {
+		case errors.Is(err, rcap.ErrCapabilityNotEnabled):
+			return -2
+		case errors.Is(err, rcap.ErrDNSRecordTypeInvalid):
+			return -3
+		case errors.Is(err, rcap.ErrDNSNameDisallowed):
+			return -5
+		}
+
+		return -4
+	}
+
+	recordsJSON, err := json.Marshal(records)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Marshal records"))
+		return -4
+	}
+
+	inst.SetFFIResult(recordsJSON)
+
+	return int32(len(recordsJSON))
+}
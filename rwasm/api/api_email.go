@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// SendEmailHandler returns the send_email host function, which sends an email with the host's email sender
+func SendEmailHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		msgPointer := args[0].(int32)
+		msgSize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := send_email(msgPointer, msgSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("send_email", 3, true, fn)
+}
+
+// send_email reads an email as a JSON rcap.EmailMessage, sends it, and returns 0 or a negative error code
+func send_email(msgPointer, msgSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	msgBytes, err := inst.ReadMemory(msgPointer, msgSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	msg := rcap.EmailMessage{}
+	if err := json.Unmarshal(msgBytes, &msg); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Unmarshal email"))
+		return -3
+	}
+
+	ctx, cancel := callContext(inst, "send_email")
+	defer cancel()
+
+	if err := inst.Ctx().Email.Send(ctx, msg); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Send email"))
+
+		switch {
+		case errors.Is(err, rcap.ErrCapabilityNotEnabled), errors.Is(err, rcap.ErrEmailSenderNotSet):
+			return -2
+		case errors.Is(err, rcap.ErrEmailInvalid):
+			return -3
+		case errors.Is(err, rcap.ErrEmailRateLimited):
+			return -4
+		case errors.Is(err, rcap.ErrEmailAddressDisallowed):
+			return -5
+		}
+
+		return -6
+	}
+
+	return 0
+}
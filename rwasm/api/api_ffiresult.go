@@ -31,7 +31,46 @@ func get_ffi_result(pointer int32, identifier int32) int32 {
 		return -1
 	}
 
-	inst.WriteMemoryAtLocation(pointer, result)
+	if err := inst.WriteMemoryAtLocation(pointer, result); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to WriteMemoryAtLocation"))
+		return -1
+	}
 
 	return 0
 }
+
+// TakeFFIResultHandler returns the pending FFI result to the module in a single call, as a pointer to memory
+// allocated within the module and the result's length, rather than requiring a second call to get_ffi_result
+func TakeFFIResultHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		ident := args[0].(int32)
+
+		pointer, size := take_ffi_result(ident)
+
+		return []int32{pointer, size}, nil
+	}
+
+	return runtime.NewMultiReturnHostFn("take_ffi_result", 1, 2, fn)
+}
+
+func take_ffi_result(identifier int32) (int32, int32) {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to instanceForIdentifier"))
+		return -1, 0
+	}
+
+	result, err := inst.UseFFIResult()
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to useFFIResult"))
+		return -1, 0
+	}
+
+	pointer, err := inst.WriteMemory(result)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to WriteMemory"))
+		return -1, 0
+	}
+
+	return pointer, int32(len(result))
+}
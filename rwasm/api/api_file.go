@@ -0,0 +1,120 @@
+package api
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// FileReadHandler returns the file_read host function, which reads a file from the File capability's directory
+func FileReadHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		pathPointer := args[0].(int32)
+		pathSize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := file_read(pathPointer, pathSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("file_read", 3, true, fn)
+}
+
+// file_read sets the FFI result to the contents of the file and returns its size, or a negative error code
+func file_read(pathPointer, pathSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	path, err := inst.ReadMemory(pathPointer, pathSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	files, err := rcap.FileDirectory(inst.Ctx().FileSource)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to FileDirectory"))
+		return fileErrorCode(err)
+	}
+
+	data, err := files.ReadFile(string(path))
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadFile"))
+		return fileErrorCode(err)
+	}
+
+	inst.SetFFIResult(data)
+
+	return int32(len(data))
+}
+
+// FileWriteHandler returns the file_write host function, which writes a file to the File capability's directory
+func FileWriteHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		pathPointer := args[0].(int32)
+		pathSize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := file_write(pathPointer, pathSize, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("file_write", 5, true, fn)
+}
+
+// file_write replaces (or creates) the file with the data, and returns 0 or a negative error code
+func file_write(pathPointer, pathSize, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	path, err := inst.ReadMemory(pathPointer, pathSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	files, err := rcap.FileDirectory(inst.Ctx().FileSource)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to FileDirectory"))
+		return fileErrorCode(err)
+	}
+
+	if err := files.WriteFile(string(path), data); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to WriteFile"))
+		return fileErrorCode(err)
+	}
+
+	return 0
+}
+
+// fileErrorCode returns the error code for a failed file read or write
+func fileErrorCode(err error) int32 {
+	switch {
+	case errors.Is(err, rcap.ErrCapabilityNotEnabled), errors.Is(err, rcap.ErrFileDirectoryNotSet), errors.Is(err, rcap.ErrFileDirectoryNotSupported):
+		return -2
+	case errors.Is(err, os.ErrNotExist):
+		return -3
+	case errors.Is(err, rcap.ErrFilePathDisallowed), errors.Is(err, rcap.ErrFileWriteNotAllowed):
+		return -5
+	}
+
+	return -4
+}
@@ -2,8 +2,10 @@ package api
 
 import (
 	"encoding/json"
+	"net/http"
 
 	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
 	"github.com/suborbital/reactr/rwasm/runtime"
 )
 
@@ -30,15 +32,42 @@ func graphql_query(endpointPointer int32, endpointSize int32, queryPointer int32
 		return -1
 	}
 
-	endpointBytes := inst.ReadMemory(endpointPointer, endpointSize)
+	endpointBytes, err := inst.ReadMemory(endpointPointer, endpointSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 	endpoint := string(endpointBytes)
 
-	queryBytes := inst.ReadMemory(queryPointer, querySize)
+	queryBytes, err := inst.ReadMemory(queryPointer, querySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 	query := string(queryBytes)
 
-	resp, err := inst.Ctx().GraphQLClient.Do(inst.Ctx().Auth, endpoint, query)
+	req := rcap.GraphQLRequest{
+		Query:     query,
+		Variables: map[string]interface{}{},
+	}
+
+	ctx, cancel := callContext(inst, "graphql_query")
+	defer cancel()
+
+	auth, err := requestAuth(ctx, inst, endpoint)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to requestAuth"))
+		return -1
+	}
+
+	resp, err := inst.Ctx().GraphQLClient.DoRequestWithContext(ctx, auth, endpoint, req, graphqlHeaders(inst))
 	if err != nil {
-		runtime.InternalLogger().Error(errors.Wrap(err, "failed to GraphQLClient.Do"))
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to GraphQLClient.DoRequestWithContext"))
+
+		if errors.Is(err, rcap.ErrGraphQLHeaderDisallowed) {
+			return -5
+		}
+
 		return -1
 	}
 
@@ -52,3 +81,154 @@ func graphql_query(endpointPointer int32, endpointSize int32, queryPointer int32
 
 	return int32(len(respBytes))
 }
+
+// GraphQLRequestHandler returns the graphql_request host function, which sends a query to a GraphQL endpoint
+// with its variables and operation name kept separate from the query
+func GraphQLRequestHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		endpointPointer := args[0].(int32)
+		endpointSize := args[1].(int32)
+		queryPointer := args[2].(int32)
+		querySize := args[3].(int32)
+		variablesPointer := args[4].(int32)
+		variablesSize := args[5].(int32)
+		operationPointer := args[6].(int32)
+		operationSize := args[7].(int32)
+		ident := args[8].(int32)
+
+		ret := graphql_request(endpointPointer, endpointSize, queryPointer, querySize, variablesPointer, variablesSize, operationPointer, operationSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("graphql_request", 9, true, fn)
+}
+
+// graphql_request sets the FFI result to the JSON response and returns its size, or a negative error code.
+// The variables are a JSON object, and either they or the operation name can be empty
+func graphql_request(endpointPointer, endpointSize, queryPointer, querySize, variablesPointer, variablesSize, operationPointer, operationSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	endpointBytes, err := inst.ReadMemory(endpointPointer, endpointSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	queryBytes, err := inst.ReadMemory(queryPointer, querySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	variablesBytes, err := inst.ReadMemory(variablesPointer, variablesSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	operationBytes, err := inst.ReadMemory(operationPointer, operationSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	req := rcap.GraphQLRequest{
+		Query:         string(queryBytes),
+		Variables:     map[string]interface{}{},
+		OperationName: string(operationBytes),
+	}
+
+	if len(variablesBytes) > 0 {
+		if err := json.Unmarshal(variablesBytes, &req.Variables); err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Unmarshal variables"))
+			return -2
+		}
+	}
+
+	ctx, cancel := callContext(inst, "graphql_request")
+	defer cancel()
+
+	auth, err := requestAuth(ctx, inst, string(endpointBytes))
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to requestAuth"))
+		return -3
+	}
+
+	resp, err := inst.Ctx().GraphQLClient.DoRequestWithContext(ctx, auth, string(endpointBytes), req, graphqlHeaders(inst))
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to GraphQLClient.DoRequestWithContext"))
+
+		if errors.Is(err, rcap.ErrGraphQLHeaderDisallowed) {
+			return -5
+		}
+
+		return -3
+	}
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: failed to Marshal"))
+		return -1
+	}
+
+	inst.SetFFIResult(respBytes)
+
+	return int32(len(respBytes))
+}
+
+// graphqlHeadersKey is the job value key for the headers set with graphql_headers
+type graphqlHeadersKey struct{}
+
+// GraphQLHeadersHandler returns the graphql_headers host function, which sets the headers
+// (such as a bearer token) that are sent with the job's subsequent GraphQL requests
+func GraphQLHeadersHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		headersPointer := args[0].(int32)
+		headersSize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := graphql_headers(headersPointer, headersSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("graphql_headers", 3, true, fn)
+}
+
+// graphql_headers replaces the headers for the job's GraphQL requests, which are encoded as they are for http_request,
+// and returns 0 or a negative error code. Headers that the capability doesn't allow are rejected when a request is made
+func graphql_headers(headersPointer, headersSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	headerBytes, err := inst.ReadMemory(headersPointer, headersSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	headers, err := decodeHTTPHeaders(headerBytes)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "could not parse GraphQL headers"))
+		return -2
+	}
+
+	inst.SetJobValue(graphqlHeadersKey{}, headers)
+
+	return 0
+}
+
+// graphqlHeaders returns the headers set for the job's GraphQL requests, if any
+func graphqlHeaders(inst *runtime.WasmInstance) http.Header {
+	headers, _ := inst.JobValue(graphqlHeadersKey{}).(http.Header)
+
+	return headers
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// MessageSendHandler returns the message_send host function, which sends a message onto the host's Grav bus
+func MessageSendHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		typePointer := args[0].(int32)
+		typeSize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := message_send(typePointer, typeSize, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("message_send", 5, true, fn)
+}
+
+// message_send returns 0 once the message is sent, or a negative error code
+func message_send(typePointer, typeSize, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	msgType, err := inst.ReadMemory(typePointer, typeSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	if err := inst.Ctx().Grav.Send(string(msgType), data); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Grav.Send"))
+
+		switch {
+		case errors.Is(err, rcap.ErrCapabilityNotEnabled), errors.Is(err, rcap.ErrGravPodNotSet):
+			return -2
+		case errors.Is(err, rcap.ErrGravTypeDisallowed):
+			return -5
+		}
+
+		return -3
+	}
+
+	return 0
+}
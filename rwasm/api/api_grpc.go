@@ -0,0 +1,85 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+	"google.golang.org/grpc/status"
+)
+
+// grpcStatusOffset is added to a gRPC status code (and negated) to form grpc_call's return value when a call fails with a status
+const grpcStatusOffset = 100
+
+// GRPCCallHandler returns the grpc_call host function, which makes a unary gRPC call with a serialized request message
+func GRPCCallHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		targetPointer := args[0].(int32)
+		targetSize := args[1].(int32)
+		methodPointer := args[2].(int32)
+		methodSize := args[3].(int32)
+		requestPointer := args[4].(int32)
+		requestSize := args[5].(int32)
+		ident := args[6].(int32)
+
+		ret := grpc_call(targetPointer, targetSize, methodPointer, methodSize, requestPointer, requestSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("grpc_call", 7, true, fn)
+}
+
+// grpc_call calls method (such as /package.Service/Method) on target (host:port) on behalf of the wasm runner, and sets the
+// FFI result to the serialized response message, returning its size. If the call fails with a gRPC status, the FFI result
+// is the status message and the return value is -(100 + the status code), such as -105 for NOT_FOUND.
+func grpc_call(targetPointer, targetSize, methodPointer, methodSize, requestPointer, requestSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	targetBytes, err := inst.ReadMemory(targetPointer, targetSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	methodBytes, err := inst.ReadMemory(methodPointer, methodSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	request, err := inst.ReadMemory(requestPointer, requestSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	if len(targetBytes) == 0 || len(methodBytes) == 0 {
+		runtime.InternalLogger().ErrorString("grpc_call requires a target and method")
+		return -2
+	}
+
+	ctx, cancel := callContext(inst, "grpc_call")
+	defer cancel()
+
+	// filter the call through the capabilities
+	response, err := inst.Ctx().GRPCClient.Call(ctx, inst.Ctx().Auth, string(targetBytes), string(methodBytes), request)
+	if err != nil {
+		if callStatus, ok := status.FromError(err); ok {
+			runtime.InternalLogger().Debug("runnable's gRPC call returned status:", callStatus.Code().String())
+
+			inst.SetFFIResult([]byte(callStatus.Message()))
+
+			return -(grpcStatusOffset + int32(callStatus.Code()))
+		}
+
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to GRPCClient.Call"))
+		return -3
+	}
+
+	inst.SetFFIResult(response)
+
+	return int32(len(response))
+}
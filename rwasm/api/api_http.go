@@ -1,11 +1,16 @@
 package api
 
 import (
-	"io/ioutil"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
 	"github.com/suborbital/reactr/rwasm/runtime"
 )
 
@@ -16,6 +21,12 @@ const (
 	methodDelete = int32(4)
 )
 
+// defaultMaxResponseBytes is the largest response body that fetch_url and http_request read, unless the Runner sets its own maximum
+const defaultMaxResponseBytes = 10 << 20
+
+// errResponseTooLarge is returned when a response body is larger than the maximum
+var errResponseTooLarge = errors.New("response body is larger than the maximum size")
+
 const (
 	contentTypeJSON        = "application/json"
 	contentTypeTextPlain   = "text/plain"
@@ -29,6 +40,8 @@ var methodValToMethod = map[int32]string{
 	methodDelete: http.MethodDelete,
 }
 
+// FetchURLHandler returns the fetch_url host function, which is kept for modules built with older versions of the
+// Runnable API. New modules should use http_request, which supports any method and returns the response's status and headers.
 func FetchURLHandler() runtime.HostFn {
 	fn := func(args ...interface{}) (interface{}, error) {
 		method := args[0].(int32)
@@ -61,7 +74,11 @@ func fetch_url(method int32, urlPointer int32, urlSize int32, bodyPointer int32,
 		return -2
 	}
 
-	urlBytes := inst.ReadMemory(urlPointer, urlSize)
+	urlBytes, err := inst.ReadMemory(urlPointer, urlSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 
 	// the URL is encoded with headers added on the end, each seperated by ::
 	// eg. https://google.com/somepage::authorization:bearer qdouwrnvgoquwnrg::anotherheader:nicetomeetyou
@@ -74,7 +91,11 @@ func fetch_url(method int32, urlPointer int32, urlSize int32, bodyPointer int32,
 		return -2
 	}
 
-	body := inst.ReadMemory(bodyPointer, bodySize)
+	body, err := inst.ReadMemory(bodyPointer, bodySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 
 	if len(body) > 0 {
 		if headers.Get("Content-Type") == "" {
@@ -82,22 +103,39 @@ func fetch_url(method int32, urlPointer int32, urlSize int32, bodyPointer int32,
 		}
 	}
 
+	ctx, cancel := callContext(inst, "fetch_url")
+	defer cancel()
+
+	auth, err := requestAuth(ctx, inst, urlString)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to requestAuth"))
+		return -3
+	}
+
 	// filter the request through the capabilities
-	resp, err := inst.Ctx().HTTPClient.Do(inst.Ctx().Auth, httpMethod, urlString, body, *headers)
+	resp, err := inst.Ctx().HTTPClient.DoWithContext(ctx, auth, httpMethod, urlString, body, *headers)
 	if err != nil {
 		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Do request"))
 		return -3
 	}
 
+	defer resp.Body.Close()
+
+	setLastResponse(inst, resp)
+
 	if resp.StatusCode > 299 {
 		runtime.InternalLogger().Debug("runnable's http request returned non-200 response:", resp.StatusCode)
 		return int32(resp.StatusCode) * -1 // return a negative value, i.e. -404 for a 404 error
 	}
 
-	defer resp.Body.Close()
-	respBytes, err := ioutil.ReadAll(resp.Body)
+	respBytes, err := readResponseBody(inst, resp)
 	if err != nil {
-		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Read response body"))
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to readResponseBody"))
+
+		if errors.Is(err, errResponseTooLarge) {
+			return -5
+		}
+
 		return -4
 	}
 
@@ -106,6 +144,26 @@ func fetch_url(method int32, urlPointer int32, urlSize int32, bodyPointer int32,
 	return int32(len(respBytes))
 }
 
+// readResponseBody reads a response's body, or returns errResponseTooLarge if it's larger than the instance's maximum
+func readResponseBody(inst *runtime.WasmInstance, resp *http.Response) ([]byte, error) {
+	maxBytes := inst.MaxResponseBytes()
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxResponseBytes
+	}
+
+	// read one byte more than the maximum to find out if the body is too large
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ReadAll")
+	}
+
+	if int64(len(body)) > maxBytes {
+		return nil, errResponseTooLarge
+	}
+
+	return body, nil
+}
+
 func parseHTTPHeaders(urlParts []string) (*http.Header, error) {
 	headers := &http.Header{}
 
@@ -122,3 +180,182 @@ func parseHTTPHeaders(urlParts []string) (*http.Header, error) {
 
 	return headers, nil
 }
+
+// requestAuth returns the auth that's used for a request to urlString, which adds a token from the OAuth2 capability
+// if it has a client for the URL's domain, or otherwise the header from the Auth capability
+func requestAuth(ctx context.Context, inst *runtime.WasmInstance, urlString string) (rcap.AuthCapability, error) {
+	if inst.Ctx().OAuth2 == nil {
+		return inst.Ctx().Auth, nil
+	}
+
+	urlObj, err := url.Parse(urlString)
+	if err != nil {
+		// invalid URLs are left for the HTTP capability to reject
+		return inst.Ctx().Auth, nil
+	}
+
+	header, err := inst.Ctx().OAuth2.HeaderForDomain(ctx, urlObj.Host)
+	if err != nil {
+		if errors.Is(err, rcap.ErrOAuth2NoClient) {
+			return inst.Ctx().Auth, nil
+		}
+
+		return nil, errors.Wrap(err, "failed to OAuth2.HeaderForDomain")
+	}
+
+	return rcap.AuthWithHeader(inst.Ctx().Auth, urlObj.Host, header), nil
+}
+
+// HTTPRequestHandler returns the http_request host function, which makes an HTTP request with any method, headers and body
+func HTTPRequestHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		methodPointer := args[0].(int32)
+		methodSize := args[1].(int32)
+		urlPointer := args[2].(int32)
+		urlSize := args[3].(int32)
+		headersPointer := args[4].(int32)
+		headersSize := args[5].(int32)
+		bodyPointer := args[6].(int32)
+		bodySize := args[7].(int32)
+		ident := args[8].(int32)
+
+		ret := http_request(methodPointer, methodSize, urlPointer, urlSize, headersPointer, headersSize, bodyPointer, bodySize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("http_request", 9, true, fn)
+}
+
+// http_request makes a request on behalf of the wasm runner. The headers are encoded as lines of `Name: value`, and the
+// FFI result is the response encoded the same way: its status code on the first line, then its headers, a blank line, and its body.
+// Responses with any status are returned to the runner, and the return value is the size of the FFI result or a negative error code.
+func http_request(methodPointer, methodSize, urlPointer, urlSize, headersPointer, headersSize, bodyPointer, bodySize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	ctx, cancel := callContext(inst, "http_request")
+	defer cancel()
+
+	resp, code := doHTTPRequest(ctx, inst, methodPointer, methodSize, urlPointer, urlSize, headersPointer, headersSize, bodyPointer, bodySize)
+	if code < 0 {
+		return code
+	}
+
+	defer resp.Body.Close()
+
+	respBytes, err := readResponseBody(inst, resp)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to readResponseBody"))
+
+		if errors.Is(err, errResponseTooLarge) {
+			return -5
+		}
+
+		return -4
+	}
+
+	result := encodeHTTPResponse(resp, respBytes)
+
+	inst.SetFFIResult(result)
+
+	return int32(len(result))
+}
+
+// doHTTPRequest reads a request made with http_request or fetch_open from the instance's memory and makes it,
+// returning a negative error code if it fails
+func doHTTPRequest(ctx context.Context, inst *runtime.WasmInstance, methodPointer, methodSize, urlPointer, urlSize, headersPointer, headersSize, bodyPointer, bodySize int32) (*http.Response, int32) {
+	methodBytes, err := inst.ReadMemory(methodPointer, methodSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return nil, -1
+	}
+
+	urlBytes, err := inst.ReadMemory(urlPointer, urlSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return nil, -1
+	}
+
+	headerBytes, err := inst.ReadMemory(headersPointer, headersSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return nil, -1
+	}
+
+	body, err := inst.ReadMemory(bodyPointer, bodySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return nil, -1
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(string(methodBytes)))
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	headers, err := decodeHTTPHeaders(headerBytes)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "could not parse request headers"))
+		return nil, -2
+	}
+
+	if len(body) > 0 && headers.Get("Content-Type") == "" {
+		headers.Set("Content-Type", contentTypeOctetStream)
+	}
+
+	auth, err := requestAuth(ctx, inst, string(urlBytes))
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to requestAuth"))
+		return nil, -3
+	}
+
+	// filter the request through the capabilities
+	resp, err := inst.Ctx().HTTPClient.DoWithContext(ctx, auth, method, string(urlBytes), body, headers)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Do request"))
+		return nil, -3
+	}
+
+	setLastResponse(inst, resp)
+
+	return resp, 0
+}
+
+// decodeHTTPHeaders parses headers encoded as lines of `Name: value`, separated by \r\n or \n
+func decodeHTTPHeaders(encoded []byte) (http.Header, error) {
+	headers := http.Header{}
+
+	for _, line := range strings.Split(string(encoded), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+
+		if !found || name == "" {
+			return nil, fmt.Errorf("header %q was not formatted correctly", line)
+		}
+
+		headers.Add(name, strings.TrimSpace(value))
+	}
+
+	return headers, nil
+}
+
+// encodeHTTPResponse encodes a response's status code, headers and body for the runner
+func encodeHTTPResponse(resp *http.Response, body []byte) []byte {
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "%d\r\n", resp.StatusCode)
+	resp.Header.Write(buf)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	return buf.Bytes()
+}
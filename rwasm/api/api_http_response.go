@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// lastResponseKey is the job value key for the most recent response received by the runner
+type lastResponseKey struct{}
+
+// lastResponse is the status and headers of the most recent response received by the runner
+type lastResponse struct {
+	status  int
+	headers http.Header
+}
+
+// setLastResponse records a response so that its status and headers can be read with fetch_status, fetch_header and fetch_headers
+func setLastResponse(inst *runtime.WasmInstance, resp *http.Response) {
+	inst.SetJobValue(lastResponseKey{}, &lastResponse{status: resp.StatusCode, headers: resp.Header})
+}
+
+func getLastResponse(inst *runtime.WasmInstance) *lastResponse {
+	last, _ := inst.JobValue(lastResponseKey{}).(*lastResponse)
+
+	return last
+}
+
+// FetchStatusHandler returns the fetch_status host function, which returns the status code of the
+// most recent response received by fetch_url, http_request or fetch_open during the current job
+func FetchStatusHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		ident := args[0].(int32)
+
+		ret := fetch_status(ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("fetch_status", 1, true, fn)
+}
+
+func fetch_status(identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	last := getLastResponse(inst)
+	if last == nil {
+		return -2
+	}
+
+	return int32(last.status)
+}
+
+// FetchHeaderHandler returns the fetch_header host function, which gets a header of the most recent response
+func FetchHeaderHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		namePointer := args[0].(int32)
+		nameSize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := fetch_header(namePointer, nameSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("fetch_header", 3, true, fn)
+}
+
+// fetch_header sets the FFI result to the value of a header of the most recent response (with multiple values joined by
+// commas, such as for Link headers), and returns its size, or -2 if there is no response or it doesn't have the header
+func fetch_header(namePointer, nameSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	nameBytes, err := inst.ReadMemory(namePointer, nameSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	last := getLastResponse(inst)
+	if last == nil {
+		return -2
+	}
+
+	values := last.headers.Values(string(nameBytes))
+	if len(values) == 0 {
+		return -2
+	}
+
+	value := []byte(strings.Join(values, ", "))
+
+	inst.SetFFIResult(value)
+
+	return int32(len(value))
+}
+
+// FetchHeadersHandler returns the fetch_headers host function, which gets all of the headers of the most recent response
+func FetchHeadersHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		ident := args[0].(int32)
+
+		ret := fetch_headers(ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("fetch_headers", 1, true, fn)
+}
+
+// fetch_headers sets the FFI result to the headers of the most recent response, encoded as lines
+// of `Name: value`, and returns its size, or -2 if there is no response
+func fetch_headers(identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	last := getLastResponse(inst)
+	if last == nil {
+		return -2
+	}
+
+	buf := &bytes.Buffer{}
+	last.headers.Write(buf)
+
+	inst.SetFFIResult(buf.Bytes())
+
+	return int32(buf.Len())
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// maxFetchReadSize is the most that fetch_read will read at once, regardless of the size of the module's buffer
+const maxFetchReadSize = 1 << 20
+
+// fetchStream is an open response whose body the module reads with fetch_read
+type fetchStream struct {
+	resp   *http.Response
+	cancel context.CancelFunc
+}
+
+func (f *fetchStream) Close() error {
+	defer f.cancel()
+
+	return f.resp.Body.Close()
+}
+
+// FetchOpenHandler returns the fetch_open host function, which makes a request like http_request
+// but returns a handle that the response body can be read from incrementally
+func FetchOpenHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		methodPointer := args[0].(int32)
+		methodSize := args[1].(int32)
+		urlPointer := args[2].(int32)
+		urlSize := args[3].(int32)
+		headersPointer := args[4].(int32)
+		headersSize := args[5].(int32)
+		bodyPointer := args[6].(int32)
+		bodySize := args[7].(int32)
+		ident := args[8].(int32)
+
+		ret := fetch_open(methodPointer, methodSize, urlPointer, urlSize, headersPointer, headersSize, bodyPointer, bodySize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("fetch_open", 9, true, fn)
+}
+
+// fetch_open makes a request on behalf of the wasm runner and returns a handle to its response, or a negative error code.
+// The FFI result is the response's status code and headers, encoded as they are by http_request but without a body.
+func fetch_open(methodPointer, methodSize, urlPointer, urlSize, headersPointer, headersSize, bodyPointer, bodySize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	// the call's timeout applies until the response's headers arrive. The body is read after fetch_open
+	// returns, so the request's own context is only cancelled along with the job (or once it's closed)
+	reqCtx, cancel := context.WithCancel(inst.Ctx().Context())
+
+	callCtx, callCancel := callContext(inst, "fetch_open")
+	stop := context.AfterFunc(callCtx, cancel)
+
+	resp, code := doHTTPRequest(reqCtx, inst, methodPointer, methodSize, urlPointer, urlSize, headersPointer, headersSize, bodyPointer, bodySize)
+
+	opened := stop()
+	callCancel()
+
+	if code < 0 {
+		cancel()
+		return code
+	}
+
+	if !opened {
+		// the timeout passed just as the response arrived, so its body can't be read
+		resp.Body.Close()
+		cancel()
+
+		runtime.InternalLogger().ErrorString("[rwasm] fetch_open timed out")
+		return -3
+	}
+
+	// the response is closed when the job ends if the runner doesn't close it
+	handle := inst.AddHandle(&fetchStream{resp: resp, cancel: cancel})
+
+	inst.SetFFIResult(encodeHTTPResponse(resp, nil))
+
+	return handle
+}
+
+// FetchReadHandler returns the fetch_read host function, which reads the next part of a response opened with fetch_open
+func FetchReadHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		handle := args[0].(int32)
+		pointer := args[1].(int32)
+		size := args[2].(int32)
+		ident := args[3].(int32)
+
+		ret := fetch_read(handle, pointer, size, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("fetch_read", 4, true, fn)
+}
+
+// fetch_read reads up to size bytes of a response body into the wasm runner's memory at pointer, and returns
+// the number of bytes read, 0 once the whole body has been read, or a negative error code
+func fetch_read(handle, pointer, size, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	stream, code := fetchStreamForHandle(inst, handle)
+	if code < 0 {
+		return code
+	}
+
+	if size <= 0 {
+		runtime.InternalLogger().ErrorString("invalid fetch_read size provided: ", size)
+		return -2
+	}
+
+	if size > maxFetchReadSize {
+		size = maxFetchReadSize
+	}
+
+	buf := make([]byte, size)
+
+	// a Read can return no bytes without reaching the end of the body, which the runner would mistake for the end
+	var n int
+	var readErr error
+
+	for n == 0 && readErr == nil {
+		n, readErr = stream.resp.Body.Read(buf)
+	}
+
+	if readErr != nil && !errors.Is(readErr, io.EOF) {
+		runtime.InternalLogger().Error(errors.Wrap(readErr, "failed to Read response body"))
+		return -4
+	}
+
+	if n == 0 {
+		return 0
+	}
+
+	if err := inst.WriteMemoryAtLocation(pointer, buf[:n]); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to WriteMemoryAtLocation"))
+		return -1
+	}
+
+	return int32(n)
+}
+
+// FetchCloseHandler returns the fetch_close host function, which closes a response opened with fetch_open
+func FetchCloseHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		handle := args[0].(int32)
+		ident := args[1].(int32)
+
+		ret := fetch_close(handle, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("fetch_close", 2, true, fn)
+}
+
+func fetch_close(handle, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	if _, code := fetchStreamForHandle(inst, handle); code < 0 {
+		return code
+	}
+
+	if err := inst.CloseHandle(handle); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to CloseHandle"))
+		return -4
+	}
+
+	return 0
+}
+
+// fetchStreamForHandle returns the response that a handle refers to, or a negative error code if it doesn't refer to one
+func fetchStreamForHandle(inst *runtime.WasmInstance, handle int32) (*fetchStream, int32) {
+	resource, err := inst.Handle(handle)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrapf(err, "invalid fetch handle %d", handle))
+		return nil, -2
+	}
+
+	stream, ok := resource.(*fetchStream)
+	if !ok {
+		runtime.InternalLogger().ErrorString("handle is not a fetch response: ", handle)
+		return nil, -2
+	}
+
+	return stream, 0
+}
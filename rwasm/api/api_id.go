@@ -0,0 +1,118 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+const (
+	idKindUUIDv4 = int32(1)
+	idKindUUIDv7 = int32(2)
+	idKindULID   = int32(3)
+)
+
+// crockfordAlphabet is the base32 alphabet that ULIDs are encoded with
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// IDNewHandler returns the id_new host function, which generates a UUID or ULID
+func IDNewHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		kind := args[0].(int32)
+		ident := args[1].(int32)
+
+		ret := id_new(kind, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("id_new", 2, true, fn)
+}
+
+// id_new sets the FFI result to a new ID of the given kind in its canonical text form and returns its size, or a negative error code
+func id_new(kind, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	var id string
+
+	switch kind {
+	case idKindUUIDv4:
+		newUUID, err := uuid.NewRandom()
+		if err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to NewRandom"))
+			return -3
+		}
+
+		id = newUUID.String()
+	case idKindUUIDv7, idKindULID:
+		// time-ordered IDs use the Clock capability, so that a Runnable can't learn the time if its clock is disabled
+		now, err := inst.Ctx().Clock.Now()
+		if err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Clock.Now"))
+			return -4
+		}
+
+		idBytes, err := timeOrderedIDBytes(now)
+		if err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to timeOrderedIDBytes"))
+			return -3
+		}
+
+		if kind == idKindUUIDv7 {
+			// set the version and variant bits
+			idBytes[6] = 0x70 | (idBytes[6] & 0x0f)
+			idBytes[8] = 0x80 | (idBytes[8] & 0x3f)
+
+			id = uuid.UUID(idBytes).String()
+		} else {
+			id = encodeULID(idBytes)
+		}
+	default:
+		runtime.InternalLogger().ErrorString("invalid id kind provided: ", kind)
+		return -2
+	}
+
+	inst.SetFFIResult([]byte(id))
+
+	return int32(len(id))
+}
+
+// timeOrderedIDBytes returns 16 bytes that start with the time as a 48 bit count of milliseconds since the epoch, followed by random bytes
+func timeOrderedIDBytes(now time.Time) ([16]byte, error) {
+	var idBytes [16]byte
+
+	if _, err := rand.Read(idBytes[6:]); err != nil {
+		return idBytes, errors.Wrap(err, "failed to rand.Read")
+	}
+
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(now.UnixMilli()))
+	copy(idBytes[:6], ms[2:])
+
+	return idBytes, nil
+}
+
+// encodeULID encodes 16 bytes as 26 characters of Crockford's base32
+func encodeULID(idBytes [16]byte) string {
+	hi := binary.BigEndian.Uint64(idBytes[:8])
+	lo := binary.BigEndian.Uint64(idBytes[8:])
+
+	encoded := make([]byte, 26)
+
+	for i := len(encoded) - 1; i >= 0; i-- {
+		encoded[i] = crockfordAlphabet[lo&31]
+
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(encoded)
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// maxRunJobDepth is the deepest that jobs can be nested with run_job, so that Runnables that run each other can't do so endlessly
+const maxRunJobDepth = 8
+
+// RunJobHandler returns the run_job host function, which runs a job with another registered Runnable and waits for its result
+func RunJobHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		typePointer := args[0].(int32)
+		typeSize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := run_job(typePointer, typeSize, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("run_job", 5, true, fn)
+}
+
+// run_job sets the FFI result to the job's result and returns its size, or a negative error code.
+// If the job fails or isn't complete when the call times out, the FFI result is set to its error instead
+func run_job(typePointer, typeSize, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	jobType, err := inst.ReadMemory(typePointer, typeSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	ctx := inst.Ctx()
+
+	// a job of the caller's own type could wait forever for a thread that the caller is using
+	if string(jobType) == ctx.JobType() || ctx.Depth() >= maxRunJobDepth {
+		runtime.InternalLogger().ErrorString(fmt.Sprintf("[rwasm] job %s can't be run from %s at depth %d", jobType, ctx.JobType(), ctx.Depth()))
+		return -4
+	}
+
+	callCtx, cancel := callContext(inst, "run_job")
+	defer cancel()
+
+	// the job runs with the same capabilities as the Runnable that called run_job
+	res, err := ctx.Do(rt.NewJob(string(jobType), data)).ThenWithContext(callCtx)
+	if err != nil {
+		if errors.Is(err, rt.ErrCapabilityNotAvailable) {
+			return -2
+		}
+
+		runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] job %s returned an error", jobType))
+
+		inst.SetFFIResult([]byte(err.Error()))
+
+		return -3
+	}
+
+	resBytes, err := jobResultBytes(res)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to jobResultBytes"))
+		return -1
+	}
+
+	inst.SetFFIResult(resBytes)
+
+	return int32(len(resBytes))
+}
+
+// jobResultBytes converts a job's result to bytes in the same way as a Wasm Runnable's job data
+func jobResultBytes(res interface{}) ([]byte, error) {
+	switch r := res.(type) {
+	case nil:
+		return []byte{}, nil
+	case []byte:
+		return r, nil
+	case string:
+		return []byte(r), nil
+	}
+
+	resJSON, err := json.Marshal(res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Marshal job result")
+	}
+
+	return resJSON, nil
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// JobMetaGetHandler returns the job_meta_get host function, which reads the metadata of the job being run
+func JobMetaGetHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		keyPointer := args[0].(int32)
+		keySize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := job_meta_get(keyPointer, keySize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("job_meta_get", 3, true, fn)
+}
+
+// job_meta_get sets the FFI result to the value and returns its size, or a negative error code. The uuid, type and attempt
+// keys are the job's UUID, jobType and attempt number, and any other key is metadata that was set by the job's caller
+func job_meta_get(keyPointer, keySize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	key, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	var val string
+
+	switch string(key) {
+	case "uuid":
+		val = inst.Ctx().JobUUID()
+	case "type":
+		val = inst.Ctx().JobType()
+	case "attempt":
+		val = strconv.Itoa(inst.Ctx().Attempt())
+	default:
+		meta, exists := inst.Ctx().JobMeta(string(key))
+		if !exists {
+			return -2
+		}
+
+		val = meta
+	}
+
+	inst.SetFFIResult([]byte(val))
+
+	return int32(len(val))
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// JWTClaimsHandler returns the jwt_claims host function, which verifies a JWT and returns its claims
+func JWTClaimsHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		tokenPointer := args[0].(int32)
+		tokenSize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := jwt_claims(tokenPointer, tokenSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("jwt_claims", 3, true, fn)
+}
+
+// jwt_claims verifies the token (or if it's empty, the bearer token in the Authorization header of the request the job is
+// handling), sets the FFI result to its claims as a JSON object and returns its size, or returns a negative error code
+func jwt_claims(tokenPointer, tokenSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	token := ""
+
+	if tokenSize > 0 {
+		tokenBytes, err := inst.ReadMemory(tokenPointer, tokenSize)
+		if err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+			return -1
+		}
+
+		token = string(tokenBytes)
+	} else {
+		token = bearerToken(inst)
+	}
+
+	if token == "" {
+		runtime.InternalLogger().Debug("[rwasm] jwt_claims called without a token")
+		return -3
+	}
+
+	ctx, cancel := callContext(inst, "jwt_claims")
+	defer cancel()
+
+	claims, err := inst.Ctx().JWT.Verify(ctx, token)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Verify JWT"))
+
+		switch {
+		case errors.Is(err, rcap.ErrCapabilityNotEnabled), errors.Is(err, rcap.ErrJWTKeysNotSet):
+			return -2
+		case errors.Is(err, rcap.ErrJWTExpired):
+			return -5
+		case errors.Is(err, rcap.ErrJWTClaimsDisallowed):
+			return -6
+		}
+
+		return -4
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Marshal claims"))
+		return -4
+	}
+
+	inst.SetFFIResult(claimsJSON)
+
+	return int32(len(claimsJSON))
+}
+
+// bearerToken returns the bearer token from the Authorization header of the request the job is handling, if there is one
+func bearerToken(inst *runtime.WasmInstance) string {
+	if inst.Ctx().RequestHandler == nil {
+		return ""
+	}
+
+	for _, name := range []string{"Authorization", "authorization"} {
+		header, err := inst.Ctx().RequestHandler.GetField(rcap.RequestFieldTypeHeader, name)
+		if err != nil {
+			continue
+		}
+
+		scheme, token, found := strings.Cut(string(header), " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	return ""
+}
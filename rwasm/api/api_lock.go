@@ -0,0 +1,118 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// heldLock is a lock acquired with lock_acquire, which is released when its handle is closed
+type heldLock struct {
+	locks rcap.LocksCapability
+	name  string
+	token string
+}
+
+func (h *heldLock) Close() error {
+	return h.locks.Release(h.name, h.token)
+}
+
+// LockAcquireHandler returns the lock_acquire host function, which acquires a named lock shared through the cache
+func LockAcquireHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		namePointer := args[0].(int32)
+		nameSize := args[1].(int32)
+		ttl := args[2].(int32)
+		ident := args[3].(int32)
+
+		ret := lock_acquire(namePointer, nameSize, ttl, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("lock_acquire", 4, true, fn)
+}
+
+// lock_acquire acquires a lock for ttl seconds and returns a handle to it, 0 if it's held by another holder, or a negative
+// error code. The lock is released when the handle is closed with lock_release, or when the job ends
+func lock_acquire(namePointer, nameSize, ttl, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	name, err := inst.ReadMemory(namePointer, nameSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	locks := inst.Ctx().Locks
+
+	token, err := locks.Acquire(string(name), int(ttl))
+	if err != nil {
+		if errors.Is(err, rcap.ErrLockHeld) {
+			return 0
+		}
+
+		runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] failed to Acquire lock %s", name))
+
+		switch {
+		case errors.Is(err, rcap.ErrCapabilityNotEnabled):
+			return -2
+		case errors.Is(err, rcap.ErrLockTTLInvalid):
+			return -3
+		}
+
+		return -4
+	}
+
+	return inst.AddHandle(&heldLock{locks: locks, name: string(name), token: token})
+}
+
+// LockReleaseHandler returns the lock_release host function, which releases a lock acquired with lock_acquire
+func LockReleaseHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		handle := args[0].(int32)
+		ident := args[1].(int32)
+
+		ret := lock_release(handle, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("lock_release", 2, true, fn)
+}
+
+// lock_release releases a lock and returns 0, or a negative error code
+func lock_release(handle, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	resource, err := inst.Handle(handle)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrapf(err, "invalid lock handle %d", handle))
+		return -2
+	}
+
+	if _, ok := resource.(*heldLock); !ok {
+		runtime.InternalLogger().ErrorString("handle is not a lock: ", handle)
+		return -2
+	}
+
+	if err := inst.CloseHandle(handle); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to release lock"))
+
+		if errors.Is(err, rcap.ErrLockNotHeld) {
+			return -3
+		}
+
+		return -4
+	}
+
+	return 0
+}
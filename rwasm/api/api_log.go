@@ -1,16 +1,25 @@
 package api
 
 import (
+	"encoding/json"
+
 	"github.com/pkg/errors"
 	"github.com/suborbital/reactr/rcap"
 	"github.com/suborbital/reactr/rwasm/runtime"
 )
 
+// logScope is added to every log from a Runnable, so that its logs can be filtered by job or environment
 type logScope struct {
-	RequestID  string `json:"request_id,omitempty"`
-	Identifier int32  `json:"ident"`
+	RequestID  string                 `json:"request_id,omitempty"`
+	Identifier int32                  `json:"ident"`
+	JobType    string                 `json:"job_type,omitempty"`
+	JobUUID    string                 `json:"job_uuid,omitempty"`
+	EnvUUID    string                 `json:"env_uuid,omitempty"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
 }
 
+// LogMsgHandler returns the log_msg host function, which is kept for modules built with older versions of the
+// Runnable API. New modules should use log_structured, which can add fields to the log.
 func LogMsgHandler() runtime.HostFn {
 	fn := func(args ...interface{}) (interface{}, error) {
 		pointer := args[0].(int32)
@@ -33,9 +42,76 @@ func log_msg(pointer int32, size int32, level int32, identifier int32) {
 		return
 	}
 
-	msgBytes := inst.ReadMemory(pointer, size)
+	msgBytes, err := inst.ReadMemory(pointer, size)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return
+	}
+
+	inst.Ctx().LoggerSource.Log(level, string(msgBytes), newLogScope(inst, identifier))
+}
+
+// LogStructuredHandler returns the log_structured host function, which logs a message with fields
+func LogStructuredHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		level := args[0].(int32)
+		msgPointer := args[1].(int32)
+		msgSize := args[2].(int32)
+		fieldsPointer := args[3].(int32)
+		fieldsSize := args[4].(int32)
+		ident := args[5].(int32)
+
+		ret := log_structured(level, msgPointer, msgSize, fieldsPointer, fieldsSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("log_structured", 6, true, fn)
+}
+
+// log_structured logs the message with the fields, which are a JSON object that can be empty, added to its scope.
+// It returns 0, or a negative error code
+func log_structured(level, msgPointer, msgSize, fieldsPointer, fieldsSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	msgBytes, err := inst.ReadMemory(msgPointer, msgSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 
-	scope := logScope{Identifier: identifier}
+	fieldsBytes, err := inst.ReadMemory(fieldsPointer, fieldsSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	scope := newLogScope(inst, identifier)
+
+	if len(fieldsBytes) > 0 {
+		if err := json.Unmarshal(fieldsBytes, &scope.Fields); err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Unmarshal log fields"))
+			return -2
+		}
+	}
+
+	inst.Ctx().LoggerSource.Log(level, string(msgBytes), scope)
+
+	return 0
+}
+
+// newLogScope returns the scope for a log from the instance's current job
+func newLogScope(inst *runtime.WasmInstance, identifier int32) logScope {
+	scope := logScope{
+		Identifier: identifier,
+		JobType:    inst.Ctx().JobType(),
+		JobUUID:    inst.Ctx().JobUUID(),
+		EnvUUID:    inst.EnvUUID(),
+	}
 
 	// if this job is handling a request, add the Request ID for extra context
 	if inst.Ctx().RequestHandler != nil {
@@ -47,5 +123,5 @@ func log_msg(pointer int32, size int32, level int32, identifier int32) {
 		}
 	}
 
-	inst.Ctx().LoggerSource.Log(level, string(msgBytes), scope)
+	return scope
 }
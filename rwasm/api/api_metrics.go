@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// metricFunc is one of the MetricsCapability's methods
+type metricFunc func(metrics rcap.MetricsCapability, name string, value float64, labels map[string]string) error
+
+// MetricCounterAddHandler returns the metric_counter_add host function, which adds to a counter in the host's metrics registry
+func MetricCounterAddHandler() runtime.HostFn {
+	return metricHostFn("metric_counter_add", rcap.MetricsCapability.CounterAdd)
+}
+
+// MetricGaugeSetHandler returns the metric_gauge_set host function, which sets a gauge in the host's metrics registry
+func MetricGaugeSetHandler() runtime.HostFn {
+	return metricHostFn("metric_gauge_set", rcap.MetricsCapability.GaugeSet)
+}
+
+// MetricHistogramObserveHandler returns the metric_histogram_observe host function, which observes a value in a histogram in the host's metrics registry
+func MetricHistogramObserveHandler() runtime.HostFn {
+	return metricHostFn("metric_histogram_observe", rcap.MetricsCapability.HistogramObserve)
+}
+
+// metricHostFn returns a host function that records a metric with record, since each kind of metric takes the same arguments
+func metricHostFn(name string, record metricFunc) runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		namePointer := args[0].(int32)
+		nameSize := args[1].(int32)
+		valuePointer := args[2].(int32)
+		labelsPointer := args[3].(int32)
+		labelsSize := args[4].(int32)
+		ident := args[5].(int32)
+
+		ret := metric_record(record, namePointer, nameSize, valuePointer, labelsPointer, labelsSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn(name, 6, true, fn)
+}
+
+// metric_record reads a metric's value as a little-endian float64 at valuePointer and its labels as a JSON object of strings
+// (which can be empty), records it with the job's type added to its labels, and returns 0 or a negative error code
+func metric_record(record metricFunc, namePointer, nameSize, valuePointer, labelsPointer, labelsSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	name, err := inst.ReadMemory(namePointer, nameSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	valueBytes, err := inst.ReadMemory(valuePointer, 8)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	labelsBytes, err := inst.ReadMemory(labelsPointer, labelsSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	labels := map[string]string{}
+
+	if len(labelsBytes) > 0 {
+		if err := json.Unmarshal(labelsBytes, &labels); err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Unmarshal metric labels"))
+			return -3
+		}
+	}
+
+	// the job type can't be set by the Runnable, so that each Runnable's metrics are kept apart
+	labels["job_type"] = inst.Ctx().JobType()
+
+	value := math.Float64frombits(binary.LittleEndian.Uint64(valueBytes))
+
+	if err := record(inst.Ctx().Metrics, string(name), value, labels); err != nil {
+		runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] failed to record metric %s", name))
+
+		switch {
+		case errors.Is(err, rcap.ErrCapabilityNotEnabled), errors.Is(err, rcap.ErrMetricsSinkNotSet):
+			return -2
+		case errors.Is(err, rcap.ErrMetricNameDisallowed):
+			return -5
+		}
+
+		return -3
+	}
+
+	return 0
+}
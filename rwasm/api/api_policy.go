@@ -0,0 +1,209 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// PermissionDenied is returned to the module by every host function that its Runnable's policy doesn't allow it to call
+const PermissionDenied = int32(-100)
+
+// LimitExceeded is returned to the module by every host function that it has called more often than its Runnable's limits allow
+const LimitExceeded = int32(-101)
+
+// payloadSizeArgs are the indexes of the arguments that are the sizes of the data passed to each host function,
+// which is counted against the limits capability's MaxBytes. Names and keys aren't counted
+var payloadSizeArgs = map[string][]int{
+	"fetch_url":        {4},
+	"http_request":     {7},
+	"fetch_open":       {7},
+	"ws_send":          {3},
+	"graphql_query":    {3},
+	"graphql_request":  {3, 5},
+	"grpc_call":        {5},
+	"db_query":         {1, 3},
+	"db_exec":          {1, 3},
+	"redis_command":    {1},
+	"cache_set":        {3},
+	"cache_cas":        {5},
+	"blob_put":         {3},
+	"file_write":       {3},
+	"message_send":     {3},
+	"broker_publish":   {3},
+	"send_email":       {1},
+	"run_job":          {3},
+	"log_msg":          {1},
+	"log_structured":   {2, 4},
+	"resp_write_chunk": {1},
+}
+
+// WithPolicy wraps each host function so that it checks the policy and limits capabilities of the Runnable calling it before
+// it runs, and records the call with the audit capability and in the environment's stats. The instance is found using the ident,
+// which is the last argument of every host function. Host functions without any arguments can't be checked, so they're returned unchanged.
+func WithPolicy(fns ...runtime.HostFn) []runtime.HostFn {
+	wrapped := make([]runtime.HostFn, len(fns))
+
+	for i := range fns {
+		wrapped[i] = withPolicy(fns[i])
+	}
+
+	return wrapped
+}
+
+func withPolicy(hostFn runtime.HostFn) runtime.HostFn {
+	if hostFn.ArgCount == 0 {
+		return hostFn
+	}
+
+	inner := hostFn.HostFn
+
+	hostFn.HostFn = func(args ...interface{}) (interface{}, error) {
+		ident, isInt := args[len(args)-1].(int32)
+		if !isInt {
+			return inner(args...)
+		}
+
+		// invalid identifiers are left for the host function to reject
+		inst, err := runtime.InstanceForIdentifier(ident, false)
+		if err != nil {
+			return inner(args...)
+		}
+
+		inst.RecordHostCall(hostFn.Name)
+
+		// the call is reported if the job is slow (see rt.SlowJobThreshold)
+		inst.Ctx().SetHostCall(hostFn.Name)
+		defer inst.Ctx().SetHostCall("")
+
+		if inst.Ctx() == nil || inst.Ctx().Capabilities == nil {
+			return inner(args...)
+		}
+
+		audit := inst.Ctx().Audit
+
+		if audit == nil || !audit.Audits(hostFn.Name) {
+			result, _, err := callWithPolicy(inst, hostFn, inner, args)
+			return result, err
+		}
+
+		started := time.Now()
+
+		result, outcome, err := callWithPolicy(inst, hostFn, inner, args)
+
+		event := rcap.AuditEvent{
+			Time:        started,
+			JobType:     inst.Ctx().JobType(),
+			JobUUID:     inst.Ctx().JobUUID(),
+			Tenant:      inst.Ctx().Tenant(),
+			HostFn:      hostFn.Name,
+			Args:        make([]int32, 0, len(args)-1),
+			PayloadSize: payloadSize(hostFn.Name, args),
+			Outcome:     outcome,
+			Result:      firstResult(result),
+			Duration:    time.Since(started),
+		}
+
+		for _, arg := range args[:len(args)-1] {
+			if val, isInt := arg.(int32); isInt {
+				event.Args = append(event.Args, val)
+			}
+		}
+
+		if err != nil {
+			event.Error = err.Error()
+		}
+
+		audit.Record(event)
+
+		return result, err
+	}
+
+	return hostFn
+}
+
+// callWithPolicy calls the host function if the policy and limits allow it, and returns its result and the call's outcome
+func callWithPolicy(inst *runtime.WasmInstance, hostFn runtime.HostFn, inner func(...interface{}) (interface{}, error), args []interface{}) (interface{}, string, error) {
+	caps := inst.Ctx().Capabilities
+
+	if caps.Policy != nil {
+		if err := caps.Policy.HostFnAllowed(hostFn.Name); err != nil {
+			logDenied(inst, hostFn.Name, "denied")
+
+			return errorResult(hostFn, PermissionDenied), rcap.AuditOutcomeDenied, nil
+		}
+	}
+
+	if caps.Limits != nil {
+		if err := caps.Limits.Use(hostFn.Name, payloadSize(hostFn.Name, args)); err != nil {
+			logDenied(inst, hostFn.Name, "rate limited")
+
+			return errorResult(hostFn, LimitExceeded), rcap.AuditOutcomeLimited, nil
+		}
+	}
+
+	result, err := inner(args...)
+	if err != nil || firstResult(result) < 0 {
+		return result, rcap.AuditOutcomeFailed, err
+	}
+
+	return result, rcap.AuditOutcomeOK, nil
+}
+
+// logDenied logs a call that was denied or rate limited, which may be a sign that a module is trying to do more than it should
+func logDenied(inst *runtime.WasmInstance, name, reason string) {
+	ctx := inst.Ctx()
+
+	msg := fmt.Sprintf("[rwasm] audit: (env: %s, jobType: %s, job: %s) %s call to host function %s", inst.EnvUUID(), ctx.JobType(), ctx.JobUUID(), reason, name)
+
+	runtime.InternalLogger().Warn(msg)
+}
+
+// firstResult returns the host function's return value, or the first of them, or 0 if it doesn't return anything
+func firstResult(result interface{}) int32 {
+	switch r := result.(type) {
+	case int32:
+		return r
+	case []int32:
+		if len(r) > 0 {
+			return r[0]
+		}
+	}
+
+	return 0
+}
+
+// errorResult returns code as the host function's first result, and zeros for any others
+func errorResult(hostFn runtime.HostFn, code int32) interface{} {
+	switch hostFn.ResultCount() {
+	case 0:
+		return nil
+	case 1:
+		return code
+	}
+
+	results := make([]int32, hostFn.ResultCount())
+	results[0] = code
+
+	return results
+}
+
+// payloadSize returns the total size of the data passed to a host function
+func payloadSize(name string, args []interface{}) int {
+	size := 0
+
+	for _, i := range payloadSizeArgs[name] {
+		if i >= len(args) {
+			continue
+		}
+
+		// negative sizes are left for the host function to reject
+		if argSize, isInt := args[i].(int32); isInt && argSize > 0 {
+			size += int(argSize)
+		}
+	}
+
+	return size
+}
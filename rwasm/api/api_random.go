@@ -0,0 +1,53 @@
+package api
+
+import (
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// maxRandomBytesSize is the most random bytes that can be requested in a single random_bytes call
+const maxRandomBytesSize = 1 << 20
+
+// RandomBytesHandler returns the random_bytes host function, which fills module memory from the host's secure random number generator
+func RandomBytesHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		pointer := args[0].(int32)
+		size := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := random_bytes(pointer, size, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("random_bytes", 3, true, fn)
+}
+
+// random_bytes writes size random bytes at pointer and returns 0, or a negative error code
+func random_bytes(pointer, size, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	if size < 0 || size > maxRandomBytesSize {
+		runtime.InternalLogger().ErrorString("invalid random_bytes size provided: ", size)
+		return -2
+	}
+
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to rand.Read"))
+		return -3
+	}
+
+	if err := inst.WriteMemoryAtLocation(pointer, buf); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to WriteMemoryAtLocation"))
+		return -1
+	}
+
+	return 0
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// RedisCommandHandler returns the redis_command host function, which runs one or more Redis commands
+func RedisCommandHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		commandsPointer := args[0].(int32)
+		commandsSize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := redis_command(commandsPointer, commandsSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("redis_command", 3, true, fn)
+}
+
+// redis_command runs the commands (a JSON array such as ["INCR", "visits"], or an array of them to run
+// in a pipeline) on behalf of the wasm runner, and sets the FFI result to a JSON array of their results,
+// each with a value or an error, returning its size
+func redis_command(commandsPointer, commandsSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	commandsBytes, err := inst.ReadMemory(commandsPointer, commandsSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	commands, err := decodeRedisCommands(commandsBytes)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "could not parse Redis commands"))
+		return -2
+	}
+
+	ctx, cancel := callContext(inst, "redis_command")
+	defer cancel()
+
+	// filter the commands through the capabilities
+	results, err := inst.Ctx().Redis.Do(ctx, commands)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Redis.Do"))
+		return -3
+	}
+
+	resultsJSON, err := json.Marshal(results)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Marshal"))
+		return -3
+	}
+
+	inst.SetFFIResult(resultsJSON)
+
+	return int32(len(resultsJSON))
+}
+
+// decodeRedisCommands decodes a JSON command, or array of commands, whose arguments are strings or numbers
+func decodeRedisCommands(commandsJSON []byte) ([][]string, error) {
+	raw := []json.RawMessage{}
+	if err := json.Unmarshal(commandsJSON, &raw); err != nil {
+		return nil, errors.Wrap(err, "failed to Unmarshal")
+	}
+
+	if len(raw) == 0 {
+		return nil, errors.New("no commands provided")
+	}
+
+	// a single command starts with its name rather than with another array
+	if !bytes.HasPrefix(bytes.TrimSpace(raw[0]), []byte("[")) {
+		raw = []json.RawMessage{commandsJSON}
+	}
+
+	commands := make([][]string, len(raw))
+
+	for i, rawCommand := range raw {
+		decoder := json.NewDecoder(bytes.NewReader(rawCommand))
+		decoder.UseNumber()
+
+		args := []interface{}{}
+		if err := decoder.Decode(&args); err != nil {
+			return nil, errors.Wrapf(err, "failed to Decode command %d", i)
+		}
+
+		commands[i] = make([]string, len(args))
+
+		for j, arg := range args {
+			switch a := arg.(type) {
+			case string:
+				commands[i][j] = a
+			case json.Number:
+				commands[i][j] = a.String()
+			default:
+				return nil, fmt.Errorf("argument %d of command %d is a %T, only strings and numbers are supported", j, i, arg)
+			}
+		}
+	}
+
+	return commands, nil
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"encoding/json"
+
 	"github.com/pkg/errors"
 	"github.com/suborbital/reactr/rcap"
 	"github.com/suborbital/reactr/rwasm/runtime"
@@ -28,7 +30,11 @@ func request_get_field(fieldType int32, keyPointer int32, keySize int32, identif
 		return -1
 	}
 
-	keyBytes := inst.ReadMemory(keyPointer, keySize)
+	keyBytes, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 	key := string(keyBytes)
 
 	val, err := inst.Ctx().RequestHandler.GetField(fieldType, key)
@@ -51,3 +57,93 @@ func request_get_field(fieldType int32, keyPointer int32, keySize int32, identif
 
 	return int32(len(val))
 }
+
+// RequestGetBodyHandler returns the request_get_body host function, which reads the full body of the request the job is handling
+func RequestGetBodyHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		ident := args[0].(int32)
+
+		ret := request_get_body(ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("request_get_body", 1, true, fn)
+}
+
+// request_get_body sets the FFI result to the request's body and returns its size, or a negative error code
+func request_get_body(identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	if inst.Ctx().RequestHandler == nil {
+		return -2
+	}
+
+	body, err := inst.Ctx().RequestHandler.GetBody()
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to GetBody"))
+
+		if errors.Is(err, rcap.ErrReqNotSet) {
+			return -2
+		}
+
+		return -5
+	}
+
+	inst.SetFFIResult(body)
+
+	return int32(len(body))
+}
+
+// RequestGetInfoHandler returns the request_get_info host function, which reads everything
+// other than the body about the request the job is handling as a single JSON object
+func RequestGetInfoHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		ident := args[0].(int32)
+
+		ret := request_get_info(ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("request_get_info", 1, true, fn)
+}
+
+// request_get_info sets the FFI result to the request's method, URL, path, query parameters, headers and params
+// encoded as JSON, and returns its size, or a negative error code
+func request_get_info(identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	if inst.Ctx().RequestHandler == nil {
+		return -2
+	}
+
+	info, err := inst.Ctx().RequestHandler.GetInfo()
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to GetInfo"))
+
+		if errors.Is(err, rcap.ErrReqNotSet) {
+			return -2
+		}
+
+		return -5
+	}
+
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Marshal"))
+		return -1
+	}
+
+	inst.SetFFIResult(infoJSON)
+
+	return int32(len(infoJSON))
+}
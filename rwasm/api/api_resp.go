@@ -1,6 +1,8 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/pkg/errors"
 	"github.com/suborbital/reactr/rcap"
 	"github.com/suborbital/reactr/rwasm/runtime"
@@ -29,10 +31,18 @@ func response_set_header(keyPointer int32, keySize int32, valPointer int32, valS
 		return -1
 	}
 
-	keyBytes := inst.ReadMemory(keyPointer, keySize)
+	keyBytes, err := inst.ReadMemory(keyPointer, keySize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 	key := string(keyBytes)
 
-	valBytes := inst.ReadMemory(valPointer, valSize)
+	valBytes, err := inst.ReadMemory(valPointer, valSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
 	val := string(valBytes)
 
 	if err := inst.Ctx().RequestHandler.SetResponseHeader(key, val); err != nil {
@@ -47,3 +57,50 @@ func response_set_header(keyPointer int32, keySize int32, valPointer int32, valS
 
 	return 0
 }
+
+// RespWriteChunkHandler returns the resp_write_chunk host function, which streams part of the Runnable's output to the job's caller
+func RespWriteChunkHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		pointer := args[0].(int32)
+		size := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := resp_write_chunk(pointer, size, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("resp_write_chunk", 3, true, fn)
+}
+
+// resp_write_chunk writes a chunk to the job's stream and flushes it if possible, and returns 0 or a negative error code
+func resp_write_chunk(pointer int32, size int32, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	stream := inst.Ctx().Stream()
+	if stream == nil {
+		runtime.InternalLogger().ErrorString("[rwasm] resp_write_chunk called for a job that isn't streaming")
+		return -2
+	}
+
+	chunk, err := inst.ReadMemory(pointer, size)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	if _, err := stream.Write(chunk); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Write chunk"))
+		return -3
+	}
+
+	if flusher, ok := stream.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	return 0
+}
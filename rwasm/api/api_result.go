@@ -27,7 +27,11 @@ func return_result(pointer int32, size int32, identifier int32) {
 		return
 	}
 
-	result := inst.ReadMemory(pointer, size)
+	result, err := inst.ReadMemory(pointer, size)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return
+	}
 
 	inst.SendExecutionResult(result, nil)
 }
@@ -54,7 +58,11 @@ func return_error(code int32, pointer int32, size int32, identifier int32) {
 		return
 	}
 
-	result := inst.ReadMemory(pointer, size)
+	result, err := inst.ReadMemory(pointer, size)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return
+	}
 
 	runErr := &rt.RunErr{Code: int(code), Message: string(result)}
 
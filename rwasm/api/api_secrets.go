@@ -0,0 +1,59 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// SecretGetHandler returns the secret_get host function, which reads a single secret from the Secrets capability
+func SecretGetHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		namePointer := args[0].(int32)
+		nameSize := args[1].(int32)
+		ident := args[2].(int32)
+
+		ret := secret_get(namePointer, nameSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("secret_get", 3, true, fn)
+}
+
+// secret_get sets the FFI result to the secret and returns its size, or a negative error code
+func secret_get(namePointer, nameSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	name, err := inst.ReadMemory(namePointer, nameSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	ctx, cancel := callContext(inst, "secret_get")
+	defer cancel()
+
+	secret, err := inst.Ctx().Secrets.Get(ctx, string(name))
+	if err != nil {
+		switch {
+		case errors.Is(err, rcap.ErrSecretNotFound):
+			return -2
+		case errors.Is(err, rcap.ErrSecretDisallowed), errors.Is(err, rcap.ErrSecretInvalidName), errors.Is(err, rcap.ErrCapabilityNotEnabled):
+			runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] secret %s can't be read", name))
+			return -5
+		}
+
+		// the error isn't returned to the Runnable, since it could contain details of the secrets provider
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Secrets.Get"))
+		return -3
+	}
+
+	inst.SetFFIResult(secret)
+
+	return int32(len(secret))
+}
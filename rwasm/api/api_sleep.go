@@ -0,0 +1,69 @@
+package api
+
+import (
+	goruntime "runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// defaultMaxSleep is the longest that sleep_ms will sleep for in one call, unless the Runner sets its own maximum
+const defaultMaxSleep = time.Minute
+
+// SleepMSHandler returns the sleep_ms host function, which pauses the job without using any CPU
+func SleepMSHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		ms := args[0].(int32)
+		ident := args[1].(int32)
+
+		ret := sleep_ms(ms, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("sleep_ms", 2, true, fn)
+}
+
+// sleep_ms sleeps for ms milliseconds, or yields to other goroutines if ms is 0, and returns 0 once it's done or a negative
+// error code. The sleeping job keeps its worker thread and instance, so a sleep that would outlast the job's timeout is
+// refused straight away rather than holding them until the job times out, and the sleep ends early if the job's context is done
+func sleep_ms(ms, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	maxSleep := inst.MaxSleep()
+	if maxSleep <= 0 {
+		maxSleep = defaultMaxSleep
+	}
+
+	if ms < 0 || time.Duration(ms)*time.Millisecond > maxSleep {
+		runtime.InternalLogger().ErrorString("[rwasm] invalid sleep_ms duration provided: ", ms)
+		return -2
+	}
+
+	if ms == 0 {
+		goruntime.Gosched()
+		return 0
+	}
+
+	ctx := inst.Ctx().Context()
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < time.Duration(ms)*time.Millisecond {
+		runtime.InternalLogger().ErrorString("[rwasm] sleep_ms duration would outlast the job's timeout: ", ms)
+		return -3
+	}
+
+	timer := time.NewTimer(time.Duration(ms) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return 0
+	case <-ctx.Done():
+		return -3
+	}
+}
@@ -29,16 +29,25 @@ func get_static_file(namePtr int32, nameSize int32, ident int32) int32 {
 		return -1
 	}
 
-	name := inst.ReadMemory(namePtr, nameSize)
+	name, err := inst.ReadMemory(namePtr, nameSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	ctx, cancel := callContext(inst, "get_static_file")
+	defer cancel()
 
-	file, err := inst.Ctx().FileSource.GetStatic(string(name))
+	file, err := rcap.GetStaticWithContext(inst.Ctx().FileSource, ctx, string(name))
 	if err != nil {
-		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to GetStatic"))
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to GetStaticWithContext"))
 
-		if err == rcap.ErrFileFuncNotSet {
+		if errors.Is(err, rcap.ErrFileFuncNotSet) {
 			return -2
-		} else if err == os.ErrNotExist {
+		} else if errors.Is(err, os.ErrNotExist) {
 			return -3
+		} else if errors.Is(err, rcap.ErrStaticFileTooLarge) {
+			return -5
 		}
 
 		return -4
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// RenderTemplateHandler returns the render_template host function, which renders one of the host's templates with JSON data
+func RenderTemplateHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		namePointer := args[0].(int32)
+		nameSize := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := render_template(namePointer, nameSize, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("render_template", 5, true, fn)
+}
+
+// render_template sets the FFI result to the rendered template and returns its size, or a negative error code
+func render_template(namePointer, nameSize, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	name, err := inst.ReadMemory(namePointer, nameSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	dataBytes, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	var data interface{}
+	if len(dataBytes) > 0 {
+		if err := json.Unmarshal(dataBytes, &data); err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Unmarshal template data"))
+			return -2
+		}
+	}
+
+	ctx, cancel := callContext(inst, "render_template")
+	defer cancel()
+
+	rendered, err := inst.Ctx().Templates.Render(ctx, string(name), data)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] failed to Render template %s", name))
+		return -3
+	}
+
+	inst.SetFFIResult(rendered)
+
+	return int32(len(rendered))
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// webSocket is an open connection that the module uses with ws_send and ws_receive
+type webSocket struct {
+	conn rcap.WebSocketConn
+}
+
+func (w *webSocket) Close() error {
+	return w.conn.Close()
+}
+
+// WebSocketOpenHandler returns the ws_open host function, which connects to a WebSocket server
+func WebSocketOpenHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		urlPointer := args[0].(int32)
+		urlSize := args[1].(int32)
+		headersPointer := args[2].(int32)
+		headersSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := ws_open(urlPointer, urlSize, headersPointer, headersSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("ws_open", 5, true, fn)
+}
+
+// ws_open connects to a WebSocket server on behalf of the wasm runner, sending the headers (encoded as they are for
+// http_request) with the handshake, and returns a handle to the connection or a negative error code
+func ws_open(urlPointer, urlSize, headersPointer, headersSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	urlBytes, err := inst.ReadMemory(urlPointer, urlSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	headerBytes, err := inst.ReadMemory(headersPointer, headersSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	headers, err := decodeHTTPHeaders(headerBytes)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "could not parse WebSocket headers"))
+		return -2
+	}
+
+	ctx, cancel := callContext(inst, "ws_open")
+	defer cancel()
+
+	// filter the connection through the capabilities
+	conn, err := inst.Ctx().WebSocket.Dial(ctx, inst.Ctx().Auth, string(urlBytes), headers)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Dial WebSocket"))
+		return -3
+	}
+
+	// the connection is closed when the job ends if the runner doesn't close it
+	return inst.AddHandle(&webSocket{conn: conn})
+}
+
+// WebSocketSendHandler returns the ws_send host function, which sends a message on an open WebSocket
+func WebSocketSendHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		handle := args[0].(int32)
+		messageType := args[1].(int32)
+		dataPointer := args[2].(int32)
+		dataSize := args[3].(int32)
+		ident := args[4].(int32)
+
+		ret := ws_send(handle, messageType, dataPointer, dataSize, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("ws_send", 5, true, fn)
+}
+
+// ws_send sends a text (1) or binary (2) message, and returns 0 or a negative error code
+func ws_send(handle, messageType, dataPointer, dataSize, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	ws, code := webSocketForHandle(inst, handle)
+	if code < 0 {
+		return code
+	}
+
+	if messageType != rcap.WebSocketTextMessage && messageType != rcap.WebSocketBinaryMessage {
+		runtime.InternalLogger().ErrorString("invalid WebSocket message type provided: ", messageType)
+		return -2
+	}
+
+	data, err := inst.ReadMemory(dataPointer, dataSize)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to ReadMemory"))
+		return -1
+	}
+
+	if err := ws.conn.Send(int(messageType), data); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Send WebSocket message"))
+		return -4
+	}
+
+	return 0
+}
+
+// WebSocketReceiveHandler returns the ws_receive host function, which waits for the next message on an open WebSocket
+func WebSocketReceiveHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		handle := args[0].(int32)
+		ident := args[1].(int32)
+
+		ret := ws_receive(handle, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("ws_receive", 2, true, fn)
+}
+
+// ws_receive sets the FFI result to the next message received on the connection, and returns its size or a negative
+// error code. It waits for a message until the job times out, and returns -5 once the server has closed the connection.
+func ws_receive(handle, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, true)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	ws, code := webSocketForHandle(inst, handle)
+	if code < 0 {
+		return code
+	}
+
+	ctx, cancel := callContext(inst, "ws_receive")
+	defer cancel()
+
+	_, data, err := ws.conn.Receive(ctx)
+	if err != nil {
+		if errors.Is(err, rcap.ErrWebSocketClosed) {
+			return -5
+		}
+
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to Receive WebSocket message"))
+		return -4
+	}
+
+	inst.SetFFIResult(data)
+
+	return int32(len(data))
+}
+
+// WebSocketCloseHandler returns the ws_close host function, which closes an open WebSocket
+func WebSocketCloseHandler() runtime.HostFn {
+	fn := func(args ...interface{}) (interface{}, error) {
+		handle := args[0].(int32)
+		ident := args[1].(int32)
+
+		ret := ws_close(handle, ident)
+
+		return ret, nil
+	}
+
+	return runtime.NewHostFn("ws_close", 2, true, fn)
+}
+
+func ws_close(handle, identifier int32) int32 {
+	inst, err := runtime.InstanceForIdentifier(identifier, false)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] alert: invalid identifier used, potential malicious activity"))
+		return -1
+	}
+
+	if _, code := webSocketForHandle(inst, handle); code < 0 {
+		return code
+	}
+
+	if err := inst.CloseHandle(handle); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "failed to CloseHandle"))
+		return -4
+	}
+
+	return 0
+}
+
+// webSocketForHandle returns the connection that a handle refers to, or a negative error code if it doesn't refer to one
+func webSocketForHandle(inst *runtime.WasmInstance, handle int32) (*webSocket, int32) {
+	resource, err := inst.Handle(handle)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrapf(err, "invalid WebSocket handle %d", handle))
+		return nil, -2
+	}
+
+	ws, ok := resource.(*webSocket)
+	if !ok {
+		runtime.InternalLogger().ErrorString("handle is not a WebSocket: ", handle)
+		return nil, -2
+	}
+
+	return ws, 0
+}
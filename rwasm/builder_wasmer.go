@@ -1,15 +1,14 @@
-//go:build !wasmtime
-// +build !wasmtime
+//go:build !wasmtime && !wazero && cgo
+// +build !wasmtime,!wazero,cgo
 
 package rwasm
 
 import (
-	"github.com/suborbital/reactr/rwasm/api"
-	"github.com/suborbital/reactr/rwasm/moduleref"
 	"github.com/suborbital/reactr/rwasm/runtime"
 	runtimewasmer "github.com/suborbital/reactr/rwasm/runtime/wasmer"
 )
 
-func runtimeBuilder(ref *moduleref.WasmModuleRef) runtime.RuntimeBuilder {
-	return runtimewasmer.NewBuilder(ref, api.API()...)
+// defaultRuntime returns the Wasm engine used when a Runner does not specify one
+func defaultRuntime() runtime.WasmRuntime {
+	return runtimewasmer.NewRuntime()
 }
@@ -0,0 +1,14 @@
+//go:build wazero || !cgo
+// +build wazero !cgo
+
+package rwasm
+
+import (
+	"github.com/suborbital/reactr/rwasm/runtime"
+	runtimewazero "github.com/suborbital/reactr/rwasm/runtime/wazero"
+)
+
+// defaultRuntime returns the Wasm engine used when a Runner does not specify one
+func defaultRuntime() runtime.WasmRuntime {
+	return runtimewazero.NewRuntime()
+}
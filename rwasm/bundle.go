@@ -0,0 +1,370 @@
+package rwasm
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// BundleManifestFile is the name of the manifest at the root of a bundle
+const BundleManifestFile = "manifest.yaml"
+
+// BundleManifest describes the Runnables in a bundle
+type BundleManifest struct {
+	Runnables []BundleRunnable `json:"runnables" yaml:"runnables"`
+}
+
+// BundleRunnable describes a Runnable in a bundle, and how it should be registered
+type BundleRunnable struct {
+	// Name is the jobType the Runnable is registered as
+	Name string `json:"name" yaml:"name"`
+	FQFN string `json:"fqfn,omitempty" yaml:"fqfn,omitempty"`
+
+	// Module is the path of the Runnable's .wasm module within the bundle
+	Module string `json:"module" yaml:"module"`
+
+	// Digest is the module's expected SHA-256 digest (see moduleref.WasmModuleRef.Digest), empty means it isn't checked
+	Digest string `json:"digest,omitempty" yaml:"digest,omitempty"`
+
+	PoolSize       int  `json:"poolSize,omitempty" yaml:"poolSize,omitempty"`
+	AutoscaleMax   int  `json:"autoscaleMax,omitempty" yaml:"autoscaleMax,omitempty"`
+	TimeoutSeconds int  `json:"timeoutSeconds,omitempty" yaml:"timeoutSeconds,omitempty"`
+	PreWarm        bool `json:"preWarm,omitempty" yaml:"preWarm,omitempty"`
+
+	// Capabilities overrides the Reactr instance's default configuration for each capability that is set
+	Capabilities *rcap.CapabilityConfig `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+}
+
+// RegisterBundle registers each of the Runnables described by the manifest of the bundle at path, which is a zip archive
+// containing a manifest.yaml file and the Runnables' modules. Files in the bundle's static/ directory are made available
+// to the Runnables with the File capability. The options are applied to every Runnable's Runner.
+//
+// Modules are read from the bundle as they're needed, so the bundle is kept open for as long as the process runs.
+func RegisterBundle(r *rt.Reactr, path string, options ...Option) error {
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to OpenReader for bundle")
+	}
+
+	if err := RegisterBundleFS(r, archive, options...); err != nil {
+		archive.Close()
+		return errors.Wrap(err, "failed to RegisterBundleFS")
+	}
+
+	return nil
+}
+
+// RegisterBundleFS registers the Runnables of a bundle that has already been opened (or extracted) as an fs.FS
+func RegisterBundleFS(r *rt.Reactr, bundle fs.FS, options ...Option) error {
+	manifest, err := ReadBundleManifest(bundle)
+	if err != nil {
+		return errors.Wrap(err, "failed to ReadBundleManifest")
+	}
+
+	defaults := r.DefaultCaps()
+
+	staticFiles := func(filename string) ([]byte, error) {
+		filename = strings.TrimPrefix(path.Clean("/"+filename), "/")
+
+		return fs.ReadFile(bundle, path.Join("static", filename))
+	}
+
+	for _, runnable := range manifest.Runnables {
+		caps := bundleCapabilities(defaults, runnable.Capabilities, staticFiles)
+
+		ref := moduleref.RefWithFS(runnable.Name, runnable.FQFN, bundle, runnable.Module)
+		ref.Digest = runnable.Digest
+
+		r.RegisterWithCaps(runnable.Name, NewRunnerWithRef(ref, options...), caps, runnable.workerOptions()...)
+	}
+
+	return nil
+}
+
+// ReadBundleManifest reads and validates a bundle's manifest, ensuring that each of its Runnables' modules exist
+func ReadBundleManifest(bundle fs.FS) (*BundleManifest, error) {
+	manifestBytes, err := fs.ReadFile(bundle, BundleManifestFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to ReadFile for %s", BundleManifestFile)
+	}
+
+	manifest := &BundleManifest{}
+	if err := yaml.UnmarshalStrict(manifestBytes, manifest); err != nil {
+		return nil, errors.Wrapf(err, "failed to Unmarshal %s", BundleManifestFile)
+	}
+
+	if len(manifest.Runnables) == 0 {
+		return nil, errors.New("bundle manifest does not contain any Runnables")
+	}
+
+	names := map[string]bool{}
+
+	for _, runnable := range manifest.Runnables {
+		if runnable.Name == "" {
+			return nil, fmt.Errorf("bundle Runnable with module %s is missing a name", runnable.Module)
+		}
+
+		if names[runnable.Name] {
+			return nil, fmt.Errorf("bundle Runnable %s is listed more than once", runnable.Name)
+		}
+
+		names[runnable.Name] = true
+
+		if runnable.Module == "" {
+			return nil, fmt.Errorf("bundle Runnable %s is missing a module", runnable.Name)
+		}
+
+		if _, err := fs.Stat(bundle, runnable.Module); err != nil {
+			return nil, errors.Wrapf(err, "failed to Stat module for Runnable %s", runnable.Name)
+		}
+	}
+
+	return manifest, nil
+}
+
+// workerOptions returns the options the Runnable's worker is registered with
+func (b BundleRunnable) workerOptions() []rt.Option {
+	opts := []rt.Option{}
+
+	if b.PoolSize > 0 {
+		opts = append(opts, rt.PoolSize(b.PoolSize))
+	}
+
+	if b.AutoscaleMax > 0 {
+		opts = append(opts, rt.Autoscale(b.AutoscaleMax))
+	}
+
+	if b.TimeoutSeconds > 0 {
+		opts = append(opts, rt.TimeoutSeconds(b.TimeoutSeconds))
+	}
+
+	if b.PreWarm {
+		opts = append(opts, rt.PreWarm())
+	}
+
+	return opts
+}
+
+// bundleCapabilities returns the capabilities for a Runnable in a bundle, which are the defaults with any of the capabilities
+// configured in the manifest replaced, and with the File capability serving the bundle's static files
+func bundleCapabilities(defaults rt.Capabilities, overrides *rcap.CapabilityConfig, staticFiles rcap.StaticFileFunc) rt.Capabilities {
+	config := defaults.Config()
+
+	if overrides != nil {
+		if overrides.Logger != nil {
+			// the logger can't be set in the manifest, so keep the default one
+			logger := *overrides.Logger
+			logger.Logger = config.Logger.Logger
+			config.Logger = &logger
+		}
+
+		if overrides.HTTP != nil {
+			// the client's certificates and proxy are configured by the host, so the manifest can only set the rules
+			http := *overrides.HTTP
+			http.Client = nil
+			if config.HTTP != nil {
+				http.Client = config.HTTP.Client
+			}
+			config.HTTP = &http
+		}
+
+		if overrides.WebSocket != nil {
+			config.WebSocket = overrides.WebSocket
+		}
+
+		if overrides.GraphQL != nil {
+			config.GraphQL = overrides.GraphQL
+		}
+
+		if overrides.GRPC != nil {
+			config.GRPC = overrides.GRPC
+		}
+
+		if overrides.DNS != nil {
+			// the resolver can only be set by the host
+			dns := *overrides.DNS
+			dns.Resolver = nil
+			if config.DNS != nil {
+				dns.Resolver = config.DNS.Resolver
+			}
+			config.DNS = &dns
+		}
+
+		if overrides.Database != nil {
+			config.Database = overrides.Database
+		}
+
+		if overrides.Redis != nil {
+			config.Redis = overrides.Redis
+		}
+
+		if overrides.Blob != nil {
+			config.Blob = overrides.Blob
+		}
+
+		if overrides.Secrets != nil {
+			// the providers are configured by the host, so the manifest can only set which secrets can be read
+			secrets := *config.Secrets
+			secrets.Enabled = overrides.Secrets.Enabled
+			secrets.Rules = overrides.Secrets.Rules
+			config.Secrets = &secrets
+		}
+
+		if overrides.Configuration != nil {
+			// likewise the values are managed by the host, so each Runnable's manifest entry can only set which keys it can read
+			configuration := *config.Configuration
+			configuration.Enabled = overrides.Configuration.Enabled
+			configuration.Rules = overrides.Configuration.Rules
+			config.Configuration = &configuration
+		}
+
+		if overrides.Crypto != nil {
+			// keys are held by the host and can't be set in the manifest
+			crypto := *overrides.Crypto
+			crypto.Keys = config.Crypto.Keys
+			config.Crypto = &crypto
+		}
+
+		if overrides.Clock != nil {
+			// keep the host's clock, which may be frozen for tests
+			clock := *overrides.Clock
+			clock.Clock = config.Clock.Clock
+			config.Clock = &clock
+		}
+
+		if overrides.Grav != nil {
+			grav := *overrides.Grav
+			grav.Pod = config.Grav.Pod
+			config.Grav = &grav
+		}
+
+		if overrides.Metrics != nil {
+			// the sink is the host's metrics registry, so the manifest can only set which metrics can be recorded
+			metrics := *overrides.Metrics
+			metrics.Sink = config.Metrics.Sink
+			config.Metrics = &metrics
+		}
+
+		if overrides.Email != nil {
+			// likewise the sender holds the host's credentials, so the manifest can only set the rules and default sender
+			email := *overrides.Email
+			email.Sender = nil
+			if config.Email != nil {
+				email.Sender = config.Email.Sender
+			}
+			config.Email = &email
+		}
+
+		if overrides.MessageBroker != nil {
+			// the publisher is the host's connection to the broker, so the manifest can only set which topics can be published to
+			broker := *overrides.MessageBroker
+			broker.Publisher = nil
+			if config.MessageBroker != nil {
+				broker.Publisher = config.MessageBroker.Publisher
+			}
+			config.MessageBroker = &broker
+		}
+
+		if overrides.Auth != nil {
+			config.Auth = overrides.Auth
+		}
+
+		if overrides.JWT != nil {
+			// the keys that tokens are verified with are trusted by the host, so the manifest can only set which tokens are accepted
+			jwt := *config.JWT
+			jwt.Enabled = overrides.JWT.Enabled
+			jwt.Rules = overrides.JWT.Rules
+			config.JWT = &jwt
+		}
+
+		if overrides.OAuth2 != nil {
+			// the clients hold the host's credentials, so the manifest can only turn the capability on or off
+			oauth2 := *config.OAuth2
+			oauth2.Enabled = overrides.OAuth2.Enabled
+			config.OAuth2 = &oauth2
+		}
+
+		if overrides.Cache != nil {
+			config.Cache = overrides.Cache
+		}
+
+		if overrides.Locks != nil {
+			config.Locks = overrides.Locks
+		}
+
+		if overrides.File != nil {
+			// the directory and static file sources are on (or credentialed by) the host, so they can't be set in the manifest
+			file := *overrides.File
+			file.FileFunc = config.File.FileFunc
+			file.Directory = config.File.Directory
+			file.AllowWrite = config.File.AllowWrite
+			file.Static = config.File.Static
+			config.File = &file
+		}
+
+		if overrides.Templates != nil {
+			config.Templates = overrides.Templates
+		}
+
+		if overrides.RequestHandler != nil {
+			config.RequestHandler = overrides.RequestHandler
+		}
+
+		if overrides.Policy != nil {
+			config.Policy = overrides.Policy
+		}
+
+		if overrides.Limits != nil {
+			config.Limits = overrides.Limits
+		}
+
+		if overrides.Timeouts != nil {
+			config.Timeouts = overrides.Timeouts
+		}
+
+		if overrides.Audit != nil {
+			// the sink is the host's audit log, so the manifest can only set which calls are recorded
+			audit := *overrides.Audit
+			audit.Sink = nil
+			if config.Audit != nil {
+				audit.Sink = config.Audit.Sink
+			}
+			config.Audit = &audit
+		}
+	}
+
+	// capabilities that aren't for a bundle (see WatchCaps) keep the host's static files
+	if staticFiles != nil {
+		file := *config.File
+		file.FileFunc = staticFiles
+		config.File = &file
+	}
+
+	caps := rt.CapabilitiesFromConfig(config)
+
+	// unless the manifest configures its own cache, share the default one rather than creating an empty one
+	if overrides == nil || overrides.Cache == nil {
+		caps.Cache = defaults.Cache
+		caps.Locks = rcap.DefaultLocks(*caps.Config().Locks, caps.Cache)
+	}
+
+	// likewise share the default database's connection pool and Redis client
+	if overrides == nil || overrides.Database == nil {
+		caps.Database = defaults.Database
+	}
+
+	if overrides == nil || overrides.Redis == nil {
+		caps.Redis = defaults.Redis
+	}
+
+	return caps
+}
@@ -0,0 +1,113 @@
+package moduleref
+
+import (
+	"container/list"
+	"sync"
+)
+
+// moduleBytes holds the bytes of modules that were loaded by refs when a memory budget is set
+var moduleBytes = &bytesCache{
+	entries:  list.New(),
+	elements: map[*WasmModuleRef]*list.Element{},
+}
+
+// UseMemoryBudget limits the total size of the module bytes that are kept in memory by refs that can load
+// their module again (from a file, an fs.FS, or a URL). When the budget is exceeded, the bytes of the least
+// recently used modules are dropped, and they are loaded again the next time they're needed. A budget of 0
+// (the default) keeps each module's bytes for as long as its ref exists.
+//
+// The budget only applies to modules loaded after it is set, and refs created with module bytes always keep them.
+func UseMemoryBudget(budget int64) {
+	moduleBytes.setBudget(budget)
+}
+
+// bytesCache is an LRU cache of module bytes, limited to a budget in bytes
+type bytesCache struct {
+	budget int64
+	size   int64
+
+	// entries is ordered from most to least recently used
+	entries  *list.List
+	elements map[*WasmModuleRef]*list.Element
+
+	lock sync.Mutex
+}
+
+type bytesEntry struct {
+	ref  *WasmModuleRef
+	data []byte
+}
+
+// enabled returns true if a budget is set
+func (b *bytesCache) enabled() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.budget > 0
+}
+
+func (b *bytesCache) setBudget(budget int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.budget = budget
+
+	if budget <= 0 {
+		b.entries.Init()
+		b.elements = map[*WasmModuleRef]*list.Element{}
+		b.size = 0
+		return
+	}
+
+	b.evict()
+}
+
+// get returns the ref's module bytes if they are still cached
+func (b *bytesCache) get(ref *WasmModuleRef) []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	elem, exists := b.elements[ref]
+	if !exists {
+		return nil
+	}
+
+	b.entries.MoveToFront(elem)
+
+	return elem.Value.(*bytesEntry).data
+}
+
+// put caches the ref's module bytes, evicting the least recently used modules to stay within the budget.
+// Modules larger than the entire budget aren't cached.
+func (b *bytesCache) put(ref *WasmModuleRef, data []byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if int64(len(data)) > b.budget {
+		return
+	}
+
+	if elem, exists := b.elements[ref]; exists {
+		b.remove(elem)
+	}
+
+	b.elements[ref] = b.entries.PushFront(&bytesEntry{ref: ref, data: data})
+	b.size += int64(len(data))
+
+	b.evict()
+}
+
+// evict removes the least recently used modules until the cache is within its budget, and must be called with the lock held
+func (b *bytesCache) evict() {
+	for b.size > b.budget {
+		b.remove(b.entries.Back())
+	}
+}
+
+// remove must be called with the lock held
+func (b *bytesCache) remove(elem *list.Element) {
+	entry := b.entries.Remove(elem).(*bytesEntry)
+
+	delete(b.elements, entry.ref)
+	b.size -= int64(len(entry.data))
+}
@@ -0,0 +1,89 @@
+package moduleref
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	UseMemoryBudget(int64(len(testModule) * 2))
+	defer UseMemoryBudget(0)
+
+	fsys := fstest.MapFS{
+		"one.wasm":   &fstest.MapFile{Data: testModule},
+		"two.wasm":   &fstest.MapFile{Data: testModule},
+		"three.wasm": &fstest.MapFile{Data: testModule},
+	}
+
+	one := RefWithFS("one", "", fsys, "one.wasm")
+	two := RefWithFS("two", "", fsys, "two.wasm")
+	three := RefWithFS("three", "", fsys, "three.wasm")
+
+	for _, ref := range []*WasmModuleRef{one, two, one, three} {
+		if _, err := ref.Bytes(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Bytes"))
+		}
+
+		if ref.Data != nil {
+			t.Error("expected the module bytes not to be kept by the ref")
+		}
+	}
+
+	// two was the least recently used when three was loaded
+	if moduleBytes.get(two) != nil {
+		t.Error("expected two to be evicted")
+	}
+
+	if moduleBytes.get(one) == nil || moduleBytes.get(three) == nil {
+		t.Error("expected one and three to be cached")
+	}
+
+	// an evicted module is loaded again when it's needed
+	changed := append([]byte{}, testModule...)
+	changed[len(changed)-1] = 0x02
+	fsys["two.wasm"] = &fstest.MapFile{Data: changed}
+
+	data, err := two.Bytes()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if !bytes.Equal(data, changed) {
+		t.Error("expected evicted module to be loaded again, got", data)
+	}
+
+	if moduleBytes.size != int64(len(testModule)*2) {
+		t.Error("unexpected cache size", moduleBytes.size)
+	}
+}
+
+func TestMemoryBudgetData(t *testing.T) {
+	UseMemoryBudget(1)
+	defer UseMemoryBudget(0)
+
+	// refs created with module bytes keep them, since they can't be loaded again
+	ref := RefWithData("test", "", testModule)
+
+	data, err := ref.Bytes()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if !bytes.Equal(data, testModule) || !bytes.Equal(ref.Data, testModule) {
+		t.Error("expected the ref to keep its module bytes")
+	}
+
+	// a module larger than the budget isn't cached, but is still returned
+	fsRef := RefWithFS("test", "", fstest.MapFS{"test.wasm": &fstest.MapFile{Data: testModule}}, "test.wasm")
+
+	if data, err := fsRef.Bytes(); err != nil || !bytes.Equal(data, testModule) {
+		t.Error("unexpected module bytes", data, err)
+	}
+
+	if moduleBytes.get(fsRef) != nil {
+		t.Error("expected module larger than the budget not to be cached")
+	}
+}
@@ -0,0 +1,66 @@
+package moduleref
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// MaxDecompressedSize is the largest module that Decompress will produce, which
+// prevents a small compressed file from expanding to fill the host's memory
+var MaxDecompressedSize int64 = 1 << 30
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// IsCompressed returns true if data is a gzip or zstd compressed stream
+func IsCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic) || bytes.HasPrefix(data, zstdMagic)
+}
+
+// Decompress returns the module contained in data if it is gzip or zstd compressed
+// (such as a .wasm.gz or .wasm.zst file), and returns data unchanged otherwise
+func Decompress(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to gzip.NewReader")
+		}
+
+		defer reader.Close()
+
+		return readLimited(reader)
+	case bytes.HasPrefix(data, zstdMagic):
+		decoder, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(MaxDecompressedSize)))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to zstd.NewReader")
+		}
+
+		defer decoder.Close()
+
+		return readLimited(decoder)
+	}
+
+	return data, nil
+}
+
+// readLimited reads a decompressed module, returning an error if it is larger than MaxDecompressedSize
+func readLimited(reader io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, MaxDecompressedSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress module")
+	}
+
+	if int64(len(data)) > MaxDecompressedSize {
+		return nil, errors.Errorf("decompressed module is larger than %d bytes", MaxDecompressedSize)
+	}
+
+	return data, nil
+}
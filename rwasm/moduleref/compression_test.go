@@ -0,0 +1,135 @@
+package moduleref
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+func gzipModule(t *testing.T, data []byte) []byte {
+	buf := &bytes.Buffer{}
+
+	writer := gzip.NewWriter(buf)
+	if _, err := writer.Write(data); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Write"))
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Close"))
+	}
+
+	return buf.Bytes()
+}
+
+func zstdModule(t *testing.T, data []byte) []byte {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to zstd.NewWriter"))
+	}
+
+	defer encoder.Close()
+
+	return encoder.EncodeAll(data, nil)
+}
+
+func TestCompressedModules(t *testing.T) {
+	fsys := fstest.MapFS{
+		"test.wasm":     &fstest.MapFile{Data: testModule},
+		"test.wasm.gz":  &fstest.MapFile{Data: gzipModule(t, testModule)},
+		"test.wasm.zst": &fstest.MapFile{Data: zstdModule(t, testModule)},
+	}
+
+	for _, path := range []string{"test.wasm", "test.wasm.gz", "test.wasm.zst"} {
+		t.Run(path, func(t *testing.T) {
+			// the digest is of the decompressed module, so it's the same however the module is stored
+			ref := RefWithFS("test", "", fsys, path)
+			ref.Digest = Digest(testModule)
+
+			data, err := ref.Bytes()
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "failed to Bytes"))
+			}
+
+			if !bytes.Equal(data, testModule) {
+				t.Error("unexpected module bytes", data)
+			}
+
+			// the decompressed module is kept, so it isn't decompressed again
+			if data, err := ref.Bytes(); err != nil || !bytes.Equal(data, testModule) {
+				t.Error("unexpected module bytes from second call", data, err)
+			}
+		})
+	}
+}
+
+func TestCompressedModuleData(t *testing.T) {
+	data, err := RefWithData("test", "", zstdModule(t, testModule)).Bytes()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if !bytes.Equal(data, testModule) {
+		t.Error("unexpected module bytes", data)
+	}
+
+	corrupt := gzipModule(t, testModule)
+	corrupt = corrupt[:len(corrupt)-4]
+
+	if _, err := RefWithData("test", "", corrupt).Bytes(); err == nil {
+		t.Error("expected truncated gzip module to fail")
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	defer func(max int64) { MaxDecompressedSize = max }(MaxDecompressedSize)
+
+	MaxDecompressedSize = 1024
+
+	large := append([]byte("\x00asm\x01\x00\x00\x00"), make([]byte, 4096)...)
+
+	if _, err := Decompress(gzipModule(t, large)); err == nil {
+		t.Error("expected gzip module larger than MaxDecompressedSize to fail")
+	}
+
+	if _, err := Decompress(zstdModule(t, large)); err == nil {
+		t.Error("expected zstd module larger than MaxDecompressedSize to fail")
+	}
+
+	if data, err := Decompress(large); err != nil || !bytes.Equal(data, large) {
+		t.Error("expected uncompressed module to be returned unchanged")
+	}
+}
+
+func TestCompressedModuleFetch(t *testing.T) {
+	compressed := gzipModule(t, testModule)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(compressed)
+	}))
+	defer s.Close()
+
+	dir := t.TempDir()
+
+	ref := RefWithURL("test", "", s.URL+"/test.wasm.gz", WithFetchCache(dir))
+	ref.Digest = Digest(testModule)
+
+	data, err := ref.Bytes()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if !bytes.Equal(data, testModule) {
+		t.Error("unexpected module bytes", data)
+	}
+
+	// the module is cached as it was downloaded
+	if cached, _ := readFetchCache(s.URL+"/test.wasm.gz", dir); !bytes.Equal(cached, compressed) {
+		t.Error("expected the compressed module to be cached")
+	}
+}
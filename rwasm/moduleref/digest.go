@@ -0,0 +1,57 @@
+package moduleref
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDigestMismatch is returned when a module's bytes don't match the digest it is expected to have
+var ErrDigestMismatch = errors.New("the Wasm module does not match its expected digest")
+
+// Digest returns the SHA-256 digest of a module's bytes, in the form sha256:<hex>
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// CheckDigest returns ErrDigestMismatch if data doesn't match expected, which can either be in the
+// form sha256:<hex> or just the hex digest. Nothing is checked if expected is empty.
+func CheckDigest(data []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+
+	expected = strings.ToLower(strings.TrimSpace(expected))
+
+	if strings.Contains(expected, ":") && !strings.HasPrefix(expected, "sha256:") {
+		return errors.Wrapf(ErrDigestMismatch, "unsupported digest algorithm in %s", expected)
+	}
+
+	if !strings.HasPrefix(expected, "sha256:") {
+		expected = "sha256:" + expected
+	}
+
+	if actual := Digest(data); actual != expected {
+		return errors.Wrapf(ErrDigestMismatch, "module has digest %s, expected %s", actual, expected)
+	}
+
+	return nil
+}
+
+// checkModuleDigest is CheckDigest for a module that may be compressed, since digests are of the decompressed module
+func checkModuleDigest(data []byte, expected string) error {
+	if expected == "" {
+		return nil
+	}
+
+	module, err := Decompress(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to Decompress")
+	}
+
+	return CheckDigest(module, expected)
+}
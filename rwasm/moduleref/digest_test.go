@@ -0,0 +1,75 @@
+package moduleref
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestDigest(t *testing.T) {
+	digest := Digest(testModule)
+
+	fsys := fstest.MapFS{
+		"test.wasm": &fstest.MapFile{Data: testModule},
+	}
+
+	for _, expected := range []string{digest, strings.TrimPrefix(digest, "sha256:"), strings.ToUpper(strings.TrimPrefix(digest, "sha256:"))} {
+		ref := RefWithFS("test", "", fsys, "test.wasm")
+		ref.Digest = expected
+
+		if _, err := ref.Bytes(); err != nil {
+			t.Error(errors.Wrapf(err, "failed to Bytes with digest %s", expected))
+		}
+	}
+
+	ref := RefWithFS("test", "", fsys, "test.wasm")
+	ref.Digest = Digest([]byte("something else"))
+
+	if _, err := ref.Bytes(); !errors.Is(err, ErrDigestMismatch) {
+		t.Error("expected ErrDigestMismatch, got", err)
+	}
+
+	// a ref with its bytes set is checked too
+	ref = RefWithData("test", "", testModule)
+	ref.Digest = "sha512:abc123"
+
+	if _, err := ref.Bytes(); !errors.Is(err, ErrDigestMismatch) {
+		t.Error("expected ErrDigestMismatch for an unsupported algorithm, got", err)
+	}
+}
+
+func TestDigestFetch(t *testing.T) {
+	server := &moduleServer{}
+	s := httptest.NewServer(server)
+	defer s.Close()
+
+	dir := t.TempDir()
+
+	ref := RefWithURL("test", "", s.URL, WithAuthHeader("Bearer abc123"), WithFetchCache(dir), WithRetries(1, time.Millisecond))
+	ref.Digest = Digest([]byte("something else"))
+
+	if _, err := ref.Bytes(); !errors.Is(err, ErrDigestMismatch) {
+		t.Error("expected ErrDigestMismatch, got", err)
+	}
+
+	// a module that doesn't match is retried, and isn't cached
+	if sent := atomic.LoadInt32(&server.sent); sent != 2 {
+		t.Error("expected the module to be downloaded twice, got", sent)
+	}
+
+	if cached, _ := readFetchCache(s.URL, dir); cached != nil {
+		t.Error("expected the mismatched module not to be cached")
+	}
+
+	ref = RefWithURL("test", "", s.URL, WithAuthHeader("Bearer abc123"), WithFetchCache(dir))
+	ref.Digest = Digest(testModule)
+
+	if _, err := ref.Bytes(); err != nil {
+		t.Error(errors.Wrap(err, "failed to Bytes"))
+	}
+}
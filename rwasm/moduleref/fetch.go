@@ -0,0 +1,338 @@
+package moduleref
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrFetchFailed is returned when a module can't be fetched from its URL and there is no cached copy to fall back on
+var ErrFetchFailed = errors.New("failed to fetch Wasm module")
+
+// FetchOption is a function that modifies fetchOpts
+type FetchOption func(fetchOpts) fetchOpts
+
+type fetchOpts struct {
+	client     *http.Client
+	headers    map[string]string
+	cacheDir   string
+	retries    int
+	retryDelay time.Duration
+
+	// digest is the ref's expected digest, which fetched modules are checked against before they're cached
+	digest string
+
+	// registryAuth and insecureRegistry are only used for oci:// refs
+	registryAuth     *registryCredentials
+	insecureRegistry bool
+}
+
+func defaultFetchOpts() fetchOpts {
+	o := fetchOpts{
+		client:     &http.Client{Timeout: time.Second * 30},
+		headers:    map[string]string{},
+		cacheDir:   "",
+		retries:    3,
+		retryDelay: time.Second,
+	}
+
+	return o
+}
+
+// WithAuthHeader sets the Authorization header sent when fetching the module, such as "Bearer <token>"
+func WithAuthHeader(value string) FetchOption {
+	return WithHeader("Authorization", value)
+}
+
+// WithHeader sets a header sent when fetching the module, for artifact servers that authenticate with a custom header
+func WithHeader(key, value string) FetchOption {
+	return func(opts fetchOpts) fetchOpts {
+		headers := make(map[string]string, len(opts.headers)+1)
+		for k, v := range opts.headers {
+			headers[k] = v
+		}
+
+		headers[key] = value
+		opts.headers = headers
+
+		return opts
+	}
+}
+
+// WithFetchCache sets a directory in which fetched modules are stored along with their ETag and Last-Modified
+// headers. The module is then only downloaded again if it has changed on the server, and the cached copy is
+// used if the server can't be reached.
+func WithFetchCache(dir string) FetchOption {
+	return func(opts fetchOpts) fetchOpts {
+		opts.cacheDir = dir
+
+		return opts
+	}
+}
+
+// WithRetries sets the number of times a failed fetch is retried, and how long to wait before the first retry
+// (which doubles for each one after). Requests that the server rejects with a 4xx status are not retried.
+func WithRetries(retries int, delay time.Duration) FetchOption {
+	return func(opts fetchOpts) fetchOpts {
+		opts.retries = retries
+		opts.retryDelay = delay
+
+		return opts
+	}
+}
+
+// WithHTTPClient sets the client used to fetch the module, such as to configure TLS or a proxy
+func WithHTTPClient(client *http.Client) FetchOption {
+	return func(opts fetchOpts) fetchOpts {
+		opts.client = client
+
+		return opts
+	}
+}
+
+// RefWithURL returns a module ref whose module is fetched from a URL the first time its bytes are needed.
+// The URL can be http:// or https://, or an OCI artifact such as oci://ghcr.io/org/runnable:v1 (see pullOCI)
+func RefWithURL(name, fqfn, url string, options ...FetchOption) *WasmModuleRef {
+	opts := defaultFetchOpts()
+	for _, o := range options {
+		opts = o(opts)
+	}
+
+	ref := &WasmModuleRef{
+		URL:       url,
+		Name:      name,
+		FQFN:      fqfn,
+		fetchOpts: &opts,
+	}
+
+	return ref
+}
+
+// fetchMeta is stored next to a cached module, and is used to ask the server whether the module has changed
+type fetchMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+
+	// Digest is the digest of the module's layer when it was pulled from an OCI registry
+	Digest string `json:"digest,omitempty"`
+}
+
+// errNoRetry wraps errors that won't be resolved by trying again
+type errNoRetry struct {
+	err error
+}
+
+func (e errNoRetry) Error() string {
+	return e.err.Error()
+}
+
+// fetch downloads the module from url, retrying failed requests. If a cache directory is set, the server is asked
+// to only send the module if it has changed from the cached copy, which is used if the server can't be reached.
+func fetch(url string, opts fetchOpts) ([]byte, error) {
+	cached, meta := readFetchCache(url, opts.cacheDir)
+
+	var lastErr error
+	delay := opts.retryDelay
+
+	for attempt := 0; attempt <= opts.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		fetcher := fetchOnce
+		if strings.HasPrefix(url, ociScheme) {
+			fetcher = pullOCIOnce
+		}
+
+		data, newMeta, err := fetcher(url, opts, cached, meta)
+		if err == nil {
+			err = checkModuleDigest(data, opts.digest)
+
+			if err != nil && newMeta == nil {
+				// the cached copy is bad, so download the module again without it
+				cached, meta = nil, nil
+			}
+		}
+
+		if err == nil {
+			if newMeta != nil {
+				writeFetchCache(url, opts.cacheDir, data, *newMeta)
+			}
+
+			return data, nil
+		}
+
+		lastErr = err
+
+		if errors.As(err, &errNoRetry{}) {
+			// the server was reached and refused the request, so the cached copy shouldn't be used either
+			return nil, errors.Wrapf(ErrFetchFailed, "%s: %s", url, err.Error())
+		}
+	}
+
+	if cached != nil {
+		return cached, nil
+	}
+
+	if errors.Is(lastErr, ErrDigestMismatch) {
+		return nil, errors.Wrapf(lastErr, "failed to fetch %s", url)
+	}
+
+	return nil, errors.Wrapf(ErrFetchFailed, "%s: %s", url, lastErr.Error())
+}
+
+// fetchOnce makes a single request for the module. The returned fetchMeta is nil if the cached copy is still current.
+func fetchOnce(url string, opts fetchOpts, cached []byte, meta *fetchMeta) ([]byte, *fetchMeta, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, errNoRetry{errors.Wrap(err, "failed to NewRequest")}
+	}
+
+	for k, v := range opts.headers {
+		req.Header.Set(k, v)
+	}
+
+	if cached != nil && meta != nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := opts.client.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to Do request")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, statusError(resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to ReadAll response body")
+	}
+
+	newMeta := &fetchMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	return data, newMeta, nil
+}
+
+// statusError returns the error for an unsuccessful response, which can be retried if the status may be temporary
+func statusError(status int) error {
+	err := fmt.Errorf("server responded with status %d", status)
+
+	// rate limiting and server errors may be temporary, but anything else in the 4xx range won't change
+	if status >= 400 && status < 500 && status != http.StatusTooManyRequests {
+		return errNoRetry{err}
+	}
+
+	return err
+}
+
+// fetchCachePaths returns the paths of the cached module and its metadata for a URL
+func fetchCachePaths(url, dir string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:])
+
+	return filepath.Join(dir, name+".wasm"), filepath.Join(dir, name+".json")
+}
+
+// readFetchCache returns the cached copy of the module at url and its metadata, or nil if there isn't one
+func readFetchCache(url, dir string) ([]byte, *fetchMeta) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	modulePath, metaPath := fetchCachePaths(url, dir)
+
+	data, err := ioutil.ReadFile(modulePath)
+	if err != nil {
+		return nil, nil
+	}
+
+	meta := &fetchMeta{}
+
+	metaBytes, err := ioutil.ReadFile(metaPath)
+	if err != nil || json.Unmarshal(metaBytes, meta) != nil {
+		// without the metadata the cached copy can still be used if the server can't be reached
+		return data, nil
+	}
+
+	return data, meta
+}
+
+// writeFetchCache stores a fetched module and its metadata. Failing to do so only means the module
+// will be downloaded again next time, so errors are ignored.
+func writeFetchCache(url, dir string, data []byte, meta fetchMeta) {
+	if dir == "" {
+		return
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+
+	modulePath, metaPath := fetchCachePaths(url, dir)
+
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+
+	// write to temporary files and rename them so that a partially written module is never read back
+	if err := writeFileAtomic(modulePath, data); err != nil {
+		return
+	}
+
+	writeFileAtomic(metaPath, metaBytes)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to TempFile")
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "failed to Write")
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "failed to Close")
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrap(err, "failed to Rename")
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package moduleref
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var testModule = []byte("\x00asm\x01\x00\x00\x00")
+
+// moduleServer serves testModule with an ETag, and counts the requests it receives and the modules it sends
+type moduleServer struct {
+	requests int32
+	sent     int32
+	failures int32
+}
+
+func (m *moduleServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&m.requests, 1)
+
+	if atomic.AddInt32(&m.failures, -1) >= 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer abc123" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if r.Header.Get("If-None-Match") == `"v1"` {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	atomic.AddInt32(&m.sent, 1)
+
+	w.Header().Set("ETag", `"v1"`)
+	w.Write(testModule)
+}
+
+func TestRefWithURL(t *testing.T) {
+	server := &moduleServer{}
+	s := httptest.NewServer(server)
+	defer s.Close()
+
+	dir := t.TempDir()
+
+	ref := RefWithURL("test", "", s.URL, WithAuthHeader("Bearer abc123"), WithFetchCache(dir))
+
+	data, err := ref.Bytes()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if string(data) != string(testModule) {
+		t.Error("unexpected module bytes", data)
+	}
+
+	// a new ref for the same URL should check that the cached copy is current rather than downloading it again
+	ref = RefWithURL("test", "", s.URL, WithAuthHeader("Bearer abc123"), WithFetchCache(dir))
+
+	data, err = ref.Bytes()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if string(data) != string(testModule) {
+		t.Error("unexpected cached module bytes", data)
+	}
+
+	if requests, sent := atomic.LoadInt32(&server.requests), atomic.LoadInt32(&server.sent); requests != 2 || sent != 1 {
+		t.Errorf("expected 2 requests and 1 download, got %d and %d", requests, sent)
+	}
+}
+
+func TestRefWithURLRetry(t *testing.T) {
+	server := &moduleServer{failures: 2}
+	s := httptest.NewServer(server)
+	defer s.Close()
+
+	ref := RefWithURL("test", "", s.URL, WithAuthHeader("Bearer abc123"), WithRetries(2, time.Millisecond))
+
+	if _, err := ref.Bytes(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if requests := atomic.LoadInt32(&server.requests); requests != 3 {
+		t.Error("expected 3 requests, got", requests)
+	}
+}
+
+func TestRefWithURLUnauthorized(t *testing.T) {
+	server := &moduleServer{}
+	s := httptest.NewServer(server)
+	defer s.Close()
+
+	ref := RefWithURL("test", "", s.URL, WithRetries(2, time.Millisecond))
+
+	if _, err := ref.Bytes(); !errors.Is(err, ErrFetchFailed) {
+		t.Error("expected ErrFetchFailed, got", err)
+	}
+
+	// the request was rejected, so it should not have been retried
+	if requests := atomic.LoadInt32(&server.requests); requests != 1 {
+		t.Error("expected 1 request, got", requests)
+	}
+}
+
+func TestRefWithURLCacheFallback(t *testing.T) {
+	server := &moduleServer{}
+	s := httptest.NewServer(server)
+
+	dir := t.TempDir()
+
+	if _, err := RefWithURL("test", "", s.URL, WithAuthHeader("Bearer abc123"), WithFetchCache(dir)).Bytes(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	s.Close()
+
+	// the server is gone, so the cached copy is used
+	data, err := RefWithURL("test", "", s.URL, WithFetchCache(dir), WithRetries(1, time.Millisecond)).Bytes()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if string(data) != string(testModule) {
+		t.Error("unexpected cached module bytes", data)
+	}
+}
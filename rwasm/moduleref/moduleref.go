@@ -1,17 +1,31 @@
 package moduleref
 
 import (
+	"io/fs"
 	"io/ioutil"
 
 	"github.com/pkg/errors"
 )
 
-// WasmModuleRef is a reference to a Wasm module (either its filepath or its bytes)
+// WasmModuleRef is a reference to a Wasm module (either its filepath, its URL, a file in an fs.FS, or its bytes)
 type WasmModuleRef struct {
 	Filepath string `json:"filepath"`
+	URL      string `json:"url,omitempty"`
 	Name     string `json:"name"`
 	FQFN     string `json:"fqfn"`
 	Data     []byte `json:"data"`
+
+	// Digest is the expected SHA-256 digest of the module's bytes, in the form sha256:<hex>, which is checked by Bytes
+	Digest string `json:"digest,omitempty"`
+
+	// Signature is an Ed25519 signature of the module's bytes, which is checked by Verify
+	Signature []byte `json:"signature,omitempty"`
+
+	// fetchOpts configures how the module is fetched when URL is set
+	fetchOpts *fetchOpts
+
+	// fsys is set by RefWithFS, and Filepath is read from it rather than the host's filesystem
+	fsys fs.FS
 }
 
 // RefWithData returns a module ref from module bytes
@@ -25,20 +39,93 @@ func RefWithData(name, fqfn string, data []byte) *WasmModuleRef {
 	return ref
 }
 
-// Bytes returns the bytes for the module
+// RefWithFS returns a module ref for the module at path within fsys, which allows modules
+// to be embedded into the binary with go:embed and registered without touching the filesystem
+func RefWithFS(name, fqfn string, fsys fs.FS, path string) *WasmModuleRef {
+	ref := &WasmModuleRef{
+		Filepath: path,
+		Name:     name,
+		FQFN:     fqfn,
+		fsys:     fsys,
+	}
+
+	return ref
+}
+
+// Bytes returns the bytes for the module, decompressing them if they are gzip or zstd compressed.
+// If the ref has a Digest, the (decompressed) bytes must match it.
 func (w *WasmModuleRef) Bytes() ([]byte, error) {
-	if w.Data == nil {
-		if w.Filepath == "" {
-			return nil, errors.New("missing Wasm module filepath in ref")
+	data := w.Data
+
+	if data == nil {
+		if cached := moduleBytes.get(w); cached != nil {
+			return cached, nil
 		}
 
-		bytes, err := ioutil.ReadFile(w.Filepath)
+		var err error
+
+		data, err = w.load()
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to ReadFile for Wasm module")
+			return nil, err
 		}
+	}
+
+	data, err := Decompress(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Decompress")
+	}
 
-		w.Data = bytes
+	if err := CheckDigest(data, w.Digest); err != nil {
+		return nil, errors.Wrap(err, "failed to CheckDigest")
 	}
 
+	// with a memory budget, loaded modules are kept in the LRU cache rather than by the ref so that they can be dropped
+	if w.Data == nil && moduleBytes.enabled() {
+		moduleBytes.put(w, data)
+		return data, nil
+	}
+
+	w.Data = data
+
 	return w.Data, nil
 }
+
+// load reads the module from wherever the ref points to
+func (w *WasmModuleRef) load() ([]byte, error) {
+	if w.URL != "" {
+		opts := defaultFetchOpts()
+		if w.fetchOpts != nil {
+			opts = *w.fetchOpts
+		}
+
+		// the fetched module is checked before it is cached, so that a bad download isn't kept
+		opts.digest = w.Digest
+
+		data, err := fetch(w.URL, opts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch Wasm module")
+		}
+
+		return data, nil
+	}
+
+	if w.fsys != nil {
+		data, err := fs.ReadFile(w.fsys, w.Filepath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to ReadFile for Wasm module from fs.FS")
+		}
+
+		return data, nil
+	}
+
+	if w.Filepath == "" {
+		return nil, errors.New("missing Wasm module filepath in ref")
+	}
+
+	data, err := ioutil.ReadFile(w.Filepath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ReadFile for Wasm module")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,29 @@
+package moduleref
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+)
+
+func TestRefWithFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"runnables/test.wasm": &fstest.MapFile{Data: testModule},
+	}
+
+	data, err := RefWithFS("test", "", fsys, "runnables/test.wasm").Bytes()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if string(data) != string(testModule) {
+		t.Error("unexpected module bytes", data)
+	}
+
+	// the path is only looked up in the fs.FS, never on the host's filesystem
+	if _, err := RefWithFS("test", "", fsys, "missing.wasm").Bytes(); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected fs.ErrNotExist, got", err)
+	}
+}
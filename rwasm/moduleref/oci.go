@@ -0,0 +1,461 @@
+package moduleref
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const ociScheme = "oci://"
+
+// wasmLayerTypes are the media types used for the layer that holds a Wasm module, in order of preference
+var wasmLayerTypes = []string{
+	"application/vnd.wasm.content.layer.v1+wasm",
+	"application/vnd.module.wasm.content.layer.v1+wasm",
+	"application/wasm",
+}
+
+// manifestTypes are the manifest media types that can be pulled
+var manifestTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// WithRegistryAuth sets the username and password (or token) used to pull oci:// refs. Without it,
+// the credentials for the registry are read from the Docker config file if there are any.
+func WithRegistryAuth(username, password string) FetchOption {
+	return func(opts fetchOpts) fetchOpts {
+		opts.registryAuth = &registryCredentials{username: username, password: password}
+
+		return opts
+	}
+}
+
+// WithInsecureRegistry pulls oci:// refs over plain HTTP, such as from a local registry used during development
+func WithInsecureRegistry() FetchOption {
+	return func(opts fetchOpts) fetchOpts {
+		opts.insecureRegistry = true
+
+		return opts
+	}
+}
+
+// ociReference is a parsed oci:// ref
+type ociReference struct {
+	registry   string
+	repository string
+	// reference is the tag or digest being pulled
+	reference string
+}
+
+// parseOCIReference parses refs such as oci://ghcr.io/org/runnable:v1 or oci://ghcr.io/org/runnable@sha256:...
+// The tag defaults to latest, and docker.io refs are pulled from Docker Hub's registry.
+func parseOCIReference(ref string) (*ociReference, error) {
+	trimmed := strings.TrimPrefix(ref, ociScheme)
+
+	slash := strings.Index(trimmed, "/")
+	if slash < 1 || slash == len(trimmed)-1 {
+		return nil, fmt.Errorf("%s is not a valid OCI reference, expected oci://registry/repository:tag", ref)
+	}
+
+	o := &ociReference{
+		registry:   trimmed[:slash],
+		repository: trimmed[slash+1:],
+		reference:  "latest",
+	}
+
+	if at := strings.Index(o.repository, "@"); at >= 0 {
+		o.reference = o.repository[at+1:]
+		o.repository = o.repository[:at]
+	} else if colon := strings.LastIndex(o.repository, ":"); colon > strings.LastIndex(o.repository, "/") {
+		o.reference = o.repository[colon+1:]
+		o.repository = o.repository[:colon]
+	}
+
+	if o.repository == "" || o.reference == "" {
+		return nil, fmt.Errorf("%s is not a valid OCI reference, expected oci://registry/repository:tag", ref)
+	}
+
+	if o.registry == "docker.io" {
+		o.registry = "registry-1.docker.io"
+
+		if !strings.Contains(o.repository, "/") {
+			o.repository = "library/" + o.repository
+		}
+	}
+
+	return o, nil
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// pullOCIOnce pulls a module from an OCI registry, using the registry's distribution API directly. The manifest is
+// always fetched, but the module's layer is only downloaded if its digest differs from the cached copy's.
+func pullOCIOnce(ref string, opts fetchOpts, cached []byte, meta *fetchMeta) ([]byte, *fetchMeta, error) {
+	oci, err := parseOCIReference(ref)
+	if err != nil {
+		return nil, nil, errNoRetry{err}
+	}
+
+	client := newRegistryClient(oci, opts)
+
+	manifestBytes, err := client.get(fmt.Sprintf("/v2/%s/manifests/%s", oci.repository, oci.reference), strings.Join(manifestTypes, ", "))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get manifest")
+	}
+
+	manifest := ociManifest{}
+	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
+		return nil, nil, errNoRetry{errors.Wrap(err, "failed to Unmarshal manifest")}
+	}
+
+	layer, err := manifest.wasmLayer()
+	if err != nil {
+		return nil, nil, errNoRetry{err}
+	}
+
+	// OCI digests always name their algorithm, and only SHA-256 digests can be checked
+	if !strings.HasPrefix(layer.Digest, "sha256:") {
+		return nil, nil, errNoRetry{fmt.Errorf("unsupported digest algorithm in %q", layer.Digest)}
+	}
+
+	if cached != nil && meta != nil && meta.Digest == layer.Digest {
+		return cached, nil, nil
+	}
+
+	data, err := client.get(fmt.Sprintf("/v2/%s/blobs/%s", oci.repository, layer.Digest), "")
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to get layer")
+	}
+
+	if err := CheckDigest(data, layer.Digest); err != nil {
+		// the layer may have been corrupted in transit, so it's worth trying again
+		return nil, nil, errors.Wrap(err, "failed to CheckDigest")
+	}
+
+	return data, &fetchMeta{URL: ref, Digest: layer.Digest}, nil
+}
+
+// wasmLayer returns the manifest's layer that holds the module, which is the one with a Wasm media
+// type, or the only layer if none of them have one
+func (m ociManifest) wasmLayer() (*ociDescriptor, error) {
+	for _, mediaType := range wasmLayerTypes {
+		for i := range m.Layers {
+			if m.Layers[i].MediaType == mediaType {
+				return &m.Layers[i], nil
+			}
+		}
+	}
+
+	if len(m.Layers) == 1 {
+		return &m.Layers[0], nil
+	}
+
+	if strings.Contains(m.MediaType, "index") || strings.Contains(m.MediaType, "manifest.list") {
+		return nil, fmt.Errorf("OCI reference is a multi-platform index (%s), which is not supported", m.MediaType)
+	}
+
+	return nil, fmt.Errorf("OCI artifact has %d layers and none of them are a Wasm module", len(m.Layers))
+}
+
+// registryClient makes requests to an OCI registry, authenticating when the registry asks it to
+type registryClient struct {
+	opts    fetchOpts
+	baseURL string
+	creds   *registryCredentials
+
+	// authorization is set once the registry has challenged a request
+	authorization string
+}
+
+func newRegistryClient(oci *ociReference, opts fetchOpts) *registryClient {
+	scheme := "https"
+	if opts.insecureRegistry {
+		scheme = "http"
+	}
+
+	creds := opts.registryAuth
+	if creds == nil {
+		creds = dockerCredentials(oci.registry)
+	}
+
+	r := &registryClient{
+		opts:    opts,
+		baseURL: fmt.Sprintf("%s://%s", scheme, oci.registry),
+		creds:   creds,
+	}
+
+	return r
+}
+
+// get fetches a path from the registry. If the registry responds with an auth challenge, the
+// credentials are used to get a token (or are sent directly) and the request is made again.
+func (r *registryClient) get(path, accept string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, r.baseURL+path, nil)
+		if err != nil {
+			return nil, errNoRetry{errors.Wrap(err, "failed to NewRequest")}
+		}
+
+		for k, v := range r.opts.headers {
+			req.Header.Set(k, v)
+		}
+
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+
+		if r.authorization != "" {
+			req.Header.Set("Authorization", r.authorization)
+		}
+
+		resp, err := r.opts.client.Do(req)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to Do request")
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+
+			if err := r.authorize(challenge); err != nil {
+				return nil, errors.Wrap(err, "failed to authorize")
+			}
+
+			continue
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, statusError(resp.StatusCode)
+		}
+
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to ReadAll response body")
+		}
+
+		return data, nil
+	}
+}
+
+// authorize responds to a registry's WWW-Authenticate challenge. Bearer challenges are answered by getting a token
+// from the registry's auth service (anonymously if there are no credentials), and Basic challenges with the credentials.
+func (r *registryClient) authorize(challenge string) error {
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if r.creds == nil {
+			return errNoRetry{errors.New("registry requires credentials, but none are configured")}
+		}
+
+		r.authorization = "Basic " + r.creds.basic()
+	case "bearer":
+		token, err := r.token(params)
+		if err != nil {
+			return errors.Wrap(err, "failed to get token")
+		}
+
+		r.authorization = "Bearer " + token
+	default:
+		return errNoRetry{fmt.Errorf("registry sent unsupported auth challenge %q", challenge)}
+	}
+
+	return nil
+}
+
+// token gets a token from the auth service named in a Bearer challenge
+func (r *registryClient) token(params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", errNoRetry{fmt.Errorf("registry sent invalid token realm %q", params["realm"])}
+	}
+
+	query := realm.Query()
+
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+
+	if scope := params["scope"]; scope != "" {
+		query.Set("scope", scope)
+	}
+
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", errNoRetry{errors.Wrap(err, "failed to NewRequest")}
+	}
+
+	if r.creds != nil {
+		req.Header.Set("Authorization", "Basic "+r.creds.basic())
+	}
+
+	resp, err := r.opts.client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to Do request")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp.StatusCode)
+	}
+
+	tokenResp := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", errors.Wrap(err, "failed to Decode token response")
+	}
+
+	if tokenResp.Token != "" {
+		return tokenResp.Token, nil
+	}
+
+	if tokenResp.AccessToken != "" {
+		return tokenResp.AccessToken, nil
+	}
+
+	return "", errNoRetry{errors.New("auth service did not return a token")}
+}
+
+// parseChallenge parses a WWW-Authenticate header such as: Bearer realm="https://auth.example.com/token",service="registry"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	rest := parts[1]
+
+	for rest != "" {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			break
+		}
+
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+
+		var value string
+
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+
+		params[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+
+	return parts[0], params
+}
+
+type registryCredentials struct {
+	username string
+	password string
+}
+
+func (r *registryCredentials) basic() string {
+	return base64.StdEncoding.EncodeToString([]byte(r.username + ":" + r.password))
+}
+
+// dockerCredentials returns the credentials stored for a registry in the Docker config file ($DOCKER_CONFIG/config.json
+// or ~/.docker/config.json), as written by `docker login`. Credential helpers are not supported.
+func dockerCredentials(registry string) *registryCredentials {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+
+		dir = filepath.Join(home, ".docker")
+	}
+
+	configBytes, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return nil
+	}
+
+	config := struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}{}
+
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil
+	}
+
+	// Docker Hub's credentials are stored under its legacy index address
+	hosts := []string{registry}
+	if registry == "registry-1.docker.io" {
+		hosts = append(hosts, "index.docker.io", "docker.io")
+	}
+
+	for key, auth := range config.Auths {
+		// keys may be a bare host or a URL such as https://index.docker.io/v1/
+		host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		host = strings.SplitN(host, "/", 2)[0]
+
+		for _, h := range hosts {
+			if host != h {
+				continue
+			}
+
+			if auth.Username != "" {
+				return &registryCredentials{username: auth.Username, password: auth.Password}
+			}
+
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil
+			}
+
+			userpass := strings.SplitN(string(decoded), ":", 2)
+			if len(userpass) != 2 {
+				return nil
+			}
+
+			return &registryCredentials{username: userpass[0], password: userpass[1]}
+		}
+	}
+
+	return nil
+}
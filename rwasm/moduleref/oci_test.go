@@ -0,0 +1,205 @@
+package moduleref
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fakeRegistry serves testModule as a Wasm artifact at org/runnable:v1, and requires a bearer token
+// from its /token endpoint, which is only given to the user "reactr" with the password "secret"
+type fakeRegistry struct {
+	url        string
+	blobPulls  int32
+	tokenCalls int32
+
+	// corrupt causes the layer to be served with bytes that don't match its digest
+	corrupt bool
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sum := sha256.Sum256(testModule)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	if r.URL.Path == "/token" {
+		atomic.AddInt32(&f.tokenCalls, 1)
+
+		if user, pass, ok := r.BasicAuth(); !ok || user != "reactr" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("scope") != "repository:org/runnable:pull" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer t0ken" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:org/runnable:pull"`, f.url))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v2/org/runnable/manifests/v1":
+		if !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.manifest.v1+json") {
+			w.WriteHeader(http.StatusNotAcceptable)
+			return
+		}
+
+		manifest := ociManifest{
+			MediaType: "application/vnd.oci.image.manifest.v1+json",
+			Layers: []ociDescriptor{
+				{MediaType: "application/vnd.oci.image.config.v1+json", Digest: "sha256:00", Size: 2},
+				{MediaType: "application/vnd.wasm.content.layer.v1+wasm", Digest: digest, Size: int64(len(testModule))},
+			},
+		}
+
+		json.NewEncoder(w).Encode(manifest)
+	case "/v2/org/runnable/blobs/" + digest:
+		atomic.AddInt32(&f.blobPulls, 1)
+
+		if f.corrupt {
+			w.Write(testModule[:len(testModule)-1])
+			return
+		}
+
+		w.Write(testModule)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeRegistry() (*fakeRegistry, *httptest.Server) {
+	registry := &fakeRegistry{}
+	server := httptest.NewServer(registry)
+	registry.url = server.URL
+
+	return registry, server
+}
+
+func TestParseOCIReference(t *testing.T) {
+	for ref, expected := range map[string]ociReference{
+		"oci://ghcr.io/org/runnable:v1":            {"ghcr.io", "org/runnable", "v1"},
+		"oci://localhost:5000/runnable":            {"localhost:5000", "runnable", "latest"},
+		"oci://ghcr.io/org/runnable@sha256:abc123": {"ghcr.io", "org/runnable", "sha256:abc123"},
+		"oci://docker.io/runnable:v2":              {"registry-1.docker.io", "library/runnable", "v2"},
+	} {
+		parsed, err := parseOCIReference(ref)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to parseOCIReference"))
+		}
+
+		if *parsed != expected {
+			t.Errorf("expected %s to parse to %+v, got %+v", ref, expected, *parsed)
+		}
+	}
+
+	if _, err := parseOCIReference("oci://runnable"); err == nil {
+		t.Error("expected a reference without a registry to fail")
+	}
+}
+
+func TestRefWithOCI(t *testing.T) {
+	registry, server := newFakeRegistry()
+	defer server.Close()
+
+	dir := t.TempDir()
+	url := "oci://" + strings.TrimPrefix(server.URL, "http://") + "/org/runnable:v1"
+
+	for i := 0; i < 2; i++ {
+		ref := RefWithURL("test", "", url, WithInsecureRegistry(), WithRegistryAuth("reactr", "secret"), WithFetchCache(dir))
+
+		data, err := ref.Bytes()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Bytes"))
+		}
+
+		if string(data) != string(testModule) {
+			t.Error("unexpected module bytes", data)
+		}
+	}
+
+	// the layer's digest hadn't changed, so the second pull should use the cached copy
+	if pulls := atomic.LoadInt32(&registry.blobPulls); pulls != 1 {
+		t.Error("expected the layer to be pulled once, got", pulls)
+	}
+}
+
+func TestRefWithOCIDockerConfig(t *testing.T) {
+	_, server := newFakeRegistry()
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	dir := t.TempDir()
+	config := fmt.Sprintf(`{"auths": {"%s": {"auth": "cmVhY3RyOnNlY3JldA=="}}}`, host)
+
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to WriteFile"))
+	}
+
+	t.Setenv("DOCKER_CONFIG", dir)
+
+	data, err := RefWithURL("test", "", "oci://"+host+"/org/runnable:v1", WithInsecureRegistry()).Bytes()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Bytes"))
+	}
+
+	if string(data) != string(testModule) {
+		t.Error("unexpected module bytes", data)
+	}
+}
+
+func TestRefWithOCIUnauthorized(t *testing.T) {
+	registry, server := newFakeRegistry()
+	defer server.Close()
+
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	url := "oci://" + strings.TrimPrefix(server.URL, "http://") + "/org/runnable:v1"
+
+	_, err := RefWithURL("test", "", url, WithInsecureRegistry(), WithRetries(2, time.Millisecond)).Bytes()
+	if !errors.Is(err, ErrFetchFailed) {
+		t.Error("expected ErrFetchFailed, got", err)
+	}
+
+	// the token request was refused, so it should not have been retried
+	if calls := atomic.LoadInt32(&registry.tokenCalls); calls != 1 {
+		t.Error("expected 1 token request, got", calls)
+	}
+}
+
+func TestRefWithOCIDigestMismatch(t *testing.T) {
+	registry, server := newFakeRegistry()
+	defer server.Close()
+
+	registry.corrupt = true
+
+	url := "oci://" + strings.TrimPrefix(server.URL, "http://") + "/org/runnable:v1"
+
+	_, err := RefWithURL("test", "", url, WithInsecureRegistry(), WithRegistryAuth("reactr", "secret"), WithRetries(2, time.Millisecond)).Bytes()
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Error("expected ErrDigestMismatch, got", err)
+	}
+
+	// the layer may have been corrupted in transit, so it should have been pulled again
+	if pulls := atomic.LoadInt32(&registry.blobPulls); pulls != 3 {
+		t.Error("expected the layer to be pulled 3 times, got", pulls)
+	}
+}
@@ -0,0 +1,89 @@
+package moduleref
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrModuleUnsigned is returned by Verify when a module has no signature
+var ErrModuleUnsigned = errors.New("the Wasm module is not signed")
+
+// ErrInvalidSignature is returned by Verify when a module's signature was not made by any of the trusted keys,
+// which means the module was signed by someone else or has been modified since it was signed
+var ErrInvalidSignature = errors.New("the Wasm module's signature is not valid for any trusted key")
+
+// SignatureExt is the extension of the file next to a module that holds its signature, such as runnable.wasm.sig
+const SignatureExt = ".sig"
+
+// Verify checks that data (the module's bytes) was signed by one of keys. If the ref's Signature isn't set, the
+// signature is read from the file next to the module with SignatureExt added to its path (for refs with a Filepath).
+// The signature can be either the raw 64 bytes or base64 encoded.
+func (w *WasmModuleRef) Verify(data []byte, keys []ed25519.PublicKey) error {
+	signature := w.Signature
+
+	if signature == nil {
+		sig, err := w.readSignature()
+		if err != nil {
+			return errors.Wrap(err, "failed to readSignature")
+		}
+
+		signature = sig
+	}
+
+	if len(signature) == 0 {
+		return ErrModuleUnsigned
+	}
+
+	if len(signature) != ed25519.SignatureSize {
+		return errors.Wrapf(ErrInvalidSignature, "signature is %d bytes, expected %d", len(signature), ed25519.SignatureSize)
+	}
+
+	for _, key := range keys {
+		if len(key) == ed25519.PublicKeySize && ed25519.Verify(key, data, signature) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// readSignature reads the signature file next to the module, returning nil if there isn't one
+func (w *WasmModuleRef) readSignature() ([]byte, error) {
+	if w.Filepath == "" || w.URL != "" {
+		return nil, nil
+	}
+
+	var raw []byte
+	var err error
+
+	if w.fsys != nil {
+		raw, err = fs.ReadFile(w.fsys, w.Filepath+SignatureExt)
+	} else {
+		raw, err = ioutil.ReadFile(w.Filepath + SignatureExt)
+	}
+
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, errors.Wrap(err, "failed to ReadFile for signature")
+	}
+
+	if len(raw) == ed25519.SignatureSize {
+		return raw, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSignature, "signature file is neither a raw nor base64 encoded signature")
+	}
+
+	return decoded, nil
+}
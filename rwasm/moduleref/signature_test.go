@@ -0,0 +1,78 @@
+package moduleref
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+)
+
+func TestVerify(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to GenerateKey"))
+	}
+
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to GenerateKey"))
+	}
+
+	ref := RefWithData("test", "", testModule)
+	ref.Signature = ed25519.Sign(private, testModule)
+
+	if err := ref.Verify(testModule, []ed25519.PublicKey{other, public}); err != nil {
+		t.Error(errors.Wrap(err, "failed to Verify"))
+	}
+
+	if err := ref.Verify(testModule, []ed25519.PublicKey{other}); !errors.Is(err, ErrInvalidSignature) {
+		t.Error("expected a module signed by an untrusted key to fail with ErrInvalidSignature, got", err)
+	}
+
+	tampered := append([]byte{}, testModule...)
+	tampered[len(tampered)-1] = 0xff
+
+	if err := ref.Verify(tampered, []ed25519.PublicKey{public}); !errors.Is(err, ErrInvalidSignature) {
+		t.Error("expected a tampered module to fail with ErrInvalidSignature, got", err)
+	}
+
+	if err := RefWithData("test", "", testModule).Verify(testModule, []ed25519.PublicKey{public}); !errors.Is(err, ErrModuleUnsigned) {
+		t.Error("expected an unsigned module to fail with ErrModuleUnsigned, got", err)
+	}
+}
+
+func TestVerifySignatureFile(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to GenerateKey"))
+	}
+
+	signature := ed25519.Sign(private, testModule)
+
+	fsys := fstest.MapFS{
+		"raw.wasm":        &fstest.MapFile{Data: testModule},
+		"raw.wasm.sig":    &fstest.MapFile{Data: signature},
+		"base64.wasm":     &fstest.MapFile{Data: testModule},
+		"base64.wasm.sig": &fstest.MapFile{Data: []byte(base64.StdEncoding.EncodeToString(signature) + "\n")},
+		"unsigned.wasm":   &fstest.MapFile{Data: testModule},
+	}
+
+	for _, path := range []string{"raw.wasm", "base64.wasm"} {
+		ref := RefWithFS("test", "", fsys, path)
+
+		data, err := ref.Bytes()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Bytes"))
+		}
+
+		if err := ref.Verify(data, []ed25519.PublicKey{public}); err != nil {
+			t.Error(errors.Wrapf(err, "failed to Verify %s", path))
+		}
+	}
+
+	if err := RefWithFS("test", "", fsys, "unsigned.wasm").Verify(testModule, []ed25519.PublicKey{public}); !errors.Is(err, ErrModuleUnsigned) {
+		t.Error("expected a module without a signature file to fail with ErrModuleUnsigned, got", err)
+	}
+}
@@ -0,0 +1,207 @@
+package rwasm
+
+import (
+	"crypto/ed25519"
+	"time"
+
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// Option is a function that modifies runnerOpts
+type Option func(runnerOpts) runnerOpts
+
+type runnerOpts struct {
+	runtime runtime.WasmRuntime
+	config  runtime.Config
+	hostFns []runtime.HostFn
+}
+
+func defaultRunnerOpts() runnerOpts {
+	o := runnerOpts{
+		runtime: defaultRuntime(),
+		config:  runtime.Config{},
+		hostFns: []runtime.HostFn{},
+	}
+
+	return o
+}
+
+// WithRuntime sets the Wasm engine used to run the module, overriding the build-time default
+func WithRuntime(wasmRuntime runtime.WasmRuntime) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.runtime = wasmRuntime
+
+		return opts
+	}
+}
+
+// WithFuel sets the amount of fuel each job is given, after which the Runnable is trapped.
+// Fuel roughly corresponds to the number of Wasm instructions executed, and is only supported by the Wasmtime runtime.
+func WithFuel(fuel uint64) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.Fuel = fuel
+
+		return opts
+	}
+}
+
+// WithMaxMemory sets the maximum size in bytes that each instance's linear memory can grow to.
+// Memory is allocated in 64KiB pages, so the limit is rounded down to a whole number of pages (minimum one).
+func WithMaxMemory(bytes uint64) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.MaxMemoryBytes = bytes
+
+		return opts
+	}
+}
+
+// WithCacheDir sets a directory where compiled modules are cached, keyed by the hash of the module,
+// so that subsequent runs can skip compilation. Compiled modules are loaded without being validated,
+// so the directory must not be writable by untrusted users.
+func WithCacheDir(dir string) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.CacheDir = dir
+
+		return opts
+	}
+}
+
+// WithMaxInstanceUses sets the number of jobs each instance runs before it is replaced with a fresh instance,
+// which bounds memory growth and leaked allocations inside long-running guests. 0 (the default) means unlimited.
+func WithMaxInstanceUses(uses int) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.MaxInstanceUses = uses
+
+		return opts
+	}
+}
+
+// WithIdleTimeout sets how long an instance can go unused before it is closed, which reclaims the memory
+// of a Runnable's pool during quiet periods. Closed instances are re-created when they are next needed.
+func WithIdleTimeout(timeout time.Duration) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.IdleTimeout = timeout
+
+		return opts
+	}
+}
+
+// WithMaxSleep sets the longest that a job can sleep for in one call to sleep_ms, which is one minute by default.
+// A sleeping job holds its worker thread and instance, so this bounds how long a job can keep them idle.
+func WithMaxSleep(max time.Duration) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.MaxSleep = max
+
+		return opts
+	}
+}
+
+// WithMaxResponseSize sets the largest HTTP response body, in bytes, that fetch_url and http_request read into memory,
+// which is 10MiB by default. Larger bodies can be streamed with fetch_open and fetch_read instead.
+func WithMaxResponseSize(max int64) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.MaxResponseBytes = max
+
+		return opts
+	}
+}
+
+// WithMaxGuestThreads sets how many guest threads each job's module can have running at once, which is 0 (no threads)
+// by default. Guest threads are spawned with wasi-threads' thread-spawn, which only the wazero runtime supports, and
+// are stopped when the job that spawned them ends. Each runs on its own goroutine, in addition to the worker's threads.
+func WithMaxGuestThreads(max int) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.MaxGuestThreads = max
+
+		return opts
+	}
+}
+
+// WithPreopenDir makes a host directory available to the module's WASI filesystem at guestPath. The module
+// can read and write files within the directory, but nothing else on the host. Can be passed multiple times.
+func WithPreopenDir(hostPath, guestPath string) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.PreopenDirs = append(opts.config.PreopenDirs, runtime.PreopenDir{HostPath: hostPath, GuestPath: guestPath})
+
+		return opts
+	}
+}
+
+// WithEnv sets an environment variable that the module can read using WASI. Can be passed multiple times.
+func WithEnv(key, value string) Option {
+	return func(opts runnerOpts) runnerOpts {
+		env := map[string]string{key: value}
+		for k, v := range opts.config.Env {
+			if k != key {
+				env[k] = v
+			}
+		}
+
+		opts.config.Env = env
+
+		return opts
+	}
+}
+
+// WithArgs sets the command line arguments that the module can read using WASI.
+// The program name (the module's name) is always passed as the first argument.
+func WithArgs(args ...string) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.Args = args
+
+		return opts
+	}
+}
+
+// WithHostFns adds host functions to the "env" module alongside the Runnable API,
+// allowing a module to call functions provided by the application embedding Reactr
+func WithHostFns(fns ...runtime.HostFn) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.hostFns = append(opts.hostFns, fns...)
+
+		return opts
+	}
+}
+
+// WithLibrary links a library module into the Runnable, so that the Runnable can import the library's exports
+// from the module named name. Libraries can also import the exports of libraries added before them.
+func WithLibrary(name string, ref *moduleref.WasmModuleRef) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.Libraries = append(opts.config.Libraries, runtime.Library{Name: name, Ref: ref})
+
+		return opts
+	}
+}
+
+// WithInitSnapshot causes the Runnable's first instance to be snapshotted once it has been initialized (by `_start` or `init`),
+// and the rest of its instances to be restored from the snapshot instead of running the initialization again. Only linear memory
+// and globals are captured, so it should not be used with modules whose initialization opens files or modifies tables.
+func WithInitSnapshot() Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.SnapshotInit = true
+
+		return opts
+	}
+}
+
+// WithTrustedKeys causes the module (and its libraries) to be rejected unless it has an Ed25519 signature made by one
+// of the given public keys, which is checked before the module is compiled. See moduleref.WasmModuleRef.Verify.
+func WithTrustedKeys(keys ...ed25519.PublicKey) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.TrustedKeys = append(opts.config.TrustedKeys, keys...)
+
+		return opts
+	}
+}
+
+// WithProfiling times the guest function calls of the given fraction of jobs (between 0 and 1), which can be read
+// from the Runner's Profile and exported for pprof or flamegraph tools. The wazero runtime records each function
+// that is called, and the other runtimes record only the time spent in the Runnable's run function.
+func WithProfiling(rate float64) Option {
+	return func(opts runnerOpts) runnerOpts {
+		opts.config.ProfileRate = rate
+
+		return opts
+	}
+}
@@ -0,0 +1,162 @@
+package runtime
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// Config is the configuration used by a RuntimeBuilder when building instances, and by a WasmEnvironment when managing them
+type Config struct {
+	// Fuel is the amount of fuel each job is given before it is trapped, 0 means unlimited
+	Fuel uint64
+
+	// MaxMemoryBytes is the maximum size each instance's linear memory can grow to, 0 means unlimited
+	MaxMemoryBytes uint64
+
+	// CacheDir is a directory where compiled modules are cached between runs, empty means no caching
+	CacheDir string
+
+	// MaxInstanceUses is the number of jobs an instance runs before it is replaced with a new one, 0 means unlimited
+	MaxInstanceUses int
+
+	// IdleTimeout is how long an instance can sit unused before it is closed to reclaim its memory, 0 means never
+	IdleTimeout time.Duration
+
+	// MaxSleep is the longest that a job can sleep for in one call to sleep_ms, 0 means one minute
+	MaxSleep time.Duration
+
+	// MaxResponseBytes is the largest HTTP response body that fetch_url and http_request read into memory, 0 means 10MiB
+	MaxResponseBytes int64
+
+	// MaxGuestThreads is the number of guest threads that each job's module can have running at once, 0 means
+	// the module can't spawn threads. Only the wazero runtime can run guest threads
+	MaxGuestThreads int
+
+	// PreopenDirs are host directories that are made available to the module's WASI filesystem
+	PreopenDirs []PreopenDir
+
+	// Env is the set of environment variables the module can read using WASI
+	Env map[string]string
+
+	// Args are the command line arguments passed to the module using WASI, after the program name
+	Args []string
+
+	// Libraries are modules whose exports are linked into the module's imports
+	Libraries []Library
+
+	// SnapshotInit causes instances after the first to be restored from a snapshot of the first
+	// instance's memory and globals, rather than running the module's initialization again
+	SnapshotInit bool
+
+	// ProfileRate is the fraction of jobs (between 0 and 1) whose guest function calls are timed
+	// and recorded into the environment's Profile, 0 means profiling is disabled
+	ProfileRate float64
+
+	// TrustedKeys are the Ed25519 public keys that modules (and libraries) must be signed by before they are
+	// compiled, empty means signatures are not checked
+	TrustedKeys []ed25519.PublicKey
+}
+
+// Library is a module whose exports are made available to the Runnable module as imports
+// from the module named Name. Each instance of the Runnable gets its own instance of each library.
+type Library struct {
+	Name string
+	Ref  *moduleref.WasmModuleRef
+}
+
+// PreopenDir maps a directory on the host to a path that the module can access using WASI
+type PreopenDir struct {
+	HostPath  string
+	GuestPath string
+}
+
+// ValidatePreopenDirs ensures each preopened directory exists on the host,
+// so that a misconfigured directory is reported when the module is built
+func ValidatePreopenDirs(dirs []PreopenDir) error {
+	for _, dir := range dirs {
+		info, err := os.Stat(dir.HostPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to Stat preopened directory %s", dir.HostPath)
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("preopened path %s is not a directory", dir.HostPath)
+		}
+	}
+
+	return nil
+}
+
+// EnvList returns the configured environment variables sorted by key, as parallel lists of keys and values
+func (c Config) EnvList() ([]string, []string) {
+	keys := make([]string, 0, len(c.Env))
+	for key := range c.Env {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = c.Env[key]
+	}
+
+	return keys, values
+}
+
+// ModuleBytes loads a module's bytes, verifying its signature if trusted keys are configured
+func (c Config) ModuleBytes(ref *moduleref.WasmModuleRef) ([]byte, error) {
+	moduleBytes, err := ref.Bytes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get ref Bytes")
+	}
+
+	if len(c.TrustedKeys) > 0 {
+		if err := ref.Verify(moduleBytes, c.TrustedKeys); err != nil {
+			return nil, errors.Wrap(err, "failed to Verify module signature")
+		}
+	}
+
+	return moduleBytes, nil
+}
+
+// LibraryBytes loads each library's module, checking that it can be used and applying the memory limit
+func (c Config) LibraryBytes() ([][]byte, error) {
+	libs := make([][]byte, len(c.Libraries))
+
+	for i, lib := range c.Libraries {
+		libBytes, err := c.ModuleBytes(lib.Ref)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get ModuleBytes for library %s", lib.Name)
+		}
+
+		if err := CheckModule(libBytes); err != nil {
+			return nil, errors.Wrapf(err, "failed to CheckModule for library %s", lib.Name)
+		}
+
+		// only the Runnable's own module is given a shared memory and can spawn guest threads
+		spawns, err := SpawnsThreads(libBytes)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to SpawnsThreads for library %s", lib.Name)
+		} else if spawns {
+			return nil, errors.Wrapf(ErrThreadsNotSupported, "library %s spawns threads", lib.Name)
+		}
+
+		if c.MaxMemoryBytes > 0 {
+			libBytes, err = LimitMemory(libBytes, MaxMemoryPages(c.MaxMemoryBytes))
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to LimitMemory for library %s", lib.Name)
+			}
+		}
+
+		libs[i] = libBytes
+	}
+
+	return libs, nil
+}
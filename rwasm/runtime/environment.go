@@ -1,7 +1,12 @@
 package runtime
 
 import (
+	"context"
+	"math/rand"
+	goruntime "runtime"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -25,42 +30,109 @@ import (
 // the internal Logger used by the Wasm runtime system
 var internalLogger = vlog.Default()
 
+// MaxInstances is the largest number of instances an environment can have in its pool
+const MaxInstances = 1024
+
+// ErrEnvironmentClosed is returned when an environment is used after it has been closed
+var ErrEnvironmentClosed = errors.New("the environment has been closed")
+
+// ErrTooManyInstances is returned by AddInstance when the environment already has MaxInstances instances
+var ErrTooManyInstances = errors.New("the environment has too many instances")
+
+// activeEnvironments holds each environment that has instances, so that they can all be closed with CloseEnvironments.
+// Environments are removed once their instances are removed, so this doesn't keep an environment alive any longer than its worker does
+var activeEnvironments sync.Map
+
 // WasmEnvironment is an environment in which Wasm instances run
 type WasmEnvironment struct {
 	UUID    string
 	builder RuntimeBuilder
+	config  Config
 
+	// availableInstances can hold every instance in the pool, so returning one to it never blocks
 	availableInstances chan *WasmInstance
 
+	// prepared holds instances that were built ahead of time by Prepare, which AddInstance uses before building new ones,
+	// and preparing is the number that Prepare is still building, which are counted so that concurrent calls can't overfill the pool
+	prepared  []*WasmInstance
+	preparing int
+
+	// target is the number of instances that have been requested with AddInstance and not removed,
+	// and live is the number that actually exist, which is lower if idle instances have been evicted
+	target   int
+	live     int
+	evicting bool
+
+	// snapshot is taken from the first instance when the SnapshotInit option is set
+	snapshot *Snapshot
+
+	stats     EnvironmentStats
+	statsLock sync.Mutex
+
+	// profile is only set if the ProfileRate option is set
+	profile *Profile
+
+	// instances is the number of instances that have been built and not yet destroyed (including those in use),
+	// which must reach zero after the environment is closed before the builder can be closed
+	instances int64
+
+	done      chan struct{}
+	closeOnce sync.Once
+
 	lock sync.RWMutex
 }
 
 // NewEnvironment creates a new environment with a pool of available wasmInstances
-func NewEnvironment(builder RuntimeBuilder) *WasmEnvironment {
+func NewEnvironment(builder RuntimeBuilder, config Config) *WasmEnvironment {
 	e := &WasmEnvironment{
 		UUID:               uuid.New().String(),
 		builder:            builder,
-		availableInstances: make(chan *WasmInstance, 64),
+		config:             config,
+		availableInstances: make(chan *WasmInstance, MaxInstances),
+		done:               make(chan struct{}),
 		lock:               sync.RWMutex{},
 	}
 
+	if config.ProfileRate > 0 {
+		e.profile = NewProfile()
+	}
+
 	return e
 }
 
-// AddInstance adds a new Wasm instance to the environment's pool
+// AddInstance adds a new Wasm instance to the environment's pool, or returns ErrTooManyInstances if it already has MaxInstances
 func (w *WasmEnvironment) AddInstance() error {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	inst, err := w.builder.New()
-	if err != nil {
-		return errors.Wrap(err, "failed to builder.New")
+	if w.target >= MaxInstances {
+		return errors.Wrapf(ErrTooManyInstances, "the limit is %d", MaxInstances)
 	}
 
-	instance := &WasmInstance{
-		runtime:    inst,
-		resultChan: make(chan []byte, 1),
-		errChan:    make(chan rt.RunErr, 1),
+	var instance *WasmInstance
+
+	if len(w.prepared) > 0 {
+		instance = w.prepared[len(w.prepared)-1]
+		w.prepared = w.prepared[:len(w.prepared)-1]
+	} else {
+		inst, err := w.newInstance()
+		if err != nil {
+			return errors.Wrap(err, "failed to newInstance")
+		}
+
+		instance = inst
+	}
+
+	w.target++
+	w.live++
+
+	if w.target == 1 {
+		activeEnvironments.Store(w.UUID, w)
+	}
+
+	if w.config.IdleTimeout > 0 && !w.evicting {
+		w.evicting = true
+		go w.evictIdle()
 	}
 
 	w.availableInstances <- instance
@@ -68,58 +140,711 @@ func (w *WasmEnvironment) AddInstance() error {
 	return nil
 }
 
+// Prepare builds count instances ahead of time to be used by the next calls to AddInstance, so that a large pool can be
+// started without building each of its instances in turn. The first instance compiles the module (and takes the snapshot
+// if the SnapshotInit option is set), and the rest are then built in parallel. Instances that fail to build are left
+// for AddInstance to build, and the first error is returned. No more instances are prepared than the pool has room for.
+func (w *WasmEnvironment) Prepare(count int) error {
+	w.lock.Lock()
+
+	if room := MaxInstances - w.target - len(w.prepared) - w.preparing; count > room {
+		count = room
+	}
+
+	if count < 1 {
+		w.lock.Unlock()
+		return nil
+	}
+
+	first, err := w.newInstance()
+	if err != nil {
+		w.lock.Unlock()
+		return errors.Wrap(err, "failed to newInstance")
+	}
+
+	w.prepared = append(w.prepared, first)
+
+	remaining := count - 1
+	build := w.builder.New
+
+	if snapshotter, ok := w.builder.(SnapshotBuilder); ok && w.config.SnapshotInit {
+		snapshot := w.snapshot
+
+		if snapshot == nil {
+			// taking the snapshot failed, so each instance must try again in turn
+			defer w.lock.Unlock()
+
+			for i := 0; i < remaining; i++ {
+				inst, err := w.newInstance()
+				if err != nil {
+					return errors.Wrap(err, "failed to newInstance")
+				}
+
+				w.prepared = append(w.prepared, inst)
+			}
+
+			return nil
+		}
+
+		build = func() (RuntimeInstance, error) {
+			return snapshotter.NewFromSnapshot(snapshot)
+		}
+	}
+
+	// the instances are counted before they're built so that the builder can't be closed while they're being built,
+	// and reserved so that another call to Prepare doesn't build them too
+	atomic.AddInt64(&w.instances, int64(remaining))
+	w.preparing += remaining
+
+	w.lock.Unlock()
+
+	var firstErr error
+	errLock := sync.Mutex{}
+
+	wg := sync.WaitGroup{}
+	sem := make(chan struct{}, goruntime.GOMAXPROCS(0))
+
+	for i := 0; i < remaining; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			inst, err := build()
+			if err != nil {
+				w.recordInstantiationFailure()
+				w.uncount()
+
+				w.lock.Lock()
+				w.preparing--
+				w.lock.Unlock()
+
+				errLock.Lock()
+				if firstErr == nil {
+					firstErr = errors.Wrap(err, "failed to build instance")
+				}
+				errLock.Unlock()
+
+				return
+			}
+
+			instance := w.wrapInstance(inst)
+
+			w.lock.Lock()
+			defer w.lock.Unlock()
+
+			w.preparing--
+
+			if w.isClosed() {
+				w.destroyInstance(instance)
+				return
+			}
+
+			w.prepared = append(w.prepared, instance)
+		}()
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
 // RemoveInstance removes one of the active instances from rotation and destroys it
 func (w *WasmEnvironment) RemoveInstance() error {
+	w.lock.Lock()
+
+	if w.isClosed() {
+		// the instances have already been destroyed (or will be once they're released)
+		w.lock.Unlock()
+		return nil
+	}
+
+	w.target--
+
+	if w.target <= 0 {
+		activeEnvironments.Delete(w.UUID)
+	}
+
+	if w.live <= w.target {
+		// an idle instance was already evicted, so there's nothing to destroy
+		w.lock.Unlock()
+		return nil
+	}
+
+	w.live--
+	w.lock.Unlock()
+
 	// grab an instance from the available queue
 	// and we won't give it back becuase it's being destroyed
-	inst := <-w.availableInstances
+	select {
+	case inst := <-w.availableInstances:
+		w.destroyInstance(inst)
+	case <-w.done:
+		// the environment was closed while waiting, which destroys the instance instead
+	}
 
-	// 4.
-	inst.runtime.Close()
-	inst.runtime = nil
-	inst.ctx = nil
-	inst.ffiResult = nil
-	inst.resultChan = nil
-	inst.errChan = nil
-	inst = nil
+	return nil
+}
+
+// Close removes all of the environment's instances and releases its compiled module. Instances that are
+// in use are destroyed once their jobs finish, and the module is released after the last one is destroyed.
+// Jobs that are waiting for an instance fail with ErrEnvironmentClosed, as does adding instances after closing.
+func (w *WasmEnvironment) Close() {
+	w.lock.Lock()
+
+	if w.isClosed() {
+		w.lock.Unlock()
+		return
+	}
+
+	close(w.done)
+	activeEnvironments.Delete(w.UUID)
+
+	w.target = 0
+	w.live = 0
+	w.snapshot = nil
+
+	for _, inst := range w.prepared {
+		w.destroyInstance(inst)
+	}
+
+	w.prepared = nil
+
+	w.drain()
+
+	w.lock.Unlock()
+
+	if atomic.LoadInt64(&w.instances) == 0 {
+		w.closeBuilder()
+	}
+}
+
+// CloseEnvironments closes every environment that has instances, such as when the host is shutting down
+func CloseEnvironments() {
+	activeEnvironments.Range(func(_, value interface{}) bool {
+		value.(*WasmEnvironment).Close()
+		return true
+	})
+}
+
+// isClosed returns true if the environment has been closed
+func (w *WasmEnvironment) isClosed() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeBuilder releases the builder's resources if it holds any, once the environment
+// has been closed and all of its instances have been destroyed
+func (w *WasmEnvironment) closeBuilder() {
+	w.closeOnce.Do(func() {
+		if closable, ok := w.builder.(ClosableBuilder); ok {
+			closable.Close()
+		}
+	})
+}
+
+// newInstance builds a new instance, the caller must hold the environment's lock
+func (w *WasmEnvironment) newInstance() (*WasmInstance, error) {
+	if w.isClosed() {
+		return nil, ErrEnvironmentClosed
+	}
+
+	inst, err := w.buildInstance()
+	if err != nil {
+		w.recordInstantiationFailure()
+
+		return nil, errors.Wrap(err, "failed to buildInstance")
+	}
+
+	atomic.AddInt64(&w.instances, 1)
+
+	return w.wrapInstance(inst), nil
+}
+
+// wrapInstance sets up a WasmInstance for a runtime instance that has just been built
+func (w *WasmEnvironment) wrapInstance(inst RuntimeInstance) *WasmInstance {
+	instance := &WasmInstance{
+		runtime:          inst,
+		envUUID:          w.UUID,
+		resultChan:       make(chan []byte, 1),
+		errChan:          make(chan rt.RunErr, 1),
+		maxSleep:         w.config.MaxSleep,
+		maxResponseBytes: w.config.MaxResponseBytes,
+		lastUsed:         time.Now(),
+	}
+
+	w.statsLock.Lock()
+	w.stats.Instantiations++
+	w.statsLock.Unlock()
+
+	w.recordMemory(instance)
+
+	return instance
+}
+
+// recordInstantiationFailure counts an instance that could not be built
+func (w *WasmEnvironment) recordInstantiationFailure() {
+	w.statsLock.Lock()
+	w.stats.InstantiationFailures++
+	w.statsLock.Unlock()
+}
+
+// buildInstance builds a runtime instance, restoring it from the environment's snapshot if there is one.
+// If snapshots are enabled and there isn't one yet, the new instance is initialized and then snapshotted.
+func (w *WasmEnvironment) buildInstance() (RuntimeInstance, error) {
+	snapshotter, ok := w.builder.(SnapshotBuilder)
+	if !w.config.SnapshotInit || !ok {
+		return w.builder.New()
+	}
+
+	if w.snapshot != nil {
+		inst, err := snapshotter.NewFromSnapshot(w.snapshot)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to NewFromSnapshot")
+		}
+
+		return inst, nil
+	}
+
+	inst, err := w.builder.New()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to builder.New")
+	}
+
+	snapshot, err := snapshotter.Snapshot(inst)
+	if err != nil {
+		// instances will continue to be initialized normally, and taking the snapshot will be tried again next time
+		internalLogger.Error(errors.Wrap(err, "[rwasm] failed to Snapshot instance"))
+		return inst, nil
+	}
+
+	w.snapshot = snapshot
+
+	return inst, nil
+}
+
+// replaceInstance adds a new instance to the pool to take the place of one that is being destroyed
+func (w *WasmEnvironment) replaceInstance() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	instance, err := w.newInstance()
+	if err != nil {
+		return errors.Wrap(err, "failed to newInstance")
+	}
+
+	w.availableInstances <- instance
 
 	return nil
 }
 
+// acquireInstance takes an instance from the pool, re-creating one if
+// instances were evicted while idle and all of the remaining ones are in use
+func (w *WasmEnvironment) acquireInstance() (*WasmInstance, error) {
+	select {
+	case inst := <-w.availableInstances:
+		return inst, nil
+	default:
+	}
+
+	w.lock.Lock()
+
+	if w.live < w.target {
+		inst, err := w.newInstance()
+		if err != nil {
+			w.lock.Unlock()
+			return nil, errors.Wrap(err, "failed to newInstance")
+		}
+
+		w.live++
+		w.lock.Unlock()
+
+		return inst, nil
+	}
+
+	w.lock.Unlock()
+
+	select {
+	case inst := <-w.availableInstances:
+		return inst, nil
+	case <-w.done:
+		return nil, ErrEnvironmentClosed
+	}
+}
+
+// release returns an instance to the pool once a job has finished with it, or destroys it if the environment has been closed.
+// This happens after every job, so it doesn't take the environment's lock.
+func (w *WasmEnvironment) release(inst *WasmInstance) {
+	if w.isClosed() {
+		w.destroyInstance(inst)
+		return
+	}
+
+	w.availableInstances <- inst
+
+	// if the environment was closed while the instance was being returned, it may have already been drained
+	if w.isClosed() {
+		w.drain()
+	}
+}
+
+// drain destroys each of the available instances
+func (w *WasmEnvironment) drain() {
+	for {
+		select {
+		case inst := <-w.availableInstances:
+			w.destroyInstance(inst)
+		default:
+			return
+		}
+	}
+}
+
+// evictIdle periodically destroys instances that have not been used for longer than the configured
+// idle timeout, and stops once all of the environment's instances have been removed
+func (w *WasmEnvironment) evictIdle() {
+	interval := w.config.IdleTimeout / 2
+	if interval < time.Millisecond*10 {
+		interval = time.Millisecond * 10
+	}
+
+	for {
+		time.Sleep(interval)
+
+		w.lock.Lock()
+
+		if w.target <= 0 {
+			w.evicting = false
+			w.lock.Unlock()
+			return
+		}
+
+		// check each of the instances that are currently available
+		waiting := len(w.availableInstances)
+
+		for i := 0; i < waiting; i++ {
+			var inst *WasmInstance
+
+			select {
+			case inst = <-w.availableInstances:
+			default:
+			}
+
+			if inst == nil {
+				break
+			}
+
+			if time.Since(inst.lastUsed) > w.config.IdleTimeout {
+				w.destroyInstance(inst)
+				w.live--
+			} else {
+				w.availableInstances <- inst
+			}
+		}
+
+		w.lock.Unlock()
+	}
+}
+
 // UseInstance provides an instance from the environment's pool to be used by a callback function
 func (w *WasmEnvironment) UseInstance(ctx *rt.Ctx, instFunc func(*WasmInstance, int32)) error {
 	// grab an instance from the available queue and then
 	// return it to the environment when finished
-	inst := <-w.availableInstances
-
-	defer func() {
-		w.availableInstances <- inst
-	}()
+	inst, err := w.acquireInstance()
+	if err != nil {
+		return errors.Wrap(err, "failed to acquireInstance")
+	}
 
 	// generate a random identifier as a reference to the instance in use to
 	// easily allow the Wasm module to reference itself when calling back over the FFI
 	ident, err := setupNewIdentifier(inst)
 	if err != nil {
+		w.release(inst)
 		return errors.Wrap(err, "failed to setupNewIdentifier")
 	}
 
+	// give the instance its full fuel budget for this job
+	if metered, ok := inst.runtime.(FuelMeteredInstance); ok {
+		if err := metered.Refuel(); err != nil {
+			removeIdentifier(ident)
+			w.release(inst)
+			return errors.Wrap(err, "failed to Refuel")
+		}
+	}
+
 	// setup the instance's temporary state
 	inst.ffiResult = nil
+	inst.memoryErr = nil
 	inst.ctx = ctx
 
+	// if the job can time out, watch for it while the instance is in use
+	var interrupted chan bool
+	finished := make(chan struct{})
+
+	if ctx.Context().Done() != nil {
+		interrupted = make(chan bool, 1)
+		go w.watchdog(ctx.Context(), inst, finished, interrupted)
+	}
+
+	// tag anything the module prints with where it came from
+	output, hasOutput := inst.runtime.(OutputInstance)
+	if hasOutput {
+		stdout, stderr := output.Output()
+		stdout.setSource(w.UUID, ctx.JobType())
+		stderr.setSource(w.UUID, ctx.JobType())
+	}
+
+	profiling := w.startProfile(inst)
+
 	// do the actual call into the Wasm module
+	start := time.Now()
+
 	instFunc(inst, ident)
 
+	// guest threads don't outlive the job that spawned them
+	threadsStopped := true
+	if threading, ok := inst.runtime.(ThreadingInstance); ok {
+		threadsStopped = threading.StopThreads()
+	}
+
+	inst.endThreads(threadsStopped)
+
+	w.recordCall(inst, time.Since(start))
+
+	inst.closeHandles()
+	inst.jobValues = nil
+
+	if profiling {
+		w.stopProfile(inst)
+	}
+
+	if hasOutput {
+		stdout, stderr := output.Output()
+		stdout.Flush()
+		stderr.Flush()
+	}
+
+	close(finished)
+
+	// remove the instance from global state
+	removeIdentifier(ident)
+
+	if interrupted != nil && <-interrupted {
+		// the watchdog has already replaced the instance, and since it
+		// was stopped part way through a call its state can't be trusted
+		w.destroyInstance(inst)
+
+		return errors.Wrap(ctx.Context().Err(), "instance was interrupted")
+	}
+
+	if !threadsStopped {
+		// the threads that couldn't be stopped are still using the instance's memory
+		if err := w.replaceInstance(); err != nil && !errors.Is(err, ErrEnvironmentClosed) {
+			internalLogger.Error(errors.Wrap(err, "[rwasm] failed to replaceInstance to replace instance with running threads"))
+		}
+
+		w.destroyInstance(inst)
+
+		return nil
+	}
+
 	// clear the instance's temporary state
 	inst.ctx = nil
 	inst.ffiResult = nil
+	inst.memoryErr = nil
+	inst.uses++
+	inst.lastUsed = time.Now()
 
-	// remove the instance from global state
-	removeIdentifier(ident)
+	if w.config.MaxInstanceUses > 0 && inst.uses >= w.config.MaxInstanceUses {
+		w.recycle(inst)
+		return nil
+	}
+
+	w.release(inst)
 
 	return nil
 }
 
+// recycle replaces an instance that has reached its maximum number of uses with a new one, discarding
+// any memory the guest has grown or leaked. If a new instance can't be created, the old one is kept.
+func (w *WasmEnvironment) recycle(inst *WasmInstance) {
+	if err := w.replaceInstance(); err != nil {
+		if !errors.Is(err, ErrEnvironmentClosed) {
+			internalLogger.Error(errors.Wrap(err, "[rwasm] failed to replaceInstance to recycle instance"))
+		}
+
+		w.release(inst)
+		return
+	}
+
+	w.destroyInstance(inst)
+}
+
+// watchdog interrupts an instance if the job using it times out, and replaces it in the pool.
+// If the runtime can't interrupt the instance, it is abandoned to its current call.
+func (w *WasmEnvironment) watchdog(ctx context.Context, inst *WasmInstance, finished chan struct{}, interrupted chan bool) {
+	select {
+	case <-finished:
+		interrupted <- false
+		return
+	case <-ctx.Done():
+		// the job may have finished at the same moment
+		select {
+		case <-finished:
+			interrupted <- false
+			return
+		default:
+		}
+	}
+
+	if interruptible, ok := inst.runtime.(InterruptibleInstance); ok {
+		interruptible.Interrupt()
+	}
+
+	if err := w.replaceInstance(); err != nil && !errors.Is(err, ErrEnvironmentClosed) {
+		internalLogger.Error(errors.Wrap(err, "[rwasm] failed to replaceInstance to replace interrupted instance"))
+	}
+
+	interrupted <- true
+}
+
+// Stats returns the environment's statistics
+func (w *WasmEnvironment) Stats() EnvironmentStats {
+	w.lock.RLock()
+	live := w.live
+	w.lock.RUnlock()
+
+	w.statsLock.Lock()
+	defer w.statsLock.Unlock()
+
+	stats := w.stats
+	stats.UUID = w.UUID
+	stats.Instances = live
+	stats.IdleInstances = len(w.availableInstances)
+
+	stats.HostCalls = make(map[string]uint64, len(w.stats.HostCalls))
+	for name, count := range w.stats.HostCalls {
+		stats.HostCalls[name] = count
+	}
+
+	if stats.Calls > 0 {
+		stats.AverageCallDuration = stats.TotalCallDuration / time.Duration(stats.Calls)
+	}
+
+	return stats
+}
+
+// Profile returns the environment's profile, or nil if profiling is disabled
+func (w *WasmEnvironment) Profile() *Profile {
+	return w.profile
+}
+
+// startProfile decides whether a job should be profiled, and if so starts recording the instance's calls
+func (w *WasmEnvironment) startProfile(inst *WasmInstance) bool {
+	if w.profile == nil || (w.config.ProfileRate < 1 && rand.Float64() >= w.config.ProfileRate) {
+		return false
+	}
+
+	// engines that can't time guest functions only record the calls made into the module
+	if profiling, ok := inst.runtime.(ProfilingInstance); ok {
+		profiling.SetProfile(w.profile)
+	} else {
+		inst.profile = w.profile
+	}
+
+	return true
+}
+
+// stopProfile stops recording an instance's calls
+func (w *WasmEnvironment) stopProfile(inst *WasmInstance) {
+	if profiling, ok := inst.runtime.(ProfilingInstance); ok {
+		profiling.SetProfile(nil)
+	}
+
+	inst.profile = nil
+}
+
+// recordCall records a call that an instance has finished
+func (w *WasmEnvironment) recordCall(inst *WasmInstance, duration time.Duration) {
+	hostCalls, trapped := inst.takeCallStats()
+
+	w.statsLock.Lock()
+	w.stats.Calls++
+	w.stats.TotalCallDuration += duration
+
+	if trapped {
+		w.stats.Traps++
+	}
+
+	if len(hostCalls) > 0 && w.stats.HostCalls == nil {
+		w.stats.HostCalls = map[string]uint64{}
+	}
+
+	for name, count := range hostCalls {
+		w.stats.HostCalls[name] += count
+	}
+
+	w.statsLock.Unlock()
+
+	w.recordMemory(inst)
+}
+
+// recordMemory updates the environment's total memory with the instance's current size,
+// and the memory high-water mark if the instance's memory has grown past it
+func (w *WasmEnvironment) recordMemory(inst *WasmInstance) {
+	sized, ok := inst.runtime.(MemoryReportingInstance)
+	if !ok {
+		return
+	}
+
+	size := sized.MemorySize()
+
+	w.statsLock.Lock()
+	defer w.statsLock.Unlock()
+
+	w.stats.MemoryBytes = w.stats.MemoryBytes + size - inst.memorySize
+	inst.memorySize = size
+
+	if size > w.stats.MemoryHighWaterBytes {
+		w.stats.MemoryHighWaterBytes = size
+	}
+}
+
+// destroyInstance closes an instance and clears its state, and closes the builder
+// if the environment has been closed and this was its last instance
+func (w *WasmEnvironment) destroyInstance(inst *WasmInstance) {
+	w.statsLock.Lock()
+	w.stats.MemoryBytes -= inst.memorySize
+	w.statsLock.Unlock()
+
+	inst.memorySize = 0
+
+	inst.runtime.Close()
+	inst.runtime = nil
+	inst.ctx = nil
+	inst.ffiResult = nil
+	inst.resultChan = nil
+	inst.errChan = nil
+
+	w.uncount()
+}
+
+// uncount removes an instance from the count of those that have been built, and closes the
+// builder if the environment has been closed and it was the last one
+func (w *WasmEnvironment) uncount() {
+	if atomic.AddInt64(&w.instances, -1) == 0 && w.isClosed() {
+		w.closeBuilder()
+	}
+}
+
 // UseInternalLogger sets the logger to be used log internal wasm runtime messages
 func UseInternalLogger(l *vlog.Logger) {
 	internalLogger = l
@@ -0,0 +1,452 @@
+package runtime
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fakeBuilder builds fakeInstances and counts how many it has built and closed
+type fakeBuilder struct {
+	built  int
+	closed int
+	lock   sync.Mutex
+
+	// unloaded is set when the builder itself is closed
+	unloaded bool
+
+	// fail causes New to return an error
+	fail bool
+}
+
+func (f *fakeBuilder) New() (RuntimeInstance, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.fail {
+		return nil, errors.New("failed to build")
+	}
+
+	f.built++
+
+	return &fakeInstance{builder: f}, nil
+}
+
+func (f *fakeBuilder) Close() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.unloaded = true
+}
+
+func (f *fakeBuilder) isUnloaded() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.unloaded
+}
+
+func (f *fakeBuilder) counts() (int, int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.built, f.closed
+}
+
+type fakeInstance struct {
+	builder *fakeBuilder
+}
+
+func (f *fakeInstance) Call(fn string, args ...interface{}) (interface{}, error) { return nil, nil }
+func (f *fakeInstance) ReadMemory(pointer int32, size int32) ([]byte, error)     { return nil, nil }
+func (f *fakeInstance) WriteMemory(data []byte) (int32, error)                   { return 0, nil }
+func (f *fakeInstance) WriteMemoryAtLocation(pointer int32, data []byte) error   { return nil }
+func (f *fakeInstance) Deallocate(pointer int32, length int)                     {}
+func (f *fakeInstance) MemorySize() uint64                                       { return WasmPageSize }
+
+func (f *fakeInstance) Close() {
+	f.builder.lock.Lock()
+	defer f.builder.lock.Unlock()
+
+	f.builder.closed++
+}
+
+func TestRecycleInstance(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{MaxInstanceUses: 3})
+
+	if err := env.AddInstance(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+	}
+
+	for i := 0; i < 7; i++ {
+		if err := env.UseInstance(nil, func(inst *WasmInstance, ident int32) {}); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to UseInstance"))
+		}
+	}
+
+	// the instance is replaced after the 3rd and 6th uses
+	built, closed := builder.counts()
+	if built != 3 {
+		t.Error("expected 3 instances to be built, got", built)
+	}
+
+	if closed != 2 {
+		t.Error("expected 2 instances to be closed, got", closed)
+	}
+}
+
+func TestNoRecycleByDefault(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{})
+
+	if err := env.AddInstance(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := env.UseInstance(nil, func(inst *WasmInstance, ident int32) {}); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to UseInstance"))
+		}
+	}
+
+	if built, _ := builder.counts(); built != 1 {
+		t.Error("expected 1 instance to be built, got", built)
+	}
+}
+
+func TestEvictIdleInstances(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{IdleTimeout: time.Millisecond * 50})
+
+	for i := 0; i < 3; i++ {
+		if err := env.AddInstance(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+		}
+	}
+
+	time.Sleep(time.Millisecond * 250)
+
+	if _, closed := builder.counts(); closed != 3 {
+		t.Error("expected 3 idle instances to be closed, got", closed)
+	}
+
+	// the pool should re-grow when an instance is needed
+	if err := env.UseInstance(nil, func(inst *WasmInstance, ident int32) {}); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to UseInstance"))
+	}
+
+	if built, _ := builder.counts(); built != 4 {
+		t.Error("expected 4 instances to be built, got", built)
+	}
+
+	// removing the instances should not wait on the ones that were evicted
+	for i := 0; i < 3; i++ {
+		if err := env.RemoveInstance(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to RemoveInstance"))
+		}
+	}
+
+	if _, closed := builder.counts(); closed != 4 {
+		t.Error("expected all 4 instances to be closed, got", closed)
+	}
+}
+
+func TestEnvironmentStats(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{})
+
+	for i := 0; i < 2; i++ {
+		if err := env.AddInstance(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := env.UseInstance(nil, func(inst *WasmInstance, ident int32) {
+			time.Sleep(time.Millisecond * 5)
+		}); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to UseInstance"))
+		}
+	}
+
+	builder.lock.Lock()
+	builder.fail = true
+	builder.lock.Unlock()
+
+	if err := env.AddInstance(); err == nil {
+		t.Fatal("expected AddInstance to fail")
+	}
+
+	stats := env.Stats()
+
+	if stats.UUID != env.UUID {
+		t.Error("expected stats to have the environment's UUID")
+	}
+
+	if stats.Instances != 2 {
+		t.Error("expected 2 instances, got", stats.Instances)
+	}
+
+	if stats.Calls != 4 {
+		t.Error("expected 4 calls, got", stats.Calls)
+	}
+
+	if stats.AverageCallDuration < time.Millisecond*5 || stats.TotalCallDuration < time.Millisecond*20 {
+		t.Error("expected calls to take at least 5ms each, got average", stats.AverageCallDuration)
+	}
+
+	if stats.MemoryHighWaterBytes != WasmPageSize {
+		t.Error("expected memory high-water mark of one page, got", stats.MemoryHighWaterBytes)
+	}
+
+	if stats.InstantiationFailures != 1 {
+		t.Error("expected 1 instantiation failure, got", stats.InstantiationFailures)
+	}
+}
+
+func TestCloseEnvironment(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{})
+
+	for i := 0; i < 3; i++ {
+		if err := env.AddInstance(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+		}
+	}
+
+	env.Close()
+
+	if _, closed := builder.counts(); closed != 3 {
+		t.Error("expected 3 instances to be closed, got", closed)
+	}
+
+	if !builder.isUnloaded() {
+		t.Error("expected builder to be closed")
+	}
+
+	if err := env.AddInstance(); !errors.Is(err, ErrEnvironmentClosed) {
+		t.Error("expected AddInstance to fail with ErrEnvironmentClosed, got", err)
+	}
+
+	if err := env.UseInstance(nil, func(inst *WasmInstance, ident int32) {}); !errors.Is(err, ErrEnvironmentClosed) {
+		t.Error("expected UseInstance to fail with ErrEnvironmentClosed, got", err)
+	}
+
+	// deregistering after closing should not block
+	for i := 0; i < 3; i++ {
+		if err := env.RemoveInstance(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to RemoveInstance"))
+		}
+	}
+
+	if stats := env.Stats(); stats.Instances != 0 {
+		t.Error("expected 0 instances, got", stats.Instances)
+	}
+}
+
+func TestCloseEnvironmentInUse(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{})
+
+	if err := env.AddInstance(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error)
+
+	go func() {
+		done <- env.UseInstance(nil, func(inst *WasmInstance, ident int32) {
+			close(started)
+			<-release
+		})
+	}()
+
+	<-started
+
+	env.Close()
+
+	// the instance is in use, so neither it nor the builder can be closed yet
+	if _, closed := builder.counts(); closed != 0 {
+		t.Error("expected the in-use instance not to be closed, got", closed)
+	}
+
+	if builder.isUnloaded() {
+		t.Error("expected builder not to be closed while an instance is in use")
+	}
+
+	close(release)
+
+	if err := <-done; err != nil {
+		t.Fatal(errors.Wrap(err, "failed to UseInstance"))
+	}
+
+	if _, closed := builder.counts(); closed != 1 {
+		t.Error("expected the instance to be closed once released, got", closed)
+	}
+
+	if !builder.isUnloaded() {
+		t.Error("expected builder to be closed after the last instance")
+	}
+}
+
+func TestCloseEnvironments(t *testing.T) {
+	active, removed := &fakeBuilder{}, &fakeBuilder{}
+	activeEnv, removedEnv := NewEnvironment(active, Config{}), NewEnvironment(removed, Config{})
+
+	for _, env := range []*WasmEnvironment{activeEnv, removedEnv} {
+		if err := env.AddInstance(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+		}
+	}
+
+	if err := removedEnv.RemoveInstance(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to RemoveInstance"))
+	}
+
+	if _, exists := activeEnvironments.Load(removedEnv.UUID); exists {
+		t.Error("expected environment with no instances not to be tracked")
+	}
+
+	CloseEnvironments()
+
+	if !active.isUnloaded() {
+		t.Error("expected active environment to be closed")
+	}
+
+	if _, exists := activeEnvironments.Load(activeEnv.UUID); exists {
+		t.Error("expected closed environment not to be tracked")
+	}
+
+	// an environment whose instances were removed is left alone, so it can be started again
+	if removed.isUnloaded() {
+		t.Error("expected environment with no instances not to be closed")
+	}
+}
+
+func TestPrepareInstances(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{})
+
+	if err := env.Prepare(4); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Prepare"))
+	}
+
+	if built, _ := builder.counts(); built != 4 {
+		t.Error("expected 4 instances to be prepared, got", built)
+	}
+
+	// the prepared instances are used first, and then new ones are built
+	for i := 0; i < 5; i++ {
+		if err := env.AddInstance(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+		}
+	}
+
+	if built, _ := builder.counts(); built != 5 {
+		t.Error("expected 5 instances to be built, got", built)
+	}
+
+	if stats := env.Stats(); stats.Instances != 5 {
+		t.Error("expected 5 instances, got", stats.Instances)
+	}
+
+	env.Close()
+
+	if _, closed := builder.counts(); closed != 5 {
+		t.Error("expected 5 instances to be closed, got", closed)
+	}
+}
+
+func TestClosePreparedInstances(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{})
+
+	if err := env.Prepare(3); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Prepare"))
+	}
+
+	if err := env.AddInstance(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+	}
+
+	env.Close()
+
+	// instances that were prepared but never added must be closed too
+	if _, closed := builder.counts(); closed != 3 {
+		t.Error("expected 3 instances to be closed, got", closed)
+	}
+
+	if !builder.isUnloaded() {
+		t.Error("expected builder to be closed")
+	}
+
+	if err := env.Prepare(2); !errors.Is(err, ErrEnvironmentClosed) {
+		t.Error("expected Prepare to fail with ErrEnvironmentClosed, got", err)
+	}
+}
+
+func TestMaxInstances(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{})
+
+	if err := env.Prepare(MaxInstances + 10); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Prepare"))
+	}
+
+	if built, _ := builder.counts(); built != MaxInstances {
+		t.Errorf("expected %d instances to be prepared, got %d", MaxInstances, built)
+	}
+
+	// the pool must be able to hold all of its instances without blocking
+	for i := 0; i < MaxInstances; i++ {
+		if err := env.AddInstance(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to AddInstance"))
+		}
+	}
+
+	if err := env.AddInstance(); !errors.Is(err, ErrTooManyInstances) {
+		t.Error("expected ErrTooManyInstances, got", err)
+	}
+
+	if stats := env.Stats(); stats.Instances != MaxInstances {
+		t.Errorf("expected %d instances, got %d", MaxInstances, stats.Instances)
+	}
+
+	env.Close()
+
+	if _, closed := builder.counts(); closed != MaxInstances {
+		t.Errorf("expected %d instances to be closed, got %d", MaxInstances, closed)
+	}
+}
+
+func TestPrepareConcurrently(t *testing.T) {
+	builder := &fakeBuilder{}
+	env := NewEnvironment(builder, Config{})
+
+	// instances that are still being built by one call must count against the room left for the others
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := env.Prepare(MaxInstances); err != nil {
+				t.Error(errors.Wrap(err, "failed to Prepare"))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if built, _ := builder.counts(); built != MaxInstances {
+		t.Errorf("expected %d instances to be prepared, got %d", MaxInstances, built)
+	}
+
+	env.Close()
+}
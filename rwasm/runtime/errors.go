@@ -0,0 +1,20 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ErrModuleInvalid is returned when a module can't be used to build a Runnable, such as because it isn't a valid Wasm binary,
+// it uses features that aren't supported, or the engine can't compile it. The error says which
+var ErrModuleInvalid = errors.New("module is invalid")
+
+// ErrGuestTrapped is returned when the guest traps during a call, such as by executing unreachable or accessing memory
+// out of bounds. The *Trap (with the guest's stack trace) can be found with errors.As
+var ErrGuestTrapped = errors.New("guest trapped")
+
+// InvalidModule returns err (such as the engine's error compiling a module) marked as ErrModuleInvalid
+func InvalidModule(err error) error {
+	return fmt.Errorf("%w: %w", ErrModuleInvalid, err)
+}
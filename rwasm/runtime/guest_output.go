@@ -0,0 +1,79 @@
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// GuestOutput is an io.Writer that receives what a module writes to its WASI stdout or stderr,
+// and sends each line to the internal logger tagged with the environment and jobType it came from
+type GuestOutput struct {
+	stream  string
+	env     string
+	jobType string
+	buf     []byte
+
+	lock sync.Mutex
+}
+
+// NewGuestOutput creates a GuestOutput for the named stream (stdout or stderr)
+func NewGuestOutput(stream string) *GuestOutput {
+	g := &GuestOutput{
+		stream: stream,
+		buf:    []byte{},
+		lock:   sync.Mutex{},
+	}
+
+	return g
+}
+
+// Write logs each complete line written, and buffers any partial line until it is completed or flushed
+func (g *GuestOutput) Write(p []byte) (int, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.buf = append(g.buf, p...)
+
+	for {
+		idx := bytes.IndexByte(g.buf, '\n')
+		if idx < 0 {
+			break
+		}
+
+		g.log(string(g.buf[:idx]))
+		g.buf = g.buf[idx+1:]
+	}
+
+	return len(p), nil
+}
+
+// Flush logs any partial line that has been written
+func (g *GuestOutput) Flush() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if len(g.buf) > 0 {
+		g.log(string(g.buf))
+		g.buf = []byte{}
+	}
+}
+
+// setSource sets the environment and jobType that the output is tagged with
+func (g *GuestOutput) setSource(env, jobType string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.env = env
+	g.jobType = jobType
+}
+
+func (g *GuestOutput) log(line string) {
+	msg := fmt.Sprintf("[rwasm] (env: %s, jobType: %s) %s: %s", g.env, g.jobType, g.stream, line)
+
+	if g.stream == "stderr" {
+		internalLogger.Warn(msg)
+	} else {
+		internalLogger.Info(msg)
+	}
+}
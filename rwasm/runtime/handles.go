@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrHandleNotFound is returned when a module uses a handle that doesn't refer to an open resource
+var ErrHandleNotFound = errors.New("the handle does not refer to an open resource")
+
+// AddHandle stores a resource that the module can use for the rest of the current job, and returns
+// the handle (which is always positive) that refers to it. The resource is closed when the job ends,
+// if the module doesn't close it first.
+func (w *WasmInstance) AddHandle(resource io.Closer) int32 {
+	if w.handles == nil {
+		w.handles = map[int32]io.Closer{}
+	}
+
+	w.lastHandle++
+	w.handles[w.lastHandle] = resource
+
+	return w.lastHandle
+}
+
+// Handle returns the resource that a handle refers to
+func (w *WasmInstance) Handle(handle int32) (io.Closer, error) {
+	resource, exists := w.handles[handle]
+	if !exists {
+		return nil, ErrHandleNotFound
+	}
+
+	return resource, nil
+}
+
+// CloseHandle closes the resource that a handle refers to, after which the handle can't be used
+func (w *WasmInstance) CloseHandle(handle int32) error {
+	resource, exists := w.handles[handle]
+	if !exists {
+		return ErrHandleNotFound
+	}
+
+	delete(w.handles, handle)
+
+	return resource.Close()
+}
+
+// closeHandles closes any resources that the module left open at the end of a job
+func (w *WasmInstance) closeHandles() {
+	for handle, resource := range w.handles {
+		if err := resource.Close(); err != nil {
+			internalLogger.Error(errors.Wrapf(err, "[rwasm] failed to Close resource for handle %d", handle))
+		}
+	}
+
+	w.handles = nil
+	w.lastHandle = 0
+}
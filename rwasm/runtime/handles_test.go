@@ -0,0 +1,56 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type testResource struct {
+	closed int
+}
+
+func (t *testResource) Close() error {
+	t.closed++
+	return nil
+}
+
+func TestHandles(t *testing.T) {
+	inst := &WasmInstance{}
+
+	first, second := &testResource{}, &testResource{}
+
+	firstHandle := inst.AddHandle(first)
+	secondHandle := inst.AddHandle(second)
+
+	if firstHandle <= 0 || secondHandle == firstHandle {
+		t.Fatal("expected distinct positive handles, got", firstHandle, secondHandle)
+	}
+
+	if resource, err := inst.Handle(firstHandle); err != nil || resource != first {
+		t.Error("expected handle to refer to its resource", err)
+	}
+
+	if err := inst.CloseHandle(firstHandle); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to CloseHandle"))
+	}
+
+	if _, err := inst.Handle(firstHandle); !errors.Is(err, ErrHandleNotFound) {
+		t.Error("expected ErrHandleNotFound for closed handle, got", err)
+	}
+
+	if err := inst.CloseHandle(firstHandle); !errors.Is(err, ErrHandleNotFound) {
+		t.Error("expected ErrHandleNotFound for closing twice, got", err)
+	}
+
+	// resources left open are closed at the end of the job
+	inst.closeHandles()
+
+	if first.closed != 1 || second.closed != 1 {
+		t.Error("expected each resource to be closed once, got", first.closed, second.closed)
+	}
+
+	if _, err := inst.Handle(secondHandle); !errors.Is(err, ErrHandleNotFound) {
+		t.Error("expected handles to be cleared at the end of the job, got", err)
+	}
+}
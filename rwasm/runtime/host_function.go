@@ -1,13 +1,18 @@
 package runtime
 
+import (
+	"fmt"
+)
+
 type innerFunc func(...interface{}) (interface{}, error)
 
 // HostFn describes a host function callable from within a Runnable module
 type HostFn struct {
-	Name     string
-	ArgCount int
-	Returns  bool
-	HostFn   innerFunc
+	Name        string
+	ArgCount    int
+	Returns     bool
+	ReturnCount int
+	HostFn      innerFunc
 }
 
 // NewHostFn creates a new host function
@@ -19,5 +24,65 @@ func NewHostFn(name string, argCount int, returns bool, fn innerFunc) HostFn {
 		HostFn:   fn,
 	}
 
+	if returns {
+		h.ReturnCount = 1
+	}
+
 	return h
 }
+
+// NewMultiReturnHostFn creates a new host function that returns several values to the module (such as
+// a pointer and a length) in a single call. fn must return an []int32 containing returnCount values.
+func NewMultiReturnHostFn(name string, argCount int, returnCount int, fn innerFunc) HostFn {
+	h := HostFn{
+		Name:        name,
+		ArgCount:    argCount,
+		Returns:     returnCount > 0,
+		ReturnCount: returnCount,
+		HostFn:      fn,
+	}
+
+	return h
+}
+
+// ResultCount returns the number of values the host function returns to the module
+func (h HostFn) ResultCount() int {
+	if h.ReturnCount > 0 {
+		return h.ReturnCount
+	}
+
+	if h.Returns {
+		return 1
+	}
+
+	return 0
+}
+
+// ResultValues converts the result of the host function into the values returned to the module.
+// A nil result is returned as zeros so that the module always receives the values it expects.
+func (h HostFn) ResultValues(result interface{}) ([]int32, error) {
+	count := h.ResultCount()
+
+	if count == 0 {
+		return []int32{}, nil
+	}
+
+	if result == nil {
+		return make([]int32, count), nil
+	}
+
+	switch r := result.(type) {
+	case int32:
+		if count == 1 {
+			return []int32{r}, nil
+		}
+	case []int32:
+		if len(r) == count {
+			return r, nil
+		}
+
+		return nil, fmt.Errorf("host function %s returned %d values, expected %d", h.Name, len(r), count)
+	}
+
+	return nil, fmt.Errorf("host function %s returned unexpected type %T", h.Name, result)
+}
@@ -0,0 +1,39 @@
+package runtime
+
+import (
+	"testing"
+)
+
+func TestHostFnResultValues(t *testing.T) {
+	noop := func(args ...interface{}) (interface{}, error) { return nil, nil }
+
+	single := NewHostFn("single", 1, true, noop)
+
+	if vals, err := single.ResultValues(int32(5)); err != nil || len(vals) != 1 || vals[0] != 5 {
+		t.Error("expected [5], got", vals, err)
+	}
+
+	if vals, err := single.ResultValues(nil); err != nil || len(vals) != 1 || vals[0] != 0 {
+		t.Error("expected [0] for nil result, got", vals, err)
+	}
+
+	multi := NewMultiReturnHostFn("multi", 1, 2, noop)
+
+	if vals, err := multi.ResultValues([]int32{1024, 12}); err != nil || len(vals) != 2 || vals[1] != 12 {
+		t.Error("expected [1024 12], got", vals, err)
+	}
+
+	if _, err := multi.ResultValues([]int32{1024}); err == nil {
+		t.Error("expected error for wrong number of values, did not get one")
+	}
+
+	if _, err := multi.ResultValues(int32(1)); err == nil {
+		t.Error("expected error for single value, did not get one")
+	}
+
+	none := NewHostFn("none", 1, false, noop)
+
+	if vals, err := none.ResultValues(nil); err != nil || len(vals) != 0 {
+		t.Error("expected no values, got", vals, err)
+	}
+}
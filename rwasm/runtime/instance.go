@@ -1,22 +1,87 @@
 package runtime
 
 import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm/moduleref"
 )
 
 var ErrExportNotFound = errors.New("the requested export is not found in the module")
 
+// ErrMemoryOutOfBounds is returned when reading or writing an instance's memory would go past its end
+var ErrMemoryOutOfBounds = errors.New("memory access is out of bounds")
+
+// ErrNoMemory is returned when reading or writing the memory of an instance whose module doesn't export any
+var ErrNoMemory = errors.New("the module does not export its memory")
+
+// ErrFuelNotSupported is returned when fuel metering is configured for a runtime that cannot enforce it
+var ErrFuelNotSupported = errors.New("fuel metering is not supported by the runtime")
+
+// ErrFuelExhausted is the RunErr returned when a job consumes its entire fuel budget
+var ErrFuelExhausted = rt.RunErr{Code: 500, Message: "the Runnable exhausted its fuel budget"}
+
 // WasmInstance is an instance of a Wasm runtime
 type WasmInstance struct {
 	runtime RuntimeInstance
 
+	// envUUID is the UUID of the environment the instance belongs to
+	envUUID string
+
 	ctx *rt.Ctx
 
 	ffiResult []byte
 
+	// memoryErr is the first failed memory access made for the current job, which causes the job to fail
+	memoryErr *rt.RunErr
+
 	resultChan chan []byte
 	errChan    chan rt.RunErr
+
+	// handles are resources that the module refers to by number during a job, such as open HTTP responses
+	handles    map[int32]io.Closer
+	lastHandle int32
+
+	// jobValues are set by host functions to keep state for the rest of the current job
+	jobValues map[interface{}]interface{}
+
+	// maxSleep is the environment's configured MaxSleep
+	maxSleep time.Duration
+
+	// maxResponseBytes is the environment's configured MaxResponseBytes
+	maxResponseBytes int64
+
+	// profile is set while a job that is being profiled runs in an instance whose engine can't profile guest functions itself
+	profile *Profile
+
+	// uses is the number of jobs the instance has run, and lastUsed is when it last finished one
+	uses     int
+	lastUsed time.Time
+
+	// memorySize is the instance's linear memory as of the end of its last call, which is counted in its environment's stats
+	memorySize uint64
+
+	// hostCalls and trapped are recorded during a job and added to the environment's stats once it's done
+	hostCalls map[string]uint64
+	trapped   bool
+	callLock  sync.Mutex
+
+	// parent is set for the views of an instance used by its guest threads (see ThreadIdentifier),
+	// and threads are the views of the instance being used during the current job, by identifier
+	parent  *WasmInstance
+	threads map[int32]*WasmInstance
+}
+
+// WasmRuntime is an interface that wraps a Wasm engine such as Wasmer or Wasmtime
+type WasmRuntime interface {
+	// Name returns the name of the engine
+	Name() string
+	// NewBuilder returns a RuntimeBuilder that builds instances of the given module using the engine
+	NewBuilder(ref *moduleref.WasmModuleRef, config Config, hostFns ...HostFn) RuntimeBuilder
 }
 
 // RuntimeBuilder is a factory-style interface that can build Wasm runtimes
@@ -24,19 +89,65 @@ type RuntimeBuilder interface {
 	New() (RuntimeInstance, error)
 }
 
+// SnapshotBuilder is a RuntimeBuilder that can capture an initialized instance's state and build new instances from it
+type SnapshotBuilder interface {
+	// Snapshot captures the memory and mutable globals of an instance that the builder created
+	Snapshot(inst RuntimeInstance) (*Snapshot, error)
+	// NewFromSnapshot builds an instance without initializing it, and restores the snapshot into it
+	NewFromSnapshot(snapshot *Snapshot) (RuntimeInstance, error)
+}
+
+// ClosableBuilder is a RuntimeBuilder that holds resources, such as its compiled module, that can be released
+type ClosableBuilder interface {
+	// Close releases the builder's resources, and is only called once all of the instances it built have been closed
+	Close()
+}
+
 // RuntimeInstance is an interface that wraps various underlying Wasm runtimes like Wasmer, Wasmtime
 type RuntimeInstance interface {
 	Call(fn string, args ...interface{}) (interface{}, error)
-	ReadMemory(pointer int32, size int32) []byte
+	ReadMemory(pointer int32, size int32) ([]byte, error)
 	WriteMemory(data []byte) (int32, error)
-	WriteMemoryAtLocation(pointer int32, data []byte)
+	WriteMemoryAtLocation(pointer int32, data []byte) error
 	Deallocate(pointer int32, length int)
 	Close()
 }
 
-// instanceReference holds a reference to a particular WasmInstance
-type instanceReference struct {
-	Inst *WasmInstance
+// FuelMeteredInstance is a RuntimeInstance whose engine can enforce a fuel budget
+type FuelMeteredInstance interface {
+	// Refuel resets the instance's fuel to the configured budget
+	Refuel() error
+}
+
+// OutputInstance is a RuntimeInstance that captures what its module writes to WASI stdout and stderr
+type OutputInstance interface {
+	// Output returns the writers that receive the module's stdout and stderr
+	Output() (stdout *GuestOutput, stderr *GuestOutput)
+}
+
+// InterruptibleInstance is a RuntimeInstance whose engine can stop a call that is in progress
+type InterruptibleInstance interface {
+	// Interrupt causes the instance's current call to trap, and can be called from any goroutine
+	Interrupt()
+}
+
+// MemoryReportingInstance is a RuntimeInstance that can report the size of its linear memory
+type MemoryReportingInstance interface {
+	// MemorySize returns the current size of the instance's linear memory in bytes
+	MemorySize() uint64
+}
+
+// ThreadingInstance is a RuntimeInstance whose engine can run guest threads alongside the instance's calls
+type ThreadingInstance interface {
+	// StopThreads stops any guest threads that the instance's module has spawned and waits for them to exit,
+	// returning false if they didn't exit in time, in which case the instance can't be used again
+	StopThreads() bool
+}
+
+// ProfilingInstance is a RuntimeInstance whose engine can time each guest function that is called
+type ProfilingInstance interface {
+	// SetProfile causes the instance's calls to be recorded into profile, until it is called again with nil
+	SetProfile(profile *Profile)
 }
 
 /////////////////////////////////////////////////////////////////////////////
@@ -48,26 +159,110 @@ type instanceReference struct {
 
 // Call executes a function from the Wasm Module
 func (w *WasmInstance) Call(fn string, args ...interface{}) (interface{}, error) {
-	return w.runtime.Call(fn, args...)
+	if w.profile != nil {
+		start := time.Now()
+		defer func() { w.profile.Record([]string{fn}, time.Since(start)) }()
+	}
+
+	result, err := w.runtime.Call(fn, args...)
+
+	var trap *Trap
+	if err != nil && errors.As(err, &trap) {
+		root := w.root()
+		root.callLock.Lock()
+		root.trapped = true
+		root.callLock.Unlock()
+	}
+
+	return result, err
+}
+
+// RecordHostCall counts a call that the instance's module has made to the named host function
+func (w *WasmInstance) RecordHostCall(name string) {
+	root := w.root()
+
+	root.callLock.Lock()
+	defer root.callLock.Unlock()
+
+	if root.hostCalls == nil {
+		root.hostCalls = map[string]uint64{}
+	}
+
+	root.hostCalls[name]++
+}
+
+// root returns the instance that a guest thread's view belongs to, or the instance itself
+func (w *WasmInstance) root() *WasmInstance {
+	if w.parent != nil {
+		return w.parent
+	}
+
+	return w
+}
+
+// takeCallStats returns the host calls and whether the instance trapped since it was last called, and resets them
+func (w *WasmInstance) takeCallStats() (map[string]uint64, bool) {
+	w.callLock.Lock()
+	defer w.callLock.Unlock()
+
+	hostCalls, trapped := w.hostCalls, w.trapped
+	w.hostCalls = nil
+	w.trapped = false
+
+	return hostCalls, trapped
 }
 
 // ExecutionResult gets the runnable's execution results
 func (w *WasmInstance) ExecutionResult() ([]byte, error) {
+	var result []byte
+	var runErr *rt.RunErr
+
 	// determine if the instance called return_result or return_error
 	select {
 	case res := <-w.resultChan:
-		return res, nil
+		result = res
 	case err := <-w.errChan:
-		return nil, err
+		runErr = &err
 	default:
 		// do nothing and fall through
 	}
 
-	return nil, nil
+	// a failed memory access means the result can't be trusted
+	w.callLock.Lock()
+	memoryErr := w.memoryErr
+	w.callLock.Unlock()
+
+	if memoryErr != nil {
+		return nil, *memoryErr
+	}
+
+	if runErr != nil {
+		return nil, *runErr
+	}
+
+	return result, nil
 }
 
 // SendExecutionResult allows FFI functions to send the run result
 func (w *WasmInstance) SendExecutionResult(result []byte, runErr *rt.RunErr) {
+	// once the module has guest threads, any of them can send the result, so
+	// later results are dropped rather than blocking the thread sending them
+	if w.hasThreads() {
+		if runErr != nil {
+			select {
+			case w.errChan <- *runErr:
+			default:
+			}
+		} else if result != nil {
+			select {
+			case w.resultChan <- result:
+			default:
+			}
+		}
+
+		return
+	}
+
 	if runErr != nil {
 		w.errChan <- *runErr
 	} else if result != nil {
@@ -75,11 +270,53 @@ func (w *WasmInstance) SendExecutionResult(result []byte, runErr *rt.RunErr) {
 	}
 }
 
+// hasThreads returns true if the instance is a guest thread's view, or its guest threads have made host calls during the current job
+func (w *WasmInstance) hasThreads() bool {
+	if w.parent != nil {
+		return true
+	}
+
+	w.callLock.Lock()
+	defer w.callLock.Unlock()
+
+	return len(w.threads) > 0
+}
+
+// EnvUUID returns the UUID of the environment that the instance belongs to
+func (w *WasmInstance) EnvUUID() string {
+	return w.envUUID
+}
+
+// MaxSleep returns the longest that the instance's jobs can sleep for in one call, or 0 if the default applies
+func (w *WasmInstance) MaxSleep() time.Duration {
+	return w.maxSleep
+}
+
+// MaxResponseBytes returns the largest HTTP response body that the instance's jobs can read into memory, or 0 if the default applies
+func (w *WasmInstance) MaxResponseBytes() int64 {
+	return w.maxResponseBytes
+}
+
 // Ctx returns the instance's Ctx
 func (w *WasmInstance) Ctx() *rt.Ctx {
 	return w.ctx
 }
 
+// SetJobValue stores a value that host functions can get with JobValue until the current job ends.
+// As with context values, the key should be of a type that is private to the package setting it.
+func (w *WasmInstance) SetJobValue(key, value interface{}) {
+	if w.jobValues == nil {
+		w.jobValues = map[interface{}]interface{}{}
+	}
+
+	w.jobValues[key] = value
+}
+
+// JobValue returns a value stored with SetJobValue during the current job, or nil
+func (w *WasmInstance) JobValue(key interface{}) interface{} {
+	return w.jobValues[key]
+}
+
 func (w *WasmInstance) SetFFIResult(data []byte) error {
 	if w.ffiResult != nil {
 		return errors.New("instance ffiResult is already set")
@@ -102,16 +339,59 @@ func (w *WasmInstance) UseFFIResult() ([]byte, error) {
 	return w.ffiResult, nil
 }
 
-func (w *WasmInstance) ReadMemory(pointer int32, size int32) []byte {
-	return w.runtime.ReadMemory(pointer, size)
+// ReadMemory reads memory from the instance. If the read is out of bounds, the current job will fail with a RunErr.
+func (w *WasmInstance) ReadMemory(pointer int32, size int32) ([]byte, error) {
+	data, err := w.runtime.ReadMemory(pointer, size)
+	if err != nil {
+		w.setMemoryErr(err)
+		return nil, err
+	}
+
+	return data, nil
 }
 
 func (w *WasmInstance) WriteMemory(data []byte) (int32, error) {
-	return w.runtime.WriteMemory(data)
+	pointer, err := w.runtime.WriteMemory(data)
+	if err != nil {
+		if errors.Is(err, ErrMemoryOutOfBounds) {
+			w.setMemoryErr(err)
+		}
+
+		return 0, err
+	}
+
+	return pointer, nil
+}
+
+// WriteMemoryAtLocation writes memory into the instance. If the write is out of bounds, the current job will fail with a RunErr.
+func (w *WasmInstance) WriteMemoryAtLocation(pointer int32, data []byte) error {
+	if err := w.runtime.WriteMemoryAtLocation(pointer, data); err != nil {
+		w.setMemoryErr(err)
+		return err
+	}
+
+	return nil
+}
+
+// setMemoryErr records a failed memory access as the RunErr for the current job, unless one has already been recorded
+func (w *WasmInstance) setMemoryErr(err error) {
+	root := w.root()
+
+	root.callLock.Lock()
+	defer root.callLock.Unlock()
+
+	if root.memoryErr == nil {
+		root.memoryErr = &rt.RunErr{Code: 500, Message: fmt.Sprintf("the Runnable made an invalid memory access: %s", err.Error())}
+	}
 }
 
-func (w *WasmInstance) WriteMemoryAtLocation(pointer int32, data []byte) {
-	w.runtime.WriteMemoryAtLocation(pointer, data)
+// CheckMemoryBounds returns an error if the size bytes starting at pointer are not within a memory of memSize bytes
+func CheckMemoryBounds(pointer int32, size int, memSize int) error {
+	if pointer < 0 || size < 0 || int64(pointer)+int64(size) > int64(memSize) {
+		return errors.Wrapf(ErrMemoryOutOfBounds, "%d bytes at %d is outside of memory of size %d", size, pointer, memSize)
+	}
+
+	return nil
 }
 
 func (w *WasmInstance) Deallocate(pointer int32, length int) {
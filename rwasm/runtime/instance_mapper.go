@@ -2,29 +2,61 @@ package runtime
 
 import (
 	"crypto/rand"
+	"encoding/binary"
 	"math"
-	"math/big"
 	"sync"
 
 	"github.com/pkg/errors"
 )
 
-// the instance mapper is a global var that maps a random int32 to a wasm instance to make bi-directional FFI calls "easy"
-var instanceMapper = sync.Map{}
+// instanceShardCount is the number of shards in the instance mapper
+const instanceShardCount = 64
+
+// identifierBufferSize is the number of random bytes that are read at once to generate identifiers
+const identifierBufferSize = 512
+
+// the instance mapper is a global var that maps a random int32 to a wasm instance to make bi-directional FFI calls "easy".
+// Identifiers are added and removed for every job, so the mapper is split into shards that each have their own lock
+// (rather than being a single sync.Map, which is slow to update) to keep concurrent jobs from contending with each other
+var instanceMapper = newInstanceMapper()
+
+type instanceShard struct {
+	instances map[int32]*WasmInstance
+	lock      sync.RWMutex
+}
+
+type shardedInstanceMapper [instanceShardCount]*instanceShard
+
+func newInstanceMapper() *shardedInstanceMapper {
+	m := &shardedInstanceMapper{}
+	for i := range m {
+		m[i] = &instanceShard{instances: map[int32]*WasmInstance{}}
+	}
+
+	return m
+}
+
+// shard returns the shard that holds ident, which is random so the shards are used evenly
+func (m *shardedInstanceMapper) shard(ident int32) *instanceShard {
+	return m[uint32(ident)%instanceShardCount]
+}
 
 func InstanceForIdentifier(ident int32, needsFFIResult bool) (*WasmInstance, error) {
-	rawRef, exists := instanceMapper.Load(ident)
+	shard := instanceMapper.shard(ident)
+
+	shard.lock.RLock()
+	inst, exists := shard.instances[ident]
+	shard.lock.RUnlock()
+
 	if !exists {
 		return nil, errors.New("instance does not exist")
 	}
 
-	ref := rawRef.(instanceReference)
-
-	if needsFFIResult && ref.Inst.ffiResult != nil {
+	if needsFFIResult && inst.ffiResult != nil {
 		return nil, errors.New("cannot use instance for host call with existing call in progress")
 	}
 
-	return ref.Inst, nil
+	return inst, nil
 }
 
 func setupNewIdentifier(inst *WasmInstance) (int32, error) {
@@ -34,32 +66,63 @@ func setupNewIdentifier(inst *WasmInstance) (int32, error) {
 			return -1, errors.Wrap(err, "failed to randomIdentifier")
 		}
 
+		shard := instanceMapper.shard(ident)
+
+		shard.lock.Lock()
+
 		// ensure we don't accidentally overwrite something else
 		// (however unlikely that may be)
-		if _, exists := instanceMapper.Load(ident); exists {
+		if _, exists := shard.instances[ident]; exists {
+			shard.lock.Unlock()
 			continue
 		}
 
-		ref := instanceReference{
-			Inst: inst,
-		}
-
-		instanceMapper.Store(ident, ref)
+		shard.instances[ident] = inst
+		shard.lock.Unlock()
 
 		return ident, nil
 	}
 }
 
 func removeIdentifier(ident int32) {
-	instanceMapper.Delete(ident)
+	shard := instanceMapper.shard(ident)
+
+	shard.lock.Lock()
+	delete(shard.instances, ident)
+	shard.lock.Unlock()
+}
+
+// identifierSource holds random bytes from crypto/rand, so that a syscall is only needed once per buffer rather than once per identifier
+type identifierSource struct {
+	buf    [identifierBufferSize]byte
+	offset int
+}
+
+// identifierSources are pooled so that concurrent jobs don't contend for a single buffer
+var identifierSources = sync.Pool{
+	New: func() interface{} {
+		return &identifierSource{offset: identifierBufferSize}
+	},
 }
 
 func randomIdentifier() (int32, error) {
-	// generate a random number between 0 and the largest possible int32
-	num, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt32))
-	if err != nil {
-		return -1, errors.Wrap(err, "failed to rand.Int")
+	src := identifierSources.Get().(*identifierSource)
+	defer identifierSources.Put(src)
+
+	if src.offset+4 > identifierBufferSize {
+		if _, err := rand.Read(src.buf[:]); err != nil {
+			return -1, errors.Wrap(err, "failed to rand.Read")
+		}
+
+		src.offset = 0
 	}
 
-	return int32(num.Int64()), nil
+	num := binary.LittleEndian.Uint32(src.buf[src.offset:])
+
+	// clear the bytes that were used so the identifier can't be recovered from the buffer
+	binary.LittleEndian.PutUint32(src.buf[src.offset:], 0)
+	src.offset += 4
+
+	// generate a random number between 0 and the largest possible int32
+	return int32(num & math.MaxInt32), nil
 }
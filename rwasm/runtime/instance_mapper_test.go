@@ -0,0 +1,114 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestInstanceMapper(t *testing.T) {
+	inst := &WasmInstance{}
+
+	ident, err := setupNewIdentifier(inst)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to setupNewIdentifier"))
+	}
+
+	found, err := InstanceForIdentifier(ident, true)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to InstanceForIdentifier"))
+	}
+
+	if found != inst {
+		t.Error("expected identifier to map to the instance")
+	}
+
+	// an instance with an FFI result pending can't be used for a call that needs one
+	inst.ffiResult = []byte("pending")
+
+	if _, err := InstanceForIdentifier(ident, true); err == nil {
+		t.Error("expected InstanceForIdentifier to fail with an FFI result pending")
+	}
+
+	removeIdentifier(ident)
+
+	if _, err := InstanceForIdentifier(ident, false); err == nil {
+		t.Error("expected removed identifier not to be found")
+	}
+}
+
+// BenchmarkInstanceMapper simulates many jobs running at once, each of which
+// sets up an identifier and then makes several host calls that look it up
+func BenchmarkInstanceMapper(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		inst := &WasmInstance{}
+
+		for pb.Next() {
+			ident, err := setupNewIdentifier(inst)
+			if err != nil {
+				b.Fatal(errors.Wrap(err, "failed to setupNewIdentifier"))
+			}
+
+			for i := 0; i < 8; i++ {
+				if _, err := InstanceForIdentifier(ident, false); err != nil {
+					b.Fatal(errors.Wrap(err, "failed to InstanceForIdentifier"))
+				}
+			}
+
+			removeIdentifier(ident)
+		}
+	})
+}
+
+// BenchmarkUseInstance runs empty jobs on an environment from many goroutines at once
+func BenchmarkUseInstance(b *testing.B) {
+	env := NewEnvironment(&fakeBuilder{}, Config{})
+
+	for i := 0; i < 8; i++ {
+		if err := env.AddInstance(); err != nil {
+			b.Fatal(errors.Wrap(err, "failed to AddInstance"))
+		}
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := env.UseInstance(nil, func(inst *WasmInstance, ident int32) {
+				InstanceForIdentifier(ident, false)
+			}); err != nil {
+				b.Fatal(errors.Wrap(err, "failed to UseInstance"))
+			}
+		}
+	})
+}
+
+func TestRandomIdentifier(t *testing.T) {
+	seen := map[int32]bool{}
+
+	for i := 0; i < 1000; i++ {
+		ident, err := randomIdentifier()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to randomIdentifier"))
+		}
+
+		if ident < 0 {
+			t.Fatal("expected identifier to be positive, got", ident)
+		}
+
+		seen[ident] = true
+	}
+
+	// collisions are possible, but vanishingly unlikely with 1000 random identifiers
+	if len(seen) < 999 {
+		t.Error("expected identifiers to be unique, got", len(seen))
+	}
+}
+
+func BenchmarkRandomIdentifier(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := randomIdentifier(); err != nil {
+				b.Fatal(errors.Wrap(err, "failed to randomIdentifier"))
+			}
+		}
+	})
+}
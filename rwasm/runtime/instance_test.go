@@ -0,0 +1,35 @@
+package runtime
+
+import (
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheckMemoryBounds(t *testing.T) {
+	cases := []struct {
+		pointer int32
+		size    int
+		valid   bool
+	}{
+		{0, 0, true},
+		{0, WasmPageSize, true},
+		{WasmPageSize - 10, 10, true},
+		{WasmPageSize - 10, 11, false},
+		{WasmPageSize, 1, false},
+		{-1, 1, false},
+		{0, -1, false},
+		{math.MaxInt32, math.MaxInt32, false},
+	}
+
+	for _, c := range cases {
+		err := CheckMemoryBounds(c.pointer, c.size, WasmPageSize)
+
+		if c.valid && err != nil {
+			t.Errorf("expected %d bytes at %d to be valid, got %s", c.size, c.pointer, err)
+		} else if !c.valid && !errors.Is(err, ErrMemoryOutOfBounds) {
+			t.Errorf("expected %d bytes at %d to be out of bounds", c.size, c.pointer)
+		}
+	}
+}
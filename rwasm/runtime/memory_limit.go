@@ -0,0 +1,170 @@
+package runtime
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// WasmPageSize is the size of a page of Wasm linear memory
+	WasmPageSize = 65536
+
+	// maxWasmPages is the number of pages addressable by a 32-bit linear memory
+	maxWasmPages = 65536
+
+	memorySectionID = 5
+)
+
+var wasmHeader = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+// ErrMemoryLimitTooLow is returned when a module's initial memory is larger than the configured limit
+var ErrMemoryLimitTooLow = errors.New("module's initial memory is larger than the memory limit")
+
+// MaxMemoryPages converts a memory limit in bytes to the number of whole Wasm pages that fit within it (minimum one)
+func MaxMemoryPages(maxBytes uint64) uint32 {
+	pages := maxBytes / WasmPageSize
+	if pages < 1 {
+		return 1
+	} else if pages > maxWasmPages {
+		return maxWasmPages
+	}
+
+	return uint32(pages)
+}
+
+// LimitMemory returns a copy of a Wasm module with the maximum size of each memory it defines capped at maxPages,
+// which causes any attempt to grow memory beyond the cap to fail regardless of which runtime is used
+func LimitMemory(module []byte, maxPages uint32) ([]byte, error) {
+	if len(module) < len(wasmHeader) || !bytes.Equal(module[:len(wasmHeader)], wasmHeader) {
+		return nil, errors.Wrap(ErrModuleInvalid, "not a valid Wasm binary")
+	}
+
+	limited := make([]byte, 0, len(module)+8)
+	limited = append(limited, wasmHeader...)
+
+	pos := len(wasmHeader)
+
+	for pos < len(module) {
+		id := module[pos]
+
+		size, n, err := readU32(module[pos+1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read section size")
+		}
+
+		start := pos + 1 + n
+		end := start + int(size)
+
+		if end > len(module) {
+			return nil, errors.Wrap(ErrModuleInvalid, "section extends past the end of the module")
+		}
+
+		if id != memorySectionID {
+			limited = append(limited, module[pos:end]...)
+			pos = end
+			continue
+		}
+
+		section, err := limitMemorySection(module[start:end], maxPages)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to limitMemorySection")
+		}
+
+		limited = append(limited, id)
+		limited = appendU32(limited, uint32(len(section)))
+		limited = append(limited, section...)
+
+		pos = end
+	}
+
+	return limited, nil
+}
+
+// limitMemorySection re-encodes the entries of a memory section with their maximum capped at maxPages
+func limitMemorySection(section []byte, maxPages uint32) ([]byte, error) {
+	count, pos, err := readU32(section)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read memory count")
+	}
+
+	limited := appendU32([]byte{}, count)
+
+	for i := uint32(0); i < count; i++ {
+		if pos >= len(section) {
+			return nil, errors.Wrap(ErrModuleInvalid, "memory section is truncated")
+		}
+
+		flags := section[pos]
+		pos++
+
+		// 64-bit memories are not supported
+		if flags&0x04 != 0 {
+			return nil, errors.New("64-bit memories cannot be limited")
+		}
+
+		min, n, err := readU32(section[pos:])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read memory minimum")
+		}
+
+		pos += n
+
+		max := maxPages
+
+		if flags&0x01 != 0 {
+			declaredMax, n, err := readU32(section[pos:])
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read memory maximum")
+			}
+
+			pos += n
+
+			if declaredMax < max {
+				max = declaredMax
+			}
+		}
+
+		if min > max {
+			return nil, ErrMemoryLimitTooLow
+		}
+
+		limited = append(limited, flags|0x01)
+		limited = appendU32(limited, min)
+		limited = appendU32(limited, max)
+	}
+
+	return limited, nil
+}
+
+// readU32 reads an unsigned LEB128 value, returning the value and the number of bytes read
+func readU32(b []byte) (uint32, int, error) {
+	var result uint32
+	var shift uint
+
+	for i := 0; i < len(b) && i < 5; i++ {
+		result |= uint32(b[i]&0x7f) << shift
+
+		if b[i]&0x80 == 0 {
+			return result, i + 1, nil
+		}
+
+		shift += 7
+	}
+
+	return 0, 0, errors.Wrap(ErrModuleInvalid, "invalid LEB128 value")
+}
+
+// appendU32 appends the unsigned LEB128 encoding of val to b
+func appendU32(b []byte, val uint32) []byte {
+	for {
+		c := byte(val & 0x7f)
+		val >>= 7
+
+		if val != 0 {
+			b = append(b, c|0x80)
+		} else {
+			return append(b, c)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package runtime
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// moduleWithMemory builds a minimal module containing a type section and a memory section with the given limits
+func moduleWithMemory(limits ...byte) []byte {
+	module := append([]byte{}, wasmHeader...)
+
+	// a type section with a single () -> () function type, which should be left untouched
+	module = append(module, 0x01, 0x04, 0x01, 0x60, 0x00, 0x00)
+
+	memory := append([]byte{0x01}, limits...)
+	module = append(module, memorySectionID, byte(len(memory)))
+	module = append(module, memory...)
+
+	return module
+}
+
+func TestLimitMemory(t *testing.T) {
+	limited, err := LimitMemory(moduleWithMemory(0x00, 0x01), 2)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to LimitMemory"))
+	}
+
+	if expected := moduleWithMemory(0x01, 0x01, 0x02); !bytes.Equal(limited, expected) {
+		t.Errorf("expected %v, got %v", expected, limited)
+	}
+}
+
+func TestLimitMemoryKeepsLowerMax(t *testing.T) {
+	limited, err := LimitMemory(moduleWithMemory(0x01, 0x01, 0x01), 200)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to LimitMemory"))
+	}
+
+	if expected := moduleWithMemory(0x01, 0x01, 0x01); !bytes.Equal(limited, expected) {
+		t.Errorf("expected %v, got %v", expected, limited)
+	}
+}
+
+func TestLimitMemoryMultiByte(t *testing.T) {
+	// 200 pages is encoded as two LEB128 bytes, which changes the size of the section
+	limited, err := LimitMemory(moduleWithMemory(0x00, 0x01), 200)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to LimitMemory"))
+	}
+
+	if expected := moduleWithMemory(0x01, 0x01, 0xc8, 0x01); !bytes.Equal(limited, expected) {
+		t.Errorf("expected %v, got %v", expected, limited)
+	}
+}
+
+func TestLimitMemoryTooLow(t *testing.T) {
+	if _, err := LimitMemory(moduleWithMemory(0x00, 0x03), 2); !errors.Is(err, ErrMemoryLimitTooLow) {
+		t.Error("expected ErrMemoryLimitTooLow, got", err)
+	}
+}
+
+func TestMaxMemoryPages(t *testing.T) {
+	if pages := MaxMemoryPages(10); pages != 1 {
+		t.Error("expected 1 page, got", pages)
+	}
+
+	if pages := MaxMemoryPages(3*WasmPageSize + 10); pages != 3 {
+		t.Error("expected 3 pages, got", pages)
+	}
+}
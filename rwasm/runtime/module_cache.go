@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// ReadCachedModule reads a module compiled by the named engine from the cache directory, keyed by the hash of the module's bytes.
+// Compiled modules are trusted when they are loaded, so the cache directory must not be writable by untrusted users.
+func ReadCachedModule(dir, engine string, module []byte) ([]byte, bool) {
+	compiled, err := os.ReadFile(cachedModulePath(dir, engine, module))
+	if err != nil {
+		return nil, false
+	}
+
+	return compiled, true
+}
+
+// WriteCachedModule writes a module compiled by the named engine to the cache directory
+func WriteCachedModule(dir, engine string, module, compiled []byte) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "failed to MkdirAll")
+	}
+
+	// write to a temp file and then rename it so that other processes never see a partially written module
+	tmp, err := os.CreateTemp(dir, "module-*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to CreateTemp")
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(compiled); err != nil {
+		tmp.Close()
+		return errors.Wrap(err, "failed to Write")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "failed to Close")
+	}
+
+	if err := os.Rename(tmp.Name(), cachedModulePath(dir, engine, module)); err != nil {
+		return errors.Wrap(err, "failed to Rename")
+	}
+
+	return nil
+}
+
+func cachedModulePath(dir, engine string, module []byte) string {
+	hash := sha256.Sum256(module)
+
+	return filepath.Join(dir, fmt.Sprintf("%s.%s", hex.EncodeToString(hash[:]), engine))
+}
@@ -0,0 +1,37 @@
+package runtime
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestModuleCache(t *testing.T) {
+	dir := t.TempDir()
+
+	module := []byte("module")
+	compiled := []byte("compiled")
+
+	if _, exists := ReadCachedModule(dir, "test", module); exists {
+		t.Error("expected cache miss, got hit")
+	}
+
+	if err := WriteCachedModule(dir, "test", module, compiled); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to WriteCachedModule"))
+	}
+
+	cached, exists := ReadCachedModule(dir, "test", module)
+	if !exists {
+		t.Fatal("expected cache hit, got miss")
+	}
+
+	if !bytes.Equal(cached, compiled) {
+		t.Error("expected cached module to match, got", string(cached))
+	}
+
+	// modules are keyed by engine as well as contents
+	if _, exists := ReadCachedModule(dir, "other", module); exists {
+		t.Error("expected cache miss for other engine, got hit")
+	}
+}
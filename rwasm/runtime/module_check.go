@@ -0,0 +1,281 @@
+package runtime
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// ErrThreadsNotSupported is returned when a Runnable is built from a module that uses shared memory or spawns threads
+// with a runtime that can't run it. The wazero runtime supports both, wasmtime only supports modules that define
+// their own shared memory (which can't spawn threads), and wasmer supports neither
+var ErrThreadsNotSupported = errors.Wrap(ErrModuleInvalid, "modules using shared memory or threads are not supported by the runtime")
+
+const importSectionID = 2
+
+// CheckModule returns an error if the binary can't be used to build a Runnable
+func CheckModule(module []byte) error {
+	if _, err := UsesThreads(module); err != nil {
+		return errors.Wrap(err, "failed to UsesThreads")
+	}
+
+	return nil
+}
+
+// UsesThreads returns true if a module defines or imports a shared memory, or imports
+// the wasi-threads thread-spawn function, which are needed to run guest threads
+func UsesThreads(module []byte) (bool, error) {
+	shared, spawns, err := readThreads(module)
+	if err != nil {
+		return false, err
+	}
+
+	return shared || spawns, nil
+}
+
+// SpawnsThreads returns true if a module imports a shared memory or the wasi-threads thread-spawn function,
+// which need the host to provide its memory and start its threads, rather than only defining a shared memory
+func SpawnsThreads(module []byte) (bool, error) {
+	_, spawns, err := readThreads(module)
+	if err != nil {
+		return false, err
+	}
+
+	return spawns, nil
+}
+
+// readThreads returns whether a module defines a shared memory, and whether it imports a shared memory or thread-spawn
+func readThreads(module []byte) (bool, bool, error) {
+	if len(module) < len(wasmHeader) || !bytes.Equal(module[:len(wasmHeader)], wasmHeader) {
+		return false, false, errors.Wrap(ErrModuleInvalid, "not a valid Wasm binary")
+	}
+
+	var shared, spawns bool
+
+	pos := len(wasmHeader)
+
+	for pos < len(module) {
+		id := module[pos]
+
+		size, n, err := readU32(module[pos+1:])
+		if err != nil {
+			return false, false, errors.Wrap(err, "failed to read section size")
+		}
+
+		start := pos + 1 + n
+		end := start + int(size)
+
+		if end > len(module) {
+			return false, false, errors.Wrap(ErrModuleInvalid, "section extends past the end of the module")
+		}
+
+		var found bool
+
+		switch id {
+		case importSectionID:
+			found, err = importsThreads(module[start:end])
+			spawns = spawns || found
+		case memorySectionID:
+			found, err = definesSharedMemory(module[start:end])
+			shared = shared || found
+		}
+
+		if err != nil {
+			return false, false, errors.Wrapf(err, "failed to read section %d", id)
+		}
+
+		pos = end
+	}
+
+	return shared, spawns, nil
+}
+
+// importsThreads checks an import section for shared memories and thread-spawn
+func importsThreads(section []byte) (bool, error) {
+	imports, err := readImports(section)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to readImports")
+	}
+
+	for _, imp := range imports {
+		if imp.module == "wasi" && imp.name == "thread-spawn" {
+			return true, nil
+		}
+
+		if imp.shared {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// moduleImport is an entry in a module's import section
+type moduleImport struct {
+	module string
+	name   string
+	kind   byte
+
+	// shared is set for imported shared memories, and limits are the encoded limits of imported memories
+	shared bool
+	limits []byte
+
+	// raw is the whole entry
+	raw []byte
+}
+
+// readImports reads the entries of an import section
+func readImports(section []byte) ([]moduleImport, error) {
+	count, pos, err := readU32(section)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read import count")
+	}
+
+	// count comes from the module, so it isn't trusted to size the slice
+	imports := []moduleImport{}
+
+	for i := uint32(0); i < count; i++ {
+		entryStart := pos
+
+		module, n, err := readName(section[pos:])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read import module")
+		}
+
+		pos += n
+
+		name, n, err := readName(section[pos:])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read import name")
+		}
+
+		pos += n
+
+		if pos >= len(section) {
+			return nil, errors.Wrap(ErrModuleInvalid, "import section is truncated")
+		}
+
+		imp := moduleImport{module: module, name: name, kind: section[pos]}
+		pos++
+
+		switch imp.kind {
+		case 0x00, 0x04:
+			// functions are a type index, tags are an attribute and a type index
+			if imp.kind == 0x04 {
+				if pos+1 > len(section) {
+					return nil, errors.Wrap(ErrModuleInvalid, "tag import is truncated")
+				}
+
+				pos++
+			}
+
+			if _, n, err = readU32(section[pos:]); err != nil {
+				return nil, errors.Wrap(err, "failed to read type index")
+			}
+
+			pos += n
+		case 0x01:
+			// tables are a reference type followed by limits
+			if pos+1 > len(section) {
+				return nil, errors.Wrap(ErrModuleInvalid, "table import is truncated")
+			}
+
+			pos++
+
+			if _, n, err = readLimits(section[pos:]); err != nil {
+				return nil, errors.Wrap(err, "failed to read table limits")
+			}
+
+			pos += n
+		case 0x02:
+			shared, n, err := readLimits(section[pos:])
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read memory limits")
+			}
+
+			imp.shared = shared
+			imp.limits = section[pos : pos+n]
+			pos += n
+		case 0x03:
+			// globals are a value type and mutability
+			if pos+2 > len(section) {
+				return nil, errors.Wrap(ErrModuleInvalid, "global import is truncated")
+			}
+
+			pos += 2
+		default:
+			return nil, errors.Wrapf(ErrModuleInvalid, "unknown import kind %d", imp.kind)
+		}
+
+		imp.raw = section[entryStart:pos]
+		imports = append(imports, imp)
+	}
+
+	return imports, nil
+}
+
+// definesSharedMemory checks a memory section for shared memories
+func definesSharedMemory(section []byte) (bool, error) {
+	count, pos, err := readU32(section)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to read memory count")
+	}
+
+	for i := uint32(0); i < count; i++ {
+		shared, n, err := readLimits(section[pos:])
+		if err != nil {
+			return false, errors.Wrap(err, "failed to read memory limits")
+		}
+
+		if shared {
+			return true, nil
+		}
+
+		pos += n
+	}
+
+	return false, nil
+}
+
+// readLimits reads a limits entry, returning whether it is shared and the number of bytes read
+func readLimits(b []byte) (bool, int, error) {
+	if len(b) == 0 {
+		return false, 0, errors.Wrap(ErrModuleInvalid, "limits are truncated")
+	}
+
+	flags := b[0]
+	pos := 1
+
+	_, n, err := readU32(b[pos:])
+	if err != nil {
+		return false, 0, errors.Wrap(err, "failed to read minimum")
+	}
+
+	pos += n
+
+	if flags&0x01 != 0 {
+		_, n, err := readU32(b[pos:])
+		if err != nil {
+			return false, 0, errors.Wrap(err, "failed to read maximum")
+		}
+
+		pos += n
+	}
+
+	return flags&0x02 != 0, pos, nil
+}
+
+// readName reads a length-prefixed name, returning it and the number of bytes read
+func readName(b []byte) (string, int, error) {
+	size, n, err := readU32(b)
+	if err != nil {
+		return "", 0, errors.Wrap(err, "failed to read name length")
+	}
+
+	end := n + int(size)
+	if end > len(b) {
+		return "", 0, errors.Wrap(ErrModuleInvalid, "name is truncated")
+	}
+
+	return string(b[n:end]), end, nil
+}
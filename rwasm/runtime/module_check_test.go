@@ -0,0 +1,114 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheckModule(t *testing.T) {
+	core := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	if err := CheckModule(core); err != nil {
+		t.Error("expected no error for core module, got", err)
+	}
+
+	if err := CheckModule([]byte("not wasm")); !errors.Is(err, ErrModuleInvalid) {
+		t.Error("expected ErrModuleInvalid, got", err)
+	}
+}
+
+func TestUsesThreads(t *testing.T) {
+	header := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	// a memory section with one shared memory (flags 0x03, min 1, max 1)
+	shared := append(append([]byte{}, header...), 0x05, 0x04, 0x01, 0x03, 0x01, 0x01)
+
+	// a memory section with one normal memory (flags 0x00, min 1)
+	unshared := append(append([]byte{}, header...), 0x05, 0x03, 0x01, 0x00, 0x01)
+
+	// an import section importing env.return_result and wasi.thread-spawn as functions
+	spawn := append(append([]byte{}, header...), 0x02, 0x29, 0x02,
+		0x03, 'e', 'n', 'v', 0x0d, 'r', 'e', 't', 'u', 'r', 'n', '_', 'r', 'e', 's', 'u', 'l', 't', 0x00, 0x00,
+		0x04, 'w', 'a', 's', 'i', 0x0c, 't', 'h', 'r', 'e', 'a', 'd', '-', 's', 'p', 'a', 'w', 'n', 0x00, 0x01,
+	)
+
+	// an import section importing a shared memory from env
+	importedShared := append(append([]byte{}, header...), 0x02, 0x10, 0x01,
+		0x03, 'e', 'n', 'v', 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x03, 0x01, 0x02,
+	)
+
+	for name, tc := range map[string]struct {
+		module  []byte
+		threads bool
+	}{
+		"shared":         {shared, true},
+		"unshared":       {unshared, false},
+		"spawn":          {spawn, true},
+		"importedShared": {importedShared, true},
+	} {
+		threads, err := UsesThreads(tc.module)
+		if err != nil {
+			t.Error(errors.Wrapf(err, "failed to UsesThreads for %s", name))
+			continue
+		}
+
+		if threads != tc.threads {
+			t.Errorf("expected %s to have threads %t, got %t", name, tc.threads, threads)
+		}
+	}
+
+	// only the imports need the host to provide the memory and threads
+	for name, tc := range map[string]struct {
+		module []byte
+		spawns bool
+	}{
+		"shared":         {shared, false},
+		"spawn":          {spawn, true},
+		"importedShared": {importedShared, true},
+	} {
+		spawns, err := SpawnsThreads(tc.module)
+		if err != nil {
+			t.Error(errors.Wrapf(err, "failed to SpawnsThreads for %s", name))
+			continue
+		}
+
+		if spawns != tc.spawns {
+			t.Errorf("expected %s to spawn threads %t, got %t", name, tc.spawns, spawns)
+		}
+	}
+
+	// each runtime decides whether it can run the module
+	if err := CheckModule(shared); err != nil {
+		t.Error("expected no error for shared memory, got", err)
+	}
+}
+
+func TestCheckModuleImportCount(t *testing.T) {
+	header := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	// an import section that claims to have 2^32-1 imports but has none
+	module := append(append([]byte{}, header...), 0x02, 0x05, 0xff, 0xff, 0xff, 0xff, 0x0f)
+
+	if err := CheckModule(module); !errors.Is(err, ErrModuleInvalid) {
+		t.Error("expected ErrModuleInvalid, got", err)
+	}
+}
+
+func TestCheckModuleTruncatedImports(t *testing.T) {
+	header := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	for name, section := range map[string][]byte{
+		"global": {0x02, 0x01, 'a', 0x01, 'b', 0x03},
+		"table":  {0x01, 0x01, 'a', 0x01, 'b', 0x01},
+		"tag":    {0x01, 0x01, 'a', 0x01, 'b', 0x04},
+		"kind":   {0x01, 0x01, 'a', 0x01, 'b', 0x07},
+	} {
+		module := append(append([]byte{}, header...), 0x02, byte(len(section)))
+		module = append(module, section...)
+
+		if err := CheckModule(module); !errors.Is(err, ErrModuleInvalid) {
+			t.Errorf("expected ErrModuleInvalid for truncated %s import, got %v", name, err)
+		}
+	}
+}
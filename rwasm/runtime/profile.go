@@ -0,0 +1,199 @@
+package runtime
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/pkg/errors"
+)
+
+// Profile accumulates the time spent in each guest function, by call stack, during the calls that are sampled
+type Profile struct {
+	samples map[string]*ProfileSample
+	started time.Time
+	lock    sync.Mutex
+}
+
+// ProfileSample is the time spent in a call stack, excluding the time spent in the functions it called
+type ProfileSample struct {
+	// Stack is the names of the functions in the stack, outermost first
+	Stack []string
+
+	// Calls is the number of times the innermost function was called with this stack
+	Calls uint64
+
+	Duration time.Duration
+}
+
+// NewProfile creates an empty Profile
+func NewProfile() *Profile {
+	p := &Profile{
+		samples: map[string]*ProfileSample{},
+		started: time.Now(),
+	}
+
+	return p
+}
+
+// Record adds a call to the profile, which spent duration in the innermost function of stack
+func (p *Profile) Record(stack []string, duration time.Duration) {
+	key := strings.Join(stack, ";")
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	sample, exists := p.samples[key]
+	if !exists {
+		sample = &ProfileSample{Stack: append([]string{}, stack...)}
+		p.samples[key] = sample
+	}
+
+	sample.Calls++
+	sample.Duration += duration
+}
+
+// Samples returns a copy of the profile's samples, sorted by stack
+func (p *Profile) Samples() []ProfileSample {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	samples := make([]ProfileSample, len(keys))
+	for i, key := range keys {
+		samples[i] = *p.samples[key]
+	}
+
+	return samples
+}
+
+// Reset discards the profile's samples
+func (p *Profile) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.samples = map[string]*ProfileSample{}
+	p.started = time.Now()
+}
+
+// WriteFolded writes the profile in the folded stack format used by flamegraph tools,
+// one stack per line with its frames separated by semicolons and followed by its time in nanoseconds
+func (p *Profile) WriteFolded(w io.Writer) error {
+	for _, s := range p.Samples() {
+		if _, err := fmt.Fprintf(w, "%s %d\n", strings.Join(s.Stack, ";"), s.Duration.Nanoseconds()); err != nil {
+			return errors.Wrap(err, "failed to Fprintf")
+		}
+	}
+
+	return nil
+}
+
+// WritePprof writes the profile in the gzipped protobuf format read by `go tool pprof`
+func (p *Profile) WritePprof(w io.Writer) error {
+	p.lock.Lock()
+	started := p.started
+	p.lock.Unlock()
+
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "calls", Unit: "count"},
+			{Type: "time", Unit: "nanoseconds"},
+		},
+		TimeNanos:     started.UnixNano(),
+		DurationNanos: time.Since(started).Nanoseconds(),
+	}
+
+	locations := map[string]*profile.Location{}
+
+	for _, s := range p.Samples() {
+		sample := &profile.Sample{
+			Value: []int64{int64(s.Calls), s.Duration.Nanoseconds()},
+		}
+
+		// pprof lists locations innermost first
+		for i := len(s.Stack) - 1; i >= 0; i-- {
+			name := s.Stack[i]
+
+			loc, exists := locations[name]
+			if !exists {
+				fn := &profile.Function{ID: uint64(len(prof.Function) + 1), Name: name, SystemName: name}
+				prof.Function = append(prof.Function, fn)
+
+				loc = &profile.Location{ID: uint64(len(prof.Location) + 1), Line: []profile.Line{{Function: fn}}}
+				prof.Location = append(prof.Location, loc)
+
+				locations[name] = loc
+			}
+
+			sample.Location = append(sample.Location, loc)
+		}
+
+		prof.Sample = append(prof.Sample, sample)
+	}
+
+	if err := prof.Write(w); err != nil {
+		return errors.Wrap(err, "failed to Write profile")
+	}
+
+	return nil
+}
+
+// CallStack tracks the guest functions that are running during a call, recording the time spent in each into a Profile
+type CallStack struct {
+	profile *Profile
+	frames  []callFrame
+}
+
+type callFrame struct {
+	name     string
+	start    time.Time
+	children time.Duration
+}
+
+// NewCallStack creates a CallStack that records into profile
+func NewCallStack(profile *Profile) *CallStack {
+	c := &CallStack{
+		profile: profile,
+	}
+
+	return c
+}
+
+// Enter is called when a function starts running
+func (c *CallStack) Enter(name string) {
+	c.frames = append(c.frames, callFrame{name: name, start: time.Now()})
+}
+
+// Exit is called when the most recently entered function returns or traps
+func (c *CallStack) Exit() {
+	if len(c.frames) == 0 {
+		return
+	}
+
+	last := len(c.frames) - 1
+	frame := c.frames[last]
+	elapsed := time.Since(frame.start)
+
+	stack := make([]string, len(c.frames))
+	for i, f := range c.frames {
+		stack[i] = f.name
+	}
+
+	c.profile.Record(stack, elapsed-frame.children)
+
+	c.frames = c.frames[:last]
+
+	if last > 0 {
+		c.frames[last-1].children += elapsed
+	}
+}
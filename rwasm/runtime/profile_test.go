@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/pkg/errors"
+)
+
+func TestCallStack(t *testing.T) {
+	p := NewProfile()
+
+	stack := NewCallStack(p)
+
+	for i := 0; i < 2; i++ {
+		stack.Enter("run_e")
+		stack.Enter("helper")
+		time.Sleep(time.Millisecond * 10)
+		stack.Exit()
+		stack.Exit()
+	}
+
+	samples := p.Samples()
+	if len(samples) != 2 {
+		t.Fatal("expected 2 samples, got", len(samples))
+	}
+
+	run, helper := samples[0], samples[1]
+
+	if strings.Join(run.Stack, ";") != "run_e" || strings.Join(helper.Stack, ";") != "run_e;helper" {
+		t.Fatal("unexpected stacks", run.Stack, helper.Stack)
+	}
+
+	if run.Calls != 2 || helper.Calls != 2 {
+		t.Error("expected 2 calls of each, got", run.Calls, helper.Calls)
+	}
+
+	// the time spent in helper is not counted as run_e's own time
+	if helper.Duration < time.Millisecond*20 || run.Duration >= helper.Duration {
+		t.Error("unexpected durations", run.Duration, helper.Duration)
+	}
+}
+
+func TestProfileFormats(t *testing.T) {
+	p := NewProfile()
+
+	p.Record([]string{"run_e"}, time.Microsecond)
+	p.Record([]string{"run_e", "helper"}, time.Millisecond)
+
+	folded := &bytes.Buffer{}
+	if err := p.WriteFolded(folded); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to WriteFolded"))
+	}
+
+	if folded.String() != "run_e 1000\nrun_e;helper 1000000\n" {
+		t.Error("unexpected folded profile:", folded.String())
+	}
+
+	buf := &bytes.Buffer{}
+	if err := p.WritePprof(buf); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to WritePprof"))
+	}
+
+	prof, err := profile.Parse(buf)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Parse"))
+	}
+
+	if len(prof.Sample) != 2 || len(prof.Function) != 2 {
+		t.Fatal("expected 2 samples and 2 functions, got", len(prof.Sample), len(prof.Function))
+	}
+
+	// the innermost function comes first
+	helper := prof.Sample[1]
+	if helper.Location[0].Line[0].Function.Name != "helper" || helper.Value[1] != time.Millisecond.Nanoseconds() {
+		t.Error("unexpected sample for helper", helper.Value)
+	}
+}
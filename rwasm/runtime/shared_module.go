@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// sharedModules holds the compiled modules that are in use by at least one builder
+var sharedModules = map[string]*SharedModule{}
+var sharedModulesLock sync.Mutex
+
+// SharedModule is a compiled module that is shared by every builder that compiles the same module bytes
+// with the same settings, so that registering a module under several jobTypes only compiles it once
+type SharedModule struct {
+	// Value is the engine's compiled module (and anything else the engine shares with it)
+	Value interface{}
+
+	key   string
+	refs  int
+	close func()
+	ready chan struct{}
+	err   error
+}
+
+// ModuleKey returns the key for a module compiled by the named engine, from
+// the module's bytes and any of the engine's settings that affect compilation
+func ModuleKey(engine string, module []byte, settings ...string) string {
+	hash := sha256.New()
+	hash.Write([]byte(engine))
+
+	for _, setting := range settings {
+		hash.Write([]byte{0})
+		hash.Write([]byte(setting))
+	}
+
+	hash.Write([]byte{0})
+	hash.Write(module)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// AcquireModule returns the shared module with the given key, calling compile to create it if no builder is using one already.
+// The close function returned by compile is called once every builder that acquired the module has released it.
+func AcquireModule(key string, compile func() (value interface{}, close func(), err error)) (*SharedModule, error) {
+	sharedModulesLock.Lock()
+
+	if shared, exists := sharedModules[key]; exists {
+		shared.refs++
+		sharedModulesLock.Unlock()
+
+		// another builder may still be compiling the module
+		<-shared.ready
+
+		if shared.err != nil {
+			return nil, shared.err
+		}
+
+		return shared, nil
+	}
+
+	shared := &SharedModule{
+		key:   key,
+		refs:  1,
+		ready: make(chan struct{}),
+	}
+
+	sharedModules[key] = shared
+	sharedModulesLock.Unlock()
+
+	shared.Value, shared.close, shared.err = compile()
+	close(shared.ready)
+
+	if shared.err != nil {
+		// builders that were waiting get the same error, and the next one to try will compile it again
+		sharedModulesLock.Lock()
+		delete(sharedModules, key)
+		sharedModulesLock.Unlock()
+
+		return nil, shared.err
+	}
+
+	return shared, nil
+}
+
+// Release is called when a builder is finished with the module, and closes it if no other builder is using it
+func (s *SharedModule) Release() {
+	sharedModulesLock.Lock()
+	defer sharedModulesLock.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+
+	delete(sharedModules, s.key)
+
+	// the module is closed before the lock is released so that a builder acquiring
+	// the same key compiles a new copy rather than finding this one part way through closing
+	if s.close != nil {
+		s.close()
+	}
+}
@@ -0,0 +1,86 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSharedModule(t *testing.T) {
+	compiled, closed := 0, 0
+
+	compile := func() (interface{}, func(), error) {
+		compiled++
+		return compiled, func() { closed++ }, nil
+	}
+
+	key := ModuleKey("test", []byte("module"))
+
+	first, err := AcquireModule(key, compile)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to AcquireModule"))
+	}
+
+	second, err := AcquireModule(key, compile)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to AcquireModule"))
+	}
+
+	if compiled != 1 || second.Value != first.Value {
+		t.Error("expected module to be compiled once and shared, compiled", compiled)
+	}
+
+	first.Release()
+
+	if closed != 0 {
+		t.Error("expected module not to be closed while still in use")
+	}
+
+	second.Release()
+
+	if closed != 1 {
+		t.Error("expected module to be closed once released by both builders, closed", closed)
+	}
+
+	// once it's closed, the next builder compiles it again
+	third, err := AcquireModule(key, compile)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to AcquireModule"))
+	}
+
+	defer third.Release()
+
+	if compiled != 2 {
+		t.Error("expected module to be compiled again, compiled", compiled)
+	}
+}
+
+func TestSharedModuleSettings(t *testing.T) {
+	if ModuleKey("test", []byte("module")) == ModuleKey("test", []byte("module"), "fuel") {
+		t.Error("expected settings to change the key")
+	}
+
+	if ModuleKey("test", []byte("module")) == ModuleKey("other", []byte("module")) {
+		t.Error("expected engine to change the key")
+	}
+}
+
+func TestSharedModuleFailure(t *testing.T) {
+	key := ModuleKey("test", []byte("invalid"))
+
+	if _, err := AcquireModule(key, func() (interface{}, func(), error) {
+		return nil, nil, errors.New("failed to compile")
+	}); err == nil {
+		t.Fatal("expected AcquireModule to fail")
+	}
+
+	// a failure isn't remembered, so compiling can be tried again
+	shared, err := AcquireModule(key, func() (interface{}, func(), error) {
+		return "compiled", nil, nil
+	})
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to AcquireModule"))
+	}
+
+	shared.Release()
+}
@@ -0,0 +1,278 @@
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	globalSectionID = 6
+	exportSectionID = 7
+
+	// snapshotGlobalPrefix is prepended to the index of each mutable global that ExportGlobals exports
+	snapshotGlobalPrefix = "reactr_snapshot_global_"
+)
+
+// Snapshot is the state of an instance's linear memory and mutable globals once its module has been
+// initialized, which is used to create more instances without running the initialization again
+type Snapshot struct {
+	// Memory is a copy of the instance's linear memory
+	Memory []byte
+
+	// Globals are the values of the mutable globals, by export name
+	Globals map[string]interface{}
+}
+
+// MemoryPages returns the number of Wasm pages needed to hold the snapshot's memory
+func (s *Snapshot) MemoryPages() uint32 {
+	return uint32(len(s.Memory) / WasmPageSize)
+}
+
+// ExportGlobals returns a copy of a Wasm module that exports each of the mutable globals it defines, so that
+// their values can be captured in a Snapshot, along with the names they were exported as. Globals of types
+// that can't be captured (such as references) are skipped.
+func ExportGlobals(module []byte) ([]byte, []string, error) {
+	if len(module) < len(wasmHeader) || !bytes.Equal(module[:len(wasmHeader)], wasmHeader) {
+		return nil, nil, errors.Wrap(ErrModuleInvalid, "not a valid Wasm binary")
+	}
+
+	sections, err := readSections(module)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to readSections")
+	}
+
+	importedGlobals := uint32(0)
+	var globals []uint32
+
+	for _, s := range sections {
+		switch s.id {
+		case importSectionID:
+			imports, err := readImports(s.contents)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "failed to readImports")
+			}
+
+			for _, imp := range imports {
+				if imp.kind == 0x03 {
+					importedGlobals++
+				}
+			}
+		case globalSectionID:
+			globals, err = mutableGlobals(s.contents)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "failed to read mutableGlobals")
+			}
+		}
+	}
+
+	if len(globals) == 0 {
+		return module, []string{}, nil
+	}
+
+	// defined globals are numbered after the imported ones
+	exports := []byte{}
+	names := make([]string, len(globals))
+
+	for i, g := range globals {
+		idx := importedGlobals + g
+		names[i] = fmt.Sprintf("%s%d", snapshotGlobalPrefix, idx)
+
+		exports = appendName(exports, names[i])
+		exports = append(exports, 0x03)
+		exports = appendU32(exports, idx)
+	}
+
+	exported := make([]byte, 0, len(module)+len(exports)+8)
+	exported = append(exported, wasmHeader...)
+
+	added := false
+
+	for _, s := range sections {
+		switch s.id {
+		case exportSectionID:
+			count, n, err := readU32(s.contents)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "failed to read export count")
+			}
+
+			section := appendU32([]byte{}, count+uint32(len(globals)))
+			section = append(section, s.contents[n:]...)
+			section = append(section, exports...)
+
+			exported = appendSection(exported, exportSectionID, section)
+			added = true
+		case globalSectionID:
+			exported = append(exported, s.raw...)
+
+			// the export section comes right after the global section, so add one if it's missing
+			if !hasSection(sections, exportSectionID) {
+				section := appendU32([]byte{}, uint32(len(globals)))
+				section = append(section, exports...)
+
+				exported = appendSection(exported, exportSectionID, section)
+				added = true
+			}
+		default:
+			exported = append(exported, s.raw...)
+		}
+	}
+
+	if !added {
+		return nil, nil, errors.New("failed to add global exports")
+	}
+
+	return exported, names, nil
+}
+
+// moduleSection is a section of a Wasm binary
+type moduleSection struct {
+	id       byte
+	contents []byte
+
+	// raw is the whole section, including its ID and size
+	raw []byte
+}
+
+// readSections splits a Wasm binary into its sections
+func readSections(module []byte) ([]moduleSection, error) {
+	sections := []moduleSection{}
+
+	pos := len(wasmHeader)
+
+	for pos < len(module) {
+		id := module[pos]
+
+		size, n, err := readU32(module[pos+1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read section size")
+		}
+
+		start := pos + 1 + n
+		end := start + int(size)
+
+		if end > len(module) {
+			return nil, errors.Wrap(ErrModuleInvalid, "section extends past the end of the module")
+		}
+
+		sections = append(sections, moduleSection{id: id, contents: module[start:end], raw: module[pos:end]})
+
+		pos = end
+	}
+
+	return sections, nil
+}
+
+func hasSection(sections []moduleSection, id byte) bool {
+	for _, s := range sections {
+		if s.id == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mutableGlobals reads a global section, returning the indices (within the section) of mutable globals with numeric types
+func mutableGlobals(section []byte) ([]uint32, error) {
+	count, pos, err := readU32(section)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read global count")
+	}
+
+	globals := []uint32{}
+
+	for i := uint32(0); i < count; i++ {
+		if pos+2 > len(section) {
+			return nil, errors.Wrap(ErrModuleInvalid, "global section is truncated")
+		}
+
+		valType, mutable := section[pos], section[pos+1] == 0x01
+		pos += 2
+
+		n, err := skipConstExpr(section[pos:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read initializer of global %d", i)
+		}
+
+		pos += n
+
+		// i32, i64, f32, and f64
+		if mutable && valType >= 0x7c && valType <= 0x7f {
+			globals = append(globals, i)
+		}
+	}
+
+	return globals, nil
+}
+
+// skipConstExpr returns the length of a constant expression, including its end instruction
+func skipConstExpr(b []byte) (int, error) {
+	pos := 0
+
+	for pos < len(b) {
+		op := b[pos]
+		pos++
+
+		switch op {
+		case 0x0b:
+			// end
+			return pos, nil
+		case 0x41, 0x42, 0x23, 0xd2:
+			// i32.const, i64.const, global.get, and ref.func have one LEB128 immediate
+			n, err := skipLEB(b[pos:])
+			if err != nil {
+				return 0, err
+			}
+
+			pos += n
+		case 0x43:
+			// f32.const
+			pos += 4
+		case 0x44:
+			// f64.const
+			pos += 8
+		case 0xd0:
+			// ref.null has a reference type
+			pos++
+		case 0x6a, 0x6b, 0x6c, 0x7c, 0x7d, 0x7e:
+			// extended constant arithmetic has no immediates
+		case 0xfd:
+			// v128.const is a LEB128 opcode followed by 16 bytes
+			n, err := skipLEB(b[pos:])
+			if err != nil {
+				return 0, err
+			}
+
+			pos += n + 16
+		default:
+			return 0, errors.Errorf("unsupported instruction 0x%x in constant expression", op)
+		}
+	}
+
+	return 0, errors.Wrap(ErrModuleInvalid, "constant expression is truncated")
+}
+
+// skipLEB returns the length of a (signed or unsigned) LEB128 value
+func skipLEB(b []byte) (int, error) {
+	for i := 0; i < len(b) && i < 10; i++ {
+		if b[i]&0x80 == 0 {
+			return i + 1, nil
+		}
+	}
+
+	return 0, errors.Wrap(ErrModuleInvalid, "invalid LEB128 value")
+}
+
+func appendName(b []byte, name string) []byte {
+	b = appendU32(b, uint32(len(name)))
+	return append(b, name...)
+}
+
+func appendSection(b []byte, id byte, contents []byte) []byte {
+	b = append(b, id)
+	b = appendU32(b, uint32(len(contents)))
+
+	return append(b, contents...)
+}
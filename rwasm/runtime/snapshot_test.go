@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestExportGlobals(t *testing.T) {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	// an import section importing an immutable i32 global, which takes global index 0
+	module = appendSection(module, importSectionID, []byte{0x01, 0x03, 'e', 'n', 'v', 0x01, 'g', 0x03, 0x7f, 0x00})
+
+	// a global section with a mutable i32, an immutable i64, and a mutable f64
+	module = appendSection(module, globalSectionID, []byte{0x03,
+		0x7f, 0x01, 0x41, 0x00, 0x0b,
+		0x7e, 0x00, 0x42, 0x00, 0x0b,
+		0x7c, 0x01, 0x44, 0, 0, 0, 0, 0, 0, 0, 0, 0x0b,
+	})
+
+	exported, names, err := ExportGlobals(module)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ExportGlobals"))
+	}
+
+	if len(names) != 2 || names[0] != "reactr_snapshot_global_1" || names[1] != "reactr_snapshot_global_3" {
+		t.Fatal("expected globals 1 and 3 to be exported, got", names)
+	}
+
+	sections, err := readSections(exported)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to readSections"))
+	}
+
+	if len(sections) != 3 || sections[2].id != exportSectionID {
+		t.Fatal("expected an export section to be added after the global section")
+	}
+
+	// export count, then each name followed by the global kind and index
+	expected := []byte{0x02}
+	expected = append(appendName(expected, names[0]), 0x03, 0x01)
+	expected = append(appendName(expected, names[1]), 0x03, 0x03)
+
+	if string(sections[2].contents) != string(expected) {
+		t.Errorf("unexpected export section %x", sections[2].contents)
+	}
+
+	// an existing export section should be extended rather than replaced
+	module = appendSection(module, exportSectionID, append(appendName([]byte{0x01}, "g"), 0x03, 0x00))
+
+	exported, _, err = ExportGlobals(module)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ExportGlobals"))
+	}
+
+	sections, err = readSections(exported)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to readSections"))
+	}
+
+	if len(sections) != 3 || sections[2].contents[0] != 0x03 {
+		t.Error("expected the export section to have 3 exports")
+	}
+}
+
+func TestExportGlobalsNone(t *testing.T) {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	// a global section with only an immutable i32
+	module = appendSection(module, globalSectionID, []byte{0x01, 0x7f, 0x00, 0x41, 0x00, 0x0b})
+
+	exported, names, err := ExportGlobals(module)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ExportGlobals"))
+	}
+
+	if len(names) != 0 || string(exported) != string(module) {
+		t.Error("expected the module to be unchanged")
+	}
+}
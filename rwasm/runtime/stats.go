@@ -0,0 +1,37 @@
+package runtime
+
+import "time"
+
+// EnvironmentStats are statistics about a WasmEnvironment's instances and the calls they have served
+type EnvironmentStats struct {
+	// UUID is the environment's UUID
+	UUID string
+
+	// Instances is the number of instances that currently exist, and IdleInstances is the number waiting for a job
+	Instances     int
+	IdleInstances int
+
+	// MemoryHighWaterBytes is the largest linear memory seen in any of the environment's instances
+	MemoryHighWaterBytes uint64
+
+	// MemoryBytes is the total linear memory of the environment's instances, as of the end of each one's last call
+	MemoryBytes uint64
+
+	// Calls is the number of jobs the environment's instances have run
+	Calls uint64
+
+	// TotalCallDuration is the time spent running jobs, and AverageCallDuration is the mean time per job
+	TotalCallDuration   time.Duration
+	AverageCallDuration time.Duration
+
+	// Instantiations is the number of instances that have been built, and InstantiationFailures
+	// is the number of times building a new instance has failed
+	Instantiations        uint64
+	InstantiationFailures uint64
+
+	// Traps is the number of jobs during which an instance trapped
+	Traps uint64
+
+	// HostCalls is the number of calls that the environment's instances have made to each host function
+	HostCalls map[string]uint64
+}
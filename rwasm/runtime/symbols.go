@@ -0,0 +1,328 @@
+package runtime
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	customSectionID = 0
+	codeSectionID   = 10
+
+	// functionNamesID is the ID of the function names subsection of the name section
+	functionNamesID = 1
+)
+
+// ModuleSymbols maps function indices and code offsets in a module to function names and source
+// locations, using the module's name section and exports, and any DWARF debug info it contains
+type ModuleSymbols struct {
+	names map[uint32]string
+
+	// codeStart is the offset of the code section's contents, which DWARF addresses are relative to
+	codeStart uint64
+	dwarf     *dwarf.Data
+
+	// lines caches each compilation unit's line entries, sorted by address
+	lines map[dwarf.Offset][]dwarf.LineEntry
+	lock  sync.Mutex
+}
+
+// NewModuleSymbols reads the symbols from a module. Debug info that can't be parsed is ignored,
+// so an error is only returned if the module itself can't be read.
+func NewModuleSymbols(module []byte) (*ModuleSymbols, error) {
+	if len(module) < len(wasmHeader) || !bytes.Equal(module[:len(wasmHeader)], wasmHeader) {
+		return nil, errors.Wrap(ErrModuleInvalid, "not a valid Wasm binary")
+	}
+
+	sections, err := readSections(module)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to readSections")
+	}
+
+	m := &ModuleSymbols{
+		names: map[uint32]string{},
+		lines: map[dwarf.Offset][]dwarf.LineEntry{},
+	}
+
+	debugSections := map[string][]byte{}
+	exportNames := map[uint32]string{}
+
+	pos := len(wasmHeader)
+
+	for _, s := range sections {
+		switch s.id {
+		case codeSectionID:
+			m.codeStart = uint64(pos + len(s.raw) - len(s.contents))
+		case exportSectionID:
+			exportNames = readFuncExports(s.contents)
+		case customSectionID:
+			name, n, err := readName(s.contents)
+			if err != nil {
+				break
+			}
+
+			if name == "name" {
+				m.names = readFunctionNames(s.contents[n:])
+			} else if len(name) > 7 && name[:7] == ".debug_" {
+				debugSections[name] = s.contents[n:]
+			}
+		}
+
+		pos += len(s.raw)
+	}
+
+	// exports are used to name any functions missing from the name section
+	for idx, name := range exportNames {
+		if _, exists := m.names[idx]; !exists {
+			m.names[idx] = name
+		}
+	}
+
+	if info, exists := debugSections[".debug_info"]; exists {
+		d, err := dwarf.New(debugSections[".debug_abbrev"], debugSections[".debug_aranges"], debugSections[".debug_frame"], info,
+			debugSections[".debug_line"], debugSections[".debug_pubnames"], debugSections[".debug_ranges"], debugSections[".debug_str"])
+
+		if err == nil {
+			// sections added in DWARF 5
+			for _, name := range []string{".debug_addr", ".debug_line_str", ".debug_str_offsets", ".debug_rnglists"} {
+				if contents, exists := debugSections[name]; exists {
+					if err := d.AddSection(name, contents); err != nil {
+						d = nil
+						break
+					}
+				}
+			}
+
+			m.dwarf = d
+		}
+	}
+
+	return m, nil
+}
+
+// FuncName returns the name of the function with the given index, or an empty string if it is not known
+func (m *ModuleSymbols) FuncName(idx uint32) string {
+	if m == nil {
+		return ""
+	}
+
+	return m.names[idx]
+}
+
+// Symbolicate fills in the function names and source locations of a stack trace's frames where they are known
+func (m *ModuleSymbols) Symbolicate(frames []TrapFrame) {
+	if m == nil {
+		return
+	}
+
+	for i := range frames {
+		if frames[i].FuncName == "" {
+			frames[i].FuncName = m.FuncName(frames[i].FuncIndex)
+		}
+
+		if frames[i].File == "" && frames[i].ModuleOffset > m.codeStart {
+			if line, found := m.lineFor(frames[i].ModuleOffset - m.codeStart); found {
+				frames[i].File = line.File.Name
+				frames[i].Line = line.Line
+				frames[i].Column = line.Column
+			}
+		}
+	}
+}
+
+// lineFor finds the line entry for an address (an offset within the code section) in the DWARF line tables
+func (m *ModuleSymbols) lineFor(addr uint64) (dwarf.LineEntry, bool) {
+	if m.dwarf == nil {
+		return dwarf.LineEntry{}, false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	reader := m.dwarf.Reader()
+
+	for {
+		entry, err := reader.Next()
+		if err != nil || entry == nil {
+			return dwarf.LineEntry{}, false
+		}
+
+		if entry.Tag != dwarf.TagCompileUnit {
+			reader.SkipChildren()
+			continue
+		}
+
+		ranges, err := m.dwarf.Ranges(entry)
+		if err != nil {
+			reader.SkipChildren()
+			continue
+		}
+
+		for _, r := range ranges {
+			if isTombstone(r[0]) {
+				continue
+			}
+
+			if addr >= r[0] && addr < r[1] {
+				return m.lineInUnit(entry, addr)
+			}
+		}
+
+		reader.SkipChildren()
+	}
+}
+
+// lineInUnit finds the line entry for an address within a compilation unit, which is the last
+// entry at or before the address. Entries are sorted first, since some compilers interleave them.
+func (m *ModuleSymbols) lineInUnit(unit *dwarf.Entry, addr uint64) (dwarf.LineEntry, bool) {
+	lines, cached := m.lines[unit.Offset]
+	if !cached {
+		reader, err := m.dwarf.LineReader(unit)
+		if err != nil || reader == nil {
+			return dwarf.LineEntry{}, false
+		}
+
+		// sequences for functions that the linker removed start at a tombstone address, so they are skipped
+		inSequence, dead := false, false
+
+		for {
+			var line dwarf.LineEntry
+			if err := reader.Next(&line); err != nil {
+				if !errors.Is(err, io.EOF) {
+					lines = nil
+				}
+
+				break
+			}
+
+			if !inSequence {
+				inSequence, dead = true, isTombstone(line.Address)
+			}
+
+			if line.EndSequence {
+				inSequence = false
+				continue
+			}
+
+			if !dead {
+				lines = append(lines, line)
+			}
+		}
+
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].Address < lines[j].Address })
+
+		m.lines[unit.Offset] = lines
+	}
+
+	idx := sort.Search(len(lines), func(i int) bool { return lines[i].Address > addr })
+	if idx == 0 {
+		return dwarf.LineEntry{}, false
+	}
+
+	return lines[idx-1], true
+}
+
+// isTombstone returns true if a DWARF address belongs to code that the linker removed, which
+// tools mark with 0, -1, or -2 (as 32-bit values) since the Wasm code section starts at 0
+func isTombstone(addr uint64) bool {
+	addr32 := int32(addr)
+
+	return addr32 == 0 || addr32 == -1 || addr32 == -2
+}
+
+// readFunctionNames reads the function names subsection of a name section
+func readFunctionNames(section []byte) map[uint32]string {
+	names := map[uint32]string{}
+
+	pos := 0
+
+	for pos < len(section) {
+		id := section[pos]
+
+		size, n, err := readU32(section[pos+1:])
+		if err != nil {
+			return names
+		}
+
+		start := pos + 1 + n
+		end := start + int(size)
+
+		if end > len(section) {
+			return names
+		}
+
+		if id == functionNamesID {
+			readNameMap(section[start:end], names)
+		}
+
+		pos = end
+	}
+
+	return names
+}
+
+// readNameMap reads a vector of indices and names into names
+func readNameMap(b []byte, names map[uint32]string) {
+	count, pos, err := readU32(b)
+	if err != nil {
+		return
+	}
+
+	for i := uint32(0); i < count; i++ {
+		idx, n, err := readU32(b[pos:])
+		if err != nil {
+			return
+		}
+
+		pos += n
+
+		name, n, err := readName(b[pos:])
+		if err != nil {
+			return
+		}
+
+		pos += n
+
+		names[idx] = name
+	}
+}
+
+// readFuncExports reads the names of the functions in an export section
+func readFuncExports(section []byte) map[uint32]string {
+	names := map[uint32]string{}
+
+	count, pos, err := readU32(section)
+	if err != nil {
+		return names
+	}
+
+	for i := uint32(0); i < count; i++ {
+		name, n, err := readName(section[pos:])
+		if err != nil || pos+n >= len(section) {
+			return names
+		}
+
+		pos += n
+
+		kind := section[pos]
+		pos++
+
+		idx, n, err := readU32(section[pos:])
+		if err != nil {
+			return names
+		}
+
+		pos += n
+
+		if kind == 0x00 {
+			names[idx] = name
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,127 @@
+package runtime
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestModuleSymbols(t *testing.T) {
+	module, err := os.ReadFile("../testdata/hello-echo/hello-echo.wasm")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ReadFile"))
+	}
+
+	symbols, err := NewModuleSymbols(module)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to NewModuleSymbols"))
+	}
+
+	// hello-echo is built in release mode, so only the standard library it links has debug info
+	var writeFmt uint32
+	var writeFmtName string
+
+	for idx, name := range symbols.names {
+		if strings.Contains(name, "core3fmt5Write9write_fmt") {
+			writeFmt, writeFmtName = idx, name
+		}
+	}
+
+	if writeFmt == 0 {
+		t.Fatal("expected to find the core::fmt::Write::write_fmt function")
+	}
+
+	offset, err := funcBodyOffset(module, writeFmt)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to funcBodyOffset"))
+	}
+
+	frames := []TrapFrame{{FuncIndex: writeFmt, ModuleOffset: offset + 2}}
+
+	symbols.Symbolicate(frames)
+
+	if frames[0].FuncName != writeFmtName {
+		t.Error("expected function name", writeFmtName, "got", frames[0].FuncName)
+	}
+
+	if !strings.HasSuffix(frames[0].File, "library/core/src/fmt/mod.rs") || frames[0].Line == 0 {
+		t.Error("expected location in library/core/src/fmt/mod.rs, got", frames[0].String())
+	}
+}
+
+func TestModuleSymbolsWithoutDebugInfo(t *testing.T) {
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	// an export section exporting function 1 as run_e
+	module = appendSection(module, exportSectionID, append(appendName([]byte{0x01}, "run_e"), 0x00, 0x01))
+
+	symbols, err := NewModuleSymbols(module)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to NewModuleSymbols"))
+	}
+
+	frames := []TrapFrame{{FuncIndex: 0, ModuleOffset: 0x20}, {FuncIndex: 1}}
+
+	symbols.Symbolicate(frames)
+
+	if frames[0].String() != "$0 (offset 0x20)" {
+		t.Error("expected unnamed frame, got", frames[0].String())
+	}
+
+	if frames[1].String() != "run_e" {
+		t.Error("expected frame named by its export, got", frames[1].String())
+	}
+}
+
+// funcBodyOffset finds the offset of a function's body within a module
+func funcBodyOffset(module []byte, funcIdx uint32) (uint64, error) {
+	sections, err := readSections(module)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to readSections")
+	}
+
+	imported := uint32(0)
+	pos := len(wasmHeader)
+
+	for _, s := range sections {
+		switch s.id {
+		case importSectionID:
+			imports, err := readImports(s.contents)
+			if err != nil {
+				return 0, errors.Wrap(err, "failed to readImports")
+			}
+
+			for _, imp := range imports {
+				if imp.kind == 0x00 {
+					imported++
+				}
+			}
+		case codeSectionID:
+			bodyPos := pos + len(s.raw) - len(s.contents)
+
+			_, n, err := readU32(s.contents)
+			if err != nil {
+				return 0, err
+			}
+
+			bodyPos += n
+
+			for i := uint32(0); i < funcIdx-imported; i++ {
+				size, n, err := readU32(module[bodyPos:])
+				if err != nil {
+					return 0, err
+				}
+
+				bodyPos += n + int(size)
+			}
+
+			return uint64(bodyPos), nil
+		}
+
+		pos += len(s.raw)
+	}
+
+	return 0, errors.New("code section not found")
+}
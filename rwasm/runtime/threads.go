@@ -0,0 +1,142 @@
+package runtime
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+)
+
+// SharedMemory returns a copy of a module that imports its memory as a shared memory (as modules built for
+// wasi-threads do) with the memory imported from the module named from instead, along with a module that
+// exports a memory matching the import as "memory". Instantiating the memory module under that name gives
+// the instances of the module a memory that they all share, which is how guest threads are run. If the
+// module doesn't import a shared memory, it is returned unchanged and the memory module is nil.
+func SharedMemory(module []byte, from string) ([]byte, []byte, error) {
+	if len(module) < len(wasmHeader) || !bytes.Equal(module[:len(wasmHeader)], wasmHeader) {
+		return nil, nil, errors.Wrap(ErrModuleInvalid, "not a valid Wasm binary")
+	}
+
+	sections, err := readSections(module)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to readSections")
+	}
+
+	rewritten := make([]byte, 0, len(module)+len(from))
+	rewritten = append(rewritten, wasmHeader...)
+
+	var memory []byte
+
+	for _, s := range sections {
+		if s.id != importSectionID {
+			rewritten = append(rewritten, s.raw...)
+			continue
+		}
+
+		imports, err := readImports(s.contents)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to readImports")
+		}
+
+		section := appendU32([]byte{}, uint32(len(imports)))
+
+		for _, imp := range imports {
+			// memories are kind 0x02
+			if imp.kind != 0x02 || !imp.shared {
+				section = append(section, imp.raw...)
+				continue
+			}
+
+			section = appendName(section, from)
+			section = appendName(section, imp.name)
+			section = append(section, imp.kind)
+			section = append(section, imp.limits...)
+
+			memory = memoryModule(imp.name, imp.limits)
+		}
+
+		rewritten = appendSection(rewritten, importSectionID, section)
+	}
+
+	if memory == nil {
+		return module, nil, nil
+	}
+
+	return rewritten, memory, nil
+}
+
+// memoryModule returns a module that defines a single memory with the given limits and exports it as name
+func memoryModule(name string, limits []byte) []byte {
+	memory := appendU32([]byte{}, 1)
+	memory = append(memory, limits...)
+
+	export := appendU32([]byte{}, 1)
+	export = appendName(export, name)
+	export = append(export, 0x02)
+	export = appendU32(export, 0)
+
+	module := append([]byte{}, wasmHeader...)
+	module = appendSection(module, memorySectionID, memory)
+	module = appendSection(module, exportSectionID, export)
+
+	return module
+}
+
+// ThreadIdentifier returns the identifier that a guest thread uses in place of ident (the identifier of the job's
+// instance) when it calls host functions. The thread gets a view of the instance that calls into thread, the
+// instance of the module that the thread runs in, so that the results of its host calls and the memory allocated
+// for them belong to the thread rather than racing with the instance's other threads. The view shares the job's
+// Ctx and result, and is removed along with its identifier when the job ends.
+func ThreadIdentifier(ident int32, thread RuntimeInstance) (int32, error) {
+	inst, err := InstanceForIdentifier(ident, false)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to InstanceForIdentifier")
+	}
+
+	// threads can be spawned by other threads, but all of them belong to the job's instance
+	if inst.parent != nil {
+		inst = inst.parent
+	}
+
+	view := &WasmInstance{
+		runtime:    thread,
+		envUUID:    inst.envUUID,
+		ctx:        inst.ctx,
+		resultChan: inst.resultChan,
+		errChan:    inst.errChan,
+		maxSleep:   inst.maxSleep,
+		parent:     inst,
+	}
+
+	threadIdent, err := setupNewIdentifier(view)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to setupNewIdentifier")
+	}
+
+	inst.callLock.Lock()
+	defer inst.callLock.Unlock()
+
+	if inst.threads == nil {
+		inst.threads = map[int32]*WasmInstance{}
+	}
+
+	inst.threads[threadIdent] = view
+
+	return threadIdent, nil
+}
+
+// endThreads removes the views of the instance used by its guest threads at the end of a job. The resources
+// that the threads left open are closed if they have stopped, and are otherwise left to the threads.
+func (w *WasmInstance) endThreads(stopped bool) {
+	w.callLock.Lock()
+	threads := w.threads
+	w.threads = nil
+	w.callLock.Unlock()
+
+	for ident, view := range threads {
+		removeIdentifier(ident)
+
+		if stopped {
+			view.closeHandles()
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package runtime
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+)
+
+func TestSharedMemory(t *testing.T) {
+	header := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	// an import section importing env.return_result as a function and a shared memory from env (flags 0x03, min 1, max 2)
+	module := append(append([]byte{}, header...), 0x02, 0x24, 0x02,
+		0x03, 'e', 'n', 'v', 0x0d, 'r', 'e', 't', 'u', 'r', 'n', '_', 'r', 'e', 's', 'u', 'l', 't', 0x00, 0x00,
+		0x03, 'e', 'n', 'v', 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x03, 0x01, 0x02,
+	)
+
+	rewritten, memory, err := SharedMemory(module, "mem")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to SharedMemory"))
+	}
+
+	expected := append(append([]byte{}, header...), 0x02, 0x24, 0x02,
+		0x03, 'e', 'n', 'v', 0x0d, 'r', 'e', 't', 'u', 'r', 'n', '_', 'r', 'e', 's', 'u', 'l', 't', 0x00, 0x00,
+		0x03, 'm', 'e', 'm', 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x03, 0x01, 0x02,
+	)
+
+	if !bytes.Equal(rewritten, expected) {
+		t.Errorf("expected the memory to be imported from mem, got %x", rewritten)
+	}
+
+	// a memory section with the import's limits, exported as memory
+	expectedMemory := append(append([]byte{}, header...), 0x05, 0x04, 0x01, 0x03, 0x01, 0x02,
+		0x07, 0x0a, 0x01, 0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	)
+
+	if !bytes.Equal(memory, expectedMemory) {
+		t.Errorf("expected a module exporting the memory, got %x", memory)
+	}
+
+	// modules that don't import a shared memory are left alone
+	unshared := append(append([]byte{}, header...), 0x05, 0x03, 0x01, 0x00, 0x01)
+
+	rewritten, memory, err = SharedMemory(unshared, "mem")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to SharedMemory"))
+	}
+
+	if !bytes.Equal(rewritten, unshared) || memory != nil {
+		t.Error("expected a module without a shared memory import to be unchanged")
+	}
+}
+
+func TestThreadIdentifier(t *testing.T) {
+	inst := &WasmInstance{
+		ctx:        &rt.Ctx{},
+		resultChan: make(chan []byte, 1),
+		errChan:    make(chan rt.RunErr, 1),
+	}
+
+	ident, err := setupNewIdentifier(inst)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to setupNewIdentifier"))
+	}
+
+	defer removeIdentifier(ident)
+
+	threadIdent, err := ThreadIdentifier(ident, nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ThreadIdentifier"))
+	}
+
+	view, err := InstanceForIdentifier(threadIdent, true)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to InstanceForIdentifier"))
+	}
+
+	// the thread's FFI result is its own, so that a host call it makes doesn't race with the instance's
+	inst.ffiResult = []byte("pending")
+
+	if _, err := InstanceForIdentifier(threadIdent, true); err != nil {
+		t.Error("expected the thread to be usable while the instance has an FFI result pending, got", err)
+	}
+
+	if view.Ctx() != inst.Ctx() {
+		t.Error("expected the thread to share the job's Ctx")
+	}
+
+	// both results are sent without blocking, and the first is kept
+	view.SendExecutionResult([]byte("thread"), nil)
+	inst.SendExecutionResult([]byte("instance"), nil)
+
+	if result, err := inst.ExecutionResult(); err != nil || string(result) != "thread" {
+		t.Errorf("expected the thread's result, got %s (%v)", string(result), err)
+	}
+
+	inst.endThreads(true)
+
+	if _, err := InstanceForIdentifier(threadIdent, false); err == nil {
+		t.Error("expected the thread's identifier to be removed")
+	}
+}
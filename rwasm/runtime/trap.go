@@ -0,0 +1,82 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/suborbital/reactr/rt"
+)
+
+// Trap is the error returned by an instance's Call when the guest traps
+type Trap struct {
+	Message string
+
+	// Frames is the guest's stack trace, innermost frame first
+	Frames []TrapFrame
+}
+
+// TrapFrame is a frame of a trapped guest's stack trace
+type TrapFrame struct {
+	FuncIndex uint32
+	FuncName  string
+
+	// ModuleOffset is the offset of the frame's current instruction within the module, 0 if unknown
+	ModuleOffset uint64
+
+	// File, Line, and Column are the source location of the instruction, if the module has DWARF debug info
+	File   string
+	Line   int
+	Column int
+}
+
+// Error returns the trap's message
+func (t *Trap) Error() string {
+	return "wasm trap: " + t.Message
+}
+
+// Is returns true if target is ErrGuestTrapped
+func (t *Trap) Is(target error) bool {
+	return target == ErrGuestTrapped
+}
+
+// Trace returns the stack trace formatted with one frame per line
+func (t *Trap) Trace() string {
+	lines := make([]string, len(t.Frames))
+	for i, f := range t.Frames {
+		lines[i] = f.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// RunErr converts the trap into the RunErr returned from the Runnable, including its stack trace
+func (t *Trap) RunErr() rt.RunErr {
+	return rt.RunErr{Code: 500, Message: "the Runnable trapped: " + t.Message, Trace: t.Trace()}
+}
+
+// String returns the frame's function name (or index) and its source location, if known
+func (f TrapFrame) String() string {
+	name := f.FuncName
+	if name == "" {
+		name = fmt.Sprintf("$%d", f.FuncIndex)
+	}
+
+	if f.File == "" {
+		if f.ModuleOffset > 0 {
+			return fmt.Sprintf("%s (offset %#x)", name, f.ModuleOffset)
+		}
+
+		return name
+	}
+
+	location := f.File
+	if f.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, f.Line)
+
+		if f.Column > 0 {
+			location = fmt.Sprintf("%s:%d", location, f.Column)
+		}
+	}
+
+	return fmt.Sprintf("%s at %s", name, location)
+}
@@ -1,6 +1,11 @@
+//go:build cgo
+// +build cgo
+
 package runtimewasmer
 
 import (
+	goruntime "runtime"
+
 	"github.com/pkg/errors"
 	"github.com/suborbital/reactr/rwasm/moduleref"
 	"github.com/suborbital/reactr/rwasm/runtime"
@@ -10,16 +15,29 @@ import (
 // WasmerBuilder is a Wasmer implementation of the instanceBuilder interface
 type WasmerBuilder struct {
 	ref     *moduleref.WasmModuleRef
+	config  runtime.Config
 	hostFns []runtime.HostFn
 	module  *wasmer.Module
 	store   *wasmer.Store
 	imports *wasmer.ImportObject
+	wasi    *wasmer.WasiEnvironment
+
+	// shared holds the compiled module and its store, which are shared with other builders of the same module
+	shared *runtime.SharedModule
+
+	libraries []*wasmer.Module
+
+	// snapshotGlobals are the exports added to capture the module's globals when SnapshotInit is set
+	snapshotGlobals []string
+
+	symbols *runtime.ModuleSymbols
 }
 
 // NewBuilder creates a new WasmerBuilder
-func NewBuilder(ref *moduleref.WasmModuleRef, hostFns ...runtime.HostFn) runtime.RuntimeBuilder {
+func NewBuilder(ref *moduleref.WasmModuleRef, config runtime.Config, hostFns ...runtime.HostFn) runtime.RuntimeBuilder {
 	w := &WasmerBuilder{
 		ref:     ref,
+		config:  config,
 		hostFns: hostFns,
 	}
 
@@ -27,16 +45,86 @@ func NewBuilder(ref *moduleref.WasmModuleRef, hostFns ...runtime.HostFn) runtime
 }
 
 func (w *WasmerBuilder) New() (runtime.RuntimeInstance, error) {
+	return w.newInstance(nil)
+}
+
+// NewFromSnapshot builds an instance without running the module's initialization, and restores the snapshot into it
+func (w *WasmerBuilder) NewFromSnapshot(snapshot *runtime.Snapshot) (runtime.RuntimeInstance, error) {
+	return w.newInstance(snapshot)
+}
+
+// Snapshot captures the memory and mutable globals of an instance
+func (w *WasmerBuilder) Snapshot(inst runtime.RuntimeInstance) (*runtime.Snapshot, error) {
+	wasmerInst, ok := inst.(*WasmerRuntime)
+	if !ok {
+		return nil, errors.New("instance was not created by a WasmerBuilder")
+	}
+
+	return wasmerInst.snapshot(w.snapshotGlobals)
+}
+
+// Close frees the builder's libraries, and its compiled module and store if no other builder is sharing them
+func (w *WasmerBuilder) Close() {
+	if w.shared == nil {
+		return
+	}
+
+	for _, lib := range w.libraries {
+		lib.Close()
+	}
+
+	w.shared.Release()
+	goruntime.SetFinalizer(w, nil)
+
+	w.shared = nil
+	w.module = nil
+	w.store = nil
+	w.imports = nil
+	w.wasi = nil
+	w.libraries = nil
+	w.symbols = nil
+}
+
+func (w *WasmerBuilder) newInstance(snapshot *runtime.Snapshot) (runtime.RuntimeInstance, error) {
+	if w.config.Fuel > 0 {
+		return nil, runtime.ErrFuelNotSupported
+	}
+
 	module, _, imports, err := w.internals()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to ModuleBytes")
 	}
 
+	// each instance gets its own instances of the libraries, so it needs its own imports to link them
+	if len(w.libraries) > 0 {
+		imports, err = w.linkLibraries(module)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to linkLibraries")
+		}
+	}
+
 	wasmerInst, err := wasmer.NewInstance(module, imports)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to NewInstance")
 	}
 
+	inst := &WasmerRuntime{
+		inst:    wasmerInst,
+		wasi:    w.wasi,
+		symbols: w.symbols,
+		stdout:  runtime.NewGuestOutput("stdout"),
+		stderr:  runtime.NewGuestOutput("stderr"),
+	}
+
+	if snapshot != nil {
+		if err := inst.restore(snapshot); err != nil {
+			inst.Close()
+			return nil, errors.Wrap(err, "failed to restore")
+		}
+
+		return inst, nil
+	}
+
 	// if the module has exported a WASI start, call it
 	wasiStart, err := wasmerInst.Exports.GetWasiStartFunction()
 	if err == nil && wasiStart != nil {
@@ -61,46 +149,231 @@ func (w *WasmerBuilder) New() (runtime.RuntimeInstance, error) {
 		}
 	}
 
-	inst := &WasmerRuntime{
-		inst: wasmerInst,
-	}
+	// log anything that was printed while starting the instance
+	inst.readOutput()
 
 	return inst, nil
 }
 
 func (w *WasmerBuilder) internals() (*wasmer.Module, *wasmer.Store, *wasmer.ImportObject, error) {
 	if w.module == nil {
-		moduleBytes, err := w.ref.Bytes()
+		moduleBytes, err := w.config.ModuleBytes(w.ref)
 		if err != nil {
 			return nil, nil, nil, errors.Wrap(err, "failed to get ref ModuleBytes")
 		}
 
-		engine := wasmer.NewEngine()
-		store := wasmer.NewStore(engine)
+		if err := runtime.CheckModule(moduleBytes); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to CheckModule")
+		}
 
-		// Compiles the module
-		mod, err := wasmer.NewModule(store, moduleBytes)
+		// the engine doesn't support the threads proposal
+		threads, err := runtime.UsesThreads(moduleBytes)
 		if err != nil {
-			return nil, nil, nil, errors.Wrap(err, "failed to NewModule")
+			return nil, nil, nil, errors.Wrap(err, "failed to UsesThreads")
+		} else if threads {
+			return nil, nil, nil, runtime.ErrThreadsNotSupported
 		}
 
-		env, err := wasmer.NewWasiStateBuilder(w.ref.Name).Finalize()
+		// the engine cannot limit memory on its own, so cap the module's declared maximum instead
+		if w.config.MaxMemoryBytes > 0 {
+			moduleBytes, err = runtime.LimitMemory(moduleBytes, runtime.MaxMemoryPages(w.config.MaxMemoryBytes))
+			if err != nil {
+				return nil, nil, nil, errors.Wrap(err, "failed to LimitMemory")
+			}
+		}
+
+		if w.config.SnapshotInit {
+			moduleBytes, w.snapshotGlobals, err = runtime.ExportGlobals(moduleBytes)
+			if err != nil {
+				return nil, nil, nil, errors.Wrap(err, "failed to ExportGlobals")
+			}
+		}
+
+		if err := runtime.ValidatePreopenDirs(w.config.PreopenDirs); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to ValidatePreopenDirs")
+		}
+
+		// Compiles the module, or uses the copy that another builder has already compiled (the cache directory is
+		// part of the key so that each directory configured with WithCacheDir receives its own compiled copy)
+		shared, err := runtime.AcquireModule(runtime.ModuleKey("wasmer", moduleBytes, w.config.CacheDir), func() (interface{}, func(), error) {
+			return w.compileShared(moduleBytes)
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to AcquireModule")
+		}
+
+		compiled := shared.Value.(*compiledModule)
+		mod, store := compiled.module, compiled.store
+
+		// stdout and stderr are buffered by Wasmer and read after each call
+		wasiState := wasmer.NewWasiStateBuilder(w.ref.Name).CaptureStdout().CaptureStderr()
+		for _, dir := range w.config.PreopenDirs {
+			wasiState = wasiState.MapDirectory(dir.GuestPath, dir.HostPath)
+		}
+
+		for _, arg := range w.config.Args {
+			wasiState = wasiState.Argument(arg)
+		}
+
+		keys, values := w.config.EnvList()
+		for i := range keys {
+			wasiState = wasiState.Environment(keys[i], values[i])
+		}
+
+		env, err := wasiState.Finalize()
 		if err != nil {
+			shared.Release()
 			return nil, nil, nil, errors.Wrap(err, "failed to NewWasiStateBuilder.Finalize")
 		}
 
-		imports, err := env.GenerateImportObject(store, mod)
+		libraries, err := w.config.LibraryBytes()
 		if err != nil {
-			imports = wasmer.NewImportObject() // for now, defaulting to creating non-WASI imports if there's a failure.
+			shared.Release()
+			return nil, nil, nil, errors.Wrap(err, "failed to LibraryBytes")
+		}
+
+		w.libraries = make([]*wasmer.Module, len(libraries))
+
+		for i, libBytes := range libraries {
+			lib, err := w.compile(store, libBytes)
+			if err != nil {
+				shared.Release()
+				return nil, nil, nil, errors.Wrapf(err, "failed to compile library %s", w.config.Libraries[i].Name)
+			}
+
+			w.libraries[i] = lib
 		}
 
-		// mount the Runnable API host functions to the module's imports
-		addHostFns(imports, store, w.hostFns...)
+		// release the shared module if the builder is dropped without being closed
+		goruntime.SetFinalizer(w, (*WasmerBuilder).Close)
 
+		w.shared = shared
+		w.symbols = compiled.symbols
 		w.module = mod
 		w.store = store
-		w.imports = imports
+		w.wasi = env
+		w.imports = w.importsFor(mod, nil)
 	}
 
 	return w.module, w.store, w.imports, nil
 }
+
+// importsFor creates the imports for a module, including WASI, the Runnable API, and the exports of any linked libraries
+func (w *WasmerBuilder) importsFor(mod *wasmer.Module, linked map[string]map[string]wasmer.IntoExtern) *wasmer.ImportObject {
+	imports, err := w.wasi.GenerateImportObject(w.store, mod)
+	if err != nil {
+		imports = wasmer.NewImportObject() // for now, defaulting to creating non-WASI imports if there's a failure.
+	}
+
+	// mount the Runnable API host functions to the module's imports
+	addHostFns(imports, w.store, w.hostFns...)
+
+	for name, exports := range linked {
+		imports.Register(name, exports)
+	}
+
+	return imports
+}
+
+// linkLibraries instantiates each of the libraries, and returns imports for the module with their exports included
+func (w *WasmerBuilder) linkLibraries(mod *wasmer.Module) (*wasmer.ImportObject, error) {
+	linked := map[string]map[string]wasmer.IntoExtern{}
+
+	for i, lib := range w.libraries {
+		name := w.config.Libraries[i].Name
+
+		libInst, err := wasmer.NewInstance(lib, w.importsFor(lib, linked))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to NewInstance for library %s", name)
+		}
+
+		// libraries are reactors, so they are initialized rather than started
+		if initialize, err := libInst.Exports.GetFunction("_initialize"); err == nil && initialize != nil {
+			if _, err := initialize(); err != nil {
+				return nil, errors.Wrapf(err, "failed to _initialize library %s", name)
+			}
+		}
+
+		exports := map[string]wasmer.IntoExtern{}
+
+		for _, export := range lib.Exports() {
+			extern, err := libInst.Exports.Get(export.Name())
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get export %s from library %s", export.Name(), name)
+			}
+
+			exports[export.Name()] = extern
+		}
+
+		linked[name] = exports
+	}
+
+	return w.importsFor(mod, linked), nil
+}
+
+// compiledModule is a module that is shared between builders, along with the store it was compiled in
+type compiledModule struct {
+	module  *wasmer.Module
+	store   *wasmer.Store
+	symbols *runtime.ModuleSymbols
+}
+
+// compileShared compiles a module in its own store so that it can be shared with other builders
+func (w *WasmerBuilder) compileShared(moduleBytes []byte) (interface{}, func(), error) {
+	symbols, err := runtime.NewModuleSymbols(moduleBytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to NewModuleSymbols")
+	}
+
+	store := wasmer.NewStore(wasmer.NewEngine())
+
+	mod, err := w.compile(store, moduleBytes)
+	if err != nil {
+		store.Close()
+		return nil, nil, errors.Wrap(err, "failed to compile")
+	}
+
+	compiled := &compiledModule{
+		module:  mod,
+		store:   store,
+		symbols: symbols,
+	}
+
+	closeFn := func() {
+		mod.Close()
+		store.Close()
+	}
+
+	return compiled, closeFn, nil
+}
+
+// compile compiles the module, using the on-disk module cache if one is configured
+func (w *WasmerBuilder) compile(store *wasmer.Store, moduleBytes []byte) (*wasmer.Module, error) {
+	if w.config.CacheDir != "" {
+		if compiled, exists := runtime.ReadCachedModule(w.config.CacheDir, "wasmer", moduleBytes); exists {
+			mod, err := wasmer.DeserializeModule(store, compiled)
+			if err == nil {
+				return mod, nil
+			}
+
+			// fall back to compiling, which will also replace the unusable cached module
+			runtime.InternalLogger().Warn("[rwasm] failed to DeserializeModule from cache, recompiling:", err.Error())
+		}
+	}
+
+	mod, err := wasmer.NewModule(store, moduleBytes)
+	if err != nil {
+		return nil, errors.Wrap(runtime.InvalidModule(err), "failed to NewModule")
+	}
+
+	if w.config.CacheDir != "" {
+		compiled, err := mod.Serialize()
+		if err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Serialize module for cache"))
+		} else if err := runtime.WriteCachedModule(w.config.CacheDir, "wasmer", moduleBytes, compiled); err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to WriteCachedModule"))
+		}
+	}
+
+	return mod, nil
+}
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package runtimewasmer
 
 import (
@@ -12,14 +15,14 @@ type WasmerHostFn struct {
 	name   string
 	args   []wasmer.ValueKind
 	ret    []wasmer.ValueKind
-	hostFn func(...wasmer.Value) (interface{}, error)
+	hostFn func(...wasmer.Value) ([]int32, error)
 }
 
 // toWasmerHostFn creates a new host funcion from a generic host fn
 func toWasmerHostFn(hostFn runtime.HostFn) *WasmerHostFn {
-	retVals := []wasmer.ValueKind{}
-	if hostFn.Returns {
-		retVals = append(retVals, wasmer.I32)
+	retVals := make([]wasmer.ValueKind, hostFn.ResultCount())
+	for i := range retVals {
+		retVals[i] = wasmer.I32
 	}
 
 	args := make([]wasmer.ValueKind, hostFn.ArgCount)
@@ -32,13 +35,18 @@ func toWasmerHostFn(hostFn runtime.HostFn) *WasmerHostFn {
 		name: hostFn.Name,
 		args: args,
 		ret:  retVals,
-		hostFn: func(wasmerArgs ...wasmer.Value) (interface{}, error) {
+		hostFn: func(wasmerArgs ...wasmer.Value) ([]int32, error) {
 			funcArgs := make([]interface{}, len(wasmerArgs))
 			for i, a := range wasmerArgs {
 				funcArgs[i] = a.I32()
 			}
 
-			return hostFn.HostFn(funcArgs...)
+			result, err := hostFn.HostFn(funcArgs...)
+			if err != nil {
+				return nil, err
+			}
+
+			return hostFn.ResultValues(result)
 		},
 	}
 
@@ -109,14 +117,14 @@ func (h *WasmerHostFn) fnReturns() []*wasmer.ValueType {
 // innerFn translates wraps the host fn in a Wasmer fn
 func (h *WasmerHostFn) innerFn() func([]wasmer.Value) ([]wasmer.Value, error) {
 	return func(argL []wasmer.Value) ([]wasmer.Value, error) {
-		result, err := h.hostFn(argL...)
+		results, err := h.hostFn(argL...)
 		if err != nil {
 			return nil, err
 		}
 
-		retVals := []wasmer.Value{}
-		if result != nil {
-			retVals = append(retVals, wasmer.NewValue(result, wasmer.I32))
+		retVals := make([]wasmer.Value, len(results))
+		for i, result := range results {
+			retVals[i] = wasmer.NewI32(result)
 		}
 
 		return retVals, nil
@@ -0,0 +1,27 @@
+//go:build cgo
+// +build cgo
+
+package runtimewasmer
+
+import (
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// wasmerRuntime is a Wasmer implementation of the WasmRuntime interface
+type wasmerRuntime struct{}
+
+// NewRuntime returns a WasmRuntime that uses the Wasmer engine
+func NewRuntime() runtime.WasmRuntime {
+	return &wasmerRuntime{}
+}
+
+// Name returns the name of the engine
+func (w *wasmerRuntime) Name() string {
+	return "wasmer"
+}
+
+// NewBuilder returns a WasmerBuilder for the given module
+func (w *wasmerRuntime) NewBuilder(ref *moduleref.WasmModuleRef, config runtime.Config, hostFns ...runtime.HostFn) runtime.RuntimeBuilder {
+	return NewBuilder(ref, config, hostFns...)
+}
@@ -0,0 +1,69 @@
+//go:build cgo
+// +build cgo
+
+package runtimewasmer
+
+import (
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+	"github.com/wasmerio/wasmer-go/wasmer"
+)
+
+// snapshot captures the instance's memory and the values of the given globals
+func (w *WasmerRuntime) snapshot(globals []string) (*runtime.Snapshot, error) {
+	snapshot := &runtime.Snapshot{
+		Globals: map[string]interface{}{},
+	}
+
+	if memory := w.exportedMemory(); memory != nil {
+		snapshot.Memory = make([]byte, memory.DataSize())
+		copy(snapshot.Memory, memory.Data())
+	}
+
+	for _, name := range globals {
+		global, err := w.inst.Exports.GetGlobal(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to GetGlobal %s", name)
+		}
+
+		val, err := global.Get()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to Get global %s", name)
+		}
+
+		snapshot.Globals[name] = val
+	}
+
+	return snapshot, nil
+}
+
+// restore copies a snapshot's memory and globals into the instance
+func (w *WasmerRuntime) restore(snapshot *runtime.Snapshot) error {
+	if len(snapshot.Memory) > 0 {
+		memory := w.exportedMemory()
+		if memory == nil {
+			return errors.New("snapshot has memory, but the instance does not")
+		}
+
+		if size := uint32(memory.Size()); size < snapshot.MemoryPages() {
+			if !memory.Grow(wasmer.Pages(snapshot.MemoryPages() - size)) {
+				return errors.New("failed to Grow memory to the size of the snapshot")
+			}
+		}
+
+		copy(memory.Data(), snapshot.Memory)
+	}
+
+	for name, val := range snapshot.Globals {
+		global, err := w.inst.Exports.GetGlobal(name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to GetGlobal %s", name)
+		}
+
+		if err := global.Set(val, global.Type().ValueType().Kind()); err != nil {
+			return errors.Wrapf(err, "failed to Set global %s", name)
+		}
+	}
+
+	return nil
+}
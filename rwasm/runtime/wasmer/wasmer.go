@@ -1,43 +1,85 @@
+//go:build cgo
+// +build cgo
+
 package runtimewasmer
 
 import (
 	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
 	"github.com/wasmerio/wasmer-go/wasmer"
 )
 
 // WasmerRuntime is a Wasmer implementation of the runtimeInstance interface
 type WasmerRuntime struct {
 	inst *wasmer.Instance
+	wasi *wasmer.WasiEnvironment
+
+	// memory is the instance's exported memory, which is looked up on first use since each lookup creates a new wrapper
+	memory *wasmer.Memory
+
+	symbols *runtime.ModuleSymbols
+
+	stdout *runtime.GuestOutput
+	stderr *runtime.GuestOutput
 }
 
 func (w *WasmerRuntime) Call(fn string, args ...interface{}) (interface{}, error) {
 	wasmFunc, err := w.inst.Exports.GetFunction(fn)
 	if err != nil || wasmFunc == nil {
-		return nil, errors.New("missing required FFI function: " + fn)
+		return nil, errors.Wrapf(runtime.ErrExportNotFound, "function %s not found", fn)
 	}
 
 	wasmResult, wasmErr := wasmFunc(args...)
+
+	w.readOutput()
+
 	if wasmErr != nil {
+		var trap *wasmer.TrapError
+		if errors.As(wasmErr, &trap) {
+			return nil, errors.Wrapf(w.trap(trap), "function %s trapped", fn)
+		}
+
 		return nil, errors.Wrap(wasmErr, "failed to wasmFunc")
 	}
 
 	return wasmResult, nil
 }
 
+// trap converts a Wasmer trap into a runtime.Trap with a symbolicated stack trace
+func (w *WasmerRuntime) trap(trap *wasmer.TrapError) *runtime.Trap {
+	t := &runtime.Trap{
+		Message: trap.Error(),
+	}
+
+	for _, frame := range trap.Trace() {
+		t.Frames = append(t.Frames, runtime.TrapFrame{
+			FuncIndex:    frame.FunctionIndex(),
+			ModuleOffset: uint64(frame.ModuleOffset()),
+		})
+	}
+
+	w.symbols.Symbolicate(t.Frames)
+
+	return t
+}
+
 // ReadMemory reads memory from the instance
-func (w *WasmerRuntime) ReadMemory(pointer int32, size int32) []byte {
-	memory, err := w.inst.Exports.GetMemory("memory")
-	if err != nil || memory == nil {
-		// we failed
-		return []byte{}
+func (w *WasmerRuntime) ReadMemory(pointer int32, size int32) ([]byte, error) {
+	memory := w.exportedMemory()
+	if memory == nil {
+		return nil, runtime.ErrNoMemory
+	}
+
+	data := memory.Data()
+	if err := runtime.CheckMemoryBounds(pointer, int(size), len(data)); err != nil {
+		return nil, err
 	}
 
-	data := memory.Data()[pointer:]
 	result := make([]byte, size)
 
-	copy(result, data)
+	copy(result, data[pointer:])
 
-	return result
+	return result, nil
 }
 
 // WriteMemory writes memory into the instance
@@ -51,22 +93,28 @@ func (w *WasmerRuntime) WriteMemory(data []byte) (int32, error) {
 
 	pointer := allocateResult.(int32)
 
-	w.WriteMemoryAtLocation(pointer, data)
+	if err := w.WriteMemoryAtLocation(pointer, data); err != nil {
+		return 0, errors.Wrap(err, "failed to WriteMemoryAtLocation")
+	}
 
 	return pointer, nil
 }
 
 // WriteMemoryAtLocation writes memory at the given location
-func (w *WasmerRuntime) WriteMemoryAtLocation(pointer int32, data []byte) {
-	memory, err := w.inst.Exports.GetMemory("memory")
-	if err != nil || memory == nil {
-		// we failed
-		return
+func (w *WasmerRuntime) WriteMemoryAtLocation(pointer int32, data []byte) error {
+	memory := w.exportedMemory()
+	if memory == nil {
+		return runtime.ErrNoMemory
+	}
+
+	scopedMemory := memory.Data()
+	if err := runtime.CheckMemoryBounds(pointer, len(data), len(scopedMemory)); err != nil {
+		return err
 	}
 
-	scopedMemory := memory.Data()[pointer:]
+	copy(scopedMemory[pointer:], data)
 
-	copy(scopedMemory, data)
+	return nil
 }
 
 // Deallocate deallocates memory in the instance
@@ -74,6 +122,51 @@ func (w *WasmerRuntime) Deallocate(pointer int32, length int) {
 	w.Call("deallocate", pointer, length)
 }
 
+// Output returns the writers that receive the module's stdout and stderr
+func (w *WasmerRuntime) Output() (*runtime.GuestOutput, *runtime.GuestOutput) {
+	return w.stdout, w.stderr
+}
+
+// readOutput moves anything the module has printed from Wasmer's buffers to the instance's outputs.
+// The buffers are shared by all of the builder's instances, so output is read by whichever instance gets there first
+func (w *WasmerRuntime) readOutput() {
+	if w.wasi == nil {
+		return
+	}
+
+	if stdout := w.wasi.ReadStdout(); len(stdout) > 0 {
+		w.stdout.Write(stdout)
+	}
+
+	if stderr := w.wasi.ReadStderr(); len(stderr) > 0 {
+		w.stderr.Write(stderr)
+	}
+}
+
+// exportedMemory returns the instance's exported memory, or nil if it doesn't export one
+func (w *WasmerRuntime) exportedMemory() *wasmer.Memory {
+	if w.memory == nil {
+		memory, err := w.inst.Exports.GetMemory("memory")
+		if err != nil {
+			return nil
+		}
+
+		w.memory = memory
+	}
+
+	return w.memory
+}
+
+// MemorySize returns the current size of the instance's linear memory in bytes
+func (w *WasmerRuntime) MemorySize() uint64 {
+	memory := w.exportedMemory()
+	if memory == nil {
+		return 0
+	}
+
+	return uint64(memory.DataSize())
+}
+
 // Close closes the instance
 func (w *WasmerRuntime) Close() {
 	w.inst.Close()
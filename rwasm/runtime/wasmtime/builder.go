@@ -1,25 +1,48 @@
+//go:build cgo
+// +build cgo
+
 package runtimewasmtime
 
 import (
+	"fmt"
+	"os"
+	goruntime "runtime"
+	"time"
+
 	"github.com/bytecodealliance/wasmtime-go"
 	"github.com/pkg/errors"
 	"github.com/suborbital/reactr/rwasm/moduleref"
 	"github.com/suborbital/reactr/rwasm/runtime"
 )
 
+// outputFlushDelay is how long a module's output must be quiet before a partial line is logged
+const outputFlushDelay = time.Millisecond * 20
+
 // WasmtimeBuilder is a Wasmer implementation of the instanceBuilder interface
 type WasmtimeBuilder struct {
 	ref     *moduleref.WasmModuleRef
+	config  runtime.Config
 	hostFns []runtime.HostFn
 	module  *wasmtime.Module
 	engine  *wasmtime.Engine
 	linker  *wasmtime.Linker
+
+	// shared holds the compiled module and its engine, which are shared with other builders of the same module
+	shared *runtime.SharedModule
+
+	libraries []*wasmtime.Module
+
+	// snapshotGlobals are the exports added to capture the module's globals when SnapshotInit is set
+	snapshotGlobals []string
+
+	symbols *runtime.ModuleSymbols
 }
 
 // NewBuilder creates a new WasmtimeBuilder
-func NewBuilder(ref *moduleref.WasmModuleRef, hostFns ...runtime.HostFn) runtime.RuntimeBuilder {
+func NewBuilder(ref *moduleref.WasmModuleRef, config runtime.Config, hostFns ...runtime.HostFn) runtime.RuntimeBuilder {
 	w := &WasmtimeBuilder{
 		ref:     ref,
+		config:  config,
 		hostFns: hostFns,
 	}
 
@@ -27,6 +50,41 @@ func NewBuilder(ref *moduleref.WasmModuleRef, hostFns ...runtime.HostFn) runtime
 }
 
 func (w *WasmtimeBuilder) New() (runtime.RuntimeInstance, error) {
+	return w.newInstance(nil)
+}
+
+// NewFromSnapshot builds an instance without running the module's initialization, and restores the snapshot into it
+func (w *WasmtimeBuilder) NewFromSnapshot(snapshot *runtime.Snapshot) (runtime.RuntimeInstance, error) {
+	return w.newInstance(snapshot)
+}
+
+// Snapshot captures the memory and mutable globals of an instance
+func (w *WasmtimeBuilder) Snapshot(inst runtime.RuntimeInstance) (*runtime.Snapshot, error) {
+	wasmtimeInst, ok := inst.(*WasmtimeInstance)
+	if !ok {
+		return nil, errors.New("instance was not created by a WasmtimeBuilder")
+	}
+
+	return wasmtimeInst.snapshot(w.snapshotGlobals)
+}
+
+// Close drops the builder's compiled module and engine, which Wasmtime frees once
+// they are garbage collected and no other builder is sharing them
+func (w *WasmtimeBuilder) Close() {
+	if w.shared != nil {
+		w.shared.Release()
+		goruntime.SetFinalizer(w, nil)
+	}
+
+	w.shared = nil
+	w.module = nil
+	w.engine = nil
+	w.linker = nil
+	w.libraries = nil
+	w.symbols = nil
+}
+
+func (w *WasmtimeBuilder) newInstance(snapshot *runtime.Snapshot) (runtime.RuntimeInstance, error) {
 	module, engine, linker, err := w.internals()
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to internals")
@@ -35,16 +93,72 @@ func (w *WasmtimeBuilder) New() (runtime.RuntimeInstance, error) {
 	store := wasmtime.NewStore(engine)
 
 	wasiConfig := wasmtime.NewWasiConfig()
+	for _, dir := range w.config.PreopenDirs {
+		if err := wasiConfig.PreopenDir(dir.HostPath, dir.GuestPath); err != nil {
+			return nil, errors.Wrapf(err, "failed to PreopenDir %s", dir.HostPath)
+		}
+	}
+
+	wasiConfig.SetArgv(append([]string{w.ref.Name}, w.config.Args...))
+	wasiConfig.SetEnv(w.config.EnvList())
+
+	stdout, stderr := runtime.NewGuestOutput("stdout"), runtime.NewGuestOutput("stderr")
+
+	if err := pipeOutput(wasiConfig.SetStdoutFile, stdout); err != nil {
+		return nil, errors.Wrap(err, "failed to pipeOutput for stdout")
+	}
+
+	if err := pipeOutput(wasiConfig.SetStderrFile, stderr); err != nil {
+		return nil, errors.Wrap(err, "failed to pipeOutput for stderr")
+	}
+
 	store.SetWasi(wasiConfig)
 
+	interruptHandle, err := store.InterruptHandle()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to InterruptHandle")
+	}
+
+	inst := &WasmtimeInstance{
+		store:           store,
+		interruptHandle: interruptHandle,
+		fuel:            w.config.Fuel,
+		symbols:         w.symbols,
+		stdout:          stdout,
+		stderr:          stderr,
+	}
+
+	// a store with fuel enabled starts out empty, so fill it before instantiating (which runs the module's start section)
+	if err := inst.Refuel(); err != nil {
+		return nil, errors.Wrap(err, "failed to Refuel")
+	}
+
+	// each instance's libraries are instantiated in its store, so they need a linker of their own
+	if len(w.libraries) > 0 {
+		linker, err = w.linkLibraries(engine, store)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to linkLibraries")
+		}
+	}
+
 	wasmTimeInst, err := linker.Instantiate(store, module)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to linker.Instantiate")
 	}
 
-	inst := &WasmtimeInstance{
-		inst:  *wasmTimeInst,
-		store: store,
+	inst.inst = *wasmTimeInst
+
+	if snapshot != nil {
+		if err := inst.restore(snapshot); err != nil {
+			return nil, errors.Wrap(err, "failed to restore")
+		}
+
+		return inst, nil
+	}
+
+	// top the fuel back up so that _start gets the full budget
+	if err := inst.Refuel(); err != nil {
+		return nil, errors.Wrap(err, "failed to Refuel")
 	}
 
 	if _, err := inst.Call("_start"); err != nil {
@@ -62,28 +176,84 @@ func (w *WasmtimeBuilder) New() (runtime.RuntimeInstance, error) {
 
 func (w *WasmtimeBuilder) internals() (*wasmtime.Module, *wasmtime.Engine, *wasmtime.Linker, error) {
 	if w.module == nil {
-		moduleBytes, err := w.ref.Bytes()
+		moduleBytes, err := w.config.ModuleBytes(w.ref)
 		if err != nil {
 			return nil, nil, nil, errors.Wrap(err, "failed to get ref ModuleBytes")
 		}
 
-		engine := wasmtime.NewEngine()
+		if err := runtime.CheckModule(moduleBytes); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to CheckModule")
+		}
 
-		// Compiles the module
-		mod, err := wasmtime.NewModule(engine, moduleBytes)
+		// the engine can run modules that define a shared memory, but
+		// can't share one between instances to run guest threads
+		spawns, err := runtime.SpawnsThreads(moduleBytes)
 		if err != nil {
-			return nil, nil, nil, errors.Wrap(err, "failed to NewModule")
+			return nil, nil, nil, errors.Wrap(err, "failed to SpawnsThreads")
+		} else if spawns {
+			return nil, nil, nil, runtime.ErrThreadsNotSupported
+		}
+
+		// the engine cannot limit memory on its own, so cap the module's declared maximum instead
+		if w.config.MaxMemoryBytes > 0 {
+			moduleBytes, err = runtime.LimitMemory(moduleBytes, runtime.MaxMemoryPages(w.config.MaxMemoryBytes))
+			if err != nil {
+				return nil, nil, nil, errors.Wrap(err, "failed to LimitMemory")
+			}
 		}
 
-		// Create a linker with WASI functions defined within it
-		linker := wasmtime.NewLinker(engine)
-		if err := linker.DefineWasi(); err != nil {
-			return nil, nil, nil, errors.Wrap(err, "failed to DefineWasi")
+		if w.config.SnapshotInit {
+			moduleBytes, w.snapshotGlobals, err = runtime.ExportGlobals(moduleBytes)
+			if err != nil {
+				return nil, nil, nil, errors.Wrap(err, "failed to ExportGlobals")
+			}
 		}
 
-		// mount the Runnable API
-		addHostFns(linker, w.hostFns...)
+		if err := runtime.ValidatePreopenDirs(w.config.PreopenDirs); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to ValidatePreopenDirs")
+		}
 
+		// Compiles the module, or uses the copy that another builder has already compiled (the cache directory is
+		// part of the key so that each directory configured with WithCacheDir receives its own compiled copy)
+		shared, err := runtime.AcquireModule(runtime.ModuleKey(w.cacheKind(), moduleBytes, w.config.CacheDir), func() (interface{}, func(), error) {
+			return w.compileShared(moduleBytes)
+		})
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to AcquireModule")
+		}
+
+		compiled := shared.Value.(*compiledModule)
+		mod, engine := compiled.module, compiled.engine
+
+		linker, err := w.newLinker(engine)
+		if err != nil {
+			shared.Release()
+			return nil, nil, nil, errors.Wrap(err, "failed to newLinker")
+		}
+
+		libraries, err := w.config.LibraryBytes()
+		if err != nil {
+			shared.Release()
+			return nil, nil, nil, errors.Wrap(err, "failed to LibraryBytes")
+		}
+
+		w.libraries = make([]*wasmtime.Module, len(libraries))
+
+		for i, libBytes := range libraries {
+			lib, err := w.compile(engine, libBytes)
+			if err != nil {
+				shared.Release()
+				return nil, nil, nil, errors.Wrapf(err, "failed to compile library %s", w.config.Libraries[i].Name)
+			}
+
+			w.libraries[i] = lib
+		}
+
+		// release the shared module if the builder is dropped without being closed
+		goruntime.SetFinalizer(w, (*WasmtimeBuilder).Close)
+
+		w.shared = shared
+		w.symbols = compiled.symbols
 		w.module = mod
 		w.engine = engine
 		w.linker = linker
@@ -91,3 +261,172 @@ func (w *WasmtimeBuilder) internals() (*wasmtime.Module, *wasmtime.Engine, *wasm
 
 	return w.module, w.engine, w.linker, nil
 }
+
+// newLinker creates a linker with the WASI and Runnable API functions defined within it
+func (w *WasmtimeBuilder) newLinker(engine *wasmtime.Engine) (*wasmtime.Linker, error) {
+	linker := wasmtime.NewLinker(engine)
+	if err := linker.DefineWasi(); err != nil {
+		return nil, errors.Wrap(err, "failed to DefineWasi")
+	}
+
+	// mount the Runnable API
+	addHostFns(linker, w.hostFns...)
+
+	return linker, nil
+}
+
+// linkLibraries instantiates each of the libraries in the store, and returns a linker with their exports defined
+func (w *WasmtimeBuilder) linkLibraries(engine *wasmtime.Engine, store *wasmtime.Store) (*wasmtime.Linker, error) {
+	linker, err := w.newLinker(engine)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to newLinker")
+	}
+
+	for i, lib := range w.libraries {
+		name := w.config.Libraries[i].Name
+
+		libInst, err := linker.Instantiate(store, lib)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to Instantiate library %s", name)
+		}
+
+		// libraries are reactors, so they are initialized rather than started
+		if initialize := libInst.GetExport(store, "_initialize"); initialize != nil && initialize.Func() != nil {
+			if _, err := initialize.Func().Call(store); err != nil {
+				return nil, errors.Wrapf(err, "failed to _initialize library %s", name)
+			}
+		}
+
+		if err := linker.DefineInstance(store, name, libInst); err != nil {
+			return nil, errors.Wrapf(err, "failed to DefineInstance for library %s", name)
+		}
+	}
+
+	return linker, nil
+}
+
+// compiledModule is a module that is shared between builders, along with the engine it was compiled with
+type compiledModule struct {
+	module  *wasmtime.Module
+	engine  *wasmtime.Engine
+	symbols *runtime.ModuleSymbols
+}
+
+// compileShared compiles a module with its own engine so that it can be shared with other builders.
+// Wasmtime frees the module once it's garbage collected, so nothing needs to be closed
+func (w *WasmtimeBuilder) compileShared(moduleBytes []byte) (interface{}, func(), error) {
+	symbols, err := runtime.NewModuleSymbols(moduleBytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to NewModuleSymbols")
+	}
+
+	config := wasmtime.NewConfig()
+	config.SetConsumeFuel(w.config.Fuel > 0)
+	config.SetInterruptable(true)
+	config.SetWasmThreads(true)
+
+	engine := wasmtime.NewEngineWithConfig(config)
+
+	mod, err := w.compile(engine, moduleBytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to compile")
+	}
+
+	compiled := &compiledModule{
+		module:  mod,
+		engine:  engine,
+		symbols: symbols,
+	}
+
+	return compiled, nil, nil
+}
+
+// compile compiles the module, using the on-disk module cache if one is configured
+func (w *WasmtimeBuilder) compile(engine *wasmtime.Engine, moduleBytes []byte) (*wasmtime.Module, error) {
+	if w.config.CacheDir != "" {
+		if compiled, exists := runtime.ReadCachedModule(w.config.CacheDir, w.cacheKind(), moduleBytes); exists {
+			mod, err := wasmtime.NewModuleDeserialize(engine, compiled)
+			if err == nil {
+				return mod, nil
+			}
+
+			// fall back to compiling, which will also replace the unusable cached module
+			// (Wasmtime rejects modules compiled with a different version or configuration)
+			runtime.InternalLogger().Warn("[rwasm] failed to NewModuleDeserialize from cache, recompiling:", err.Error())
+		}
+	}
+
+	mod, err := wasmtime.NewModule(engine, moduleBytes)
+	if err != nil {
+		return nil, errors.Wrap(runtime.InvalidModule(err), "failed to NewModule")
+	}
+
+	if w.config.CacheDir != "" {
+		compiled, err := mod.Serialize()
+		if err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Serialize module for cache"))
+		} else if err := runtime.WriteCachedModule(w.config.CacheDir, w.cacheKind(), moduleBytes, compiled); err != nil {
+			runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to WriteCachedModule"))
+		}
+	}
+
+	return mod, nil
+}
+
+// cacheKind distinguishes cached modules by the engine configuration they were compiled with,
+// since fuel metering changes the generated code and Wasmtime refuses to load mismatched modules
+func (w *WasmtimeBuilder) cacheKind() string {
+	if w.config.Fuel > 0 {
+		return "wasmtime-fuel"
+	}
+
+	return "wasmtime"
+}
+
+// pipeOutput connects one of the module's WASI output streams to a GuestOutput. Wasmtime can only send
+// output to a file, so it is given the write end of a pipe and the read end is copied to the GuestOutput.
+// The copy ends once Wasmtime closes its end of the pipe, which happens when the store is garbage collected.
+func pipeOutput(setFile func(string) error, output *runtime.GuestOutput) error {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "failed to Pipe")
+	}
+
+	// Wasmtime opens its own handle to the pipe, so ours can be closed once it has
+	err = setFile(fmt.Sprintf("/dev/fd/%d", writer.Fd()))
+	writer.Close()
+
+	if err != nil {
+		reader.Close()
+		return errors.Wrap(err, "failed to set output file")
+	}
+
+	go func() {
+		buf := make([]byte, 4096)
+
+		for {
+			n, err := reader.Read(buf)
+			if n > 0 {
+				output.Write(buf[:n])
+
+				// the copy can't tell when a call finishes, so a partial line is logged once the output goes quiet
+				reader.SetReadDeadline(time.Now().Add(outputFlushDelay))
+				continue
+			}
+
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				output.Flush()
+				reader.SetReadDeadline(time.Time{})
+				continue
+			}
+
+			if err != nil {
+				output.Flush()
+				reader.Close()
+				return
+			}
+		}
+	}()
+
+	return nil
+}
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package runtimewasmtime
 
 import (
@@ -23,9 +26,9 @@ func addHostFns(linker *wasmtime.Linker, fns ...runtime.HostFn) {
 			params[i] = i32Type
 		}
 
-		returns := []*wasmtime.ValType{}
-		if fn.Returns {
-			returns = append(returns, i32Type)
+		returns := make([]*wasmtime.ValType, fn.ResultCount())
+		for i := range returns {
+			returns[i] = i32Type
 		}
 
 		fnType := wasmtime.NewFuncType(params, returns)
@@ -45,10 +48,14 @@ func addHostFns(linker *wasmtime.Linker, fns ...runtime.HostFn) {
 				return nil, wasmtime.NewTrap(errors.Wrapf(err, "failed to HostFn for %s", fn.Name).Error())
 			}
 
-			// function may return nothing, so nil check before trying to convert it
-			returnVals := []wasmtime.Val{}
-			if result != nil {
-				returnVals = append(returnVals, wasmtime.ValI32(result.(int32)))
+			results, err := fn.ResultValues(result)
+			if err != nil {
+				return nil, wasmtime.NewTrap(errors.Wrapf(err, "failed to ResultValues for %s", fn.Name).Error())
+			}
+
+			returnVals := make([]wasmtime.Val, len(results))
+			for i, r := range results {
+				returnVals[i] = wasmtime.ValI32(r)
 			}
 
 			return returnVals, nil
@@ -0,0 +1,27 @@
+//go:build cgo
+// +build cgo
+
+package runtimewasmtime
+
+import (
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// wasmtimeRuntime is a Wasmtime implementation of the WasmRuntime interface
+type wasmtimeRuntime struct{}
+
+// NewRuntime returns a WasmRuntime that uses the Wasmtime engine
+func NewRuntime() runtime.WasmRuntime {
+	return &wasmtimeRuntime{}
+}
+
+// Name returns the name of the engine
+func (w *wasmtimeRuntime) Name() string {
+	return "wasmtime"
+}
+
+// NewBuilder returns a WasmtimeBuilder for the given module
+func (w *wasmtimeRuntime) NewBuilder(ref *moduleref.WasmModuleRef, config runtime.Config, hostFns ...runtime.HostFn) runtime.RuntimeBuilder {
+	return NewBuilder(ref, config, hostFns...)
+}
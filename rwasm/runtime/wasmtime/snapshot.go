@@ -0,0 +1,89 @@
+//go:build cgo
+// +build cgo
+
+package runtimewasmtime
+
+import (
+	"fmt"
+
+	"github.com/bytecodealliance/wasmtime-go"
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// snapshot captures the instance's memory and the values of the given globals
+func (w *WasmtimeInstance) snapshot(globals []string) (*runtime.Snapshot, error) {
+	snapshot := &runtime.Snapshot{
+		Globals: map[string]interface{}{},
+	}
+
+	if memory := w.memory(); memory != nil {
+		data := memory.UnsafeData(w.store)
+
+		snapshot.Memory = make([]byte, len(data))
+		copy(snapshot.Memory, data)
+	}
+
+	for _, name := range globals {
+		export := w.inst.GetExport(w.store, name)
+		if export == nil || export.Global() == nil {
+			return nil, fmt.Errorf("global %s not found", name)
+		}
+
+		snapshot.Globals[name] = export.Global().Get(w.store).Get()
+	}
+
+	return snapshot, nil
+}
+
+// restore copies a snapshot's memory and globals into the instance
+func (w *WasmtimeInstance) restore(snapshot *runtime.Snapshot) error {
+	if len(snapshot.Memory) > 0 {
+		memory := w.memory()
+		if memory == nil {
+			return errors.New("snapshot has memory, but the instance does not")
+		}
+
+		if size := memory.Size(w.store); size < uint64(snapshot.MemoryPages()) {
+			if _, err := memory.Grow(w.store, uint64(snapshot.MemoryPages())-size); err != nil {
+				return errors.Wrap(err, "failed to Grow memory to the size of the snapshot")
+			}
+		}
+
+		copy(memory.UnsafeData(w.store), snapshot.Memory)
+	}
+
+	for name, val := range snapshot.Globals {
+		export := w.inst.GetExport(w.store, name)
+		if export == nil || export.Global() == nil {
+			return fmt.Errorf("global %s not found", name)
+		}
+
+		wasmVal, err := valOf(val)
+		if err != nil {
+			return errors.Wrapf(err, "failed to convert global %s", name)
+		}
+
+		if err := export.Global().Set(w.store, wasmVal); err != nil {
+			return errors.Wrapf(err, "failed to Set global %s", name)
+		}
+	}
+
+	return nil
+}
+
+// valOf converts a Go value into a Wasmtime value
+func valOf(val interface{}) (wasmtime.Val, error) {
+	switch v := val.(type) {
+	case int32:
+		return wasmtime.ValI32(v), nil
+	case int64:
+		return wasmtime.ValI64(v), nil
+	case float32:
+		return wasmtime.ValF32(v), nil
+	case float64:
+		return wasmtime.ValF64(v), nil
+	}
+
+	return wasmtime.Val{}, fmt.Errorf("unsupported value type %T", val)
+}
@@ -1,3 +1,6 @@
+//go:build cgo
+// +build cgo
+
 package runtimewasmtime
 
 import (
@@ -7,8 +10,20 @@ import (
 )
 
 type WasmtimeInstance struct {
-	inst  wasmtime.Instance
-	store *wasmtime.Store
+	inst            wasmtime.Instance
+	store           *wasmtime.Store
+	interruptHandle *wasmtime.InterruptHandle
+	fuel            uint64
+
+	fuelAdded uint64
+
+	// exportedMemory is looked up on first use, since each lookup crosses into the engine and creates a new wrapper
+	exportedMemory *wasmtime.Memory
+
+	symbols *runtime.ModuleSymbols
+
+	stdout *runtime.GuestOutput
+	stderr *runtime.GuestOutput
 }
 
 func (w *WasmtimeInstance) Call(fn string, args ...interface{}) (interface{}, error) {
@@ -20,27 +35,62 @@ func (w *WasmtimeInstance) Call(fn string, args ...interface{}) (interface{}, er
 
 	wasmResult, wasmErr := wasmFunc.Func().Call(w.store, args...)
 	if wasmErr != nil {
+		if w.fuelExhausted() {
+			return nil, errors.Wrapf(runtime.ErrFuelExhausted, "function %s trapped", fn)
+		}
+
+		var trap *wasmtime.Trap
+		if errors.As(wasmErr, &trap) {
+			return nil, errors.Wrapf(w.trap(trap), "function %s trapped", fn)
+		}
+
 		return nil, errors.Wrap(wasmErr, "failed to wasmFunc")
 	}
 
 	return wasmResult, nil
 }
 
-// ReadMemory reads memory from the instance
-func (w *WasmtimeInstance) ReadMemory(pointer int32, size int32) []byte {
-	memory := w.inst.GetExport(w.store, "memory").Memory()
+// trap converts a Wasmtime trap into a runtime.Trap with a symbolicated stack trace
+func (w *WasmtimeInstance) trap(trap *wasmtime.Trap) *runtime.Trap {
+	t := &runtime.Trap{
+		Message: trap.Message(),
+	}
+
+	for _, frame := range trap.Frames() {
+		f := runtime.TrapFrame{
+			FuncIndex:    frame.FuncIndex(),
+			ModuleOffset: uint64(frame.ModuleOffset()),
+		}
+
+		if name := frame.FuncName(); name != nil {
+			f.FuncName = *name
+		}
+
+		t.Frames = append(t.Frames, f)
+	}
 
+	w.symbols.Symbolicate(t.Frames)
+
+	return t
+}
+
+// ReadMemory reads memory from the instance
+func (w *WasmtimeInstance) ReadMemory(pointer int32, size int32) ([]byte, error) {
+	memory := w.memory()
 	if memory == nil {
-		// we failed
-		return []byte{}
+		return nil, runtime.ErrNoMemory
+	}
+
+	data := memory.UnsafeData(w.store)
+	if err := runtime.CheckMemoryBounds(pointer, int(size), len(data)); err != nil {
+		return nil, err
 	}
 
-	data := memory.UnsafeData(w.store)[pointer:]
 	result := make([]byte, size)
 
-	copy(result, data)
+	copy(result, data[pointer:])
 
-	return result
+	return result, nil
 }
 
 // WriteMemory writes memory into the instance
@@ -54,23 +104,42 @@ func (w *WasmtimeInstance) WriteMemory(data []byte) (int32, error) {
 
 	pointer := allocateResult.(int32)
 
-	w.WriteMemoryAtLocation(pointer, data)
+	if err := w.WriteMemoryAtLocation(pointer, data); err != nil {
+		return 0, errors.Wrap(err, "failed to WriteMemoryAtLocation")
+	}
 
 	return pointer, nil
 }
 
 // WriteMemoryAtLocation writes memory at the given location
-func (w *WasmtimeInstance) WriteMemoryAtLocation(pointer int32, data []byte) {
-	memory := w.inst.GetExport(w.store, "memory").Memory()
-
+func (w *WasmtimeInstance) WriteMemoryAtLocation(pointer int32, data []byte) error {
+	memory := w.memory()
 	if memory == nil {
-		// we failed
-		return
+		return runtime.ErrNoMemory
+	}
+
+	scopedMemory := memory.UnsafeData(w.store)
+	if err := runtime.CheckMemoryBounds(pointer, len(data), len(scopedMemory)); err != nil {
+		return err
 	}
 
-	scopedMemory := memory.UnsafeData(w.store)[pointer:]
+	copy(scopedMemory[pointer:], data)
 
-	copy(scopedMemory, data)
+	return nil
+}
+
+// memory returns the instance's exported memory, or nil if it doesn't export one
+func (w *WasmtimeInstance) memory() *wasmtime.Memory {
+	if w.exportedMemory == nil {
+		export := w.inst.GetExport(w.store, "memory")
+		if export == nil {
+			return nil
+		}
+
+		w.exportedMemory = export.Memory()
+	}
+
+	return w.exportedMemory
 }
 
 // Deallocate deallocates memory in the instance
@@ -78,7 +147,64 @@ func (w *WasmtimeInstance) Deallocate(pointer int32, length int) {
 	w.Call("deallocate", pointer, length)
 }
 
+// Refuel resets the instance's fuel to the configured budget
+func (w *WasmtimeInstance) Refuel() error {
+	if w.fuel == 0 {
+		return nil
+	}
+
+	remaining := w.fuelRemaining()
+
+	if remaining < w.fuel {
+		if err := w.store.AddFuel(w.fuel - remaining); err != nil {
+			return errors.Wrap(err, "failed to AddFuel")
+		}
+
+		w.fuelAdded += w.fuel - remaining
+	}
+
+	return nil
+}
+
+// fuelExhausted returns true if fuel is enabled and the instance has none remaining
+func (w *WasmtimeInstance) fuelExhausted() bool {
+	return w.fuel > 0 && w.fuelRemaining() == 0
+}
+
+// fuelRemaining returns the amount of fuel left in the store, which
+// is tracked by hand since a trapped store can consume more than it was given
+func (w *WasmtimeInstance) fuelRemaining() uint64 {
+	consumed, _ := w.store.FuelConsumed()
+	if consumed >= w.fuelAdded {
+		return 0
+	}
+
+	return w.fuelAdded - consumed
+}
+
+// Interrupt causes the instance's current call to trap
+func (w *WasmtimeInstance) Interrupt() {
+	w.interruptHandle.Interrupt()
+}
+
+// MemorySize returns the current size of the instance's linear memory in bytes
+func (w *WasmtimeInstance) MemorySize() uint64 {
+	memory := w.memory()
+	if memory == nil {
+		return 0
+	}
+
+	return uint64(memory.DataSize(w.store))
+}
+
+// Output returns the writers that receive the module's stdout and stderr
+func (w *WasmtimeInstance) Output() (*runtime.GuestOutput, *runtime.GuestOutput) {
+	return w.stdout, w.stderr
+}
+
 // Close closes the instance
 func (w *WasmtimeInstance) Close() {
-	// TODO: figure out how to close
+	// Wasmtime frees the instance's resources when the store is garbage collected,
+	// so drop the reference to the store to allow that to happen
+	w.store = nil
 }
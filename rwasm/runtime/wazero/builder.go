@@ -0,0 +1,422 @@
+package runtimewazero
+
+import (
+	"context"
+	goruntime "runtime"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// WazeroBuilder is a wazero implementation of the instanceBuilder interface
+type WazeroBuilder struct {
+	ref     *moduleref.WasmModuleRef
+	config  runtime.Config
+	hostFns []runtime.HostFn
+	module  wazero.CompiledModule
+	runtime wazero.Runtime
+
+	// shared tracks the use of the module's compiled code in the shared compilation cache
+	shared *runtime.SharedModule
+
+	// when libraries are linked or the module imports a shared memory, each instance gets its own runtime built from these
+	runtimeConfig wazero.RuntimeConfig
+	cache         wazero.CompilationCache
+	moduleBytes   []byte
+	libraries     [][]byte
+
+	// memoryModule provides the shared memory that the module imports, if it does
+	memoryModule []byte
+
+	// snapshotGlobals are the exports added to capture the module's globals when SnapshotInit is set
+	snapshotGlobals []string
+
+	symbols *runtime.ModuleSymbols
+}
+
+// NewBuilder creates a new WazeroBuilder
+func NewBuilder(ref *moduleref.WasmModuleRef, config runtime.Config, hostFns ...runtime.HostFn) runtime.RuntimeBuilder {
+	w := &WazeroBuilder{
+		ref:     ref,
+		config:  config,
+		hostFns: hostFns,
+	}
+
+	return w
+}
+
+func (w *WazeroBuilder) New() (runtime.RuntimeInstance, error) {
+	return w.newInstance(nil)
+}
+
+// NewFromSnapshot builds an instance without running the module's initialization, and restores the snapshot into it
+func (w *WazeroBuilder) NewFromSnapshot(snapshot *runtime.Snapshot) (runtime.RuntimeInstance, error) {
+	return w.newInstance(snapshot)
+}
+
+// Snapshot captures the memory and mutable globals of an instance
+func (w *WazeroBuilder) Snapshot(inst runtime.RuntimeInstance) (*runtime.Snapshot, error) {
+	wazeroInst, ok := inst.(*WazeroInstance)
+	if !ok {
+		return nil, errors.New("instance was not created by a WazeroBuilder")
+	}
+
+	return wazeroInst.snapshot(w.snapshotGlobals)
+}
+
+// Close frees the compiled module if no other builder is sharing it, or the compilation cache used for linking libraries
+func (w *WazeroBuilder) Close() {
+	// closing the runtime would remove the module from the shared cache, so it is left to be garbage collected
+	if w.shared != nil {
+		w.shared.Release()
+		goruntime.SetFinalizer(w, nil)
+	}
+
+	if w.cache != nil {
+		w.cache.Close(context.Background())
+	}
+
+	w.shared = nil
+	w.module = nil
+	w.runtime = nil
+	w.cache = nil
+	w.runtimeConfig = nil
+	w.moduleBytes = nil
+	w.libraries = nil
+	w.memoryModule = nil
+	w.symbols = nil
+}
+
+func (w *WazeroBuilder) newInstance(snapshot *runtime.Snapshot) (runtime.RuntimeInstance, error) {
+	if w.config.Fuel > 0 {
+		return nil, runtime.ErrFuelNotSupported
+	}
+
+	module, wazeroRuntime, err := w.internals()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to internals")
+	}
+
+	ctx := context.Background()
+
+	stdout, stderr := runtime.NewGuestOutput("stdout"), runtime.NewGuestOutput("stderr")
+
+	inst := &WazeroInstance{
+		ctx:     ctx,
+		symbols: w.symbols,
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+
+	// wazero links imports by module name, so each instance's libraries and shared memory need a runtime of their own
+	if w.moduleBytes != nil {
+		module, wazeroRuntime, err = w.linkedRuntime(w.compileContext(), stdout, stderr)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to linkedRuntime")
+		}
+
+		inst.runtime = wazeroRuntime
+	}
+
+	// instances are anonymous so that many can be created from the same module,
+	// and wazero calls the exported _start function (if there is one) while instantiating
+	config := w.moduleConfig(stdout, stderr).WithName("")
+	if snapshot != nil {
+		config = config.WithStartFunctions()
+	}
+
+	mod, err := wazeroRuntime.InstantiateModule(ctx, module, config)
+	if err != nil {
+		inst.Close()
+		return nil, errors.Wrap(err, "failed to InstantiateModule")
+	}
+
+	inst.mod = mod
+
+	// the threads that the module spawns are instances of it that share its memory, whose start functions aren't run
+	if w.memoryModule != nil {
+		inst.threads = &threadGroup{
+			runtime: wazeroRuntime,
+			module:  module,
+			config:  w.moduleConfig(stdout, stderr).WithName("").WithStartFunctions(),
+			symbols: w.symbols,
+			stdout:  stdout,
+			stderr:  stderr,
+			max:     w.config.MaxGuestThreads,
+		}
+	}
+
+	if snapshot != nil {
+		if err := inst.restore(snapshot); err != nil {
+			inst.Close()
+			return nil, errors.Wrap(err, "failed to restore")
+		}
+
+		return inst, nil
+	}
+
+	// if the module has exported an init function, call it, since legacy Runnables built without cgo use this runtime
+	if init := mod.ExportedFunction("init"); init != nil {
+		if _, err := init.Call(ctx); err != nil {
+			inst.Close()
+			return nil, errors.Wrap(err, "failed to init")
+		}
+	}
+
+	return inst, nil
+}
+
+func (w *WazeroBuilder) internals() (wazero.CompiledModule, wazero.Runtime, error) {
+	if w.module == nil && w.moduleBytes == nil {
+		moduleBytes, err := w.config.ModuleBytes(w.ref)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to get ref ModuleBytes")
+		}
+
+		if err := runtime.CheckModule(moduleBytes); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to CheckModule")
+		}
+
+		// a module built for wasi-threads imports a shared memory, which is provided by another module so that its threads can share it
+		moduleBytes, w.memoryModule, err = runtime.SharedMemory(moduleBytes, sharedMemoryModule)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to SharedMemory")
+		}
+
+		if w.config.SnapshotInit {
+			moduleBytes, w.snapshotGlobals, err = runtime.ExportGlobals(moduleBytes)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "failed to ExportGlobals")
+			}
+		}
+
+		w.symbols, err = runtime.NewModuleSymbols(moduleBytes)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to NewModuleSymbols")
+		}
+
+		if err := runtime.ValidatePreopenDirs(w.config.PreopenDirs); err != nil {
+			return nil, nil, errors.Wrap(err, "failed to ValidatePreopenDirs")
+		}
+
+		libraries, err := w.config.LibraryBytes()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to LibraryBytes")
+		}
+
+		ctx := w.compileContext()
+
+		// allow calls to be stopped by closing the module, which is how instances are interrupted
+		config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true).WithCoreFeatures(api.CoreFeaturesV2 | experimental.CoreFeaturesThreads)
+		if w.config.MaxMemoryBytes > 0 {
+			config = config.WithMemoryLimitPages(runtime.MaxMemoryPages(w.config.MaxMemoryBytes))
+		}
+
+		if len(libraries) > 0 || w.memoryModule != nil {
+			// share compiled code between the runtimes of each instance
+			if w.config.CacheDir != "" {
+				w.cache, err = wazero.NewCompilationCacheWithDir(w.config.CacheDir)
+				if err != nil {
+					return nil, nil, errors.Wrap(err, "failed to NewCompilationCacheWithDir")
+				}
+			} else {
+				w.cache = wazero.NewCompilationCache()
+			}
+
+			w.runtimeConfig = config.WithCompilationCache(w.cache)
+			w.moduleBytes = moduleBytes
+			w.libraries = libraries
+
+			return nil, nil, nil
+		}
+
+		// builders of the same module share its compiled code through a common compilation cache
+		cache, err := sharedCache(w.config.CacheDir)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to sharedCache")
+		}
+
+		wazeroRuntime, err := w.newRuntime(ctx, config.WithCompilationCache(cache))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to newRuntime")
+		}
+
+		// Compiles the module, unless another builder has already compiled it into the cache
+		var mod wazero.CompiledModule
+
+		key := runtime.ModuleKey("wazero", moduleBytes, w.config.CacheDir, strconv.FormatBool(w.config.ProfileRate > 0))
+
+		shared, err := runtime.AcquireModule(key, func() (interface{}, func(), error) {
+			compiled, err := wazeroRuntime.CompileModule(ctx, moduleBytes)
+			if err != nil {
+				return nil, nil, errors.Wrap(runtime.InvalidModule(err), "failed to CompileModule")
+			}
+
+			mod = compiled
+
+			// closing any copy of the module removes its compiled code from the cache
+			return nil, func() { compiled.Close(context.Background()) }, nil
+		})
+		if err != nil {
+			wazeroRuntime.Close(ctx)
+			return nil, nil, errors.Wrap(err, "failed to AcquireModule")
+		}
+
+		if mod == nil {
+			mod, err = wazeroRuntime.CompileModule(ctx, moduleBytes)
+			if err != nil {
+				shared.Release()
+				return nil, nil, errors.Wrap(runtime.InvalidModule(err), "failed to CompileModule")
+			}
+		}
+
+		// release the shared module if the builder is dropped without being closed
+		goruntime.SetFinalizer(w, (*WazeroBuilder).Close)
+
+		w.shared = shared
+		w.module = mod
+		w.runtime = wazeroRuntime
+	}
+
+	return w.module, w.runtime, nil
+}
+
+// sharedCaches are the compilation caches shared by builders, keyed by the cache directory (or "" to only cache in memory)
+var sharedCaches = map[string]wazero.CompilationCache{}
+var sharedCachesLock sync.Mutex
+
+// sharedCache returns the compilation cache for dir, creating it if needed
+func sharedCache(dir string) (wazero.CompilationCache, error) {
+	sharedCachesLock.Lock()
+	defer sharedCachesLock.Unlock()
+
+	if cache, exists := sharedCaches[dir]; exists {
+		return cache, nil
+	}
+
+	var cache wazero.CompilationCache
+	var err error
+
+	if dir != "" {
+		cache, err = wazero.NewCompilationCacheWithDir(dir)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to NewCompilationCacheWithDir")
+		}
+	} else {
+		cache = wazero.NewCompilationCache()
+	}
+
+	sharedCaches[dir] = cache
+
+	return cache, nil
+}
+
+// compileContext returns the context used to compile modules, which adds listeners to each function if profiling is enabled
+func (w *WazeroBuilder) compileContext() context.Context {
+	if w.config.ProfileRate > 0 {
+		return withProfileListeners(context.Background())
+	}
+
+	return context.Background()
+}
+
+// newRuntime creates a runtime with the WASI and Runnable API host modules mounted
+func (w *WazeroBuilder) newRuntime(ctx context.Context, config wazero.RuntimeConfig) (wazero.Runtime, error) {
+	wazeroRuntime := wazero.NewRuntimeWithConfig(ctx, config)
+
+	// mount the WASI functions
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, wazeroRuntime); err != nil {
+		wazeroRuntime.Close(ctx)
+		return nil, errors.Wrap(err, "failed to Instantiate WASI")
+	}
+
+	// mount the Runnable API
+	if err := addHostFns(ctx, wazeroRuntime, w.hostFns...); err != nil {
+		wazeroRuntime.Close(ctx)
+		return nil, errors.Wrap(err, "failed to addHostFns")
+	}
+
+	// mount wasi-threads
+	if err := addThreadSpawn(ctx, wazeroRuntime); err != nil {
+		wazeroRuntime.Close(ctx)
+		return nil, errors.Wrap(err, "failed to addThreadSpawn")
+	}
+
+	return wazeroRuntime, nil
+}
+
+// linkedRuntime creates a runtime for a single instance with its shared memory and each of the libraries
+// instantiated under their names, and compiles the module within it (which is fast, as compiled code is cached)
+func (w *WazeroBuilder) linkedRuntime(ctx context.Context, stdout, stderr *runtime.GuestOutput) (wazero.CompiledModule, wazero.Runtime, error) {
+	wazeroRuntime, err := w.newRuntime(ctx, w.runtimeConfig)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to newRuntime")
+	}
+
+	if w.memoryModule != nil {
+		memory, err := wazeroRuntime.CompileModule(ctx, w.memoryModule)
+		if err != nil {
+			wazeroRuntime.Close(ctx)
+			return nil, nil, errors.Wrap(runtime.InvalidModule(err), "failed to CompileModule for shared memory")
+		}
+
+		if _, err := wazeroRuntime.InstantiateModule(ctx, memory, wazero.NewModuleConfig().WithName(sharedMemoryModule)); err != nil {
+			wazeroRuntime.Close(ctx)
+			return nil, nil, errors.Wrap(err, "failed to InstantiateModule for shared memory")
+		}
+	}
+
+	for i, lib := range w.config.Libraries {
+		compiled, err := wazeroRuntime.CompileModule(ctx, w.libraries[i])
+		if err != nil {
+			wazeroRuntime.Close(ctx)
+			return nil, nil, errors.Wrapf(runtime.InvalidModule(err), "failed to CompileModule for library %s", lib.Name)
+		}
+
+		// libraries are reactors, so they are initialized rather than started
+		config := w.moduleConfig(stdout, stderr).WithName(lib.Name).WithStartFunctions("_initialize")
+
+		if _, err := wazeroRuntime.InstantiateModule(ctx, compiled, config); err != nil {
+			wazeroRuntime.Close(ctx)
+			return nil, nil, errors.Wrapf(err, "failed to InstantiateModule for library %s", lib.Name)
+		}
+	}
+
+	mod, err := wazeroRuntime.CompileModule(ctx, w.moduleBytes)
+	if err != nil {
+		wazeroRuntime.Close(ctx)
+		return nil, nil, errors.Wrap(runtime.InvalidModule(err), "failed to CompileModule")
+	}
+
+	return mod, wazeroRuntime, nil
+}
+
+// moduleConfig returns the WASI configuration for a module
+func (w *WazeroBuilder) moduleConfig(stdout, stderr *runtime.GuestOutput) wazero.ModuleConfig {
+	config := wazero.NewModuleConfig().WithStdout(stdout).WithStderr(stderr)
+
+	config = config.WithArgs(append([]string{w.ref.Name}, w.config.Args...)...)
+
+	keys, values := w.config.EnvList()
+	for i := range keys {
+		config = config.WithEnv(keys[i], values[i])
+	}
+
+	if len(w.config.PreopenDirs) > 0 {
+		fsConfig := wazero.NewFSConfig()
+		for _, dir := range w.config.PreopenDirs {
+			fsConfig = fsConfig.WithDirMount(dir.HostPath, dir.GuestPath)
+		}
+
+		config = config.WithFSConfig(fsConfig)
+	}
+
+	return config
+}
@@ -0,0 +1,77 @@
+package runtimewazero
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// addHostFns adds a list of host functions to the runtime as the "env" module
+func addHostFns(ctx context.Context, wazeroRuntime wazero.Runtime, fns ...runtime.HostFn) error {
+	builder := wazeroRuntime.NewHostModuleBuilder("env")
+
+	for i := range fns {
+		// we create a copy inside the loop otherwise things get overwritten
+		fn := fns[i]
+
+		// all function params are currently expressed as i32s, which will be improved upon
+		// in the future with the introduction of witx-bindgen and/or interface types
+		params := make([]api.ValueType, fn.ArgCount)
+		for i := 0; i < fn.ArgCount; i++ {
+			params[i] = api.ValueTypeI32
+		}
+
+		returns := make([]api.ValueType, fn.ResultCount())
+		for i := range returns {
+			returns[i] = api.ValueTypeI32
+		}
+
+		// this is reused across the normal and Swift variations of the function
+		wazeroFunc := api.GoModuleFunc(func(ctx context.Context, _ api.Module, stack []uint64) {
+			hostArgs := make([]interface{}, fn.ArgCount)
+
+			// the stack can be longer than hostArgs (swift, lame), so use hostArgs to control the loop
+			for i := range hostArgs {
+				hostArgs[i] = api.DecodeI32(stack[i])
+			}
+
+			// guest threads make host calls with the identifier of the job's instance, which is swapped for their own
+			if thread, ok := ctx.Value(guestThreadKey{}).(*guestThread); ok && fn.ArgCount > 0 {
+				hostArgs[fn.ArgCount-1] = thread.identifier(hostArgs[fn.ArgCount-1].(int32))
+			}
+
+			result, err := fn.HostFn(hostArgs...)
+			if err != nil {
+				// wazero recovers the panic and returns it as the error from the guest's call
+				panic(errors.Wrapf(err, "failed to HostFn for %s", fn.Name))
+			}
+
+			results, err := fn.ResultValues(result)
+			if err != nil {
+				panic(errors.Wrapf(err, "failed to ResultValues for %s", fn.Name))
+			}
+
+			// results are written over the params at the start of the stack
+			for i, r := range results {
+				stack[i] = api.EncodeI32(r)
+			}
+		})
+
+		builder.NewFunctionBuilder().WithGoModuleFunction(wazeroFunc, params, returns).Export(fn.Name)
+
+		// add swift params and mount swift variation
+		swiftParams := append(params, api.ValueTypeI32, api.ValueTypeI32)
+
+		builder.NewFunctionBuilder().WithGoModuleFunction(wazeroFunc, swiftParams, returns).Export(fmt.Sprintf("%s_swift", fn.Name))
+	}
+
+	if _, err := builder.Instantiate(ctx); err != nil {
+		return errors.Wrap(err, "failed to Instantiate host module")
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package runtimewazero
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/suborbital/reactr/rwasm/runtime"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/experimental"
+)
+
+// callStackKey is the context key for the CallStack of a call that is being profiled
+type callStackKey struct{}
+
+// withProfileListeners returns a context that causes the modules compiled with it to notify profileListeners of each function call
+func withProfileListeners(ctx context.Context) context.Context {
+	return experimental.WithFunctionListenerFactory(ctx, experimental.FunctionListenerFactoryFunc(newProfileListener))
+}
+
+// profileListener records the time spent in a function into the CallStack of the call, if it is being profiled
+type profileListener struct {
+	name string
+}
+
+func newProfileListener(def api.FunctionDefinition) experimental.FunctionListener {
+	name := def.Name()
+	if name == "" && len(def.ExportNames()) > 0 {
+		name = def.ExportNames()[0]
+	}
+
+	if name == "" {
+		name = fmt.Sprintf("$%d", def.Index())
+	}
+
+	return &profileListener{name: name}
+}
+
+// Before is called when the function starts running
+func (p *profileListener) Before(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64, _ experimental.StackIterator) {
+	if stack, ok := ctx.Value(callStackKey{}).(*runtime.CallStack); ok {
+		stack.Enter(p.name)
+	}
+}
+
+// After is called when the function returns
+func (p *profileListener) After(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ []uint64) {
+	if stack, ok := ctx.Value(callStackKey{}).(*runtime.CallStack); ok {
+		stack.Exit()
+	}
+}
+
+// Abort is called when the function traps
+func (p *profileListener) Abort(ctx context.Context, _ api.Module, _ api.FunctionDefinition, _ error) {
+	if stack, ok := ctx.Value(callStackKey{}).(*runtime.CallStack); ok {
+		stack.Exit()
+	}
+}
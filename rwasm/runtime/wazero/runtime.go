@@ -0,0 +1,24 @@
+package runtimewazero
+
+import (
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// wazeroRuntime is a wazero implementation of the WasmRuntime interface
+type wazeroRuntime struct{}
+
+// NewRuntime returns a WasmRuntime that uses the wazero engine
+func NewRuntime() runtime.WasmRuntime {
+	return &wazeroRuntime{}
+}
+
+// Name returns the name of the engine
+func (w *wazeroRuntime) Name() string {
+	return "wazero"
+}
+
+// NewBuilder returns a WazeroBuilder for the given module
+func (w *wazeroRuntime) NewBuilder(ref *moduleref.WasmModuleRef, config runtime.Config, hostFns ...runtime.HostFn) runtime.RuntimeBuilder {
+	return NewBuilder(ref, config, hostFns...)
+}
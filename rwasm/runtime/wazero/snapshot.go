@@ -0,0 +1,73 @@
+package runtimewazero
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// snapshot captures the instance's memory and the values of the given globals
+func (w *WazeroInstance) snapshot(globals []string) (*runtime.Snapshot, error) {
+	snapshot := &runtime.Snapshot{
+		Globals: map[string]interface{}{},
+	}
+
+	if memory := w.mod.Memory(); memory != nil {
+		data, ok := memory.Read(0, memory.Size())
+		if !ok {
+			return nil, errors.New("failed to Read memory")
+		}
+
+		snapshot.Memory = make([]byte, len(data))
+		copy(snapshot.Memory, data)
+	}
+
+	for _, name := range globals {
+		global := w.mod.ExportedGlobal(name)
+		if global == nil {
+			return nil, fmt.Errorf("global %s not found", name)
+		}
+
+		snapshot.Globals[name] = decodeResult(global.Type(), global.Get())
+	}
+
+	return snapshot, nil
+}
+
+// restore copies a snapshot's memory and globals into the instance
+func (w *WazeroInstance) restore(snapshot *runtime.Snapshot) error {
+	if len(snapshot.Memory) > 0 {
+		memory := w.mod.Memory()
+		if memory == nil {
+			return errors.New("snapshot has memory, but the instance does not")
+		}
+
+		if size := memory.Size() / runtime.WasmPageSize; size < snapshot.MemoryPages() {
+			if _, ok := memory.Grow(snapshot.MemoryPages() - size); !ok {
+				return errors.New("failed to Grow memory to the size of the snapshot")
+			}
+		}
+
+		if !memory.Write(0, snapshot.Memory) {
+			return errors.New("failed to Write memory")
+		}
+	}
+
+	for name, val := range snapshot.Globals {
+		global, ok := w.mod.ExportedGlobal(name).(api.MutableGlobal)
+		if !ok {
+			return fmt.Errorf("mutable global %s not found", name)
+		}
+
+		encoded, err := encodeParam(val)
+		if err != nil {
+			return errors.Wrapf(err, "failed to encode global %s", name)
+		}
+
+		global.Set(encoded)
+	}
+
+	return nil
+}
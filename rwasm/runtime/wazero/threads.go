@@ -0,0 +1,234 @@
+package runtimewazero
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// sharedMemoryModule is the name that a module's imported shared memory is provided under,
+// since the host functions are already instantiated as "env"
+const sharedMemoryModule = "reactr:memory"
+
+// maxThreadID is the largest thread ID that wasi-threads allows
+const maxThreadID = 0x1FFFFFFF
+
+// threadStopTimeout is how long stopped guest threads have to exit, which they can't do if they're blocked
+// in memory.atomic.wait (which can't be interrupted) or a host call that doesn't return in time
+const threadStopTimeout = 5 * time.Second
+
+// threadGroupKey is the context key for the threadGroup of the instance making a call,
+// and guestThreadKey is the context key for the guestThread making it, if there is one
+type threadGroupKey struct{}
+type guestThreadKey struct{}
+
+// threadGroup runs the guest threads spawned by an instance's module, each of which is another
+// instance of the module that shares its memory, and stops them when the instance's job ends
+type threadGroup struct {
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+	config  wazero.ModuleConfig
+	symbols *runtime.ModuleSymbols
+	stdout  *runtime.GuestOutput
+	stderr  *runtime.GuestOutput
+	max     int
+
+	// ctx is cancelled to stop the threads that are running
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running int
+	lastID  int32
+	wg      sync.WaitGroup
+	lock    sync.Mutex
+}
+
+// guestThread is the instance that a guest thread runs in, along with the identifier it uses for host calls
+type guestThread struct {
+	inst *WazeroInstance
+
+	// ident is the identifier from runtime.ThreadIdentifier used in place of parentIdent
+	parentIdent int32
+	ident       int32
+	registered  bool
+}
+
+// addThreadSpawn adds wasi-threads' thread-spawn function to the runtime as the "wasi" module
+func addThreadSpawn(ctx context.Context, wazeroRuntime wazero.Runtime) error {
+	_, err := wazeroRuntime.NewHostModuleBuilder("wasi").
+		NewFunctionBuilder().
+		WithGoModuleFunction(api.GoModuleFunc(threadSpawn), []api.ValueType{api.ValueTypeI32}, []api.ValueType{api.ValueTypeI32}).
+		Export("thread-spawn").
+		Instantiate(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to Instantiate wasi module")
+	}
+
+	return nil
+}
+
+// threadSpawn starts a guest thread, returning its ID or -1 if it can't be started (including when
+// the module doesn't import a shared memory, since its threads would each get a memory of their own)
+func threadSpawn(ctx context.Context, _ api.Module, stack []uint64) {
+	group, ok := ctx.Value(threadGroupKey{}).(*threadGroup)
+	if !ok {
+		stack[0] = api.EncodeI32(-1)
+		return
+	}
+
+	stack[0] = api.EncodeI32(group.spawn(ctx, api.DecodeI32(stack[0])))
+}
+
+// spawn instantiates the module and calls its wasi_thread_start function with arg on a new goroutine
+func (g *threadGroup) spawn(ctx context.Context, arg int32) int32 {
+	g.lock.Lock()
+
+	// threads that are being stopped can't spawn more
+	if _, isThread := ctx.Value(guestThreadKey{}).(*guestThread); isThread && ctx.Err() != nil {
+		g.lock.Unlock()
+		return -1
+	}
+
+	if g.running >= g.max {
+		g.lock.Unlock()
+		return -1
+	}
+
+	if g.ctx == nil {
+		g.ctx, g.cancel = context.WithCancel(context.Background())
+	}
+
+	g.running++
+	g.lastID = g.lastID%maxThreadID + 1
+	g.wg.Add(1)
+
+	tid, threadCtx := g.lastID, g.ctx
+
+	g.lock.Unlock()
+
+	mod, err := g.runtime.InstantiateModule(threadCtx, g.module, g.config)
+	if err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to InstantiateModule for guest thread"))
+		g.done()
+		return -1
+	}
+
+	start := mod.ExportedFunction("wasi_thread_start")
+	if start == nil {
+		mod.Close(threadCtx)
+		g.done()
+		return -1
+	}
+
+	thread := &guestThread{}
+
+	callCtx := context.WithValue(context.WithValue(threadCtx, threadGroupKey{}, g), guestThreadKey{}, thread)
+
+	thread.inst = &WazeroInstance{
+		mod:     mod,
+		ctx:     callCtx,
+		symbols: g.symbols,
+		stdout:  g.stdout,
+		stderr:  g.stderr,
+	}
+
+	go g.run(thread, start, tid, arg)
+
+	return tid
+}
+
+// run calls the thread's start function, and closes its instance once the thread exits
+func (g *threadGroup) run(thread *guestThread, start api.Function, tid, arg int32) {
+	defer g.done()
+	defer thread.inst.mod.Close(context.Background())
+
+	_, err := start.Call(thread.inst.ctx, api.EncodeI32(tid), api.EncodeI32(arg))
+	if err == nil || thread.inst.ctx.Err() != nil {
+		return
+	}
+
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 0 {
+		return
+	}
+
+	if trap := parseTrap(err, g.symbols); trap != nil {
+		err = trap
+	}
+
+	runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] guest thread %d failed", tid))
+}
+
+// done records that a thread has exited
+func (g *threadGroup) done() {
+	g.lock.Lock()
+	g.running--
+	g.lock.Unlock()
+
+	g.wg.Done()
+}
+
+// interrupt stops the running threads without waiting for them
+func (g *threadGroup) interrupt() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.cancel != nil {
+		g.cancel()
+	}
+}
+
+// stop stops the running threads and waits for them to exit, returning false if they don't exit in time
+func (g *threadGroup) stop() bool {
+	g.lock.Lock()
+
+	if g.cancel != nil {
+		g.cancel()
+	}
+
+	g.ctx, g.cancel = nil, nil
+	running := g.running
+
+	g.lock.Unlock()
+
+	if running == 0 {
+		return true
+	}
+
+	stopped := make(chan struct{})
+
+	go func() {
+		g.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return true
+	case <-time.After(threadStopTimeout):
+		return false
+	}
+}
+
+// identifier returns the identifier that the thread uses for a host call in place of ident, the identifier of the job's
+// instance. Host functions take the caller's identifier as their last argument, which the thread passes from its memory.
+func (t *guestThread) identifier(ident int32) int32 {
+	if t.registered && t.parentIdent == ident {
+		return t.ident
+	}
+
+	threadIdent, err := runtime.ThreadIdentifier(ident, t.inst)
+	if err != nil {
+		// invalid identifiers are left for the host function to reject
+		return ident
+	}
+
+	t.parentIdent, t.ident, t.registered = ident, threadIdent, true
+
+	return threadIdent
+}
@@ -0,0 +1,114 @@
+package runtimewazero
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// stackTraceHeader separates the message of a wazero error from the stack trace appended to it
+const stackTraceHeader = "\nwasm stack trace:\n"
+
+// parseTrap converts an error returned by wazero into a runtime.Trap if it has a stack trace, or nil if it does not.
+// wazero only includes the trace in the error message, formatted as one function signature per line (prefixed with
+// the module name) each followed by its source locations if the module has DWARF debug info, so the trace is parsed.
+func parseTrap(err error, symbols *runtime.ModuleSymbols) *runtime.Trap {
+	msg := err.Error()
+
+	idx := strings.Index(msg, stackTraceHeader)
+	if idx < 0 {
+		return nil
+	}
+
+	trap := &runtime.Trap{
+		Message: strings.TrimPrefix(msg[:idx], "wasm error: "),
+	}
+
+	for _, line := range strings.Split(msg[idx+len(stackTraceHeader):], "\n") {
+		if !strings.HasPrefix(line, "\t") {
+			// the trace ends at the first line that isn't indented
+			break
+		}
+
+		line = line[1:]
+
+		if strings.HasPrefix(line, "\t") {
+			// a source location for the previous frame, where the first is the innermost if there was inlining
+			if len(trap.Frames) > 0 && trap.Frames[len(trap.Frames)-1].File == "" {
+				parseSource(&trap.Frames[len(trap.Frames)-1], line[1:])
+			}
+
+			continue
+		}
+
+		trap.Frames = append(trap.Frames, parseFrame(line))
+	}
+
+	symbols.Symbolicate(trap.Frames)
+
+	return trap
+}
+
+// parseFrame parses a frame formatted like `module.function(i32,i32) i32`
+func parseFrame(line string) runtime.TrapFrame {
+	name := line
+	if paren := strings.Index(name, "("); paren >= 0 {
+		name = name[:paren]
+	}
+
+	// functions from the Runnable's own module have an empty module name
+	if dot := strings.Index(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+
+	frame := runtime.TrapFrame{}
+
+	// functions without names are identified by their index
+	if strings.HasPrefix(name, "$") {
+		if idx, err := strconv.ParseUint(name[1:], 10, 32); err == nil {
+			frame.FuncIndex = uint32(idx)
+			return frame
+		}
+	}
+
+	frame.FuncName = name
+
+	return frame
+}
+
+// parseSource parses a source location formatted like `0x1a: /path/to/file.rs:10:5`, with the line and column being optional
+func parseSource(frame *runtime.TrapFrame, line string) {
+	if colon := strings.Index(line, ": "); colon >= 0 {
+		line = line[colon+2:]
+	}
+
+	line = strings.TrimSuffix(line, " (inlined)")
+
+	numbers := []int{}
+
+	for len(numbers) < 2 {
+		colon := strings.LastIndex(line, ":")
+		if colon < 0 {
+			break
+		}
+
+		n, err := strconv.Atoi(line[colon+1:])
+		if err != nil {
+			break
+		}
+
+		numbers = append([]int{n}, numbers...)
+		line = line[:colon]
+	}
+
+	frame.File = line
+
+	if len(numbers) > 0 {
+		frame.Line = numbers[0]
+	}
+
+	if len(numbers) > 1 {
+		frame.Column = numbers[1]
+	}
+}
@@ -0,0 +1,231 @@
+package runtimewazero
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rwasm/runtime"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// WazeroInstance is a wazero implementation of the RuntimeInstance interface
+type WazeroInstance struct {
+	mod api.Module
+	ctx context.Context
+
+	// runtime is only set if the instance has a runtime of its own (to link libraries)
+	runtime wazero.Runtime
+
+	symbols *runtime.ModuleSymbols
+
+	// callStack is set while a job that is being profiled runs
+	callStack *runtime.CallStack
+
+	// threads is set if the module imports a shared memory, which allows it to spawn guest threads
+	threads *threadGroup
+
+	stdout *runtime.GuestOutput
+	stderr *runtime.GuestOutput
+}
+
+// Call executes a function exported from the module
+func (w *WazeroInstance) Call(fn string, args ...interface{}) (interface{}, error) {
+	wasmFunc := w.mod.ExportedFunction(fn)
+
+	if wasmFunc == nil {
+		return nil, errors.Wrapf(runtime.ErrExportNotFound, "function %s not found", fn)
+	}
+
+	params := make([]uint64, len(args))
+	for i, a := range args {
+		param, err := encodeParam(a)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encodeParam %d for %s", i, fn)
+		}
+
+		params[i] = param
+	}
+
+	ctx := w.ctx
+	if w.callStack != nil {
+		ctx = context.WithValue(ctx, callStackKey{}, w.callStack)
+	}
+
+	if w.threads != nil {
+		ctx = context.WithValue(ctx, threadGroupKey{}, w.threads)
+	}
+
+	results, wasmErr := wasmFunc.Call(ctx, params...)
+	if wasmErr != nil {
+		if trap := parseTrap(wasmErr, w.symbols); trap != nil {
+			return nil, errors.Wrapf(trap, "function %s trapped", fn)
+		}
+
+		return nil, errors.Wrap(wasmErr, "failed to wasmFunc")
+	}
+
+	if len(results) == 0 {
+		return nil, nil
+	}
+
+	return decodeResult(wasmFunc.Definition().ResultTypes()[0], results[0]), nil
+}
+
+// ReadMemory reads memory from the instance
+func (w *WazeroInstance) ReadMemory(pointer int32, size int32) ([]byte, error) {
+	memory := w.mod.Memory()
+	if memory == nil {
+		return nil, runtime.ErrNoMemory
+	}
+
+	if err := runtime.CheckMemoryBounds(pointer, int(size), int(memory.Size())); err != nil {
+		return nil, err
+	}
+
+	data, ok := memory.Read(uint32(pointer), uint32(size))
+	if !ok {
+		return nil, errors.Wrapf(runtime.ErrMemoryOutOfBounds, "failed to Read %d bytes at %d", size, pointer)
+	}
+
+	// data is a view of the instance's memory, so copy it out
+	result := make([]byte, size)
+
+	copy(result, data)
+
+	return result, nil
+}
+
+// WriteMemory writes memory into the instance
+func (w *WazeroInstance) WriteMemory(data []byte) (int32, error) {
+	lengthOfInput := len(data)
+
+	allocateResult, err := w.Call("allocate", lengthOfInput)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to Call allocate")
+	}
+
+	pointer := allocateResult.(int32)
+
+	if err := w.WriteMemoryAtLocation(pointer, data); err != nil {
+		return 0, errors.Wrap(err, "failed to WriteMemoryAtLocation")
+	}
+
+	return pointer, nil
+}
+
+// WriteMemoryAtLocation writes memory at the given location
+func (w *WazeroInstance) WriteMemoryAtLocation(pointer int32, data []byte) error {
+	memory := w.mod.Memory()
+	if memory == nil {
+		return runtime.ErrNoMemory
+	}
+
+	if err := runtime.CheckMemoryBounds(pointer, len(data), int(memory.Size())); err != nil {
+		return err
+	}
+
+	if !memory.Write(uint32(pointer), data) {
+		return errors.Wrapf(runtime.ErrMemoryOutOfBounds, "failed to Write %d bytes at %d", len(data), pointer)
+	}
+
+	return nil
+}
+
+// Deallocate deallocates memory in the instance
+func (w *WazeroInstance) Deallocate(pointer int32, length int) {
+	w.Call("deallocate", pointer, length)
+}
+
+// Interrupt causes the instance's current call to trap by closing the module, so it can't be used afterwards
+func (w *WazeroInstance) Interrupt() {
+	if w.threads != nil {
+		w.threads.interrupt()
+	}
+
+	w.mod.CloseWithExitCode(w.ctx, 1)
+}
+
+// StopThreads stops any guest threads that the module has spawned and waits for them to exit,
+// returning false if they didn't exit in time
+func (w *WazeroInstance) StopThreads() bool {
+	if w.threads == nil {
+		return true
+	}
+
+	return w.threads.stop()
+}
+
+// MemorySize returns the current size of the instance's linear memory in bytes
+func (w *WazeroInstance) MemorySize() uint64 {
+	if w.mod.Memory() == nil {
+		return 0
+	}
+
+	return uint64(w.mod.Memory().Size())
+}
+
+// SetProfile causes the instance's calls to be recorded into profile, until it is called again with nil
+func (w *WazeroInstance) SetProfile(profile *runtime.Profile) {
+	if profile == nil {
+		w.callStack = nil
+		return
+	}
+
+	w.callStack = runtime.NewCallStack(profile)
+}
+
+// Output returns the writers that receive the module's stdout and stderr
+func (w *WazeroInstance) Output() (*runtime.GuestOutput, *runtime.GuestOutput) {
+	return w.stdout, w.stderr
+}
+
+// Close closes the instance
+func (w *WazeroInstance) Close() {
+	if w.threads != nil {
+		w.threads.interrupt()
+	}
+
+	if w.mod != nil {
+		w.mod.Close(w.ctx)
+	}
+
+	if w.runtime != nil {
+		w.runtime.Close(w.ctx)
+	}
+}
+
+// encodeParam converts a Go value into wazero's representation of a Wasm value
+func encodeParam(arg interface{}) (uint64, error) {
+	switch a := arg.(type) {
+	case int32:
+		return api.EncodeI32(a), nil
+	case int:
+		return api.EncodeI32(int32(a)), nil
+	case uint32:
+		return api.EncodeU32(a), nil
+	case int64:
+		return api.EncodeI64(a), nil
+	case float32:
+		return api.EncodeF32(a), nil
+	case float64:
+		return api.EncodeF64(a), nil
+	}
+
+	return 0, fmt.Errorf("unsupported argument type %T", arg)
+}
+
+// decodeResult converts a wazero result into a Go value of the same kind the other runtimes return
+func decodeResult(valType api.ValueType, result uint64) interface{} {
+	switch valType {
+	case api.ValueTypeI64:
+		return int64(result)
+	case api.ValueTypeF32:
+		return api.DecodeF32(result)
+	case api.ValueTypeF64:
+		return api.DecodeF64(result)
+	}
+
+	return api.DecodeI32(result)
+}
@@ -1,11 +1,14 @@
 package rwasm
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
 
 	"github.com/pkg/errors"
 	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm/api"
+	"github.com/suborbital/reactr/rwasm/moduleref"
 )
 
 func BenchmarkRunnable(b *testing.B) {
@@ -41,3 +44,73 @@ func BenchmarkSwiftRunnable(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkRunnableLargePayload(b *testing.B) {
+	r := rt.New()
+
+	doWasm := r.Register("wasm", NewRunner("./testdata/hello-echo/hello-echo.wasm"))
+
+	for _, size := range []int{1024, 64 * 1024, 1024 * 1024} {
+		input := bytes.Repeat([]byte("a"), size)
+
+		b.Run(fmt.Sprintf("%dKiB", size/1024), func(b *testing.B) {
+			// the input is written into the instance's memory, and the result is read back out
+			b.SetBytes(int64(size) * 2)
+
+			for n := 0; n < b.N; n++ {
+				res, err := doWasm(input).Then()
+				if err != nil {
+					b.Fatal(errors.Wrap(err, "failed to Then"))
+				}
+
+				if len(res.([]byte)) != size+len("hello ") {
+					b.Fatal("unexpected result length", len(res.([]byte)))
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInstanceMemory(b *testing.B) {
+	opts := defaultRunnerOpts()
+
+	ref := &moduleref.WasmModuleRef{Filepath: "./testdata/hello-echo/hello-echo.wasm"}
+
+	inst, err := opts.runtime.NewBuilder(ref, opts.config, api.API()...).New()
+	if err != nil {
+		b.Fatal(errors.Wrap(err, "failed to New"))
+	}
+
+	defer inst.Close()
+
+	for _, size := range []int{1024, 64 * 1024, 1024 * 1024} {
+		data := bytes.Repeat([]byte("a"), size)
+
+		pointer, err := inst.WriteMemory(data)
+		if err != nil {
+			b.Fatal(errors.Wrap(err, "failed to WriteMemory"))
+		}
+
+		b.Run(fmt.Sprintf("read-%dKiB", size/1024), func(b *testing.B) {
+			b.SetBytes(int64(size))
+
+			for n := 0; n < b.N; n++ {
+				if _, err := inst.ReadMemory(pointer, int32(size)); err != nil {
+					b.Fatal(errors.Wrap(err, "failed to ReadMemory"))
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("write-%dKiB", size/1024), func(b *testing.B) {
+			b.SetBytes(int64(size))
+
+			for n := 0; n < b.N; n++ {
+				if err := inst.WriteMemoryAtLocation(pointer, data); err != nil {
+					b.Fatal(errors.Wrap(err, "failed to WriteMemoryAtLocation"))
+				}
+			}
+		})
+
+		inst.Deallocate(pointer, size)
+	}
+}
@@ -2,33 +2,68 @@ package rwasm
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strings"
 
+	"github.com/suborbital/grav/grav"
 	"github.com/suborbital/reactr/request"
 	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm/api"
 	"github.com/suborbital/reactr/rwasm/moduleref"
 	"github.com/suborbital/reactr/rwasm/runtime"
 
 	"github.com/pkg/errors"
 )
 
+// ErrNoMessageHandler is returned when a message is delivered to a Runnable whose module doesn't export on_message
+var ErrNoMessageHandler = errors.New("the module does not export an on_message function")
+
+// ErrModuleInvalid and ErrGuestTrapped are the same errors as the runtime package's, so that jobs' errors can be
+// checked with errors.Is without importing it. A trapped job's error is also an rt.RunErr with the guest's stack trace
+var (
+	ErrModuleInvalid = runtime.ErrModuleInvalid
+	ErrGuestTrapped  = runtime.ErrGuestTrapped
+)
+
 //Runner represents a wasm-based runnable
 type Runner struct {
 	env *runtime.WasmEnvironment
 }
 
-// NewRunner returns a new *Runner
-func NewRunner(filepath string) *Runner {
+// NewRunner returns a new *Runner. If filepath is an http://, https:// or oci:// URL, the module is fetched from it
+func NewRunner(filepath string, options ...Option) *Runner {
 	ref := &moduleref.WasmModuleRef{
 		Filepath: filepath,
 	}
 
-	return NewRunnerWithRef(ref)
+	if strings.HasPrefix(filepath, "http://") || strings.HasPrefix(filepath, "https://") || strings.HasPrefix(filepath, "oci://") {
+		ref = moduleref.RefWithURL("", "", filepath)
+	}
+
+	return NewRunnerWithRef(ref, options...)
 }
 
-func NewRunnerWithRef(ref *moduleref.WasmModuleRef) *Runner {
-	builder := runtimeBuilder(ref)
+// NewRunnerWithFS returns a new *Runner for the module at path within fsys, such as an embed.FS
+func NewRunnerWithFS(fsys fs.FS, path string, options ...Option) *Runner {
+	ref := moduleref.RefWithFS("", "", fsys, path)
+
+	return NewRunnerWithRef(ref, options...)
+}
 
-	environment := runtime.NewEnvironment(builder)
+// NewRunnerWithRef returns a new *Runner for the provided module reference
+func NewRunnerWithRef(ref *moduleref.WasmModuleRef, options ...Option) *Runner {
+	opts := defaultRunnerOpts()
+	for _, o := range options {
+		opts = o(opts)
+	}
+
+	// every host function, including the application's own, is subject to the Runnable's policy and limits
+	hostFns := api.WithPolicy(append(api.API(), opts.hostFns...)...)
+
+	builder := opts.runtime.NewBuilder(ref, opts.config, hostFns...)
+
+	environment := runtime.NewEnvironment(builder, opts.config)
 
 	r := &Runner{
 		env: environment,
@@ -39,6 +74,11 @@ func NewRunnerWithRef(ref *moduleref.WasmModuleRef) *Runner {
 
 // Run runs a Runner
 func (w *Runner) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	// messages delivered by Reactr.Subscribe are handled by the module's on_message function rather than run_e
+	if msg, isMsg := job.Data().(grav.Message); isMsg {
+		return w.runMessage(msg, ctx)
+	}
+
 	var jobBytes []byte
 
 	// check if the job is a CoordinatedRequest, and set up the WasmInstance if so
@@ -70,12 +110,16 @@ func (w *Runner) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
 		}
 
 		// execute the Runnable's Run function, passing the input data and ident
-		// set runErr but don't return because the ExecutionResult error should override the Call error
-		_, runErr = instance.Call("run_e", inPointer, int32(len(jobBytes)), ident)
+		// set callErr but don't return because the ExecutionResult error should override the Call error
+		_, callErr := instance.Call("run_e", inPointer, int32(len(jobBytes)), ident)
 
 		// get the results from the instance
 		output, runErr = instance.ExecutionResult()
 
+		if runErr == nil {
+			runErr = callRunErr(callErr)
+		}
+
 		// deallocate the memory used for the input
 		instance.Deallocate(inPointer, len(jobBytes))
 	}); err != nil {
@@ -103,6 +147,92 @@ func (w *Runner) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
 	return output, nil
 }
 
+// runMessage passes a message's type and data to the module's on_message function,
+// which can return a result or error in the same way as run_e
+func (w *Runner) runMessage(msg grav.Message, ctx *rt.Ctx) (interface{}, error) {
+	var output []byte
+	var runErr error
+
+	if err := w.env.UseInstance(ctx, func(instance *runtime.WasmInstance, ident int32) {
+		// the type and data are written together, so only one allocation is needed
+		msgType := []byte(msg.Type())
+		input := append(append([]byte{}, msgType...), msg.Data()...)
+
+		inPointer, writeErr := instance.WriteMemory(input)
+		if writeErr != nil {
+			runErr = errors.Wrap(writeErr, "failed to instance.writeMemory")
+			return
+		}
+
+		typeSize := int32(len(msgType))
+
+		_, callErr := instance.Call("on_message", inPointer, typeSize, inPointer+typeSize, int32(len(msg.Data())), ident)
+
+		output, runErr = instance.ExecutionResult()
+
+		if errors.Is(callErr, runtime.ErrExportNotFound) {
+			runErr = ErrNoMessageHandler
+		} else if runErr == nil {
+			runErr = callRunErr(callErr)
+		}
+
+		instance.Deallocate(inPointer, len(input))
+	}); err != nil {
+		return nil, errors.Wrap(err, "failed to useInstance")
+	}
+
+	if runErr != nil {
+		return nil, errors.Wrap(runErr, "failed to execute Wasm Runnable")
+	}
+
+	return output, nil
+}
+
+// callRunErr returns the error that a job fails with when its call into the module failed, if any
+func callRunErr(callErr error) error {
+	// a Runnable that runs out of fuel is trapped before it can return a result
+	if errors.Is(callErr, runtime.ErrFuelExhausted) {
+		return callErr
+	}
+
+	// a Runnable that traps returns its stack trace to help with debugging, and the error matches ErrGuestTrapped
+	var trap *runtime.Trap
+	if errors.As(callErr, &trap) {
+		return fmt.Errorf("%w: %w", ErrGuestTrapped, trap.RunErr())
+	}
+
+	return nil
+}
+
+// Stats returns statistics about the Runner's Wasm instances and the jobs they have run
+func (w *Runner) Stats() runtime.EnvironmentStats {
+	return w.env.Stats()
+}
+
+// Profile returns the profile of the Runner's sampled jobs, or nil if the WithProfiling option is not set
+func (w *Runner) Profile() *runtime.Profile {
+	return w.env.Profile()
+}
+
+// Close destroys the Runner's instances and frees its compiled module. It should be called after the Runner's
+// jobType has been deregistered (or reloaded with a new Runner), as the Runner cannot run any jobs once it is closed
+func (w *Runner) Close() {
+	w.env.Close()
+}
+
+// CloseAll closes every Runner that has instances, such as when the host is shutting down
+func CloseAll() {
+	runtime.CloseEnvironments()
+}
+
+// Provision builds the instances for several threads at once when a worker is starting them, such as when it is pre-warmed.
+// The module is compiled by the first instance and the rest are built in parallel, rather than each in turn as they're added
+func (w *Runner) Provision(count int) {
+	if err := w.env.Prepare(count); err != nil {
+		runtime.InternalLogger().Error(errors.Wrap(err, "[rwasm] failed to Prepare instances"))
+	}
+}
+
 // OnChange runs when a worker starts using this Runnable
 func (w *Runner) OnChange(evt rt.ChangeEvent) error {
 	switch evt {
@@ -0,0 +1,58 @@
+package wasmtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestAbortStatus(t *testing.T) {
+	// aborts with a 422 status and a JSON error payload
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "return_abort_status", typ: 3},
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(422), i32Const(0), i32Const(7), i32Const(7), i32Const(17), localGet(2), call(0), []byte{opDrop},
+		),
+		dataSegment{offset: 0, data: []byte(`invalid{"field":"email"}`)},
+	)
+
+	r := rt.New()
+
+	r.Register("abort", rwasm.NewRunnerWithRef(moduleref.RefWithData("abort", "", module)))
+
+	_, err := r.Do(rt.NewJob("abort", nil)).Then()
+	if err == nil {
+		t.Fatal("expected error, did not get one")
+	}
+
+	runErr := &rt.RunErr{}
+	if !errors.As(err, runErr) {
+		t.Fatal("expected RunErr, got", err.Error())
+	}
+
+	if runErr.Code != 422 || runErr.Message != "invalid" {
+		t.Error("expected 422 invalid, got", runErr.Error())
+	}
+
+	if runErr.Body != `{"field":"email"}` {
+		t.Errorf("expected JSON body, got %q", runErr.Body)
+	}
+
+	if !strings.Contains(runErr.Error(), `"body":{"field":"email"}`) {
+		t.Error("expected error to include the JSON body, got", runErr.Error())
+	}
+
+	// RunErrs with a body can still be matched, such as by errors.Is
+	if !errors.Is(errors.Wrap(*runErr, "failed"), *runErr) {
+		t.Error("expected wrapped RunErr to match with errors.Is")
+	}
+}
@@ -1,6 +1,8 @@
 package wasmtest
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -12,6 +14,7 @@ import (
 	"github.com/suborbital/reactr/request"
 	"github.com/suborbital/reactr/rt"
 	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
 )
 
 func TestASEcho(t *testing.T) {
@@ -33,6 +36,48 @@ func TestASEcho(t *testing.T) {
 	}
 }
 
+func TestASEchoFS(t *testing.T) {
+	r := rt.New()
+
+	// test a WASM module that is loaded from an fs.FS (as it would be from an embed.FS)
+	doWasm := r.Register("as-echo-fs", rwasm.NewRunnerWithFS(os.DirFS("../testdata"), "as-echo/as-echo.wasm"))
+
+	res, err := doWasm("from an fs.FS!").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, from an fs.FS!" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+}
+
+func TestASEchoGzip(t *testing.T) {
+	r := rt.New()
+
+	module, err := os.ReadFile("../testdata/as-echo/as-echo.wasm")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ReadFile"))
+	}
+
+	buf := &bytes.Buffer{}
+	writer := gzip.NewWriter(buf)
+	writer.Write(module)
+	writer.Close()
+
+	// test a WASM module that is decompressed when it's loaded
+	doWasm := r.Register("as-echo-gzip", rwasm.NewRunnerWithRef(moduleref.RefWithData("as-echo-gzip", "", buf.Bytes())))
+
+	res, err := doWasm("from a gzipped module!").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, from a gzipped module!" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+}
+
 func TestASFetch(t *testing.T) {
 	r := rt.New()
 
@@ -0,0 +1,110 @@
+package wasmtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// testBlobStore keeps objects in memory
+type testBlobStore struct {
+	objects map[string][]byte
+}
+
+func (b *testBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	b.objects[key] = append([]byte{}, data...)
+	return nil
+}
+
+func (b *testBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, exists := b.objects[key]
+	if !exists {
+		return nil, rcap.ErrBlobNotFound
+	}
+
+	return data, nil
+}
+
+func (b *testBlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (b *testBlobStore) PresignURL(ctx context.Context, method, key string, expiry time.Duration) (string, error) {
+	return "https://blobs.example.com/" + key + "?method=" + method + "&expiry=" + expiry.String(), nil
+}
+
+func TestBlobStore(t *testing.T) {
+	// stores the job's input as upload.txt, then returns it with blob_get
+	putGet := runnableModule(
+		[]funcImport{
+			{module: "env", name: "blob_put", typ: 3},
+			{module: "env", name: "blob_get", typ: 4},
+			{module: "env", name: "take_ffi_result", typ: 5},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(0), i32Const(10), localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(10), localGet(2), call(1), []byte{opDrop},
+			localGet(2), call(2), localGet(2), call(3),
+		),
+		dataSegment{offset: 0, data: []byte("upload.txt")},
+	)
+
+	// returns a URL to PUT upload.txt for 60 seconds
+	presign := runnableModule(
+		[]funcImport{
+			{module: "env", name: "blob_presign", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(16), i32Const(3), i32Const(0), i32Const(10), i32Const(60), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+		dataSegment{offset: 0, data: []byte("upload.txt")},
+		dataSegment{offset: 16, data: []byte("PUT")},
+	)
+
+	r := rt.New()
+
+	store := &testBlobStore{objects: map[string][]byte{}}
+
+	caps := r.DefaultCaps()
+	caps.BlobStore = store
+
+	r.RegisterWithCaps("blob-put-get", rwasm.NewRunnerWithRef(moduleref.RefWithData("blob-put-get", "", putGet)), caps)
+	r.RegisterWithCaps("blob-presign", rwasm.NewRunnerWithRef(moduleref.RefWithData("blob-presign", "", presign)), caps)
+
+	res, err := r.Do(rt.NewJob("blob-put-get", "a large upload")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "a large upload" || string(store.objects["upload.txt"]) != "a large upload" {
+		t.Errorf("expected 'a large upload' to be stored and returned, got %q", res.([]byte))
+	}
+
+	res, err = r.Do(rt.NewJob("blob-presign", nil)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if expected := "https://blobs.example.com/upload.txt?method=PUT&expiry=1m0s"; string(res.([]byte)) != expected {
+		t.Errorf("expected %s, got %s", expected, res.([]byte))
+	}
+}
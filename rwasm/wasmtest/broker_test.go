@@ -0,0 +1,78 @@
+package wasmtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+type testPublisher struct {
+	published map[string]string
+	lock      sync.Mutex
+}
+
+func (t *testPublisher) Publish(ctx context.Context, topic string, data []byte) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.published[topic] = string(data)
+
+	return nil
+}
+
+func TestBrokerPublish(t *testing.T) {
+	// publishes the job's input to the topic named by the data segment
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "broker_publish", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(1024), i32Const(14), localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(0), localGet(2), call(1),
+		),
+		dataSegment{offset: 1024, data: []byte("orders.created")},
+	)
+
+	publisher := &testPublisher{published: map[string]string{}}
+
+	config := rcap.DefaultCapabilityConfig()
+	config.MessageBroker = &rcap.MessageBrokerConfig{
+		Enabled:   true,
+		Rules:     rcap.MessageBrokerRules{AllowedTopics: []string{"orders.*"}},
+		Publisher: publisher,
+	}
+
+	denied := rcap.DefaultCapabilityConfig()
+	denied.MessageBroker = &rcap.MessageBrokerConfig{
+		Enabled:   true,
+		Rules:     rcap.MessageBrokerRules{AllowedTopics: []string{"payments.*"}},
+		Publisher: publisher,
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("orders", rwasm.NewRunnerWithRef(moduleref.RefWithData("orders", "", module)), rt.CapabilitiesFromConfig(config))
+	r.RegisterWithCaps("payments", rwasm.NewRunnerWithRef(moduleref.RefWithData("payments", "", module)), rt.CapabilitiesFromConfig(denied))
+
+	if _, err := r.Do(rt.NewJob("payments", "denied")).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if _, err := r.Do(rt.NewJob("orders", "order 42")).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if publisher.published["orders.created"] != "order 42" {
+		t.Errorf("expected only 'order 42' to be published, got %v", publisher.published)
+	}
+}
@@ -0,0 +1,119 @@
+package wasmtest
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+)
+
+const bundleManifest = `
+runnables:
+  - name: bundle-echo
+    module: modules/as-echo.wasm
+    poolSize: 2
+    preWarm: true
+  - name: bundle-static
+    module: modules/get-static.wasm
+    capabilities:
+      http:
+        enabled: false
+`
+
+// writeBundle writes a bundle containing the given files to a temporary directory
+func writeBundle(t *testing.T, files map[string][]byte) string {
+	path := filepath.Join(t.TempDir(), "bundle.zip")
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Create"))
+	}
+
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+
+	for name, data := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Create in archive"))
+		}
+
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Write"))
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Close archive"))
+	}
+
+	return path
+}
+
+func TestRegisterBundle(t *testing.T) {
+	echo, err := os.ReadFile("../testdata/as-echo/as-echo.wasm")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ReadFile"))
+	}
+
+	static, err := os.ReadFile("../testdata/get-static/get-static.wasm")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ReadFile"))
+	}
+
+	path := writeBundle(t, map[string][]byte{
+		rwasm.BundleManifestFile:  []byte(bundleManifest),
+		"modules/as-echo.wasm":    echo,
+		"modules/get-static.wasm": static,
+		"static/important.md":     []byte("# Hello, Bundle"),
+	})
+
+	r := rt.New()
+
+	if err := rwasm.RegisterBundle(r, path); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to RegisterBundle"))
+	}
+
+	res, err := r.Do(r.Job("bundle-echo", "bundle")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, bundle" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+
+	if count := r.Metrics().Workers["bundle-echo"].ThreadCount; count != 2 {
+		t.Error("expected 2 threads, got", count)
+	}
+
+	res, err = r.Do(r.Job("bundle-static", "important.md")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "# Hello, Bundle" {
+		t.Error("get-static failed, got:", string(res.([]byte)))
+	}
+}
+
+func TestRegisterBundleMissingModule(t *testing.T) {
+	path := writeBundle(t, map[string][]byte{
+		rwasm.BundleManifestFile: []byte(bundleManifest),
+	})
+
+	r := rt.New()
+
+	if err := rwasm.RegisterBundle(r, path); err == nil {
+		t.Error("expected RegisterBundle to fail for a bundle that is missing its modules")
+	}
+
+	if r.IsRegistered("bundle-echo") {
+		t.Error("expected no Runnables to be registered from an invalid bundle")
+	}
+}
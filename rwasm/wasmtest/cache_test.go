@@ -0,0 +1,106 @@
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestCacheDeleteAndKeys(t *testing.T) {
+	// deletes user:1, then lists the keys with the job's input as the prefix
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "cache_delete", typ: 3},
+			{module: "env", name: "cache_keys", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(0), i32Const(6), localGet(2), call(0), []byte{opDrop},
+			localGet(0), localGet(1), localGet(2), call(1), []byte{opDrop},
+			localGet(2), call(2), localGet(2), call(3),
+		),
+		dataSegment{offset: 0, data: []byte("user:1")},
+	)
+
+	r := rt.New()
+
+	caps := r.DefaultCaps()
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		caps.Cache.Set(key, []byte("val"), 0)
+	}
+
+	r.RegisterWithCaps("cache", rwasm.NewRunnerWithRef(moduleref.RefWithData("cache", "", module)), caps)
+
+	res, err := r.Do(rt.NewJob("cache", "user:")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != `["user:2"]` {
+		t.Errorf("expected [\"user:2\"], got %s", res.([]byte))
+	}
+}
+
+func TestCacheAtomicOperations(t *testing.T) {
+	cas := func(oldOffset, oldSize, valOffset, valSize int32) []byte {
+		return code(
+			i32Const(16), i32Const(4), i32Const(oldOffset), i32Const(oldSize), i32Const(valOffset), i32Const(valSize),
+			i32Const(0), localGet(2), call(1), []byte{opDrop},
+		)
+	}
+
+	// takes the lock, fails to steal it, releases it, and then decrements hits twice (taking each result) and returns its value
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "cache_incr", typ: 3},
+			{module: "env", name: "cache_cas", typ: 4},
+			{module: "env", name: "take_ffi_result", typ: 5},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32, i32, i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			cas(0, 0, 32, 4),
+			cas(0, 0, 48, 6),
+			cas(32, 4, 64, 8),
+			i32Const(0), i32Const(4), i32Const(-2), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(2), []byte{opDrop, opDrop},
+			i32Const(0), i32Const(4), i32Const(-2), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(2), localGet(2), call(3),
+		),
+		dataSegment{offset: 0, data: []byte("hits")},
+		dataSegment{offset: 16, data: []byte("lock")},
+		dataSegment{offset: 32, data: []byte("held")},
+		dataSegment{offset: 48, data: []byte("stolen")},
+		dataSegment{offset: 64, data: []byte("released")},
+	)
+
+	r := rt.New()
+
+	r.RegisterWithCaps("atomic", rwasm.NewRunnerWithRef(moduleref.RefWithData("atomic", "", module)), r.DefaultCaps())
+
+	res, err := r.Do(rt.NewJob("atomic", nil)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "-4" {
+		t.Errorf("expected -4, got %s", res.([]byte))
+	}
+
+	// the lock would be 'stolen' if the second swap had succeeded, which would also have made the third fail
+	if val, _ := r.DefaultCaps().Cache.Get("lock"); string(val) != "released" {
+		t.Errorf("expected lock to be 'released', got %q", val)
+	}
+}
@@ -0,0 +1,59 @@
+package wasmtest
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestTimeNow(t *testing.T) {
+	// returns the 16 bytes written by time_now
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "time_now", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(0), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(16), localGet(2), call(1),
+		),
+	)
+
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := rcap.NewFrozenClock(start)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Clock = &rcap.ClockConfig{Enabled: true, Clock: clock}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("clock", rwasm.NewRunnerWithRef(moduleref.RefWithData("clock", "", module)), rt.CapabilitiesFromConfig(config))
+
+	for _, elapsed := range []time.Duration{0, 5 * time.Second} {
+		clock.Advance(elapsed)
+
+		res, err := r.Do(rt.NewJob("clock", "")).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		result := res.([]byte)
+
+		if wall := int64(binary.LittleEndian.Uint64(result)); wall != start.Add(elapsed).UnixNano() {
+			t.Errorf("expected wall time %d, got %d", start.Add(elapsed).UnixNano(), wall)
+		}
+
+		if monotonic := int64(binary.LittleEndian.Uint64(result[8:])); monotonic != int64(elapsed) {
+			t.Errorf("expected monotonic time %d, got %d", elapsed, monotonic)
+		}
+	}
+}
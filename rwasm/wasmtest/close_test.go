@@ -0,0 +1,53 @@
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+)
+
+func TestCloseRunner(t *testing.T) {
+	r := rt.New()
+
+	old := rwasm.NewRunner("../testdata/as-echo/as-echo.wasm")
+
+	doWasm := r.Register("as-echo-close", old, rt.PoolSize(2))
+
+	if _, err := doWasm("before").Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	runner := rwasm.NewRunner("../testdata/as-echo/as-echo.wasm")
+
+	if err := r.Reload("as-echo-close", runner); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Reload"))
+	}
+
+	// closing the replaced Runner should not affect the new one
+	old.Close()
+
+	if stats := old.Stats(); stats.Instances != 0 {
+		t.Error("expected closed Runner to have 0 instances, got", stats.Instances)
+	}
+
+	res, err := doWasm("after").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, after" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+
+	if err := r.DeRegister("as-echo-close"); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to DeRegister"))
+	}
+
+	runner.Close()
+
+	if stats := runner.Stats(); stats.Instances != 0 {
+		t.Error("expected closed Runner to have 0 instances, got", stats.Instances)
+	}
+}
@@ -0,0 +1,50 @@
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestConfigGet(t *testing.T) {
+	// reads the configuration key named by the job's input and returns its value
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "config_get", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Configuration = &rcap.ConfigurationConfig{
+		Enabled: true,
+		Rules:   rcap.ConfigurationRules{AllowedKeys: []string{"features.*"}},
+		Values:  map[string]string{"features.checkout": "enabled"},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("config", rwasm.NewRunnerWithRef(moduleref.RefWithData("config", "", module)), rt.CapabilitiesFromConfig(config))
+
+	res, err := r.Do(rt.NewJob("config", "features.checkout")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "enabled" {
+		t.Errorf("expected 'enabled', got %q", res.([]byte))
+	}
+}
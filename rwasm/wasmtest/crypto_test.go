@@ -0,0 +1,96 @@
+package wasmtest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestCryptoHMAC(t *testing.T) {
+	// returns the sha256 HMAC of the job's input using the webhook key
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "crypto_hmac", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(0), i32Const(6), i32Const(6), i32Const(7), localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+		dataSegment{offset: 0, data: []byte("sha256webhook")},
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Crypto = &rcap.CryptoConfig{
+		Enabled: true,
+		Keys:    map[string]rcap.CryptoKey{"webhook": {Secret: []byte("whsec_test")}},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("crypto", rwasm.NewRunnerWithRef(moduleref.RefWithData("crypto", "", module)), rt.CapabilitiesFromConfig(config))
+
+	res, err := r.Do(rt.NewJob("crypto", "payload")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("payload"))
+
+	if !hmac.Equal(res.([]byte), mac.Sum(nil)) {
+		t.Errorf("unexpected HMAC %x", res.([]byte))
+	}
+}
+
+func TestCryptoEncryptDecrypt(t *testing.T) {
+	// encrypts the job's input with the tokens key, then decrypts the ciphertext and returns the plaintext
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "crypto_encrypt", typ: 3},
+			{module: "env", name: "crypto_decrypt", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(0), i32Const(6), localGet(0), localGet(1), i32Const(6), i32Const(4), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(6), localGet(2), call(2), i32Const(6), i32Const(4), localGet(2), call(1), []byte{opDrop},
+			localGet(2), call(2), localGet(2), call(3),
+		),
+		dataSegment{offset: 0, data: []byte("tokensuser")},
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Crypto = &rcap.CryptoConfig{
+		Enabled: true,
+		Keys:    map[string]rcap.CryptoKey{"tokens": {Secret: []byte("0123456789abcdef")}},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("crypto", rwasm.NewRunnerWithRef(moduleref.RefWithData("crypto", "", module)), rt.CapabilitiesFromConfig(config))
+
+	res, err := r.Do(rt.NewJob("crypto", "card ending 4242")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "card ending 4242" {
+		t.Errorf("expected 'card ending 4242', got %q", res.([]byte))
+	}
+}
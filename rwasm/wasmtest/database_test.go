@@ -0,0 +1,84 @@
+package wasmtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// testDatabase returns the statements it's given (and the types of their arguments) as
+// rows, and reports every exec as affecting one row
+type testDatabase struct{}
+
+func (testDatabase) Query(ctx context.Context, query string, args []interface{}) ([]byte, error) {
+	types := []string{}
+	for _, arg := range args {
+		types = append(types, fmt.Sprintf("%T", arg))
+	}
+
+	return json.Marshal([]map[string]interface{}{{"query": query, "args": args, "types": types}})
+}
+
+func (testDatabase) Exec(ctx context.Context, query string, args []interface{}) (*rcap.DatabaseResult, error) {
+	return &rcap.DatabaseResult{RowsAffected: 1, LastInsertID: int64(len(args))}, nil
+}
+
+// databaseModule returns a Runnable that runs query with the fn host function (db_query or
+// db_exec), using the job's input as the arguments, and returns the FFI result
+func databaseModule(fn, query string) []byte {
+	return runnableModule(
+		[]funcImport{
+			{module: "env", name: fn, typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(0), i32Const(int32(len(query))), localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+		dataSegment{offset: 0, data: []byte(query)},
+	)
+}
+
+func TestDatabase(t *testing.T) {
+	r := rt.New()
+
+	caps := rt.DefaultCapabilities(nil)
+	caps.Database = testDatabase{}
+
+	query := "SELECT * FROM people WHERE name = $1 AND age = $2"
+
+	r.RegisterWithCaps("db-query", rwasm.NewRunnerWithRef(moduleref.RefWithData("db-query", "", databaseModule("db_query", query))), caps)
+	r.RegisterWithCaps("db-exec", rwasm.NewRunnerWithRef(moduleref.RefWithData("db-exec", "", databaseModule("db_exec", "DELETE FROM people"))), caps)
+
+	res, err := r.Do(rt.NewJob("db-query", []byte(`["alice", 30, 1.5, true, null]`))).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	expected := `[{"args":["alice",30,1.5,true,null],"query":"SELECT * FROM people WHERE name = $1 AND age = $2",` +
+		`"types":["string","int64","float64","bool","\u003cnil\u003e"]}]`
+	if string(res.([]byte)) != expected {
+		t.Errorf("expected %s, got %s", expected, res.([]byte))
+	}
+
+	res, err = r.Do(rt.NewJob("db-exec", []byte(`[1, 2]`))).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if expected := `{"rowsAffected":1,"lastInsertId":2}`; string(res.([]byte)) != expected {
+		t.Errorf("expected %s, got %s", expected, res.([]byte))
+	}
+}
@@ -0,0 +1,50 @@
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestDNSResolve(t *testing.T) {
+	// resolves the A records of the name in the job's input
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "dns_resolve", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			localGet(0), localGet(1), i32Const(1024), i32Const(1), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+		dataSegment{offset: 1024, data: []byte("A")},
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.DNS = &rcap.DNSConfig{
+		Enabled: true,
+		Rules:   rcap.DNSRules{AllowedNames: []string{"localhost"}},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("dns", rwasm.NewRunnerWithRef(moduleref.RefWithData("dns", "", module)), rt.CapabilitiesFromConfig(config))
+
+	res, err := r.Do(rt.NewJob("dns", "localhost")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != `["127.0.0.1"]` {
+		t.Errorf("expected localhost to resolve to 127.0.0.1, got %s", res.([]byte))
+	}
+}
@@ -0,0 +1,73 @@
+package wasmtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+type testEmailSender struct {
+	sent []rcap.EmailMessage
+	lock sync.Mutex
+}
+
+func (t *testEmailSender) Send(ctx context.Context, msg rcap.EmailMessage) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.sent = append(t.sent, msg)
+
+	return nil
+}
+
+func TestSendEmail(t *testing.T) {
+	// sends the email described by the job's input
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "send_email", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(0), localGet(2), call(1),
+		),
+	)
+
+	sender := &testEmailSender{}
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Email = &rcap.EmailConfig{
+		Enabled: true,
+		From:    "notify@example.com",
+		Rules:   rcap.EmailRules{MaxPerMinute: 1},
+		Sender:  sender,
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("notify", rwasm.NewRunnerWithRef(moduleref.RefWithData("notify", "", module)), rt.CapabilitiesFromConfig(config))
+
+	// the second email is over the rate limit, so it isn't sent
+	for i := 0; i < 2; i++ {
+		if _, err := r.Do(rt.NewJob("notify", `{"to":["ada@example.com"],"subject":"Welcome","text":"Hello, Ada"}`)).Then(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+	}
+
+	if len(sender.sent) != 1 {
+		t.Fatalf("expected 1 email to be sent, got %d", len(sender.sent))
+	}
+
+	if sent := sender.sent[0]; sent.From != "notify@example.com" || sent.To[0] != "ada@example.com" || sent.Subject != "Welcome" {
+		t.Errorf("unexpected email %+v", sent)
+	}
+}
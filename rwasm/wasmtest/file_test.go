@@ -0,0 +1,58 @@
+package wasmtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestFileReadWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	// writes the job's input to out/artifact.txt, then reads it back and returns it
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "file_write", typ: 3},
+			{module: "env", name: "file_read", typ: 4},
+			{module: "env", name: "take_ffi_result", typ: 5},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(0), i32Const(16), localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(16), localGet(2), call(1), []byte{opDrop},
+			localGet(2), call(2), localGet(2), call(3),
+		),
+		dataSegment{offset: 0, data: []byte("out/artifact.txt")},
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.File = &rcap.FileConfig{Enabled: true, Directory: dir, AllowWrite: true}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("file", rwasm.NewRunnerWithRef(moduleref.RefWithData("file", "", module)), rt.CapabilitiesFromConfig(config))
+
+	res, err := r.Do(rt.NewJob("file", "build artifact")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "build artifact" {
+		t.Errorf("expected 'build artifact', got %q", res.([]byte))
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "out", "artifact.txt")); string(data) != "build artifact" {
+		t.Errorf("expected 'build artifact' to be written, got %q", data)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build wasmtime
+// +build wasmtime
+
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+func TestFuelExhausted(t *testing.T) {
+	r := rt.New()
+
+	doWasm := r.Register("as-echo-starved", rwasm.NewRunner("../testdata/as-echo/as-echo.wasm", rwasm.WithFuel(100)))
+
+	_, err := doWasm("from AssemblyScript!").Then()
+	if err == nil {
+		t.Error("expected error, did not get one")
+		return
+	}
+
+	if !errors.Is(err, runtime.ErrFuelExhausted) {
+		t.Error("expected ErrFuelExhausted, got", err)
+	}
+}
+
+func TestFuelWithinBudget(t *testing.T) {
+	r := rt.New()
+
+	doWasm := r.Register("as-echo-fueled", rwasm.NewRunner("../testdata/as-echo/as-echo.wasm", rwasm.WithFuel(10000000)))
+
+	for i := 0; i < 3; i++ {
+		res, err := doWasm("from AssemblyScript!").Then()
+		if err != nil {
+			t.Error(errors.Wrap(err, "failed to Then"))
+			return
+		}
+
+		if string(res.([]byte)) != "hello, from AssemblyScript!" {
+			t.Error("as-echo failed, got:", string(res.([]byte)))
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package wasmtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+var (
+	graphqlQuery     = []byte(`query GetRepo($name: String!, $stars: Int) { repository(name: $name) { id } }`)
+	graphqlVariables = []byte(`{"name":"reactr","stars":5}`)
+	graphqlOperation = []byte("GetRepo")
+)
+
+func TestGraphQLRequest(t *testing.T) {
+	// sends the query with its variables and operation name to the endpoint it's given, and returns the response
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "graphql_request", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			localGet(0), localGet(1),
+			i32Const(0), i32Const(int32(len(graphqlQuery))),
+			i32Const(128), i32Const(int32(len(graphqlVariables))),
+			i32Const(192), i32Const(int32(len(graphqlOperation))),
+			localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1),
+			localGet(2), call(2),
+		),
+		dataSegment{offset: 0, data: graphqlQuery},
+		dataSegment{offset: 128, data: graphqlVariables},
+		dataSegment{offset: 192, data: graphqlOperation},
+	)
+
+	// the server returns the request it received as its data
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": req})
+	}))
+	defer server.Close()
+
+	r := rt.New()
+
+	r.Register("graphql", rwasm.NewRunnerWithRef(moduleref.RefWithData("graphql", "", module)))
+
+	res, err := r.Do(rt.NewJob("graphql", server.URL)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	resp := rcap.GraphQLResponse{}
+	if err := json.Unmarshal(res.([]byte), &resp); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Unmarshal"))
+	}
+
+	if resp.Data["query"] != string(graphqlQuery) {
+		t.Errorf("expected the query to be sent unchanged, got %v", resp.Data["query"])
+	}
+
+	if resp.Data["operationName"] != "GetRepo" {
+		t.Errorf("expected operationName GetRepo, got %v", resp.Data["operationName"])
+	}
+
+	variables, _ := resp.Data["variables"].(map[string]interface{})
+	if variables["name"] != "reactr" || variables["stars"] != float64(5) {
+		t.Errorf("expected the variables to be sent, got %v", resp.Data["variables"])
+	}
+}
+
+func TestGraphQLHeaders(t *testing.T) {
+	headers := []byte("Authorization: Bearer runnable-token\n")
+	query := []byte("{ viewer { id } }")
+
+	// sets a bearer token for the job's GraphQL requests, and returns the response to a query to the endpoint it's given
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "graphql_headers", typ: 3},
+			{module: "env", name: "graphql_query", typ: 4},
+			{module: "env", name: "take_ffi_result", typ: 5},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(0), i32Const(int32(len(headers))), localGet(2), call(0), []byte{opDrop},
+			localGet(0), localGet(1), i32Const(64), i32Const(int32(len(query))), localGet(2), call(1), []byte{opDrop},
+			localGet(2), call(2),
+			localGet(2), call(3),
+		),
+		dataSegment{offset: 0, data: headers},
+		dataSegment{offset: 64, data: query},
+	)
+
+	// the server returns the Authorization header it received as its data
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"authorization": r.Header.Get("Authorization")}})
+	}))
+	defer server.Close()
+
+	config := rcap.DefaultCapabilityConfig()
+	config.GraphQL.AllowedHeaders = []string{"Authorization"}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("graphql", rwasm.NewRunnerWithRef(moduleref.RefWithData("graphql", "", module)), rt.CapabilitiesFromConfig(config))
+
+	res, err := r.Do(rt.NewJob("graphql", server.URL)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	resp := rcap.GraphQLResponse{}
+	if err := json.Unmarshal(res.([]byte), &resp); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Unmarshal"))
+	}
+
+	if resp.Data["authorization"] != "Bearer runnable-token" {
+		t.Errorf("expected the Runnable's bearer token, got %v", resp.Data["authorization"])
+	}
+}
@@ -0,0 +1,132 @@
+package wasmtest
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/grav/grav"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestMessageSend(t *testing.T) {
+	// sends the job's input as an order.created message
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "message_send", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(0), i32Const(13), localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(0), localGet(2), call(1),
+		),
+		dataSegment{offset: 0, data: []byte("order.created")},
+	)
+
+	g := grav.New()
+
+	received := make(chan grav.Message, 1)
+
+	receiver := g.Connect()
+	receiver.OnType("order.created", func(msg grav.Message) error {
+		received <- msg
+		return nil
+	})
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Grav = &rcap.GravConfig{Enabled: true, Pod: g.Connect()}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("grav", rwasm.NewRunnerWithRef(moduleref.RefWithData("grav", "", module)), rt.CapabilitiesFromConfig(config))
+
+	if _, err := r.Do(rt.NewJob("grav", "order 1")).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	select {
+	case msg := <-received:
+		if string(msg.Data()) != "order 1" {
+			t.Errorf("expected 'order 1', got %q", msg.Data())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not received")
+	}
+}
+
+func TestOnMessage(t *testing.T) {
+	// on_message sends the data of each message it receives as an order.handled message
+	module := messageModule(
+		[]funcImport{
+			{module: "env", name: "message_send", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+		},
+		code(i32Const(0), i32Const(0), localGet(2), call(1)),
+		code(i32Const(0), i32Const(13), localGet(2), localGet(3), localGet(4), call(0), []byte{opDrop}),
+		dataSegment{offset: 0, data: []byte("order.handled")},
+	)
+
+	g := grav.New()
+
+	handled := make(chan grav.Message, 3)
+
+	receiver := g.Connect()
+	receiver.OnType("order.handled", func(msg grav.Message) error {
+		handled <- msg
+		return nil
+	})
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Grav = &rcap.GravConfig{Enabled: true, Pod: g.Connect()}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("orders", rwasm.NewRunnerWithRef(moduleref.RefWithData("orders", "", module)), rt.CapabilitiesFromConfig(config))
+	// a job that isn't a message is handled by run_e, and waiting for it means the module is ready before messages are sent
+	if _, err := r.Do(rt.NewJob("orders", "warm")).Then(); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Subscribe(g.Connect(), "orders", "order.created", "order.updated")
+
+	sender := g.Connect()
+	sender.Send(grav.NewMsg("order.created", []byte("order 1")))
+	sender.Send(grav.NewMsg("order.deleted", []byte("order 2")))
+	sender.Send(grav.NewMsg("order.updated", []byte("order 3")))
+
+	received := []string{}
+
+	for len(received) < 2 {
+		select {
+		case msg := <-handled:
+			received = append(received, string(msg.Data()))
+		case <-time.After(10 * time.Second):
+			t.Fatal("message was not handled")
+		}
+	}
+
+	// messages are handled concurrently, so they may be handled in any order
+	sort.Strings(received)
+
+	if strings.Join(received, ",") != "order 1,order 3" {
+		t.Error("expected order 1 and order 3 to be handled, got", received)
+	}
+
+	// a module without on_message can't receive messages
+	r.Register("plain", rwasm.NewRunnerWithRef(moduleref.RefWithData("plain", "", runnableModule(nil, nil, nil))))
+
+	if _, err := r.Do(rt.NewJob("plain", grav.NewMsg("order.created", nil))).Then(); !errors.Is(err, rwasm.ErrNoMessageHandler) {
+		t.Error("expected ErrNoMessageHandler, got", err)
+	}
+}
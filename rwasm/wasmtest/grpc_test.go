@@ -0,0 +1,104 @@
+package wasmtest
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcCallModule returns a Runnable that calls the gRPC health service at target with the request message it's given.
+// It returns the FFI result set by grpc_call, or if returnCode is set, grpc_call's return value as 4 little-endian bytes.
+func grpcCallModule(target string, returnCode bool) []byte {
+	method := "/grpc.health.v1.Health/Check"
+
+	grpcCall := code(
+		i32Const(0), i32Const(int32(len(target))),
+		i32Const(256), i32Const(int32(len(method))),
+		localGet(0), localGet(1),
+		localGet(2), call(0),
+	)
+
+	body := code(grpcCall, []byte{opDrop}, localGet(2), call(1), localGet(2), call(2))
+	if returnCode {
+		body = code(i32Const(8192), grpcCall, []byte{opI32Store, 0x02, 0x00}, i32Const(8192), i32Const(4), localGet(2), call(2))
+	}
+
+	return runnableModule(
+		[]funcImport{
+			{module: "env", name: "grpc_call", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		body,
+		dataSegment{offset: 0, data: []byte(target)},
+		dataSegment{offset: 256, data: []byte(method)},
+	)
+}
+
+func TestGRPCCall(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Listen"))
+	}
+
+	server := grpc.NewServer()
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("reactr", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	go server.Serve(listener)
+	defer server.Stop()
+
+	target := listener.Addr().String()
+
+	config := rcap.DefaultCapabilityConfig()
+	config.GRPC = &rcap.GRPCConfig{Enabled: true, Plaintext: true, TimeoutSeconds: 5}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("grpc-call", rwasm.NewRunnerWithRef(moduleref.RefWithData("grpc-call", "", grpcCallModule(target, false))), rt.CapabilitiesFromConfig(config))
+	r.RegisterWithCaps("grpc-code", rwasm.NewRunnerWithRef(moduleref.RefWithData("grpc-code", "", grpcCallModule(target, true))), rt.CapabilitiesFromConfig(config))
+
+	request, _ := proto.Marshal(&healthpb.HealthCheckRequest{Service: "reactr"})
+
+	res, err := r.Do(rt.NewJob("grpc-call", request)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	resp := &healthpb.HealthCheckResponse{}
+	if err := proto.Unmarshal(res.([]byte), resp); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Unmarshal"))
+	}
+
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Error("expected SERVING, got", resp.Status)
+	}
+
+	// a call that fails with a status returns its code
+	request, _ = proto.Marshal(&healthpb.HealthCheckRequest{Service: "missing"})
+
+	res, err = r.Do(rt.NewJob("grpc-code", request)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if code := int32(binary.LittleEndian.Uint32(res.([]byte))); code != -105 {
+		t.Error("expected -105 for NOT_FOUND, got", code)
+	}
+}
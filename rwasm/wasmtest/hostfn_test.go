@@ -0,0 +1,64 @@
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// takeResultModule is a Runnable that calls a custom host function to prepare an FFI result,
+// then uses take_ffi_result to receive it as a pointer and length and returns it as the job's result
+var takeResultModule = runnableModule(
+	[]funcImport{
+		{module: "env", name: "prepare_greeting", typ: 0},
+		{module: "env", name: "take_ffi_result", typ: 3},
+		returnResultImport,
+	},
+	[]funcType{
+		{params: []byte{i32}, results: []byte{i32, i32}},
+	},
+	code(
+		localGet(2), call(0), []byte{opDrop},
+		// take_ffi_result leaves the pointer and length on the stack for return_result
+		localGet(2), call(1),
+		localGet(2), call(2),
+	),
+)
+
+func prepareGreeting() runtime.HostFn {
+	return runtime.NewHostFn("prepare_greeting", 1, true, func(args ...interface{}) (interface{}, error) {
+		inst, err := runtime.InstanceForIdentifier(args[0].(int32), false)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to InstanceForIdentifier")
+		}
+
+		greeting := []byte("hello from the host")
+
+		if err := inst.SetFFIResult(greeting); err != nil {
+			return nil, errors.Wrap(err, "failed to SetFFIResult")
+		}
+
+		return int32(len(greeting)), nil
+	})
+}
+
+func TestMultiReturnHostFn(t *testing.T) {
+	r := rt.New()
+
+	ref := moduleref.RefWithData("take-result", "", takeResultModule)
+
+	doWasm := r.Register("take-result", rwasm.NewRunnerWithRef(ref, rwasm.WithHostFns(prepareGreeting())))
+
+	res, err := doWasm(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello from the host" {
+		t.Error("expected 'hello from the host', got", string(res.([]byte)))
+	}
+}
@@ -0,0 +1,382 @@
+package wasmtest
+
+import (
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+var (
+	httpRequestHeaders = []byte("Content-Type: application/json\r\nAuthorization: Bearer abc123\n")
+	httpRequestBody    = []byte(`{"hello":"world"}`)
+)
+
+// httpRequestModule is a Runnable that POSTs JSON with an auth header to the URL it's given,
+// and returns the encoded response from http_request as its result
+var httpRequestModule = runnableModule(
+	[]funcImport{
+		{module: "env", name: "http_request", typ: 3},
+		{module: "env", name: "take_ffi_result", typ: 4},
+		returnResultImport,
+	},
+	[]funcType{
+		{params: []byte{i32, i32, i32, i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+		{params: []byte{i32}, results: []byte{i32, i32}},
+	},
+	code(
+		i32Const(0), i32Const(4),
+		localGet(0), localGet(1),
+		i32Const(16), i32Const(int32(len(httpRequestHeaders))),
+		i32Const(256), i32Const(int32(len(httpRequestBody))),
+		localGet(2), call(0), []byte{opDrop},
+		localGet(2), call(1),
+		localGet(2), call(2),
+	),
+	dataSegment{offset: 0, data: []byte("POST")},
+	dataSegment{offset: 16, data: httpRequestHeaders},
+	dataSegment{offset: 256, data: httpRequestBody},
+)
+
+// httpRequestCodeModule makes the same request as httpRequestModule, and returns http_request's return value as 4 little-endian bytes
+var httpRequestCodeModule = runnableModule(
+	[]funcImport{
+		{module: "env", name: "http_request", typ: 3},
+		returnResultImport,
+	},
+	[]funcType{
+		{params: []byte{i32, i32, i32, i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+	},
+	code(
+		i32Const(8192),
+		i32Const(0), i32Const(4),
+		localGet(0), localGet(1),
+		i32Const(16), i32Const(int32(len(httpRequestHeaders))),
+		i32Const(256), i32Const(int32(len(httpRequestBody))),
+		localGet(2), call(0), []byte{opI32Store, 0x02, 0x00},
+		i32Const(8192), i32Const(4), localGet(2), call(1),
+	),
+	dataSegment{offset: 0, data: []byte("POST")},
+	dataSegment{offset: 16, data: httpRequestHeaders},
+	dataSegment{offset: 256, data: httpRequestBody},
+)
+
+func TestHTTPRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		w.Header().Set("Link", `</things?page=2>; rel="next"`)
+		w.Header().Set("X-Request", r.Method+" "+r.Header.Get("Content-Type")+" "+r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	r := rt.New()
+
+	doWasm := r.Register("http-request", rwasm.NewRunnerWithRef(moduleref.RefWithData("http-request", "", httpRequestModule)))
+
+	res, err := doWasm(server.URL + "/things").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	expected := "201\r\n" +
+		"Content-Length: 17\r\n" +
+		"Content-Type: application/json\r\n" +
+		"Date: " + "DATE" + "\r\n" +
+		"Link: </things?page=2>; rel=\"next\"\r\n" +
+		"X-Request: POST application/json Bearer abc123\r\n" +
+		"\r\n" +
+		`{"hello":"world"}`
+
+	if got := withoutDate(string(res.([]byte))); got != expected {
+		t.Errorf("unexpected response, got:\n%q\nexpected:\n%q", got, expected)
+	}
+
+	// responses with error statuses are returned to the Runnable rather than failing the request
+	res, err = doWasm(server.URL + "/missing").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if got := string(res.([]byte)); got[:5] != "404\r\n" || got[len(got)-10:] != "not found\n" {
+		t.Errorf("unexpected response, got: %q", got)
+	}
+
+	// a body larger than the Runner's maximum isn't read into memory
+	doLimited := r.Register("http-request-limited", rwasm.NewRunnerWithRef(moduleref.RefWithData("http-request-limited", "", httpRequestCodeModule), rwasm.WithMaxResponseSize(16)))
+
+	res, err = doLimited(server.URL + "/things").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if code := int32(binary.LittleEndian.Uint32(res.([]byte))); code != -5 {
+		t.Error("expected -5 for a body larger than the maximum, got", code)
+	}
+
+	doExact := r.Register("http-request-code", rwasm.NewRunnerWithRef(moduleref.RefWithData("http-request-code", "", httpRequestCodeModule), rwasm.WithMaxResponseSize(17)))
+
+	res, err = doExact(server.URL + "/things").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if code := int32(binary.LittleEndian.Uint32(res.([]byte))); code <= 0 {
+		t.Error("expected a body of the maximum size to be read, got", code)
+	}
+}
+
+// withoutDate replaces the value of the Date header, which changes with each response
+func withoutDate(response string) string {
+	start := strings.Index(response, "Date: ")
+	if start < 0 {
+		return response
+	}
+
+	end := strings.Index(response[start:], "\r\n")
+
+	return response[:start] + "Date: DATE" + response[start+end:]
+}
+
+// fetchStreamModule is a Runnable that opens a response from the URL it's given, reads its body in three
+// parts into consecutive memory, and returns what it read. Handles are numbered from 1 in each job.
+var fetchStreamModule = runnableModule(
+	[]funcImport{
+		{module: "env", name: "fetch_open", typ: 3},
+		{module: "env", name: "fetch_read", typ: 4},
+		{module: "env", name: "fetch_close", typ: 5},
+		returnResultImport,
+	},
+	[]funcType{
+		{params: []byte{i32, i32, i32, i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+		{params: []byte{i32, i32, i32, i32}, results: []byte{i32}},
+		{params: []byte{i32, i32}, results: []byte{i32}},
+	},
+	code(
+		i32Const(0), i32Const(0),
+		localGet(0), localGet(1),
+		i32Const(0), i32Const(0),
+		i32Const(0), i32Const(0),
+		localGet(2), call(0), []byte{opDrop},
+		i32Const(1), i32Const(8192), i32Const(5), localGet(2), call(1), []byte{opDrop},
+		i32Const(1), i32Const(8197), i32Const(5), localGet(2), call(1), []byte{opDrop},
+		i32Const(1), i32Const(8202), i32Const(100), localGet(2), call(1), []byte{opDrop},
+		i32Const(1), localGet(2), call(2), []byte{opDrop},
+		i32Const(8192), i32Const(22), localGet(2), call(3),
+	),
+)
+
+func TestFetchStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello, streaming world"))
+	}))
+	defer server.Close()
+
+	r := rt.New()
+
+	doWasm := r.Register("fetch-stream", rwasm.NewRunnerWithRef(moduleref.RefWithData("fetch-stream", "", fetchStreamModule)))
+
+	res, err := doWasm(server.URL).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, streaming world" {
+		t.Errorf("unexpected result, got: %q", string(res.([]byte)))
+	}
+}
+
+// fetchHeaderModule is a Runnable that makes a request with fetch_url to the URL it's given, and returns the response's
+// status (from fetch_status, as 4 little-endian bytes) followed by its Link header (from fetch_header)
+var fetchHeaderModule = runnableModule(
+	[]funcImport{
+		{module: "env", name: "fetch_url", typ: 3},
+		{module: "env", name: "fetch_status", typ: 0},
+		{module: "env", name: "fetch_header", typ: 4},
+		{module: "env", name: "get_ffi_result", typ: 5},
+		returnResultImport,
+	},
+	[]funcType{
+		{params: []byte{i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+		{params: []byte{i32, i32, i32}, results: []byte{i32}},
+		{params: []byte{i32, i32}, results: []byte{i32}},
+	},
+	code(
+		i32Const(1), localGet(0), localGet(1), i32Const(0), i32Const(0), localGet(2), call(0), []byte{opDrop},
+		i32Const(8192), localGet(2), call(1), []byte{opI32Store, 0x02, 0x00},
+		i32Const(8192),
+		i32Const(16), i32Const(4), localGet(2), call(2), i32Const(4), []byte{opI32Add},
+		i32Const(8196), localGet(2), call(3), []byte{opDrop},
+		localGet(2), call(4),
+	),
+	dataSegment{offset: 16, data: []byte("Link")},
+)
+
+func TestFetchStatusAndHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", `</things?page=2>; rel="next"`)
+		w.Header().Add("Link", `</things?page=9>; rel="last"`)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	r := rt.New()
+
+	doWasm := r.Register("fetch-header", rwasm.NewRunnerWithRef(moduleref.RefWithData("fetch-header", "", fetchHeaderModule)))
+
+	res, err := doWasm(server.URL).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	result := res.([]byte)
+
+	// the status and headers are available even though fetch_url treats a 404 as an error
+	if status := binary.LittleEndian.Uint32(result[:4]); status != 404 {
+		t.Error("expected status 404, got", status)
+	}
+
+	if link := string(result[4:]); link != `</things?page=2>; rel="next", </things?page=9>; rel="last"` {
+		t.Errorf("unexpected Link header, got: %q", link)
+	}
+}
+
+// fetchCodeModule is a Runnable that makes a request with fetch_url to the URL it's given, and returns fetch_url's
+// return value as 4 little-endian bytes
+var fetchCodeModule = runnableModule(
+	[]funcImport{
+		{module: "env", name: "fetch_url", typ: 3},
+		returnResultImport,
+	},
+	[]funcType{
+		{params: []byte{i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+	},
+	code(
+		i32Const(8192),
+		i32Const(1), localGet(0), localGet(1), i32Const(0), i32Const(0), localGet(2), call(0),
+		[]byte{opI32Store, 0x02, 0x00},
+		i32Const(8192), i32Const(4), localGet(2), call(1),
+	),
+)
+
+func TestCallTimeouts(t *testing.T) {
+	// the server hangs until the request is cancelled
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Timeouts = &rcap.TimeoutsConfig{
+		Enabled:  true,
+		Timeouts: []rcap.HostFnTimeout{{HostFns: []string{"fetch_*", "http_request"}, Millis: 100}},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("fetch-code", rwasm.NewRunnerWithRef(moduleref.RefWithData("fetch-code", "", fetchCodeModule)), rt.CapabilitiesFromConfig(config))
+
+	started := time.Now()
+
+	res, err := r.Do(rt.NewJob("fetch-code", server.URL)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if code := int32(binary.LittleEndian.Uint32(res.([]byte))); code != -3 {
+		t.Error("expected the request to fail with -3, got", code)
+	}
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Error("expected the request to time out, but the job took", elapsed)
+	}
+}
+
+func TestFetchStreamTimeout(t *testing.T) {
+	// the server sends its headers straight away, but its body only after the call's timeout has passed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		if r.URL.Query().Get("slow") != "" {
+			time.Sleep(3 * time.Second)
+		}
+
+		w.Write([]byte("hello, streaming world"))
+	}))
+	defer server.Close()
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Timeouts = &rcap.TimeoutsConfig{
+		Enabled:  true,
+		Timeouts: []rcap.HostFnTimeout{{HostFns: []string{"fetch_open"}, Millis: 1500}},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("fetch-stream", rwasm.NewRunnerWithRef(moduleref.RefWithData("fetch-stream", "", fetchStreamModule)), rt.CapabilitiesFromConfig(config))
+
+	// the first job builds the instance, which would otherwise count against the timeout
+	if _, err := r.Do(rt.NewJob("fetch-stream", server.URL)).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	// the timeout only applies until the headers arrive, so the body can still be read
+	res, err := r.Do(rt.NewJob("fetch-stream", server.URL+"?slow=1")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, streaming world" {
+		t.Errorf("unexpected result, got: %q", string(res.([]byte)))
+	}
+}
+
+func TestSlowJobHostCall(t *testing.T) {
+	// the server responds slowly
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	slowJobs := make(chan rt.SlowJob, 1)
+
+	r := rt.New()
+
+	r.Register("slow-fetch", rwasm.NewRunnerWithRef(moduleref.RefWithData("slow-fetch", "", fetchCodeModule)), rt.SlowJobThreshold(100*time.Millisecond, func(job rt.SlowJob) {
+		slowJobs <- job
+	}))
+
+	if _, err := r.Do(rt.NewJob("slow-fetch", server.URL)).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	select {
+	case job := <-slowJobs:
+		if job.HostCall != "fetch_url" || job.Input != server.URL {
+			t.Errorf("expected slow job calling fetch_url with input %s, got %+v", server.URL, job)
+		}
+	default:
+		t.Error("expected the job to be reported as slow")
+	}
+}
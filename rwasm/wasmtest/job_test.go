@@ -0,0 +1,201 @@
+package wasmtest
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+type upperRunner struct{}
+
+func (u upperRunner) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	return strings.ToUpper(string(job.Bytes())), nil
+}
+
+func (u upperRunner) OnChange(_ rt.ChangeEvent) error {
+	return nil
+}
+
+type failRunner struct{}
+
+func (f failRunner) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	return nil, errors.New("failed on purpose")
+}
+
+func (f failRunner) OnChange(_ rt.ChangeEvent) error {
+	return nil
+}
+
+func TestRunJob(t *testing.T) {
+	// runs a job with the jobType named by the job's input and 'hello' as its data, and returns the FFI result
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "run_job", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			localGet(0), localGet(1), i32Const(0), i32Const(5), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+		dataSegment{offset: 0, data: []byte("hello")},
+	)
+
+	r := rt.New()
+
+	r.Register("upper", upperRunner{})
+	r.Register("fail", failRunner{})
+	r.Register("compose", rwasm.NewRunnerWithRef(moduleref.RefWithData("compose", "", module)))
+
+	res, err := r.Do(rt.NewJob("compose", "upper")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "HELLO" {
+		t.Errorf("expected 'HELLO', got %q", res.([]byte))
+	}
+
+	// a failed job's error is set as the FFI result
+	res, err = r.Do(rt.NewJob("compose", "fail")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "failed on purpose" {
+		t.Errorf("expected 'failed on purpose', got %q", res.([]byte))
+	}
+}
+
+// nestRunner runs nested jobs of its own type until it's nested in enough other jobs, and then runs a code job
+type nestRunner struct {
+	depth int
+}
+
+func (n nestRunner) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	jobType := "nest"
+	if ctx.Depth() >= n.depth {
+		jobType = "code"
+	}
+
+	return ctx.Do(rt.NewJob(jobType, job.Bytes())).Then()
+}
+
+func (n nestRunner) OnChange(_ rt.ChangeEvent) error {
+	return nil
+}
+
+func TestRunJobLimits(t *testing.T) {
+	// runs a job with the jobType named by the job's input, and returns run_job's return code
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "run_job", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(8192), localGet(0), localGet(1), i32Const(0), i32Const(5), localGet(2), call(0), []byte{opI32Store, 0x02, 0x00},
+			i32Const(8192), i32Const(4), localGet(2), call(1),
+		),
+		dataSegment{offset: 0, data: []byte("hello")},
+	)
+
+	r := rt.New()
+
+	r.Register("upper", upperRunner{})
+	r.Register("code", rwasm.NewRunnerWithRef(moduleref.RefWithData("code", "", module)))
+
+	for _, tc := range []struct {
+		name     string
+		depth    int
+		input    string
+		expected int32
+	}{
+		{"nested", 2, "upper", 5},
+		// a job of the Runnable's own type would wait forever for a thread if its pool size is one
+		{"own jobType", 0, "code", -4},
+		// the code job is nested in 8 others
+		{"too deep", 7, "upper", -4},
+	} {
+		name, depth, input, expected := tc.name, tc.depth, tc.input, tc.expected
+
+		r.Register("nest", nestRunner{depth: depth}, rt.PoolSize(depth+1))
+
+		res, err := r.Do(rt.NewJob("nest", input)).Then()
+		if err != nil {
+			t.Error(errors.Wrapf(err, "failed to Then for %s", name))
+			continue
+		}
+
+		if ret := int32(binary.LittleEndian.Uint32(res.([]byte))); ret != expected {
+			t.Errorf("expected %s to return %d, got %d", name, expected, ret)
+		}
+	}
+}
+
+func TestJobMetaGet(t *testing.T) {
+	// returns the value of the job metadata key named by the job's input
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "job_meta_get", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+	)
+
+	r := rt.New()
+
+	r.Register("meta", rwasm.NewRunnerWithRef(moduleref.RefWithData("meta", "", module)))
+
+	job := rt.NewJob("meta", "correlation-id").WithMeta("correlation-id", "abc123")
+
+	res, err := r.Do(job).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "abc123" {
+		t.Errorf("expected 'abc123', got %q", res.([]byte))
+	}
+
+	retry := rt.NewJob("meta", "attempt").Retry()
+
+	res, err = r.Do(retry).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "2" {
+		t.Errorf("expected '2', got %q", res.([]byte))
+	}
+
+	uuidJob := rt.NewJob("meta", "uuid")
+
+	res, err = r.Do(uuidJob).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != uuidJob.UUID() {
+		t.Errorf("expected %q, got %q", uuidJob.UUID(), res.([]byte))
+	}
+}
@@ -0,0 +1,93 @@
+package wasmtest
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/request"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestJWTClaims(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-42"}`))
+	token := signed + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(key, []byte(signed)))
+
+	// verifies the token in the job's input (or the request's bearer token if there isn't one) and returns its claims
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "jwt_claims", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.JWT = &rcap.JWTConfig{
+		Enabled: true,
+		Keys:    map[string]crypto.PublicKey{"": pub},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("jwt", rwasm.NewRunnerWithRef(moduleref.RefWithData("jwt", "", module)), rt.CapabilitiesFromConfig(config))
+
+	t.Run("token", func(t *testing.T) {
+		res, err := r.Do(rt.NewJob("jwt", token)).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		if string(res.([]byte)) != `{"sub":"user-42"}` {
+			t.Errorf("expected claims, got %s", res.([]byte))
+		}
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		req := &request.CoordinatedRequest{
+			Method:  "GET",
+			URL:     "/orders",
+			ID:      "abc123",
+			Headers: map[string]string{"Authorization": "Bearer " + token},
+		}
+
+		reqJSON, err := req.ToJSON()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to ToJSON"))
+		}
+
+		res, err := r.Do(rt.NewJob("jwt", reqJSON)).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		resp := &request.CoordinatedResponse{}
+		if err := json.Unmarshal(res.([]byte), resp); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Unmarshal response"))
+		}
+
+		if string(resp.Output) != `{"sub":"user-42"}` {
+			t.Errorf("expected claims, got %s", resp.Output)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// greetingLibrary is a library module that exports a function returning the location of the greeting
+var greetingLibrary = testModule{
+	types: []funcType{{results: []byte{i32}}},
+	funcs: []testFunc{{typ: 0, body: i32Const(100)}},
+	exports: []funcExport{
+		{name: "greeting_ptr", fn: 0},
+	},
+}.bytes()
+
+// libraryModule is a Runnable that imports greeting_ptr from the greeting library and returns the greeting
+var libraryModule = runnableModule(
+	[]funcImport{
+		{module: "greeter", name: "greeting_ptr", typ: 3},
+		returnResultImport,
+	},
+	[]funcType{
+		{results: []byte{i32}},
+	},
+	code(
+		call(0), i32Const(20),
+		localGet(2), call(1),
+	),
+	dataSegment{offset: 100, data: []byte("hello from a library")},
+)
+
+func TestLibraryModule(t *testing.T) {
+	r := rt.New()
+
+	ref := moduleref.RefWithData("library", "", libraryModule)
+	lib := moduleref.RefWithData("greeter", "", greetingLibrary)
+
+	doWasm := r.Register("library", rwasm.NewRunnerWithRef(ref, rwasm.WithLibrary("greeter", lib)))
+
+	for i := 0; i < 2; i++ {
+		res, err := doWasm(nil).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		if string(res.([]byte)) != "hello from a library" {
+			t.Error("expected 'hello from a library', got", string(res.([]byte)))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package wasmtest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestLockAcquire(t *testing.T) {
+	store8 := []byte{opI32Store8, 0x00, 0x00}
+
+	// acquires the orders lock twice, releases it, acquires it again, and returns each call's return value as a byte
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "lock_acquire", typ: 3},
+			{module: "env", name: "lock_release", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(100), i32Const(0), i32Const(6), i32Const(10), localGet(2), call(0), store8,
+			i32Const(101), i32Const(0), i32Const(6), i32Const(10), localGet(2), call(0), store8,
+			i32Const(102), i32Const(1), localGet(2), call(1), store8,
+			i32Const(103), i32Const(0), i32Const(6), i32Const(10), localGet(2), call(0), store8,
+			i32Const(100), i32Const(4), localGet(2), call(2),
+		),
+		dataSegment{offset: 0, data: []byte("orders")},
+	)
+
+	r := rt.New()
+
+	r.Register("lock", rwasm.NewRunnerWithRef(moduleref.RefWithData("lock", "", module)))
+
+	// the lock that's still held at the end of the first job is released, so the second job can acquire it
+	for i := 0; i < 2; i++ {
+		res, err := r.Do(rt.NewJob("lock", nil)).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		if !bytes.Equal(res.([]byte), []byte{1, 0, 0, 2}) {
+			t.Errorf("expected handle 1, held, released, handle 2, got %v", res.([]byte))
+		}
+	}
+}
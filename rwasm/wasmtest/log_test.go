@@ -0,0 +1,78 @@
+package wasmtest
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/vektor/vlog"
+)
+
+func TestLogStructured(t *testing.T) {
+	msg := []byte("order created")
+	fields := []byte(`{"order_id":42,"region":"ca"}`)
+
+	// logs a warning with fields
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "log_structured", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(2), i32Const(0), i32Const(int32(len(msg))), i32Const(64), i32Const(int32(len(fields))), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(0), localGet(2), call(1),
+		),
+		dataSegment{offset: 0, data: msg},
+		dataSegment{offset: 64, data: fields},
+	)
+
+	logs := make(chan []byte, 10)
+
+	logger := vlog.Default(vlog.Level(vlog.LogLevelInfo), vlog.PreLogHook(func(log []byte) {
+		logs <- log
+	}))
+
+	r := rt.New()
+
+	r.RegisterWithCaps("log", rwasm.NewRunnerWithRef(moduleref.RefWithData("log", "", module)), rt.CapabilitiesFromConfig(rcap.DefaultConfigWithLogger(logger)))
+
+	job := rt.NewJob("log", "")
+
+	if _, err := r.Do(job).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	log := struct {
+		Message string `json:"log_message"`
+		Level   int    `json:"level"`
+		Scope   struct {
+			JobType string                 `json:"job_type"`
+			JobUUID string                 `json:"job_uuid"`
+			EnvUUID string                 `json:"env_uuid"`
+			Fields  map[string]interface{} `json:"fields"`
+		} `json:"scope"`
+	}{}
+
+	if err := json.Unmarshal(<-logs, &log); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Unmarshal"))
+	}
+
+	if log.Message != "(W) order created" || log.Level != 2 {
+		t.Errorf("expected a warning with the message, got %q at level %d", log.Message, log.Level)
+	}
+
+	if log.Scope.JobType != "log" || log.Scope.JobUUID != job.UUID() || log.Scope.EnvUUID == "" {
+		t.Errorf("expected the log to be scoped to the job, got %+v", log.Scope)
+	}
+
+	if log.Scope.Fields["order_id"] != float64(42) || log.Scope.Fields["region"] != "ca" {
+		t.Errorf("expected the log's fields, got %v", log.Scope.Fields)
+	}
+}
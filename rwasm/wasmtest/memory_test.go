@@ -0,0 +1,55 @@
+package wasmtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestMaxMemory(t *testing.T) {
+	r := rt.New()
+
+	doWasm := r.Register("as-echo-limited", rwasm.NewRunner("../testdata/as-echo/as-echo.wasm", rwasm.WithMaxMemory(1024*1024)))
+
+	res, err := doWasm("from AssemblyScript!").Then()
+	if err != nil {
+		t.Error(errors.Wrap(err, "failed to Then"))
+		return
+	}
+
+	if string(res.([]byte)) != "hello, from AssemblyScript!" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+
+	// the input alone is larger than the limit, so the instance cannot grow enough to hold it
+	if _, err := doWasm(strings.Repeat("a", 2*1024*1024)).Then(); err == nil {
+		t.Error("expected error, did not get one")
+	}
+}
+
+func TestOutOfBoundsResult(t *testing.T) {
+	r := rt.New()
+
+	// return_result is called with a result that runs past the end of the module's single page of memory
+	module := runnableModule(
+		[]funcImport{returnResultImport},
+		nil,
+		code(i32Const(65530), i32Const(100), localGet(2), call(0)),
+	)
+
+	doWasm := r.Register("out-of-bounds", rwasm.NewRunnerWithRef(moduleref.RefWithData("out-of-bounds", "", module)))
+
+	_, err := doWasm(nil).Then()
+	if err == nil {
+		t.Fatal("expected error, did not get one")
+	}
+
+	runErr := &rt.RunErr{}
+	if !errors.As(err, runErr) || runErr.Code != 500 || !strings.Contains(runErr.Message, "out of bounds") {
+		t.Error("expected out of bounds RunErr, got", err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package wasmtest
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rprom"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestMetricCounterAdd(t *testing.T) {
+	name := []byte("orders_total")
+	labels := []byte(`{"region":"ca"}`)
+
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint64(value, math.Float64bits(1.5))
+
+	// adds 1.5 to the orders_total counter
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "metric_counter_add", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(0), i32Const(int32(len(name))), i32Const(32), i32Const(64), i32Const(int32(len(labels))), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(0), localGet(2), call(1),
+		),
+		dataSegment{offset: 0, data: name},
+		dataSegment{offset: 32, data: value},
+		dataSegment{offset: 64, data: labels},
+	)
+
+	registry := prometheus.NewRegistry()
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Metrics = &rcap.MetricsConfig{Enabled: true, Sink: rprom.NewRunnableMetrics(registry, "")}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("checkout", rwasm.NewRunnerWithRef(moduleref.RefWithData("checkout", "", module)), rt.CapabilitiesFromConfig(config))
+
+	for i := 0; i < 2; i++ {
+		if _, err := r.Do(rt.NewJob("checkout", "")).Then(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+	}
+
+	expected := `
+# HELP orders_total Counter recorded by a Runnable
+# TYPE orders_total counter
+orders_total{job_type="checkout",region="ca"} 3
+`
+
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
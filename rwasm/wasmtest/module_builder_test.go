@@ -0,0 +1,291 @@
+package wasmtest
+
+// testModule assembles small Wasm modules for tests that need guest behaviour the testdata Runnables don't have
+type testModule struct {
+	types   []funcType
+	imports []funcImport
+	funcs   []testFunc
+	exports []funcExport
+	globals []int32
+	data    []dataSegment
+
+	// sharedMemory imports the memory from env as a shared memory, as modules built for wasi-threads do
+	sharedMemory bool
+}
+
+type funcType struct {
+	params  []byte
+	results []byte
+}
+
+type funcImport struct {
+	module string
+	name   string
+	typ    int
+}
+
+type testFunc struct {
+	typ    int
+	locals []byte
+	body   []byte
+}
+
+type funcExport struct {
+	name string
+	fn   int
+}
+
+type dataSegment struct {
+	offset int32
+	data   []byte
+}
+
+// value types and common instructions
+const (
+	i32 = 0x7f
+	i64 = 0x7e
+
+	opUnreachable = 0x00
+	opIf          = 0x04
+	opEnd         = 0x0b
+	opCall        = 0x10
+	opDrop        = 0x1a
+	opLocalGet    = 0x20
+	opGlobalGet   = 0x23
+	opGlobalSet   = 0x24
+	opI32Load     = 0x28
+	opI32Load8    = 0x2d
+	opI32Store    = 0x36
+	opI32Store8   = 0x3a
+	opI32Const    = 0x41
+	opI64Const    = 0x42
+	opI32Add      = 0x6a
+	opI32Sub      = 0x6b
+)
+
+// runnableModule returns a module with the Runnable API's allocate and deallocate exports,
+// whose run_e export has the given body and can call the given imports
+func runnableModule(imports []funcImport, types []funcType, runBody []byte, data ...dataSegment) []byte {
+	return runnableTestModule(imports, types, runBody, data...).bytes()
+}
+
+// messageModule returns a runnableModule that also exports on_message with the given body, which receives
+// the message type's pointer and size as locals 0 and 1, the data's pointer and size as 2 and 3, and the ident as 4
+func messageModule(imports []funcImport, types []funcType, runBody, onMessageBody []byte, data ...dataSegment) []byte {
+	m := runnableTestModule(imports, types, runBody, data...)
+
+	m.types = append(m.types, funcType{params: []byte{i32, i32, i32, i32, i32}})
+	m.funcs = append(m.funcs, testFunc{typ: len(m.types) - 1, body: onMessageBody})
+	m.exports = append(m.exports, funcExport{name: "on_message", fn: len(imports) + len(m.funcs) - 1})
+
+	return m.bytes()
+}
+
+func runnableTestModule(imports []funcImport, types []funcType, runBody []byte, data ...dataSegment) testModule {
+	m := testModule{
+		types: append([]funcType{
+			{params: []byte{i32}, results: []byte{i32}},
+			{params: []byte{i32, i32}},
+			{params: []byte{i32, i32, i32}},
+		}, types...),
+		imports: imports,
+		data:    data,
+	}
+
+	base := len(imports)
+
+	m.funcs = []testFunc{
+		// allocate always returns the same region, which is enough for one job at a time
+		{typ: 0, body: append([]byte{opI32Const}, sleb(4096)...)},
+		{typ: 1},
+		{typ: 2, body: runBody},
+	}
+
+	m.exports = []funcExport{
+		{name: "allocate", fn: base},
+		{name: "deallocate", fn: base + 1},
+		{name: "run_e", fn: base + 2},
+	}
+
+	return m
+}
+
+func (m testModule) bytes() []byte {
+	out := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+	types := uleb(uint32(len(m.types)))
+	for _, t := range m.types {
+		types = append(types, 0x60)
+		types = append(types, vec(t.params)...)
+		types = append(types, vec(t.results)...)
+	}
+
+	out = section(out, 1, types)
+
+	if len(m.imports) > 0 || m.sharedMemory {
+		count := len(m.imports)
+		if m.sharedMemory {
+			count++
+		}
+
+		imports := uleb(uint32(count))
+		for _, imp := range m.imports {
+			imports = append(imports, name(imp.module)...)
+			imports = append(imports, name(imp.name)...)
+			imports = append(imports, 0x00)
+			imports = append(imports, uleb(uint32(imp.typ))...)
+		}
+
+		// one shared page of memory
+		if m.sharedMemory {
+			imports = append(imports, name("env")...)
+			imports = append(imports, name("memory")...)
+			imports = append(imports, 0x02, 0x03, 0x01, 0x01)
+		}
+
+		out = section(out, 2, imports)
+	}
+
+	funcs := uleb(uint32(len(m.funcs)))
+	for _, f := range m.funcs {
+		funcs = append(funcs, uleb(uint32(f.typ))...)
+	}
+
+	out = section(out, 3, funcs)
+
+	// one page of memory
+	if !m.sharedMemory {
+		out = section(out, 5, []byte{0x01, 0x00, 0x01})
+	}
+
+	// globals are mutable i32s with the given initial values
+	if len(m.globals) > 0 {
+		globals := uleb(uint32(len(m.globals)))
+		for _, g := range m.globals {
+			globals = append(globals, i32, 0x01)
+			globals = append(globals, i32Const(g)...)
+			globals = append(globals, 0x0b)
+		}
+
+		out = section(out, 6, globals)
+	}
+
+	exports := uleb(uint32(len(m.exports) + 1))
+	exports = append(exports, name("memory")...)
+	exports = append(exports, 0x02, 0x00)
+	for _, e := range m.exports {
+		exports = append(exports, name(e.name)...)
+		exports = append(exports, 0x00)
+		exports = append(exports, uleb(uint32(e.fn))...)
+	}
+
+	out = section(out, 7, exports)
+
+	code := uleb(uint32(len(m.funcs)))
+	for _, f := range m.funcs {
+		body := uleb(uint32(len(f.locals)))
+		for _, l := range f.locals {
+			body = append(body, 0x01, l)
+		}
+
+		body = append(body, f.body...)
+		body = append(body, 0x0b)
+
+		code = append(code, uleb(uint32(len(body)))...)
+		code = append(code, body...)
+	}
+
+	out = section(out, 10, code)
+
+	if len(m.data) > 0 {
+		data := uleb(uint32(len(m.data)))
+		for _, d := range m.data {
+			data = append(data, 0x00, opI32Const)
+			data = append(data, sleb(int64(d.offset))...)
+			data = append(data, 0x0b)
+			data = append(data, vec(d.data)...)
+		}
+
+		out = section(out, 11, data)
+	}
+
+	return out
+}
+
+func section(out []byte, id byte, contents []byte) []byte {
+	out = append(out, id)
+	out = append(out, uleb(uint32(len(contents)))...)
+
+	return append(out, contents...)
+}
+
+func vec(b []byte) []byte {
+	return append(uleb(uint32(len(b))), b...)
+}
+
+func name(s string) []byte {
+	return vec([]byte(s))
+}
+
+func uleb(v uint32) []byte {
+	out := []byte{}
+
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+
+		if v == 0 {
+			return append(out, b)
+		}
+
+		out = append(out, b|0x80)
+	}
+}
+
+func sleb(v int64) []byte {
+	out := []byte{}
+
+	for {
+		b := byte(v & 0x7f)
+		v >>= 7
+
+		if (v == 0 && b&0x40 == 0) || (v == -1 && b&0x40 != 0) {
+			return append(out, b)
+		}
+
+		out = append(out, b|0x80)
+	}
+}
+
+// i32Const and the other helpers below encode single instructions
+func i32Const(v int32) []byte {
+	return append([]byte{opI32Const}, sleb(int64(v))...)
+}
+
+func i64Const(v int64) []byte {
+	return append([]byte{opI64Const}, sleb(v)...)
+}
+
+func localGet(idx int) []byte {
+	return append([]byte{opLocalGet}, uleb(uint32(idx))...)
+}
+
+func call(fn int) []byte {
+	return append([]byte{opCall}, uleb(uint32(fn))...)
+}
+
+func i32Load(addr int32) []byte {
+	return append(i32Const(addr), opI32Load, 0x02, 0x00)
+}
+
+func code(instrs ...[]byte) []byte {
+	out := []byte{}
+	for _, i := range instrs {
+		out = append(out, i...)
+	}
+
+	return out
+}
+
+// returnResultImport is the Runnable API function used to return a job's result
+var returnResultImport = funcImport{module: "env", name: "return_result", typ: 2}
@@ -0,0 +1,88 @@
+package wasmtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestOAuth2Requests(t *testing.T) {
+	tokens := int32(0)
+
+	authServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&tokens, 1)
+
+		if id, secret, _ := r.BasicAuth(); id != "reactr" || secret != "s3cret" {
+			http.Error(w, "invalid client", http.StatusUnauthorized)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "t0ken", "token_type": "Bearer", "expires_in": 3600})
+	}))
+	defer authServer.Close()
+
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer apiServer.Close()
+
+	apiURL, _ := url.Parse(apiServer.URL)
+
+	// GETs the URL it's given with fetch_url and returns the response body
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "fetch_url", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(1), localGet(0), localGet(1), i32Const(0), i32Const(0), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.OAuth2 = &rcap.OAuth2Config{
+		Enabled: true,
+		Clients: []rcap.OAuth2ClientConfig{
+			{
+				Domains:      []string{apiURL.Hostname()},
+				TokenURL:     authServer.URL,
+				ClientID:     "reactr",
+				ClientSecret: "s3cret",
+			},
+		},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("oauth2", rwasm.NewRunnerWithRef(moduleref.RefWithData("oauth2", "", module)), rt.CapabilitiesFromConfig(config))
+
+	for i := 0; i < 2; i++ {
+		res, err := r.Do(rt.NewJob("oauth2", apiServer.URL)).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		if string(res.([]byte)) != "Bearer t0ken" {
+			t.Errorf("expected the OAuth2 token to be sent, got %q", res.([]byte))
+		}
+	}
+
+	if atomic.LoadInt32(&tokens) != 1 {
+		t.Errorf("expected one token request, got %d", tokens)
+	}
+}
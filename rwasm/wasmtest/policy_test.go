@@ -0,0 +1,185 @@
+package wasmtest
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestHostFnPolicy(t *testing.T) {
+	// calls sleep_ms(0) and returns its return value as a byte
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "sleep_ms", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(100), i32Const(0), localGet(2), call(0), []byte{opI32Store8, 0x00, 0x00},
+			i32Const(100), i32Const(1), localGet(2), call(1),
+		),
+	)
+
+	r := rt.New()
+
+	for _, tc := range []struct {
+		name   string
+		rules  rcap.PolicyRules
+		result byte
+	}{
+		{"unrestricted", rcap.PolicyRules{}, 0},
+		{"allowed", rcap.PolicyRules{AllowedHostFns: []string{"sleep_ms", "return_*"}}, 0},
+		{"denied", rcap.PolicyRules{DeniedHostFns: []string{"sleep_*"}}, 0x9c},
+		{"not-allowed", rcap.PolicyRules{AllowedHostFns: []string{"return_result"}}, 0x9c},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := rcap.DefaultCapabilityConfig()
+			config.Policy = &rcap.PolicyConfig{Enabled: true, Rules: tc.rules}
+
+			jobType := "policy-" + tc.name
+
+			r.RegisterWithCaps(jobType, rwasm.NewRunnerWithRef(moduleref.RefWithData(jobType, "", module)), rt.CapabilitiesFromConfig(config))
+
+			res, err := r.Do(rt.NewJob(jobType, nil)).Then()
+			if err != nil {
+				t.Fatal(errors.Wrap(err, "failed to Then"))
+			}
+
+			// PermissionDenied is -100, which is 0x9c as a byte
+			if !bytes.Equal(res.([]byte), []byte{tc.result}) {
+				t.Errorf("expected %v, got %v", []byte{tc.result}, res.([]byte))
+			}
+		})
+	}
+}
+
+func TestHostFnLimits(t *testing.T) {
+	store8 := []byte{opI32Store8, 0x00, 0x00}
+
+	// calls sleep_ms(0) three times and sets a 6 byte value in the cache twice, and returns each call's return value as a byte
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "sleep_ms", typ: 3},
+			{module: "env", name: "cache_set", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32}, results: []byte{i32}},
+			{params: []byte{i32, i32, i32, i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(100), i32Const(0), localGet(2), call(0), store8,
+			i32Const(101), i32Const(0), localGet(2), call(0), store8,
+			i32Const(102), i32Const(0), localGet(2), call(0), store8,
+			i32Const(103), i32Const(0), i32Const(3), i32Const(3), i32Const(6), i32Const(0), localGet(2), call(1), store8,
+			i32Const(104), i32Const(0), i32Const(3), i32Const(3), i32Const(6), i32Const(0), localGet(2), call(1), store8,
+			i32Const(100), i32Const(5), localGet(2), call(2),
+		),
+		dataSegment{offset: 0, data: []byte("keyvalue!")},
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Limits = &rcap.LimitsConfig{
+		Enabled: true,
+		Limits: []rcap.HostFnLimit{
+			{HostFns: []string{"sleep_*"}, MaxCalls: 2, PeriodSeconds: 60},
+			{HostFns: []string{"cache_set"}, MaxBytes: 10, PeriodSeconds: 60},
+		},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("limits", rwasm.NewRunnerWithRef(moduleref.RefWithData("limits", "", module)), rt.CapabilitiesFromConfig(config))
+
+	res, err := r.Do(rt.NewJob("limits", nil)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	// LimitExceeded is -101, which is 0x9b as a byte
+	if !bytes.Equal(res.([]byte), []byte{0, 0, 0x9b, 0, 0x9b}) {
+		t.Errorf("expected the third sleep and second cache write to be limited, got %v", res.([]byte))
+	}
+}
+
+type testAuditSink struct {
+	events []rcap.AuditEvent
+	lock   sync.Mutex
+}
+
+func (t *testAuditSink) Record(event rcap.AuditEvent) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.events = append(t.events, event)
+}
+
+func TestHostFnAudit(t *testing.T) {
+	// calls sleep_ms(0) and sleep_ms(-5), which fails, and returns an empty result
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "sleep_ms", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(0), localGet(2), call(0), []byte{opDrop},
+			i32Const(-5), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(0), localGet(2), call(1),
+		),
+	)
+
+	sink := &testAuditSink{}
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Audit = &rcap.AuditConfig{Enabled: true, Sink: sink}
+
+	r := rt.New()
+
+	// events are recorded with the tenant that the Runnable finds for each job
+	r.RegisterWithCaps("audit", rwasm.NewRunnerWithRef(moduleref.RefWithData("audit", "", module)), rt.CapabilitiesFromConfig(config), rt.TenantCaps(rt.TenantFromMeta("tenant"), nil))
+
+	if _, err := r.Do(rt.NewJob("audit", nil).WithMeta("tenant", "acme")).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if len(sink.events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(sink.events))
+	}
+
+	expected := []struct {
+		hostFn  string
+		outcome string
+		result  int32
+	}{
+		{"sleep_ms", rcap.AuditOutcomeOK, 0},
+		{"sleep_ms", rcap.AuditOutcomeFailed, -2},
+		{"return_result", rcap.AuditOutcomeOK, 0},
+	}
+
+	for i, e := range expected {
+		event := sink.events[i]
+
+		if event.HostFn != e.hostFn || event.Outcome != e.outcome || event.Result != e.result {
+			t.Errorf("expected event %d to be %s %s %d, got %s %s %d", i, e.hostFn, e.outcome, e.result, event.HostFn, event.Outcome, event.Result)
+		}
+
+		if event.JobType != "audit" || event.Tenant != "acme" {
+			t.Errorf("expected event %d to be for jobType audit and tenant acme, got %s and %s", i, event.JobType, event.Tenant)
+		}
+	}
+
+	if len(sink.events[1].Args) != 1 || sink.events[1].Args[0] != -5 {
+		t.Errorf("expected args [-5], got %v", sink.events[1].Args)
+	}
+}
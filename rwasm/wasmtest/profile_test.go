@@ -0,0 +1,72 @@
+package wasmtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// workModule's run_e calls its exported work function, which does nothing
+var workModule = testModule{
+	types: []funcType{
+		{params: []byte{i32}, results: []byte{i32}},
+		{params: []byte{i32, i32}},
+		{params: []byte{i32, i32, i32}},
+		{},
+	},
+	funcs: []testFunc{
+		{typ: 0, body: i32Const(4096)},
+		{typ: 1},
+		{typ: 2, body: call(3)},
+		{typ: 3},
+	},
+	exports: []funcExport{
+		{name: "allocate", fn: 0},
+		{name: "deallocate", fn: 1},
+		{name: "run_e", fn: 2},
+		{name: "work", fn: 3},
+	},
+}.bytes()
+
+func TestRunnerProfile(t *testing.T) {
+	r := rt.New()
+
+	runner := rwasm.NewRunnerWithRef(moduleref.RefWithData("profile", "", workModule), rwasm.WithProfiling(1))
+
+	doWasm := r.Register("profile", runner)
+
+	for i := 0; i < 3; i++ {
+		if _, err := doWasm(nil).Then(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+	}
+
+	run := profileSample(runner.Profile(), "run_e")
+	if run == nil || run.Calls != 3 {
+		t.Error("expected 3 calls of run_e, got", run)
+	}
+}
+
+func TestRunnerWithoutProfiling(t *testing.T) {
+	runner := rwasm.NewRunnerWithRef(moduleref.RefWithData("profile", "", workModule))
+
+	if runner.Profile() != nil {
+		t.Error("expected no profile")
+	}
+}
+
+// profileSample finds the sample for a stack, given as function names separated by semicolons
+func profileSample(p *runtime.Profile, stack string) *runtime.ProfileSample {
+	for _, s := range p.Samples() {
+		if strings.Join(s.Stack, ";") == stack {
+			return &s
+		}
+	}
+
+	return nil
+}
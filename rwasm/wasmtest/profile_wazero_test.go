@@ -0,0 +1,35 @@
+//go:build wazero
+// +build wazero
+
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestRunnerProfileFunctions(t *testing.T) {
+	r := rt.New()
+
+	runner := rwasm.NewRunnerWithRef(moduleref.RefWithData("profile-functions", "", workModule), rwasm.WithProfiling(1))
+
+	doWasm := r.Register("profile-functions", runner)
+
+	if _, err := doWasm(nil).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	// wazero records each guest function, including the ones called by run_e
+	work := profileSample(runner.Profile(), "run_e;work")
+	if work == nil || work.Calls != 1 {
+		t.Error("expected 1 call of work from run_e, got", work)
+	}
+
+	if profileSample(runner.Profile(), "allocate") == nil {
+		t.Error("expected calls to allocate to be recorded")
+	}
+}
@@ -0,0 +1,111 @@
+package wasmtest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestRandomBytes(t *testing.T) {
+	// fills 32 bytes of memory with random bytes and returns them
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "random_bytes", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			i32Const(0), i32Const(32), localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(32), localGet(2), call(1),
+		),
+	)
+
+	r := rt.New()
+
+	r.Register("random", rwasm.NewRunnerWithRef(moduleref.RefWithData("random", "", module)))
+
+	results := [][]byte{}
+
+	for i := 0; i < 2; i++ {
+		res, err := r.Do(rt.NewJob("random", "")).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		results = append(results, res.([]byte))
+	}
+
+	if len(results[0]) != 32 || bytes.Equal(results[0], make([]byte, 32)) {
+		t.Errorf("expected 32 random bytes, got %x", results[0])
+	}
+
+	if bytes.Equal(results[0], results[1]) {
+		t.Error("expected each job to get different bytes")
+	}
+}
+
+func TestIDNew(t *testing.T) {
+	// generates an ID of the kind given by the job's input ('1' to '3') and returns it
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "id_new", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			localGet(0), []byte{opI32Load8, 0, 0}, i32Const('0'), []byte{opI32Sub},
+			localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Clock = &rcap.ClockConfig{Enabled: true, Clock: rcap.NewFrozenClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("id", rwasm.NewRunnerWithRef(moduleref.RefWithData("id", "", module)), rt.CapabilitiesFromConfig(config))
+
+	newID := func(kind string) string {
+		res, err := r.Do(rt.NewJob("id", kind)).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		return string(res.([]byte))
+	}
+
+	v4 := newID("1")
+	if parsed, err := uuid.Parse(v4); err != nil || parsed.Version() != 4 {
+		t.Errorf("expected a v4 UUID, got %q", v4)
+	}
+
+	if newID("1") == v4 {
+		t.Error("expected each UUID to be different")
+	}
+
+	// time-ordered IDs start with the clock's time in milliseconds
+	v7 := newID("2")
+	if parsed, err := uuid.Parse(v7); err != nil || parsed.Version() != 7 || !strings.HasPrefix(v7, "0176bb3e-7000-7") {
+		t.Errorf("expected a v7 UUID from the frozen time, got %q", v7)
+	}
+
+	ulid := newID("3")
+	if len(ulid) != 26 || !strings.HasPrefix(ulid, "01ETXKWW00") {
+		t.Errorf("expected a ULID from the frozen time, got %q", ulid)
+	}
+}
@@ -0,0 +1,65 @@
+package wasmtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// testRedis returns each command it's given, joined with spaces, as its result
+type testRedis struct{}
+
+func (testRedis) Do(ctx context.Context, commands [][]string) ([]rcap.RedisResult, error) {
+	results := make([]rcap.RedisResult, len(commands))
+	for i, command := range commands {
+		results[i] = rcap.RedisResult{Value: strings.Join(command, " ")}
+	}
+
+	return results, nil
+}
+
+func TestRedisCommand(t *testing.T) {
+	// runs the job's input with redis_command and returns the FFI result
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "redis_command", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop}, localGet(2), call(1), localGet(2), call(2)),
+	)
+
+	r := rt.New()
+
+	caps := rt.DefaultCapabilities(nil)
+	caps.Redis = testRedis{}
+
+	r.RegisterWithCaps("redis", rwasm.NewRunnerWithRef(moduleref.RefWithData("redis", "", module)), caps)
+
+	for _, tc := range []struct {
+		commands string
+		expected string
+	}{
+		{`["INCR", "visits"]`, `[{"value":"INCR visits"}]`},
+		{`[["SET", "name", "alice", "EX", 60], ["GET", "name"]]`, `[{"value":"SET name alice EX 60"},{"value":"GET name"}]`},
+	} {
+		res, err := r.Do(rt.NewJob("redis", []byte(tc.commands))).Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		if string(res.([]byte)) != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, res.([]byte))
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+)
+
+func TestReloadRunner(t *testing.T) {
+	r := rt.New()
+
+	doWasm := r.Register("as-echo-reload", rwasm.NewRunner("../testdata/as-echo/as-echo.wasm"), rt.PoolSize(2))
+
+	if _, err := doWasm("before").Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if err := r.Reload("as-echo-reload", rwasm.NewRunner("../testdata/as-echo/as-echo.wasm")); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Reload"))
+	}
+
+	res, err := doWasm("after").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, after" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+}
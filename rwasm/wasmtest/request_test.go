@@ -0,0 +1,129 @@
+package wasmtest
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/request"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestRequestGetInfo(t *testing.T) {
+	// returns the info of the request that the job is handling
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "request_get_info", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+	)
+
+	r := rt.New()
+
+	r.Register("request", rwasm.NewRunnerWithRef(moduleref.RefWithData("request", "", module)))
+
+	req := &request.CoordinatedRequest{
+		Method:  "POST",
+		URL:     "/orders/42?expand=items&expand=customer",
+		ID:      "abc123",
+		Body:    []byte(`{"hello":"world"}`),
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Params:  map[string]string{"id": "42"},
+	}
+
+	reqJSON, err := req.ToJSON()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ToJSON"))
+	}
+
+	res, err := r.Do(rt.NewJob("request", reqJSON)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	resp := &request.CoordinatedResponse{}
+	if err := json.Unmarshal(res.([]byte), resp); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Unmarshal response"))
+	}
+
+	info := rcap.RequestInfo{}
+	if err := json.Unmarshal(resp.Output, &info); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Unmarshal info"))
+	}
+
+	if info.Method != "POST" || info.Path != "/orders/42" || info.ID != "abc123" {
+		t.Errorf("unexpected request info %+v", info)
+	}
+
+	if len(info.Query["expand"]) != 2 || info.Query["expand"][1] != "customer" {
+		t.Errorf("expected both expand query parameters, got %v", info.Query)
+	}
+
+	if info.Headers["Content-Type"] != "application/json" || info.Params["id"] != "42" {
+		t.Errorf("expected the request's headers and params, got %v and %v", info.Headers, info.Params)
+	}
+}
+
+func TestRespWriteChunk(t *testing.T) {
+	// streams the job's input twice before returning it as the result
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "resp_write_chunk", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+		},
+		code(
+			localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			localGet(0), localGet(1), localGet(2), call(1),
+		),
+	)
+
+	r := rt.New()
+
+	r.Register("stream", rwasm.NewRunnerWithRef(moduleref.RefWithData("stream", "", module)))
+
+	recorder := httptest.NewRecorder()
+
+	res, err := r.Do(rt.NewJob("stream", "data: hello\n\n").WithStream(recorder)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if recorder.Body.String() != "data: hello\n\ndata: hello\n\n" {
+		t.Errorf("expected two chunks to be streamed, got %q", recorder.Body.String())
+	}
+
+	if !recorder.Flushed {
+		t.Error("expected the stream to be flushed")
+	}
+
+	if string(res.([]byte)) != "data: hello\n\n" {
+		t.Errorf("expected the result to be returned as well, got %q", res.([]byte))
+	}
+
+	// a job that isn't streaming still returns its result
+	res, err = r.Do(rt.NewJob("stream", "hello")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello" {
+		t.Errorf("expected 'hello', got %q", res.([]byte))
+	}
+}
@@ -0,0 +1,62 @@
+package wasmtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestSecretGet(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(dir, "db"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "db", "password"), []byte("hunter2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// reads the secret named by the job's input and returns it
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "secret_get", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Secrets = &rcap.SecretsConfig{
+		Enabled: true,
+		Rules:   rcap.SecretsRules{AllowedSecrets: []string{"db/*"}},
+		Files:   &rcap.FileSecretsConfig{Directory: dir},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("secret", rwasm.NewRunnerWithRef(moduleref.RefWithData("secret", "", module)), rt.CapabilitiesFromConfig(config))
+
+	res, err := r.Do(rt.NewJob("secret", "db/password")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hunter2" {
+		t.Errorf("expected 'hunter2', got %q", res.([]byte))
+	}
+}
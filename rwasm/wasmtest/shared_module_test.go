@@ -0,0 +1,53 @@
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+)
+
+func TestSharedModuleRunners(t *testing.T) {
+	r := rt.New()
+
+	first := rwasm.NewRunner("../testdata/as-echo/as-echo.wasm")
+	second := rwasm.NewRunner("../testdata/as-echo/as-echo.wasm")
+
+	doFirst := r.Register("as-echo-shared-1", first)
+	doSecond := r.Register("as-echo-shared-2", second)
+
+	for _, do := range []rt.JobFunc{doFirst, doSecond} {
+		if _, err := do("shared").Then(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+	}
+
+	// the module is shared, so unloading one Runner must not affect the other
+	if err := r.DeRegister("as-echo-shared-1"); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to DeRegister"))
+	}
+
+	first.Close()
+
+	// a new instance is created from the shared module for each job
+	r.Register("as-echo-shared-3", rwasm.NewRunner("../testdata/as-echo/as-echo.wasm"), rt.PoolSize(2))
+
+	res, err := doSecond("after").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, after" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+
+	res, err = r.Do(r.Job("as-echo-shared-3", "third")).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, third" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+}
@@ -0,0 +1,48 @@
+package wasmtest
+
+import (
+	"crypto/ed25519"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestSignedModule(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to GenerateKey"))
+	}
+
+	module, err := os.ReadFile("../testdata/as-echo/as-echo.wasm")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ReadFile"))
+	}
+
+	signed := moduleref.RefWithData("as-echo", "", module)
+	signed.Signature = ed25519.Sign(private, module)
+
+	unsigned := moduleref.RefWithData("as-echo", "", module)
+
+	r := rt.New()
+
+	doSigned := r.Register("as-echo-signed", rwasm.NewRunnerWithRef(signed, rwasm.WithTrustedKeys(public)))
+	doUnsigned := r.Register("as-echo-unsigned", rwasm.NewRunnerWithRef(unsigned, rwasm.WithTrustedKeys(public)), rt.RetrySeconds(0), rt.MaxRetries(0))
+
+	res, err := doSigned("signed").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, signed" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+
+	// the unsigned module is rejected before it is compiled, so its instances can't be created
+	if _, err := doUnsigned("unsigned").Then(); !errors.Is(err, moduleref.ErrModuleUnsigned) {
+		t.Error("expected ErrModuleUnsigned, got", err)
+	}
+}
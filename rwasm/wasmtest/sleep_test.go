@@ -0,0 +1,78 @@
+package wasmtest
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestSleepMS(t *testing.T) {
+	// sleeps for the number of milliseconds in the job's input
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "sleep_ms", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32}, results: []byte{i32}},
+		},
+		code(
+			localGet(0), []byte{opI32Load, 0x02, 0x00}, localGet(2), call(0), []byte{opDrop},
+			i32Const(0), i32Const(0), localGet(2), call(1),
+		),
+	)
+
+	r := rt.New()
+
+	doWasm := r.Register("sleep", rwasm.NewRunnerWithRef(moduleref.RefWithData("sleep", "", module)), rt.TimeoutSeconds(1))
+
+	duration := func(ms uint32) []byte {
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint32(b, ms)
+		return b
+	}
+
+	start := time.Now()
+
+	if _, err := doWasm(duration(50)).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the job to sleep for 50ms, took %s", elapsed)
+	}
+
+	// a sleep that would outlast the job's timeout is refused straight away, rather than holding on to the instance until the job times out
+	start = time.Now()
+
+	if _, err := doWasm(duration(30000)).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected the sleep to be refused, took %s", elapsed)
+	}
+
+	// a sleep longer than the Runner's maximum is refused rather than holding on to the instance
+	doLimited := r.Register("sleep-limited", rwasm.NewRunnerWithRef(moduleref.RefWithData("sleep-limited", "", module), rwasm.WithMaxSleep(10*time.Millisecond)))
+
+	// run a job first so that compiling the module isn't timed
+	if _, err := doLimited(duration(0)).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	start = time.Now()
+
+	if _, err := doLimited(duration(500)).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+		t.Errorf("expected the sleep to be refused, took %s", elapsed)
+	}
+}
@@ -0,0 +1,108 @@
+package wasmtest
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// initModule is a Runnable whose _start calls count_init, changes a byte of its memory, and stores the location
+// of the changed data in a global. run_e returns the data at that location, which is only correct once initialized.
+var initModule = testModule{
+	types: []funcType{
+		{params: []byte{i32}, results: []byte{i32}},
+		{params: []byte{i32, i32}},
+		{params: []byte{i32, i32, i32}},
+		{},
+	},
+	imports: []funcImport{
+		{module: "env", name: "count_init", typ: 3},
+		returnResultImport,
+	},
+	funcs: []testFunc{
+		{typ: 0, body: i32Const(4096)},
+		{typ: 1},
+		{typ: 2, body: code(
+			[]byte{opGlobalGet, 0x00}, i32Const(11),
+			localGet(2), call(1),
+		)},
+		{typ: 3, body: code(
+			call(0),
+			i32Const(100), i32Const('I'), []byte{opI32Store8, 0x00, 0x00},
+			i32Const(100), []byte{opGlobalSet, 0x00},
+		)},
+	},
+	exports: []funcExport{
+		{name: "allocate", fn: 2},
+		{name: "deallocate", fn: 3},
+		{name: "run_e", fn: 4},
+		{name: "_start", fn: 5},
+	},
+	globals: []int32{0},
+	data: []dataSegment{
+		{offset: 100, data: []byte("xnitialized")},
+	},
+}.bytes()
+
+func countInit(count *int32) runtime.HostFn {
+	return runtime.NewHostFn("count_init", 0, false, func(args ...interface{}) (interface{}, error) {
+		atomic.AddInt32(count, 1)
+
+		return nil, nil
+	})
+}
+
+func TestInitSnapshot(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts    []rwasm.Option
+		preWarm bool
+		inits   int32
+	}{
+		"snapshot":               {[]rwasm.Option{rwasm.WithInitSnapshot()}, false, 1},
+		"no snapshot":            {[]rwasm.Option{}, false, 3},
+		"pre-warmed snapshot":    {[]rwasm.Option{rwasm.WithInitSnapshot()}, true, 1},
+		"pre-warmed no snapshot": {[]rwasm.Option{}, true, 3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := rt.New()
+
+			count := int32(0)
+
+			ref := moduleref.RefWithData("init", "", initModule)
+			opts := append(tc.opts, rwasm.WithHostFns(countInit(&count)))
+
+			workerOpts := []rt.Option{rt.PoolSize(3)}
+			if tc.preWarm {
+				// the instances are built in parallel when the Runner is registered
+				workerOpts = append(workerOpts, rt.PreWarm())
+			}
+
+			doWasm := r.Register("init", rwasm.NewRunnerWithRef(ref, opts...), workerOpts...)
+
+			results := []*rt.Result{}
+			for i := 0; i < 9; i++ {
+				results = append(results, doWasm(nil))
+			}
+
+			for _, res := range results {
+				data, err := res.Then()
+				if err != nil {
+					t.Fatal(errors.Wrap(err, "failed to Then"))
+				}
+
+				if string(data.([]byte)) != "Initialized" {
+					t.Error("expected 'Initialized', got", string(data.([]byte)))
+				}
+			}
+
+			if inits := atomic.LoadInt32(&count); inits != tc.inits {
+				t.Errorf("expected %d inits, got %d", tc.inits, inits)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+func TestRunnerStats(t *testing.T) {
+	r := rt.New()
+
+	count := int32(0)
+
+	ref := moduleref.RefWithData("stats", "", initModule)
+	runner := rwasm.NewRunnerWithRef(ref, rwasm.WithHostFns(countInit(&count)))
+
+	doWasm := r.Register("stats", runner)
+
+	for i := 0; i < 3; i++ {
+		if _, err := doWasm(nil).Then(); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+	}
+
+	stats := runner.Stats()
+
+	if stats.Instances != 1 {
+		t.Error("expected 1 instance, got", stats.Instances)
+	}
+
+	if stats.Calls != 3 {
+		t.Error("expected 3 calls, got", stats.Calls)
+	}
+
+	if stats.Instantiations != 1 || stats.IdleInstances != 1 {
+		t.Error("expected 1 idle instance from 1 instantiation, got", stats.IdleInstances, stats.Instantiations)
+	}
+
+	if stats.MemoryBytes != runtime.WasmPageSize {
+		t.Error("expected one page of memory in use, got", stats.MemoryBytes)
+	}
+
+	if stats.HostCalls["return_result"] != 3 {
+		t.Error("expected 3 calls to return_result, got", stats.HostCalls["return_result"])
+	}
+
+	// the module has one page of memory
+	if stats.MemoryHighWaterBytes != runtime.WasmPageSize {
+		t.Error("expected memory high-water mark of one page, got", stats.MemoryHighWaterBytes)
+	}
+}
@@ -0,0 +1,60 @@
+package wasmtest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	name := []byte("receipt.txt")
+
+	// renders the receipt template with the job's input as its data
+	module := runnableModule(
+		[]funcImport{
+			{module: "env", name: "render_template", typ: 3},
+			{module: "env", name: "take_ffi_result", typ: 4},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+			{params: []byte{i32}, results: []byte{i32, i32}},
+		},
+		code(
+			i32Const(0), i32Const(int32(len(name))), localGet(0), localGet(1), localGet(2), call(0), []byte{opDrop},
+			localGet(2), call(1), localGet(2), call(2),
+		),
+		dataSegment{offset: 0, data: name},
+	)
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Templates = &rcap.TemplatesConfig{Enabled: true, Directory: "templates"}
+	config.File = &rcap.FileConfig{
+		Enabled: true,
+		FileFunc: func(name string) ([]byte, error) {
+			if name != "templates/receipt.txt" {
+				return nil, os.ErrNotExist
+			}
+
+			return []byte("Order {{.id}}: {{range .items}}{{.}} {{end}}"), nil
+		},
+	}
+
+	r := rt.New()
+
+	r.RegisterWithCaps("template", rwasm.NewRunnerWithRef(moduleref.RefWithData("template", "", module)), rt.CapabilitiesFromConfig(config))
+
+	res, err := r.Do(rt.NewJob("template", `{"id":42,"items":["tea","cake"]}`)).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "Order 42: tea cake " {
+		t.Errorf("expected 'Order 42: tea cake ', got %q", res.([]byte))
+	}
+}
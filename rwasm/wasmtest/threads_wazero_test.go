@@ -0,0 +1,88 @@
+//go:build wazero || !cgo
+// +build wazero !cgo
+
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// threadsModule imports a shared memory and spawns a thread that returns the job's result, which run_e
+// waits for. The thread then loops forever, so it has to be stopped when the job ends. If the thread
+// can't be spawned, run_e returns "none" instead.
+func threadsModule() []byte {
+	atomicStore := []byte{0xfe, 0x17, 0x02, 0x00}
+	atomicWait := []byte{0xfe, 0x01, 0x02, 0x00}
+	atomicNotify := []byte{0xfe, 0x00, 0x02, 0x00}
+
+	m := runnableTestModule(
+		[]funcImport{
+			{module: "wasi", name: "thread-spawn", typ: 0},
+			returnResultImport,
+		},
+		nil,
+		code(
+			// clear the flag the thread sets, and store the ident at 8 for the thread to use
+			i32Const(0), i32Const(0), atomicStore,
+			i32Const(8), localGet(2), []byte{opI32Store, 0x02, 0x00},
+			i32Const(8), call(0), i32Const(0), []byte{0x48, opIf, 0x40},
+			i32Const(110), i32Const(4), localGet(2), call(1),
+			[]byte{0x05},
+			i32Const(0), i32Const(0), i64Const(5e9), atomicWait, []byte{opDrop},
+			[]byte{opEnd},
+		),
+		dataSegment{offset: 100, data: []byte("thread")},
+		dataSegment{offset: 110, data: []byte("none")},
+	)
+
+	m.sharedMemory = true
+
+	// wasi_thread_start receives the thread ID and the argument passed to thread-spawn, which is where the ident is
+	m.funcs = append(m.funcs, testFunc{typ: 1, body: code(
+		i32Const(100), i32Const(6), localGet(1), []byte{opI32Load, 0x02, 0x00}, call(1),
+		i32Const(0), i32Const(1), atomicStore,
+		i32Const(0), i32Const(1), atomicNotify, []byte{opDrop},
+		[]byte{0x03, 0x40, 0x0c, 0x00, opEnd},
+	)})
+
+	m.exports = append(m.exports, funcExport{name: "wasi_thread_start", fn: 2 + len(m.funcs) - 1})
+
+	return m.bytes()
+}
+
+func TestGuestThreads(t *testing.T) {
+	r := rt.New()
+
+	module := threadsModule()
+
+	doThreads := r.Register("threads", rwasm.NewRunnerWithRef(moduleref.RefWithData("threads", "", module), rwasm.WithMaxGuestThreads(1)), rt.TimeoutSeconds(10))
+
+	// the second job can only spawn its thread if the first job's was stopped
+	for i := 0; i < 2; i++ {
+		res, err := doThreads(nil).Then()
+		if err != nil {
+			t.Fatal(errors.Wrapf(err, "failed to Then for job %d", i))
+		}
+
+		if string(res.([]byte)) != "thread" {
+			t.Errorf("expected job %d's result to be returned by its thread, got %s", i, string(res.([]byte)))
+		}
+	}
+
+	// guest threads are disabled by default
+	doDisabled := r.Register("threads-disabled", rwasm.NewRunnerWithRef(moduleref.RefWithData("threads-disabled", "", module)), rt.TimeoutSeconds(10))
+
+	res, err := doDisabled(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "none" {
+		t.Error("expected the thread not to be spawned, got", string(res.([]byte)))
+	}
+}
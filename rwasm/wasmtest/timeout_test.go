@@ -0,0 +1,55 @@
+//go:build wasmtime || wazero || !cgo
+// +build wasmtime wazero !cgo
+
+package wasmtest
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// loopModule is a minimal Runnable whose run_e loops forever when given any input, and returns immediately otherwise
+var loopModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i32) -> i32, (i32, i32) -> (), (i32, i32, i32) -> ()
+	0x01, 0x11, 0x03, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x00, 0x60, 0x03, 0x7f, 0x7f, 0x7f, 0x00,
+	// functions: allocate, deallocate, run_e
+	0x03, 0x04, 0x03, 0x00, 0x01, 0x02,
+	// memory: one page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// exports
+	0x07, 0x2a, 0x04,
+	0x06, 'm', 'e', 'm', 'o', 'r', 'y', 0x02, 0x00,
+	0x08, 'a', 'l', 'l', 'o', 'c', 'a', 't', 'e', 0x00, 0x00,
+	0x0a, 'd', 'e', 'a', 'l', 'l', 'o', 'c', 'a', 't', 'e', 0x00, 0x01,
+	0x05, 'r', 'u', 'n', '_', 'e', 0x00, 0x02,
+	// code
+	0x0a, 0x19, 0x03,
+	// allocate: return 1024
+	0x05, 0x00, 0x41, 0x80, 0x08, 0x0b,
+	// deallocate: do nothing
+	0x02, 0x00, 0x0b,
+	// run_e: if the input length is 0 return, otherwise loop forever
+	0x0e, 0x00, 0x20, 0x01, 0x45, 0x04, 0x40, 0x0f, 0x0b, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b,
+}
+
+func TestTimeoutInterruptsInstance(t *testing.T) {
+	r := rt.New()
+
+	ref := moduleref.RefWithData("loop", "", loopModule)
+
+	doWasm := r.Register("loop", rwasm.NewRunnerWithRef(ref), rt.TimeoutSeconds(1))
+
+	if _, err := doWasm("loop forever").Then(); !errors.Is(err, rt.ErrJobTimeout) {
+		t.Fatal("expected ErrJobTimeout, got", err)
+	}
+
+	// the interrupted instance should have been replaced, so another job can run
+	if _, err := doWasm("").Then(); err != nil {
+		t.Error(errors.Wrap(err, "failed to Then"))
+	}
+}
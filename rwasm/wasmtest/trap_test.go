@@ -0,0 +1,83 @@
+package wasmtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// trapModule's run_e calls its exported crash function, which executes unreachable
+var trapModule = testModule{
+	types: []funcType{
+		{params: []byte{i32}, results: []byte{i32}},
+		{params: []byte{i32, i32}},
+		{params: []byte{i32, i32, i32}},
+		{},
+	},
+	funcs: []testFunc{
+		{typ: 0, body: i32Const(4096)},
+		{typ: 1},
+		{typ: 2, body: call(3)},
+		{typ: 3, body: []byte{opUnreachable}},
+	},
+	exports: []funcExport{
+		{name: "allocate", fn: 0},
+		{name: "deallocate", fn: 1},
+		{name: "run_e", fn: 2},
+		{name: "crash", fn: 3},
+	},
+}.bytes()
+
+func TestTrapStackTrace(t *testing.T) {
+	r := rt.New()
+
+	runner := rwasm.NewRunnerWithRef(moduleref.RefWithData("trap", "", trapModule))
+
+	doWasm := r.Register("trap", runner)
+
+	_, err := doWasm(nil).Then()
+	if err == nil {
+		t.Fatal("expected error, did not get one")
+	}
+
+	if !errors.Is(err, rwasm.ErrGuestTrapped) {
+		t.Error("expected ErrGuestTrapped, got", err.Error())
+	}
+
+	runErr := &rt.RunErr{}
+	if !errors.As(err, runErr) {
+		t.Fatal("expected RunErr, got", err.Error())
+	}
+
+	if runErr.Code != 500 || !strings.Contains(runErr.Message, "trapped") {
+		t.Error("expected trap RunErr, got", runErr.Error())
+	}
+
+	// the innermost frame comes first
+	frames := strings.Split(runErr.Trace, "\n")
+	if len(frames) < 2 || !strings.HasPrefix(frames[0], "crash") || !strings.HasPrefix(frames[1], "run_e") {
+		t.Error("expected trace through crash and run_e, got", runErr.Trace)
+	}
+
+	if traps := runner.Stats().Traps; traps != 1 {
+		t.Error("expected 1 trap, got", traps)
+	}
+}
+
+func TestModuleInvalid(t *testing.T) {
+	r := rt.New()
+
+	// the module has a valid header, but its only section is cut off
+	truncated := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x01, 0x10, 0x00}
+
+	// building an instance fails every time, so there is no need to wait between retries
+	doWasm := r.Register("invalid", rwasm.NewRunnerWithRef(moduleref.RefWithData("invalid", "", truncated)), rt.RetrySeconds(0))
+
+	if _, err := doWasm(nil).Then(); !errors.Is(err, rwasm.ErrModuleInvalid) {
+		t.Error("expected ErrModuleInvalid, got", err)
+	}
+}
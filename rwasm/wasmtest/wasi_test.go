@@ -0,0 +1,207 @@
+package wasmtest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// readFileModule is a Runnable that uses WASI to read hello.txt from the first preopened directory.
+// Engines number preopened directories differently (Wasmer reserves fd 3 for its virtual root),
+// so like libc it tries the next fd if the first can't open the file
+var readFileModule = runnableModule(
+	[]funcImport{
+		{module: "wasi_snapshot_preview1", name: "path_open", typ: 3},
+		{module: "wasi_snapshot_preview1", name: "fd_read", typ: 4},
+		returnResultImport,
+	},
+	[]funcType{
+		{params: []byte{i32, i32, i32, i32, i32, i64, i64, i32, i32}, results: []byte{i32}},
+		{params: []byte{i32, i32, i32, i32}, results: []byte{i32}},
+	},
+	code(
+		// if path_open(3, 0, "hello.txt", 0, FD_READ, 0, 0, &fd) fails, try fd 4
+		openHello(3), []byte{opIf, 0x40}, openHello(4), []byte{opDrop, opEnd},
+		// fd_read(fd, iovec, 1, &nread)
+		i32Load(300), i32Const(200), i32Const(1), i32Const(304),
+		call(1), []byte{opDrop},
+		// return_result(buffer, nread, ident)
+		i32Const(1024), i32Load(304), localGet(2),
+		call(2),
+	),
+	dataSegment{offset: 100, data: []byte("hello.txt")},
+	// an iovec pointing to a 512 byte buffer at 1024
+	dataSegment{offset: 200, data: []byte{0x00, 0x04, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00}},
+)
+
+func openHello(fd int32) []byte {
+	return code(
+		i32Const(fd), i32Const(0), i32Const(100), i32Const(9), i32Const(0), i64Const(2), i64Const(0), i32Const(0), i32Const(300),
+		call(0),
+	)
+}
+
+func TestPreopenDir(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello from the host"), 0644); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to WriteFile"))
+	}
+
+	r := rt.New()
+
+	ref := moduleref.RefWithData("read-file", "", readFileModule)
+
+	doWasm := r.Register("read-file", rwasm.NewRunnerWithRef(ref, rwasm.WithPreopenDir(dir, "/data")))
+
+	res, err := doWasm(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello from the host" {
+		t.Error("expected 'hello from the host', got", string(res.([]byte)))
+	}
+}
+
+func TestPreopenDirMissing(t *testing.T) {
+	r := rt.New()
+
+	ref := moduleref.RefWithData("read-file", "", readFileModule)
+
+	doWasm := r.Register("read-file", rwasm.NewRunnerWithRef(ref, rwasm.WithPreopenDir("/does/not/exist", "/data")), rt.MaxRetries(0), rt.RetrySeconds(0))
+
+	if _, err := doWasm(nil).Then(); err == nil {
+		t.Error("expected error, did not get one")
+	}
+}
+
+// wasiStringsModule is a Runnable that returns the buffer filled by a WASI function pair such as
+// environ_sizes_get/environ_get, which holds each of the strings separated by null bytes
+func wasiStringsModule(kind string) []byte {
+	return runnableModule(
+		[]funcImport{
+			{module: "wasi_snapshot_preview1", name: kind + "_sizes_get", typ: 3},
+			{module: "wasi_snapshot_preview1", name: kind + "_get", typ: 3},
+			returnResultImport,
+		},
+		[]funcType{
+			{params: []byte{i32, i32}, results: []byte{i32}},
+		},
+		code(
+			// x_sizes_get(&count, &size)
+			i32Const(100), i32Const(104),
+			call(0), []byte{opDrop},
+			// x_get(pointers, buffer)
+			i32Const(200), i32Const(1024),
+			call(1), []byte{opDrop},
+			// return_result(buffer, size, ident)
+			i32Const(1024), i32Load(104), localGet(2),
+			call(2),
+		),
+	)
+}
+
+func TestWasiEnv(t *testing.T) {
+	r := rt.New()
+
+	ref := moduleref.RefWithData("wasi-env", "", wasiStringsModule("environ"))
+
+	doWasm := r.Register("wasi-env", rwasm.NewRunnerWithRef(ref, rwasm.WithEnv("GREETING", "hello"), rwasm.WithEnv("NAME", "reactr")))
+
+	res, err := doWasm(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "GREETING=hello\x00NAME=reactr\x00" {
+		t.Errorf("expected env to be set, got %q", string(res.([]byte)))
+	}
+}
+
+func TestWasiArgs(t *testing.T) {
+	r := rt.New()
+
+	ref := moduleref.RefWithData("wasi-args", "", wasiStringsModule("args"))
+
+	doWasm := r.Register("wasi-args", rwasm.NewRunnerWithRef(ref, rwasm.WithArgs("--verbose", "input.txt")))
+
+	res, err := doWasm(nil).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "wasi-args\x00--verbose\x00input.txt\x00" {
+		t.Errorf("expected args to be set, got %q", string(res.([]byte)))
+	}
+}
+
+// printModule is a Runnable that uses WASI to print a line to stdout and a partial line to stderr
+var printModule = runnableModule(
+	[]funcImport{
+		{module: "wasi_snapshot_preview1", name: "fd_write", typ: 3},
+	},
+	[]funcType{
+		{params: []byte{i32, i32, i32, i32}, results: []byte{i32}},
+	},
+	code(
+		// fd_write(1, stdout iovec, 1, &nwritten)
+		i32Const(1), i32Const(200), i32Const(1), i32Const(300),
+		call(0), []byte{opDrop},
+		// fd_write(2, stderr iovec, 1, &nwritten)
+		i32Const(2), i32Const(208), i32Const(1), i32Const(300),
+		call(0), []byte{opDrop},
+	),
+	dataSegment{offset: 100, data: []byte("hello from stdout\n")},
+	dataSegment{offset: 150, data: []byte("oops")},
+	// iovecs for each of the strings
+	dataSegment{offset: 200, data: []byte{100, 0x00, 0x00, 0x00, 18, 0x00, 0x00, 0x00, 150, 0x00, 0x00, 0x00, 4, 0x00, 0x00, 0x00}},
+)
+
+func TestWasiOutput(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "log")
+
+	runtime.UseInternalLogger(vlog.Default(vlog.ToFile(logFile), vlog.Level(vlog.LogLevelInfo)))
+	defer runtime.UseInternalLogger(vlog.Default())
+
+	r := rt.New()
+
+	ref := moduleref.RefWithData("print", "", printModule)
+
+	doWasm := r.Register("print", rwasm.NewRunnerWithRef(ref))
+
+	if _, err := doWasm(nil).Then(); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	// some runtimes copy the output in the background, so give it a moment to arrive
+	var logs string
+
+	for i := 0; i < 10; i++ {
+		data, _ := os.ReadFile(logFile)
+		logs = string(data)
+
+		if strings.Contains(logs, "oops") {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if !strings.Contains(logs, "jobType: print) stdout: hello from stdout") {
+		t.Error("expected stdout to be logged, got", logs)
+	}
+
+	if !strings.Contains(logs, "jobType: print) stderr: oops") {
+		t.Error("expected stderr to be logged, got", logs)
+	}
+}
@@ -0,0 +1,167 @@
+package wasmtest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+)
+
+func TestWatchModule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runnable.wasm")
+
+	echo, err := os.ReadFile("../testdata/as-echo/as-echo.wasm")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ReadFile"))
+	}
+
+	hello, err := os.ReadFile("../testdata/hello-echo/hello-echo.wasm")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to ReadFile"))
+	}
+
+	if err := os.WriteFile(path, echo, 0600); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to WriteFile"))
+	}
+
+	r := rt.New()
+
+	doWasm := r.Register("watched", rwasm.NewRunner(path))
+
+	stop, err := rwasm.Watch(r, "watched", path)
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Watch"))
+	}
+
+	defer stop()
+
+	res, err := doWasm("watched").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "hello, watched" {
+		t.Error("as-echo failed, got:", string(res.([]byte)))
+	}
+
+	// a module that is only partly written must not replace the one that works
+	if err := os.WriteFile(path, hello[:len(hello)/2], 0600); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to WriteFile"))
+	}
+
+	time.Sleep(rwasm.WatchInterval * 4)
+
+	res, err = doWasm("truncated").Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then after writing a truncated module"))
+	}
+
+	if string(res.([]byte)) != "hello, truncated" {
+		t.Error("expected the truncated module to be skipped, got:", string(res.([]byte)))
+	}
+
+	// replace the module with one that responds differently, and wait for it to be reloaded
+	if err := os.WriteFile(path, hello, 0600); err != nil {
+		t.Fatal(errors.Wrap(err, "failed to WriteFile"))
+	}
+
+	deadline := time.Now().Add(time.Minute * 3)
+
+	for {
+		res, err := doWasm("reloaded").Then()
+		if err != nil {
+			t.Fatal(errors.Wrap(err, "failed to Then"))
+		}
+
+		if string(res.([]byte)) == "hello reloaded" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("module was not reloaded, got:", string(res.([]byte)))
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+}
+
+// configValue returns the value of the configuration key it's given
+type configValue struct{}
+
+func (c configValue) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	return ctx.Configuration.Get(job.String())
+}
+
+func (c configValue) OnChange(change rt.ChangeEvent) error {
+	return nil
+}
+
+func TestWatchCaps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capabilities.yaml")
+
+	writeCaps := func(allowedKey string) {
+		config := "configuration:\n  enabled: true\n  rules:\n    allowedKeys: [" + allowedKey + "]\n"
+
+		if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+			t.Fatal(errors.Wrap(err, "failed to WriteFile"))
+		}
+	}
+
+	writeCaps("colour")
+
+	config := rcap.DefaultCapabilityConfig()
+	config.Configuration = &rcap.ConfigurationConfig{
+		Enabled: true,
+		Values:  map[string]string{"colour": "blue", "size": "large"},
+	}
+
+	r := rt.NewWithConfig(config)
+
+	doConfig := r.Register("config-value", configValue{})
+
+	stop, err := rwasm.WatchCaps(r, path, "config-value")
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to WatchCaps"))
+	}
+
+	defer stop()
+
+	if res, err := doConfig("colour").Then(); err != nil || res.(string) != "blue" {
+		t.Fatal("expected colour to be allowed, got", res, err)
+	}
+
+	if _, err := doConfig("size").Then(); err == nil {
+		t.Fatal("expected size to be disallowed")
+	}
+
+	// allow a different key, and wait for the capabilities to be updated
+	writeCaps("size")
+
+	deadline := time.Now().Add(time.Second * 10)
+
+	for {
+		res, err := doConfig("size").Then()
+		if err == nil && res.(string) == "large" {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("capabilities were not updated, got:", res, err)
+		}
+
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	if _, err := doConfig("colour").Then(); err == nil {
+		t.Error("expected colour to be disallowed")
+	}
+
+	if _, err := rwasm.WatchCaps(r, path, "nope"); err == nil {
+		t.Error("expected error for unregistered jobType, did not get one")
+	}
+}
@@ -0,0 +1,89 @@
+package wasmtest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+)
+
+// webSocketModule is a Runnable that connects to the WebSocket URL it's given, sends a message, and returns
+// the message it receives in reply. Handles are numbered from 1 in each job.
+var webSocketModule = runnableModule(
+	[]funcImport{
+		{module: "env", name: "ws_open", typ: 3},
+		{module: "env", name: "ws_send", typ: 3},
+		{module: "env", name: "ws_receive", typ: 4},
+		{module: "env", name: "take_ffi_result", typ: 5},
+		returnResultImport,
+	},
+	[]funcType{
+		{params: []byte{i32, i32, i32, i32, i32}, results: []byte{i32}},
+		{params: []byte{i32, i32}, results: []byte{i32}},
+		{params: []byte{i32}, results: []byte{i32, i32}},
+	},
+	code(
+		localGet(0), localGet(1), i32Const(0), i32Const(0), localGet(2), call(0), []byte{opDrop},
+		i32Const(1), i32Const(1), i32Const(0), i32Const(4), localGet(2), call(1), []byte{opDrop},
+		i32Const(1), localGet(2), call(2), []byte{opDrop},
+		localGet(2), call(3),
+		localGet(2), call(4),
+	),
+	dataSegment{offset: 0, data: []byte("ping")},
+)
+
+func TestWebSocket(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		conn.WriteMessage(websocket.TextMessage, append([]byte("pong: "), data...))
+	}))
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	r := rt.New()
+
+	doWasm := r.Register("websocket", rwasm.NewRunnerWithRef(moduleref.RefWithData("websocket", "", webSocketModule)))
+
+	res, err := doWasm(wsURL).Then()
+	if err != nil {
+		t.Fatal(errors.Wrap(err, "failed to Then"))
+	}
+
+	if string(res.([]byte)) != "pong: ping" {
+		t.Errorf("unexpected result, got: %q", string(res.([]byte)))
+	}
+
+	// connections to origins that aren't allowed are refused, so there is no message to return
+	config := rcap.DefaultCapabilityConfig()
+	config.WebSocket = &rcap.WebSocketConfig{
+		Enabled: true,
+		Rules:   rcap.WebSocketRules{AllowedOrigins: []string{"wss://stream.example.com"}},
+	}
+
+	r.RegisterWithCaps("websocket-refused", rwasm.NewRunnerWithRef(moduleref.RefWithData("websocket-refused", "", webSocketModule)), rt.CapabilitiesFromConfig(config))
+
+	if res, err := r.Do(rt.NewJob("websocket-refused", wsURL)).Then(); err == nil && len(res.([]byte)) > 0 {
+		t.Errorf("expected connection to be refused, got: %q", string(res.([]byte)))
+	}
+}
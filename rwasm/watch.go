@@ -0,0 +1,213 @@
+package rwasm
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// WatchInterval is how often watched module files are checked for changes
+var WatchInterval = time.Millisecond * 250
+
+// Watch reloads the Runnable registered as jobType whenever the module file at path changes, so that Runnable authors
+// can rebuild their module and try it without restarting the host. Each reload uses a new Runner created with
+// options, and the jobs that were sent to the old one are allowed to finish first (see rt.Reactr.Reload). The Runners
+// that Watch creates are closed once they've been replaced and their jobs are finished. Files that can't be compiled,
+// such as while they're still being written, are skipped until they change again and the current Runner is kept.
+//
+// Watch is intended for development. It returns a function that stops watching the file.
+func Watch(r *rt.Reactr, jobType, path string, options ...Option) (func(), error) {
+	if !r.IsRegistered(jobType) {
+		return nil, fmt.Errorf("jobType %q is not registered", jobType)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to Stat module")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to ReadFile for module")
+	}
+
+	w := &moduleWatcher{
+		reactr:  r,
+		jobType: jobType,
+		path:    path,
+		options: options,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		digest:  moduleref.Digest(data),
+		stop:    make(chan struct{}),
+	}
+
+	go w.watch()
+
+	stopOnce := sync.Once{}
+
+	stop := func() {
+		stopOnce.Do(func() {
+			close(w.stop)
+		})
+	}
+
+	return stop, nil
+}
+
+// moduleWatcher polls a module file, which works with editors and build tools that replace files rather than writing them
+type moduleWatcher struct {
+	reactr  *rt.Reactr
+	jobType string
+	path    string
+	options []Option
+
+	// modTime and size are from the last time the file was checked, and digest is of the module that was last loaded
+	modTime time.Time
+	size    int64
+	digest  string
+
+	// runner is the Runner that the watcher last reloaded the jobType with, or nil if it hasn't reloaded it yet
+	runner *watchedRunner
+
+	stop chan struct{}
+}
+
+// watchedRunner is a Runner created by a moduleWatcher, which signals when the worker using it has stopped all of
+// its threads (such as when the worker has been retired by the next reload) so that the watcher can close it
+type watchedRunner struct {
+	*Runner
+
+	threads  int
+	stopped  chan struct{}
+	stopOnce sync.Once
+	lock     sync.Mutex
+}
+
+func newWatchedRunner(runner *Runner) *watchedRunner {
+	return &watchedRunner{
+		Runner:  runner,
+		stopped: make(chan struct{}),
+	}
+}
+
+// OnChange runs when a worker starts or stops using this Runnable
+func (w *watchedRunner) OnChange(evt rt.ChangeEvent) error {
+	if err := w.Runner.OnChange(evt); err != nil {
+		return err
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	switch evt {
+	case rt.ChangeTypeStart:
+		w.threads++
+	case rt.ChangeTypeStop:
+		w.threads--
+
+		if w.threads == 0 {
+			w.stopOnce.Do(func() {
+				close(w.stopped)
+			})
+		}
+	}
+
+	return nil
+}
+
+func (w *moduleWatcher) watch() {
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.check(); err != nil {
+				runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] failed to reload %s from %s", w.jobType, w.path))
+			}
+		}
+	}
+}
+
+// check reloads the Runnable if its module has changed since it was last checked
+func (w *moduleWatcher) check() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		// the file may be in the middle of being replaced
+		return nil
+	}
+
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return nil
+	}
+
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to ReadFile")
+	}
+
+	digest := moduleref.Digest(data)
+	if digest == w.digest {
+		return nil
+	}
+
+	module, err := moduleref.Decompress(data)
+	if err != nil {
+		return errors.Wrap(err, "failed to Decompress")
+	}
+
+	// a module that is still being written (or failed to build) shouldn't replace one that works
+	if err := runtime.CheckModule(module); err != nil {
+		return errors.Wrap(err, "failed to CheckModule")
+	}
+
+	ref := &moduleref.WasmModuleRef{
+		Filepath: w.path,
+		Name:     w.jobType,
+		Data:     module,
+	}
+
+	next := newWatchedRunner(NewRunnerWithRef(ref, w.options...))
+
+	// CheckModule only looks at the module's header and imports, so the module is compiled and instantiated
+	// before anything is swapped. The instance is kept for the new worker, so the module isn't compiled twice
+	if err := next.env.Prepare(1); err != nil {
+		next.Close()
+		return errors.Wrap(err, "failed to Prepare")
+	}
+
+	if err := w.reactr.Reload(w.jobType, next); err != nil {
+		next.Close()
+		return errors.Wrap(err, "failed to Reload")
+	}
+
+	w.digest = digest
+
+	// the previous Runner is closed once the worker it was replaced in has finished its jobs. The Runner
+	// that the jobType was registered with isn't the watcher's to close, so it's left to its owner
+	if previous := w.runner; previous != nil {
+		go func() {
+			<-previous.stopped
+			previous.Close()
+		}()
+	}
+
+	w.runner = next
+
+	runtime.InternalLogger().Info(fmt.Sprintf("[rwasm] reloaded %s from %s", w.jobType, w.path))
+
+	return nil
+}
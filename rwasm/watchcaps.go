@@ -0,0 +1,135 @@
+package rwasm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/suborbital/reactr/rcap"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/reactr/rwasm/moduleref"
+	"github.com/suborbital/reactr/rwasm/runtime"
+)
+
+// WatchCaps updates the Capabilities of the Runnables registered as jobTypes from the capabilities config file at path,
+// and again whenever the file changes, so that things like cache backends, auth headers and allowlists can be rotated
+// without restarting the host or its workers (see rt.Reactr.UpdateCaps). The file is YAML (or JSON) in the same format
+// as the capabilities of a bundle's Runnable, and each capability it configures replaces the Reactr instance's default
+// in the same way, keeping anything that can only be set by the host. Later changes that can't be parsed are skipped
+// until the file changes again.
+//
+// It checks the file every WatchInterval, and returns a function that stops watching it.
+func WatchCaps(r *rt.Reactr, path string, jobTypes ...string) (func(), error) {
+	for _, jobType := range jobTypes {
+		if !r.IsRegistered(jobType) {
+			return nil, fmt.Errorf("jobType %q is not registered", jobType)
+		}
+	}
+
+	w := &capsWatcher{
+		reactr:   r,
+		path:     path,
+		jobTypes: jobTypes,
+		stop:     make(chan struct{}),
+	}
+
+	if err := w.check(); err != nil {
+		return nil, errors.Wrap(err, "failed to load capabilities config")
+	}
+
+	go w.watch()
+
+	stopOnce := sync.Once{}
+
+	stop := func() {
+		stopOnce.Do(func() {
+			close(w.stop)
+		})
+	}
+
+	return stop, nil
+}
+
+// capsWatcher polls a capabilities config file in the same way as moduleWatcher polls a module
+type capsWatcher struct {
+	reactr   *rt.Reactr
+	path     string
+	jobTypes []string
+
+	// modTime and size are from the last time the file was checked, and digest is of the config that was last applied
+	modTime time.Time
+	size    int64
+	digest  string
+
+	stop chan struct{}
+}
+
+func (w *capsWatcher) watch() {
+	ticker := time.NewTicker(WatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if err := w.check(); err != nil {
+				runtime.InternalLogger().Error(errors.Wrapf(err, "[rwasm] failed to update capabilities from %s", w.path))
+			}
+		}
+	}
+}
+
+// check updates the Runnables' Capabilities if the config file has changed since it was last checked
+func (w *capsWatcher) check() error {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		if w.digest != "" {
+			// the file may be in the middle of being replaced
+			return nil
+		}
+
+		return errors.Wrap(err, "failed to Stat")
+	}
+
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return nil
+	}
+
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to ReadFile")
+	}
+
+	digest := moduleref.Digest(data)
+	if digest == w.digest {
+		return nil
+	}
+
+	config := &rcap.CapabilityConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return errors.Wrap(err, "failed to Unmarshal")
+	}
+
+	caps := bundleCapabilities(w.reactr.DefaultCaps(), config, nil)
+
+	for _, jobType := range w.jobTypes {
+		if err := w.reactr.UpdateCaps(jobType, caps); err != nil {
+			return errors.Wrapf(err, "failed to UpdateCaps for %s", jobType)
+		}
+	}
+
+	w.digest = digest
+
+	runtime.InternalLogger().Info(fmt.Sprintf("[rwasm] updated capabilities from %s", w.path))
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package rwebhook
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/suborbital/reactr/request"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// DefaultMaxBodySize is the largest request body accepted by a Webhook that doesn't set MaxBodySize
+const DefaultMaxBodySize = 5 << 20
+
+// Webhook maps an inbound webhook endpoint to a jobType
+type Webhook struct {
+	// Name is used as the endpoint's path, i.e. /webhook/{Name}
+	Name    string
+	JobType string
+
+	// Verifier validates the request's signature, and if nil, no verification is done
+	Verifier Verifier
+
+	// MaxBodySize is the largest request body accepted, in bytes. Larger requests are rejected before their
+	// signature is verified, and if 0, DefaultMaxBodySize is used
+	MaxBodySize int64
+}
+
+// Receiver accepts webhook requests and schedules jobs for them
+type Receiver struct {
+	reactr *rt.Reactr
+	log    *vlog.Logger
+
+	hooks map[string]Webhook
+	lock  sync.RWMutex
+}
+
+type hookResponse struct {
+	ResultID string `json:"resultId"`
+}
+
+// NewReceiver creates a Receiver that schedules jobs on the provided Reactr instance
+func NewReceiver(r *rt.Reactr, log *vlog.Logger) *Receiver {
+	rc := &Receiver{
+		reactr: r,
+		log:    log,
+		hooks:  map[string]Webhook{},
+		lock:   sync.RWMutex{},
+	}
+
+	return rc
+}
+
+// Add adds a webhook to the Receiver, replacing any existing webhook with the same name
+func (rc *Receiver) Add(hook Webhook) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	rc.hooks[hook.Name] = hook
+}
+
+// Remove removes a webhook from the Receiver
+func (rc *Receiver) Remove(name string) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+
+	delete(rc.hooks, name)
+}
+
+// Routes returns a route group that can be mounted on a vk.Server to serve the Receiver's webhooks
+func (rc *Receiver) Routes() *vk.RouteGroup {
+	group := vk.Group("/webhook")
+	group.POST("/:name", rc.handler())
+
+	return group
+}
+
+func (rc *Receiver) handler() vk.HandlerFunc {
+	return func(r *http.Request, ctx *vk.Ctx) (interface{}, error) {
+		hook, exists := rc.getHook(ctx.Params.ByName("name"))
+		if !exists {
+			return nil, vk.E(http.StatusNotFound, "webhook not found")
+		}
+
+		maxBodySize := hook.MaxBodySize
+		if maxBodySize <= 0 {
+			maxBodySize = DefaultMaxBodySize
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return nil, vk.E(http.StatusRequestEntityTooLarge, "request body is too large")
+			}
+
+			return nil, vk.E(http.StatusInternalServerError, "failed to read request body")
+		}
+
+		r.Body.Close()
+
+		if hook.Verifier != nil {
+			if err := hook.Verifier.Verify(r, body); err != nil {
+				ctx.Log.Error(errors.Wrapf(err, "failed to Verify webhook %s", hook.Name))
+				return nil, vk.E(http.StatusUnauthorized, "failed to verify webhook signature")
+			}
+		}
+
+		// the body was already read for verification, so replace it before building the request
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		req, err := request.FromVKRequest(r, ctx)
+		if err != nil {
+			return nil, vk.Wrap(http.StatusInternalServerError, err)
+		}
+
+		reqJSON, err := req.ToJSON()
+		if err != nil {
+			return nil, vk.Wrap(http.StatusInternalServerError, err)
+		}
+
+		res := rc.reactr.Do(rt.NewJob(hook.JobType, reqJSON))
+
+		res.ThenDo(func(_ interface{}, err error) {
+			if err != nil {
+				rc.log.Error(errors.Wrapf(err, "job for webhook %s returned error result", hook.Name))
+			}
+		})
+
+		resp := hookResponse{
+			ResultID: res.UUID(),
+		}
+
+		return vk.R(http.StatusAccepted, resp), nil
+	}
+}
+
+func (rc *Receiver) getHook(name string) (Webhook, bool) {
+	rc.lock.RLock()
+	defer rc.lock.RUnlock()
+
+	hook, exists := rc.hooks[name]
+
+	return hook, exists
+}
@@ -0,0 +1,132 @@
+package rwebhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/suborbital/reactr/request"
+	"github.com/suborbital/reactr/rt"
+	"github.com/suborbital/vektor/vk"
+	"github.com/suborbital/vektor/vlog"
+)
+
+// capture sends the body of each webhook request it receives to its channel
+type capture struct {
+	bodies chan string
+}
+
+func (c capture) Run(job rt.Job, ctx *rt.Ctx) (interface{}, error) {
+	req, err := request.FromJSON(job.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	c.bodies <- string(req.Body)
+
+	return nil, nil
+}
+
+func (c capture) OnChange(change rt.ChangeEvent) error {
+	return nil
+}
+
+func setupReceiver(hook Webhook) (*vk.Router, chan string) {
+	log := vlog.Default(vlog.Level(vlog.LogLevelError))
+
+	r := rt.New()
+	bodies := make(chan string, 1)
+	r.Register(hook.JobType, capture{bodies})
+
+	receiver := NewReceiver(r, log)
+	receiver.Add(hook)
+
+	router := vk.NewRouter(log)
+	router.AddGroup(receiver.Routes())
+	router.Finalize()
+
+	return router, bodies
+}
+
+func TestReceiver(t *testing.T) {
+	router, bodies := setupReceiver(Webhook{
+		Name:        "github",
+		JobType:     "capture",
+		Verifier:    GitHubVerifier("shhh"),
+		MaxBodySize: 64,
+	})
+
+	body := `{"action":"opened"}`
+
+	t.Run("accepted", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+sign("shhh", body))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Fatal("expected 202, got", w.Code)
+		}
+
+		resp := hookResponse{}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ResultID == "" {
+			t.Error("expected response with result ID, got", w.Body.String())
+		}
+
+		select {
+		case received := <-bodies:
+			if received != body {
+				t.Errorf("expected job to receive %q, got %q", body, received)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("job was not run")
+		}
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(body))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+sign("nope", body))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Error("expected 401, got", w.Code)
+		}
+	})
+
+	t.Run("unknown webhook", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/webhook/stripe", strings.NewReader(body))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNotFound {
+			t.Error("expected 404, got", w.Code)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		large := `{"action":"` + strings.Repeat("a", 64) + `"}`
+
+		req := httptest.NewRequest(http.MethodPost, "/webhook/github", strings.NewReader(large))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+sign("shhh", large))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Error("expected 413, got", w.Code)
+		}
+	})
+
+	select {
+	case received := <-bodies:
+		t.Errorf("expected only one job to run, also got %q", received)
+	default:
+	}
+}
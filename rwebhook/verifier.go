@@ -0,0 +1,185 @@
+package rwebhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrSignatureMissing and others are errors related to webhook signature verification
+var (
+	ErrSignatureMissing   = errors.New("webhook signature missing")
+	ErrSignatureInvalid   = errors.New("webhook signature invalid")
+	ErrTimestampExpired   = errors.New("webhook timestamp outside of tolerance")
+	ErrSignatureMalformed = errors.New("webhook signature malformed")
+)
+
+// Verifier validates the signature of an inbound webhook request
+type Verifier interface {
+	Verify(r *http.Request, body []byte) error
+}
+
+// VerifierFunc is a function that can be used as a Verifier
+type VerifierFunc func(r *http.Request, body []byte) error
+
+// Verify calls the VerifierFunc
+func (v VerifierFunc) Verify(r *http.Request, body []byte) error {
+	return v(r, body)
+}
+
+// hmacVerifier verifies a hex-encoded HMAC of the request body found in a header
+type hmacVerifier struct {
+	header  string
+	prefix  string
+	secret  []byte
+	newHash func() hash.Hash
+}
+
+// HMACSHA256Verifier returns a Verifier that checks for a hex-encoded HMAC-SHA256 of the request body in the given header
+func HMACSHA256Verifier(header, secret string) Verifier {
+	h := &hmacVerifier{
+		header:  header,
+		secret:  []byte(secret),
+		newHash: sha256.New,
+	}
+
+	return h
+}
+
+// GitHubVerifier returns a Verifier for GitHub's `X-Hub-Signature-256` header
+func GitHubVerifier(secret string) Verifier {
+	h := &hmacVerifier{
+		header:  "X-Hub-Signature-256",
+		prefix:  "sha256=",
+		secret:  []byte(secret),
+		newHash: sha256.New,
+	}
+
+	return h
+}
+
+// GitHubLegacyVerifier returns a Verifier for GitHub's deprecated SHA-1 `X-Hub-Signature` header
+func GitHubLegacyVerifier(secret string) Verifier {
+	h := &hmacVerifier{
+		header:  "X-Hub-Signature",
+		prefix:  "sha1=",
+		secret:  []byte(secret),
+		newHash: sha1.New,
+	}
+
+	return h
+}
+
+// Verify verifies the request
+func (h *hmacVerifier) Verify(r *http.Request, body []byte) error {
+	sig := r.Header.Get(h.header)
+	if sig == "" {
+		return ErrSignatureMissing
+	}
+
+	if !strings.HasPrefix(sig, h.prefix) {
+		return ErrSignatureMalformed
+	}
+
+	sigBytes, err := hex.DecodeString(strings.TrimPrefix(sig, h.prefix))
+	if err != nil {
+		return ErrSignatureMalformed
+	}
+
+	mac := hmac.New(h.newHash, h.secret)
+	mac.Write(body)
+
+	if !hmac.Equal(sigBytes, mac.Sum(nil)) {
+		return ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// stripeVerifier verifies Stripe's `Stripe-Signature` header
+type stripeVerifier struct {
+	secret    []byte
+	tolerance time.Duration
+}
+
+// StripeVerifier returns a Verifier for Stripe's `Stripe-Signature` header.
+// Events with a timestamp older than tolerance are rejected to prevent replay attacks,
+// and a tolerance of 0 uses Stripe's recommended default of 5 minutes.
+func StripeVerifier(secret string, tolerance time.Duration) Verifier {
+	if tolerance == 0 {
+		tolerance = time.Minute * 5
+	}
+
+	s := &stripeVerifier{
+		secret:    []byte(secret),
+		tolerance: tolerance,
+	}
+
+	return s
+}
+
+// Verify verifies the request
+func (s *stripeVerifier) Verify(r *http.Request, body []byte) error {
+	header := r.Header.Get("Stripe-Signature")
+	if header == "" {
+		return ErrSignatureMissing
+	}
+
+	// the header is formatted as t=timestamp,v1=signature,v1=signature...
+	timestamp := ""
+	signatures := [][]byte{}
+
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return ErrSignatureMalformed
+		}
+
+		switch parts[0] {
+		case "t":
+			timestamp = parts[1]
+		case "v1":
+			sig, err := hex.DecodeString(parts[1])
+			if err != nil {
+				return ErrSignatureMalformed
+			}
+
+			signatures = append(signatures, sig)
+		}
+	}
+
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrSignatureMalformed
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrSignatureMalformed
+	}
+
+	if time.Since(time.Unix(unix, 0)) > s.tolerance {
+		return ErrTimestampExpired
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+
+	return ErrSignatureInvalid
+}
@@ -0,0 +1,87 @@
+package rwebhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func sign(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestGitHubVerifier(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	verifier := GitHubVerifier("shhh")
+
+	t.Run("valid", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodPost, "/webhook/github", nil)
+		r.Header.Set("X-Hub-Signature-256", "sha256="+sign("shhh", string(body)))
+
+		if err := verifier.Verify(r, body); err != nil {
+			t.Error("expected no error, got", err)
+		}
+	})
+
+	t.Run("wrong secret", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodPost, "/webhook/github", nil)
+		r.Header.Set("X-Hub-Signature-256", "sha256="+sign("nope", string(body)))
+
+		if err := verifier.Verify(r, body); err != ErrSignatureInvalid {
+			t.Error("expected ErrSignatureInvalid, got", err)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		r, _ := http.NewRequest(http.MethodPost, "/webhook/github", nil)
+
+		if err := verifier.Verify(r, body); err != ErrSignatureMissing {
+			t.Error("expected ErrSignatureMissing, got", err)
+		}
+	})
+}
+
+func TestStripeVerifier(t *testing.T) {
+	body := []byte(`{"type":"charge.succeeded"}`)
+	verifier := StripeVerifier("whsec", 0)
+
+	t.Run("valid", func(t *testing.T) {
+		ts := fmt.Sprintf("%d", time.Now().Unix())
+
+		r, _ := http.NewRequest(http.MethodPost, "/webhook/stripe", nil)
+		r.Header.Set("Stripe-Signature", fmt.Sprintf("t=%s,v1=%s,v0=abc", ts, sign("whsec", ts+"."+string(body))))
+
+		if err := verifier.Verify(r, body); err != nil {
+			t.Error("expected no error, got", err)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		ts := fmt.Sprintf("%d", time.Now().Add(-time.Hour).Unix())
+
+		r, _ := http.NewRequest(http.MethodPost, "/webhook/stripe", nil)
+		r.Header.Set("Stripe-Signature", fmt.Sprintf("t=%s,v1=%s", ts, sign("whsec", ts+"."+string(body))))
+
+		if err := verifier.Verify(r, body); err != ErrTimestampExpired {
+			t.Error("expected ErrTimestampExpired, got", err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		ts := fmt.Sprintf("%d", time.Now().Unix())
+
+		r, _ := http.NewRequest(http.MethodPost, "/webhook/stripe", nil)
+		r.Header.Set("Stripe-Signature", fmt.Sprintf("t=%s,v1=%s", ts, sign("whsec", ts+"."+string(body))))
+
+		if err := verifier.Verify(r, []byte(`{"type":"charge.refunded"}`)); err != ErrSignatureInvalid {
+			t.Error("expected ErrSignatureInvalid, got", err)
+		}
+	})
+}